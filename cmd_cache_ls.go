@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/blobstore"
+	"github.com/datawire/ocibuild/pkg/cache"
+	"github.com/datawire/ocibuild/pkg/cliutil"
+)
+
+func init() {
+	var cacheDir string
+	cmd := &cobra.Command{
+		Use:   "ls [flags]",
+		Short: "List the entries in the local download cache",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			store, err := openCache(cacheDir)
+			if err != nil {
+				return err
+			}
+			entries, err := store.List()
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "DIGEST\tSIZE\tLAST USED")
+			for _, entry := range entries {
+				fmt.Fprintf(tw, "%s\t%d\t%s\n", entry.Digest, entry.Size, entry.LastUsed.UTC().Format(time.RFC3339))
+			}
+			return tw.Flush()
+		},
+	}
+	addCacheDirFlag(cmd, &cacheDir)
+	argparserCache.AddCommand(cmd)
+}
+
+// addCacheDirFlag adds a --cache-dir flag; pass its value to openCache.
+func addCacheDirFlag(cmd *cobra.Command, cacheDir *string) {
+	cmd.Flags().StringVar(cacheDir, "cache-dir", "",
+		"Use `DIR` as the local download cache; if empty, use \"ocibuild\" inside of the "+
+			"user cache directory, such as ~/.cache/ocibuild")
+}
+
+// openCache returns the cache.Store for a --cache-dir flag value, backed by the global
+// --cache-registry if it is set (and --hermetic is not).
+func openCache(cacheDir string) (cache.Store, error) {
+	if cacheDir == "" {
+		var err error
+		cacheDir, err = cache.DefaultDir()
+		if err != nil {
+			return cache.Store{}, err
+		}
+	}
+	store := cache.Store{Dir: cacheDir, Remote: nil}
+	// The cache is an optimization, not an input, so with --hermetic just don't use the registry
+	// rather than failing.
+	if cacheRegistry != "" && !hermeticMode {
+		remote, err := blobstore.NewRegistry(cacheRegistry, registryOptions()...)
+		if err != nil {
+			return cache.Store{}, fmt.Errorf("invalid --cache-registry: %w", err)
+		}
+		store.Remote = remote
+	}
+	return store, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+)
+
+func init() {
+	var (
+		cacheDir string
+		maxSize  cliutil.ByteSize
+		maxAge   time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "prune [flags]",
+		Short: "Remove old entries from the local download cache",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+		Long: "Remove entries from the local download cache that have not been used " +
+			"within --max-age, and then remove least-recently-used entries until the " +
+			"cache is no larger than --max-size.  Partial downloads (kept so that failed " +
+			"downloads can be resumed) that have not been touched within --max-age are " +
+			"removed too.  It is safe to run this while other " +
+			"ocibuild processes are using the cache.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if maxSize == 0 && maxAge == 0 {
+				return cliutil.FlagErrorFunc(cmd, fmt.Errorf("at least one of --max-size or --max-age is required"))
+			}
+			store, err := openCache(cacheDir)
+			if err != nil {
+				return err
+			}
+			removed, err := store.Prune(int64(maxSize), maxAge, time.Now())
+			var total int64
+			for _, entry := range removed {
+				total += entry.Size
+			}
+			dlog.Infof(cmd.Context(), "removed %d entries (%d bytes)", len(removed), total)
+			return err
+		},
+	}
+	addCacheDirFlag(cmd, &cacheDir)
+	cmd.Flags().Var(&maxSize, "max-size",
+		"Remove least-recently-used entries until the cache is at most `SIZE` (such as '10Gi')")
+	cmd.Flags().DurationVar(&maxAge, "max-age", 0,
+		"Remove entries that have not been used within `DURATION` (such as '720h')")
+	argparserCache.AddCommand(cmd)
+}
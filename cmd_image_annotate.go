@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/annotations"
+	"github.com/datawire/ocibuild/pkg/cliutil"
+)
+
+func init() {
+	var (
+		tag      string
+		setBoth  []string
+		setLabel []string
+		setAnnot []string
+		gitMode  string
+		gitDir   string
+		inFlags  imageFileFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "annotate [flags] IN_IMAGEFILE >OUT_IMAGEFILE",
+		Short: "Set OCI annotations and labels on an image",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Set annotations on an image's manifest and labels in its config, such as the " +
+			"pre-defined OCI annotations (" + annotations.Source + ", " + annotations.Revision +
+			", " + annotations.Created + ", and so on)." +
+			"\n\n" +
+			"With --git=auto (the default), if the current directory (or --git-dir) is inside " +
+			"of a Git repository, then " + annotations.Source + " is set to the URL of the " +
+			"'origin' remote, " + annotations.Revision + " to the commit ID of HEAD, and " +
+			annotations.Created + " to $SOURCE_DATE_EPOCH or else the commit time of HEAD " +
+			"(never the current time, so that builds are reproducible).  These are set both " +
+			"as annotations and as labels, and may be overridden with the --set flags.  With " +
+			"--git=always it is an error to not be in a Git repository, and with --git=never " +
+			"Git is not consulted." +
+			"\n\n" +
+			"A --set-label value that is empty removes that label." +
+			"\n\n" +
+			"LIMITATION: The Docker image file format that ocibuild reads and writes does " +
+			"not have a place for manifest annotations, so they are lost when the image is " +
+			"written; use labels (or --set, which sets both) for information that must be " +
+			"kept.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			ctx := flags.Context()
+			img, err := inFlags.Open(args[0])
+			if err != nil {
+				return err
+			}
+			var ref name.Reference
+			if tag != "" {
+				ref, err = name.NewTag(tag)
+				if err != nil {
+					return err
+				}
+			}
+
+			labels := make(map[string]string)
+			annots := make(map[string]string)
+			switch gitMode {
+			case "auto", "always":
+				fromGit, err := annotations.FromGit(ctx, gitDir)
+				if err != nil {
+					if gitMode == "always" {
+						return err
+					}
+					dlog.Debugf(ctx, "not setting annotations from Git: %v", err)
+				}
+				for k, v := range fromGit {
+					labels[k] = v
+					annots[k] = v
+				}
+			case "never":
+			default:
+				return fmt.Errorf("invalid --git %q: must be 'auto', 'always', or 'never'", gitMode)
+			}
+			for _, item := range []struct {
+				flag  string
+				vals  []string
+				dests []map[string]string
+			}{
+				{"--set", setBoth, []map[string]string{labels, annots}},
+				{"--set-label", setLabel, []map[string]string{labels}},
+				{"--set-annotation", setAnnot, []map[string]string{annots}},
+			} {
+				for _, kv := range item.vals {
+					eq := strings.Index(kv, "=")
+					if eq <= 0 {
+						return fmt.Errorf("invalid %s %q: must be 'KEY=VALUE'", item.flag, kv)
+					}
+					for _, dest := range item.dests {
+						dest[kv[:eq]] = kv[eq+1:]
+					}
+				}
+			}
+
+			img, err = annotations.Apply(img, annots, labels)
+			if err != nil {
+				return err
+			}
+			return inFlags.Write(args[0], ref, img, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "Tag the resulting image as `TAG`")
+	if err := cmd.RegisterFlagCompletionFunc("tag", completeDockerImages); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringArrayVar(&setBoth, "set", nil,
+		"Set both the annotation and the label `KEY=VALUE`; may be given multiple times")
+	cmd.Flags().StringArrayVar(&setLabel, "set-label", nil,
+		"Set the config label `KEY=VALUE`; may be given multiple times")
+	cmd.Flags().StringArrayVar(&setAnnot, "set-annotation", nil,
+		"Set the manifest annotation `KEY=VALUE`; may be given multiple times")
+	cmd.Flags().StringVar(&gitMode, "git", "auto",
+		"Whether to set the source, revision, and created annotations from Git: "+
+			"'auto', 'always', or 'never'")
+	if err := cmd.RegisterFlagCompletionFunc("git", completeWords("auto", "always", "never")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&gitDir, "git-dir", ".",
+		"With --git, look for the Git repository containing `DIR`")
+	if err := cmd.RegisterFlagCompletionFunc("git-dir", completeDirs); err != nil {
+		panic(err)
+	}
+
+	addImageFileFlags(cmd, &inFlags, true)
+
+	argparserImage.AddCommand(cmd)
+}
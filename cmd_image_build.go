@@ -1,19 +1,24 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 
+	"github.com/datawire/dlib/dlog"
 	"github.com/google/go-containerregistry/pkg/name"
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
-	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
+	"github.com/datawire/ocibuild/pkg/annotations"
 	"github.com/datawire/ocibuild/pkg/cliutil"
 	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/squash"
 )
 
 type configFlags struct {
@@ -32,11 +37,16 @@ type configFlags struct {
 	// WorkingDir
 	workingDir string
 	// Labels
+	labelsSet []string
 	// StopSignal
 	// Memory
 	// MemorySwap
 	// CpuShares
 	// Healthcheck
+
+	// Not part of the config itself.
+	template       bool
+	templateGitDir string
 }
 
 func (flags *configFlags) AddFlagsTo(prefix string, flagset *pflag.FlagSet) {
@@ -60,21 +70,42 @@ func (flags *configFlags) AddFlagsTo(prefix string, flagset *pflag.FlagSet) {
 	flagset.StringVarP(&flags.workingDir, prefix+"WorkingDir", "w", "",
 		"Set the resulting image's `working-directory`")
 	// Labels
+	flagset.StringArrayVarP(&flags.labelsSet, prefix+"Labels.set", "l", nil,
+		"Set the label `KEY=VALUE` in the resulting image's config; an empty VALUE removes the label")
 	// StopSignal
 	// Memory
 	// MemorySwap
 	// CpuShares
 	// Healthcheck
+
+	flagset.BoolVar(&flags.template, prefix+"template", false,
+		"Expand the values of --"+prefix+"Env.append and --"+prefix+"Labels.set as templates "+
+			"referencing build metadata")
+	flagset.StringVar(&flags.templateGitDir, prefix+"template-git-dir", ".",
+		"With --"+prefix+"template, get .GitSHA and .Epoch from the Git repository containing `DIR`")
 }
 
 func (flags configFlags) IsZero() bool {
 	// Because it contains slices, we con't just use `== configFlags{}` because Go won't let you
 	// compare slices.  We could manually check each field, but this is easier.
+	flags.templateGitDir = ""
 	return reflect.ValueOf(flags).IsZero()
 }
 
-func (flags configFlags) ApplyTo(config *ociv1.Config) {
+// ApplyTo modifies config per the flags.  If --config.template was given, then data is used to
+// expand the Env and Labels values, and must be non-nil.
+func (flags configFlags) ApplyTo(config *ociv1.Config, data *annotations.TemplateData) error {
 	// https://github.com/opencontainers/image-spec/blob/main/config.md
+	expand := func(flagname, val string) (string, error) {
+		if !flags.template {
+			return val, nil
+		}
+		ret, err := annotations.Expand(val, data)
+		if err != nil {
+			return "", fmt.Errorf("%s %q: %w", flagname, val, err)
+		}
+		return ret, nil
+	}
 
 	// User
 
@@ -84,7 +115,15 @@ func (flags configFlags) ApplyTo(config *ociv1.Config) {
 	if flags.envClear {
 		config.Env = nil
 	}
-	config.Env = append(config.Env, flags.envAppend...)
+	// Don't append to the base image's slice in-place.
+	config.Env = append([]string(nil), config.Env...)
+	for _, kv := range flags.envAppend {
+		kv, err := expand("--config.Env.append", kv)
+		if err != nil {
+			return err
+		}
+		config.Env = append(config.Env, kv)
+	}
 
 	// Entrypoint
 	if flags.entrypoint != nil {
@@ -104,6 +143,29 @@ func (flags configFlags) ApplyTo(config *ociv1.Config) {
 	}
 
 	// Labels
+	if len(flags.labelsSet) > 0 {
+		// Don't modify the base image's map in-place.
+		labels := make(map[string]string, len(config.Labels)+len(flags.labelsSet))
+		for k, v := range config.Labels {
+			labels[k] = v
+		}
+		for _, kv := range flags.labelsSet {
+			eq := strings.Index(kv, "=")
+			if eq <= 0 {
+				return fmt.Errorf("invalid --config.Labels.set %q: must be 'KEY=VALUE'", kv)
+			}
+			val, err := expand("--config.Labels.set", kv[eq+1:])
+			if err != nil {
+				return err
+			}
+			if val == "" {
+				delete(labels, kv[:eq])
+			} else {
+				labels[kv[:eq]] = val
+			}
+		}
+		config.Labels = labels
+	}
 
 	// StopSignal
 
@@ -114,18 +176,56 @@ func (flags configFlags) ApplyTo(config *ociv1.Config) {
 	// CpuShares
 
 	// Healthcheck
+
+	return nil
 }
 
 func init() {
 	var flags struct {
-		base   string
-		tag    string
-		config configFlags
+		base       string
+		tag        string
+		dedup      bool
+		layerWheel []string
+		dryRun     bool
+		outLayout  string
+		config     configFlags
 	}
 	cmd := &cobra.Command{
 		Use:   "build [flags] IN_LAYERFILES... >OUT_IMAGEFILE",
 		Short: "Combine layers in to a complete image",
 		Args:  cliutil.WrapPositionalArgs(cobra.MinimumNArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Combine layers in to a complete image, on top of an optional base image, and " +
+			"write the image to stdout." +
+			"\n\n" +
+			"With --config.template, the values given to --config.Env.append and " +
+			"--config.Labels.set are Go text/templates that may reference build metadata: " +
+			"{{ .GitSHA }} is the commit ID of HEAD of the Git repository containing " +
+			"--config.template-git-dir, {{ .Epoch }} is $SOURCE_DATE_EPOCH or else the commit " +
+			"time of HEAD (in seconds since the Unix epoch), and {{ .WheelVersions \"NAME\" }} " +
+			"is the version of the Python distribution NAME installed in the resulting image.  " +
+			"These never depend on the current time, so the result is reproducible; and it is " +
+			"an error to reference metadata that isn't available.  For example:" +
+			"\n\n" +
+			"    ocibuild image build --base=base.tar --config.template \\\n" +
+			"        --config.Env.append='APP_VERSION={{ .WheelVersions \"flask\" }}' \\\n" +
+			"        --config.Labels.set='build.revision={{ .GitSHA }}' \\\n" +
+			"        app.layer.tar >app.tar" +
+			"\n\n" +
+			"--layer-wheel takes a 'LAYERFILE=WHEELFILE' pair, naming one of the IN_LAYERFILES " +
+			"and the Python wheel that it was installed from (with 'ocibuild layer wheel'); " +
+			"the layer's descriptor in the image's manifest is annotated with " +
+			"'" + annotations.Wheel + "=FILENAME sha256=HEX' so that tools can map the layer " +
+			"back to its Python input.  LIMITATION: The Docker image file format that ocibuild " +
+			"writes does not have a place for manifest annotations, so these are only kept " +
+			"when the image is pushed or written by a tool that uses the Go API." +
+			"\n\n" +
+			"With --dry-run, the image is not written; instead a YAML description of the input " +
+			"files (their sizes and digests) and of the image that would be written is written " +
+			"to stdout.",
+
 		RunE: func(cmd *cobra.Command, args []string) error {
 			base := empty.Image
 			if flags.base != "" {
@@ -152,8 +252,35 @@ func init() {
 				}
 				layers = append(layers, layer)
 			}
+			layerAnnotations, err := parseLayerWheelFlags(flags.layerWheel, args)
+			if err != nil {
+				return cliutil.FlagErrorFunc(cmd, err)
+			}
+
+			if flags.dryRun {
+				return planImageBuild(flags.base, base, tag, args, flags.dedup, !flags.config.IsZero())
+			}
+
+			if flags.dedup {
+				baseLayers, err := base.Layers()
+				if err != nil {
+					return err
+				}
+				deduplicator, err := squash.NewDeduplicator(baseLayers)
+				if err != nil {
+					return err
+				}
+				for i := range layers {
+					var saved int64
+					layers[i], saved, err = deduplicator.Dedup(layers[i])
+					if err != nil {
+						return fmt.Errorf("%s: %w", args[i], err)
+					}
+					dlog.Infof(cmd.Context(), "%s: elided %d bytes already present in lower layers", args[i], saved)
+				}
+			}
 
-			img, err := mutate.AppendLayers(base, layers...)
+			img, err := annotations.AppendLayers(base, layers, layerAnnotations)
 			if err != nil {
 				return err
 			}
@@ -161,7 +288,24 @@ func init() {
 			if !flags.config.IsZero() {
 				configFile, _ := img.ConfigFile()
 
-				flags.config.ApplyTo(&configFile.Config)
+				var data *annotations.TemplateData
+				if flags.config.template {
+					imgLayers, err := img.Layers()
+					if err != nil {
+						return err
+					}
+					fsys, err := squash.Load(imgLayers, false)
+					if err != nil {
+						return err
+					}
+					data, err = annotations.NewTemplateData(cmd.Context(), flags.config.templateGitDir, fsys)
+					if err != nil {
+						return err
+					}
+				}
+				if err := flags.config.ApplyTo(&configFile.Config, data); err != nil {
+					return err
+				}
 
 				img, err = mutate.Config(img, configFile.Config)
 				if err != nil {
@@ -169,7 +313,7 @@ func init() {
 				}
 			}
 
-			if err := ociv1tarball.Write(tag, img, os.Stdout); err != nil {
+			if err := writeImage(flags.outLayout, tag, img, os.Stdout); err != nil {
 				return err
 			}
 			return nil
@@ -177,8 +321,103 @@ func init() {
 	}
 
 	cmd.Flags().StringVar(&flags.base, "base", "", "Use `IN_IMAGEFILE` as the base of the image")
+	cmd.Flags().BoolVar(&flags.dedup, "dedup", false,
+		"Omit files from IN_LAYERFILES that are identical to files already present in the "+
+			"base image (or in earlier IN_LAYERFILES)")
+	cmd.Flags().StringArrayVar(&flags.layerWheel, "layer-wheel", nil,
+		"Annotate LAYERFILE with the WHEELFILE that it was installed from (`LAYERFILE=WHEELFILE`)")
 	cmd.Flags().StringVarP(&flags.tag, "tag", "t", "", "Tag the resulting image as `TAG`")
+	if err := cmd.RegisterFlagCompletionFunc("base", completeFileExt("tar")); err != nil {
+		panic(err)
+	}
+	if err := cmd.RegisterFlagCompletionFunc("tag", completeDockerImages); err != nil {
+		panic(err)
+	}
+	addOutLayoutFlag(cmd, &flags.outLayout)
 	flags.config.AddFlagsTo("config.", cmd.Flags())
+	addDryRunFlag(cmd, &flags.dryRun)
 
 	argparserImage.AddCommand(cmd)
 }
+
+// parseLayerWheelFlags parses the --layer-wheel flags, returning the annotations for each of
+// layerFiles.
+func parseLayerWheelFlags(flagVals []string, layerFiles []string) ([]map[string]string, error) {
+	ret := make([]map[string]string, len(layerFiles))
+	for _, kv := range flagVals {
+		eq := strings.Index(kv, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid --layer-wheel %q: must be 'LAYERFILE=WHEELFILE'", kv)
+		}
+		layerFile, wheelFile := kv[:eq], kv[eq+1:]
+		idx := -1
+		for i := range layerFiles {
+			if layerFiles[i] == layerFile {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid --layer-wheel %q: %q is not one of the layer files", kv, layerFile)
+		}
+		wheel, err := os.Open(wheelFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --layer-wheel %q: %w", kv, err)
+		}
+		digest, _, err := ociv1.SHA256(wheel)
+		_ = wheel.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid --layer-wheel %q: %w", kv, err)
+		}
+		ret[idx] = map[string]string{
+			annotations.Wheel: annotations.FormatWheel(annotations.WheelProvenance{
+				Filename: filepath.Base(wheelFile),
+				Digest:   digest,
+			}),
+		}
+	}
+	return ret, nil
+}
+
+// planImageBuild writes the --dry-run plan for `ocibuild image build`.
+func planImageBuild(
+	baseFile string, base ociv1.Image, tag name.Reference, layerFiles []string, dedup, config bool,
+) error {
+	var p plan
+	details := map[string]string{}
+	baseLayers, err := base.Layers()
+	if err != nil {
+		return err
+	}
+	if baseFile != "" {
+		input, err := planLocalFile(baseFile)
+		if err != nil {
+			return err
+		}
+		p.Inputs = append(p.Inputs, input)
+		details["base"] = baseFile
+	}
+	for _, layerFile := range layerFiles {
+		input, err := planLocalFile(layerFile)
+		if err != nil {
+			return err
+		}
+		p.Inputs = append(p.Inputs, input)
+	}
+	if tag != nil {
+		details["tag"] = tag.String()
+	}
+	details["layers"] = fmt.Sprintf("%d (%d from the base image, %d added)",
+		len(baseLayers)+len(layerFiles), len(baseLayers), len(layerFiles))
+	if dedup {
+		details["dedup"] = "files already present in lower layers would be omitted"
+	}
+	if config {
+		details["config"] = "modified by --config.* flags"
+	}
+	p.Outputs = append(p.Outputs, planOutput{
+		Destination: "stdout",
+		Details:     details,
+	})
+	return writePlan(p)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/du"
+	"github.com/datawire/ocibuild/pkg/progress"
+)
+
+func init() {
+	var (
+		format  string
+		limit   int
+		inFlags imageFileFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "du [flags] IN_IMAGEFILE",
+		Short: "Report what is taking up space in an image",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Report how the space in an image is used, to help track down image bloat.  " +
+			"There are four sections:" +
+			"\n\n" +
+			"The size of each layer: the total size of the files in it, and the compressed " +
+			"size of the layer blob." +
+			"\n\n" +
+			"The size of each top-level directory: both in the squashed filesystem (what a " +
+			"container sees), and across all of the layers (what is stored in the image, " +
+			"including files that later layers replace or remove)." +
+			"\n\n" +
+			"The size of each installed Python distribution, found by its .dist-info " +
+			"directory: the total size of the files listed in its RECORD file, plus compiled " +
+			"bytecode for its .py files." +
+			"\n\n" +
+			"Duplicate files: file contents that are stored in more than one layer, such as " +
+			"a file that a later layer re-adds only to change its permissions, along with " +
+			"how much space the extra copies waste." +
+			"\n\n" +
+			"With --format=table (the default), the directory, distribution, and duplicate " +
+			"sections are each limited to the --limit largest entries.  With --format=json, " +
+			"the output is a JSON object with the keys \"layers\", \"dirs\", \"dists\", and " +
+			"\"duplicates\", which are not limited.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return fmt.Errorf("invalid --format %q: must be 'table' or 'json'", format)
+			}
+			img, err := inFlags.Open(args[0])
+			if err != nil {
+				return err
+			}
+			report, err := du.Image(img)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				bs, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return err
+				}
+				_, err = os.Stdout.Write(append(bs, '\n'))
+				return err
+			}
+			return writeDUReport(os.Stdout, report, limit)
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "table",
+		"Output `FORMAT`; either 'table' or 'json'")
+	if err := cmd.RegisterFlagCompletionFunc("format", completeWords("table", "json")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().IntVar(&limit, "limit", 20,
+		"With --format=table, show at most `N` entries in each section after the layer list (0 for no limit)")
+
+	addImageFileFlags(cmd, &inFlags, false)
+
+	argparserImage.AddCommand(cmd)
+}
+
+// writeDUReport writes a du.Report as plain-text tables.
+func writeDUReport(w io.Writer, report *du.Report, limit int) error {
+	limited := func(n int) int {
+		if limit > 0 && n > limit {
+			return limit
+		}
+		return n
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "LAYER\tSIZE\tCOMPRESSED\tFILES\tCREATED BY")
+	for _, layer := range report.Layers {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\n", layer.Index, progress.FormatBytes(layer.Size),
+			progress.FormatBytes(layer.CompressedSize), layer.Files, layer.CreatedBy)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "DIRECTORY\tSIZE\tIN LAYERS")
+	for _, dir := range report.Dirs[:limited(len(report.Dirs))] {
+		fmt.Fprintf(tw, "/%s\t%s\t%s\n", dir.Name, progress.FormatBytes(dir.Size),
+			progress.FormatBytes(dir.LayerSize))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "DISTRIBUTION\tVERSION\tSIZE\tFILES")
+	for _, dist := range report.Dists[:limited(len(report.Dists))] {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", dist.Name, dist.Version,
+			progress.FormatBytes(dist.Size), dist.Files)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "WASTED\tSIZE\tLAYERS\tPATHS")
+	for _, dup := range report.Duplicates[:limited(len(report.Duplicates))] {
+		var layers, paths []string
+		seenPaths := make(map[string]struct{})
+		for _, c := range dup.Copies {
+			layers = append(layers, strconv.Itoa(c.Layer))
+			if _, seen := seenPaths[c.Path]; !seen {
+				seenPaths[c.Path] = struct{}{}
+				paths = append(paths, "/"+c.Path)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", progress.FormatBytes(dup.Wasted),
+			progress.FormatBytes(dup.Size), strings.Join(layers, ","), strings.Join(paths, " "))
+	}
+	return tw.Flush()
+}
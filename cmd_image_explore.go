@@ -0,0 +1,451 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/progress"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func init() {
+	var (
+		noTUI   bool
+		inFlags imageFileFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "explore [flags] IN_IMAGEFILE",
+		Short: "Interactively explore the layers and files of an image",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Show the layers of an image, and the tree of files in the image, with which " +
+			"layer last changed each path and how much space each file and directory takes up; " +
+			"similar to the `dive` tool." +
+			"\n\n" +
+			"The terminal UI has two panes: the list of layers at the top, and the file tree " +
+			"below it; paths that the selected layer changed are shown in bold.  The keys are:" +
+			"\n\n" +
+			"    Tab            switch between the layer list and the file tree\n" +
+			"    Up/Down, k/j   move the cursor\n" +
+			"    PgUp/PgDn      move the cursor a page at a time\n" +
+			"    Enter, Space   collapse or expand the directory under the cursor\n" +
+			"    f              only show the paths that the selected layer changed\n" +
+			"    q              quit" +
+			"\n\n" +
+			"If stdin or stdout is not a terminal (or with --no-tui), then the layer list and " +
+			"the file tree are printed as plain text instead.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			img, err := inFlags.Open(args[0])
+			if err != nil {
+				return err
+			}
+			layers, err := img.Layers()
+			if err != nil {
+				return err
+			}
+			config, err := img.ConfigFile()
+			if err != nil {
+				return err
+			}
+			root, changes, err := squash.Explore(layers)
+			if err != nil {
+				return err
+			}
+
+			// Match up the history entries with the layers.
+			var createdBy []string
+			for _, entry := range config.History {
+				if !entry.EmptyLayer {
+					createdBy = append(createdBy, entry.CreatedBy)
+				}
+			}
+			if len(createdBy) != len(layers) {
+				createdBy = make([]string, len(layers))
+			}
+			exp := &explorer{ //nolint:exhaustivestruct
+				title:     args[0],
+				root:      root,
+				collapsed: make(map[string]bool),
+			}
+			for i := range layers {
+				layer := exploreLayer{ //nolint:exhaustivestruct
+					createdBy: createdBy[i],
+					changes:   changes[i],
+				}
+				for _, change := range changes[i] {
+					if change.Kind != squash.ChangeRemove {
+						layer.size += change.Size
+					}
+				}
+				exp.layers = append(exp.layers, layer)
+			}
+
+			if noTUI || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+				return exp.WriteText(os.Stdout)
+			}
+			return exp.Run(os.Stdin, os.Stdout)
+		},
+	}
+	cmd.Flags().BoolVar(&noTUI, "no-tui", false,
+		"Print the layers and file tree as plain text, even if stdout is a terminal")
+
+	addImageFileFlags(cmd, &inFlags, false)
+
+	argparserImage.AddCommand(cmd)
+}
+
+type exploreLayer struct {
+	createdBy string
+	size      int64 // the total size of the files that the layer adds or modifies
+	changes   []squash.Change
+}
+
+// explorer is the state of the `ocibuild image explore` terminal UI.
+type explorer struct {
+	title     string
+	root      *squash.Node
+	layers    []exploreLayer
+	collapsed map[string]bool
+
+	focusTree   bool
+	onlyChanges bool
+	layerCursor int
+	treeCursor  int
+	treeScroll  int
+}
+
+type exploreRow struct {
+	node  *squash.Node
+	depth int
+}
+
+// changedBy returns whether node, or anything under it, was last changed by the given layer.
+func changedBy(node *squash.Node, layer int) bool {
+	if node.Layer == layer {
+		return true
+	}
+	for _, child := range node.Children {
+		if changedBy(child, layer) {
+			return true
+		}
+	}
+	return false
+}
+
+// rows returns the rows of the file tree that are currently visible.
+func (exp *explorer) rows() []exploreRow {
+	var ret []exploreRow
+	var walk func(*squash.Node, int)
+	walk = func(node *squash.Node, depth int) {
+		if exp.onlyChanges && !changedBy(node, exp.layerCursor) {
+			return
+		}
+		ret = append(ret, exploreRow{node: node, depth: depth})
+		if exp.collapsed[node.Name] {
+			return
+		}
+		for _, child := range node.Children {
+			walk(child, depth+1)
+		}
+	}
+	for _, child := range exp.root.Children {
+		walk(child, 0)
+	}
+	return ret
+}
+
+func layerLabel(layer int) string {
+	if layer < 0 {
+		return "-"
+	}
+	return strconv.Itoa(layer)
+}
+
+func nodeLabel(node *squash.Node) string {
+	name := path.Base(node.Name)
+	switch {
+	case node.Header != nil && node.Header.Typeflag == tar.TypeSymlink:
+		return name + " -> " + node.Header.Linkname
+	case node.Header != nil && node.Header.Typeflag == tar.TypeLink:
+		return name + " => /" + node.Header.Linkname
+	case isDir(node):
+		return name + "/"
+	default:
+		return name
+	}
+}
+
+func isDir(node *squash.Node) bool {
+	return node.Header == nil || node.Header.Typeflag == tar.TypeDir
+}
+
+// WriteText writes the layer list and the full file tree as plain text.
+func (exp *explorer) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "LAYER\tSIZE\tADDED\tMODIFIED\tREMOVED\tCREATED BY")
+	for i, layer := range exp.layers {
+		counts := make(map[squash.ChangeKind]int)
+		for _, change := range layer.changes {
+			counts[change.Kind]++
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%s\n", i, progress.FormatBytes(layer.size),
+			counts[squash.ChangeAdd], counts[squash.ChangeModify], counts[squash.ChangeRemove],
+			layer.createdBy)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "LAYER\tSIZE\tPATH")
+	var walk func(*squash.Node)
+	walk = func(node *squash.Node) {
+		name := node.Name
+		if isDir(node) {
+			name += "/"
+		}
+		if node.Header != nil && node.Header.Typeflag == tar.TypeSymlink {
+			name += " -> " + node.Header.Linkname
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", layerLabel(node.Layer), progress.FormatBytes(node.Size), name)
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(exp.root)
+	return tw.Flush()
+}
+
+// Run runs the interactive terminal UI until the user quits.
+func (exp *explorer) Run(in, out *os.File) (err error) {
+	oldState, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return err
+	}
+	// Switch to the alternate screen, and hide the cursor.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+		if _err := term.Restore(int(in.Fd()), oldState); _err != nil && err == nil {
+			err = _err
+		}
+	}()
+
+	keys := bufio.NewReader(in)
+	for {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			return err
+		}
+		if err := exp.draw(out, width, height); err != nil {
+			return err
+		}
+		key, err := readKey(keys)
+		if err != nil {
+			return err
+		}
+		if !exp.handleKey(key, height) {
+			return nil
+		}
+	}
+}
+
+// readKey reads a single keypress, returning escape sequences (such as "\x1b[A" for Up) whole.
+func readKey(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if b != '\x1b' || r.Buffered() == 0 {
+		return string(b), nil
+	}
+	// An escape sequence: "ESC [" followed by parameters and a final byte in the range 0x40-0x7E.
+	seq := []byte{b}
+	for r.Buffered() > 0 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, b)
+		if len(seq) > 2 && b >= 0x40 && b <= 0x7e {
+			break
+		}
+	}
+	return string(seq), nil
+}
+
+// handleKey updates the state for a keypress; it returns false if the UI should exit.
+func (exp *explorer) handleKey(key string, height int) bool {
+	page := height / 2
+	if page < 1 {
+		page = 1
+	}
+	move := func(delta int) {
+		if exp.focusTree {
+			exp.treeCursor += delta
+		} else {
+			exp.layerCursor += delta
+			if exp.onlyChanges {
+				exp.treeCursor = 0
+			}
+		}
+	}
+	switch key {
+	case "q", "\x03", "\x1b":
+		return false
+	case "\t":
+		exp.focusTree = !exp.focusTree
+	case "k", "\x1b[A", "\x1bOA":
+		move(-1)
+	case "j", "\x1b[B", "\x1bOB":
+		move(1)
+	case "\x1b[5~":
+		move(-page)
+	case "\x1b[6~":
+		move(page)
+	case "\r", " ", "\x1b[C", "\x1b[D":
+		if rows := exp.rows(); exp.focusTree && exp.treeCursor < len(rows) {
+			if node := rows[exp.treeCursor].node; len(node.Children) > 0 {
+				switch key {
+				case "\x1b[C":
+					exp.collapsed[node.Name] = false
+				case "\x1b[D":
+					exp.collapsed[node.Name] = true
+				default:
+					exp.collapsed[node.Name] = !exp.collapsed[node.Name]
+				}
+			}
+		}
+	case "f":
+		exp.onlyChanges = !exp.onlyChanges
+		exp.treeCursor = 0
+	}
+	exp.layerCursor = clamp(exp.layerCursor, 0, len(exp.layers)-1)
+	exp.treeCursor = clamp(exp.treeCursor, 0, len(exp.rows())-1)
+	return true
+}
+
+func clamp(n, lo, hi int) int {
+	if n > hi {
+		n = hi
+	}
+	if n < lo {
+		n = lo
+	}
+	return n
+}
+
+// fit truncates or pads str to exactly width columns; assuming that each rune is 1 column.
+func fit(str string, width int) string {
+	runes := []rune(str)
+	if len(runes) > width {
+		if width < 1 {
+			return ""
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return str + strings.Repeat(" ", width-len(runes))
+}
+
+const (
+	sgrReset   = "\x1b[0m"
+	sgrBold    = "\x1b[1m"
+	sgrReverse = "\x1b[7m"
+)
+
+func (exp *explorer) draw(out io.Writer, width, height int) error {
+	var screen []string
+	line := func(sgr, str string) {
+		screen = append(screen, sgr+fit(str, width)+sgrReset)
+	}
+
+	line(sgrReverse, " ocibuild image explore: "+exp.title)
+
+	// The layer list takes up to a third of the screen.
+	layerRows := clamp(len(exp.layers), 1, clamp(height/3, 1, height))
+	layerScroll := clamp(exp.layerCursor-layerRows+1, 0, len(exp.layers))
+	line(sgrBold, fmt.Sprintf(" %5s  %9s  %s", "LAYER", "SIZE", "CREATED BY"))
+	for i := layerScroll; i < layerScroll+layerRows && i < len(exp.layers); i++ {
+		sgr := ""
+		if i == exp.layerCursor {
+			sgr = sgrBold
+			if !exp.focusTree {
+				sgr = sgrReverse
+			}
+		}
+		line(sgr, fmt.Sprintf(" %5d  %9s  %s", i, progress.FormatBytes(exp.layers[i].size), exp.layers[i].createdBy))
+	}
+
+	counts := make(map[squash.ChangeKind]int)
+	if len(exp.layers) > 0 {
+		for _, change := range exp.layers[exp.layerCursor].changes {
+			counts[change.Kind]++
+		}
+	}
+	filter := "all paths"
+	if exp.onlyChanges {
+		filter = "only paths changed by this layer"
+	}
+	line(sgrReverse, fmt.Sprintf(" layer %d: %d added, %d modified, %d removed; showing %s",
+		exp.layerCursor, counts[squash.ChangeAdd], counts[squash.ChangeModify], counts[squash.ChangeRemove],
+		filter))
+
+	// The file tree takes up the rest of the screen, less the header and footer.
+	line(sgrBold, fmt.Sprintf(" %5s  %9s  %s", "LAYER", "SIZE", "PATH"))
+	treeRows := height - len(screen) - 1
+	rows := exp.rows()
+	if exp.treeCursor < exp.treeScroll {
+		exp.treeScroll = exp.treeCursor
+	}
+	if treeRows > 0 && exp.treeCursor >= exp.treeScroll+treeRows {
+		exp.treeScroll = exp.treeCursor - treeRows + 1
+	}
+	for i := exp.treeScroll; i < exp.treeScroll+treeRows; i++ {
+		if i >= len(rows) {
+			line("", "")
+			continue
+		}
+		node := rows[i].node
+		marker := "  "
+		if len(node.Children) > 0 {
+			marker = "▾ "
+			if exp.collapsed[node.Name] {
+				marker = "▸ "
+			}
+		}
+		sgr := ""
+		if node.Layer == exp.layerCursor {
+			sgr = sgrBold
+		}
+		if i == exp.treeCursor && exp.focusTree {
+			sgr += sgrReverse
+		}
+		line(sgr, fmt.Sprintf(" %5s  %9s  %s%s%s", layerLabel(node.Layer), progress.FormatBytes(node.Size),
+			strings.Repeat("  ", rows[i].depth), marker, nodeLabel(node)))
+	}
+
+	line(sgrReverse, " Tab: switch pane  ↑/↓: move  Enter: collapse/expand  f: filter by layer  q: quit")
+
+	if len(screen) > height {
+		screen = screen[:height]
+	}
+	_, err := io.WriteString(out, "\x1b[H"+strings.Join(screen, "\r\n"))
+	return err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/history"
+	"github.com/datawire/ocibuild/pkg/reproducible"
+)
+
+func parseClampTime(str string) (time.Time, error) {
+	switch {
+	case str == "":
+		return time.Time{}, nil
+	case str == "now":
+		return reproducible.Now(), nil
+	case strings.HasPrefix(str, "@"):
+		secs, err := strconv.ParseInt(str[1:], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(secs, 0), nil
+	default:
+		return time.Parse(time.RFC3339, str)
+	}
+}
+
+func init() {
+	var (
+		tag          string
+		dropEmpty    bool
+		rewrites     []string
+		clampCreated string
+		inFlags      imageFileFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "history [flags] IN_IMAGEFILE >OUT_IMAGEFILE",
+		Short: "Edit the history entries of an image",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Edit the history entries in an image's config, which record how each layer was " +
+			"created; some scanners and policies require a clean history.  The layers " +
+			"themselves are not changed." +
+			"\n\n" +
+			"--drop-empty drops the entries that don't correspond to a layer, such as those " +
+			"that a Dockerfile's ENV or LABEL instructions create in a base image." +
+			"\n\n" +
+			"--rewrite-created-by takes a 'REGEXP=REPLACEMENT' pair (split at the first '='; " +
+			"write a '=' in the REGEXP as '\\x3d'), and replaces matches of REGEXP in the " +
+			"created_by of each entry with REPLACEMENT, which may refer to submatches as " +
+			"'${1}'.  It may be given multiple times; the rewrites are applied in order." +
+			"\n\n" +
+			"--clamp-created sets any created timestamp (of history entries, or of the image " +
+			"itself) that is later than the given time to that time.  The time may be given " +
+			"as an RFC 3339 timestamp, as '@UNIX_SECONDS', or as 'now' (which respects " +
+			"$SOURCE_DATE_EPOCH).",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			var opts history.Options
+			opts.DropEmpty = dropEmpty
+			for _, rewrite := range rewrites {
+				eq := strings.Index(rewrite, "=")
+				if eq < 0 {
+					return fmt.Errorf("invalid --rewrite-created-by %q: must be 'REGEXP=REPLACEMENT'", rewrite)
+				}
+				pattern, err := regexp.Compile(rewrite[:eq])
+				if err != nil {
+					return fmt.Errorf("invalid --rewrite-created-by %q: %w", rewrite, err)
+				}
+				opts.CreatedBy = append(opts.CreatedBy, history.Rewrite{
+					Pattern:     pattern,
+					Replacement: rewrite[eq+1:],
+				})
+			}
+			var err error
+			opts.ClampCreated, err = parseClampTime(clampCreated)
+			if err != nil {
+				return fmt.Errorf("invalid --clamp-created %q: %w", clampCreated, err)
+			}
+
+			var ref name.Reference
+			if tag != "" {
+				ref, err = name.NewTag(tag)
+				if err != nil {
+					return err
+				}
+			}
+
+			img, err := inFlags.Open(args[0])
+			if err != nil {
+				return err
+			}
+			img, err = history.Edit(img, opts)
+			if err != nil {
+				return err
+			}
+			return inFlags.Write(args[0], ref, img, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "Tag the resulting image as `TAG`")
+	if err := cmd.RegisterFlagCompletionFunc("tag", completeDockerImages); err != nil {
+		panic(err)
+	}
+	cmd.Flags().BoolVar(&dropEmpty, "drop-empty", false,
+		"Drop history entries that don't correspond to a layer")
+	cmd.Flags().StringArrayVar(&rewrites, "rewrite-created-by", nil,
+		"Rewrite the created_by of each history entry with `REGEXP=REPLACEMENT`; may be given multiple times")
+	cmd.Flags().StringVar(&clampCreated, "clamp-created", "",
+		"Clamp created timestamps to be no later than `TIME`")
+
+	addImageFileFlags(cmd, &inFlags, true)
+
+	argparserImage.AddCommand(cmd)
+}
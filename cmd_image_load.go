@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/dockerutil"
+)
+
+func init() {
+	var (
+		tag          string
+		engine       dockerutil.Engine
+		namespace    string
+		pushFallback bool
+		inFlags      imageFileFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "load [flags] --tag=TAG IN_IMAGEFILE",
+		Short: "Load an image in to a container engine",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Load an image in to a container engine, tagged as --tag." +
+			"\n\n" +
+			"With --engine=docker (the default), the image is loaded with the docker CLI.  The " +
+			"daemon is $DOCKER_HOST if it is set, or else that of the current Docker context; " +
+			"if that is the default socket and it doesn't exist, then the sockets of a " +
+			"rootless Docker daemon and of Podman's Docker-compatible service are tried." +
+			"\n\n" +
+			"With --engine=podman, the image is loaded with Podman's REST API, at " +
+			"$CONTAINER_HOST if it is set, or else at the rootless or the rootful Podman " +
+			"service's socket; the podman CLI is not needed." +
+			"\n\n" +
+			"With --engine=nerdctl, the image is loaded in to containerd with the nerdctl CLI, " +
+			"in the containerd --namespace (such as 'k8s.io' for the images that Kubernetes " +
+			"uses)." +
+			"\n\n" +
+			"With --push-if-no-daemon, if no Docker or Podman daemon is found, then the image " +
+			"is instead pushed to the registry named by --tag (such as a 'localhost:5000/…' " +
+			"registry in CI), using the credentials in the Docker config file (or from the " +
+			"--creds-helper program).",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			ctx := flags.Context()
+			ref, err := name.NewTag(tag)
+			if err != nil {
+				return cliutil.FlagErrorFunc(flags, fmt.Errorf("invalid --tag %q: %w", tag, err))
+			}
+			img, err := inFlags.Open(args[0])
+			if err != nil {
+				return err
+			}
+			if namespace != "" && engine != dockerutil.EngineNerdctl {
+				return cliutil.FlagErrorFunc(flags, fmt.Errorf("--namespace is only valid with --engine=nerdctl"))
+			}
+			err = engine.Load(ctx, namespace, ref, img)
+			if errors.Is(err, dockerutil.ErrNoDaemon) && pushFallback {
+				dlog.Infof(ctx, "%v; pushing to %s instead", err, ref)
+				err = dockerutil.Push(ctx, ref, img, registryOptions()...)
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "Load the image as `TAG`")
+	if err := cmd.MarkFlagRequired("tag"); err != nil {
+		panic(err)
+	}
+	if err := cmd.RegisterFlagCompletionFunc("tag", completeDockerImages); err != nil {
+		panic(err)
+	}
+	cmd.Flags().Var(&engine, "engine",
+		"Load the image in to `ENGINE`: 'docker', 'podman', or 'nerdctl'")
+	if err := cmd.RegisterFlagCompletionFunc("engine", completeWords("docker", "podman", "nerdctl")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&namespace, "namespace", "",
+		"With --engine=nerdctl, load the image in to the containerd `NAMESPACE`")
+	cmd.Flags().BoolVar(&pushFallback, "push-if-no-daemon", false,
+		"If there is no Docker daemon, push the image to the registry named by --tag instead")
+	addImageFileFlags(cmd, &inFlags, false)
+
+	argparserImage.AddCommand(cmd)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/rebase"
+)
+
+func init() {
+	var (
+		tag         string
+		oldBaseFile string
+		newBaseFile string
+		inFlags     imageFileFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "rebase [flags] --old-base=IN_IMAGEFILE --new-base=IN_IMAGEFILE IN_IMAGEFILE >OUT_IMAGEFILE",
+		Short: "Replace the base layers of an image with a different base image",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Replace the layers of the --old-base image at the bottom of IN_IMAGEFILE with " +
+			"the layers of the --new-base image, keeping the layers on top of them as they " +
+			"are; such as to pick up a security update to the base image without rebuilding " +
+			"the application layers.  It is an error if IN_IMAGEFILE is not actually based " +
+			"on --old-base." +
+			"\n\n" +
+			"The config's layer list and history are rewritten to match, and the OS and " +
+			"architecture are taken from --new-base; the rest of the config (environment " +
+			"variables, entrypoint, and such) is kept from IN_IMAGEFILE as-is, even if it was " +
+			"inherited from --old-base." +
+			"\n\n" +
+			"LIMITATION: This doesn't re-run anything; the result is only correct if the " +
+			"layers on top of the base don't depend on what exactly is in the old base (for " +
+			"instance, Python packages installed with 'ocibuild layer wheel' are fine as long " +
+			"as both bases have the same Python version and paths).",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			img, err := inFlags.Open(args[0])
+			if err != nil {
+				return err
+			}
+			oldBase, err := fsutil.OpenImage(oldBaseFile)
+			if err != nil {
+				return err
+			}
+			newBase, err := fsutil.OpenImage(newBaseFile)
+			if err != nil {
+				return err
+			}
+			var ref name.Reference
+			if tag != "" {
+				ref, err = name.NewTag(tag)
+				if err != nil {
+					return err
+				}
+			}
+
+			img, err = rebase.Rebase(img, oldBase, newBase)
+			if err != nil {
+				return err
+			}
+			return inFlags.Write(args[0], ref, img, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "Tag the resulting image as `TAG`")
+	if err := cmd.RegisterFlagCompletionFunc("tag", completeDockerImages); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&oldBaseFile, "old-base", "",
+		"The base image file `IN_IMAGEFILE` that the input image is currently based on")
+	if err := cmd.MarkFlagRequired("old-base"); err != nil {
+		panic(err)
+	}
+	if err := cmd.RegisterFlagCompletionFunc("old-base", completeFileExt("tar")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&newBaseFile, "new-base", "",
+		"The base image file `IN_IMAGEFILE` to base the output image on instead")
+	if err := cmd.MarkFlagRequired("new-base"); err != nil {
+		panic(err)
+	}
+	if err := cmd.RegisterFlagCompletionFunc("new-base", completeFileExt("tar")); err != nil {
+		panic(err)
+	}
+
+	addImageFileFlags(cmd, &inFlags, true)
+
+	argparserImage.AddCommand(cmd)
+}
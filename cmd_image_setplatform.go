@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/platform"
+)
+
+func init() {
+	var (
+		tag          string
+		platformStr  string
+		osName       string
+		arch         string
+		variant      string
+		osVersion    string
+		skipValidate bool
+		inFlags      imageFileFlags
+	)
+	cmd := &cobra.Command{
+		Use:     "set-platform [flags] IN_IMAGEFILE >OUT_IMAGEFILE",
+		Aliases: []string{"flatten-config"},
+		Short:   "Set the OS and architecture that an image's config says it is for",
+		Args:    cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Set the 'os', 'architecture', 'variant', and 'os.version' fields of an image's " +
+			"config, such as when assembling arm64 layers on an amd64 host (where `ocibuild " +
+			"image build` gives the image the host's platform).  Fields that aren't specified " +
+			"are left as they are in IN_IMAGEFILE; --platform sets the OS, architecture, and " +
+			"variant all at once, and the other flags override it." +
+			"\n\n" +
+			"Unless --skip-validate is given, the layers are scanned for ELF executables and " +
+			"shared libraries, and it is an error if any of them are for an architecture " +
+			"other than the target architecture." +
+			"\n\n" +
+			"LIMITATION: Validation only checks the architecture of ELF files; it does not " +
+			"check the variant or the OS, nor does it check Windows executables.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			img, err := inFlags.Open(args[0])
+			if err != nil {
+				return err
+			}
+			var ref name.Reference
+			if tag != "" {
+				ref, err = name.NewTag(tag)
+				if err != nil {
+					return err
+				}
+			}
+
+			plat, err := platform.Get(img)
+			if err != nil {
+				return err
+			}
+			if platformStr != "" {
+				parsed, err := platform.Parse(platformStr)
+				if err != nil {
+					return err
+				}
+				plat.OS = parsed.OS
+				plat.Architecture = parsed.Architecture
+				plat.Variant = parsed.Variant
+			}
+			if flags.Flags().Changed("os") {
+				plat.OS = osName
+			}
+			if flags.Flags().Changed("arch") {
+				plat.Architecture = arch
+			}
+			if flags.Flags().Changed("variant") {
+				plat.Variant = variant
+			}
+			if flags.Flags().Changed("os-version") {
+				plat.OSVersion = osVersion
+			}
+
+			if !skipValidate {
+				if err := platform.Validate(img, plat); err != nil {
+					return err
+				}
+			}
+			img, err = platform.Set(img, plat)
+			if err != nil {
+				return err
+			}
+			return inFlags.Write(args[0], ref, img, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVarP(&tag, "tag", "t", "", "Tag the resulting image as `TAG`")
+	if err := cmd.RegisterFlagCompletionFunc("tag", completeDockerImages); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&platformStr, "platform", "",
+		"Set the OS, architecture, and variant from `OS/ARCH[/VARIANT]`")
+	if err := cmd.RegisterFlagCompletionFunc("platform", completeWords(
+		"linux/amd64", "linux/arm64/v8", "linux/arm/v7", "linux/386", "linux/ppc64le", "linux/s390x",
+		"windows/amd64")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&osName, "os", "", "Set the `OS`")
+	cmd.Flags().StringVar(&arch, "arch", "", "Set the `ARCHITECTURE`")
+	cmd.Flags().StringVar(&variant, "variant", "", "Set the architecture `VARIANT` (empty to remove)")
+	cmd.Flags().StringVar(&osVersion, "os-version", "", "Set the `OS_VERSION` (empty to remove)")
+	cmd.Flags().BoolVar(&skipValidate, "skip-validate", false,
+		"Don't check that ELF files in the layers are for the target architecture")
+
+	addImageFileFlags(cmd, &inFlags, true)
+
+	argparserImage.AddCommand(cmd)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/ghactions"
+	"github.com/datawire/ocibuild/pkg/verify"
+)
+
+func init() {
+	var (
+		format  string
+		inFlags imageFileFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "verify [flags] IN_IMAGEFILE",
+		Short: "Check an image for structural problems",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Check an image for the sorts of structural problems that cause some " +
+			"registries to reject it: digests and sizes in the manifest that don't match the " +
+			"config and layers, diff_ids in the config that don't match the layers (or are in " +
+			"the wrong order), invalid or inconsistent (mixed Docker and OCI) media types, " +
+			"history that doesn't match the layers, layers that aren't valid tar archives, and " +
+			"layers with duplicate whiteouts or with whiteouts for files in the same layer." +
+			"\n\n" +
+			"Each problem found is printed as a line on stdout (or, with --format=json, as " +
+			"an element of a JSON array with the keys \"object\", \"check\", and " +
+			"\"message\"; or with --format=github, as GitHub Actions annotations).  The " +
+			"default is --format=github if --output-format=github is given, or else " +
+			"--format=table.  The command fails if any problems are found." +
+			"\n\n" +
+			"LIMITATION: The Docker image file format that ocibuild reads doesn't record the " +
+			"manifest, so the manifest checked is the one that would be pushed to a registry; " +
+			"this still catches config and layer problems, but not a corrupted manifest.json.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			if outputFormat == "github" && !flags.Flags().Changed("format") {
+				format = "github"
+			}
+			switch format {
+			case "table", "json", "github":
+			default:
+				return fmt.Errorf("invalid --format %q: must be 'table', 'json', or 'github'", format)
+			}
+			img, err := inFlags.Open(args[0])
+			if err != nil {
+				return err
+			}
+			problems, err := verify.Image(img)
+			if err != nil {
+				return err
+			}
+
+			switch format {
+			case "json":
+				if problems == nil {
+					problems = []verify.Problem{}
+				}
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetEscapeHTML(false)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(problems); err != nil {
+					return err
+				}
+			case "github":
+				for _, problem := range problems {
+					props := ghactions.Properties{"file": args[0], "title": problem.Check}
+					if _, err := fmt.Println(ghactions.Error(props, problem.Object+": "+problem.Message)); err != nil {
+						return err
+					}
+				}
+			default:
+				for _, problem := range problems {
+					if _, err := fmt.Printf("%s: %s\n", args[0], problem); err != nil {
+						return err
+					}
+				}
+			}
+
+			if len(problems) > 0 {
+				return fmt.Errorf("%s: %d problem(s) found", args[0], len(problems))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "table",
+		"Output `FORMAT`; one of 'table', 'json', or 'github'")
+	if err := cmd.RegisterFlagCompletionFunc("format", completeWords("table", "json", "github")); err != nil {
+		panic(err)
+	}
+
+	addImageFileFlags(cmd, &inFlags, false)
+
+	argparserImage.AddCommand(cmd)
+}
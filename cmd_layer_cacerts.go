@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/reproducible"
+	"github.com/datawire/ocibuild/pkg/sysdata"
+)
+
+func init() {
+	var (
+		fromFile  string
+		fromURL   string
+		urlSHA256 string
+	)
+	cmd := &cobra.Command{
+		Use:   "ca-certs [flags] >OUT_LAYERFILE",
+		Short: "Create a layer containing a bundle of CA certificates",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+
+		Long: "Create a layer containing a PEM bundle of CA certificates at " +
+			"/" + sysdata.CABundlePath + " (with symlinks to it from the other common " +
+			"locations), which is needed by nearly any program that makes TLS connections, but " +
+			"is missing from an image built from scratch." +
+			"\n\n" +
+			"By default, the bundle is copied from the host that ocibuild is running on.  With " +
+			"--file, it is read from a file instead.  With --url, it is downloaded, and verified " +
+			"against the --sha256 digest (which is required), so that the result is pinned to a " +
+			"specific, known-good bundle; for example, the Mozilla bundle published at " +
+			"https://curl.se/docs/caextract.html.  Either way, the bundle must contain only " +
+			"valid certificates.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			ctx := flags.Context()
+			var (
+				bundle []byte
+				err    error
+			)
+			switch {
+			case fromFile != "" && fromURL != "":
+				return cliutil.FlagErrorFunc(flags, fmt.Errorf("--file and --url are mutually exclusive"))
+			case (fromURL == "") != (urlSHA256 == ""):
+				return cliutil.FlagErrorFunc(flags, fmt.Errorf("--url and --sha256 must be given together"))
+			}
+			switch {
+			case fromURL != "":
+				if err := checkHermetic("downloading a CA bundle (use --file)"); err != nil {
+					return err
+				}
+				bundle, err = sysdata.CABundleFromURL(ctx, nil, fromURL, urlSHA256)
+			case fromFile != "":
+				bundle, err = os.ReadFile(fromFile)
+			default:
+				bundle, _, err = sysdata.CABundleFromHost()
+			}
+			if err != nil {
+				return err
+			}
+			layer, err := sysdata.CACertsLayer(ctx, bundle, reproducible.Now())
+			if err != nil {
+				return err
+			}
+			return writeLayer(ctx, layer, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVar(&fromFile, "file", "", "Read the CA bundle from `PEMFILE`, instead of the host")
+	if err := cmd.RegisterFlagCompletionFunc("file", completeFileExt("pem", "crt")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&fromURL, "url", "", "Download the CA bundle from `URL`, instead of the host")
+	cmd.Flags().StringVar(&urlSHA256, "sha256", "", "The expected SHA-256 `HEXDIGEST` of the --url bundle")
+
+	argparserLayer.AddCommand(cmd)
+}
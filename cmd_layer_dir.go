@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -14,21 +16,52 @@ import (
 func init() {
 	var flagPrefix dir.Prefix
 	var flagChOwn dir.Ownership
+	var flagSpecialFiles fsutil.SpecialFilePolicy
+	var flagMetadata string
 	cmd := &cobra.Command{
 		Use:   "dir [flags] IN_DIRNAME >OUT_LAYERFILE",
 		Short: "Create a layer from a directory",
-		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
-		RunE: func(_ *cobra.Command, args []string) error {
+		Long: "Create a layer from the contents of IN_DIRNAME." +
+			"\n\n" +
+			"Directory entries in the layer are named with a trailing \"/\", as tar itself " +
+			"does.  Older versions of ocibuild named them without it, so a layer created " +
+			"from the same directory by an older version has a different digest.",
+		Args: cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeDirs,
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			if flagMetadata != "" {
+				for _, name := range []string{"prefix", "chown-uid", "chown-uname", "chown-gid", "chown-gname"} {
+					if flags.Flags().Changed(name) {
+						return cliutil.FlagErrorFunc(flags, fmt.Errorf("--metadata and --%s are mutually exclusive", name))
+					}
+				}
+				metadataBytes, err := os.ReadFile(flagMetadata)
+				if err != nil {
+					return err
+				}
+				var metadata dir.Metadata
+				if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+					return fmt.Errorf("%s: %w", flagMetadata, err)
+				}
+				layer, err := dir.LayerFromExtracted(args[0], &metadata, reproducible.Now())
+				if err != nil {
+					return err
+				}
+				return writeLayer(flags.Context(), layer, os.Stdout)
+			}
+
 			var prefix *dir.Prefix
 			if flagPrefix.DirName != "" {
 				prefix = &flagPrefix
 			}
-			layer, err := dir.LayerFromDir(args[0], prefix, &flagChOwn, reproducible.Now())
+			layer, err := dir.LayerFromDirWithSpecialFiles(args[0], prefix, &flagChOwn, reproducible.Now(), flagSpecialFiles)
 			if err != nil {
 				return err
 			}
 
-			if err := fsutil.WriteLayer(layer, os.Stdout); err != nil {
+			if err := writeLayer(flags.Context(), layer, os.Stdout); err != nil {
 				return err
 			}
 			return nil
@@ -56,6 +89,20 @@ func init() {
 		"Force the numeric group ID of read files to be `GID`; use a value <0 to use the actual GID")
 	cmd.Flags().StringVar(&flagChOwn.GName, "chown-gname", "root",
 		"Force symbolic group name of the read files to be `gname`; an empty value uses the actual group name")
+	cmd.Flags().Var(&flagSpecialFiles, "special-files", ``+
+		`What to do with character devices, block devices, and FIFOs in the directory; one of `+
+		`"preserve", "strip", or "error"`)
+	if err := cmd.RegisterFlagCompletionFunc("special-files", completeWords("preserve", "strip", "error")); err != nil {
+		panic(err)
+	}
+	// rehydration
+	cmd.Flags().StringVar(&flagMetadata, "metadata", "", ``+
+		`Rather than reading the ownership and such from the directory, read it from `+
+		"`IN_JSON_FILE`"+`, as written by "ocibuild layer extract --metadata" when the `+
+		`directory was extracted; files added to the directory since then are owned by root`)
+	if err := cmd.RegisterFlagCompletionFunc("metadata", completeFileExt("json")); err != nil {
+		panic(err)
+	}
 
 	argparserLayer.AddCommand(cmd)
 }
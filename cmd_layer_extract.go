@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/dir"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+func init() {
+	var (
+		dest         string
+		metadataFile string
+	)
+	cmd := &cobra.Command{
+		Use:   "extract [flags] --dest=OUT_DIR --metadata=OUT_JSON_FILE IN_LAYERFILE",
+		Short: "Extract a layer to a directory",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Given a layer file, write its contents to a directory on disk, so that it " +
+			"can be inspected (or modified) with ordinary tools." +
+			"\n\n" +
+			"The extracted files are owned by the current user.  The things about the " +
+			"layer that can't be represented by files owned by the current user--file " +
+			"ownership, extended attributes, whiteouts, and device nodes--are recorded in " +
+			"the JSON metadata file, along with the rest of each entry's tar header.  " +
+			"Whiteouts and device nodes are only recorded there, and are not written to " +
+			"OUT_DIR." +
+			"\n\n" +
+			"To turn the directory back in to a layer, use `ocibuild layer dir --metadata`; " +
+			"if the directory is unmodified, the resulting layer is identical to the " +
+			"original.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			layer, err := fsutil.OpenLayer(args[0])
+			if err != nil {
+				return err
+			}
+			metadata, err := dir.ExtractLayer(flags.Context(), layer, dest)
+			if err != nil {
+				return err
+			}
+			metadataBytes, err := json.MarshalIndent(metadata, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(metadataFile, append(metadataBytes, '\n'), 0o666); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dest, "dest", "",
+		"Write the layer's files to `OUT_DIR`, which is created if it doesn't exist")
+	if err := cmd.MarkFlagDirname("dest"); err != nil {
+		panic(err)
+	}
+	if err := cmd.MarkFlagRequired("dest"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&metadataFile, "metadata", "",
+		"Write the metadata of the layer's entries to `OUT_JSON_FILE`")
+	if err := cmd.RegisterFlagCompletionFunc("metadata", completeFileExt("json")); err != nil {
+		panic(err)
+	}
+	if err := cmd.MarkFlagRequired("metadata"); err != nil {
+		panic(err)
+	}
+
+	argparserLayer.AddCommand(cmd)
+}
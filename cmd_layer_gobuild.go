@@ -73,7 +73,7 @@ func init() {
 				outputWriter = outputFile
 			}
 
-			if err := fsutil.WriteLayer(layer, outputWriter); err != nil {
+			if err := writeLayer(flags.Context(), layer, outputWriter); err != nil {
 				return err
 			}
 
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/reproducible"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func init() {
+	var flags struct {
+		Conflict     fsutil.ConflictPolicy
+		SpecialFiles fsutil.SpecialFilePolicy
+		Output       string
+	}
+	cmd := &cobra.Command{
+		Use:   "merge [flags] IN_LAYERFILES... {-o OUT_LAYERFILE|>OUT_LAYERFILE}",
+		Short: "Merge several layers in to a single layer",
+		Args:  cliutil.WrapPositionalArgs(cobra.MinimumNArgs(2)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Merge several layers in to a single layer.  This is like 'squash', except " +
+			"that if more than one of the input layers has a file at the same path, then " +
+			"that is a conflict, which is handled according to the --conflict flag; by " +
+			"default it is an error, which makes 'merge' suitable for combining many small " +
+			"layers that are expected to be disjoint in to one." +
+			"\n\n" +
+			"Whiteout files are not conflicts; a whiteout in one input layer removes the " +
+			"file (or directory contents) that it names from the earlier input layers.  " +
+			"Whiteouts are kept in the output layer, so that they still apply to whatever " +
+			"layers it is stacked on top of, unless a later input layer replaces the " +
+			"whited-out path with a non-directory, in which case the whiteout is dropped.",
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			layers := make([]ociv1.Layer, 0, len(args))
+			for _, layerpath := range args {
+				layer, err := fsutil.OpenLayer(layerpath)
+				if err != nil {
+					return err
+				}
+				layers = append(layers, layer)
+			}
+
+			layer, err := squash.Merge(cmd.Context(), layers,
+				flags.Conflict, flags.SpecialFiles, reproducible.Now())
+			if err != nil {
+				return err
+			}
+
+			if flags.Output != "" {
+				return writeLayerFile(cmd.Context(), layer, flags.Output)
+			}
+			return writeLayer(cmd.Context(), layer, os.Stdout)
+		},
+	}
+	cmd.Flags().Var(&flags.Conflict, "conflict", ``+
+		`What to do when more than one input layer has a file at the same path; one of `+
+		`"error", "keep-first", or "keep-last"`)
+	if err := cmd.RegisterFlagCompletionFunc("conflict", completeWords("error", "keep-first", "keep-last")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().Var(&flags.SpecialFiles, "special-files", ``+
+		`What to do with character devices, block devices, and FIFOs in the input layers; one of `+
+		`"preserve", "strip", or "error"`)
+	if err := cmd.RegisterFlagCompletionFunc("special-files", completeWords("preserve", "strip", "error")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVarP(&flags.Output, "output", "o", "",
+		"Write the merged layer to `OUT_LAYERFILE` instead of to stdout")
+
+	argparserLayer.AddCommand(cmd)
+}
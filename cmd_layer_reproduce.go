@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cache"
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/python/pypa/entry_points"
+	"github.com/datawire/ocibuild/pkg/python/pypa/recording_installs"
+	"github.com/datawire/ocibuild/pkg/python/wheelhouse"
+)
+
+// reproduceRecipe is the --recipe file for `ocibuild layer reproduce`: everything that went in to
+// building a wheel layer, and the digest of the layer that it built.
+type reproduceRecipe struct {
+	Wheel struct {
+		URL    string `json:"url"`
+		SHA256 string `json:"sha256"`
+	} `json:"wheel"`
+	Platform    json.RawMessage `json:"platform"`
+	Epoch       string          `json:"epoch"`
+	MtimePolicy string          `json:"mtimePolicy,omitempty"`
+	Installer   *string         `json:"installer,omitempty"`
+	Digest      string          `json:"digest"`
+}
+
+// reproduceStatement is what `ocibuild layer reproduce` writes to stdout.
+type reproduceStatement struct {
+	Recipe     string `json:"recipe"`
+	Wheel      string `json:"wheel"`
+	Expected   string `json:"expected"`
+	Actual     string `json:"actual"`
+	Size       int64  `json:"size"`
+	Reproduced bool   `json:"reproduced"`
+}
+
+func init() {
+	var (
+		recipeFile string
+		outputFile string
+		findLinks  string
+		cacheDir   string
+		noCache    bool
+		auth       indexAuth
+	)
+	cmd := &cobra.Command{
+		Use:   "reproduce [flags] --recipe=IN_JSON_FILE >OUT_JSON_FILE",
+		Short: "Rebuild a wheel layer from a recipe, and check that it is bit-for-bit identical",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+
+		Long: "Rebuild a layer from the recorded inputs in a recipe file, the same way that " +
+			"`ocibuild layer wheel` would build it, and check that the digest of the rebuilt " +
+			"layer matches the digest recorded in the recipe.  The recipe is a JSON file that " +
+			"is as follows:" +
+			"\n\n" +
+			"    {\n" +
+			"      // where to get the wheel, and its sha256 (hex)\n" +
+			"      \"wheel\": {\n" +
+			"        \"url\": \"https://files.pythonhosted.org/.../foo-1.0-py3-none-any.whl\",\n" +
+			"        \"sha256\": \"0123...\"\n" +
+			"      },\n" +
+			"      // the contents of the --platform-file, as JSON\n" +
+			"      \"platform\": {\"ConsoleShebang\": \"/usr/bin/python3\", ...},\n" +
+			"      // the --mtime-epoch, and optionally the --mtime-policy (default\n" +
+			"      // 'source-date-epoch') and --installer (default 'ocibuild layer wheel')\n" +
+			"      \"epoch\": \"@1609459200\",\n" +
+			"      \"mtimePolicy\": \"source-date-epoch\",\n" +
+			"      \"installer\": \"ocibuild layer wheel\",\n" +
+			"      // the digest of the (uncompressed) layer file that was built\n" +
+			"      \"digest\": \"sha256:4567...\"\n" +
+			"    }" +
+			"\n\n" +
+			"(without the comments).  The wheel is looked for in the local download cache and " +
+			"in --find-links before downloading it from its URL, and in any case its sha256 " +
+			"must match." +
+			"\n\n" +
+			"A JSON statement of the result (the digests of the recipe, the wheel, and the " +
+			"expected and actual layers) is written to stdout, whether or not the layer was " +
+			"reproduced; the command fails if it wasn't.  With --output, the rebuilt layer is " +
+			"also written to OUT_LAYERFILE, which is useful for investigating a mismatch." +
+			"\n\n" +
+			"Directory entries in the layer are named with a trailing \"/\", as tar itself " +
+			"does; recipes recorded by older versions of ocibuild, which named them without " +
+			"it, do not reproduce." +
+			"\n\n" +
+			"LIMITATION: Only wheels installed directly in to the platform's scheme (without " +
+			"--venv, --slim, --direct-url, or --requested) can be reproduced.  If the platform " +
+			"has a PyCompile command, then it must be the same Python version that originally " +
+			"compiled the .pyc files.",
+
+		RunE: func(flags *cobra.Command, _ []string) error {
+			ctx := flags.Context()
+
+			recipeBytes, err := os.ReadFile(recipeFile)
+			if err != nil {
+				return err
+			}
+			var recipe reproduceRecipe
+			if err := json.Unmarshal(recipeBytes, &recipe); err != nil {
+				return fmt.Errorf("%s: %w", recipeFile, err)
+			}
+			if recipe.Wheel.URL == "" || recipe.Wheel.SHA256 == "" || recipe.Digest == "" ||
+				len(recipe.Platform) == 0 {
+				return fmt.Errorf("%s: the wheel.url, wheel.sha256, platform, and digest fields are required",
+					recipeFile)
+			}
+			plat, err := parsePlatformFile(recipeFile+": platform", recipe.Platform, nil)
+			if err != nil {
+				return err
+			}
+			policy := bdist.MtimePolicy{
+				Mode:  bdist.MtimeSourceDateEpoch,
+				Epoch: time.Time{},
+			}
+			if recipe.MtimePolicy != "" {
+				policy.Mode = bdist.MtimeMode(recipe.MtimePolicy)
+			}
+			validMode := false
+			for _, mode := range bdist.MtimeModes {
+				validMode = validMode || policy.Mode == mode
+			}
+			if !validMode {
+				return fmt.Errorf("%s: invalid mtimePolicy %q", recipeFile, recipe.MtimePolicy)
+			}
+			policy.Epoch, err = parseClampTime(recipe.Epoch)
+			if err != nil {
+				return fmt.Errorf("%s: invalid epoch %q: %w", recipeFile, recipe.Epoch, err)
+			}
+			if policy.Epoch.IsZero() && policy.Mode != bdist.MtimePip && policy.Mode != bdist.MtimePreserve {
+				return fmt.Errorf("%s: mtimePolicy %q requires an epoch", recipeFile, policy.Mode)
+			}
+			ctx = bdist.WithMtimePolicy(ctx, policy)
+			installer := "ocibuild layer wheel"
+			if recipe.Installer != nil {
+				installer = *recipe.Installer
+			}
+
+			filename, content, err := getRecipeWheel(ctx, recipe.Wheel.URL, recipe.Wheel.SHA256,
+				findLinks, cacheDir, noCache, auth)
+			if err != nil {
+				return err
+			}
+			layer, err := bdist.InstallWheelFromReader(ctx,
+				plat,
+				time.Time{}, // minTime: zero; don't enforce minTime
+				time.Time{}, // maxTime: zero; auto based on the timestamps in the wheel
+				filename,
+				bytes.NewReader(content),
+				int64(len(content)),
+				bdist.PostInstallHooks(
+					entry_points.CreateScripts(plat),
+					recording_installs.Record("sha256", installer, nil),
+				),
+			)
+			if err != nil {
+				return err
+			}
+
+			hasher := sha256.New()
+			counter := &countingWriter{} //nolint:exhaustivestruct
+			dst := io.MultiWriter(hasher, counter)
+			var outFile *os.File
+			if outputFile != "" {
+				outFile, err = os.Create(outputFile)
+				if err != nil {
+					return err
+				}
+				dst = io.MultiWriter(dst, outFile)
+			}
+			err = fsutil.WriteLayer(layer, dst)
+			if outFile != nil {
+				if closeErr := outFile.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			recipeSum := sha256.Sum256(recipeBytes)
+			actual := "sha256:" + hex.EncodeToString(hasher.Sum(nil))
+			statement := reproduceStatement{
+				Recipe:     "sha256:" + hex.EncodeToString(recipeSum[:]),
+				Wheel:      "sha256:" + recipe.Wheel.SHA256,
+				Expected:   recipe.Digest,
+				Actual:     actual,
+				Size:       counter.n,
+				Reproduced: actual == recipe.Digest,
+			}
+			out, err := json.MarshalIndent(statement, "", "  ")
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stdout.Write(append(out, '\n')); err != nil {
+				return err
+			}
+			if !statement.Reproduced {
+				return fmt.Errorf("layer was not reproduced: expected %s, but got %s",
+					statement.Expected, statement.Actual)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&recipeFile, "recipe", "",
+		"Read the recipe to reproduce from `IN_JSON_FILE`")
+	if err := cmd.MarkFlagRequired("recipe"); err != nil {
+		panic(err)
+	}
+	if err := cmd.RegisterFlagCompletionFunc("recipe", completeFileExt("json")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&outputFile, "output", "",
+		"Also write the rebuilt layer to `OUT_LAYERFILE`")
+	addIndexAuthFlags(cmd, &auth)
+	addFindLinksFlag(cmd, &findLinks)
+	addCacheDirFlag(cmd, &cacheDir)
+	cmd.Flags().BoolVar(&noCache, "no-cache", false,
+		"Don't use the local download cache")
+
+	argparserLayer.AddCommand(cmd)
+}
+
+// getRecipeWheel returns the filename and content of the wheel at wheelURL, checking that its
+// sha256 is hexDigest.  The cache and the findLinks wheelhouse are tried before the URL.
+func getRecipeWheel(
+	ctx context.Context,
+	wheelURL, hexDigest string,
+	findLinks, cacheDir string,
+	noCache bool,
+	auth indexAuth,
+) (string, []byte, error) {
+	u, err := url.Parse(wheelURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid wheel URL: %w", err)
+	}
+	filename := path.Base(u.Path)
+	u.Fragment = ""
+
+	verify := func(content []byte) error {
+		sum := sha256.Sum256(content)
+		if actual := hex.EncodeToString(sum[:]); actual != hexDigest {
+			return fmt.Errorf("%s: checksum mismatch: sha256: expected=%s actual=%s",
+				filename, hexDigest, actual)
+		}
+		return nil
+	}
+
+	var store cache.Store
+	if !noCache {
+		if store, err = openCache(cacheDir); err != nil {
+			return "", nil, err
+		}
+		content, ok, err := store.Get("sha256:" + hexDigest)
+		if err != nil {
+			dlog.Warnf(ctx, "cache: %v", err)
+		}
+		if ok {
+			dlog.Infof(ctx, "cache: using cached %s", filename)
+			return filename, content, verify(content)
+		}
+	}
+	if findLinks != "" {
+		content, err := wheelhouse.Open(findLinks, filename)
+		if err != nil {
+			return "", nil, err
+		}
+		return filename, content, verify(content)
+	}
+
+	if err := checkHermetic("downloading wheels (use --find-links)"); err != nil {
+		return "", nil, err
+	}
+	client := pep503.Client{ //nolint:exhaustivestruct
+		Credentials: auth.providers(u.Scheme + "://" + u.Host + "/"),
+	}
+	setupDownloads(&client, cacheDir, noCache)
+	content, err := client.Get(ctx, u.String()+"#sha256="+hexDigest)
+	if err != nil {
+		return "", nil, err
+	}
+	if !noCache {
+		if _, err := store.Put(content); err != nil {
+			dlog.Warnf(ctx, "cache: %v", err)
+		}
+	}
+	return filename, content, verify(content)
+}
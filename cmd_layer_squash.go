@@ -12,10 +12,14 @@ import (
 )
 
 func init() {
+	var flagSpecialFiles fsutil.SpecialFilePolicy
 	cmd := &cobra.Command{
 		Use:   "squash [flags] IN_LAYERFILES... >OUT_LAYERFILE",
 		Short: "Squash several layers in to a single layer",
 		Args:  cliutil.WrapPositionalArgs(cobra.MinimumNArgs(2)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
 		RunE: func(flags *cobra.Command, args []string) error {
 			layers := make([]ociv1.Layer, 0, len(args))
 			for _, layerpath := range args {
@@ -26,16 +30,23 @@ func init() {
 				layers = append(layers, layer)
 			}
 
-			layer, err := squash.Squash(layers)
+			layer, err := squash.SquashWithSpecialFiles(layers, flagSpecialFiles)
 			if err != nil {
 				return err
 			}
 
-			if err := fsutil.WriteLayer(layer, os.Stdout); err != nil {
+			if err := writeLayer(flags.Context(), layer, os.Stdout); err != nil {
 				return err
 			}
 			return nil
 		},
 	}
+	cmd.Flags().Var(&flagSpecialFiles, "special-files", ``+
+		`What to do with character devices, block devices, and FIFOs in the input layers; one of `+
+		`"preserve", "strip", or "error"`)
+	if err := cmd.RegisterFlagCompletionFunc("special-files", completeWords("preserve", "strip", "error")); err != nil {
+		panic(err)
+	}
+
 	argparserLayer.AddCommand(cmd)
 }
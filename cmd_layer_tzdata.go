@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/reproducible"
+	"github.com/datawire/ocibuild/pkg/sysdata"
+)
+
+func init() {
+	var (
+		srcDir    string
+		zones     []string
+		localtime string
+	)
+	cmd := &cobra.Command{
+		Use:   "tzdata [flags] >OUT_LAYERFILE",
+		Short: "Create a layer containing the timezone database",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+
+		Long: "Create a layer containing the timezone database at /" + sysdata.ZoneinfoPath + ", " +
+			"which is needed by any program that deals with local times, but is missing from an " +
+			"image built from scratch.  The database is copied from --dir, which defaults to " +
+			"the host that ocibuild is running on." +
+			"\n\n" +
+			"The full database is a few megabytes; use --zone (which may be given multiple " +
+			"times) to only include the zones that match the given glob patterns, such as " +
+			"'UTC' or 'America/*'.  The metadata files (zone.tab and the like) are always " +
+			"included." +
+			"\n\n" +
+			"With --localtime, /etc/localtime is made a symlink to that zone, setting the " +
+			"image's default timezone." +
+			"\n\n" +
+			"For example:" +
+			"\n\n" +
+			"    ocibuild layer tzdata --zone=UTC --zone='America/*' --localtime=America/New_York >tzdata.layer.tar",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			ctx := flags.Context()
+			layer, err := sysdata.TZDataLayer(ctx, srcDir, zones, localtime, reproducible.Now())
+			if err != nil {
+				return err
+			}
+			return writeLayer(ctx, layer, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVar(&srcDir, "dir", sysdata.HostZoneinfoDir, "Read the timezone database from `DIRECTORY`")
+	if err := cmd.MarkFlagDirname("dir"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringArrayVar(&zones, "zone", nil,
+		"Only include the zones matching `GLOB` (default: include all zones)")
+	cmd.Flags().StringVar(&localtime, "localtime", "", "Make /etc/localtime a symlink to `ZONE`")
+
+	argparserLayer.AddCommand(cmd)
+}
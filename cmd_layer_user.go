@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/passwd"
+	"github.com/datawire/ocibuild/pkg/reproducible"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func init() {
+	var (
+		base string
+		user passwd.User
+	)
+	cmd := &cobra.Command{
+		Use:   "user [flags] --name=NAME --uid=UID >OUT_LAYERFILE",
+		Short: "Create a layer that adds a user account",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+
+		Long: "Create a layer that adds a user (and its primary group) to /etc/passwd and " +
+			"/etc/group, and creates the user's home directory; so that an image can run as a " +
+			"non-root user without running useradd in a container." +
+			"\n\n" +
+			"With --base, the existing /etc/passwd and /etc/group (and /etc/shadow and " +
+			"/etc/gshadow, which are only updated if they exist) are read from the base image, " +
+			"and the resulting layer has the complete updated files, to be stacked on top of " +
+			"the base image.  It is an error if the user name or UID is already in use in the " +
+			"base image.  If the --group already exists, the user is added to it; otherwise it " +
+			"is created with --gid (which defaults to the same as --uid)." +
+			"\n\n" +
+			"For example:" +
+			"\n\n" +
+			"    ocibuild layer user --base=base.tar --name=app --uid=10001 --home=/app >user.layer.tar",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			var layers []ociv1.Layer
+			if base != "" {
+				img, err := fsutil.OpenImage(base)
+				if err != nil {
+					return err
+				}
+				layers, err = img.Layers()
+				if err != nil {
+					return err
+				}
+			}
+			if !flags.Flags().Changed("gid") {
+				user.GID = -1
+			}
+			editor, err := squash.NewEditor(layers, fsutil.SpecialFilesPreserve)
+			if err != nil {
+				return err
+			}
+			if err := passwd.AddUser(editor, user, reproducible.Now()); err != nil {
+				return err
+			}
+			layer, err := editor.Delta()
+			if err != nil {
+				return err
+			}
+			return writeLayer(flags.Context(), layer, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVar(&base, "base", "",
+		"Read the existing user and group databases from `IN_IMAGEFILE`")
+	if err := cmd.RegisterFlagCompletionFunc("base", completeFileExt("tar")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&user.Name, "name", "", "Add the user `NAME`")
+	if err := cmd.MarkFlagRequired("name"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().IntVar(&user.UID, "uid", 0, "The numeric user ID of the user")
+	if err := cmd.MarkFlagRequired("uid"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&user.Group, "group", "",
+		"The name of the user's primary `GROUP` (default: the same as --name)")
+	cmd.Flags().IntVar(&user.GID, "gid", 0,
+		"The numeric group ID of the user's primary group (default: the existing --group's GID, "+
+			"or else the same as --uid)")
+	cmd.Flags().StringVar(&user.Gecos, "comment", "", "The `COMMENT` (GECOS) field, such as a full name")
+	cmd.Flags().StringVar(&user.Home, "home", "", "The user's home `DIRECTORY` (default: /home/NAME)")
+	cmd.Flags().StringVar(&user.Shell, "shell", "", "The user's login `SHELL` (default: /sbin/nologin)")
+
+	argparserLayer.AddCommand(cmd)
+}
@@ -1,23 +1,72 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/datawire/dlib/dlog"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/spf13/cobra"
 	"sigs.k8s.io/yaml"
 
 	"github.com/datawire/ocibuild/pkg/cliutil"
 	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/platform"
 	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/python/pep405"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pep668"
 	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/python/pypa/core_metadata"
+	"github.com/datawire/ocibuild/pkg/python/pypa/direct_url"
 	"github.com/datawire/ocibuild/pkg/python/pypa/entry_points"
 	"github.com/datawire/ocibuild/pkg/python/pypa/recording_installs"
+	"github.com/datawire/ocibuild/pkg/python/slim"
+	"github.com/datawire/ocibuild/pkg/squash"
 )
 
 func init() {
-	var platFile string
+	var (
+		platFile          string
+		directURL         string
+		directURLCommitID string
+		directURLEditable bool
+		installer         string
+		requested         bool
+		manifestFile      string
+		slimGlobs         []string
+		slimDefaults      bool
+		localVersion      string
+		setMetadata       []string
+		stripDescription  bool
+		download          bool
+		indexServer       string
+		auth              indexAuth
+		findLinks         string
+		sumDB             checksumDB
+		venvRoot          string
+		externallyManaged pep668.Policy
+		cacheDir          string
+		noCache           bool
+		stepTimeout       time.Duration
+		skipVerify        bool
+		permissiveRecord  bool
+		mtimeMode         string
+		mtimeEpoch        string
+		targets           []string
+		outputDir         string
+		maxLayerSize      cliutil.ByteSize
+		dryRun            bool
+	)
 	cmd := &cobra.Command{
 		Use:   "wheel [flags] IN_WHEELFILE.whl >OUT_LAYERFILE",
 		Short: "Turn a Python wheel in to a layer",
@@ -31,6 +80,16 @@ func init() {
 			"    # This entire file can be generated with the `ocibuild python inspect`\n" +
 			"    # command.\n" +
 			"\n" +
+			"    # optional; the version of this file format (currently 1)\n" +
+			"    SchemaVersion: 1\n" +
+			"\n" +
+			"    # optional; fill in the shebangs and scheme paths below that aren't\n" +
+			"    # given from a common layout: 'debian', 'alpine', 'fedora', 'upstream'\n" +
+			"    # (/usr/local, as in the official 'python' images), or 'venv' (which\n" +
+			"    # uses Venv.Root); this requires VersionInfo.\n" +
+			"    Layout: debian\n" +
+			"    VersionInfo: {major: 3, minor: 9, micro: 2, releaselevel: final, serial: 0}\n" +
+			"\n" +
 			"    # file locations\n" +
 			"    ConsoleShebang: /usr/bin/python3.9\n" +
 			"    GraphicalShebang: /usr/bin/python3.9\n" +
@@ -45,6 +104,8 @@ func init() {
 			"      headers: /usr/include/site/python3.9/\n" +
 			"      scripts: /usr/bin\n" +
 			"      data: /usr\n" +
+			"      # optional; defaults to the headers path\n" +
+			"      include: /usr/include/python3.9\n" +
 			"\n" +
 			"    # user account\n" +
 			"    UID: 0\n" +
@@ -52,61 +113,935 @@ func init() {
 			"    UName: root\n" +
 			"    GName: root\n" +
 			"\n" +
+			"    # optional; normalize the permission bits of installed files\n" +
+			"    # (directories 0755, files 0755 if owner-executable or else 0644),\n" +
+			"    # and/or clear the bits in Umask; by default files from the wheel\n" +
+			"    # get pip's 0755/0644 and generated files are left as-is.\n" +
+			"    Modes:\n" +
+			"      Normalize: true\n" +
+			"      Umask: 0o022\n" +
+			"\n" +
 			"    # command to run on the host (not target) system to generate .pyc\n" +
 			"    # files.  The Python version number must match the target Python's\n" +
 			"    # version number rather precisely; or rather their\n" +
 			"    # `importlib.util.MAGIC_NUMBER` values must match.\n" +
 			"    PyCompile: ['python3.9', '-m', 'compileall']\n" +
 			"\n" +
+			"    # optional; run PyCompile inside of a container of this image file\n" +
+			"    # (such as the base image) with `docker run`, rather than on the host,\n" +
+			"    # so that the magic numbers always match; PyCompile must then be a\n" +
+			"    # Python in the image, such as ['/usr/bin/python3', '-m', 'compileall'].\n" +
+			"    PyCompileImage: ./base.tar\n" +
+			"\n" +
+			"    # optional; set for Windows-flavored targets, where the scheme paths are\n" +
+			"    # Windows paths ('C:\\Python39\\Lib\\site-packages') and the layer is\n" +
+			"    # written in the Windows container layout; implied by WindowsLaunchers.\n" +
+			"    Windows: false\n" +
+			"\n" +
+			"    # optional; only for Windows-flavored targets: files (on the host) to\n" +
+			"    # use as the launcher stubs for '.exe' entry-point script wrappers;\n" +
+			"    # these are distlib's 't64.exe' and 'w64.exe' (also vendored in pip).\n" +
+			"    WindowsLaunchers:\n" +
+			"      Console: ./t64.exe\n" +
+			"      Graphical: ./w64.exe\n" +
+			"\n" +
+			"    # optional; a Go text/template to use instead of the default one for\n" +
+			"    # the entry-point scripts generated from the wheel's entry_points.txt.\n" +
+			"    # It gets .Shebang, .Section, .Name, .Module, .ImportName, and .Func,\n" +
+			"    # and its output must begin with a '#!' line.\n" +
+			"    ScriptTemplate: |\n" +
+			"      #!{{ .Shebang }} -sE\n" +
+			"      import sys\n" +
+			"      from {{ .Module }} import {{ .ImportName }}\n" +
+			"      sys.exit({{ .Func }}())\n" +
+			"\n" +
+			"Instead of a platform file, --platform-file may name one of ocibuild's built-in " +
+			"presets for common base images, such as 'preset:python:3.12-slim' or " +
+			"'preset:debian12-python3.11'; see `ocibuild python platform presets`." +
+			"\n\n" +
+			"The .pyc files that PyCompile generates are kept in the local cache (see " +
+			"--cache-dir), keyed by the content and timestamps of the .py files, the " +
+			"PyCompile command line, and the Python executable; so re-building a layer " +
+			"for an unchanged wheel doesn't need to run PyCompile again.  Use --no-cache " +
+			"to disable this." +
+			"\n\n" +
+			"If the wheel was obtained from a direct URL rather than from a package " +
+			"index, use the --direct-url flag to record its origin in the installed " +
+			"package's .dist-info/direct_url.json (per PEP 610).  The URL is in the " +
+			"form that pip accepts; for example " +
+			"'git+https://github.com/example/project.git@v1.0' for a VCS checkout " +
+			"(in which case --direct-url-commit-id is required), " +
+			"'file:///path/to/project' for a local directory (which may be marked " +
+			"with --direct-url-editable), or 'https://example.com/project.whl' for an " +
+			"archive (in which case the hash of IN_WHEELFILE is recorded)." +
+			"\n\n" +
+			"With --venv, the package is installed in to a virtual environment (per " +
+			"PEP 405) at the given directory rather than in to the platform's own " +
+			"scheme; the layer includes the virtual environment's pyvenv.cfg and its " +
+			"bin/python symlinks to the platform's interpreter (ConsoleShebang), so " +
+			"that it is self-contained.  This requires the platform file to specify " +
+			"VersionInfo." +
+			"\n\n" +
+			"If the platform file has an ExternallyManaged message (as recorded by " +
+			"`ocibuild python inspect` for an interpreter marked EXTERNALLY-MANAGED " +
+			"per PEP 668), installing directly in to the platform's scheme is refused " +
+			"unless --venv is given or --externally-managed says otherwise." +
+			"\n\n" +
+			"With --download, IN_WHEELFILE is not a local file, but is instead the " +
+			"filename of a wheel to fetch from --index-server or --find-links (as with " +
+			"`ocibuild python getwheel`); the downloaded wheel is installed directly, " +
+			"without first being written to disk." +
+			"\n\n" +
+			"With one or more --target flags, the wheel is installed for several platforms " +
+			"in one invocation (such as linux/amd64 and linux/arm64, each with its own " +
+			"platform file), instead of for the single --platform-file.  Several wheels may " +
+			"be given (such as one per architecture); for each target, the wheel that its " +
+			"platform file's Tags most prefer is used (if the platform file has no Tags, " +
+			"exactly one wheel must be given).  The layers are written to OUT_DIR as " +
+			"OS-ARCH[-VARIANT].tar, and a JSON list saying which layer is for which platform " +
+			"(and which wheel it was installed from) is written to stdout." +
+			"\n\n" +
+			"With --max-layer-size, several wheels may be given (such as a package and all of " +
+			"its dependencies), and they are installed as several layers rather than one, each " +
+			"at most SIZE (uncompressed), to respect registry limits on layer size and to " +
+			"improve pull parallelism.  Each wheel is installed separately, and then the " +
+			"installed wheels are grouped in to layers in the order that they are given on the " +
+			"command line, starting a new layer whenever the next wheel wouldn't fit; a wheel " +
+			"is never split between layers, so one that is bigger than SIZE gets a layer to " +
+			"itself.  The layers are written to OUT_DIR as 000.tar, 001.tar, and so on, and " +
+			"their filenames are written to stdout, one per line, in the order that they " +
+			"should be stacked.  Later wheels' files take precedence over earlier ones'.  The " +
+			"grouping only depends on the order and sizes of the wheels, so give them in a " +
+			"consistent order (such as sorted, as with `sort` or `ls`) so that adding, removing, " +
+			"or upgrading one wheel only changes its own layer and those after it, and " +
+			"rebuilds can re-use the cached layers before it." +
+			"\n\n" +
+			"The --mtime-policy flag says what timestamps the installed files get.  The " +
+			"default, 'pip', does what pip does: files from the wheel keep their " +
+			"timestamps, and files generated during installation (.pyc files, scripts, " +
+			"RECORD, and directories) get a timestamp one second after the newest file in " +
+			"the wheel, so that .pyc files are newer than their sources.  'preserve' keeps " +
+			"the wheel's timestamps in the same way (for this command it is the same as " +
+			"'pip'; they differ only for callers of the Go API).  The other " +
+			"policies are relative to --mtime-epoch (which defaults to $SOURCE_DATE_EPOCH): " +
+			"'clamp-to-epoch' keeps the wheel's timestamps but clamps them to the epoch, " +
+			"'force-epoch' sets every timestamp to the epoch, and 'source-date-epoch' sets " +
+			"files from the wheel to the epoch and generated files to one second after it." +
+			"\n\n" +
+			"With --dry-run, nothing is installed or written; instead a YAML description of " +
+			"the wheel (its size, digest, version, and requirements) and of where it would be " +
+			"installed is written to stdout, which is useful for reviewing changes.  With " +
+			"--download, the wheel itself is not downloaded; its metadata is fetched on its own " +
+			"if the index server supports that (PEP 658)." +
+			"\n\n" +
+			"The platform file is validated before anything is installed; use `ocibuild " +
+			"python platform validate` to check a platform file on its own." +
+			"\n\n" +
+			"Directory entries in the layer are named with a trailing \"/\", as tar itself " +
+			"does.  Older versions of ocibuild named them without it, so a layer created " +
+			"from the same wheel by an older version has a different digest." +
+			"\n\n" +
 			"LIMITATION: While checksums are verified, signatures are not.",
-		Args: cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+		Args: cliutil.WrapPositionalArgs(func(cmd *cobra.Command, args []string) error {
+			if len(targets) > 0 || maxLayerSize != 0 {
+				return cobra.MinimumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		}),
+
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if download {
+				return completeWheelFilenames(cmd, args, toComplete)
+			}
+			return completeFileExt("whl")(cmd, args, toComplete)
+		},
+
 		RunE: func(flags *cobra.Command, args []string) error {
-			yamlBytes, err := os.ReadFile(platFile)
+			ctx := flags.Context()
+			timeouts := bdist.StepTimeouts{
+				IntegrityCheck: stepTimeout,
+				PyCompile:      stepTimeout,
+				GenerateLayer:  stepTimeout,
+			}
+			if skipVerify {
+				ctx = bdist.WithoutRecordVerification(ctx)
+			}
+			if permissiveRecord {
+				ctx = bdist.WithPermissiveRecord(ctx)
+			}
+			if mtimeMode != string(bdist.MtimePip) || mtimeEpoch != "" {
+				validMode := false
+				for _, mode := range bdist.MtimeModes {
+					validMode = validMode || mtimeMode == string(mode)
+				}
+				if !validMode {
+					return cliutil.FlagErrorFunc(flags, fmt.Errorf("invalid --mtime-policy %q", mtimeMode))
+				}
+				policy := bdist.MtimePolicy{
+					Mode:  bdist.MtimeMode(mtimeMode),
+					Epoch: time.Time{},
+				}
+				epochStr := mtimeEpoch
+				if epochStr == "" {
+					if sde := os.Getenv("SOURCE_DATE_EPOCH"); sde != "" {
+						epochStr = "@" + sde
+					}
+				}
+				epoch, err := parseClampTime(epochStr)
+				if err != nil {
+					return cliutil.FlagErrorFunc(flags, fmt.Errorf("invalid --mtime-epoch %q: %w", epochStr, err))
+				}
+				if epoch.IsZero() && policy.Mode != bdist.MtimePip && policy.Mode != bdist.MtimePreserve {
+					return cliutil.FlagErrorFunc(flags, fmt.Errorf(
+						"--mtime-policy=%s requires --mtime-epoch or $SOURCE_DATE_EPOCH", mtimeMode))
+				}
+				policy.Epoch = epoch
+				ctx = bdist.WithMtimePolicy(ctx, policy)
+			}
+
+			mutators, err := parseMetadataFlags(localVersion, setMetadata, stripDescription)
+			if err != nil {
+				return cliutil.FlagErrorFunc(flags, err)
+			}
+
+			// Cache the compiled .pyc files, so that re-building the layer for an unchanged
+			// wheel doesn't need to run the compiler again.
+			var compileCache python.CompileCache
+			if !noCache {
+				if store, err := openCache(cacheDir); err != nil {
+					dlog.Warnf(ctx, "cache: %v", err)
+				} else {
+					compileCache = store
+				}
+			}
+
+			openWheel := func(arg string) (wheelReader io.ReaderAt, wheelSize int64, closeFn func(), err error) {
+				if download {
+					content, err := downloadWheel(ctx, indexServer, auth, findLinks, cacheDir, noCache, sumDB, arg)
+					if err != nil {
+						return nil, 0, nil, err
+					}
+					return bytes.NewReader(content), int64(len(content)), func() {}, nil
+				}
+				wheelFile, err := os.Open(arg)
+				if err != nil {
+					return nil, 0, nil, err
+				}
+				wheelInfo, err := wheelFile.Stat()
+				if err != nil {
+					_ = wheelFile.Close()
+					return nil, 0, nil, err
+				}
+				return wheelFile, wheelInfo.Size(), func() { _ = wheelFile.Close() }, nil
+			}
+
+			// resolvePlatform applies --venv and --externally-managed to plat, returning the
+			// platform to install for and the virtual environment (if any) to create.
+			resolvePlatform := func(platFile string, plat python.Platform) (python.Platform, string, error) {
+				venvRoot := venvRoot
+				if venvRoot == "" && externallyManaged == pep668.PolicyVenv && plat.Venv == nil &&
+					plat.ExternallyManaged != "" {
+					venvRoot = pep668.DefaultVenvRoot
+				}
+				if venvRoot != "" {
+					var err error
+					plat, err = plat.WithVenv(venvRoot)
+					if err != nil {
+						return plat, "", fmt.Errorf("--venv: %w", err)
+					}
+				}
+				if err := pep668.Check(plat, externallyManaged); err != nil {
+					return plat, "", fmt.Errorf("%s: %w\n(use --venv or --externally-managed to install anyway)",
+						platFile, err)
+				}
+				return plat, venvRoot, nil
+			}
+
+			install := func(
+				platFile string, plat python.Platform, filename string, wheelReader io.ReaderAt, wheelSize int64,
+			) (ociv1.Layer, *pep376.UninstallManifest, error) {
+				plat, venvRoot, err := resolvePlatform(platFile, plat)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				urlData, err := parseDirectURLFlags(directURL, directURLCommitID, directURLEditable,
+					wheelReader, wheelSize)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				hooks := []bdist.PostInstallHook{
+					entry_points.CreateScripts(plat),
+				}
+				slimGlobs := slimGlobs
+				if slimDefaults {
+					slimGlobs = append(append([]string(nil), slim.DefaultGlobs...), slimGlobs...)
+				}
+				if len(slimGlobs) > 0 {
+					hooks = append(hooks, slim.Filter(plat, slimGlobs, func(rpt slim.Report) {
+						dlog.Infof(ctx, "slim: %v", rpt)
+					}))
+				}
+				if len(mutators) > 0 {
+					hooks = append(hooks, core_metadata.Mutate(mutators...))
+				}
+				if requested {
+					hooks = append(hooks, pep376.RecordRequested(""))
+				}
+				if externallyManaged == pep668.PolicyOverride && plat.Venv == nil &&
+					plat.ExternallyManaged != "" {
+					hooks = append(hooks, pep668.RecordOverride())
+				}
+				hooks = append(hooks, recording_installs.Record(
+					"sha256",
+					installer,
+					urlData,
+				))
+				var manifest *pep376.UninstallManifest
+				if manifestFile != "" {
+					hooks = append(hooks, pep376.RecordUninstallManifest(func(m *pep376.UninstallManifest) error {
+						manifest = m
+						return nil
+					}))
+				}
+				if venvRoot != "" {
+					// This comes last, so that the virtual environment itself doesn't get
+					// recorded as part of the package.
+					hooks = append(hooks, pep405.CreateVenv(plat))
+				}
+
+				layer, err := bdist.InstallWheelFromReaderWithTimeouts(ctx,
+					plat,
+					time.Time{}, // minTime: zero; don't enforce minTime
+					time.Time{}, // maxTime: zero; auto based on the timestamps in the wheel
+					filename,
+					wheelReader,
+					wheelSize,
+					bdist.PostInstallHooks(hooks...),
+					timeouts,
+				)
+				if err != nil {
+					return nil, nil, err
+				}
+				return layer, manifest, nil
+			}
+
+			// planInstall describes, for --dry-run, installing a wheel for a platform.
+			planInstall := func(
+				platFile string, plat python.Platform, wheel planInput, destination string,
+			) (planOutput, error) {
+				plat, venvRoot, err := resolvePlatform(platFile, plat)
+				if err != nil {
+					return planOutput{}, err //nolint:exhaustivestruct // zero value
+				}
+				details := map[string]string{
+					"platformFile": platFile,
+					"wheel":        wheel.Name,
+					"purelib":      plat.Scheme.PureLib,
+					"platlib":      plat.Scheme.PlatLib,
+					"scripts":      plat.Scheme.Scripts,
+				}
+				if venvRoot != "" {
+					details["venv"] = venvRoot
+				}
+				return planOutput{
+					Destination: destination,
+					Details:     details,
+				}, nil
+			}
+
+			if len(targets) > 0 {
+				if flags.Flags().Changed("platform-file") {
+					return cliutil.FlagErrorFunc(flags, fmt.Errorf("--platform-file and --target are mutually exclusive"))
+				}
+				if maxLayerSize != 0 {
+					return cliutil.FlagErrorFunc(flags,
+						fmt.Errorf("--max-layer-size and --target are mutually exclusive"))
+				}
+				if manifestFile != "" {
+					return cliutil.FlagErrorFunc(flags, fmt.Errorf("--uninstall-manifest is not supported with --target"))
+				}
+				if outputDir == "" {
+					return cliutil.FlagErrorFunc(flags, fmt.Errorf("--target requires --output-dir"))
+				}
+				if dryRun {
+					matrix, err := parseWheelTargets(targets, outputDir, args, nil)
+					if err != nil {
+						return err
+					}
+					var p plan
+					planned := make(map[string]planInput)
+					for _, target := range matrix {
+						wheel, ok := planned[target.wheel]
+						if !ok {
+							wheel, err = planWheel(ctx, download, indexServer, auth, findLinks, cacheDir, noCache,
+								target.wheel)
+							if err != nil {
+								return err
+							}
+							planned[target.wheel] = wheel
+							p.Inputs = append(p.Inputs, wheel)
+						}
+						output, err := planInstall(target.platFile, target.plat, wheel, target.layerFile)
+						if err != nil {
+							return fmt.Errorf("--target=%q: %w", target.flag, err)
+						}
+						output.Details["platform"] = platform.String(target.ociPlat)
+						p.Outputs = append(p.Outputs, output)
+					}
+					return writePlan(p)
+				}
+				return installWheelMatrix(ctx, targets, outputDir, args, compileCache, openWheel, install)
+			}
+
+			if platFile == "" {
+				return cliutil.FlagErrorFunc(flags, fmt.Errorf(`required flag(s) "platform-file" not set`))
+			}
+			plat, err := loadPlatformFile(platFile, compileCache)
 			if err != nil {
 				return err
 			}
-			var plat struct {
-				python.Platform
-				PyCompile []string
+			if maxLayerSize != 0 {
+				var flagErr error
+				switch {
+				case manifestFile != "":
+					flagErr = fmt.Errorf("--uninstall-manifest is not supported with --max-layer-size")
+				case dryRun:
+					flagErr = fmt.Errorf("--dry-run is not supported with --max-layer-size")
+				case outputDir == "":
+					flagErr = fmt.Errorf("--max-layer-size requires --output-dir")
+				}
+				if flagErr != nil {
+					return cliutil.FlagErrorFunc(flags, flagErr)
+				}
+				return installWheelsSplit(ctx, platFile, plat, args, int64(maxLayerSize), outputDir,
+					openWheel, install)
 			}
-			if err := yaml.Unmarshal(yamlBytes, &plat, yaml.DisallowUnknownFields); err != nil {
-				return fmt.Errorf("%s: %w", platFile, err)
+			if dryRun {
+				wheel, err := planWheel(ctx, download, indexServer, auth, findLinks, cacheDir, noCache, args[0])
+				if err != nil {
+					return err
+				}
+				output, err := planInstall(platFile, plat, wheel, "stdout")
+				if err != nil {
+					return err
+				}
+				p := plan{
+					Inputs:  []planInput{wheel},
+					Outputs: []planOutput{output},
+				}
+				if manifestFile != "" {
+					p.Outputs = append(p.Outputs, planOutput{
+						Destination: manifestFile,
+						Details:     map[string]string{"uninstallManifest": wheel.Name},
+					})
+				}
+				return writePlan(p)
 			}
-			plat.Platform.PyCompile, err = python.ExternalCompiler(plat.PyCompile...)
+			wheelReader, wheelSize, closeWheel, err := openWheel(args[0])
 			if err != nil {
 				return err
 			}
-
-			ctx := flags.Context()
-
-			layer, err := bdist.InstallWheel(ctx,
-				plat.Platform,
-				time.Time{}, // minTime: zero; don't enforce minTime
-				time.Time{}, // maxTime: zero; auto based on the timestamps in the wheel
-				args[0],     // filename
-				bdist.PostInstallHooks(
-					entry_points.CreateScripts(plat.Platform),
-					recording_installs.Record(
-						"sha256",
-						"ocibuild layer wheel",
-						nil, // direct_url
-					),
-				),
-			)
+			defer closeWheel()
+			layer, manifest, err := install(platFile, plat, filepath.Base(args[0]), wheelReader, wheelSize)
 			if err != nil {
 				return err
 			}
 
-			if err := fsutil.WriteLayer(layer, os.Stdout); err != nil {
+			if manifest != nil {
+				manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(manifestFile, append(manifestBytes, '\n'), 0o666); err != nil {
+					return err
+				}
+			}
+
+			if err := writeLayer(ctx, layer, os.Stdout); err != nil {
 				return err
 			}
 			return nil
 		},
 	}
 	cmd.Flags().StringVar(&platFile, "platform-file", "",
-		"Read `IN_YAML_FILE` to determine details about the target platform")
-	if err := cmd.MarkFlagRequired("platform-file"); err != nil {
+		"Read `IN_YAML_FILE` to determine details about the target platform, or use a built-in "+
+			"preset with 'preset:NAME' (see `ocibuild python platform presets`) "+
+			"(required, unless --target is given, or it is set by $OCIBUILD_PLATFORM_FILE or the config file)")
+	if err := cmd.RegisterFlagCompletionFunc("platform-file", completeFileExt("yml", "yaml", "json")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&venvRoot, "venv", "",
+		"Install in to a virtual environment at `DIR` (an absolute path on the target)")
+	cmd.Flags().Var(&externallyManaged, "externally-managed",
+		"If the platform is marked as EXTERNALLY-MANAGED (PEP 668), `POLICY` says what to do: "+
+			"'error' to refuse to install, 'venv' to install in to a virtual environment at --venv "+
+			"(default "+pep668.DefaultVenvRoot+"), or 'override' to install anyway and record that "+
+			"in the package's .dist-info")
+	if err := cmd.RegisterFlagCompletionFunc("externally-managed",
+		completeWords("error", "venv", "override")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&directURL, "direct-url", "",
+		"Record that the wheel was installed from `URL` (see PEP 610)")
+	cmd.Flags().StringVar(&directURLCommitID, "direct-url-commit-id", "",
+		"For a VCS --direct-url, the exact commit `ID` that was checked out")
+	cmd.Flags().BoolVar(&directURLEditable, "direct-url-editable", false,
+		"For a local-directory --direct-url, record that it was an editable install")
+	cmd.Flags().StringArrayVar(&slimGlobs, "slim", nil,
+		"Omit files matching `GLOB` (such as 'tests' or '*.pyi') from the layer; a GLOB without "+
+			"a '/' is matched against each path component; may be given multiple times")
+	cmd.Flags().BoolVar(&slimDefaults, "slim-defaults", false,
+		fmt.Sprintf("Shorthand for --slim for each of %q", slim.DefaultGlobs))
+	cmd.Flags().StringVar(&localVersion, "local-version", "",
+		"Add the PEP 440 local version `LABEL` to the installed package's version "+
+			"(in .dist-info/METADATA), such as '1.2.3' becoming '1.2.3+LABEL'")
+	cmd.Flags().StringArrayVar(&setMetadata, "set-metadata", nil,
+		"Set the `FIELD=VALUE` in the installed package's .dist-info/METADATA, replacing any "+
+			"existing FIELD; may be given multiple times")
+	cmd.Flags().BoolVar(&stripDescription, "strip-description", false,
+		"Remove the long description from the installed package's .dist-info/METADATA, to "+
+			"save space")
+	cmd.Flags().StringVar(&installer, "installer", "ocibuild layer wheel",
+		"Record `NAME` as the tool that installed the package (in .dist-info/INSTALLER); "+
+			"set to an empty string to omit the INSTALLER file")
+	cmd.Flags().BoolVar(&requested, "requested", false,
+		"Mark the package as having been installed by direct user request, rather than "+
+			"as a dependency (in .dist-info/REQUESTED)")
+	cmd.Flags().StringVar(&manifestFile, "uninstall-manifest", "",
+		"Write a JSON manifest of the files to remove to uninstall the package to `OUT_JSON_FILE`")
+	cmd.Flags().BoolVar(&download, "download", false,
+		"Download IN_WHEELFILE from --index-server, rather than reading a local file")
+	cmd.Flags().StringVar(&indexServer, "index-server", pep503.PyPIBaseURL,
+		"With --download, the index server to download the wheel from")
+	addIndexAuthFlags(cmd, &auth)
+	addFindLinksFlag(cmd, &findLinks)
+	addCacheDirFlag(cmd, &cacheDir)
+	cmd.Flags().BoolVar(&noCache, "no-cache", false,
+		"Don't use the local cache, either of downloaded wheels (with --download) or of "+
+			"compiled .pyc files")
+	addChecksumDBFlags(cmd, &sumDB)
+	cmd.Flags().DurationVar(&stepTimeout, "step-timeout", 0,
+		"Abort if any single step of installation (verifying the RECORD hashes, compiling .pyc "+
+			"files, or generating the layer) takes longer than `DURATION`; 0 means no limit")
+	cmd.Flags().BoolVar(&skipVerify, "skip-verify", false,
+		"Don't verify the hashes in the wheel's RECORD file; only use this for wheels from a "+
+			"trusted source that have already been verified, such as the local download cache")
+	cmd.Flags().BoolVar(&permissiveRecord, "permissive-record", false,
+		"Tolerate a wheel with a missing or incomplete RECORD file (files not listed in it, or "+
+			"rows without a hash or size), logging warnings instead of failing; the hashes that "+
+			"are present are still verified")
+	mtimeModes := make([]string, 0, len(bdist.MtimeModes))
+	for _, mode := range bdist.MtimeModes {
+		mtimeModes = append(mtimeModes, string(mode))
+	}
+	cmd.Flags().StringVar(&mtimeMode, "mtime-policy", string(bdist.MtimePip),
+		"What timestamps to give installed files: "+strings.Join(mtimeModes, ", "))
+	if err := cmd.RegisterFlagCompletionFunc("mtime-policy", completeWords(mtimeModes...)); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&mtimeEpoch, "mtime-epoch", "",
+		"The epoch for --mtime-policy, as RFC 3339 `TIME`, '@UNIX_SECONDS', or 'now' "+
+			"(default $SOURCE_DATE_EPOCH)")
+	cmd.Flags().StringArrayVar(&targets, "target", nil,
+		"Install for the platform `OS/ARCH[/VARIANT]=IN_YAML_FILE` (rather than for --platform-file); "+
+			"may be given multiple times")
+	if err := cmd.RegisterFlagCompletionFunc("target", completeWords(
+		"linux/amd64=", "linux/arm64=", "linux/arm/v7=")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&outputDir, "output-dir", "",
+		"With --target or --max-layer-size, write the output layers to `OUT_DIR`")
+	if err := cmd.RegisterFlagCompletionFunc("output-dir", completeDirs); err != nil {
 		panic(err)
 	}
+	cmd.Flags().Var(&maxLayerSize, "max-layer-size",
+		"Install several wheels as several layers, each at most `SIZE` (uncompressed, such as '500Mi')")
+	addDryRunFlag(cmd, &dryRun)
 	argparserLayer.AddCommand(cmd)
 }
+
+// parseMetadataFlags returns the core_metadata.Mutators for the --local-version, --set-metadata,
+// and --strip-description flags.
+func parseMetadataFlags(
+	localVersion string,
+	setMetadata []string,
+	stripDescription bool,
+) ([]core_metadata.Mutator, error) {
+	var mutators []core_metadata.Mutator
+	for _, kv := range setMetadata {
+		eq := strings.Index(kv, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid --set-metadata %q: must be FIELD=VALUE", kv)
+		}
+		mutator, err := core_metadata.SetField(core_metadata.MetadataFile, kv[:eq], kv[eq+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid --set-metadata %q: %w", kv, err)
+		}
+		mutators = append(mutators, mutator)
+	}
+	if localVersion != "" {
+		mutator, err := core_metadata.LocalVersion(localVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --local-version: %w", err)
+		}
+		mutators = append(mutators, mutator)
+	}
+	if stripDescription {
+		mutators = append(mutators, core_metadata.StripDescription())
+	}
+	return mutators, nil
+}
+
+func parseDirectURLFlags(
+	directURL, commitID string, editable bool, wheelReader io.ReaderAt, wheelSize int64,
+) (*direct_url.DirectURL, error) {
+	if directURL == "" {
+		if commitID != "" {
+			return nil, fmt.Errorf("--direct-url-commit-id requires --direct-url")
+		}
+		if editable {
+			return nil, fmt.Errorf("--direct-url-editable requires --direct-url")
+		}
+		return nil, nil
+	}
+	urlData, err := direct_url.ParseRequirementURL(directURL)
+	if err != nil {
+		return nil, fmt.Errorf("--direct-url: %w", err)
+	}
+	switch {
+	case urlData.VCSInfo != nil:
+		if commitID == "" {
+			return nil, fmt.Errorf("--direct-url=%q is a VCS URL, and requires --direct-url-commit-id", directURL)
+		}
+		urlData.VCSInfo.CommitID = commitID
+	case commitID != "":
+		return nil, fmt.Errorf("--direct-url-commit-id is only valid with a VCS --direct-url")
+	}
+	switch {
+	case urlData.DirInfo != nil:
+		urlData.DirInfo.Editable = editable
+	case editable:
+		return nil, fmt.Errorf("--direct-url-editable is only valid with a local-directory --direct-url")
+	}
+	if urlData.ArchiveInfo != nil {
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, io.NewSectionReader(wheelReader, 0, wheelSize)); err != nil {
+			return nil, err
+		}
+		sum := fmt.Sprintf("%x", hasher.Sum(nil))
+		urlData.ArchiveInfo.Hash = "sha256=" + sum
+		urlData.ArchiveInfo.Hashes = map[string]string{"sha256": sum}
+	}
+	if err := urlData.Validate(); err != nil {
+		return nil, fmt.Errorf("--direct-url: %w", err)
+	}
+	return urlData, nil
+}
+
+// presetPrefix marks a --platform-file argument as naming a built-in preset (see python.Presets)
+// rather than a file.
+const presetPrefix = "preset:"
+
+// loadPlatformFile reads a --platform-file YAML file, or a "preset:NAME" built-in preset.  If
+// compileCache is non-nil, then the platform's PyCompile caches its output in it.
+func loadPlatformFile(platFile string, compileCache python.CompileCache) (python.Platform, error) {
+	if strings.HasPrefix(platFile, presetPrefix) {
+		yamlBytes, err := presetPlatformFile(strings.TrimPrefix(platFile, presetPrefix))
+		if err != nil {
+			return python.Platform{}, fmt.Errorf("%s: %w", platFile, err) //nolint:exhaustivestruct // zero value
+		}
+		return parsePlatformFile(platFile, yamlBytes, compileCache)
+	}
+	yamlBytes, err := os.ReadFile(platFile)
+	if err != nil {
+		return python.Platform{}, err //nolint:exhaustivestruct // zero value
+	}
+	return parsePlatformFile(platFile, yamlBytes, compileCache)
+}
+
+// presetPlatformFile returns the contents of a platform file for a built-in preset.  The .pyc
+// files are compiled with the host's "pythonX.Y", which must be the same minor version as the
+// preset's.
+func presetPlatformFile(name string) ([]byte, error) {
+	preset, err := python.LookupPreset(name)
+	if err != nil {
+		return nil, err
+	}
+	plat, err := preset.Platform()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(struct {
+		python.Platform
+		PyCompile []string
+	}{
+		Platform: plat,
+		PyCompile: []string{
+			fmt.Sprintf("python%d.%d", plat.VersionInfo.Major, plat.VersionInfo.Minor),
+			"-m", "compileall",
+		},
+	})
+}
+
+// parsePlatformFile parses and validates the contents of a --platform-file YAML (or JSON) file
+// (applying its Layout, if any); platFile is only used for error messages.
+func parsePlatformFile(platFile string, yamlBytes []byte, compileCache python.CompileCache) (python.Platform, error) {
+	var err error
+	var plat struct {
+		python.Platform
+		PyCompile        []string
+		PyCompileImage   string
+		WindowsLaunchers *struct {
+			Console   string
+			Graphical string
+		}
+	}
+	if err := python.UnmarshalPlatform(yamlBytes, &plat); err != nil {
+		return plat.Platform, fmt.Errorf("%s: %w", platFile, err)
+	}
+	var identity string
+	if plat.PyCompileImage != "" {
+		img, err := fsutil.OpenImage(plat.PyCompileImage)
+		if err != nil {
+			return plat.Platform, fmt.Errorf("%s: PyCompileImage: %w", platFile, err)
+		}
+		plat.Platform.PyCompile, err = python.ContainerCompiler(img, plat.PyCompile...)
+		if err != nil {
+			return plat.Platform, fmt.Errorf("%s: PyCompile: %w", platFile, err)
+		}
+		if compileCache != nil {
+			if identity, err = python.ContainerCompilerIdentity(img, plat.PyCompile...); err != nil {
+				return plat.Platform, err
+			}
+		}
+	} else {
+		plat.Platform.PyCompile, err = python.ExternalCompiler(plat.PyCompile...)
+		if err != nil {
+			return plat.Platform, err
+		}
+		if compileCache != nil {
+			if identity, err = python.ExternalCompilerIdentity(plat.PyCompile...); err != nil {
+				return plat.Platform, err
+			}
+			// In case PyCompile is a wrapper script (such as a pyenv shim) that would pick a
+			// different Python without itself changing.
+			identity += fmt.Sprintf(" magic=%x", plat.MagicNumber)
+		}
+	}
+	if _, err := entry_points.ParseScriptTemplate(plat.ScriptTemplate); err != nil {
+		return plat.Platform, fmt.Errorf("%s: %w", platFile, err)
+	}
+	if compileCache != nil {
+		plat.Platform.PyCompile = python.CachingCompiler(plat.Platform.PyCompile, identity, compileCache)
+	}
+	if plat.WindowsLaunchers != nil {
+		var launchers python.WindowsLaunchers
+		if launchers.Console, err = os.ReadFile(plat.WindowsLaunchers.Console); err != nil {
+			return plat.Platform, fmt.Errorf("%s: WindowsLaunchers: %w", platFile, err)
+		}
+		if launchers.Graphical, err = os.ReadFile(plat.WindowsLaunchers.Graphical); err != nil {
+			return plat.Platform, fmt.Errorf("%s: WindowsLaunchers: %w", platFile, err)
+		}
+		plat.Platform.WindowsLaunchers = &launchers
+	}
+	if err := plat.Platform.ApplyLayout(); err != nil {
+		return plat.Platform, fmt.Errorf("%s: %w", platFile, err)
+	}
+	if err := plat.Platform.Validate(); err != nil {
+		return plat.Platform, fmt.Errorf("%s: %w", platFile, err)
+	}
+	return plat.Platform, nil
+}
+
+// wheelMatrixEntry is an entry in the JSON list that `ocibuild layer wheel --target` writes to
+// stdout, saying which layer is for which platform.
+type wheelMatrixEntry struct {
+	Platform ociv1.Platform `json:"platform"`
+	Wheel    string         `json:"wheel"`
+	Layer    string         `json:"layer"`
+}
+
+// wheelTarget is a parsed --target flag.
+type wheelTarget struct {
+	flag      string
+	ociPlat   ociv1.Platform
+	platFile  string
+	plat      python.Platform
+	wheel     string
+	layerFile string
+}
+
+// parseWheelTargets parses the --target flags, loading each platform file and selecting the wheel
+// to install for it.
+func parseWheelTargets(
+	targets []string,
+	outputDir string,
+	wheels []string,
+	compileCache python.CompileCache,
+) ([]wheelTarget, error) {
+	ret := make([]wheelTarget, 0, len(targets))
+	seen := make(map[string]struct{}, len(targets))
+	for _, target := range targets {
+		eq := strings.Index(target, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid --target %q: must be 'OS/ARCH[/VARIANT]=PLATFORM_FILE'", target)
+		}
+		ociPlat, err := platform.Parse(target[:eq])
+		if err != nil {
+			return nil, fmt.Errorf("invalid --target %q: %w", target, err)
+		}
+		name := strings.ReplaceAll(platform.String(ociPlat), "/", "-")
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("multiple --target flags for platform %q", platform.String(ociPlat))
+		}
+		seen[name] = struct{}{}
+
+		platFile := target[eq+1:]
+		plat, err := loadPlatformFile(platFile, compileCache)
+		if err != nil {
+			return nil, err
+		}
+		wheel, err := selectWheel(plat, wheels)
+		if err != nil {
+			return nil, fmt.Errorf("--target=%q: %w", target, err)
+		}
+		ret = append(ret, wheelTarget{
+			flag:      target,
+			ociPlat:   ociPlat,
+			platFile:  platFile,
+			plat:      plat,
+			wheel:     wheel,
+			layerFile: filepath.Join(outputDir, name+".tar"),
+		})
+	}
+	return ret, nil
+}
+
+func installWheelMatrix(
+	ctx context.Context,
+	targets []string,
+	outputDir string,
+	wheels []string,
+	compileCache python.CompileCache,
+	openWheel func(string) (io.ReaderAt, int64, func(), error),
+	install func(string, python.Platform, string, io.ReaderAt, int64) (ociv1.Layer, *pep376.UninstallManifest, error),
+) error {
+	matrix, err := parseWheelTargets(targets, outputDir, wheels, compileCache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputDir, 0o777); err != nil {
+		return err
+	}
+	entries := make([]wheelMatrixEntry, 0, len(matrix))
+	for _, target := range matrix {
+		wheelReader, wheelSize, closeWheel, err := openWheel(target.wheel)
+		if err != nil {
+			return err
+		}
+		layer, _, err := install(target.platFile, target.plat, filepath.Base(target.wheel), wheelReader, wheelSize)
+		closeWheel()
+		if err != nil {
+			return fmt.Errorf("--target=%q: %w", target.flag, err)
+		}
+
+		dlog.Infof(ctx, "%s: %s => %s", platform.String(target.ociPlat), target.wheel, target.layerFile)
+		if err := writeLayerFile(ctx, layer, target.layerFile); err != nil {
+			return err
+		}
+		entries = append(entries, wheelMatrixEntry{
+			Platform: target.ociPlat,
+			Wheel:    filepath.Base(target.wheel),
+			Layer:    target.layerFile,
+		})
+	}
+	out, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(out, '\n'))
+	return err
+}
+
+// installWheelsSplit installs each of the wheels for plat, and writes them to outputDir as layers
+// that are each at most maxLayerSize (see squash.PartitionBySize), listing the layers on stdout.
+func installWheelsSplit(
+	ctx context.Context,
+	platFile string,
+	plat python.Platform,
+	wheels []string,
+	maxLayerSize int64,
+	outputDir string,
+	openWheel func(string) (io.ReaderAt, int64, func(), error),
+	install func(string, python.Platform, string, io.ReaderAt, int64) (ociv1.Layer, *pep376.UninstallManifest, error),
+) error {
+	layers := make([]squash.NamedLayer, 0, len(wheels))
+	for _, wheel := range wheels {
+		wheelReader, wheelSize, closeWheel, err := openWheel(wheel)
+		if err != nil {
+			return err
+		}
+		layer, _, err := install(platFile, plat, filepath.Base(wheel), wheelReader, wheelSize)
+		closeWheel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", wheel, err)
+		}
+		layers = append(layers, squash.NamedLayer{
+			Name:  filepath.Base(wheel),
+			Layer: layer,
+		})
+	}
+
+	partitions, err := squash.PartitionBySize(layers, maxLayerSize)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputDir, 0o777); err != nil {
+		return err
+	}
+	for i, partition := range partitions {
+		filename := filepath.Join(outputDir, fmt.Sprintf("%03d.tar", i))
+		dlog.Infof(ctx, "%s: %d bytes: %q", filename, partition.Size, partition.Names)
+		if err := writeLayerFile(ctx, partition.Layer, filename); err != nil {
+			return err
+		}
+		if _, err := fmt.Println(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectWheel returns the wheel that plat's Tags most prefer.  If plat doesn't specify Tags, then
+// there must be exactly one wheel.
+func selectWheel(plat python.Platform, wheels []string) (string, error) {
+	if len(plat.Tags) == 0 {
+		if len(wheels) != 1 {
+			return "", fmt.Errorf("the platform file doesn't specify Tags, so exactly 1 wheel must be given; "+
+				"got %d", len(wheels))
+		}
+		return wheels[0], nil
+	}
+	var (
+		best     string
+		bestPref int
+	)
+	for _, wheel := range wheels {
+		fileInfo, err := bdist.ParseFilename(filepath.Base(wheel))
+		if err != nil {
+			return "", err
+		}
+		if !plat.Tags.Supports(fileInfo.CompatibilityTag) {
+			continue
+		}
+		if pref := plat.Tags.Preference(fileInfo.CompatibilityTag); best == "" || pref < bestPref {
+			best, bestPref = wheel, pref
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("none of the wheels are supported by the platform's Tags")
+	}
+	return best, nil
+}
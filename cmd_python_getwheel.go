@@ -1,24 +1,39 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 
+	"github.com/datawire/dlib/dlog"
 	"github.com/spf13/cobra"
 
 	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/checksumdb"
 	"github.com/datawire/ocibuild/pkg/python/pep503"
 	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
 	"github.com/datawire/ocibuild/pkg/python/pypa/simple_repo_api"
+	"github.com/datawire/ocibuild/pkg/python/wheelhouse"
 )
 
 func init() {
-	var indexServer string
+	var (
+		indexServer string
+		auth        indexAuth
+		findLinks   string
+		cacheDir    string
+		noCache     bool
+		sumDB       checksumDB
+	)
 	cmd := &cobra.Command{
 		Use:   "getwheel [flags] NAME_VERSION_PLATFORM.whl >NAME_VERSION_PLATFORM.whl",
 		Short: "Download a wheel file from the Python Package Index",
 		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
 
+		ValidArgsFunction: completeWheelFilenames,
+
 		Long: "Given a wheel filename, download it from a package index, writing the file " +
 			"contents to stdout." +
 			"\n\n" +
@@ -32,35 +47,259 @@ func init() {
 			"LIMITATION: While checksums are verified, GPG signatures are not.",
 
 		RunE: func(flags *cobra.Command, args []string) error {
-			ctx := flags.Context()
-			filename := args[0]
-			filenameInfo, err := bdist.ParseFilename(filename)
+			content, err := downloadWheel(flags.Context(), indexServer, auth, findLinks, cacheDir, noCache, sumDB,
+				args[0])
 			if err != nil {
 				return err
 			}
-			client := simple_repo_api.NewClient(nil, nil)
-			client.BaseURL = indexServer
-			links, err := client.ListPackageFiles(ctx, filenameInfo.Distribution)
-			if err != nil {
+			if _, err := os.Stdout.Write(content); err != nil {
 				return err
 			}
-			for _, link := range links {
-				if link.Text == filename {
-					content, err := link.Get(ctx)
-					if err != nil {
-						return err
-					}
-					if _, err := os.Stdout.Write(content); err != nil {
-						return err
-					}
-					return nil
-				}
-			}
-			return fmt.Errorf("package index does not have wheel %q", filename)
+			return nil
 		},
 	}
 	cmd.Flags().StringVar(&indexServer, "index-server", pep503.PyPIBaseURL,
 		"Index server to download the wheel from")
+	addIndexAuthFlags(cmd, &auth)
+	addFindLinksFlag(cmd, &findLinks)
+	addCacheDirFlag(cmd, &cacheDir)
+	cmd.Flags().BoolVar(&noCache, "no-cache", false,
+		"Don't use the local download cache")
+	addChecksumDBFlags(cmd, &sumDB)
 
 	argparserPython.AddCommand(cmd)
 }
+
+// downloadWheel downloads the wheel file with the given filename from an index server, using the
+// local download cache unless noCache is set.  If findLinks is set, then the wheel is instead read
+// from that wheelhouse directory (as written by `ocibuild python vendor`), without using the
+// network.  Either way, the wheel is then checked against sumDB.
+func downloadWheel(
+	ctx context.Context,
+	indexServer string,
+	auth indexAuth,
+	findLinks, cacheDir string,
+	noCache bool,
+	sumDB checksumDB,
+	filename string,
+) ([]byte, error) {
+	content, err := fetchWheel(ctx, indexServer, auth, findLinks, cacheDir, noCache, filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := sumDB.verify(ctx, filename, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func fetchWheel(
+	ctx context.Context,
+	indexServer string,
+	auth indexAuth,
+	findLinks, cacheDir string,
+	noCache bool,
+	filename string,
+) ([]byte, error) {
+	if findLinks != "" {
+		return wheelhouse.Open(findLinks, filename)
+	}
+	link, err := findWheelLink(ctx, indexServer, auth, cacheDir, noCache, filename)
+	if err != nil {
+		return nil, err
+	}
+	if noCache {
+		return link.Get(ctx)
+	}
+	return getWheelCached(ctx, cacheDir, *link)
+}
+
+// findWheelLink asks the index server for the link to a wheel file, without downloading the
+// wheel.  Unless noCache is set, it remembers the index server's list of files in the cache.
+func findWheelLink(
+	ctx context.Context,
+	indexServer string,
+	auth indexAuth,
+	cacheDir string,
+	noCache bool,
+	filename string,
+) (*pep503.FileLink, error) {
+	if err := checkHermetic("downloading wheels from the index server (use --find-links)"); err != nil {
+		return nil, err
+	}
+	filenameInfo, err := bdist.ParseFilename(filename)
+	if err != nil {
+		return nil, err
+	}
+	client := simple_repo_api.NewClient(nil, nil)
+	client.BaseURL = indexServer
+	client.Credentials = auth.providers(indexServer)
+	setupDownloads(&client.Client, cacheDir, noCache)
+	links, err := client.ListPackageFiles(ctx, filenameInfo.Distribution)
+	if err != nil {
+		return nil, err
+	}
+	if !noCache {
+		// Remember the list of files, for shell completion.
+		filenames := make([]string, 0, len(links))
+		for _, link := range links {
+			filenames = append(filenames, link.Text)
+		}
+		if store, err := openCache(cacheDir); err == nil {
+			err = store.PutIndex(indexServer, pep503.NormalizeName(filenameInfo.Distribution), filenames)
+			if err != nil {
+				dlog.Warnf(ctx, "cache: %v", err)
+			}
+		}
+	}
+	for _, link := range links {
+		if link.Text == filename {
+			ret := link
+			return &ret, nil
+		}
+	}
+	return nil, fmt.Errorf("package index does not have wheel %q: %w", filename, pep503.ErrNotFound)
+}
+
+// setupDownloads configures how a client downloads files, from the global --download-connections
+// and --download-retries flags.  Unless noCache is set, partial downloads are kept in the cache
+// directory, so that if a download fails, the next run can resume it.
+func setupDownloads(client *pep503.Client, cacheDir string, noCache bool) {
+	client.Connections = downloadConnections
+	client.Retries = downloadRetries
+	if !noCache {
+		if store, err := openCache(cacheDir); err == nil {
+			client.PartialDir = store.PartialDir()
+		}
+	}
+}
+
+// indexAuth is the set of flags for authenticating to a private index server; see
+// addIndexAuthFlags.
+type indexAuth struct {
+	tokenCommand string
+	username     string
+}
+
+// indexCredentialsEnvPrefix is the prefix of the per-host environment variables that
+// indexAuth.providers reads credentials from (see pep503.EnvCredentials).
+const indexCredentialsEnvPrefix = "OCIBUILD_INDEX_CREDENTIALS_"
+
+// addIndexAuthFlags adds flags for authenticating to a private index server.
+func addIndexAuthFlags(cmd *cobra.Command, auth *indexAuth) {
+	cmd.Flags().StringVar(&auth.tokenCommand, "index-token-command", "",
+		"Authenticate to --index-server using a token printed by `COMMAND` (split on whitespace), "+
+			"such as 'gcloud auth print-access-token'; credentials are also read from "+
+			"$"+indexCredentialsEnvPrefix+"{HOST} (either 'USERNAME:PASSWORD' or a token) and "+
+			"from ~/.netrc")
+	cmd.Flags().StringVar(&auth.username, "index-username", "",
+		"With --index-token-command, send the token as the password for `USERNAME` (such as "+
+			"'aws' for CodeArtifact or 'oauth2accesstoken' for Artifact Registry) rather than as a "+
+			"bearer token")
+}
+
+// providers returns the credential providers for an index server, in order of precedence: the
+// per-host environment variables, then the token command (only for the index server's own host),
+// then ~/.netrc.
+func (auth indexAuth) providers(indexServer string) []pep503.CredentialProvider {
+	ret := []pep503.CredentialProvider{
+		pep503.EnvCredentials(indexCredentialsEnvPrefix),
+	}
+	if cmdline := strings.Fields(auth.tokenCommand); len(cmdline) > 0 {
+		if u, err := url.Parse(indexServer); err == nil && u.Host != "" {
+			ret = append(ret, pep503.ForHosts(pep503.CommandCredentials(auth.username, cmdline...), u.Host))
+		}
+	}
+	ret = append(ret, pep503.NetrcCredentials(""))
+	return ret
+}
+
+// checksumDB is the set of flags for cross-checking downloads against checksum databases; see
+// addChecksumDBFlags.
+type checksumDB struct {
+	sources []string
+	require bool
+}
+
+// addChecksumDBFlags adds flags for cross-checking downloads against checksum databases.
+func addChecksumDBFlags(cmd *cobra.Command, sumDB *checksumDB) {
+	cmd.Flags().StringArrayVar(&sumDB.sources, "checksum-db", nil,
+		"Refuse downloaded files whose hashes differ from those published by `SOURCE`: either "+
+			"'pypi' for PyPI's JSON API, the https:// URL of another server implementing that API, "+
+			"or the name of a local file of 'FILENAME ALGORITHM:HEXDIGEST' lines; may be given "+
+			"multiple times")
+	cmd.Flags().BoolVar(&sumDB.require, "checksum-db-require", false,
+		"With --checksum-db, also refuse files that none of the checksum databases know about")
+}
+
+func (sumDB checksumDB) verify(ctx context.Context, filename string, content []byte) error {
+	if len(sumDB.sources) == 0 {
+		return nil
+	}
+	sources := make([]checksumdb.Source, 0, len(sumDB.sources))
+	for _, str := range sumDB.sources {
+		if str == "pypi" || strings.HasPrefix(str, "https://") || strings.HasPrefix(str, "http://") {
+			if err := checkHermetic("consulting checksum database " + str); err != nil {
+				return err
+			}
+		}
+		switch {
+		case str == "pypi":
+			sources = append(sources, checksumdb.PyPIJSON{BaseURL: "", HTTPClient: nil})
+		case strings.HasPrefix(str, "https://") || strings.HasPrefix(str, "http://"):
+			sources = append(sources, checksumdb.PyPIJSON{BaseURL: str, HTTPClient: nil})
+		default:
+			sources = append(sources, checksumdb.NewFile(str))
+		}
+	}
+	var project string
+	if fileInfo, err := bdist.ParseFilename(filename); err == nil {
+		project = fileInfo.Distribution
+	}
+	return checksumdb.Verify(ctx, sources, project, filename, content, sumDB.require)
+}
+
+// addFindLinksFlag adds a --find-links flag, for use with downloadWheel.
+func addFindLinksFlag(cmd *cobra.Command, findLinks *string) {
+	cmd.Flags().StringVar(findLinks, "find-links", "",
+		"Read wheels from the wheelhouse `DIR` written by `ocibuild python vendor`, instead of "+
+			"downloading them from the index server")
+	if err := cmd.RegisterFlagCompletionFunc("find-links", completeDirs); err != nil {
+		panic(err)
+	}
+}
+
+// getWheelCached is like link.Get(ctx), but if the index server told us the sha256 of the file,
+// then it first checks the cache.
+func getWheelCached(ctx context.Context, cacheDir string, link pep503.FileLink) ([]byte, error) {
+	store, err := openCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var digest string
+	if u, err := url.Parse(link.HRef); err == nil {
+		if keyvals, err := url.ParseQuery(u.Fragment); err == nil && keyvals.Get("sha256") != "" {
+			digest = "sha256:" + keyvals.Get("sha256")
+		}
+	}
+	if digest != "" {
+		content, ok, err := store.Get(digest)
+		if err != nil {
+			dlog.Warnf(ctx, "cache: %v", err)
+		}
+		if ok {
+			dlog.Infof(ctx, "cache: using cached %s", digest)
+			return content, nil
+		}
+	}
+
+	content, err := link.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := store.Put(content); err != nil {
+		dlog.Warnf(ctx, "cache: %v", err)
+	}
+	return content, nil
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 
 	"github.com/datawire/dlib/dexec"
@@ -17,13 +20,16 @@ import (
 	"github.com/datawire/ocibuild/pkg/dockerutil"
 	"github.com/datawire/ocibuild/pkg/fsutil"
 	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep405"
+	"github.com/datawire/ocibuild/pkg/python/pep668"
 	"github.com/datawire/ocibuild/pkg/python/pyinspect"
 )
 
 func init() {
 	var flags struct {
-		Interpreter string
-		ImageFile   string
+		Interpreter    string
+		ImageFile      string
+		CompileInImage bool
 	}
 	cmd := &cobra.Command{
 		Use:   "inspect [flags] >PYTHON_PLATFORM.yml",
@@ -34,6 +40,17 @@ func init() {
 			"also includes some informative fields that are not used by " +
 			"`ocibuild python wheel`." +
 			"\n\n" +
+			"If the interpreter is in a virtual environment (PEP 405), its pyvenv.cfg " +
+			"is read and recorded as the platform's Venv.  Otherwise, if the " +
+			"interpreter is marked as EXTERNALLY-MANAGED (PEP 668), that is recorded " +
+			"as the platform's ExternallyManaged message, which `ocibuild layer " +
+			"wheel` respects." +
+			"\n\n" +
+			"With --imagefile, the PyCompile command is a Python on the host with the " +
+			"same importlib.util.MAGIC_NUMBER as the image's Python; or with " +
+			"--compile-in-image, it is the image's Python itself, run inside of a " +
+			"container of the image (PyCompileImage)." +
+			"\n\n" +
 			"LIMITATION: The --imagefile flag requires interacting with a running " +
 			"Docker.",
 
@@ -59,9 +76,11 @@ func init() {
 			var plat struct {
 				python.Platform `yaml:",inline"`
 				PyCompile       []string
+				PyCompileImage  string `yaml:",omitempty"`
 			}
 			var err error
 
+			plat.SchemaVersion = python.PlatformSchemaVersion
 			plat.ConsoleShebang, plat.GraphicalShebang, err = pyinspect.Shebangs(sys, flags.Interpreter)
 			if err != nil {
 				return err
@@ -77,11 +96,14 @@ func init() {
 				if err := dockerutil.WithImage(ctx, "python-inspect",
 					image,
 					func(ctx context.Context, tag name.Tag) error {
-						var err error
-						dyn, err = pyinspect.Dynamic(ctx, "docker", "run",
+						cmdline, err := dockerutil.CommandLine(ctx, "run",
 							"--rm",
 							"--entrypoint="+plat.ConsoleShebang,
 							tag.String())
+						if err != nil {
+							return err
+						}
+						dyn, err = pyinspect.Dynamic(ctx, cmdline...)
 						return err
 					},
 				); err != nil {
@@ -97,12 +119,41 @@ func init() {
 			}
 			plat.Tags = dyn.Tags
 
+			if dyn.Prefix != dyn.BasePrefix {
+				cfgFilename := sys.Join(dyn.Prefix, "pyvenv.cfg")
+				cfgBytes, err := sys.ReadFile(cfgFilename)
+				if err != nil {
+					return fmt.Errorf("interpreter is in a virtual environment: %w", err)
+				}
+				cfg, err := pep405.ParseConfig(bytes.NewReader(cfgBytes))
+				if err != nil {
+					return fmt.Errorf("%s: %w", cfgFilename, err)
+				}
+				venv := cfg.Venv(dyn.Prefix, dyn.BaseExecutable, dyn.VersionInfo)
+				plat.Venv = &venv
+			} else {
+				markerFilename := sys.Join(dyn.Stdlib, pep668.Filename)
+				markerBytes, err := sys.ReadFile(markerFilename)
+				switch {
+				case err == nil:
+					plat.ExternallyManaged, err = pep668.Parse(bytes.NewReader(markerBytes))
+					if err != nil {
+						return fmt.Errorf("%s: %w", markerFilename, err)
+					}
+				case errors.Is(err, fs.ErrNotExist):
+					// not externally managed
+				default:
+					return err
+				}
+			}
+
 			dirs := []string{
 				dyn.Scheme.PureLib,
 				dyn.Scheme.PlatLib,
 				dyn.Scheme.Headers,
 				dyn.Scheme.Scripts,
 				dyn.Scheme.Data,
+				dyn.Scheme.Include,
 			}
 			foundOwner := false
 			for _, dir := range dirs {
@@ -121,9 +172,13 @@ func init() {
 				return fmt.Errorf("could not stat any of the scheme directories: %#v", dyn.Scheme)
 			}
 
-			if image == nil {
+			switch {
+			case image == nil:
 				plat.PyCompile = []string{plat.ConsoleShebang, "-m", "compileall"}
-			} else {
+			case flags.CompileInImage:
+				plat.PyCompile = []string{plat.ConsoleShebang, "-m", "compileall"}
+				plat.PyCompileImage = flags.ImageFile
+			default:
 				names := []string{
 					fmt.Sprintf("python%d.%d", dyn.VersionInfo.Major, dyn.VersionInfo.Minor),
 					fmt.Sprintf("python%d", dyn.VersionInfo.Major),
@@ -153,7 +208,7 @@ func init() {
 						magicForLog, nativeDyn.VersionInfo)
 				}
 				if plat.PyCompile == nil {
-					return fmt.Errorf("unable to find a Python installatation on the host system that matches importlib.util.MAGIC_NUMBER=%q (sys.version_info=%+v)", //nolint:lll
+					return fmt.Errorf("unable to find a Python installatation on the host system that matches importlib.util.MAGIC_NUMBER=%q (sys.version_info=%+v); use --compile-in-image to compile in the image instead", //nolint:lll
 						plat.MagicNumber, plat.VersionInfo)
 				}
 			}
@@ -172,6 +227,11 @@ func init() {
 		"The Python interpreter to inspect")
 	cmd.Flags().StringVar(&flags.ImageFile, "imagefile", "",
 		"Inspect a Docker image's Python rather than the host's Python")
+	if err := cmd.RegisterFlagCompletionFunc("imagefile", completeFileExt("tar")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().BoolVar(&flags.CompileInImage, "compile-in-image", false,
+		"With --imagefile, compile .pyc files in a container of the image, rather than with a matching Python on the host")
 
 	argparserPython.AddCommand(cmd)
 }
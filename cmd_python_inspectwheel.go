@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func init() {
+	var auth indexAuth
+	cmd := &cobra.Command{
+		Use:   "inspect-wheel [flags] {IN_WHEELFILE.whl|WHEEL_URL} >OUT_JSONFILE",
+		Short: "Print information about a wheel file, for debugging",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("whl"),
+
+		Long: "Print a JSON object describing a Python wheel file: the parsed filename, " +
+			"the contents of its .dist-info/WHEEL, METADATA, and entry_points.txt files, " +
+			"whether the files in the wheel match its RECORD, and the total size of the " +
+			"files once installed (not counting compiled bytecode)." +
+			"\n\n" +
+			"Problems with the wheel are reported in the \"errors\" and \"recordErrors\" " +
+			"keys rather than causing the command to fail, so that as much information " +
+			"as possible is shown for a broken wheel." +
+			"\n\n" +
+			"If the argument is an http:// or https:// URL, then rather than downloading the " +
+			"whole wheel, HTTP Range requests are used to fetch only the zip central directory " +
+			"and the .dist-info files; RECORD is not verified in this case (\"recordErrors\" " +
+			"is null).  The server must support Range requests.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			var info *bdist.WheelInfo
+			var err error
+			if strings.HasPrefix(args[0], "http://") || strings.HasPrefix(args[0], "https://") {
+				info, err = inspectRemoteWheel(flags, args[0], auth)
+			} else {
+				info, err = bdist.InspectWheel(args[0])
+			}
+			if err != nil {
+				return err
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetEscapeHTML(false)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(info)
+		},
+	}
+
+	addIndexAuthFlags(cmd, &auth)
+
+	argparserPython.AddCommand(cmd)
+}
+
+func inspectRemoteWheel(flags *cobra.Command, wheelURL string, auth indexAuth) (*bdist.WheelInfo, error) {
+	if err := checkHermetic("inspecting remote wheels"); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(wheelURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wheel URL: %w", err)
+	}
+	client := pep503.Client{ //nolint:exhaustivestruct
+		Credentials: auth.providers(u.Scheme + "://" + u.Host + "/"),
+	}
+	zipReader, _, err := client.OpenZip(flags.Context(), wheelURL)
+	if err != nil {
+		if errors.Is(err, pep503.ErrNoRanges) {
+			err = fmt.Errorf("%w; download the wheel and inspect the file instead", err)
+		}
+		return nil, err
+	}
+	return bdist.InspectWheelMetadata(path.Base(u.Path), zipReader)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/python/pypa/entry_points"
+	"github.com/datawire/ocibuild/pkg/python/pypa/recording_installs"
+)
+
+func init() {
+	var (
+		platFile         string
+		dest             string
+		noChown          bool
+		installer        string
+		requested        bool
+		cacheDir         string
+		noCache          bool
+		skipVerify       bool
+		permissiveRecord bool
+	)
+	cmd := &cobra.Command{
+		Use:   "install [flags] --dest=OUT_DIR IN_WHEELFILE.whl",
+		Short: "Install a Python wheel in to a directory on disk",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("whl"),
+
+		Long: "Given a Python wheel file, install it in to a directory on disk, rather " +
+			"than in to a layer; this is for build flows that don't produce container " +
+			"images, such as building a .deb or .rpm package, or populating a chroot, " +
+			"where ocibuild can be used in place of `pip install --root`." +
+			"\n\n" +
+			"The installation is exactly the same as `ocibuild layer wheel` does (and " +
+			"--platform-file is the same as for that command); the files that would be " +
+			"in the layer are written under OUT_DIR instead.  So the platform's scheme " +
+			"paths are relative to OUT_DIR; a purelib of /usr/lib/python3.9/site-packages " +
+			"is installed to OUT_DIR/usr/lib/python3.9/site-packages." +
+			"\n\n" +
+			"Files are given the ownership (UID and GID) from the platform file if " +
+			"possible, which generally requires running as root; otherwise (or with " +
+			"--no-chown) they are owned by the current user.  Directories that already " +
+			"exist in OUT_DIR are left as-is; files that already exist are replaced." +
+			"\n\n" +
+			"LIMITATION: Windows-flavored platforms are not supported, since ocibuild " +
+			"cannot write Windows file attributes.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			ctx := flags.Context()
+			if skipVerify {
+				ctx = bdist.WithoutRecordVerification(ctx)
+			}
+			if permissiveRecord {
+				ctx = bdist.WithPermissiveRecord(ctx)
+			}
+
+			var compileCache python.CompileCache
+			if !noCache {
+				if store, err := openCache(cacheDir); err != nil {
+					dlog.Warnf(ctx, "cache: %v", err)
+				} else {
+					compileCache = store
+				}
+			}
+			plat, err := loadPlatformFile(platFile, compileCache)
+			if err != nil {
+				return err
+			}
+			if plat.Windows || plat.WindowsLaunchers != nil {
+				return fmt.Errorf("%s: Windows-flavored platforms are not supported", platFile)
+			}
+
+			wheelFile, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = wheelFile.Close()
+			}()
+			wheelInfo, err := wheelFile.Stat()
+			if err != nil {
+				return err
+			}
+
+			hooks := []bdist.PostInstallHook{
+				entry_points.CreateScripts(plat),
+			}
+			if requested {
+				hooks = append(hooks, pep376.RecordRequested(""))
+			}
+			hooks = append(hooks, recording_installs.Record(
+				"sha256",
+				installer,
+				nil, // direct_url
+			))
+
+			vfs, _, err := bdist.InstallWheelToVFS(ctx,
+				plat,
+				time.Time{}, // minTime: zero; don't enforce minTime
+				time.Time{}, // maxTime: zero; auto based on the timestamps in the wheel
+				filepath.Base(args[0]),
+				wheelFile,
+				wheelInfo.Size(),
+				bdist.PostInstallHooks(hooks...),
+			)
+			if err != nil {
+				return err
+			}
+			return fsutil.WriteToDir(ctx, dest, fsutil.FileReferencesFromMap(vfs), !noChown)
+		},
+	}
+	cmd.Flags().StringVar(&platFile, "platform-file", "",
+		"Read `IN_YAML_FILE` to determine details about the target platform (see `ocibuild layer wheel --help`)")
+	if err := cmd.RegisterFlagCompletionFunc("platform-file", completeFileExt("yml", "yaml", "json")); err != nil {
+		panic(err)
+	}
+	if err := cmd.MarkFlagRequired("platform-file"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&dest, "dest", "",
+		"Install the wheel in to `OUT_DIR`, which is created if it doesn't exist")
+	if err := cmd.MarkFlagDirname("dest"); err != nil {
+		panic(err)
+	}
+	if err := cmd.MarkFlagRequired("dest"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().BoolVar(&noChown, "no-chown", false,
+		"Don't try to give the installed files the platform file's UID and GID")
+	cmd.Flags().StringVar(&installer, "installer", "ocibuild python install",
+		"Record `NAME` as the tool that installed the package (in .dist-info/INSTALLER); "+
+			"set to an empty string to omit the INSTALLER file")
+	cmd.Flags().BoolVar(&requested, "requested", false,
+		"Mark the package as having been installed by direct user request, rather than "+
+			"as a dependency (in .dist-info/REQUESTED)")
+	addCacheDirFlag(cmd, &cacheDir)
+	cmd.Flags().BoolVar(&noCache, "no-cache", false,
+		"Don't use the local cache of compiled .pyc files")
+	cmd.Flags().BoolVar(&skipVerify, "skip-verify", false,
+		"Don't verify the hashes in the wheel's RECORD file; only use this for wheels from a "+
+			"trusted source that have already been verified")
+	cmd.Flags().BoolVar(&permissiveRecord, "permissive-record", false,
+		"Tolerate a wheel with a missing or incomplete RECORD file, logging warnings instead "+
+			"of failing; the hashes that are present are still verified")
+
+	argparserPython.AddCommand(cmd)
+}
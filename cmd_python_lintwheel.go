@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/ghactions"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/sarif"
+)
+
+func init() {
+	var (
+		format         string
+		failOnWarnings bool
+	)
+	cmd := &cobra.Command{
+		Use:   "lint-wheel [flags] IN_WHEELFILE.whl",
+		Short: "Check a wheel file against the wheel specification",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("whl"),
+
+		Long: "Check a Python wheel file for problems: files that don't match RECORD or " +
+			"that are missing from it, compatibility tags in the filename that don't " +
+			"match .dist-info/WHEEL, names and versions that don't agree between the " +
+			"filename, the .dist-info directory, and METADATA, versions that aren't " +
+			"PEP 440 normalized, and files that shouldn't be in a wheel (setup.py, " +
+			"setup.cfg, .egg-info, .pyc)." +
+			"\n\n" +
+			"Each problem found is printed as a line on stdout (or, with --format=json, " +
+			"as an element of a JSON array with the keys \"severity\", \"check\", " +
+			"\"file\", and \"message\"; with --format=github, as GitHub Actions " +
+			"annotations; or with --format=sarif, as a SARIF log for code scanning " +
+			"tools).  The default is --format=github if --output-format=github is " +
+			"given, or else --format=table.  The command fails if any problems with " +
+			"severity \"error\" are found, or with --fail-on-warnings if any problems at " +
+			"all are found.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			if outputFormat == "github" && !flags.Flags().Changed("format") {
+				format = "github"
+			}
+			switch format {
+			case "table", "json", "github", "sarif":
+			default:
+				return fmt.Errorf("invalid --format %q: must be 'table', 'json', 'github', or 'sarif'", format)
+			}
+			findings, err := bdist.Validate(args[0])
+			if err != nil {
+				return err
+			}
+
+			switch format {
+			case "json":
+				if findings == nil {
+					findings = []bdist.Finding{}
+				}
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetEscapeHTML(false)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(findings); err != nil {
+					return err
+				}
+			case "github":
+				for _, finding := range findings {
+					props := ghactions.Properties{"file": args[0], "title": finding.Check}
+					msg := finding.Message
+					if finding.File != "" {
+						msg = finding.File + ": " + msg
+					}
+					line := ghactions.Warning(props, msg)
+					if finding.Severity == bdist.SeverityError {
+						line = ghactions.Error(props, msg)
+					}
+					if _, err := fmt.Println(line); err != nil {
+						return err
+					}
+				}
+			case "sarif":
+				log := sarif.NewLog("ocibuild", "https://github.com/datawire/ocibuild")
+				for _, finding := range findings {
+					level := sarif.LevelWarning
+					if finding.Severity == bdist.SeverityError {
+						level = sarif.LevelError
+					}
+					msg := finding.Message
+					if finding.File != "" {
+						msg = finding.File + ": " + msg
+					}
+					log.AddResult(finding.Check, level, msg, filepath.ToSlash(args[0]))
+				}
+				if err := log.Write(os.Stdout); err != nil {
+					return err
+				}
+			default:
+				for _, finding := range findings {
+					if _, err := fmt.Printf("%s: %s\n", args[0], finding); err != nil {
+						return err
+					}
+				}
+			}
+
+			var errCount int
+			for _, finding := range findings {
+				if failOnWarnings || finding.Severity == bdist.SeverityError {
+					errCount++
+				}
+			}
+			if errCount > 0 {
+				return fmt.Errorf("%s: %d problem(s) found", args[0], errCount)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "table",
+		"Output `FORMAT`; one of 'table', 'json', 'github', or 'sarif'")
+	if err := cmd.RegisterFlagCompletionFunc("format", completeWords("table", "json", "github", "sarif")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().BoolVar(&failOnWarnings, "fail-on-warnings", false,
+		"Fail if there are any warnings, not just if there are errors")
+
+	argparserPython.AddCommand(cmd)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func init() {
+	var format string
+	cmd := &cobra.Command{
+		Use:   "list [flags] {IN_IMAGEFILE|IN_LAYERFILE|IN_DIRNAME}",
+		Short: "List the Python distributions installed in an image, layer, or directory",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Print the name, version, and installer of each Python distribution that " +
+			"has a .dist-info directory in the given Docker image file, layer file, or " +
+			"directory.  For an image, the layers are squashed together first, so " +
+			"distributions removed by a later layer are not listed." +
+			"\n\n" +
+			"With --format=json, the output is a JSON array of objects with the keys " +
+			"\"name\", \"version\", \"installer\", \"requested\", and \"distInfoDir\".",
+
+		RunE: func(_ *cobra.Command, args []string) error {
+			if format != "table" && format != "json" {
+				return fmt.Errorf("invalid --format %q: must be 'table' or 'json'", format)
+			}
+			fsys, err := openFS(args[0])
+			if err != nil {
+				return err
+			}
+			dists, err := pep376.ListInstalled(fsys)
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				bs, err := json.MarshalIndent(dists, "", "  ")
+				if err != nil {
+					return err
+				}
+				_, err = os.Stdout.Write(append(bs, '\n'))
+				return err
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tVERSION\tINSTALLER")
+			for _, dist := range dists {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", dist.Name, dist.Version, dist.Installer)
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "table",
+		"Output `FORMAT`; either 'table' or 'json'")
+	if err := cmd.RegisterFlagCompletionFunc("format", completeWords("table", "json")); err != nil {
+		panic(err)
+	}
+
+	argparserPython.AddCommand(cmd)
+}
+
+// openFS returns a filesystem for a directory, a Docker image file, or a layer file.
+func openFS(filename string) (fs.FS, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(filename), nil
+	}
+	var layers []ociv1.Layer
+	if image, err := fsutil.OpenImage(filename); err == nil {
+		layers, err = image.Layers()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		layer, err := fsutil.OpenLayer(filename)
+		if err != nil {
+			return nil, err
+		}
+		layers = []ociv1.Layer{layer}
+	}
+	return squash.Load(layers, false)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "presets [flags]",
+		Short: "List the built-in platform presets",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+
+		Long: "List the built-in presets that may be used instead of a platform file, by " +
+			"passing '--platform-file=preset:NAME' (or '--target=OS/ARCH=preset:NAME') to " +
+			"`ocibuild layer wheel` or the other commands that take a platform file." +
+			"\n\n" +
+			"Files are installed owned by root, and .pyc files are compiled with the host's " +
+			"'pythonX.Y' of the same minor version as the preset.  To see everything about a " +
+			"preset, run `ocibuild python platform validate --print preset:NAME`; if a preset " +
+			"is close to but not quite what you need, that output is a good starting point for " +
+			"a platform file of your own.",
+
+		RunE: func(_ *cobra.Command, _ []string) error {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tPYTHON\tLAYOUT\tEXTERNALLY MANAGED\tDESCRIPTION")
+			for _, preset := range python.Presets {
+				fmt.Fprintf(tw, "%s\t%d.%d\t%s\t%t\t%s\n",
+					preset.Name,
+					preset.Version.Major, preset.Version.Minor,
+					preset.Layout,
+					preset.ExternallyManaged != "",
+					preset.Description)
+			}
+			return tw.Flush()
+		},
+	}
+
+	argparserPythonPlatform.AddCommand(cmd)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+func init() {
+	var print bool
+	cmd := &cobra.Command{
+		Use:   "validate [flags] IN_YAML_FILE...",
+		Short: "Check platform files for problems",
+		Args:  cliutil.WrapPositionalArgs(cobra.MinimumNArgs(1)),
+
+		ValidArgsFunction: completeFileExt("yml", "yaml", "json"),
+
+		Long: "Check that each of the given platform files (as used by `ocibuild layer " +
+			"wheel --platform-file`; see `ocibuild layer wheel --help`) is valid, reporting " +
+			"every problem found in each file rather than just the first." +
+			"\n\n" +
+			"A platform file is invalid if it has fields that ocibuild doesn't know about " +
+			"(such as a misspelled field name), if it is for a newer SchemaVersion than this " +
+			"version of ocibuild supports (currently " +
+			fmt.Sprint(python.PlatformSchemaVersion) + "), or if it is missing required " +
+			"fields (such as any of the Scheme paths) that its Layout doesn't fill in." +
+			"\n\n" +
+			"With --print, each valid platform file is written to stdout as YAML with its " +
+			"Layout applied, which shows exactly which paths will be used.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			invalid := 0
+			for _, platFile := range args {
+				plat, err := loadPlatformFile(platFile, nil)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					invalid++
+					continue
+				}
+				if !print {
+					fmt.Printf("%s: valid\n", platFile)
+					continue
+				}
+				bs, err := yaml.Marshal(plat)
+				if err != nil {
+					return err
+				}
+				if len(args) > 1 {
+					fmt.Printf("# %s\n", platFile)
+				}
+				if _, err := os.Stdout.Write(bs); err != nil {
+					return err
+				}
+			}
+			if invalid > 0 {
+				return fmt.Errorf("%d of %d platform file(s) are invalid", invalid, len(args))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&print, "print", false,
+		"Write each valid platform file to stdout, with its Layout applied")
+
+	argparserPythonPlatform.AddCommand(cmd)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/pypa/pipcompat"
+)
+
+func init() {
+	var flags struct {
+		Pythons []string
+		Pips    []string
+		WorkDir string
+		Quiet   bool
+	}
+	cmd := &cobra.Command{
+		Use:   "self-test [flags] IN_WHEELFILE.whl...",
+		Short: "Compare ocibuild's installation of wheels against pip's",
+		Args:  cliutil.WrapPositionalArgs(cobra.MinimumNArgs(1)),
+
+		ValidArgsFunction: completeFileExt("whl"),
+
+		Long: "Install each of the given wheel files both with `pip install --no-deps " +
+			"--ignore-installed --prefix=DIR` and with ocibuild (mimicking that pip), and " +
+			"report whether the results differ.  This is the same comparison that " +
+			"ocibuild's own test suite does, so that it can be run against the wheels and " +
+			"the Python and pip versions that you care about." +
+			"\n\n" +
+			"The comparison is run for every combination of a --python and a --pip.  " +
+			"Each --python is either 'host' (run the host's 'python3'), 'host:PYTHON' (run " +
+			"the host's PYTHON), or the name of a Docker image such as 'python:3.12-slim' " +
+			"(run 'python3' in a container of that image), optionally followed by " +
+			"'=PYTHON' to run an interpreter other than 'python3' in the container.  Each " +
+			"--pip is a pip version to install (to a scratch directory, using the " +
+			"environment's existing pip) and compare against; if no --pip is given, then " +
+			"whichever pip the environment already has is used." +
+			"\n\n" +
+			"A line is printed for each comparison saying whether it is 'ok', 'diverged', " +
+			"or failed with an error; each divergence is followed by a diff of the " +
+			"installed files, with pip's install as the \"Expected\" side and ocibuild's " +
+			"as the \"Actual\" side.  The command fails if any comparison did not pass." +
+			"\n\n" +
+			"LIMITATION: Container environments require interacting with a running " +
+			"Docker, and network access from inside of the container if --pip is given.",
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			if len(flags.Pythons) == 0 {
+				return cliutil.FlagErrorFunc(cmd, fmt.Errorf("at least one --python is required"))
+			}
+			pips := flags.Pips
+			if len(pips) == 0 {
+				pips = []string{""}
+			}
+			var envs []pipcompat.Env
+			for _, pyStr := range flags.Pythons {
+				for _, pip := range pips {
+					env, err := pipcompat.ParseEnv(pyStr, pip)
+					if err != nil {
+						return cliutil.FlagErrorFunc(cmd, fmt.Errorf("invalid --python: %w", err))
+					}
+					envs = append(envs, env)
+				}
+			}
+
+			var total, failed int
+			err := pipcompat.RunMatrix(ctx, envs, flags.WorkDir, args, func(result pipcompat.Result) {
+				total++
+				switch {
+				case result.Err != nil:
+					failed++
+					fmt.Printf("%s: %s: error: %v\n", result.Env, result.Wheel, result.Err)
+				case result.Diff != "":
+					failed++
+					fmt.Printf("%s: %s: diverged\n", result.Env, result.Wheel)
+					if !flags.Quiet {
+						fmt.Print(result.Diff)
+					}
+				default:
+					fmt.Printf("%s: %s: ok\n", result.Env, result.Wheel)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d comparison(s) did not pass", failed, total)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&flags.Pythons, "python", []string{"host"},
+		"Compare against the pip of `ENVIRONMENT` ('host', 'host:PYTHON', or 'IMAGE[=PYTHON]'); "+
+			"may be given multiple times")
+	cmd.Flags().StringArrayVar(&flags.Pips, "pip", nil,
+		"Compare against pip `VERSION`; may be given multiple times")
+	cmd.Flags().StringVar(&flags.WorkDir, "work-dir", "",
+		"Write scratch files to subdirectories of `DIR` (default: the system's temporary "+
+			"directory); for container environments, Docker must be able to mount it")
+	if err := cmd.MarkFlagDirname("work-dir"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().BoolVarP(&flags.Quiet, "quiet", "q", false,
+		"Don't print a diff for each divergence; just say that it diverged")
+
+	argparserPython.AddCommand(cmd)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/pep425"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func init() {
+	var (
+		pythonVersion string
+		platforms     []string
+		abis          []string
+		format        string
+	)
+	cmd := &cobra.Command{
+		Use:   "tags [flags] --python-version=X.Y --platform=PLATFORM",
+		Short: "Print the wheel tags that an installer for a Python version and platform supports",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+
+		Long: "Print the PEP 425 tags supported by CPython X.Y on the given platforms, one " +
+			"per line, from most-preferred to least-preferred; the same list that " +
+			"`packaging.tags.sys_tags()` would give on that system, and that 'ocibuild " +
+			"python getwheel' and 'ocibuild layer wheel' use to pick between wheels.  This is " +
+			"useful for figuring out why a wheel wasn't selected." +
+			"\n\n" +
+			"PEP 600 \"manylinux_2_X_ARCH\" and PEP 656 \"musllinux_1_X_ARCH\" platforms " +
+			"(and the legacy \"manylinux2014_ARCH\" aliases) are expanded to include every " +
+			"older manylinux or musllinux platform.  The --platform flag may be given " +
+			"multiple times, for systems that support several platforms." +
+			"\n\n" +
+			"With --format=json, the output is a JSON array of tag strings, suitable for " +
+			"the \"Tags\" field of a platform file.",
+
+		RunE: func(flags *cobra.Command, _ []string) error {
+			if format != "text" && format != "json" {
+				return cliutil.FlagErrorFunc(flags,
+					fmt.Errorf("invalid --format %q: must be 'text' or 'json'", format))
+			}
+			ver, err := pep440.ParseVersion(pythonVersion)
+			if err != nil {
+				return cliutil.FlagErrorFunc(flags, fmt.Errorf("invalid --python-version: %w", err))
+			}
+			if len(ver.Release) != 2 || ver.Epoch != 0 || !ver.IsFinal() {
+				return cliutil.FlagErrorFunc(flags,
+					fmt.Errorf("invalid --python-version %q: must be of the form MAJOR.MINOR", pythonVersion))
+			}
+
+			tags := pep425.CPythonInstaller(ver.Release[0], ver.Release[1], abis, platforms)
+
+			if format == "json" {
+				bs, err := json.MarshalIndent(tags, "", "  ")
+				if err != nil {
+					return err
+				}
+				_, err = flags.OutOrStdout().Write(append(bs, '\n'))
+				return err
+			}
+			out := bufio.NewWriter(flags.OutOrStdout())
+			for _, tag := range tags {
+				if _, err := fmt.Fprintln(out, tag); err != nil {
+					return err
+				}
+			}
+			return out.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&pythonVersion, "python-version", "",
+		"The `MAJOR.MINOR` version of CPython to list tags for, such as '3.11'")
+	cmd.Flags().StringArrayVar(&platforms, "platform", nil,
+		"A `PLATFORM` tag supported by the system, such as 'manylinux2014_x86_64' or 'win_amd64'")
+	cmd.Flags().StringArrayVar(&abis, "abi", nil,
+		"An `ABI` tag supported by the interpreter, such as 'cp311d'; if not given, the "+
+			"default ABI for the --python-version is used")
+	cmd.Flags().StringVar(&format, "format", "text",
+		"Output `FORMAT`; either 'text' or 'json'")
+	if err := cmd.RegisterFlagCompletionFunc("format", completeWords("text", "json")); err != nil {
+		panic(err)
+	}
+	if err := cmd.MarkFlagRequired("python-version"); err != nil {
+		panic(err)
+	}
+	if err := cmd.MarkFlagRequired("platform"); err != nil {
+		panic(err)
+	}
+
+	argparserPython.AddCommand(cmd)
+}
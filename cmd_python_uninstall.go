@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/reproducible"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "uninstall [flags] IN_IMAGEFILE DISTNAME >OUT_LAYERFILE",
+		Short: "Create a layer that removes a Python package from an image",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(2)),
+
+		ValidArgsFunction: completeNthArg(completeFileExt("tar"), nil),
+
+		Long: "Given a Docker image file and the name of a Python distribution " +
+			"installed in it, create a layer of whiteout entries that removes that " +
+			"distribution when stacked on top of the image.  This is useful for " +
+			"slimming a base image (for example, removing pip and setuptools) " +
+			"without rebuilding it." +
+			"\n\n" +
+			"The files to remove are determined from the distribution's " +
+			".dist-info/RECORD file; in addition to the files listed there, any " +
+			"compiled bytecode in __pycache__ directories is removed, as are any " +
+			"directories inside of site-packages that would be left empty." +
+			"\n\n" +
+			"LIMITATION: Files that the package created at runtime, and that are " +
+			"not listed in RECORD, are not removed.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			ctx := flags.Context()
+			image, err := fsutil.OpenImage(args[0])
+			if err != nil {
+				return err
+			}
+			layers, err := image.Layers()
+			if err != nil {
+				return err
+			}
+			fsys, err := squash.Load(layers, false)
+			if err != nil {
+				return err
+			}
+
+			layer, _, err := pep376.UninstallContext(ctx, fsys, args[1], reproducible.Now())
+			if err != nil {
+				return err
+			}
+
+			if err := writeLayer(ctx, layer, os.Stdout); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+
+	argparserPython.AddCommand(cmd)
+}
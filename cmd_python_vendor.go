@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/simple_repo_api"
+	"github.com/datawire/ocibuild/pkg/python/requirements"
+	"github.com/datawire/ocibuild/pkg/python/wheelhouse"
+	"github.com/datawire/ocibuild/pkg/warnings"
+)
+
+func init() {
+	var (
+		reqFile     string
+		destDir     string
+		indexServer string
+		auth        indexAuth
+		platFile    string
+		cacheDir    string
+		noCache     bool
+		sumDB       checksumDB
+		preRelease  string
+		prePackages []string
+		constraints []string
+	)
+	cmd := &cobra.Command{
+		Use:   "vendor [flags] --requirements=IN_TXT_FILE --dest=OUT_DIR",
+		Short: "Download the wheels pinned by a requirements file in to a local wheelhouse",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+
+		Long: "Given a requirements file in which every requirement is pinned to an exact " +
+			"version with '==' (such as the output of `pip freeze` or " +
+			"`pip-compile --generate-hashes`), or is pinned by a constraints file, download the wheels for those versions " +
+			"from the index server in to a local directory (a \"wheelhouse\"), and " +
+			"write a manifest (" + wheelhouse.ManifestFilename + ") recording each " +
+			"wheel's name, version, hashes, and origin.  Later builds can then read the " +
+			"wheels from the directory without network access, using the --find-links " +
+			"flag of `ocibuild layer wheel --download` or `ocibuild python getwheel`." +
+			"\n\n" +
+			"If a requirement has --hash options, then only wheels matching one of those " +
+			"hashes are downloaded, and downloaded files are checked against them.  If " +
+			"--platform-file is given, then only wheels compatible with that platform's " +
+			"Tags and VersionInfo are downloaded; otherwise every wheel for the pinned " +
+			"version is downloaded." +
+			"\n\n" +
+			"If the requirements file sets --index-url, then that is used unless " +
+			"--index-server is given explicitly.  Wheels already in the wheelhouse are " +
+			"kept, and new ones are added to its manifest." +
+			"\n\n" +
+			"Constraints files (given with --constraint, or with '-c' lines in the " +
+			"requirements file) have the same format as requirements files, and work like " +
+			"pip's: a constraint doesn't add a project, but each requirement is narrowed " +
+			"to the versions (and hashes) that its constraints allow, and it is an error if " +
+			"nothing is left.  This allows a single constraints file to centrally pin the " +
+			"versions of projects that many requirements files use." +
+			"\n\n" +
+			"The --pre flag says whether pre-release versions (such as release " +
+			"candidates) may be vendored: 'if-necessary' (the default, like pip without " +
+			"--pre) allows them only if a requirement pins one explicitly, 'allow' (like " +
+			"pip --pre) always allows them, and 'forbid' never does.  Projects listed with " +
+			"--pre-package are always allowed pre-releases, so that CI can opt specific " +
+			"projects in to release candidates with --pre=forbid." +
+			"\n\n" +
+			"LIMITATION: Environment markers are not evaluated; a requirement with a " +
+			"marker for which there are no suitable wheels is skipped with a warning, " +
+			"rather than being an error.  Source distributions are never downloaded.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			ctx := flags.Context()
+			if err := checkHermetic("vendoring wheels from the index server"); err != nil {
+				return err
+			}
+
+			preReleases, err := pep440.ParsePreReleasePolicy(preRelease)
+			if err != nil {
+				return cliutil.FlagErrorFunc(flags, fmt.Errorf("invalid --pre %q", preRelease))
+			}
+
+			reqs, err := readRequirementsFile(reqFile)
+			if err != nil {
+				return err
+			}
+			if err := applyConstraints(reqFile, reqs, constraints); err != nil {
+				return err
+			}
+			if reqs.IndexURL != "" && !flags.Flags().Changed("index-server") {
+				indexServer = reqs.IndexURL
+			}
+			if len(reqs.ExtraIndexURLs) > 0 {
+				dlog.Warnf(ctx, "%s: ignoring --extra-index-url: only a single index server is supported",
+					reqFile)
+			}
+
+			client := simple_repo_api.NewClient(nil, nil)
+			client.BaseURL = indexServer
+			client.Credentials = auth.providers(indexServer)
+			client.PreReleases = preReleases
+			client.PreReleasePackages = prePackages
+			setupDownloads(&client.Client, cacheDir, noCache)
+			filterTags := false
+			if platFile != "" {
+				plat, err := loadPlatformFile(platFile, nil)
+				if err != nil {
+					return err
+				}
+				if plat.VersionInfo != nil {
+					if client.Python, err = plat.VersionInfo.PEP440(); err != nil {
+						return fmt.Errorf("%s: %w", platFile, err)
+					}
+				}
+				client.SupportedTags = plat.Tags
+				filterTags = len(plat.Tags) > 0
+			}
+
+			if err := os.MkdirAll(destDir, 0o777); err != nil {
+				return err
+			}
+			manifest, err := wheelhouse.ReadManifest(destDir)
+			if err != nil {
+				if !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+				manifest = &wheelhouse.Manifest{Wheels: nil}
+			}
+
+			for _, req := range reqs.Requirements {
+				wheels, err := vendorRequirement(ctx, client, filterTags, destDir, cacheDir, noCache, sumDB, req)
+				if err != nil {
+					return fmt.Errorf("%s:%d: %s: %w", reqFile, req.Line, req.Name, err)
+				}
+				for _, whl := range wheels {
+					manifest.Add(whl)
+				}
+			}
+			return wheelhouse.WriteManifest(destDir, *manifest)
+		},
+	}
+	cmd.Flags().StringVar(&reqFile, "requirements", "",
+		"Read the pinned requirements from `IN_TXT_FILE` (required)")
+	if err := cmd.MarkFlagRequired("requirements"); err != nil {
+		panic(err)
+	}
+	if err := cmd.RegisterFlagCompletionFunc("requirements", completeFileExt("txt", "in")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringArrayVar(&constraints, "constraint", nil,
+		"Constrain the requirements by the constraints file `IN_TXT_FILE`; may be given multiple times")
+	if err := cmd.RegisterFlagCompletionFunc("constraint", completeFileExt("txt", "in")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&destDir, "dest", "",
+		"Write the wheels and manifest to `OUT_DIR` (required)")
+	if err := cmd.MarkFlagRequired("dest"); err != nil {
+		panic(err)
+	}
+	if err := cmd.RegisterFlagCompletionFunc("dest", completeDirs); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&indexServer, "index-server", pep503.PyPIBaseURL,
+		"Index server to download the wheels from")
+	addIndexAuthFlags(cmd, &auth)
+	cmd.Flags().StringVar(&platFile, "platform-file", "",
+		"Only download wheels compatible with the platform described by `IN_YAML_FILE` "+
+			"(see `ocibuild layer wheel --help`)")
+	if err := cmd.RegisterFlagCompletionFunc("platform-file", completeFileExt("yml", "yaml", "json")); err != nil {
+		panic(err)
+	}
+	addCacheDirFlag(cmd, &cacheDir)
+	cmd.Flags().BoolVar(&noCache, "no-cache", false,
+		"Don't use the local download cache")
+	addChecksumDBFlags(cmd, &sumDB)
+	cmd.Flags().StringVar(&preRelease, "pre", pep440.PreReleasesIfNecessary.String(),
+		"Whether to allow pre-release versions: `POLICY` is 'if-necessary', 'allow', or 'forbid'")
+	if err := cmd.RegisterFlagCompletionFunc("pre", completeWords("if-necessary", "allow", "forbid")); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringArrayVar(&prePackages, "pre-package", nil,
+		"Always allow pre-release versions of the project `NAME`, regardless of --pre; may be "+
+			"given multiple times")
+
+	argparserPython.AddCommand(cmd)
+}
+
+func readRequirementsFile(filename string) (*requirements.File, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reqs, err := requirements.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return reqs, nil
+}
+
+// applyConstraints applies the constraints files named by the requirements file and by the
+// --constraint flags to reqs.Requirements.
+func applyConstraints(reqFile string, reqs *requirements.File, flagFiles []string) error {
+	filenames := make([]string, 0, len(reqs.Constraints)+len(flagFiles))
+	for _, filename := range reqs.Constraints {
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(filepath.Dir(reqFile), filename)
+		}
+		filenames = append(filenames, filename)
+	}
+	filenames = append(filenames, flagFiles...)
+	for _, filename := range filenames {
+		constraints, err := readRequirementsFile(filename)
+		if err != nil {
+			return err
+		}
+		reqs.Requirements, err = requirements.Constrain(reqs.Requirements, constraints.Requirements)
+		if err != nil {
+			return fmt.Errorf("%s: constraints from %s: %w", reqFile, filename, err)
+		}
+	}
+	return nil
+}
+
+// vendorRequirement downloads the wheels for a single pinned requirement in to destDir, returning
+// the manifest entries for them.
+func vendorRequirement(
+	ctx context.Context,
+	client simple_repo_api.Client,
+	filterTags bool,
+	destDir, cacheDir string,
+	noCache bool,
+	sumDB checksumDB,
+	req requirements.Requirement,
+) ([]wheelhouse.Wheel, error) {
+	version, ok := req.Pinned()
+	if !ok {
+		return nil, fmt.Errorf("requirement is not pinned to an exact version with '==' "+
+			"(by itself, or by a constraint): %q", req.Requirement.String())
+	}
+	if version.IsPreRelease() && client.PreReleasePolicy(req.Name) == pep440.PreReleasesForbid {
+		return nil, fmt.Errorf("requirement is pinned to a pre-release, which --pre=%s forbids "+
+			"(use --pre-package=%s to allow it): %q", pep440.PreReleasesForbid, req.Name, req.Requirement.String())
+	}
+	candidates, err := client.ListCandidates(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	var ret []wheelhouse.Wheel //nolint:prealloc // 'continue' is quite likely
+	for _, candidate := range candidates {
+		if !req.Specifier.Match(candidate.Version) {
+			continue
+		}
+		if (filterTags && !candidate.Supported) || !candidate.PythonCompatible {
+			continue
+		}
+		if !hashesMayMatch(req.Hashes, candidate.Hashes) {
+			continue
+		}
+		if filepath.Base(candidate.Link.Text) != candidate.Link.Text {
+			return nil, fmt.Errorf("index server gave invalid filename: %q", candidate.Link.Text)
+		}
+		if candidate.Yanked {
+			if err := warnings.Warnf(ctx, warnings.Yanked,
+				"%s has been yanked: %s", candidate.Link.Text, candidate.YankedReason); err != nil {
+				return nil, err
+			}
+		}
+
+		var content []byte
+		if noCache {
+			content, err = candidate.Link.Get(ctx)
+		} else {
+			content, err = getWheelCached(ctx, cacheDir, candidate.Link)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRequirementHashes(req.Hashes, content); err != nil {
+			return nil, fmt.Errorf("%s: %w", candidate.Link.Text, err)
+		}
+		if err := sumDB.verify(ctx, candidate.Link.Text, content); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(destDir, candidate.Link.Text), content, 0o644); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		ret = append(ret, wheelhouse.Wheel{
+			Name:     pep503.NormalizeName(candidate.Distribution),
+			Version:  candidate.Version.String(),
+			Filename: candidate.Link.Text,
+			Hashes:   map[string]string{"sha256": hex.EncodeToString(sum[:])},
+			URL:      candidate.URL,
+		})
+		dlog.Infof(ctx, "vendored %s", candidate.Link.Text)
+	}
+	if len(ret) == 0 {
+		if req.Marker != nil {
+			dlog.Warnf(ctx, "skipping %q: no suitable wheels", req.Requirement.String())
+			return nil, nil
+		}
+		if _, sdist, err := client.SelectWheelOrSdist(ctx, req.Name, req.Specifier); err == nil && sdist != nil {
+			return nil, fmt.Errorf("%w for version %s; only the sdist %s is available, and ocibuild "+
+				"can't build sdists: build a wheel from it (such as with 'pip wheel'), and publish "+
+				"that to the index server", simple_repo_api.ErrNoMatch, version, sdist.Text)
+		}
+		return nil, fmt.Errorf("%w for version %s", simple_repo_api.ErrNoMatch, version)
+	}
+	return ret, nil
+}
+
+// hashesMayMatch returns whether a file that the index server says has the hashes 'have' might
+// match one of the hashes that a requirement wants; that is, whether it's worth downloading.
+func hashesMayMatch(want map[string][]string, have map[string]string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for alg, digest := range have {
+		wantDigests, ok := want[alg]
+		if !ok {
+			continue
+		}
+		for _, wantDigest := range wantDigests {
+			if digest == wantDigest {
+				return true
+			}
+		}
+		return false
+	}
+	// The index server didn't tell us any hashes that we can compare; we'll have to download it
+	// to find out.
+	return true
+}
+
+// checkRequirementHashes returns an error if a requirement has hashes, and content doesn't match
+// any of them.
+func checkRequirementHashes(want map[string][]string, content []byte) error {
+	if len(want) == 0 {
+		return nil
+	}
+	for alg, wantDigests := range want {
+		newHasher := python.HashlibAlgorithmsGuaranteed[alg]
+		if newHasher == nil {
+			continue
+		}
+		hasher := newHasher()
+		_, _ = hasher.Write(content)
+		digest := hex.EncodeToString(hasher.Sum(nil))
+		for _, wantDigest := range wantDigests {
+			if digest == wantDigest {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: does not match any of the requirement's hashes", python.ErrHashMismatch)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "verify-installed [flags] {IN_IMAGEFILE|IN_LAYERFILE|IN_DIRNAME} [DISTNAME...]",
+		Short: "Check installed Python distributions against their RECORD files",
+		Args:  cliutil.WrapPositionalArgs(cobra.MinimumNArgs(1)),
+
+		ValidArgsFunction: completeFileExt("tar"),
+
+		Long: "Check that the files of each Python distribution installed in the given " +
+			"Docker image file, layer file, or directory match the hashes and sizes " +
+			"listed in the distribution's .dist-info/RECORD file, and that none of them " +
+			"are missing.  If DISTNAMEs are given, only those distributions are checked." +
+			"\n\n" +
+			"Each problem found is printed as a line on stdout, and the command fails if " +
+			"any problems are found." +
+			"\n\n" +
+			"LIMITATION: Files that were added to a distribution's directories but that " +
+			"aren't listed in RECORD are not reported.",
+
+		RunE: func(_ *cobra.Command, args []string) error {
+			fsys, err := openFS(args[0])
+			if err != nil {
+				return err
+			}
+			dists, err := pep376.ListInstalled(fsys)
+			if err != nil {
+				return err
+			}
+			if len(args) > 1 {
+				want := make(map[string]struct{}, len(args)-1)
+				for _, name := range args[1:] {
+					want[pep503.NormalizeName(name)] = struct{}{}
+				}
+				filtered := dists[:0]
+				for _, dist := range dists {
+					if _, ok := want[pep503.NormalizeName(dist.Name)]; ok {
+						filtered = append(filtered, dist)
+						delete(want, pep503.NormalizeName(dist.Name))
+					}
+				}
+				if len(want) > 0 {
+					return fmt.Errorf("distribution(s) not installed: %q", sortedStrings(want))
+				}
+				dists = filtered
+			}
+
+			problems := 0
+			for _, dist := range dists {
+				recordFile, err := fsys.Open(path.Join(dist.DistInfoDir, "RECORD"))
+				if err != nil {
+					return err
+				}
+				entries, err := pep376.ParseRecord(recordFile)
+				_ = recordFile.Close()
+				if err != nil {
+					return fmt.Errorf("%s: %w", dist.DistInfoDir, err)
+				}
+				diffs, err := pep376.DiffRecord(fsys, dist.DistInfoDir, entries)
+				if err != nil {
+					return fmt.Errorf("%s: %w", dist.DistInfoDir, err)
+				}
+				for _, diff := range diffs {
+					if _, err := fmt.Printf("%s %s: %s\n", dist.Name, dist.Version, diff); err != nil {
+						return err
+					}
+				}
+				problems += len(diffs)
+			}
+			if problems > 0 {
+				return fmt.Errorf("%s: %d problem(s) found", args[0], problems)
+			}
+			return nil
+		},
+	}
+
+	argparserPython.AddCommand(cmd)
+}
+
+func sortedStrings(set map[string]struct{}) []string {
+	ret := make([]string, 0, len(set))
+	for str := range set {
+		ret = append(ret, str)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "compare [flags] VERSION_A VERSION_B",
+		Short: "Compare two Python versions",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(2)),
+
+		ValidArgsFunction: cobra.NoFileCompletions,
+
+		Long: "Compare two Python versions according to PEP 440, and print \"-1\" if VERSION_A " +
+			"is older than VERSION_B, \"0\" if they are equivalent (such as \"1.0\" and " +
+			"\"1.0.0\"), or \"1\" if VERSION_A is newer than VERSION_B.  For example:" +
+			"\n\n" +
+			"    if [ \"$(ocibuild python version compare \"$have\" 3.10)\" -lt 0 ]; then ...",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			a := versionArg(flags, args[0])
+			b := versionArg(flags, args[1])
+			_, err := fmt.Fprintln(flags.OutOrStdout(), a.Cmp(b))
+			return err
+		},
+	}
+
+	argparserPythonVersion.AddCommand(cmd)
+}
+
+// versionArg parses a version from the command line; if it is invalid, that is a usage error.
+func versionArg(flags *cobra.Command, str string) pep440.Version {
+	ver, err := pep440.ParseVersion(str)
+	if err != nil {
+		_ = cliutil.FlagErrorFunc(flags, err)
+	}
+	return *ver
+}
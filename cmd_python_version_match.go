@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func init() {
+	var quiet bool
+	cmd := &cobra.Command{
+		Use:   "match [flags] SPECIFIER VERSION...",
+		Short: "Check whether Python versions match a version specifier",
+		Args:  cliutil.WrapPositionalArgs(cobra.MinimumNArgs(2)),
+
+		ValidArgsFunction: cobra.NoFileCompletions,
+
+		Long: "Check each VERSION against a PEP 440 version SPECIFIER (such as " +
+			"\">=3.8,!=3.9.*\"), and print the ones that match it.  Like grep(1), the " +
+			"command exits with status 0 if any VERSION matches, or 1 if none do.  For " +
+			"example:" +
+			"\n\n" +
+			"    if ocibuild python version match -q '>=3.8' \"$have\"; then ...",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			spec, err := pep440.ParseSpecifier(args[0])
+			if err != nil {
+				return cliutil.FlagErrorFunc(flags, err)
+			}
+			matched := false
+			for _, arg := range args[1:] {
+				ver := versionArg(flags, arg)
+				if !spec.Match(ver) {
+					continue
+				}
+				matched = true
+				if !quiet {
+					if _, err := fmt.Fprintln(flags.OutOrStdout(), arg); err != nil {
+						return err
+					}
+				}
+			}
+			if !matched {
+				return exitStatus(1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Don't print anything; only set the exit status")
+
+	argparserPythonVersion.AddCommand(cmd)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+)
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "normalize [flags] VERSION...",
+		Short: "Print the normal form of Python versions",
+		Args:  cliutil.WrapPositionalArgs(cobra.MinimumNArgs(1)),
+
+		ValidArgsFunction: cobra.NoFileCompletions,
+
+		Long: "Print the PEP 440 normal form of each VERSION, one per line; for example, " +
+			"\"v1.0-Alpha_2\" is normalized to \"1.0a2\".",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			for _, arg := range args {
+				ver := versionArg(flags, arg)
+				if _, err := fmt.Fprintln(flags.OutOrStdout(), ver.String()); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	argparserPythonVersion.AddCommand(cmd)
+}
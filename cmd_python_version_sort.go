@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func init() {
+	var reverse bool
+	cmd := &cobra.Command{
+		Use:   "sort [flags] <IN_FILE >OUT_FILE",
+		Short: "Sort a list of Python versions",
+		Args:  cliutil.WrapPositionalArgs(cobra.NoArgs),
+
+		Long: "Read Python versions from stdin, one per line, and write them to stdout sorted " +
+			"from oldest to newest according to PEP 440.  Blank lines are ignored, and versions " +
+			"are written as they were given rather than being normalized; equivalent versions " +
+			"(such as \"1.0\" and \"1.0.0\") are kept in the order that they were read.",
+
+		RunE: func(flags *cobra.Command, _ []string) error {
+			type line struct {
+				str string
+				ver pep440.Version
+			}
+			var lines []line
+			scanner := bufio.NewScanner(flags.InOrStdin())
+			for lineno := 1; scanner.Scan(); lineno++ {
+				str := strings.TrimSpace(scanner.Text())
+				if str == "" {
+					continue
+				}
+				ver, err := pep440.ParseVersion(str)
+				if err != nil {
+					return fmt.Errorf("stdin:%d: %w", lineno, err)
+				}
+				lines = append(lines, line{str: str, ver: *ver})
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			sort.SliceStable(lines, func(i, j int) bool {
+				if reverse {
+					return lines[i].ver.Cmp(lines[j].ver) > 0
+				}
+				return lines[i].ver.Cmp(lines[j].ver) < 0
+			})
+			out := bufio.NewWriter(flags.OutOrStdout())
+			for _, line := range lines {
+				if _, err := fmt.Fprintln(out, line.str); err != nil {
+					return err
+				}
+			}
+			return out.Flush()
+		},
+	}
+	cmd.Flags().BoolVarP(&reverse, "reverse", "r", false, "Sort from newest to oldest")
+
+	argparserPythonVersion.AddCommand(cmd)
+}
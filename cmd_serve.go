@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/python/simpleindex"
+)
+
+func init() {
+	var listen string
+	cmd := &cobra.Command{
+		Use:   "serve [flags] WHEELHOUSE_DIR",
+		Short: "Serve a directory of wheels as a simple package index",
+		Args:  cliutil.WrapPositionalArgs(cobra.ExactArgs(1)),
+
+		ValidArgsFunction: completeDirs,
+
+		Long: "Serve the wheel files in WHEELHOUSE_DIR as a PEP 503 \"simple\" package index, " +
+			"so that pip (with `--index-url http://ADDRESS/simple/`) and ocibuild (with " +
+			"`--index-server`) can resolve and download from it; for example to test " +
+			"dependency resolution locally, or to build without access to the real index " +
+			"server." +
+			"\n\n" +
+			"Each wheel's core metadata (its .dist-info/METADATA file) is also served on its " +
+			"own, per PEP 658, so that resolvers don't need to download whole wheels to read " +
+			"their dependencies.  Files that aren't wheels are ignored.  The directory is " +
+			"re-read for every request, so wheels may be added or removed while it is running; " +
+			"a wheelhouse.json manifest is not required." +
+			"\n\n" +
+			"It runs until interrupted.",
+
+		RunE: func(flags *cobra.Command, args []string) error {
+			ctx := flags.Context()
+			if info, err := os.Stat(args[0]); err != nil {
+				return err
+			} else if !info.IsDir() {
+				return cliutil.FlagErrorFunc(flags, errors.New("WHEELHOUSE_DIR is not a directory"))
+			}
+			listener, err := net.Listen("tcp", listen)
+			if err != nil {
+				return err
+			}
+			server := &http.Server{ //nolint:exhaustivestruct // only set what we need
+				Handler:           &simpleindex.Server{Dir: args[0]}, //nolint:exhaustivestruct
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				<-ctx.Done()
+				_ = server.Close()
+			}()
+			dlog.Infof(ctx, "serving %s at http://%s/simple/", args[0], listener.Addr())
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", "127.0.0.1:8080",
+		"Listen for connections on `ADDRESS` (HOST:PORT; use port 0 to pick a free port)")
+
+	argparser.AddCommand(cmd)
+}
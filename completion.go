@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/dockerutil"
+)
+
+// completeFileExt returns a cobra completion function that completes filenames with any of the
+// given extensions (without the leading ".").
+func completeFileExt(exts ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return exts, cobra.ShellCompDirectiveFilterFileExt
+	}
+}
+
+// completeNthArg returns a cobra completion function that calls fns[len(args)] for the next
+// positional argument; the last function is used for any arguments after that.
+func completeNthArg(
+	fns ...func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective),
+) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		idx := len(args)
+		if idx >= len(fns) {
+			idx = len(fns) - 1
+		}
+		if fns[idx] == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return fns[idx](cmd, args, toComplete)
+	}
+}
+
+// completeDockerImages completes the names of images in the local Docker daemon.
+func completeDockerImages(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	images, err := dockerutil.ListImages(cmd.Context())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return images, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeWheelFilenames completes wheel filenames that were seen on the --index-server the last
+// time `ocibuild python getwheel` consulted it (see cache.Store.PutIndex).  Until the user has
+// typed a "-" it only completes the distribution names, so as not to flood the terminal with
+// every version of every package.
+func completeWheelFilenames(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	indexServer, _ := cmd.Flags().GetString("index-server")
+	cacheDir, _ := cmd.Flags().GetString("cache-dir")
+	store, err := openCache(cacheDir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	filenames, err := store.ListIndex(indexServer)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	if strings.Contains(toComplete, "-") {
+		return filenames, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, filename := range filenames {
+		name := filename[:strings.Index(filename, "-")+1]
+		if name != "" && (len(names) == 0 || names[len(names)-1] != name) {
+			names = append(names, name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completeDirs completes directory names.
+func completeDirs(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveFilterDirs
+}
+
+// completeWords returns a cobra completion function that completes a fixed list of words.
+func completeWords(words ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return words, cobra.ShellCompDirectiveNoFileComp
+	}
+}
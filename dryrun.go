@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/datawire/ocibuild/pkg/cache"
+	"github.com/datawire/ocibuild/pkg/python/pep345"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/python/wheelhouse"
+)
+
+// addDryRunFlag adds a --dry-run flag; a command with it set should resolve its inputs, and then
+// call writePlan instead of writing its output.
+func addDryRunFlag(cmd *cobra.Command, dryRun *bool) {
+	cmd.Flags().BoolVar(dryRun, "dry-run", false,
+		"Don't write any output or download any wheels; instead resolve the inputs, and write a "+
+			"YAML description of what would be done to stdout")
+}
+
+// A plan is what a command writes to stdout with --dry-run.
+type plan struct {
+	Inputs  []planInput  `json:"inputs"`
+	Outputs []planOutput `json:"outputs"`
+}
+
+// planInput describes an input file.  Size and Digest are omitted if they can't be known without
+// downloading the file.
+type planInput struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Size   int64  `json:"size,omitempty"`
+	Digest string `json:"digest,omitempty"`
+
+	// These are only set for wheels, from the wheel's METADATA.
+	Version        string   `json:"version,omitempty"`
+	RequiresPython string   `json:"requiresPython,omitempty"`
+	RequiresDist   []string `json:"requiresDist,omitempty"`
+	// InstalledSize is the total size of the files in the wheel; see bdist.WheelInfo.
+	InstalledSize int64 `json:"installedSize,omitempty"`
+
+	Notes []string `json:"notes,omitempty"`
+}
+
+// planOutput describes an output that would be written.
+type planOutput struct {
+	Destination string            `json:"destination"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+func writePlan(p plan) error {
+	bs, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(bs)
+	return err
+}
+
+// planLocalFile describes an input file on the local filesystem.
+func planLocalFile(filename string) (planInput, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return planInput{}, err //nolint:exhaustivestruct // zero value
+	}
+	return planInput{ //nolint:exhaustivestruct // wheel fields are set by planLocalWheel
+		Name:   filepath.Base(filename),
+		Source: filename,
+		Size:   int64(len(content)),
+		Digest: cache.Digest(content),
+	}, nil
+}
+
+// planLocalWheel describes a wheel file on the local filesystem.
+func planLocalWheel(filename string) (planInput, error) {
+	input, err := planLocalFile(filename)
+	if err != nil {
+		return input, err
+	}
+	info, err := bdist.InspectWheel(filename)
+	if err != nil {
+		return input, err
+	}
+	if info.Filename != nil {
+		input.Version = info.Filename.Version.String()
+	}
+	input.InstalledSize = info.InstalledSize
+	setPlanMetadata(&input, info.Metadata)
+	input.Notes = append(input.Notes, info.Errors...)
+	input.Notes = append(input.Notes, info.RecordErrors...)
+	return input, nil
+}
+
+// planWheel describes a wheel that `layer wheel` would read: a local file, or with download set
+// a wheel from findLinks or the index server.  Wheels from the index server are not downloaded;
+// their metadata is fetched separately if the index server supports PEP 658, or else read from the
+// wheel with HTTP Range requests if the server supports that.
+func planWheel(
+	ctx context.Context,
+	download bool,
+	indexServer string,
+	auth indexAuth,
+	findLinks, cacheDir string,
+	noCache bool,
+	filename string,
+) (planInput, error) {
+	switch {
+	case !download:
+		return planLocalWheel(filename)
+	case findLinks != "":
+		// Check that it's in the manifest and matches it.
+		if _, err := wheelhouse.Open(findLinks, filename); err != nil {
+			return planInput{}, err //nolint:exhaustivestruct // zero value
+		}
+		return planLocalWheel(filepath.Join(findLinks, filename))
+	}
+
+	link, err := findWheelLink(ctx, indexServer, auth, cacheDir, noCache, filename)
+	if err != nil {
+		return planInput{}, err //nolint:exhaustivestruct // zero value
+	}
+	input := planInput{ //nolint:exhaustivestruct // filled in below
+		Name:   filename,
+		Source: link.HRef,
+	}
+	if u, err := url.Parse(link.HRef); err == nil {
+		if keyvals, err := url.ParseQuery(u.Fragment); err == nil && keyvals.Get("sha256") != "" {
+			input.Digest = "sha256:" + keyvals.Get("sha256")
+		}
+		u.Fragment = ""
+		input.Source = u.String()
+	}
+	if fileInfo, err := bdist.ParseFilename(filename); err == nil {
+		input.Version = fileInfo.Version.String()
+	}
+	metadata, err := link.GetMetadata(ctx)
+	switch {
+	case errors.Is(err, pep503.ErrNoMetadata):
+		planRemoteWheel(ctx, *link, &input)
+	case err != nil:
+		dlog.Warnf(ctx, "%s: metadata: %v", filename, err)
+		input.Notes = append(input.Notes, "could not fetch the wheel's metadata: "+err.Error())
+	default:
+		header, err := pep345.ParseMetadata(bytes.NewReader(metadata))
+		if err != nil {
+			input.Notes = append(input.Notes, "invalid metadata: "+err.Error())
+		} else {
+			setPlanMetadata(&input, header)
+		}
+	}
+	if input.Digest == "" {
+		input.Notes = append(input.Notes, "the index server does not publish the wheel's sha256 digest")
+	}
+	return input, nil
+}
+
+// planRemoteWheel fills in input from the wheel's .dist-info files when the index server doesn't
+// serve the metadata separately, by reading just those files from the wheel with HTTP Range
+// requests.
+func planRemoteWheel(ctx context.Context, link pep503.FileLink, input *planInput) {
+	zipReader, size, err := link.OpenZip(ctx)
+	if err != nil {
+		if !errors.Is(err, pep503.ErrNoRanges) {
+			dlog.Warnf(ctx, "%s: metadata: %v", input.Name, err)
+		}
+		input.Notes = append(input.Notes,
+			"the index server does not serve the wheel's metadata separately (PEP 658) or "+
+				"support range requests, so its size and requirements are not known without "+
+				"downloading it")
+		return
+	}
+	input.Size = size
+	info, err := bdist.InspectWheelMetadata(input.Name, zipReader)
+	if err != nil {
+		input.Notes = append(input.Notes, "invalid wheel: "+err.Error())
+		return
+	}
+	input.InstalledSize = info.InstalledSize
+	input.Notes = append(input.Notes, info.Errors...)
+	setPlanMetadata(input, info.Metadata)
+}
+
+func setPlanMetadata(input *planInput, metadata textproto.MIMEHeader) {
+	if metadata == nil {
+		return
+	}
+	if version := metadata.Get("Version"); version != "" {
+		input.Version = version
+	}
+	input.RequiresPython = strings.TrimSpace(metadata.Get("Requires-Python"))
+	input.RequiresDist = metadata.Values("Requires-Dist")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/datawire/ocibuild/pkg/hermetic"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/checksumdb"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/python/pypa/simple_repo_api"
+	"github.com/datawire/ocibuild/pkg/python/wheelhouse"
+)
+
+// Exit statuses; see exitStatusHelp.  Usage errors exit with status 2 from cliutil.FlagErrorFunc.
+const (
+	exitFailure      = 1
+	exitUsage        = 2
+	exitResolution   = 3
+	exitHashMismatch = 4
+	exitIntegrity    = 5
+	exitNetwork      = 6
+)
+
+const exitStatusHelp = "" +
+	"EXIT STATUS: 0 on success; 1 for errors not listed here; 2 for usage errors (invalid " +
+	"flags or arguments, or an invalid config file); 3 if a requirement could not be " +
+	"resolved (the index server or wheelhouse has no matching wheel, or a version specifier " +
+	"is unsatisfiable); 4 if a downloaded or vendored file doesn't match its expected hash " +
+	"(or a checksum database); 5 if a wheel fails its integrity check (its content doesn't " +
+	"match its RECORD); and 6 for network errors (including network access forbidden by " +
+	"--hermetic).  A few commands that report their result through their exit status (such as " +
+	"`ocibuild python version match`) document their own."
+
+// exitStatusFor returns the exit status for an error returned from a command.
+func exitStatusFor(err error) int {
+	var unsatisfiable *pep440.UnsatisfiableError
+	var httpErr *pep503.HTTPError
+	var urlErr *url.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, python.ErrHashMismatch), errors.Is(err, checksumdb.ErrMismatch):
+		return exitHashMismatch
+	case errors.Is(err, bdist.ErrIntegrity):
+		return exitIntegrity
+	case errors.Is(err, simple_repo_api.ErrNoMatch),
+		errors.Is(err, pep503.ErrNotFound),
+		errors.Is(err, wheelhouse.ErrNotFound),
+		errors.As(err, &unsatisfiable):
+		return exitResolution
+	case errors.Is(err, hermetic.ErrNetwork),
+		errors.As(err, &urlErr),
+		errors.As(err, &netErr),
+		errors.As(err, &httpErr) && (httpErr.StatusCode >= http.StatusInternalServerError ||
+			httpErr.StatusCode == http.StatusTooManyRequests):
+		return exitNetwork
+	default:
+		return exitFailure
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/spf13/cobra"
+
+	"github.com/datawire/ocibuild/pkg/blobstore"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+// imageFileFlags select which image to use from an IN_IMAGEFILE that is a "docker save" archive
+// containing several images, whether to write the other images back out along with it, and
+// whether to write the output to an OCI image layout directory instead of to stdout.
+type imageFileFlags struct {
+	inTag      string
+	keepOthers bool
+	outLayout  string
+}
+
+// addImageFileFlags adds the --in-tag flag, and (if the command writes an image) the
+// --keep-others and --out-layout flags.
+func addImageFileFlags(cmd *cobra.Command, flags *imageFileFlags, writes bool) {
+	cmd.Flags().StringVar(&flags.inTag, "in-tag", "",
+		"If IN_IMAGEFILE contains several images, use the one tagged as `TAG`; IN_IMAGEFILE may "+
+			"also be an OCI image layout directory, in which case this is the image's ref.name")
+	if err := cmd.RegisterFlagCompletionFunc("in-tag", completeDockerImages); err != nil {
+		panic(err)
+	}
+	if writes {
+		cmd.Flags().BoolVar(&flags.keepOthers, "keep-others", false,
+			"Also write the other images in IN_IMAGEFILE to OUT_IMAGEFILE, unchanged")
+		addOutLayoutFlag(cmd, &flags.outLayout)
+	}
+}
+
+// addOutLayoutFlag adds the --out-layout flag, for writeImage.
+func addOutLayoutFlag(cmd *cobra.Command, outLayout *string) {
+	cmd.Flags().StringVar(outLayout, "out-layout", "",
+		"Rather than writing OUT_IMAGEFILE to stdout, add the image to the OCI image layout "+
+			"directory `OUT_DIR` (which is created if it doesn't exist)")
+	if err := cmd.MarkFlagDirname("out-layout"); err != nil {
+		panic(err)
+	}
+}
+
+// Open opens the selected image from filename.
+func (flags imageFileFlags) Open(filename string) (ociv1.Image, error) {
+	return fsutil.OpenImageTag(filename, flags.inTag)
+}
+
+// Write writes img to w (or to --out-layout), tagged as ref (which may be nil).  With
+// --keep-others, the other images from filename are also written, and img replaces the selected
+// image; if ref is nil then img keeps the tags that the selected image had.
+func (flags imageFileFlags) Write(filename string, ref name.Reference, img ociv1.Image, w io.Writer) error {
+	if !flags.keepOthers {
+		return writeImage(flags.outLayout, ref, img, w)
+	}
+	images, err := fsutil.OpenImages(filename)
+	if err != nil {
+		return err
+	}
+	selected := -1
+	switch {
+	case flags.inTag != "":
+		tag, err := name.NewTag(flags.inTag)
+		if err != nil {
+			return err
+		}
+		for i := range images {
+			if images[i].HasTag(tag) {
+				selected = i
+				break
+			}
+		}
+	case len(images) == 1:
+		selected = 0
+	}
+	if selected < 0 {
+		return fmt.Errorf("%s: could not find the selected image", filename)
+	}
+	images[selected].Image = img
+	if ref != nil {
+		tag, ok := ref.(name.Tag)
+		if !ok {
+			return fmt.Errorf("--keep-others: %q is not a tag", ref)
+		}
+		images[selected].Tags = []name.Tag{tag}
+	}
+	if flags.outLayout != "" {
+		return appendLayoutImages(flags.outLayout, images)
+	}
+	return fsutil.WriteImages(w, images)
+}
+
+// writeImage writes img to w as a "docker save" archive, tagged as ref (which may be nil); or, if
+// outLayout is non-empty, adds it to the OCI image layout directory outLayout instead.
+func writeImage(outLayout string, ref name.Reference, img ociv1.Image, w io.Writer) error {
+	if outLayout == "" {
+		return ociv1tarball.Write(ref, img, w)
+	}
+	image := fsutil.ArchiveImage{Image: img} //nolint:exhaustivestruct // Tags is set below
+	if tag, ok := ref.(name.Tag); ok {
+		image.Tags = []name.Tag{tag}
+	}
+	return appendLayoutImages(outLayout, []fsutil.ArchiveImage{image})
+}
+
+// appendLayoutImages adds images to the OCI image layout directory outLayout, once for each of its
+// tags (or once without a name, if it has none).
+func appendLayoutImages(outLayout string, images []fsutil.ArchiveImage) error {
+	store, err := blobstore.OpenLayout(outLayout)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if len(image.Tags) == 0 {
+			if err := store.AppendImage(image.Image, ""); err != nil {
+				return err
+			}
+		}
+		for _, tag := range image.Tags {
+			if err := store.AppendImage(image.Image, tag.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -3,30 +3,68 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/datawire/dlib/dlog"
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/logs"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/dockerutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/ghactions"
+	"github.com/datawire/ocibuild/pkg/hermetic"
+	"github.com/datawire/ocibuild/pkg/httpconfig"
+	"github.com/datawire/ocibuild/pkg/progress"
+	"github.com/datawire/ocibuild/pkg/warnings"
 )
 
 var (
 	argparser = &cobra.Command{
 		Use:   "ocibuild {[flags]|SUBCOMMAND...}",
 		Short: "Manipulate OCI/Docker images and layers as regular files",
+		Long:  cliutil.ConfigHelp + "\n\n" + exitStatusHelp,
 
 		Args: cliutil.WrapPositionalArgs(cliutil.OnlySubcommands),
 		RunE: cliutil.RunSubcommands,
 
 		SilenceErrors: true, // main() will handle this after .ExecuteContext() returns
 		SilenceUsage:  true, // our FlagErrorFunc will handle it
+	}
+	argparserCache = &cobra.Command{
+		Use:   "cache {[flags]|SUBCOMMAND...}",
+		Short: "Manage the local download cache",
+		Long: "Manage the local download cache, where downloaded wheels are kept (keyed by their " +
+			"sha256 digest) so that they need not be downloaded again." +
+			"\n\n" +
+			"With the global --cache-registry flag, the cache is shared through a repository in " +
+			"an OCI registry, so that machines that don't keep a local cache between runs (such " +
+			"as ephemeral CI runners) can still share one: entries missing from the local cache " +
+			"are pulled from the registry, and new entries are pushed to it.  Registry " +
+			"credentials are read from the Docker config file, as for `docker login`, or from " +
+			"the --creds-helper program." +
+			"\n\n" +
+			"LIMITATION: Entries are pushed as blobs that no manifest refers to, so registries " +
+			"that garbage-collect unreferenced blobs will eventually remove them (they are then " +
+			"just downloaded again).  `ocibuild cache ls` and `ocibuild cache prune` only act " +
+			"on the local cache.",
 
-		CompletionOptions: cobra.CompletionOptions{ //nolint:exhaustivestruct
-			DisableDefaultCmd: true,
-		},
+		Args: cliutil.WrapPositionalArgs(cliutil.OnlySubcommands),
+		RunE: cliutil.RunSubcommands,
 	}
 	argparserImage = &cobra.Command{
 		Use:   "image {[flags]|SUBCOMMAND...}",
@@ -49,25 +87,368 @@ var (
 		Args: cliutil.WrapPositionalArgs(cliutil.OnlySubcommands),
 		RunE: cliutil.RunSubcommands,
 	}
+	argparserPythonPlatform = &cobra.Command{
+		Use:   "platform {[flags]|SUBCOMMAND...}",
+		Short: "Work with the platform files that describe target Python environments",
+
+		Args: cliutil.WrapPositionalArgs(cliutil.OnlySubcommands),
+		RunE: cliutil.RunSubcommands,
+	}
+	argparserPythonVersion = &cobra.Command{
+		Use:     "version {[flags]|SUBCOMMAND...}",
+		Aliases: []string{"pep440"},
+		Short:   "Parse, compare, and match Python (PEP 440) version numbers",
+		Long: "Parse, compare, and match Python version numbers and version specifiers, with " +
+			"exactly the same semantics (PEP 440) as the rest of ocibuild uses; so that shell " +
+			"scripts and Makefiles needn't approximate them with `sort -V` or similar." +
+			"\n\n" +
+			"An invalid version or specifier on the command line is a usage error, and exits " +
+			"with status 2.",
+
+		Args: cliutil.WrapPositionalArgs(cliutil.OnlySubcommands),
+		RunE: cliutil.RunSubcommands,
+	}
+
+	// outputFormat is the global --output-format flag; either "text" or "github".
+	outputFormat = "text"
+
+	// cacheRegistry is the global --cache-registry flag; see openCache.
+	cacheRegistry string
+
+	// credsHelper is the global --creds-helper flag; see registryOptions.
+	credsHelper string
+
+	// hermeticMode is the global --hermetic flag; see checkHermetic.
+	hermeticMode bool
+
+	// downloadConnections and downloadRetries are the global --download-connections and
+	// --download-retries flags; see setupDownloads.
+	downloadConnections int
+	downloadRetries     int
+
+	// httpSettings is the global --proxy, --no-proxy, --ca-cert, --client-cert, --client-key, and
+	// --tls-host flags (and the config file's 'tlsHosts'); see setupHTTP.
+	httpSettings = httpconfig.Config{} //nolint:exhaustivestruct // set from flags
+
+	// warningCollector collects warnings for the global --strict and --warnings-file flags.
+	warningCollector = &warnings.Collector{} //nolint:exhaustivestruct // Strict is set from flags
+	// warningsFile is the global --warnings-file flag.
+	warningsFile string
 )
 
 func init() {
+	var (
+		jsonLogs     bool
+		progressMode string
+		strict       []string
+		tlsHosts     []string
+	)
+	argparser.PersistentFlags().BoolVar(&jsonLogs, "json-logs", false,
+		"Write log messages to stderr as JSON objects, one per line")
+	argparser.PersistentFlags().StringVar(&progressMode, "progress", "auto",
+		"How to report the progress of downloads: 'bar' draws a progress bar on stderr, "+
+			"'log' writes log messages, and 'auto' uses 'bar' if stderr is a terminal and "+
+			"--json-logs is not set, or 'log' otherwise")
+	argparser.PersistentFlags().StringVar(&outputFormat, "output-format", outputFormat,
+		"How to report errors and warnings: 'text', or 'github' to emit them as GitHub Actions "+
+			"workflow commands (such as '::error::MESSAGE') so that they show up as annotations")
+	if err := argparser.RegisterFlagCompletionFunc("output-format", completeWords("text", "github")); err != nil {
+		panic(err)
+	}
+	argparser.PersistentFlags().StringVar(&cacheRegistry, "cache-registry", "",
+		"Share the download cache through the OCI registry repository `REPOSITORY` (such as "+
+			"'ghcr.io/example/ocibuild-cache'): entries missing from the local cache are pulled "+
+			"from it, and new entries are pushed to it")
+	argparser.PersistentFlags().StringVar(&credsHelper, "creds-helper", "",
+		"Get registry credentials from the docker-credential-helper program "+
+			"'docker-credential-`NAME`' (such as 'pass' or 'ecr-login'), rather than from the "+
+			"Docker config file")
+	argparser.PersistentFlags().BoolVar(&hermeticMode, "hermetic", false,
+		"Forbid all network access, so that the build provably depends only on local inputs: "+
+			"wheels must come from --find-links wheelhouses, base images from local files, and "+
+			"--cache-registry is ignored")
+	argparser.PersistentFlags().IntVar(&downloadConnections, "download-connections", 1,
+		"Download large files from index servers in segments over up to `N` connections at once, "+
+			"if the server supports Range requests")
+	argparser.PersistentFlags().IntVar(&downloadRetries, "download-retries", 3,
+		"Resume a download from an index server that fails partway through up to `N` times")
+	argparser.PersistentFlags().StringVar(&httpSettings.Proxy, "proxy", "",
+		"Send requests to index servers and registries through the proxy at `URL` (default from "+
+			"$HTTPS_PROXY and $HTTP_PROXY)")
+	argparser.PersistentFlags().StringVar(&httpSettings.NoProxy, "no-proxy", "",
+		"Don't use the proxy for the comma-separated `HOSTS` (default from $NO_PROXY)")
+	argparser.PersistentFlags().StringVar(&httpSettings.CACert, "ca-cert", "",
+		"Trust the CA certificates in the PEM `FILE`, in addition to the system's trusted CAs")
+	argparser.PersistentFlags().StringVar(&httpSettings.ClientCert, "client-cert", "",
+		"Present the client certificate in the PEM `FILE` to servers that ask for one (mTLS); "+
+			"the private key is read from --client-key, or else from the same file")
+	argparser.PersistentFlags().StringVar(&httpSettings.ClientKey, "client-key", "",
+		"Read the private key for --client-cert from the PEM `FILE`")
+	argparser.PersistentFlags().StringArrayVar(&tlsHosts, "tls-host", nil,
+		"Override the TLS settings for one host; `HOST[:PORT],SETTING=VALUE...` where SETTING is "+
+			"'ca-cert', 'client-cert', or 'client-key' (may be given multiple times)")
+	argparser.PersistentFlags().StringSliceVar(&strict, "strict", nil,
+		"Treat warnings of the given `CLASSES` as errors (comma-separated; 'all', or any of "+
+			strings.Join(warningClassNames(), ", ")+")")
+	if err := argparser.RegisterFlagCompletionFunc("strict",
+		completeWords(append(warningClassNames(), string(warnings.All))...)); err != nil {
+		panic(err)
+	}
+	argparser.PersistentFlags().StringVar(&warningsFile, "warnings-file", "",
+		"Write the warnings to `FILE` as a JSON array of {\"class\", \"message\"} objects, "+
+			"even if the command fails")
+	argparser.PersistentPreRunE = func(flags *cobra.Command, _ []string) error {
+		if hermeticMode {
+			setupHermetic()
+		} else if err := setupHTTP(tlsHosts); err != nil {
+			return err
+		}
+		if err := setupWarnings(strict); err != nil {
+			return err
+		}
+		return setupLogging(flags, jsonLogs, progressMode)
+	}
+
 	argparser.SetFlagErrorFunc(cliutil.FlagErrorFunc)
 	argparser.SetHelpTemplate(cliutil.HelpTemplate)
+	argparser.AddCommand(argparserCache)
 	argparser.AddCommand(argparserImage)
 	argparser.AddCommand(argparserLayer)
 	argparser.AddCommand(argparserPython)
+	argparserPython.AddCommand(argparserPythonPlatform)
+	argparserPython.AddCommand(argparserPythonVersion)
+}
+
+// An exitStatus error causes the program to exit with that status without printing anything, for
+// commands that report their result through their exit status (like test(1)).
+type exitStatus int
+
+func (status exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(status))
 }
 
 func main() {
-	ctx := context.Background()
+	cfg, err := cliutil.LoadConfig()
+	if err == nil {
+		err = cliutil.ApplyConfig(argparser, cfg)
+		httpSettings.Hosts = cfg.TLSHosts
+	}
+	if err != nil {
+		fmt.Fprintf(argparser.ErrOrStderr(), "%s: error: config: %v\n", argparser.CommandPath(), err)
+		os.Exit(exitUsage)
+	}
+
+	// Cancel the Context on SIGINT or SIGTERM, so that long-running operations stop cleanly
+	// (removing any temporary files) when a CI job is aborted.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = argparser.ExecuteContext(ctx)
+	cancel()
+	if warningsFile != "" {
+		if writeErr := writeWarningsFile(warningsFile); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	var status exitStatus
+	if errors.As(err, &status) {
+		os.Exit(int(status))
+	}
+	if err != nil {
+		if outputFormat == "github" {
+			fmt.Fprintln(argparser.ErrOrStderr(), ghactions.Error(nil, err.Error()))
+		} else {
+			fmt.Fprintf(argparser.ErrOrStderr(), "%s: error: %v\n", argparser.CommandPath(), err)
+		}
+		os.Exit(exitStatusFor(err))
+	}
+}
+
+// setupHermetic enforces --hermetic.  Commands should call checkHermetic before doing anything
+// that needs the network, so that the user gets a clear error up front; as a backstop, any HTTP
+// request that is made anyway fails, and `go build` is kept from downloading modules.
+func setupHermetic() {
+	http.DefaultTransport = hermetic.Transport{}
+	_ = os.Setenv("GOPROXY", "off")
+}
+
+// setupHTTP applies the HTTP settings flags by replacing http.DefaultTransport, which the index
+// server and registry clients all use unless they are given a different transport.  Each
+// --tls-host flag adds to (or replaces an entry in) the config file's 'tlsHosts'.
+func setupHTTP(tlsHosts []string) error {
+	if len(tlsHosts) > 0 {
+		hosts := make(map[string]httpconfig.TLS, len(httpSettings.Hosts)+len(tlsHosts))
+		for host, settings := range httpSettings.Hosts {
+			hosts[host] = settings
+		}
+		for _, str := range tlsHosts {
+			host, settings, err := httpconfig.ParseHost(str)
+			if err != nil {
+				return fmt.Errorf("--tls-host: %w", err)
+			}
+			hosts[host] = settings
+		}
+		httpSettings.Hosts = hosts
+	}
+	if httpSettings.IsZero() {
+		return nil
+	}
+	transport, err := httpSettings.Transport()
+	if err != nil {
+		return err
+	}
+	http.DefaultTransport = transport
+	return nil
+}
+
+// registryOptions returns the options for talking to an OCI registry (for --cache-registry, or for
+// pushing an image): credentials are taken from the --creds-helper program if it is set, or else
+// from the Docker config file.
+func registryOptions() []remote.Option {
+	keychain := authn.DefaultKeychain
+	if credsHelper != "" {
+		keychain = dockerutil.CredsHelperKeychain(credsHelper)
+	}
+	return []remote.Option{remote.WithAuthFromKeychain(keychain)}
+}
+
+// checkHermetic returns an error if --hermetic is set; what describes the network access that the
+// caller is about to make.
+func checkHermetic(what string) error {
+	return hermetic.Check(hermeticMode, what)
+}
 
+func warningClassNames() []string {
+	ret := make([]string, 0, len(warnings.Classes))
+	for _, class := range warnings.Classes {
+		ret = append(ret, string(class))
+	}
+	return ret
+}
+
+// setupWarnings validates the --strict flag and installs the fallback warnings.Collector; as with
+// setupLogging, it has to be set globally.
+func setupWarnings(strict []string) error {
+	for _, str := range strict {
+		class := warnings.Class(str)
+		valid := class == warnings.All
+		for _, known := range warnings.Classes {
+			valid = valid || class == known
+		}
+		if !valid {
+			return fmt.Errorf("invalid --strict class %q: must be 'all' or one of %s",
+				str, strings.Join(warningClassNames(), ", "))
+		}
+		warningCollector.Strict = append(warningCollector.Strict, class)
+	}
+	warnings.SetFallbackCollector(warningCollector)
+	return nil
+}
+
+// writeWarningsFile writes the collected warnings for --warnings-file.
+func writeWarningsFile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := warningCollector.WriteJSON(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// setupLogging configures the fallback dlog.Logger and progress.Reporter; cobra doesn't let us
+// replace the Context after flags have been parsed, so these have to be set globally.
+func setupLogging(flags *cobra.Command, jsonLogs bool, progressMode string) error {
+	stderr := flags.ErrOrStderr()
+	isTerminal := false
+	width := 0
+	if file, ok := stderr.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		isTerminal = true
+		width, _, _ = term.GetSize(int(file.Fd()))
+	}
+
+	var formatter logrus.Formatter
+	if jsonLogs {
+		formatter = &logrus.JSONFormatter{} //nolint:exhaustivestruct
+	} else {
+		formatter = &logrus.TextFormatter{ //nolint:exhaustivestruct
+			SortingFunc: dlog.DefaultFieldSort,
+		}
+	}
+	switch outputFormat {
+	case "text":
+	case "github":
+		formatter = ghactions.Formatter{Fallback: formatter}
+	default:
+		return fmt.Errorf("invalid --output-format %q: must be one of 'text' or 'github'", outputFormat)
+	}
+	logger := logrus.New()
+	logger.SetOutput(stderr)
+	logger.SetFormatter(formatter)
+	dlog.SetFallbackLogger(dlog.WrapLogrus(logger))
+
+	ctx := flags.Context()
 	logs.Warn = dlog.StdLogger(ctx, dlog.LogLevelWarn)
 	logs.Progress = dlog.StdLogger(ctx, dlog.LogLevelInfo)
 	logs.Debug = dlog.StdLogger(ctx, dlog.LogLevelDebug)
 
-	if err := argparser.ExecuteContext(ctx); err != nil {
-		fmt.Fprintf(argparser.ErrOrStderr(), "%s: error: %v\n", argparser.CommandPath(), err)
-		os.Exit(1)
+	switch progressMode {
+	case "auto":
+		if isTerminal && !jsonLogs {
+			progressMode = "bar"
+		} else {
+			progressMode = "log"
+		}
+	case "bar", "log":
+	default:
+		return fmt.Errorf("invalid --progress mode %q: must be one of 'auto', 'bar', or 'log'",
+			progressMode)
+	}
+	if progressMode == "bar" {
+		progress.SetFallbackReporter(&progress.BarReporter{ //nolint:exhaustivestruct
+			Out:   stderr,
+			Width: width,
+		})
+	} else {
+		progress.SetFallbackReporter(progress.LogReporter{})
 	}
+	return nil
+}
+
+// writeLayer is like fsutil.WriteLayer, but also reports a progress.LayerDigested event.
+func writeLayer(ctx context.Context, layer ociv1.Layer, dst io.Writer) error {
+	hasher := sha256.New()
+	counter := &countingWriter{} //nolint:exhaustivestruct
+	if err := fsutil.WriteLayer(layer, io.MultiWriter(dst, hasher, counter)); err != nil {
+		return err
+	}
+	progress.Report(ctx, progress.Event{ //nolint:exhaustivestruct
+		Kind:   progress.LayerDigested,
+		Bytes:  counter.n,
+		Digest: "sha256:" + hex.EncodeToString(hasher.Sum(nil)),
+	})
+	return nil
+}
+
+// writeLayerFile is like writeLayer, but writes to a new file.
+func writeLayerFile(ctx context.Context, layer ociv1.Layer, filename string) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	return writeLayer(ctx, layer, file)
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
 }
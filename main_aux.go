@@ -11,13 +11,6 @@ import (
 )
 
 func init() {
-	// completion
-	argparser.CompletionOptions.DisableDefaultCmd = false
-	argparser.PersistentPreRun = func(cmd *cobra.Command, _ []string) {
-		completionCmd, _, _ := cmd.Root().Find([]string{"completion"})
-		completionCmd.Hidden = true
-	}
-
 	// man
 	argparser.AddCommand(&cobra.Command{
 		Hidden: true,
@@ -0,0 +1,143 @@
+// Package annotations deals with the pre-defined OCI image annotations, which are set both as
+// annotations on an image's manifest and as labels in the image's config.
+//
+// https://github.com/opencontainers/image-spec/blob/main/annotations.md
+package annotations
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datawire/dlib/dexec"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// Pre-defined annotation keys.
+const (
+	Created       = "org.opencontainers.image.created"
+	Authors       = "org.opencontainers.image.authors"
+	URL           = "org.opencontainers.image.url"
+	Documentation = "org.opencontainers.image.documentation"
+	Source        = "org.opencontainers.image.source"
+	Version       = "org.opencontainers.image.version"
+	Revision      = "org.opencontainers.image.revision"
+	Vendor        = "org.opencontainers.image.vendor"
+	Licenses      = "org.opencontainers.image.licenses"
+	RefName       = "org.opencontainers.image.ref.name"
+	Title         = "org.opencontainers.image.title"
+	Description   = "org.opencontainers.image.description"
+)
+
+// FormatCreated formats a timestamp for the Created annotation (RFC 3339, in UTC, so that the
+// value doesn't depend on the local timezone).
+func FormatCreated(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// FromGit returns the Source, Revision, and Created annotations for the Git repository that
+// contains dir:
+//
+//  - Source is the URL of the "origin" remote (with any credentials removed, and SCP-style
+//    "git@host:path" addresses turned in to "https://host/path"); it is omitted if there is no
+//    "origin" remote.
+//  - Revision is the commit ID of HEAD.
+//  - Created is $SOURCE_DATE_EPOCH if it is set, or else the commit time of HEAD; never the
+//    current time, so that the result is reproducible.
+//
+// It returns an error if dir is not in a Git repository.
+func FromGit(ctx context.Context, dir string) (map[string]string, error) {
+	git := func(args ...string) (string, error) {
+		out, err := dexec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	revision, err := git("rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("annotations.FromGit: %q is not in a Git repository with commits: %w", dir, err)
+	}
+	ret := map[string]string{
+		Revision: revision,
+	}
+
+	if remote, err := git("remote", "get-url", "origin"); err == nil && remote != "" {
+		ret[Source] = normalizeRemote(remote)
+	}
+
+	if secs, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		ret[Created] = FormatCreated(time.Unix(secs, 0))
+	} else {
+		str, err := git("log", "-1", "--format=%ct", "HEAD")
+		if err != nil {
+			return nil, fmt.Errorf("annotations.FromGit: %w", err)
+		}
+		secs, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("annotations.FromGit: invalid commit time %q: %w", str, err)
+		}
+		ret[Created] = FormatCreated(time.Unix(secs, 0))
+	}
+
+	return ret, nil
+}
+
+var reSCPLike = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.*)$`)
+
+// normalizeRemote turns a Git remote address in to a URL suitable for the Source annotation.
+func normalizeRemote(remote string) string {
+	if !strings.Contains(remote, "://") {
+		if match := reSCPLike.FindStringSubmatch(remote); match != nil {
+			remote = "https://" + match[1] + "/" + strings.TrimPrefix(match[2], "/")
+		}
+	}
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		u.User = nil
+		if u.Scheme == "ssh" || u.Scheme == "git" {
+			u.Scheme = "https"
+			u.Host = u.Hostname()
+		}
+		remote = u.String()
+	}
+	return strings.TrimSuffix(remote, ".git")
+}
+
+// Apply returns a copy of img with the given annotations added to its manifest and the given
+// labels added to its config, overriding any existing annotations or labels with the same keys.  A
+// label value of "" removes the label.
+func Apply(img ociv1.Image, manifestAnnotations, configLabels map[string]string) (ociv1.Image, error) {
+	if len(configLabels) > 0 {
+		configFile, err := img.ConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("annotations.Apply: %w", err)
+		}
+		// Don't use mutate.Config, as it modifies the base image's ConfigFile in-place.  And
+		// DeepCopy doesn't copy the Labels map.
+		labels := make(map[string]string, len(configFile.Config.Labels)+len(configLabels))
+		for k, v := range configFile.Config.Labels {
+			labels[k] = v
+		}
+		for k, v := range configLabels {
+			if v == "" {
+				delete(labels, k)
+			} else {
+				labels[k] = v
+			}
+		}
+		configFile = configFile.DeepCopy()
+		configFile.Config.Labels = labels
+		img, err = mutate.ConfigFile(img, configFile)
+		if err != nil {
+			return nil, fmt.Errorf("annotations.Apply: %w", err)
+		}
+	}
+	if len(manifestAnnotations) > 0 {
+		img = mutate.Annotations(img, manifestAnnotations).(ociv1.Image) //nolint:forcetypeassert // given an Image
+	}
+	return img, nil
+}
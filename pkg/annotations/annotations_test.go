@@ -0,0 +1,84 @@
+package annotations_test
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/datawire/ocibuild/pkg/annotations"
+)
+
+func TestFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_DATE", "2021-12-01T00:00:00Z")
+	t.Setenv("GIT_COMMITTER_DATE", "2021-12-01T00:00:00Z")
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	_, err := annotations.FromGit(ctx, dir)
+	assert.Error(t, err, "not a repository")
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com",
+			"commit", "--quiet", "--allow-empty", "--message=initial"},
+		{"remote", "add", "origin", "git@github.com:example/repo.git"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	revision, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	require.NoError(t, err)
+
+	annots, err := annotations.FromGit(ctx, dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		annotations.Source:   "https://github.com/example/repo",
+		annotations.Revision: string(revision[:len(revision)-1]),
+		annotations.Created:  "2021-12-01T00:00:00Z",
+	}, annots)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "0")
+	annots, err = annotations.FromGit(ctx, dir)
+	require.NoError(t, err)
+	assert.Equal(t, "1970-01-01T00:00:00Z", annots[annotations.Created])
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+	base, err := mutate.Config(empty.Image, ociv1.Config{ //nolint:exhaustivestruct
+		Labels: map[string]string{"keep": "yes", "remove": "yes"},
+	})
+	require.NoError(t, err)
+
+	img, err := annotations.Apply(base,
+		map[string]string{annotations.Revision: "abc123"},
+		map[string]string{annotations.Revision: "abc123", "remove": ""})
+	require.NoError(t, err)
+
+	configFile, err := img.ConfigFile()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"keep": "yes", annotations.Revision: "abc123"}, configFile.Config.Labels)
+
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{annotations.Revision: "abc123"}, manifest.Annotations)
+
+	// The base image is not modified.
+	configFile, err = base.ConfigFile()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"keep": "yes", "remove": "yes"}, configFile.Config.Labels)
+}
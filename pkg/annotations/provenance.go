@@ -0,0 +1,89 @@
+package annotations
+
+import (
+	"fmt"
+	"strings"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// Wheel is the annotation key that ocibuild sets on a layer descriptor in an image's manifest to
+// record which Python wheel the layer was installed from.  The value is the wheel's filename
+// followed by its digest; for example:
+//
+//     org.ocibuild.wheel=Flask-2.0.1-py3-none-any.whl sha256=c1f4…
+//
+// See FormatWheel and ParseWheel.
+const Wheel = "org.ocibuild.wheel"
+
+// WheelProvenance identifies the Python wheel that a layer was installed from.
+type WheelProvenance struct {
+	Filename string
+	Digest   ociv1.Hash
+}
+
+// FormatWheel formats prov as a value for the Wheel annotation.
+func FormatWheel(prov WheelProvenance) string {
+	return prov.Filename + " " + prov.Digest.Algorithm + "=" + prov.Digest.Hex
+}
+
+// ParseWheel parses a value of the Wheel annotation, as formatted by FormatWheel.
+func ParseWheel(str string) (WheelProvenance, error) {
+	sp := strings.LastIndexByte(str, ' ')
+	if sp <= 0 {
+		return WheelProvenance{}, //nolint:exhaustivestruct // zero value
+			fmt.Errorf("annotations.ParseWheel: invalid value %q: must be 'FILENAME ALGORITHM=HEX'", str)
+	}
+	digest, err := ociv1.NewHash(strings.Replace(str[sp+1:], "=", ":", 1))
+	if err != nil {
+		return WheelProvenance{}, fmt.Errorf("annotations.ParseWheel: invalid value %q: %w", str, err) //nolint:exhaustivestruct // zero value
+	}
+	return WheelProvenance{
+		Filename: str[:sp],
+		Digest:   digest,
+	}, nil
+}
+
+// AppendLayers is like mutate.AppendLayers, but also sets annotations on the descriptor of each
+// layer in the resulting image's manifest.  layerAnnotations[i] are the annotations for layers[i];
+// layerAnnotations may be shorter than layers, and nil entries are fine.
+func AppendLayers(base ociv1.Image, layers []ociv1.Layer, layerAnnotations []map[string]string) (ociv1.Image, error) {
+	adds := make([]mutate.Addendum, 0, len(layers))
+	for i, layer := range layers {
+		add := mutate.Addendum{ //nolint:exhaustivestruct // only set what we need
+			Layer: layer,
+		}
+		if i < len(layerAnnotations) && len(layerAnnotations[i]) > 0 {
+			add.Annotations = layerAnnotations[i]
+		}
+		adds = append(adds, add)
+	}
+	img, err := mutate.Append(base, adds...)
+	if err != nil {
+		return nil, fmt.Errorf("annotations.AppendLayers: %w", err)
+	}
+	return img, nil
+}
+
+// LayerWheels reads back the Wheel annotations on the layer descriptors in img's manifest.  The
+// returned map is keyed by the layer's digest; layers without a Wheel annotation are omitted.
+func LayerWheels(img ociv1.Image) (map[ociv1.Hash]WheelProvenance, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("annotations.LayerWheels: %w", err)
+	}
+	ret := make(map[ociv1.Hash]WheelProvenance)
+	for _, desc := range manifest.Layers {
+		str, ok := desc.Annotations[Wheel]
+		if !ok {
+			continue
+		}
+		prov, err := ParseWheel(str)
+		if err != nil {
+			return nil, fmt.Errorf("annotations.LayerWheels: layer %s: %w", desc.Digest, err)
+		}
+		ret[desc.Digest] = prov
+	}
+	return ret, nil
+}
@@ -0,0 +1,68 @@
+package annotations_test
+
+import (
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/annotations"
+)
+
+func TestParseWheel(t *testing.T) {
+	t.Parallel()
+	digest, err := ociv1.NewHash("sha256:" +
+		"1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef")
+	require.NoError(t, err)
+	prov := annotations.WheelProvenance{
+		Filename: "Flask-2.0.1-py3-none-any.whl",
+		Digest:   digest,
+	}
+	str := annotations.FormatWheel(prov)
+	assert.Equal(t, "Flask-2.0.1-py3-none-any.whl "+
+		"sha256=1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef", str)
+
+	parsed, err := annotations.ParseWheel(str)
+	require.NoError(t, err)
+	assert.Equal(t, prov, parsed)
+
+	for _, bad := range []string{
+		"",
+		"Flask-2.0.1-py3-none-any.whl",
+		" sha256=1234",
+		"Flask-2.0.1-py3-none-any.whl sha256=xyz",
+	} {
+		_, err := annotations.ParseWheel(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestLayerWheels(t *testing.T) {
+	t.Parallel()
+	layerA, err := random.Layer(64, "application/vnd.oci.image.layer.v1.tar")
+	require.NoError(t, err)
+	layerB, err := random.Layer(64, "application/vnd.oci.image.layer.v1.tar")
+	require.NoError(t, err)
+	digestA, err := layerA.Digest()
+	require.NoError(t, err)
+
+	prov := annotations.WheelProvenance{
+		Filename: "Flask-2.0.1-py3-none-any.whl",
+		Digest:   digestA, // any digest will do
+	}
+	img, err := annotations.AppendLayers(empty.Image,
+		[]ociv1.Layer{layerA, layerB},
+		[]map[string]string{{annotations.Wheel: annotations.FormatWheel(prov)}})
+	require.NoError(t, err)
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	assert.Len(t, layers, 2)
+
+	wheels, err := annotations.LayerWheels(img)
+	require.NoError(t, err)
+	assert.Equal(t, map[ociv1.Hash]annotations.WheelProvenance{digestA: prov}, wheels)
+}
@@ -0,0 +1,104 @@
+package annotations
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+// TemplateData is the build metadata that templated label and environment values may reference;
+// see Expand.  Everything in it is derived from the inputs to the build (never from the current
+// time or the like), so that expanding a template is deterministic.
+type TemplateData struct {
+	// Revision is the commit ID of HEAD, or "" if not in a Git repository.
+	Revision string
+	// Created is $SOURCE_DATE_EPOCH, or else the commit time of HEAD; or the zero Time if
+	// neither is available.
+	Created time.Time
+	// Installed is the list of Python distributions installed in the image.
+	Installed []pep376.Installed
+}
+
+// NewTemplateData collects the TemplateData for the Git repository containing gitDir (if it is
+// in one; see FromGit) and for the Python distributions installed in fsys (if it is non-nil; see
+// pep376.ListInstalled).
+func NewTemplateData(ctx context.Context, gitDir string, fsys fs.FS) (*TemplateData, error) {
+	var data TemplateData
+	if fromGit, err := FromGit(ctx, gitDir); err == nil {
+		data.Revision = fromGit[Revision]
+		created, err := time.Parse(time.RFC3339, fromGit[Created])
+		if err != nil {
+			return nil, fmt.Errorf("annotations.NewTemplateData: %w", err)
+		}
+		data.Created = created
+	} else if secs, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		data.Created = time.Unix(secs, 0).UTC()
+	}
+	if fsys != nil {
+		installed, err := pep376.ListInstalled(fsys)
+		if err != nil {
+			return nil, fmt.Errorf("annotations.NewTemplateData: %w", err)
+		}
+		data.Installed = installed
+	}
+	return &data, nil
+}
+
+// GitSHA returns the commit ID of HEAD; it is an error if not in a Git repository.
+func (d TemplateData) GitSHA() (string, error) {
+	if d.Revision == "" {
+		return "", fmt.Errorf("not in a Git repository with commits")
+	}
+	return d.Revision, nil
+}
+
+// Epoch returns the Created time as seconds since the Unix epoch; it is an error if neither
+// $SOURCE_DATE_EPOCH nor a Git commit is available.
+func (d TemplateData) Epoch() (int64, error) {
+	if d.Created.IsZero() {
+		return 0, fmt.Errorf("neither $SOURCE_DATE_EPOCH nor a Git commit is available")
+	}
+	return d.Created.Unix(), nil
+}
+
+// WheelVersions returns the version of the named Python distribution installed in the image; it
+// is an error if it isn't installed, or if several versions of it are.
+func (d TemplateData) WheelVersions(name string) (string, error) {
+	var versions []string
+	for _, dist := range d.Installed {
+		if pep503.NormalizeName(dist.Name) == pep503.NormalizeName(name) {
+			versions = append(versions, dist.Version)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return "", fmt.Errorf("%q is not installed", name)
+	case 1:
+		return versions[0], nil
+	default:
+		return "", fmt.Errorf("several versions of %q are installed: %s",
+			name, strings.Join(versions, ", "))
+	}
+}
+
+// Expand evaluates text as a Go text/template with the given data, such as
+// "{{ .GitSHA }}", "{{ .Epoch }}", or "{{ .WheelVersions \"flask\" }}".
+func Expand(text string, data *TemplateData) (string, error) {
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("annotations.Expand: %w", err)
+	}
+	var ret strings.Builder
+	if err := tmpl.Execute(&ret, data); err != nil {
+		return "", fmt.Errorf("annotations.Expand: %w", err)
+	}
+	return ret.String(), nil
+}
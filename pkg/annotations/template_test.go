@@ -0,0 +1,63 @@
+package annotations_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/annotations"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1609459200")
+	fsys := fstest.MapFS{
+		"usr/lib/python3/site-packages/Flask-2.0.1.dist-info/METADATA": &fstest.MapFile{
+			Data: []byte("Metadata-Version: 2.1\nName: Flask\nVersion: 2.0.1\n"),
+		},
+	}
+	// t.TempDir() is not in a Git repository.
+	data, err := annotations.NewTemplateData(context.Background(), t.TempDir(), fsys)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1609459200, 0).UTC(), data.Created)
+
+	type testcase struct {
+		Input       string
+		Output      string
+		ExpectedErr string
+	}
+	testcases := map[string]testcase{
+		"plain":       {Input: "hello", Output: "hello"},
+		"epoch":       {Input: "built-{{ .Epoch }}", Output: "built-1609459200"},
+		"wheel":       {Input: `{{ .WheelVersions "flask" }}`, Output: "2.0.1"},
+		"wheel-norm":  {Input: `{{ .WheelVersions "FLASK" }}`, Output: "2.0.1"},
+		"no-git":      {Input: "{{ .GitSHA }}", ExpectedErr: "not in a Git repository"},
+		"no-wheel":    {Input: `{{ .WheelVersions "django" }}`, ExpectedErr: `"django" is not installed`},
+		"bad-field":   {Input: "{{ .Nonexistent }}", ExpectedErr: "Nonexistent"},
+		"bad-syntax":  {Input: "{{ .Epoch", ExpectedErr: "unclosed action"},
+		"multi-field": {Input: `{{ .Epoch }}:{{ .WheelVersions "Flask" }}`, Output: "1609459200:2.0.1"},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			out, err := annotations.Expand(tcData.Input, data)
+			if tcData.ExpectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tcData.ExpectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Output, out)
+		})
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	data, err = annotations.NewTemplateData(context.Background(), t.TempDir(), nil)
+	require.NoError(t, err)
+	_, err = annotations.Expand("{{ .Epoch }}", data)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "neither $SOURCE_DATE_EPOCH nor a Git commit is available")
+}
@@ -0,0 +1,44 @@
+// Package blobstore defines a content-addressed store of blobs keyed by their digest
+// ("sha256:{hex}"), along with implementations of it backed by a directory (Dir), an OCI image
+// layout (Layout), and a repository in an OCI registry (Registry).  The download cache and image
+// reading share these, rather than each having its own idea of where blobs live.
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A Store is a content-addressed store of blobs.
+type Store interface {
+	// Get returns the content stored for a digest.  If there is no such blob, it returns
+	// (nil, false, nil).
+	Get(digest string) ([]byte, bool, error)
+	// Put stores content under digest, which the caller has already verified is the digest of
+	// the content.
+	Put(digest string, content []byte) error
+}
+
+// ErrInvalidDigest is returned (wrapped) when a digest string is malformed.
+var ErrInvalidDigest = errors.New("invalid digest")
+
+// ParseDigest validates a "sha256:{hex}" digest string, and returns the hex part of it.
+func ParseDigest(digest string) (hexSum string, err error) {
+	hexSum = strings.TrimPrefix(digest, "sha256:")
+	if hexSum == digest || len(hexSum) != 2*sha256.Size {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, digest)
+	}
+	if _, err := hex.DecodeString(hexSum); err != nil || strings.ToLower(hexSum) != hexSum {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, digest)
+	}
+	return hexSum, nil
+}
+
+// Digest returns the digest that content is stored under.
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,134 @@
+package blobstore_test
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/blobstore"
+)
+
+// testStore runs the tests that every Store should pass.
+func testStore(t *testing.T, store blobstore.Store) {
+	t.Helper()
+	digest := blobstore.Digest([]byte("a"))
+
+	// miss
+	content, ok, err := store.Get(digest)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, content)
+
+	// hit
+	require.NoError(t, store.Put(digest, []byte("a")))
+	content, ok, err = store.Get(digest)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a"), content)
+
+	// invalid digest
+	_, _, err = store.Get("sha256:zz")
+	assert.ErrorIs(t, err, blobstore.ErrInvalidDigest)
+}
+
+func TestDir(t *testing.T) {
+	t.Parallel()
+	dir := blobstore.Dir{Path: t.TempDir()}
+	testStore(t, dir)
+
+	// A corrupt blob is a miss.
+	digest := blobstore.Digest([]byte("b"))
+	filename, err := dir.BlobPath(digest)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, []byte("corrupt"), 0o644))
+	_, ok, err := dir.Get(digest)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, dir.Put(digest, []byte("b")))
+	content, ok, err := dir.Get(digest)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("b"), content)
+}
+
+func TestLayout(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "layout")
+	assert.False(t, blobstore.IsLayout(path))
+	store, err := blobstore.OpenLayout(path)
+	require.NoError(t, err)
+	assert.True(t, blobstore.IsLayout(path))
+	testStore(t, store)
+
+	// No images yet.
+	_, err = store.Image("")
+	assert.Error(t, err)
+
+	img1, err := random.Image(100, 1)
+	require.NoError(t, err)
+	img2, err := random.Image(100, 2)
+	require.NoError(t, err)
+	require.NoError(t, store.AppendImage(img1, "example.com/one:v1"))
+
+	// The only image is selected without a tag.
+	got, err := store.Image("")
+	require.NoError(t, err)
+	assertSameImage(t, img1, got)
+
+	require.NoError(t, store.AppendImage(img2, "example.com/two:v2"))
+	_, err = store.Image("")
+	assert.Error(t, err)
+	got, err = store.Image("example.com/two:v2")
+	require.NoError(t, err)
+	assertSameImage(t, img2, got)
+	_, err = store.Image("example.com/three:v3")
+	assert.Error(t, err)
+
+	// Reopening finds the same layout, and the image's blobs are in the Store.
+	store, err = blobstore.OpenLayout(path)
+	require.NoError(t, err)
+	layers, err := img2.Layers()
+	require.NoError(t, err)
+	layerDigest, err := layers[0].Digest()
+	require.NoError(t, err)
+	_, ok, err := store.Get(layerDigest.String())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// A directory with other things in it isn't turned in to a layout.
+	other := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(other, "file"), []byte("x"), 0o644))
+	_, err = blobstore.OpenLayout(other)
+	assert.Error(t, err)
+	assert.False(t, blobstore.IsLayout(other))
+}
+
+func assertSameImage(t *testing.T, expected, actual ociv1.Image) {
+	t.Helper()
+	expectedDigest, err := expected.Digest()
+	require.NoError(t, err)
+	actualDigest, err := actual.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, expectedDigest, actualDigest)
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	store, err := blobstore.NewRegistry(strings.TrimPrefix(server.URL, "http://")+"/blobs",
+		remote.WithTransport(server.Client().Transport))
+	require.NoError(t, err)
+	testStore(t, store)
+}
@@ -0,0 +1,79 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dir is a Store in a directory, with each blob at "blobs/sha256/{hex}" (the same place as in an
+// OCI image layout).  Writes are atomic renames, so it is safe for concurrent use by multiple
+// processes.  A blob whose content doesn't match its digest is treated as missing, and is
+// overwritten by the next Put.
+type Dir struct {
+	Path string
+}
+
+// BlobDir returns the directory that the blobs are stored in.
+func (d Dir) BlobDir() string {
+	return filepath.Join(d.Path, "blobs", "sha256")
+}
+
+// BlobPath returns the filename that the blob for digest is stored at.
+func (d Dir) BlobPath(digest string) (string, error) {
+	hexSum, err := ParseDigest(digest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d.BlobDir(), hexSum), nil
+}
+
+// Get implements Store.
+func (d Dir) Get(digest string) ([]byte, bool, error) {
+	filename, err := d.BlobPath(digest)
+	if err != nil {
+		return nil, false, fmt.Errorf("blobstore.Dir.Get: %w", err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("blobstore.Dir.Get: %w", err)
+	}
+	if Digest(content) != digest {
+		return nil, false, nil
+	}
+	return content, true, nil
+}
+
+// Put implements Store.
+func (d Dir) Put(digest string, content []byte) error {
+	filename, err := d.BlobPath(digest)
+	if err != nil {
+		return fmt.Errorf("blobstore.Dir.Put: %w", err)
+	}
+	if err := os.MkdirAll(d.BlobDir(), 0o777); err != nil {
+		return fmt.Errorf("blobstore.Dir.Put: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(d.BlobDir(), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("blobstore.Dir.Put: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+	if _, err := tmpFile.Write(content); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("blobstore.Dir.Put: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("blobstore.Dir.Put: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), filename); err != nil {
+		return fmt.Errorf("blobstore.Dir.Put: %w", err)
+	}
+	return nil
+}
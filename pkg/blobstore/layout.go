@@ -0,0 +1,113 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+// RefNameAnnotation is the annotation on a manifest descriptor in an OCI image layout's index.json
+// that names the image.
+const RefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// Layout is a Store in an OCI image layout directory, which may also hold images (see AppendImage
+// and Image).  Its blobs are stored the same way as in a Dir.
+type Layout struct {
+	Dir
+}
+
+// IsLayout returns whether path is an OCI image layout directory; that is, a directory containing
+// an "oci-layout" file.
+func IsLayout(path string) bool {
+	info, err := os.Stat(filepath.Join(path, "oci-layout"))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// OpenLayout returns the OCI image layout in the directory path, creating an empty one if the
+// directory doesn't exist or is empty.
+func OpenLayout(path string) (*Layout, error) {
+	if !IsLayout(path) {
+		dirents, err := os.ReadDir(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("blobstore.OpenLayout: %w", err)
+		}
+		if len(dirents) > 0 {
+			return nil, fmt.Errorf("blobstore.OpenLayout: %q is not an OCI image layout", path)
+		}
+		if _, err := layout.Write(path, empty.Index); err != nil {
+			return nil, fmt.Errorf("blobstore.OpenLayout: %w", err)
+		}
+	}
+	return &Layout{Dir: Dir{Path: path}}, nil
+}
+
+// AppendImage writes img (its manifest, its config, and its layers) to the layout, and adds it to
+// the layout's index; if tag is non-empty then it is recorded as the image's name.
+func (l *Layout) AppendImage(img ociv1.Image, tag string) error {
+	var opts []layout.Option
+	if tag != "" {
+		opts = append(opts, layout.WithAnnotations(map[string]string{
+			RefNameAnnotation: tag,
+		}))
+	}
+	if err := layout.Path(l.Path).AppendImage(img, opts...); err != nil {
+		return fmt.Errorf("blobstore.Layout.AppendImage: %w", err)
+	}
+	return nil
+}
+
+// Image returns an image from the layout's index.  If tag is non-empty, it selects the image
+// whose name is tag (comparing fully-resolved names, as fsutil.ArchiveImage.HasTag does);
+// otherwise the layout must contain exactly one image.
+func (l *Layout) Image(tag string) (ociv1.Image, error) {
+	var want *name.Tag
+	if tag != "" {
+		ref, err := name.NewTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("blobstore.Layout.Image: %w", err)
+		}
+		want = &ref
+	}
+	index, err := layout.Path(l.Path).ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("blobstore.Layout.Image: %w", err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("blobstore.Layout.Image: %w", err)
+	}
+	var matches []ociv1.Hash
+	for _, desc := range manifest.Manifests {
+		if !desc.MediaType.IsImage() {
+			continue
+		}
+		if want != nil {
+			ref, err := name.NewTag(desc.Annotations[RefNameAnnotation])
+			if err != nil || ref.Name() != want.Name() {
+				continue
+			}
+		}
+		matches = append(matches, desc.Digest)
+	}
+	switch {
+	case len(matches) == 0 && want != nil:
+		return nil, fmt.Errorf("blobstore.Layout.Image: %s: no image named %q", l.Path, tag)
+	case len(matches) == 0:
+		return nil, fmt.Errorf("blobstore.Layout.Image: %s: no images", l.Path)
+	case len(matches) > 1 && want == nil:
+		return nil, fmt.Errorf("blobstore.Layout.Image: %s: contains %d images; select one by name",
+			l.Path, len(matches))
+	}
+	img, err := index.Image(matches[0])
+	if err != nil {
+		return nil, fmt.Errorf("blobstore.Layout.Image: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,85 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// BlobMediaType is the media type that Registry pushes blobs as.
+const BlobMediaType types.MediaType = "application/vnd.datawire.ocibuild.cache.blob"
+
+// Registry is a Store that stores blobs in an OCI registry repository (like BuildKit's registry
+// cache).  Blobs are pushed without a manifest referencing them, so registries that
+// garbage-collect unreferenced blobs will eventually remove them; when it is used as a cache this
+// is harmless, it just means that they get downloaded again.
+type Registry struct {
+	Repository name.Repository
+	Options    []remote.Option
+}
+
+// NewRegistry returns a Registry for a repository name such as "ghcr.io/example/ocibuild-cache".
+// If no options are given, credentials are taken from authn.DefaultKeychain (the Docker config
+// file and credential helpers).
+func NewRegistry(repo string, opts ...remote.Option) (*Registry, error) {
+	repository, err := name.NewRepository(repo)
+	if err != nil {
+		return nil, fmt.Errorf("blobstore.NewRegistry: %w", err)
+	}
+	if len(opts) == 0 {
+		opts = []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)}
+	}
+	return &Registry{
+		Repository: repository,
+		Options:    opts,
+	}, nil
+}
+
+func (r *Registry) String() string {
+	return r.Repository.String()
+}
+
+// Get implements Store.
+func (r *Registry) Get(digest string) ([]byte, bool, error) {
+	if _, err := ParseDigest(digest); err != nil {
+		return nil, false, fmt.Errorf("blobstore.Registry.Get: %w", err)
+	}
+	layer, err := remote.Layer(r.Repository.Digest(digest), r.Options...)
+	if err != nil {
+		return nil, false, fmt.Errorf("blobstore.Registry.Get: %w", err)
+	}
+	body, err := layer.Compressed()
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("blobstore.Registry.Get: %s: %w", digest, err)
+	}
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, false, fmt.Errorf("blobstore.Registry.Get: %s: %w", digest, err)
+	}
+	if Digest(content) != digest {
+		return nil, false, fmt.Errorf("blobstore.Registry.Get: %s: registry returned content with digest %s",
+			digest, Digest(content))
+	}
+	return content, true, nil
+}
+
+// Put implements Store.  Blobs that the registry already has are not uploaded again.
+func (r *Registry) Put(digest string, content []byte) error {
+	if err := remote.WriteLayer(r.Repository, static.NewLayer(content, BlobMediaType), r.Options...); err != nil {
+		return fmt.Errorf("blobstore.Registry.Put: %s: %w", digest, err)
+	}
+	return nil
+}
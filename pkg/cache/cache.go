@@ -0,0 +1,270 @@
+// Package cache implements a local on-disk content-addressed store, used to avoid re-downloading
+// things (such as wheel files) between runs of ocibuild.
+//
+// Entries are keyed by their digest ("sha256:{hex}").  The store is safe for concurrent use by
+// multiple processes: writes are atomic renames, and a lockfile ensures that pruning does not
+// happen concurrently with reads or writes.
+//
+// Blobs are stored in a blobstore.Dir.  A store may be backed by a remote blobstore.Store (such as
+// a blobstore.Registry), so that machines that don't keep a local cache between runs (such as
+// ephemeral CI runners) can still share one.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/datawire/ocibuild/pkg/blobstore"
+)
+
+// Store is a cache directory.
+type Store struct {
+	Dir string
+	// Remote, if set, is consulted on a local miss, and is written through to by Put.
+	Remote blobstore.Store
+}
+
+// DefaultDir returns the default cache directory, which is "ocibuild" inside of the user's cache
+// directory (for example, "~/.cache/ocibuild" on Linux).
+func DefaultDir() (string, error) {
+	userDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cache.DefaultDir: %w", err)
+	}
+	return filepath.Join(userDir, "ocibuild"), nil
+}
+
+// Entry describes an item in the cache.
+type Entry struct {
+	Digest   string
+	Size     int64
+	LastUsed time.Time
+}
+
+// ErrInvalidDigest is returned when a digest string is malformed.
+var ErrInvalidDigest = blobstore.ErrInvalidDigest
+
+// Digest returns the digest that content would be stored under.
+func Digest(content []byte) string {
+	return blobstore.Digest(content)
+}
+
+func (s Store) blobs() blobstore.Dir {
+	return blobstore.Dir{Path: s.Dir}
+}
+
+func (s Store) blobDir() string {
+	return s.blobs().BlobDir()
+}
+
+// PartialDir returns the directory that partially-downloaded files are kept in so that they can
+// be resumed (see pep503.Client.PartialDir).  Prune removes partial downloads that haven't been
+// touched within its maxAge.
+func (s Store) PartialDir() string {
+	return filepath.Join(s.Dir, "partial")
+}
+
+func (s Store) withLock(exclusive bool, fn func() error) error {
+	if err := os.MkdirAll(s.blobDir(), 0o777); err != nil {
+		return err
+	}
+	lockFile, err := os.OpenFile(filepath.Join(s.Dir, "lock"), os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+	if err := lockFileHandle(lockFile, exclusive); err != nil {
+		return fmt.Errorf("lock %q: %w", lockFile.Name(), err)
+	}
+	return fn()
+}
+
+// Get returns the content stored for a digest, and marks the entry as recently used.  If there is
+// no such entry locally, then the Remote (if any) is consulted, and a hit there is stored locally.
+// If there is no such entry, it returns (nil, false, nil).
+func (s Store) Get(digest string) ([]byte, bool, error) {
+	content, ok, err := s.getLocal(digest)
+	if err != nil || ok || s.Remote == nil {
+		return content, ok, err
+	}
+	content, ok, err = s.Remote.Get(digest)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if _, err := s.putLocal(content); err != nil {
+		return content, true, err
+	}
+	return content, true, nil
+}
+
+func (s Store) getLocal(digest string) ([]byte, bool, error) {
+	filename, err := s.blobs().BlobPath(digest)
+	if err != nil {
+		return nil, false, fmt.Errorf("cache.Store.Get: %w", err)
+	}
+	var content []byte
+	var ok bool
+	err = s.withLock(false, func() error {
+		// A corrupt blob is a miss, and the next Put overwrites it.
+		var err error
+		content, ok, err = s.blobs().Get(digest)
+		if err != nil || !ok {
+			return err
+		}
+		now := time.Now()
+		return os.Chtimes(filename, now, now)
+	})
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("cache.Store.Get: %w", err)
+	}
+	return content, ok, nil
+}
+
+// Put stores content in the cache (and in the Remote, if any), returning its digest.  If storing
+// it in the Remote fails, then the digest is still returned along with the error.
+func (s Store) Put(content []byte) (string, error) {
+	digest, err := s.putLocal(content)
+	if err != nil || s.Remote == nil {
+		return digest, err
+	}
+	if err := s.Remote.Put(digest, content); err != nil {
+		return digest, fmt.Errorf("cache.Store.Put: %w", err)
+	}
+	return digest, nil
+}
+
+func (s Store) putLocal(content []byte) (string, error) {
+	digest := Digest(content)
+	err := s.withLock(false, func() error {
+		return s.blobs().Put(digest, content)
+	})
+	if err != nil {
+		return "", fmt.Errorf("cache.Store.Put: %w", err)
+	}
+	return digest, nil
+}
+
+func (s Store) list() ([]Entry, error) {
+	dirents, err := os.ReadDir(s.blobDir())
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Entry, 0, len(dirents))
+	for _, dirent := range dirents {
+		if _, err := blobstore.ParseDigest("sha256:" + dirent.Name()); err != nil {
+			// Skip temporary files and other junk.
+			continue
+		}
+		info, err := dirent.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		ret = append(ret, Entry{
+			Digest:   "sha256:" + dirent.Name(),
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+		})
+	}
+	// Most-recently-used first.
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].LastUsed.Equal(ret[j].LastUsed) {
+			return ret[i].LastUsed.After(ret[j].LastUsed)
+		}
+		return ret[i].Digest < ret[j].Digest
+	})
+	return ret, nil
+}
+
+// prunePartial removes the files in PartialDir that were last modified more than maxAge before
+// now.
+func (s Store) prunePartial(maxAge time.Duration, now time.Time) error {
+	dirents, err := os.ReadDir(s.PartialDir())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, dirent := range dirents {
+		info, err := dirent.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if now.Sub(info.ModTime()) <= maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.PartialDir(), dirent.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns all of the entries in the cache, most-recently-used first.
+func (s Store) List() ([]Entry, error) {
+	var ret []Entry
+	err := s.withLock(false, func() error {
+		var err error
+		ret, err = s.list()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cache.Store.List: %w", err)
+	}
+	return ret, nil
+}
+
+// Prune removes entries that were last used more than maxAge before now, and then removes
+// least-recently-used entries until the total size of the cache is at most maxSize.  Partial
+// downloads (see PartialDir) older than maxAge are removed too, but are not returned.  A maxAge or
+// maxSize of zero disables that limit.  It returns the entries that were removed.
+func (s Store) Prune(maxSize int64, maxAge time.Duration, now time.Time) ([]Entry, error) {
+	var removed []Entry
+	err := s.withLock(true, func() error {
+		entries, err := s.list()
+		if err != nil {
+			return err
+		}
+		var total int64
+		for _, entry := range entries {
+			total += entry.Size
+		}
+		// Walk from least-recently-used to most-recently-used.
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := entries[i]
+			tooOld := maxAge > 0 && now.Sub(entry.LastUsed) > maxAge
+			tooBig := maxSize > 0 && total > maxSize
+			if !tooOld && !tooBig {
+				continue
+			}
+			filename, _ := s.blobs().BlobPath(entry.Digest)
+			if err := os.Remove(filename); err != nil {
+				return err
+			}
+			total -= entry.Size
+			removed = append(removed, entry)
+		}
+		if maxAge > 0 {
+			return s.prunePartial(maxAge, now)
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("cache.Store.Prune: %w", err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,154 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/cache"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	store := cache.Store{Dir: t.TempDir(), Remote: nil}
+
+	// miss
+	content, ok, err := store.Get(cache.Digest([]byte("a")))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, content)
+
+	// invalid
+	_, _, err = store.Get("md5:abcd")
+	assert.ErrorIs(t, err, cache.ErrInvalidDigest)
+
+	// hit
+	digestA, err := store.Put([]byte("a"))
+	require.NoError(t, err)
+	content, ok, err = store.Get(digestA)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a"), content)
+
+	// corrupt
+	require.NoError(t, os.WriteFile(
+		filepath.Join(store.Dir, "blobs", "sha256", strings.TrimPrefix(digestA, "sha256:")),
+		[]byte("b"), 0o644))
+	_, ok, err = store.Get(digestA)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+	store := cache.Store{Dir: t.TempDir(), Remote: nil}
+	now := time.Now()
+
+	put := func(content string, age time.Duration) string {
+		digest, err := store.Put([]byte(content))
+		require.NoError(t, err)
+		filename := filepath.Join(store.Dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+		require.NoError(t, os.Chtimes(filename, now.Add(-age), now.Add(-age)))
+		return digest
+	}
+	digestOld := put("old", 48*time.Hour)
+	digestMid := put("middle", 2*time.Hour)
+	digestNew := put("newer", 1*time.Hour)
+
+	listDigests := func() []string {
+		entries, err := store.List()
+		require.NoError(t, err)
+		var ret []string
+		for _, entry := range entries {
+			ret = append(ret, entry.Digest)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{digestNew, digestMid, digestOld}, listDigests())
+
+	require.NoError(t, os.MkdirAll(store.PartialDir(), 0o777))
+	for name, age := range map[string]time.Duration{"old.part": 48 * time.Hour, "new.part": time.Hour} {
+		filename := filepath.Join(store.PartialDir(), name)
+		require.NoError(t, os.WriteFile(filename, []byte("partial"), 0o644))
+		require.NoError(t, os.Chtimes(filename, now.Add(-age), now.Add(-age)))
+	}
+
+	removed, err := store.Prune(0, 24*time.Hour, now)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, digestOld, removed[0].Digest)
+	assert.Equal(t, []string{digestNew, digestMid}, listDigests())
+	partials, err := os.ReadDir(store.PartialDir())
+	require.NoError(t, err)
+	require.Len(t, partials, 1)
+	assert.Equal(t, "new.part", partials[0].Name())
+
+	removed, err = store.Prune(int64(len("newer")), 0, now)
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, digestMid, removed[0].Digest)
+	assert.Equal(t, []string{digestNew}, listDigests())
+}
+
+func TestIndex(t *testing.T) {
+	t.Parallel()
+	store := cache.Store{Dir: t.TempDir(), Remote: nil}
+	const pypi = "https://pypi.org/simple/"
+
+	filenames, err := store.ListIndex(pypi)
+	assert.NoError(t, err)
+	assert.Empty(t, filenames)
+
+	require.NoError(t, store.PutIndex(pypi, "pip", []string{"pip-1.0-py3-none-any.whl"}))
+	require.NoError(t, store.PutIndex(pypi, "a-b", []string{"a_b-2.0-py3-none-any.whl", "a_b-1.0-py3-none-any.whl"}))
+	require.NoError(t, store.PutIndex("https://example.com/simple/", "c", []string{"c-1.0-py3-none-any.whl"}))
+	// Replaces the earlier list.
+	require.NoError(t, store.PutIndex(pypi, "pip", []string{"pip-2.0-py3-none-any.whl"}))
+
+	filenames, err = store.ListIndex(pypi)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"a_b-1.0-py3-none-any.whl",
+		"a_b-2.0-py3-none-any.whl",
+		"pip-2.0-py3-none-any.whl",
+	}, filenames)
+}
+
+func TestByKey(t *testing.T) {
+	t.Parallel()
+	store := cache.Store{Dir: t.TempDir(), Remote: nil}
+
+	// miss
+	content, ok, err := store.GetByKey("a")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, content)
+
+	// hit
+	require.NoError(t, store.PutByKey("a", []byte("content-a")))
+	require.NoError(t, store.PutByKey("b", []byte("content-b")))
+	content, ok, err = store.GetByKey("a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("content-a"), content)
+
+	// replace
+	require.NoError(t, store.PutByKey("a", []byte("content-a2")))
+	content, ok, err = store.GetByKey("a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("content-a2"), content)
+
+	// the content was pruned
+	_, err = store.Prune(1, 0, time.Now())
+	require.NoError(t, err)
+	content, ok, err = store.GetByKey("b")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, content)
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s Store) indexDir(indexURL string) string {
+	return filepath.Join(s.Dir, "index", hashKey(indexURL))
+}
+
+// PutIndex records the list of filenames that the package index at indexURL has for the package
+// pkgname, replacing any list previously recorded for that package.  This allows things such as
+// shell completion to know what files exist without going to the network.
+func (s Store) PutIndex(indexURL, pkgname string, filenames []string) error {
+	dir := s.indexDir(indexURL)
+	err := s.withLock(false, func() error {
+		if err := os.MkdirAll(dir, 0o777); err != nil {
+			return err
+		}
+		tmpFile, err := os.CreateTemp(dir, ".tmp-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.Remove(tmpFile.Name())
+		}()
+		for _, filename := range filenames {
+			if _, err := fmt.Fprintln(tmpFile, filename); err != nil {
+				_ = tmpFile.Close()
+				return err
+			}
+		}
+		if err := tmpFile.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmpFile.Name(), filepath.Join(dir, hashKey(pkgname)))
+	})
+	if err != nil {
+		return fmt.Errorf("cache.Store.PutIndex: %w", err)
+	}
+	return nil
+}
+
+// ListIndex returns all of the filenames recorded by PutIndex for any package at indexURL, in
+// sorted order.
+func (s Store) ListIndex(indexURL string) ([]string, error) {
+	dir := s.indexDir(indexURL)
+	var ret []string
+	err := s.withLock(false, func() error {
+		dirents, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		for _, dirent := range dirents {
+			if strings.HasPrefix(dirent.Name(), ".") {
+				// Skip temporary files.
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(dir, dirent.Name()))
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return err
+			}
+			for _, line := range strings.Split(string(content), "\n") {
+				if line != "" {
+					ret = append(ret, line)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cache.Store.ListIndex: %w", err)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/datawire/ocibuild/pkg/blobstore"
+)
+
+func (s Store) keyDir() string {
+	return filepath.Join(s.Dir, "keys")
+}
+
+// PutByKey stores content in the cache (as Put does), and records that it is the content for an
+// arbitrary key; this allows caching things that are addressed by their inputs rather than by
+// their own content (such as the output of a compiler).  Keyed entries are only recorded locally,
+// not in the Remote.
+func (s Store) PutByKey(key string, content []byte) error {
+	digest, err := s.Put(content)
+	if err != nil && digest == "" {
+		return fmt.Errorf("cache.Store.PutByKey: %w", err)
+	}
+	err = s.withLock(false, func() error {
+		if err := os.MkdirAll(s.keyDir(), 0o777); err != nil {
+			return err
+		}
+		tmpFile, err := os.CreateTemp(s.keyDir(), ".tmp-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.Remove(tmpFile.Name())
+		}()
+		if _, err := fmt.Fprintln(tmpFile, digest); err != nil {
+			_ = tmpFile.Close()
+			return err
+		}
+		if err := tmpFile.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmpFile.Name(), filepath.Join(s.keyDir(), hashKey(key)))
+	})
+	if err != nil {
+		return fmt.Errorf("cache.Store.PutByKey: %w", err)
+	}
+	return nil
+}
+
+// GetByKey returns the content recorded for key by PutByKey.  If there is no such entry (or if the
+// content has since been pruned), it returns (nil, false, nil).
+func (s Store) GetByKey(key string) ([]byte, bool, error) {
+	var digest string
+	err := s.withLock(false, func() error {
+		content, err := os.ReadFile(filepath.Join(s.keyDir(), hashKey(key)))
+		if err != nil {
+			return err
+		}
+		digest = strings.TrimSpace(string(content))
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("cache.Store.GetByKey: %w", err)
+	}
+	if _, err := blobstore.ParseDigest(digest); err != nil {
+		// Corrupt; treat it as a miss, and let the next PutByKey overwrite it.
+		return nil, false, nil
+	}
+	content, ok, err := s.Get(digest)
+	if err != nil {
+		return nil, false, fmt.Errorf("cache.Store.GetByKey: %w", err)
+	}
+	return content, ok, nil
+}
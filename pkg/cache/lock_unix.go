@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package cache
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFileHandle acquires an advisory lock on the file, which is released when the file is closed.
+func lockFileHandle(file *os.File, exclusive bool) error {
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+	for {
+		err := unix.Flock(int(file.Fd()), how)
+		if err != unix.EINTR { //nolint:errorlint // unix.Flock returns bare errnos
+			return err
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cache_test
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/blobstore"
+	"github.com/datawire/ocibuild/pkg/cache"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	remoteStore, err := blobstore.NewRegistry(strings.TrimPrefix(server.URL, "http://")+"/ocibuild-cache",
+		remote.WithTransport(server.Client().Transport))
+	require.NoError(t, err)
+
+	// Two machines that share a registry, but not a cache directory.
+	storeA := cache.Store{Dir: t.TempDir(), Remote: remoteStore}
+	storeB := cache.Store{Dir: t.TempDir(), Remote: remoteStore}
+
+	// miss
+	content, ok, err := storeB.Get(cache.Digest([]byte("a")))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, content)
+
+	// write-through
+	digestA, err := storeA.Put([]byte("a"))
+	require.NoError(t, err)
+
+	// remote hit
+	content, ok, err = storeB.Get(digestA)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a"), content)
+
+	// ... which is now stored locally
+	entries, err := storeB.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, digestA, entries[0].Digest)
+	local := cache.Store{Dir: storeB.Dir, Remote: nil}
+	_, ok, err = local.Get(digestA)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,61 @@
+package cliutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// ByteSize is a pflag.Value for a number of bytes, accepting either a plain integer, or an integer
+// followed by a decimal ("k", "M", "G", "T") or binary ("Ki", "Mi", "Gi", "Ti") suffix.
+type ByteSize int64
+
+var _ pflag.Value = (*ByteSize)(nil)
+
+//nolint:gochecknoglobals // Would be 'const'.
+var byteSizeSuffixes = []struct {
+	Suffix string
+	Mult   int64
+}{
+	// Check the 2-character suffixes first.
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"k", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+}
+
+// String implements pflag.Value.
+func (s ByteSize) String() string {
+	return strconv.FormatInt(int64(s), 10)
+}
+
+// Set implements pflag.Value.
+func (s *ByteSize) Set(str string) error {
+	numStr, mult := str, int64(1)
+	for _, suffix := range byteSizeSuffixes {
+		if strings.HasSuffix(str, suffix.Suffix) {
+			numStr, mult = strings.TrimSuffix(str, suffix.Suffix), suffix.Mult
+			break
+		}
+	}
+	num, err := strconv.ParseInt(numStr, 10, 64)
+	if err != nil || num < 0 {
+		return fmt.Errorf("invalid size: %q", str)
+	}
+	if num > (1<<63-1)/mult {
+		return fmt.Errorf("size is too large: %q", str)
+	}
+	*s = ByteSize(num * mult)
+	return nil
+}
+
+// Type implements pflag.Value.
+func (ByteSize) Type() string {
+	return "bytes"
+}
@@ -0,0 +1,42 @@
+package cliutil_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+)
+
+func TestByteSize(t *testing.T) {
+	t.Parallel()
+	type testcase struct {
+		Input     string
+		OutputVal int64
+		OutputErr string
+	}
+	testcases := map[string]testcase{
+		"plain":    {"1234", 1234, ""},
+		"decimal":  {"500M", 500_000_000, ""},
+		"binary":   {"500Mi", 500 << 20, ""},
+		"kilo":     {"2k", 2000, ""},
+		"empty":    {"", 0, `invalid size: ""`},
+		"negative": {"-1Ki", 0, `invalid size: "-1Ki"`},
+		"bad-unit": {"1Xi", 0, `invalid size: "1Xi"`},
+		"overflow": {"9000000Ti", 0, `size is too large: "9000000Ti"`},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			var size cliutil.ByteSize
+			err := size.Set(tc.Input)
+			if tc.OutputErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.OutputErr)
+			}
+			assert.Equal(t, tc.OutputVal, int64(size))
+		})
+	}
+}
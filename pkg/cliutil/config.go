@@ -0,0 +1,189 @@
+package cliutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/datawire/ocibuild/pkg/httpconfig"
+)
+
+// ConfigFileEnv is the environment variable that may be set to override the location of the config
+// file.
+const ConfigFileEnv = "OCIBUILD_CONFIG"
+
+// Config is the set of user defaults that may be set in the config file or in environment
+// variables.  Each field (other than TLSHosts, which isn't a flag) provides the default for the
+// command-line flag of the same name, on whichever subcommands have that flag.
+type Config struct {
+	// IndexServer is the default for --index-server; environment variable
+	// OCIBUILD_INDEX_SERVER.
+	IndexServer string `json:"indexServer,omitempty"`
+	// CacheDir is the default for --cache-dir; environment variable OCIBUILD_CACHE_DIR.
+	CacheDir string `json:"cacheDir,omitempty"`
+	// CacheRegistry is the default for --cache-registry; environment variable
+	// OCIBUILD_CACHE_REGISTRY.
+	CacheRegistry string `json:"cacheRegistry,omitempty"`
+	// PlatformFile is the default for --platform-file; environment variable
+	// OCIBUILD_PLATFORM_FILE.
+	PlatformFile string `json:"platformFile,omitempty"`
+	// IndexTokenCommand is the default for --index-token-command; environment variable
+	// OCIBUILD_INDEX_TOKEN_COMMAND.
+	IndexTokenCommand string `json:"indexTokenCommand,omitempty"`
+	// IndexUsername is the default for --index-username; environment variable
+	// OCIBUILD_INDEX_USERNAME.
+	IndexUsername string `json:"indexUsername,omitempty"`
+	// CredsHelper is the default for --creds-helper; environment variable
+	// OCIBUILD_CREDS_HELPER.
+	CredsHelper string `json:"credsHelper,omitempty"`
+	// Proxy is the default for --proxy; environment variable OCIBUILD_PROXY.
+	Proxy string `json:"proxy,omitempty"`
+	// NoProxy is the default for --no-proxy; environment variable OCIBUILD_NO_PROXY.
+	NoProxy string `json:"noProxy,omitempty"`
+	// CACert is the default for --ca-cert; environment variable OCIBUILD_CA_CERT.
+	CACert string `json:"caCert,omitempty"`
+	// ClientCert is the default for --client-cert; environment variable OCIBUILD_CLIENT_CERT.
+	ClientCert string `json:"clientCert,omitempty"`
+	// ClientKey is the default for --client-key; environment variable OCIBUILD_CLIENT_KEY.
+	ClientKey string `json:"clientKey,omitempty"`
+	// TLSHosts is per-host TLS settings, keyed by "HOST" or "HOST:PORT"; --tls-host flags add to
+	// it.  There is no environment variable for it.
+	TLSHosts map[string]httpconfig.TLS `json:"tlsHosts,omitempty"`
+}
+
+type configSetting struct {
+	Flag  string
+	Env   string
+	Field func(*Config) *string
+}
+
+//nolint:gochecknoglobals // Would be 'const'.
+var configSettings = []configSetting{
+	{"index-server", "OCIBUILD_INDEX_SERVER", func(c *Config) *string { return &c.IndexServer }},
+	{"cache-dir", "OCIBUILD_CACHE_DIR", func(c *Config) *string { return &c.CacheDir }},
+	{"cache-registry", "OCIBUILD_CACHE_REGISTRY", func(c *Config) *string { return &c.CacheRegistry }},
+	{"platform-file", "OCIBUILD_PLATFORM_FILE", func(c *Config) *string { return &c.PlatformFile }},
+	{"index-token-command", "OCIBUILD_INDEX_TOKEN_COMMAND", func(c *Config) *string { return &c.IndexTokenCommand }},
+	{"index-username", "OCIBUILD_INDEX_USERNAME", func(c *Config) *string { return &c.IndexUsername }},
+	{"creds-helper", "OCIBUILD_CREDS_HELPER", func(c *Config) *string { return &c.CredsHelper }},
+	{"proxy", "OCIBUILD_PROXY", func(c *Config) *string { return &c.Proxy }},
+	{"no-proxy", "OCIBUILD_NO_PROXY", func(c *Config) *string { return &c.NoProxy }},
+	{"ca-cert", "OCIBUILD_CA_CERT", func(c *Config) *string { return &c.CACert }},
+	{"client-cert", "OCIBUILD_CLIENT_CERT", func(c *Config) *string { return &c.ClientCert }},
+	{"client-key", "OCIBUILD_CLIENT_KEY", func(c *Config) *string { return &c.ClientKey }},
+}
+
+// ConfigHelp is a paragraph describing the config file and environment variables, suitable for
+// including in a command's long description.
+const ConfigHelp = "" +
+	"Defaults for some flags may be set in a config file and in environment variables.  The " +
+	"config file is ${XDG_CONFIG_HOME:-~/.config}/ocibuild/config.yaml (or the file named by " +
+	"$" + ConfigFileEnv + "), and may set 'indexServer', 'cacheDir', 'cacheRegistry', " +
+	"'platformFile', 'indexTokenCommand', 'indexUsername', 'credsHelper', 'proxy', 'noProxy', " +
+	"'caCert', 'clientCert', and 'clientKey'; the corresponding environment variables are " +
+	"OCIBUILD_INDEX_SERVER, OCIBUILD_CACHE_DIR, OCIBUILD_CACHE_REGISTRY, " +
+	"OCIBUILD_PLATFORM_FILE, OCIBUILD_INDEX_TOKEN_COMMAND, OCIBUILD_INDEX_USERNAME, " +
+	"OCIBUILD_CREDS_HELPER, OCIBUILD_PROXY, OCIBUILD_NO_PROXY, OCIBUILD_CA_CERT, " +
+	"OCIBUILD_CLIENT_CERT, and OCIBUILD_CLIENT_KEY.  In order of precedence, a setting is taken " +
+	"from the command-line flag, then the environment variable, then the config file, then the " +
+	"built-in default.  The config file may also set 'tlsHosts', a map from \"HOST\" or " +
+	"\"HOST:PORT\" to per-host {'caCert', 'clientCert', 'clientKey'} settings, which --tls-host " +
+	"flags add to."
+
+// DefaultConfigFile returns the default location of the config file, which is
+// "ocibuild/config.yaml" inside of the user's config directory (see os.UserConfigDir).
+func DefaultConfigFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cliutil.DefaultConfigFile: %w", err)
+	}
+	return filepath.Join(dir, "ocibuild", "config.yaml"), nil
+}
+
+// LoadConfigFile reads a YAML config file.  If the file does not exist, then an empty Config is
+// returned (this is not an error).
+func LoadConfigFile(filename string) (Config, error) {
+	var cfg Config
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("cliutil.LoadConfigFile: %w", err)
+	}
+	if err := yaml.Unmarshal(bs, &cfg, yaml.DisallowUnknownFields); err != nil {
+		return cfg, fmt.Errorf("cliutil.LoadConfigFile: %q: %w", filename, err)
+	}
+	return cfg, nil
+}
+
+// ApplyEnv overrides settings in cfg with any of the corresponding environment variables that are
+// set to a non-empty value.  getenv is usually os.Getenv.
+func (cfg *Config) ApplyEnv(getenv func(string) string) {
+	for _, setting := range configSettings {
+		if val := getenv(setting.Env); val != "" {
+			*setting.Field(cfg) = val
+		}
+	}
+}
+
+// LoadConfig loads the config file (from $OCIBUILD_CONFIG or DefaultConfigFile), and then applies
+// the environment variables to it.
+func LoadConfig() (Config, error) {
+	filename := os.Getenv(ConfigFileEnv)
+	if filename == "" {
+		var err error
+		filename, err = DefaultConfigFile()
+		if err != nil {
+			// No config directory (for example, $HOME isn't set); just use the
+			// environment.
+			var cfg Config
+			cfg.ApplyEnv(os.Getenv)
+			return cfg, nil
+		}
+	}
+	cfg, err := LoadConfigFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ApplyEnv(os.Getenv)
+	return cfg, nil
+}
+
+// ApplyConfig sets the defaults of the flags on cmd and all of its subcommands based on cfg.  It
+// must be called before the command line is parsed, so that flags given on the command line take
+// precedence.  A required flag that is given a default by cfg is no longer required.
+func ApplyConfig(cmd *cobra.Command, cfg Config) error {
+	for _, setting := range configSettings {
+		val := *setting.Field(&cfg)
+		if val == "" {
+			continue
+		}
+		flag := cmd.Flags().Lookup(setting.Flag)
+		if flag == nil {
+			// Persistent flags (such as the global flags on the root command) aren't
+			// merged in to cmd.Flags() until the command line is parsed.
+			flag = cmd.PersistentFlags().Lookup(setting.Flag)
+		}
+		if flag == nil {
+			continue
+		}
+		if err := flag.Value.Set(val); err != nil {
+			return fmt.Errorf("%s: invalid %s config value %q: %w",
+				cmd.CommandPath(), setting.Flag, val, err)
+		}
+		flag.DefValue = val
+		delete(flag.Annotations, cobra.BashCompOneRequiredFlag)
+	}
+	for _, subcmd := range cmd.Commands() {
+		if err := ApplyConfig(subcmd, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
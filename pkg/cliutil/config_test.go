@@ -0,0 +1,110 @@
+package cliutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/cliutil"
+	"github.com/datawire/ocibuild/pkg/httpconfig"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	cfg, err := cliutil.LoadConfigFile(filepath.Join(dir, "missing.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, cliutil.Config{}, cfg) //nolint:exhaustivestruct
+
+	filename := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(""+
+		"indexServer: https://example.com/simple/\n"+
+		"cacheDir: /var/cache/ocibuild\n"), 0o644))
+	cfg, err = cliutil.LoadConfigFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, cliutil.Config{ //nolint:exhaustivestruct
+		IndexServer: "https://example.com/simple/",
+		CacheDir:    "/var/cache/ocibuild",
+	}, cfg)
+
+	// The environment overrides the file.
+	cfg.ApplyEnv(func(key string) string {
+		return map[string]string{
+			"OCIBUILD_CACHE_DIR":     "/tmp/cache",
+			"OCIBUILD_PLATFORM_FILE": "plat.yml",
+		}[key]
+	})
+	assert.Equal(t, cliutil.Config{ //nolint:exhaustivestruct
+		IndexServer:  "https://example.com/simple/",
+		CacheDir:     "/tmp/cache",
+		PlatformFile: "plat.yml",
+	}, cfg)
+
+	require.NoError(t, os.WriteFile(filename, []byte(""+
+		"caCert: /etc/ssl/corp.pem\n"+
+		"tlsHosts:\n"+
+		"  registry.example.com:5000:\n"+
+		"    clientCert: client.pem\n"+
+		"    clientKey: client.key\n"), 0o644))
+	cfg, err = cliutil.LoadConfigFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, cliutil.Config{ //nolint:exhaustivestruct
+		CACert: "/etc/ssl/corp.pem",
+		TLSHosts: map[string]httpconfig.TLS{
+			"registry.example.com:5000": { //nolint:exhaustivestruct
+				ClientCert: "client.pem",
+				ClientKey:  "client.key",
+			},
+		},
+	}, cfg)
+
+	require.NoError(t, os.WriteFile(filename, []byte("indexURL: typo\n"), 0o644))
+	_, err = cliutil.LoadConfigFile(filename)
+	assert.Error(t, err)
+}
+
+func TestApplyConfig(t *testing.T) {
+	t.Parallel()
+	newCmd := func() (*cobra.Command, *string, *string, *string) {
+		var indexServer, platFile, cacheRegistry string
+		root := &cobra.Command{Use: "root"} //nolint:exhaustivestruct
+		root.PersistentFlags().StringVar(&cacheRegistry, "cache-registry", "", "")
+
+		sub := &cobra.Command{ //nolint:exhaustivestruct
+			Use:  "sub",
+			RunE: func(*cobra.Command, []string) error { return nil },
+		}
+		sub.Flags().StringVar(&indexServer, "index-server", "https://pypi.org/simple/", "")
+		sub.Flags().StringVar(&platFile, "platform-file", "", "")
+		require.NoError(t, sub.MarkFlagRequired("platform-file"))
+		root.AddCommand(sub)
+		return root, &indexServer, &platFile, &cacheRegistry
+	}
+	cfg := cliutil.Config{ //nolint:exhaustivestruct
+		IndexServer:   "https://example.com/simple/",
+		PlatformFile:  "plat.yml",
+		CacheRegistry: "ghcr.io/example/cache",
+	}
+
+	// The config supplies defaults, and satisfies required flags.
+	root, indexServer, platFile, cacheRegistry := newCmd()
+	require.NoError(t, cliutil.ApplyConfig(root, cfg))
+	root.SetArgs([]string{"sub"})
+	require.NoError(t, root.Execute())
+	assert.Equal(t, "https://example.com/simple/", *indexServer)
+	assert.Equal(t, "plat.yml", *platFile)
+	assert.Equal(t, "ghcr.io/example/cache", *cacheRegistry)
+
+	// Flags on the command line take precedence.
+	root, indexServer, platFile, _ = newCmd()
+	require.NoError(t, cliutil.ApplyConfig(root, cfg))
+	root.SetArgs([]string{"sub", "--index-server=https://other.example.com/", "--platform-file=x.yml"})
+	require.NoError(t, root.Execute())
+	assert.Equal(t, "https://other.example.com/", *indexServer)
+	assert.Equal(t, "x.yml", *platFile)
+}
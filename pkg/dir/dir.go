@@ -1,9 +1,10 @@
-// Package dir deals with creating a layer from a directory.
+// Package dir deals with creating a layer from a directory, and with extracting a layer to one.
 package dir
 
 import (
 	"archive/tar"
 	"bytes"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -13,6 +14,9 @@ import (
 
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
 	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/tarnorm"
 )
 
 type Prefix struct {
@@ -31,12 +35,41 @@ type Ownership struct {
 	GName string
 }
 
+// preservedXattrs is the list of extended attributes that LayerFromDir copies from files in to
+// the layer.  Like Docker, this is limited to file capabilities; other attributes (such as SELinux
+// labels) are specific to the build host, and shouldn't end up in the image.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var preservedXattrs = []string{
+	"security.capability",
+}
+
+// LayerFromDir creates a layer from the contents of a directory, with the headers normalized with
+// tarnorm.Lax.  Character devices, block devices, and FIFOs in the directory are preserved; use
+// LayerFromDirWithSpecialFiles to strip or reject them instead.
+//
+// Because of the normalization, directory entries (including the parents created for the prefix)
+// are named with a trailing "/".  This is a deliberate break in reproducibility: older versions
+// named them without it, so the same directory now produces a layer with a different digest.
 func LayerFromDir(
 	dirname string,
 	prefix *Prefix,
 	chown *Ownership,
 	clampTime time.Time,
 	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, error) {
+	return LayerFromDirWithSpecialFiles(dirname, prefix, chown, clampTime, fsutil.SpecialFilesPreserve, opts...)
+}
+
+// LayerFromDirWithSpecialFiles is like LayerFromDir, but character devices, block devices, and
+// FIFOs in the directory are handled according to the special policy.
+func LayerFromDirWithSpecialFiles(
+	dirname string,
+	prefix *Prefix,
+	chown *Ownership,
+	clampTime time.Time,
+	special fsutil.SpecialFilePolicy,
+	opts ...ociv1tarball.LayerOption,
 ) (ociv1.Layer, error) {
 	type logEntry struct {
 		Name string
@@ -58,7 +91,7 @@ func LayerFromDir(
 		}
 		for i := len(dirs) - 1; i >= 0; i-- {
 			if err := tarWriter.WriteHeader(&tar.Header{
-				Name:     dirs[i],
+				Name:     dirs[i] + "/",
 				Typeflag: tar.TypeDir,
 				ModTime:  clampTime,
 
@@ -88,18 +121,26 @@ func LayerFromDir(
 		if prefix != nil {
 			name = path.Join(prefix.DirName, name)
 		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if err := tarnorm.Header(header, tarnorm.Lax); err != nil {
+			return fmt.Errorf("dir.LayerFromDirWithSpecialFiles: %w", err)
+		}
+		if keep, err := special.Check(header); err != nil {
+			return fmt.Errorf("dir.LayerFromDirWithSpecialFiles: %w", err)
+		} else if !keep {
+			return nil
+		}
+
 		defer func() {
 			log = append(log, logEntry{
 				Name: name,
 				Info: info,
 			})
 		}()
-
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return err
-		}
-		header.Name = name
 		for _, entry := range log {
 			if os.SameFile(entry.Info, info) {
 				header.Typeflag = tar.TypeLink
@@ -113,6 +154,11 @@ func LayerFromDir(
 				return err
 			}
 		}
+		xattrs, err := readXattrs(filename)
+		if err != nil {
+			return err
+		}
+		fsutil.SetXattrs(header, xattrs)
 		if header.ModTime.After(clampTime) {
 			header.ModTime = clampTime
 		}
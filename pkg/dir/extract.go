@@ -0,0 +1,307 @@
+package dir
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/tarnorm"
+)
+
+// Metadata records everything about a layer's entries other than the file contents, so that the
+// parts of a layer that can't be represented in an extracted directory (ownership, extended
+// attributes, whiteouts, and device nodes) aren't lost.  The entries are in the order that they
+// appear in the layer.
+type Metadata struct {
+	Entries []MetadataEntry `json:"entries"`
+}
+
+// A MetadataEntry is the tar header of a single layer entry.
+type MetadataEntry struct {
+	Name string `json:"name"`
+	// Type is one of "file", "dir", "symlink", "hardlink", "char", "block", or "fifo".
+	Type     string            `json:"type"`
+	Linkname string            `json:"linkname,omitempty"`
+	Mode     int64             `json:"mode"`
+	UID      int               `json:"uid"`
+	GID      int               `json:"gid"`
+	UName    string            `json:"uname,omitempty"`
+	GName    string            `json:"gname,omitempty"`
+	ModTime  time.Time         `json:"mtime"`
+	Devmajor int64             `json:"devmajor,omitempty"`
+	Devminor int64             `json:"devminor,omitempty"`
+	Xattrs   map[string]string `json:"xattrs,omitempty"`
+}
+
+//nolint:gochecknoglobals // Would be 'const'.
+var metadataTypes = map[byte]string{
+	tar.TypeReg:     "file",
+	tar.TypeDir:     "dir",
+	tar.TypeSymlink: "symlink",
+	tar.TypeLink:    "hardlink",
+	tar.TypeChar:    "char",
+	tar.TypeBlock:   "block",
+	tar.TypeFifo:    "fifo",
+}
+
+func newMetadataEntry(header *tar.Header) (MetadataEntry, error) {
+	typ, ok := metadataTypes[header.Typeflag]
+	if !ok {
+		return MetadataEntry{}, //nolint:exhaustivestruct // zero value
+			fmt.Errorf("%q: unsupported tar entry type %q", header.Name, header.Typeflag)
+	}
+	return MetadataEntry{
+		Name:     strings.TrimSuffix(header.Name, "/"),
+		Type:     typ,
+		Linkname: header.Linkname,
+		Mode:     header.Mode,
+		UID:      header.Uid,
+		GID:      header.Gid,
+		UName:    header.Uname,
+		GName:    header.Gname,
+		ModTime:  header.ModTime,
+		Devmajor: header.Devmajor,
+		Devminor: header.Devminor,
+		Xattrs:   fsutil.Xattrs(header),
+	}, nil
+}
+
+// Header returns the tar header that the entry records; the Size is left zero.
+func (e MetadataEntry) Header() (*tar.Header, error) {
+	var typeflag byte
+	for flag, typ := range metadataTypes {
+		if typ == e.Type {
+			typeflag = flag
+		}
+	}
+	if typeflag == 0 {
+		return nil, fmt.Errorf("%q: invalid type %q", e.Name, e.Type)
+	}
+	header := &tar.Header{ //nolint:exhaustivestruct // partial
+		Typeflag: typeflag,
+		Name:     e.Name,
+		Linkname: e.Linkname,
+		Mode:     e.Mode,
+		Uid:      e.UID,
+		Gid:      e.GID,
+		Uname:    e.UName,
+		Gname:    e.GName,
+		ModTime:  e.ModTime,
+		Devmajor: e.Devmajor,
+		Devminor: e.Devminor,
+	}
+	fsutil.SetXattrs(header, e.Xattrs)
+	if err := tarnorm.Header(header, tarnorm.Lax); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// MetadataOnly returns whether the entry is only recorded in the Metadata, and not extracted to
+// disk: whiteouts and device nodes.
+func (e MetadataEntry) MetadataOnly() bool {
+	switch e.Type {
+	case "char", "block", "fifo":
+		return true
+	default:
+		return strings.HasPrefix(path.Base(e.Name), ".wh.")
+	}
+}
+
+// ExtractLayer writes the contents of a layer to the directory dest (see fsutil.WriteToDir), and
+// returns the Metadata of all of the layer's entries.  The extracted files are owned by the
+// current user, and entries that are MetadataOnly are not extracted.  A root directory entry ("./")
+// is ignored.  It checks ctx between files, and returns early if ctx is canceled.
+func ExtractLayer(ctx context.Context, layer ociv1.Layer, dest string) (*Metadata, error) {
+	layerReader, err := layer.Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("dir.ExtractLayer: %w", err)
+	}
+	defer func() {
+		_ = layerReader.Close()
+	}()
+
+	metadata := &Metadata{Entries: nil}
+	var files []fsutil.FileReference
+	tarReader := tar.NewReader(layerReader)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		header, err := tarReader.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("dir.ExtractLayer: %w", err)
+		}
+		if path.Clean(header.Name) == "." {
+			continue
+		}
+		if err := tarnorm.Header(header, tarnorm.Lax); err != nil {
+			return nil, fmt.Errorf("dir.ExtractLayer: %w", err)
+		}
+		entry, err := newMetadataEntry(header)
+		if err != nil {
+			return nil, fmt.Errorf("dir.ExtractLayer: %w", err)
+		}
+		metadata.Entries = append(metadata.Entries, entry)
+		if entry.MetadataOnly() {
+			continue
+		}
+		var content []byte
+		if header.Typeflag == tar.TypeReg {
+			// #nosec G110 -- the layer is already in memory or on disk, so it isn't a
+			// decompression bomb that we wouldn't already be subject to
+			content, err = io.ReadAll(tarReader)
+			if err != nil {
+				return nil, fmt.Errorf("dir.ExtractLayer: %w", err)
+			}
+		}
+		header.Name = entry.Name
+		files = append(files, &fsutil.InMemFileReference{
+			FileInfo:  header.FileInfo(),
+			MFullName: entry.Name,
+			MContent:  content,
+		})
+	}
+
+	if err := fsutil.WriteToDir(ctx, dest, files, false); err != nil {
+		return nil, fmt.Errorf("dir.ExtractLayer: %w", err)
+	}
+	return metadata, nil
+}
+
+// LayerFromExtracted is the inverse of ExtractLayer: it creates a layer from a directory that
+// ExtractLayer wrote, and the Metadata that it returned.  The directory may have been modified in
+// the mean time: the directory says which files exist and what their content and symlink targets
+// are, and the metadata says everything else.  Files that are in the metadata but have since been
+// removed from the directory are omitted (MetadataOnly entries are always included), and files
+// that have since been added to the directory are included as if they were in a layer made by
+// LayerFromDir with chown set to root, with their timestamps clamped to clampTime.
+func LayerFromExtracted(
+	dirname string,
+	metadata *Metadata,
+	clampTime time.Time,
+	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, error) {
+	var byteWriter bytes.Buffer
+	tarWriter := tar.NewWriter(&byteWriter)
+
+	seen := make(map[string]struct{}, len(metadata.Entries))
+	for _, entry := range metadata.Entries {
+		header, err := entry.Header()
+		if err != nil {
+			return nil, fmt.Errorf("dir.LayerFromExtracted: %w", err)
+		}
+		seen[entry.Name] = struct{}{}
+		filename := filepath.Join(dirname, filepath.FromSlash(entry.Name))
+		var content []byte
+		if !entry.MetadataOnly() {
+			info, err := os.Lstat(filename)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return nil, fmt.Errorf("dir.LayerFromExtracted: %w", err)
+			}
+			switch header.Typeflag {
+			case tar.TypeReg:
+				if !info.Mode().IsRegular() {
+					return nil, fmt.Errorf("dir.LayerFromExtracted: %q is no longer a regular file", entry.Name)
+				}
+				if content, err = os.ReadFile(filename); err != nil {
+					return nil, fmt.Errorf("dir.LayerFromExtracted: %w", err)
+				}
+			case tar.TypeSymlink:
+				if header.Linkname, err = os.Readlink(filename); err != nil {
+					return nil, fmt.Errorf("dir.LayerFromExtracted: %w", err)
+				}
+			case tar.TypeDir:
+				if !info.IsDir() {
+					return nil, fmt.Errorf("dir.LayerFromExtracted: %q is no longer a directory", entry.Name)
+				}
+			}
+		}
+		header.Size = int64(len(content))
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	err := filepath.Walk(dirname, func(filename string, info fs.FileInfo, e error) error {
+		if e != nil {
+			return e
+		}
+		name, err := filepath.Rel(dirname, filename)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if _, ok := seen[name]; ok || name == "." {
+			return nil
+		}
+		var linkname string
+		if info.Mode().Type() == fs.ModeSymlink {
+			if linkname, err = os.Readlink(filename); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, linkname)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Uid, header.Uname = 0, "root"
+		header.Gid, header.Gname = 0, "root"
+		if err := tarnorm.Header(header, tarnorm.Lax); err != nil {
+			return fmt.Errorf("dir.LayerFromExtracted: %w", err)
+		}
+		if header.ModTime.After(clampTime) {
+			header.ModTime = clampTime
+		}
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			if _, err := tarWriter.Write(content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	byteSlice := byteWriter.Bytes()
+	return ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(byteSlice)), nil
+	}, opts...)
+}
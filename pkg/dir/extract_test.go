@@ -0,0 +1,105 @@
+package dir_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/dir"
+	"github.com/datawire/ocibuild/pkg/testutil"
+)
+
+type testEntry struct {
+	Header  tar.Header
+	Content string
+}
+
+func makeLayer(t *testing.T, entries []testEntry) ociv1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		entry.Header.Size = int64(len(entry.Content))
+		require.NoError(t, tarWriter.WriteHeader(&entry.Header))
+		_, err := io.WriteString(tarWriter, entry.Content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func TestExtractRoundTrip(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	//nolint:exhaustivestruct // partial
+	entries := []testEntry{
+		{Header: tar.Header{Typeflag: tar.TypeDir, Name: "usr/", Mode: 0o755, ModTime: mtime}},
+		{Header: tar.Header{Typeflag: tar.TypeDir, Name: "usr/bin/", Mode: 0o755, ModTime: mtime,
+			Uid: 1000, Gid: 1000, Uname: "app", Gname: "app"}},
+		{Header: tar.Header{Typeflag: tar.TypeReg, Name: "usr/bin/ping", Mode: 0o4755, ModTime: mtime,
+			PAXRecords: map[string]string{"SCHILY.xattr.security.capability": "\x01\x00\x00\x02"}},
+			Content: "#!/bin/sh\n"},
+		{Header: tar.Header{Typeflag: tar.TypeLink, Name: "usr/bin/ping6", Linkname: "usr/bin/ping",
+			ModTime: mtime}},
+		{Header: tar.Header{Typeflag: tar.TypeSymlink, Name: "usr/bin/pong", Linkname: "ping",
+			Mode: 0o777, ModTime: mtime}},
+		{Header: tar.Header{Typeflag: tar.TypeReg, Name: "usr/.wh.lib", Mode: 0o644, ModTime: mtime}},
+		{Header: tar.Header{Typeflag: tar.TypeChar, Name: "usr/null", Mode: 0o666, ModTime: mtime,
+			Devmajor: 1, Devminor: 3}},
+	}
+	layer := makeLayer(t, entries)
+
+	dest := filepath.Join(t.TempDir(), "rootfs")
+	metadata, err := dir.ExtractLayer(ctx, layer, dest)
+	require.NoError(t, err)
+	require.Len(t, metadata.Entries, len(entries))
+	assert.Equal(t, 1000, metadata.Entries[1].UID)
+	assert.Equal(t, "hardlink", metadata.Entries[3].Type)
+	assert.Equal(t, map[string]string{"security.capability": "\x01\x00\x00\x02"}, metadata.Entries[2].Xattrs)
+	assert.True(t, metadata.Entries[5].MetadataOnly())
+	assert.True(t, metadata.Entries[6].MetadataOnly())
+
+	content, err := os.ReadFile(filepath.Join(dest, "usr", "bin", "pong"))
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(content))
+	for _, name := range []string{".wh.lib", "null"} {
+		_, err := os.Lstat(filepath.Join(dest, "usr", name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+
+	// Unmodified, it round-trips exactly.
+	actLayer, err := dir.LayerFromExtracted(dest, metadata, mtime)
+	require.NoError(t, err)
+	testutil.AssertEqualLayers(t, layer, actLayer)
+
+	// Modified, the directory wins for content, and the metadata wins for everything else.
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "usr", "bin", "ping"), []byte("#!/bin/bash\n"), 0o600))
+	require.NoError(t, os.Remove(filepath.Join(dest, "usr", "bin", "pong")))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "usr", "bin", "new"), []byte("new\n"), 0o644))
+	entries[2].Content = "#!/bin/bash\n"
+	entries = append(entries[:4], entries[5:]...)
+	//nolint:exhaustivestruct // partial
+	entries = append(entries, testEntry{
+		Header: tar.Header{Typeflag: tar.TypeReg, Name: "usr/bin/new", Mode: 0o644, ModTime: mtime,
+			Uname: "root", Gname: "root"},
+		Content: "new\n",
+	})
+	actLayer, err = dir.LayerFromExtracted(dest, metadata, mtime)
+	require.NoError(t, err)
+	testutil.AssertEqualLayers(t, makeLayer(t, entries), actLayer)
+}
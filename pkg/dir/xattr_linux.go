@@ -0,0 +1,36 @@
+package dir
+
+import (
+	"errors"
+	"io/fs"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the values of the preservedXattrs that are set on the file (without following
+// symlinks).
+func readXattrs(filename string) (map[string]string, error) {
+	var ret map[string]string
+	buf := make([]byte, 256)
+	for _, name := range preservedXattrs {
+		for {
+			size, err := unix.Lgetxattr(filename, name, buf)
+			if errors.Is(err, unix.ERANGE) {
+				buf = make([]byte, 2*len(buf))
+				continue
+			}
+			if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.ENOTSUP) {
+				break
+			}
+			if err != nil {
+				return nil, &fs.PathError{Op: "lgetxattr", Path: filename, Err: err}
+			}
+			if ret == nil {
+				ret = make(map[string]string)
+			}
+			ret[name] = string(buf[:size])
+			break
+		}
+	}
+	return ret, nil
+}
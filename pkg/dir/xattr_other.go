@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package dir
+
+// readXattrs returns the values of the preservedXattrs that are set on the file; extended
+// attributes are only supported on Linux, so on other platforms this never returns any.
+func readXattrs(_ string) (map[string]string, error) {
+	return nil, nil
+}
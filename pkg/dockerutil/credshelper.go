@@ -0,0 +1,50 @@
+package dockerutil
+
+import (
+	"fmt"
+
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// CredsHelperKeychain returns an authn.Keychain that gets registry credentials from the
+// docker-credential-helper program "docker-credential-{helper}" (such as "pass", "secretservice",
+// or "ecr-login"), the same way that Docker does for the config file's "credsStore" setting.  A
+// registry that the helper has no credentials for is accessed anonymously.
+func CredsHelperKeychain(helper string) authn.Keychain {
+	return credsHelperKeychain{
+		program: client.NewShellProgramFunc("docker-credential-" + helper),
+	}
+}
+
+type credsHelperKeychain struct {
+	program client.ProgramFunc
+}
+
+// Resolve implements authn.Keychain.
+func (kc credsHelperKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	// Like authn.DefaultKeychain, use the same key as Docker does for Docker Hub.
+	key := target.RegistryStr()
+	if key == name.DefaultRegistry {
+		key = authn.DefaultAuthKey
+	}
+	creds, err := client.Get(kc.program, key)
+	if err != nil {
+		if credentials.IsErrCredentialsNotFound(err) {
+			return authn.Anonymous, nil
+		}
+		return nil, fmt.Errorf("dockerutil.CredsHelperKeychain: %s: %w", key, err)
+	}
+	// This is the same convention that the Docker CLI uses for identity tokens.
+	if creds.Username == "<token>" {
+		return authn.FromConfig(authn.AuthConfig{ //nolint:exhaustivestruct // only a token
+			IdentityToken: creds.Secret,
+		}), nil
+	}
+	return authn.FromConfig(authn.AuthConfig{ //nolint:exhaustivestruct // only a user/pass
+		Username: creds.Username,
+		Password: creds.Secret,
+	}), nil
+}
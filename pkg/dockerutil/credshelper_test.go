@@ -0,0 +1,71 @@
+package dockerutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/dockerutil"
+)
+
+const fakeCredsHelper = `#!/bin/sh
+test "$1" = get || exit 1
+read -r server
+case "$server" in
+	registry.example.com) echo '{"Username":"user","Secret":"pass"}';;
+	https://index.docker.io/v1/) echo '{"Username":"<token>","Secret":"tok"}';;
+	broken.example.com) echo 'oops'; exit 1;;
+	*) echo 'credentials not found in native keychain'; exit 1;;
+esac
+`
+
+func TestCredsHelperKeychain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake credential helper is a shell script")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(fakeCredsHelper), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	keychain := dockerutil.CredsHelperKeychain("fake")
+
+	testcases := map[string]struct {
+		Registry string
+		Expected *authn.AuthConfig
+	}{
+		"password": {
+			Registry: "registry.example.com",
+			Expected: &authn.AuthConfig{Username: "user", Password: "pass"}, //nolint:exhaustivestruct
+		},
+		"token": {
+			Registry: name.DefaultRegistry,
+			Expected: &authn.AuthConfig{IdentityToken: "tok"}, //nolint:exhaustivestruct
+		},
+		"anonymous": {
+			Registry: "other.example.com",
+			Expected: &authn.AuthConfig{}, //nolint:exhaustivestruct
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			registry, err := name.NewRegistry(tcData.Registry)
+			require.NoError(t, err)
+			auth, err := keychain.Resolve(registry)
+			require.NoError(t, err)
+			cfg, err := auth.Authorization()
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Expected, cfg)
+		})
+	}
+
+	registry, err := name.NewRegistry("broken.example.com")
+	require.NoError(t, err)
+	_, err = keychain.Resolve(registry)
+	assert.Error(t, err)
+}
@@ -1,14 +1,19 @@
+// Package dockerutil talks to container engines: mostly to a Docker-API daemon (Docker itself,
+// rootful or rootless, or Podman's Docker-compatible service) using the docker CLI, but images may
+// also be loaded in to Podman using its REST API or in to containerd using nerdctl.
 package dockerutil
 
 import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/datawire/dlib/dexec"
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
 )
 
@@ -17,6 +22,11 @@ func newTag(repo string) (name.Tag, error) {
 		repo, os.Getpid(), time.Now().UnixNano()))
 }
 
+// WithImage loads img in to the daemon under a temporary tag, calls fn with that tag, and then
+// removes the image from the daemon.  The Context passed to fn remembers the daemon, so that
+// Command and CommandLine called with it talk to the same daemon.
+//
+// If there is no daemon, it returns an error wrapping ErrNoDaemon without calling fn.
 func WithImage(
 	ctx context.Context,
 	imgname string,
@@ -29,14 +39,39 @@ func WithImage(
 		}
 	}
 
+	host, err := Host(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = withHost(ctx, host)
+
 	tag, err := newTag(imgname)
 	if err != nil {
 		return err
 	}
+	if err := Load(ctx, tag, img); err != nil {
+		return err
+	}
 	defer func() {
-		maybeSetErr(dexec.CommandContext(ctx, "docker", "image", "rm", tag.String()).Run())
+		cmd, err := Command(ctx, "image", "rm", tag.String())
+		if err != nil {
+			maybeSetErr(err)
+			return
+		}
+		maybeSetErr(cmd.Run())
 	}()
-	cmd := dexec.CommandContext(ctx, "docker", "image", "load")
+	return fn(ctx, tag)
+}
+
+// Load loads img in to the daemon, tagged as tag.
+//
+// If there is no daemon, it returns an error wrapping ErrNoDaemon; a caller may then choose to
+// Push the image instead.
+func Load(ctx context.Context, tag name.Tag, img ociv1.Image) error {
+	cmd, err := Command(ctx, "image", "load")
+	if err != nil {
+		return err
+	}
 	pipe, err := cmd.StdinPipe()
 	if err != nil {
 		return err
@@ -54,8 +89,37 @@ func WithImage(
 	if err := pipe.Close(); err != nil {
 		return err
 	}
-	if err := cmd.Wait(); err != nil {
-		return err
+	return cmd.Wait()
+}
+
+// Push pushes img to the registry named by tag, without involving a daemon.  If no options are
+// given, credentials are taken from authn.DefaultKeychain (the Docker config file and credential
+// helpers).
+func Push(ctx context.Context, tag name.Tag, img ociv1.Image, opts ...remote.Option) error {
+	if len(opts) == 0 {
+		opts = []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)}
 	}
-	return fn(ctx, tag)
+	return remote.Write(tag, img, append([]remote.Option{remote.WithContext(ctx)}, opts...)...)
+}
+
+// ListImages returns the "REPOSITORY:TAG" names of the images in the daemon.  Images without a tag
+// are omitted.
+func ListImages(ctx context.Context) ([]string, error) {
+	cmd, err := Command(ctx, "image", "ls", "--format", "{{.Repository}}:{{.Tag}}")
+	if err != nil {
+		return nil, err
+	}
+	cmd.DisableLogging = true
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" || strings.Contains(line, "<none>") {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	return ret, nil
 }
@@ -0,0 +1,76 @@
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// An Engine is a container engine that an image can be loaded in to.
+//
+// Engine implements pflag.Value, so it may be used directly as a command-line flag.
+type Engine int
+
+const (
+	// EngineDocker loads images with the docker CLI, in to the daemon that Host finds.  This
+	// is the zero value.
+	EngineDocker Engine = iota
+	// EnginePodman loads images with Podman's REST API; see LoadPodman.
+	EnginePodman
+	// EngineNerdctl loads images with the nerdctl CLI, in to a containerd namespace; see
+	// LoadNerdctl.
+	EngineNerdctl
+)
+
+// Engines is the list of all Engines.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var Engines = []Engine{EngineDocker, EnginePodman, EngineNerdctl}
+
+// String implements pflag.Value.
+func (e Engine) String() string {
+	switch e {
+	case EngineDocker:
+		return "docker"
+	case EnginePodman:
+		return "podman"
+	case EngineNerdctl:
+		return "nerdctl"
+	default:
+		return fmt.Sprintf("Engine(%d)", int(e))
+	}
+}
+
+// Set implements pflag.Value.
+func (e *Engine) Set(str string) error {
+	for _, engine := range Engines {
+		if str == engine.String() {
+			*e = engine
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid engine %q: must be one of \"docker\", \"podman\", or \"nerdctl\"", str)
+}
+
+// Type implements pflag.Value.
+func (Engine) Type() string {
+	return "engine"
+}
+
+// Load loads img in to the engine, tagged as tag.  For EngineNerdctl, the image is loaded in to
+// the containerd namespace named by namespace (or nerdctl's default namespace, if namespace is
+// empty); namespace is ignored for the other engines.
+func (e Engine) Load(ctx context.Context, namespace string, tag name.Tag, img ociv1.Image) error {
+	switch e {
+	case EngineDocker:
+		return Load(ctx, tag, img)
+	case EnginePodman:
+		return LoadPodman(ctx, tag, img)
+	case EngineNerdctl:
+		return LoadNerdctl(ctx, namespace, tag, img)
+	default:
+		return fmt.Errorf("dockerutil: invalid engine %v", e)
+	}
+}
@@ -0,0 +1,118 @@
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/datawire/dlib/dexec"
+)
+
+// ErrNoDaemon is returned (wrapped) when there is no Docker-API daemon to talk to.
+var ErrNoDaemon = errors.New("no Docker daemon found")
+
+// defaultSocket is where a rootful Docker daemon listens, and what `docker context inspect`
+// reports for the "default" context when $DOCKER_HOST isn't set.
+const defaultSocket = "/var/run/docker.sock"
+
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return fmt.Sprintf("/run/user/%d", os.Getuid())
+}
+
+// podmanSockets returns the Docker-compatible sockets of a rootless and of a rootful Podman
+// service.
+func podmanSockets() []string {
+	return []string{
+		filepath.Join(runtimeDir(), "podman", "podman.sock"),
+		"/run/podman/podman.sock",
+	}
+}
+
+// fallbackSockets returns the sockets to try, in order, if the default socket doesn't exist: the
+// socket of a rootless Docker daemon, then the Podman sockets.
+func fallbackSockets() []string {
+	return append([]string{filepath.Join(runtimeDir(), "docker.sock")}, podmanSockets()...)
+}
+
+func isSocket(filename string) bool {
+	info, err := os.Stat(filename)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// Host returns the address of the Docker-API daemon that the other functions in this package talk
+// to, in the form that the docker CLI's --host flag takes:
+//
+//  - $DOCKER_HOST, if it is set.
+//  - Otherwise, the host of the current Docker context (per $DOCKER_CONTEXT or `docker context
+//    use`), if it isn't the default socket or if the default socket exists.
+//  - Otherwise, the first of these sockets that exists: a rootless Docker daemon's
+//    ($XDG_RUNTIME_DIR/docker.sock), a rootless Podman service's
+//    ($XDG_RUNTIME_DIR/podman/podman.sock), or a rootful Podman service's
+//    (/run/podman/podman.sock).
+//
+// If none of those exist, or if the docker CLI is not installed, it returns an error wrapping
+// ErrNoDaemon.
+func Host(ctx context.Context) (string, error) {
+	if host, ok := ctx.Value(hostContextKey{}).(string); ok {
+		return host, nil
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoDaemon, err)
+	}
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return host, nil
+	}
+
+	cmd := dexec.CommandContext(ctx, "docker", "context", "inspect", "--format", "{{.Endpoints.docker.Host}}")
+	cmd.DisableLogging = true
+	if out, err := cmd.Output(); err == nil {
+		host := strings.TrimSpace(string(out))
+		if host != "" && (host != "unix://"+defaultSocket || isSocket(defaultSocket)) {
+			return host, nil
+		}
+	} else if isSocket(defaultSocket) {
+		// An old docker CLI without contexts.
+		return "unix://" + defaultSocket, nil
+	}
+
+	for _, sock := range fallbackSockets() {
+		if isSocket(sock) {
+			return "unix://" + sock, nil
+		}
+	}
+	return "", ErrNoDaemon
+}
+
+type hostContextKey struct{}
+
+// withHost returns a Context that causes Host to return host without looking for it again.
+func withHost(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, hostContextKey{}, host)
+}
+
+// CommandLine returns the command line to run the docker CLI with the given arguments, talking to
+// the daemon that Host finds.
+func CommandLine(ctx context.Context, args ...string) ([]string, error) {
+	host, err := Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{"docker", "--host=" + host}, args...), nil
+}
+
+// Command is like dexec.CommandContext(ctx, "docker", args...), but talks to the daemon that Host
+// finds.
+func Command(ctx context.Context, args ...string) (*dexec.Cmd, error) {
+	cmdline, err := CommandLine(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return dexec.CommandContext(ctx, cmdline[0], cmdline[1:]...), nil
+}
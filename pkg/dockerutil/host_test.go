@@ -0,0 +1,76 @@
+package dockerutil_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/dockerutil"
+)
+
+// fakeDocker puts a "docker" executable on $PATH whose `docker context inspect` fails, as if it
+// were an old docker CLI without contexts.
+func fakeDocker(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake docker is a shell script")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\nexit 1\n"), 0o755))
+	t.Setenv("PATH", dir)
+}
+
+func TestHost(t *testing.T) {
+	ctx := context.Background()
+	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
+		t.Skip("there is a real Docker daemon")
+	}
+
+	t.Run("no-docker", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+		t.Setenv("DOCKER_HOST", "tcp://example.com:2376")
+		_, err := dockerutil.Host(ctx)
+		assert.ErrorIs(t, err, dockerutil.ErrNoDaemon)
+	})
+	t.Run("DOCKER_HOST", func(t *testing.T) {
+		fakeDocker(t)
+		t.Setenv("DOCKER_HOST", "tcp://example.com:2376")
+		host, err := dockerutil.Host(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://example.com:2376", host)
+	})
+	t.Run("no-daemon", func(t *testing.T) {
+		fakeDocker(t)
+		t.Setenv("DOCKER_HOST", "")
+		t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+		_, err := dockerutil.Host(ctx)
+		assert.ErrorIs(t, err, dockerutil.ErrNoDaemon)
+	})
+	t.Run("rootless-podman", func(t *testing.T) {
+		fakeDocker(t)
+		t.Setenv("DOCKER_HOST", "")
+		runtimeDir := t.TempDir()
+		t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+		sock := filepath.Join(runtimeDir, "podman", "podman.sock")
+		require.NoError(t, os.Mkdir(filepath.Dir(sock), 0o755))
+		listener, err := net.Listen("unix", sock)
+		require.NoError(t, err)
+		defer func() {
+			_ = listener.Close()
+		}()
+
+		host, err := dockerutil.Host(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "unix://"+sock, host)
+
+		cmdline, err := dockerutil.CommandLine(ctx, "image", "ls")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"docker", "--host=unix://" + sock, "image", "ls"}, cmdline)
+	})
+}
@@ -0,0 +1,41 @@
+package dockerutil
+
+import (
+	"context"
+
+	"github.com/datawire/dlib/dexec"
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// LoadNerdctl loads img in to containerd with the nerdctl CLI, tagged as tag, in the containerd
+// namespace named by namespace; if namespace is empty then nerdctl picks the namespace
+// ($CONTAINERD_NAMESPACE, or else "default").  This is how to make an image available to a
+// Kubernetes node that uses containerd directly, using the "k8s.io" namespace.
+func LoadNerdctl(ctx context.Context, namespace string, tag name.Tag, img ociv1.Image) error {
+	var args []string
+	if namespace != "" {
+		args = append(args, "--namespace="+namespace)
+	}
+	args = append(args, "image", "load")
+	cmd := dexec.CommandContext(ctx, "nerdctl", args...)
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = pipe.Close()
+		_ = cmd.Wait()
+	}()
+	if err := ociv1tarball.Write(tag, img, pipe); err != nil {
+		return err
+	}
+	if err := pipe.Close(); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
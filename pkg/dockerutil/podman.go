@@ -0,0 +1,89 @@
+package dockerutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// PodmanSocket returns the filename of the Podman service's socket: the path of
+// $CONTAINER_HOST if it is set to a "unix://" URL, or else the first of
+// $XDG_RUNTIME_DIR/podman/podman.sock (rootless) and /run/podman/podman.sock (rootful) that
+// exists.  If there is no such socket, it returns an error wrapping ErrNoDaemon.
+func PodmanSocket() (string, error) {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		if !strings.HasPrefix(host, "unix://") {
+			return "", fmt.Errorf("$CONTAINER_HOST=%q: only unix:// sockets are supported", host)
+		}
+		return strings.TrimPrefix(host, "unix://"), nil
+	}
+	for _, sock := range podmanSockets() {
+		if isSocket(sock) {
+			return sock, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no Podman service socket", ErrNoDaemon)
+}
+
+// LoadPodman loads img in to Podman, tagged as tag, using the Podman service's REST API (see
+// PodmanSocket) rather than the podman CLI.
+func LoadPodman(ctx context.Context, tag name.Tag, img ociv1.Image) error {
+	sock, err := PodmanSocket()
+	if err != nil {
+		return err
+	}
+	return loadPodman(ctx, sock, tag, img)
+}
+
+func loadPodman(ctx context.Context, sock string, tag name.Tag, img ociv1.Image) error {
+	client := &http.Client{ //nolint:exhaustivestruct // only set what we need
+		Transport: &http.Transport{ //nolint:exhaustivestruct // only set what we need
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+
+	pipeR, pipeW := io.Pipe()
+	go func() {
+		pipeW.CloseWithError(ociv1tarball.Write(tag, img, pipeW))
+	}()
+	defer func() {
+		_ = pipeR.Close()
+	}()
+
+	// The hostname is ignored, since we always dial the socket.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://podman/v3.0.0/libpod/images/load", pipeR)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("podman: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			return fmt.Errorf("podman: HTTP %s", resp.Status)
+		}
+		return fmt.Errorf("podman: HTTP %s: %s", resp.Status, apiErr.Message)
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
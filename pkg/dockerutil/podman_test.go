@@ -0,0 +1,64 @@
+package dockerutil_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/dockerutil"
+)
+
+func TestLoadPodman(t *testing.T) {
+	ctx := context.Background()
+	sock := filepath.Join(t.TempDir(), "podman.sock")
+	t.Setenv("CONTAINER_HOST", "unix://"+sock)
+
+	listener, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	var loaded []string
+	srv := &http.Server{ //nolint:exhaustivestruct // only set what we need
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/v3.0.0/libpod/images/load" {
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(map[string]string{"message": "no such endpoint"})
+				return
+			}
+			manifest, err := ociv1tarball.LoadManifest(func() (io.ReadCloser, error) {
+				return r.Body, nil
+			})
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+				return
+			}
+			for _, desc := range manifest {
+				loaded = append(loaded, desc.RepoTags...)
+			}
+			_ = json.NewEncoder(w).Encode(map[string][]string{"Names": loaded})
+		}),
+	}
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	defer func() {
+		_ = srv.Close()
+	}()
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	tag, err := name.NewTag("example.com/podman-test:1")
+	require.NoError(t, err)
+
+	require.NoError(t, dockerutil.EnginePodman.Load(ctx, "", tag, img))
+	assert.Equal(t, []string{"example.com/podman-test:1"}, loaded)
+}
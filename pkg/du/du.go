@@ -0,0 +1,330 @@
+// Package du reports where the space in an image goes: how much each layer adds, how much each
+// top-level directory takes up, how much each installed Python distribution takes up, and which
+// files are stored more than once because they appear in more than one layer.
+package du
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+// A Layer is the usage of a single layer.
+type Layer struct {
+	Index  int    `json:"index"`
+	Digest string `json:"digest"`
+	// Size is the total size of the regular files in the layer.
+	Size int64 `json:"size"`
+	// CompressedSize is the size of the (compressed) layer blob.
+	CompressedSize int64  `json:"compressedSize"`
+	Files          int    `json:"files"`
+	CreatedBy      string `json:"createdBy,omitempty"`
+}
+
+// A Dir is the usage of a top-level directory (or of a file at the top-level).
+type Dir struct {
+	Name string `json:"name"`
+	// Size is the total size of the regular files under the directory in the squashed
+	// filesystem; that is, what is visible in a container.
+	Size int64 `json:"size"`
+	// LayerSize is the total size of the regular files under the directory across all of the
+	// layers, including files that are replaced or removed by later layers; that is, what is
+	// stored in the image.
+	LayerSize int64 `json:"layerSize"`
+}
+
+// A Dist is the usage of an installed Python distribution.
+type Dist struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	DistInfoDir string `json:"distInfoDir"`
+	// Size is the total size of the files listed in the distribution's RECORD file, plus any
+	// compiled bytecode for the .py files in it, in the squashed filesystem.
+	Size  int64 `json:"size"`
+	Files int   `json:"files"`
+}
+
+// A Copy is one place that a duplicated file is stored.
+type Copy struct {
+	Layer int    `json:"layer"`
+	Path  string `json:"path"`
+}
+
+// A Duplicate is a file content that is stored in more than one layer.
+type Duplicate struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+	// Wasted is the space taken up by the copies other than the first one.
+	Wasted int64  `json:"wasted"`
+	Copies []Copy `json:"copies"`
+}
+
+// A Report is the result of Image.
+type Report struct {
+	Layers []Layer `json:"layers"`
+	// Dirs is sorted by Size, largest first.
+	Dirs []Dir `json:"dirs"`
+	// Dists is sorted by Size, largest first.
+	Dists []Dist `json:"dists"`
+	// Duplicates is sorted by Wasted, largest first.
+	Duplicates []Duplicate `json:"duplicates"`
+}
+
+// Image reads all of the layers of img, and reports on the space used in it.
+//
+// Python distributions are found by their .dist-info directories, like pep376.ListInstalled does;
+// distributions without a RECORD file are not reported.  Empty files are never reported as
+// duplicates.
+func Image(img ociv1.Image) (*Report, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("du.Image: %w", err)
+	}
+	config, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("du.Image: %w", err)
+	}
+
+	// Match up the history entries with the layers.
+	var createdBy []string
+	for _, entry := range config.History {
+		if !entry.EmptyLayer {
+			createdBy = append(createdBy, entry.CreatedBy)
+		}
+	}
+	if len(createdBy) != len(layers) {
+		createdBy = make([]string, len(layers))
+	}
+
+	report := &Report{ //nolint:exhaustivestruct // filled in below
+		Layers:     make([]Layer, 0, len(layers)),
+		Duplicates: []Duplicate{},
+	}
+	layerDirSizes := make(map[string]int64)
+	copies := make(map[string][]Copy)
+	sizes := make(map[string]int64)
+	for i, layer := range layers {
+		usage, err := scanLayer(layer, func(name string, size int64, digest string) {
+			layerDirSizes[topLevel(name)] += size
+			if size == 0 {
+				return
+			}
+			copies[digest] = append(copies[digest], Copy{Layer: i, Path: name})
+			sizes[digest] = size
+		})
+		if err != nil {
+			return nil, fmt.Errorf("du.Image: layer %d: %w", i, err)
+		}
+		usage.Index = i
+		usage.CreatedBy = createdBy[i]
+		report.Layers = append(report.Layers, usage)
+	}
+
+	for digest, list := range copies {
+		inLayers := make(map[int]struct{})
+		for _, c := range list {
+			inLayers[c.Layer] = struct{}{}
+		}
+		if len(inLayers) < 2 {
+			continue
+		}
+		report.Duplicates = append(report.Duplicates, Duplicate{
+			Digest: digest,
+			Size:   sizes[digest],
+			Wasted: sizes[digest] * int64(len(inLayers)-1),
+			Copies: list,
+		})
+	}
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		if report.Duplicates[i].Wasted != report.Duplicates[j].Wasted {
+			return report.Duplicates[i].Wasted > report.Duplicates[j].Wasted
+		}
+		return report.Duplicates[i].Digest < report.Duplicates[j].Digest
+	})
+
+	fsys, err := squash.Load(layers, false)
+	if err != nil {
+		return nil, fmt.Errorf("du.Image: %w", err)
+	}
+	dirSizes := make(map[string]int64)
+	if err := walkFiles(fsys, ".", func(name string, info fs.FileInfo) {
+		dirSizes[topLevel(name)] += info.Size()
+	}); err != nil {
+		return nil, fmt.Errorf("du.Image: %w", err)
+	}
+	report.Dirs = make([]Dir, 0, len(layerDirSizes))
+	for name, layerSize := range layerDirSizes {
+		report.Dirs = append(report.Dirs, Dir{
+			Name:      name,
+			Size:      dirSizes[name],
+			LayerSize: layerSize,
+		})
+	}
+	sort.Slice(report.Dirs, func(i, j int) bool {
+		if report.Dirs[i].Size != report.Dirs[j].Size {
+			return report.Dirs[i].Size > report.Dirs[j].Size
+		}
+		return report.Dirs[i].Name < report.Dirs[j].Name
+	})
+
+	report.Dists, err = distUsage(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("du.Image: %w", err)
+	}
+
+	return report, nil
+}
+
+// topLevel returns the first component of a path.
+func topLevel(name string) string {
+	if idx := strings.Index(name, "/"); idx >= 0 {
+		return name[:idx]
+	}
+	return name
+}
+
+// scanLayer reads a layer, calling fn for each regular file in it with the file's cleaned name,
+// its size, and the digest of its content.
+func scanLayer(layer ociv1.Layer, fn func(name string, size int64, digest string)) (Layer, error) {
+	var ret Layer
+	digest, err := layer.Digest()
+	if err != nil {
+		return ret, err
+	}
+	ret.Digest = digest.String()
+	ret.CompressedSize, err = layer.Size()
+	if err != nil {
+		return ret, err
+	}
+
+	layerReader, err := layer.Uncompressed()
+	if err != nil {
+		return ret, err
+	}
+	defer func() {
+		_ = layerReader.Close()
+	}()
+	tarReader := tar.NewReader(layerReader)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return ret, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean("/" + header.Name)[1:]
+		if strings.HasPrefix(path.Base(name), ".wh.") {
+			continue
+		}
+		hasher := sha256.New()
+		// #nosec G110 -- mitigated by only hashing
+		size, err := io.Copy(hasher, tarReader)
+		if err != nil {
+			return ret, err
+		}
+		ret.Size += size
+		ret.Files++
+		fn(name, size, fmt.Sprintf("sha256:%x", hasher.Sum(nil)))
+	}
+	return ret, nil
+}
+
+// walkFiles calls fn for each regular file under dir in fsys.
+func walkFiles(fsys fs.FS, dir string, fn func(name string, info fs.FileInfo)) error {
+	// Don't use fs.WalkDir, because it stat()s each directory, and layer filesystems may be
+	// missing entries for parent directories.
+	dirents, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, dirent := range dirents {
+		name := path.Join(dir, dirent.Name())
+		if dirent.IsDir() {
+			if err := walkFiles(fsys, name, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		info, err := dirent.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			fn(name, info)
+		}
+	}
+	return nil
+}
+
+// distUsage returns the usage of each Python distribution installed in fsys.
+func distUsage(fsys fs.FS) ([]Dist, error) {
+	dists, err := pep376.ListInstalled(fsys)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Dist, 0, len(dists))
+	for _, dist := range dists {
+		record, err := fsys.Open(path.Join(dist.DistInfoDir, "RECORD"))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		manifest, err := pep376.NewUninstallManifest(dist.DistInfoDir, record)
+		_ = record.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		files := make(map[string]struct{}, len(manifest.Files))
+		for _, name := range manifest.Files {
+			files[name] = struct{}{}
+		}
+		for _, glob := range manifest.PycacheGlobs {
+			matches, err := fs.Glob(fsys, glob)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range matches {
+				files[name] = struct{}{}
+			}
+		}
+
+		usage := Dist{
+			Name:        dist.Name,
+			Version:     dist.Version,
+			DistInfoDir: dist.DistInfoDir,
+			Size:        0,
+			Files:       0,
+		}
+		for name := range files {
+			info, err := fs.Stat(fsys, name)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			usage.Size += info.Size()
+			usage.Files++
+		}
+		ret = append(ret, usage)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Size > ret[j].Size
+	})
+	return ret, nil
+}
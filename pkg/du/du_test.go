@@ -0,0 +1,105 @@
+package du_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/du"
+)
+
+type testFile struct {
+	Name    string
+	Content string
+}
+
+func testLayer(t *testing.T, files ...testFile) ociv1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, file := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file.Name,
+			Mode:     0o644,
+			Size:     int64(len(file.Content)),
+		}))
+		_, err := io.WriteString(tarWriter, file.Content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	content := buf.Bytes()
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func TestImage(t *testing.T) {
+	t.Parallel()
+	const (
+		distInfo = "usr/lib/python3/site-packages/example-1.0.dist-info"
+		metadata = "Name: example\nVersion: 1.0\n"
+		record   = "example/__init__.py,,\n" +
+			"example-1.0.dist-info/METADATA,,\n" +
+			"example-1.0.dist-info/RECORD,,\n"
+		// __init__.py + __init__.cpython-39.pyc + METADATA + RECORD
+		distSize = 7 + 3 + int64(len(metadata)) + int64(len(record))
+	)
+	img, err := mutate.AppendLayers(empty.Image,
+		testLayer(t,
+			testFile{"etc/config", "0123456789"},
+			testFile{"etc/empty", ""},
+			testFile{"usr/lib/python3/site-packages/example/__init__.py", "print()"},
+			testFile{"usr/lib/python3/site-packages/example/__pycache__/__init__.cpython-39.pyc", "abc"},
+			testFile{distInfo + "/METADATA", metadata},
+			testFile{distInfo + "/RECORD", record},
+		),
+		testLayer(t,
+			testFile{"etc/config", "0123456789"},
+			testFile{"etc/empty", ""},
+			testFile{"tmp/.wh.nothing", ""},
+		),
+	)
+	require.NoError(t, err)
+
+	report, err := du.Image(img)
+	require.NoError(t, err)
+
+	require.Len(t, report.Layers, 2)
+	assert.Equal(t, 0, report.Layers[0].Index)
+	assert.Equal(t, 6, report.Layers[0].Files)
+	assert.Equal(t, 1, report.Layers[1].Index)
+	assert.Equal(t, 2, report.Layers[1].Files)
+	assert.Equal(t, int64(10), report.Layers[1].Size)
+
+	assert.Equal(t, []du.Dir{
+		{Name: "usr", Size: distSize, LayerSize: distSize},
+		{Name: "etc", Size: 10, LayerSize: 20},
+	}, report.Dirs)
+
+	assert.Equal(t, []du.Dist{{
+		Name:        "example",
+		Version:     "1.0",
+		DistInfoDir: distInfo,
+		Size:        distSize,
+		Files:       4,
+	}}, report.Dists)
+
+	require.Len(t, report.Duplicates, 1)
+	assert.Equal(t, int64(10), report.Duplicates[0].Size)
+	assert.Equal(t, int64(10), report.Duplicates[0].Wasted)
+	assert.Equal(t, []du.Copy{
+		{Layer: 0, Path: "etc/config"},
+		{Layer: 1, Path: "etc/config"},
+	}, report.Duplicates[0].Copies)
+}
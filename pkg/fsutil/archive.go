@@ -0,0 +1,186 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/blobstore"
+)
+
+// An ArchiveImage is one of the images in a "docker save" archive, along with the tags that it has
+// in that archive (which may be none).
+type ArchiveImage struct {
+	Tags  []name.Tag
+	Image ociv1.Image
+}
+
+// HasTag returns whether img is tagged as tag, comparing the fully-resolved names so that (for
+// example) "foo" and "docker.io/library/foo:latest" are the same tag.
+func (img ArchiveImage) HasTag(tag name.Tag) bool {
+	for _, imgTag := range img.Tags {
+		if imgTag.Name() == tag.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenImages opens each of the images in a "docker save" archive, which (unlike OpenImage) may
+// contain any number of images.
+func OpenImages(filename string) ([]ArchiveImage, error) {
+	opener := PathOpener(filename)
+	pathErr := func(err error) error {
+		return &fs.PathError{
+			Op:   "open imagefile",
+			Path: filename,
+			Err:  err,
+		}
+	}
+	manifest, err := ociv1tarball.LoadManifest(opener)
+	if err != nil {
+		return nil, pathErr(err)
+	}
+	ret := make([]ArchiveImage, 0, len(manifest))
+	for _, desc := range manifest {
+		tags := make([]name.Tag, 0, len(desc.RepoTags))
+		for _, tagStr := range desc.RepoTags {
+			tag, err := name.NewTag(tagStr)
+			if err != nil {
+				return nil, pathErr(err)
+			}
+			tags = append(tags, tag)
+		}
+		var img ociv1.Image
+		if len(tags) > 0 {
+			img, err = ociv1tarball.Image(opener, &tags[0])
+		} else {
+			// An untagged image can't be selected by tag, so present go-containerregistry
+			// with an archive that contains only this image.
+			img, err = ociv1tarball.Image(singleImageOpener(opener, desc), nil)
+		}
+		if err != nil {
+			return nil, pathErr(err)
+		}
+		ret = append(ret, ArchiveImage{
+			Tags:  tags,
+			Image: img,
+		})
+	}
+	return ret, nil
+}
+
+// OpenImageTag is like OpenImage, but if tag is non-empty then it selects the image tagged as tag
+// from an archive that may contain several images.  The filename may also be an OCI image layout
+// directory, in which case tag selects the image by its "org.opencontainers.image.ref.name"
+// annotation (see blobstore.Layout.Image).
+func OpenImageTag(filename, tag string) (ociv1.Image, error) {
+	if blobstore.IsLayout(filename) {
+		img, err := (&blobstore.Layout{Dir: blobstore.Dir{Path: filename}}).Image(tag)
+		if err != nil {
+			return nil, &fs.PathError{
+				Op:   "open imagefile",
+				Path: filename,
+				Err:  err,
+			}
+		}
+		return img, nil
+	}
+	if tag == "" {
+		return OpenImage(filename)
+	}
+	ref, err := name.NewTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	img, err := ociv1tarball.Image(PathOpener(filename), &ref)
+	if err != nil {
+		return nil, &fs.PathError{
+			Op:   "open imagefile",
+			Path: filename,
+			Err:  err,
+		}
+	}
+	return img, nil
+}
+
+// WriteImages writes a "docker save" archive containing each of images; it is the inverse of
+// OpenImages.
+func WriteImages(w io.Writer, images []ArchiveImage) error {
+	refs := make(map[name.Reference]ociv1.Image)
+	for _, img := range images {
+		if len(img.Tags) == 0 {
+			// The repository name of a digest reference doesn't end up in the archive;
+			// the reference only needs to be a unique map key.
+			digest, err := img.Image.Digest()
+			if err != nil {
+				return err
+			}
+			ref, err := name.NewDigest("untagged@" + digest.String())
+			if err != nil {
+				return err
+			}
+			refs[ref] = img.Image
+			continue
+		}
+		for _, tag := range img.Tags {
+			refs[tag] = img.Image
+		}
+	}
+	return ociv1tarball.MultiRefWrite(refs, w)
+}
+
+// singleImageOpener returns an Opener for a copy of the archive that opener opens, but with the
+// manifest.json listing only desc.
+func singleImageOpener(opener ociv1tarball.Opener, desc ociv1tarball.Descriptor) ociv1tarball.Opener {
+	return func() (io.ReadCloser, error) {
+		manifestBytes, err := json.Marshal(ociv1tarball.Manifest{desc})
+		if err != nil {
+			return nil, err
+		}
+		in, err := opener()
+		if err != nil {
+			return nil, err
+		}
+		pipeR, pipeW := io.Pipe()
+		go func() {
+			defer func() {
+				_ = in.Close()
+			}()
+			pipeW.CloseWithError(func() error {
+				tarR := tar.NewReader(in)
+				tarW := tar.NewWriter(pipeW)
+				for {
+					hdr, err := tarR.Next()
+					if err != nil {
+						if errors.Is(err, io.EOF) {
+							break
+						}
+						return err
+					}
+					var body io.Reader = tarR
+					if hdr.Name == "manifest.json" {
+						hdr.Size = int64(len(manifestBytes))
+						body = bytes.NewReader(manifestBytes)
+					}
+					if err := tarW.WriteHeader(hdr); err != nil {
+						return err
+					}
+					if _, err := io.Copy(tarW, body); err != nil {
+						return fmt.Errorf("%s: %w", hdr.Name, err)
+					}
+				}
+				return tarW.Close()
+			}())
+		}()
+		return pipeR, nil
+	}
+}
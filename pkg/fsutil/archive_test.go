@@ -0,0 +1,101 @@
+package fsutil_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/blobstore"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	t.Parallel()
+	newImage := func() ociv1.Image {
+		img, err := random.Image(256, 2)
+		require.NoError(t, err)
+		return img
+	}
+	digest := func(img ociv1.Image) ociv1.Hash {
+		digest, err := img.Digest()
+		require.NoError(t, err)
+		return digest
+	}
+	newTag := func(str string) name.Tag {
+		tag, err := name.NewTag(str)
+		require.NoError(t, err)
+		return tag
+	}
+
+	in := []fsutil.ArchiveImage{
+		{Tags: []name.Tag{newTag("example.com/app-a:1"), newTag("example.com/app-a:latest")}, Image: newImage()},
+		{Tags: []name.Tag{newTag("example.com/app-b:1")}, Image: newImage()},
+		{Tags: nil, Image: newImage()},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, fsutil.WriteImages(&buf, in))
+	filename := filepath.Join(t.TempDir(), "images.tar")
+	require.NoError(t, os.WriteFile(filename, buf.Bytes(), 0o666))
+
+	_, err := fsutil.OpenImage(filename)
+	assert.Error(t, err, "OpenImage with several images")
+
+	out, err := fsutil.OpenImages(filename)
+	require.NoError(t, err)
+	require.Len(t, out, len(in))
+	for _, want := range in {
+		found := false
+		for _, got := range out {
+			if digest(got.Image) != digest(want.Image) {
+				continue
+			}
+			found = true
+			assert.Len(t, got.Tags, len(want.Tags))
+			for _, tag := range want.Tags {
+				assert.True(t, got.HasTag(tag), tag.String())
+			}
+			layers, err := got.Image.Layers()
+			require.NoError(t, err)
+			assert.Len(t, layers, 2)
+		}
+		assert.True(t, found, digest(want.Image).String())
+	}
+
+	img, err := fsutil.OpenImageTag(filename, "example.com/app-b:1")
+	require.NoError(t, err)
+	assert.Equal(t, digest(in[1].Image), digest(img))
+
+	_, err = fsutil.OpenImageTag(filename, "example.com/app-c:1")
+	assert.Error(t, err, "missing tag")
+}
+
+func TestOpenImageTagLayout(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "layout")
+	store, err := blobstore.OpenLayout(dir)
+	require.NoError(t, err)
+	imgA, err := random.Image(256, 1)
+	require.NoError(t, err)
+	imgB, err := random.Image(256, 1)
+	require.NoError(t, err)
+	require.NoError(t, store.AppendImage(imgA, "example.com/app-a:1"))
+	require.NoError(t, store.AppendImage(imgB, "example.com/app-b:1"))
+
+	_, err = fsutil.OpenImageTag(dir, "")
+	assert.Error(t, err, "OpenImageTag with several images and no tag")
+
+	img, err := fsutil.OpenImageTag(dir, "example.com/app-b:1")
+	require.NoError(t, err)
+	want, err := imgB.Digest()
+	require.NoError(t, err)
+	got, err := img.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
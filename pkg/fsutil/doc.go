@@ -0,0 +1,4 @@
+// Package fsutil deals with the files in layers: opening image and layer files, representing the
+// files in a layer as FileReferences, transforming and merging sets of them, and writing them back
+// out as a layer.
+package fsutil
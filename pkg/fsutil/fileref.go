@@ -3,6 +3,7 @@ package fsutil
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"io"
 	"io/fs"
 	"sort"
@@ -11,6 +12,8 @@ import (
 
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
 	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/tarnorm"
 )
 
 type FileReference interface {
@@ -23,40 +26,77 @@ type FileReference interface {
 	Open() (io.ReadCloser, error)
 }
 
+// PathLess reports whether the slash-separated path a sorts before b in the order that
+// LayerFromFileReferences writes files to a layer; a directory always sorts before its contents.
+func PathLess(a, b string) bool {
+	// Do a part-wise comparison, rather than a simple string compare, because "-" < "/" < EOF.
+	aParts := strings.Split(a, "/")
+	bParts := strings.Split(b, "/")
+	for idx := 0; idx < len(aParts) || idx < len(bParts); idx++ {
+		var aPart, bPart string
+		if idx < len(aParts) {
+			aPart = aParts[idx]
+		}
+		if idx < len(bParts) {
+			bPart = bParts[idx]
+		}
+		if aPart != bPart {
+			return aPart < bPart
+		}
+	}
+	return false
+}
+
+// LayerFromFileReferences generates a layer containing the files in vfs, with any timestamps later
+// than clampTime clamped to clampTime, and with the headers normalized with tarnorm.Lax.  If a
+// file's Sys() is a *tar.Header, then it is used for the ownership, extended attributes, and the
+// target of symlinks and hardlinks; extended attributes may also be supplied by implementing
+// XattrFileReference.
+//
+// Because of the tarnorm normalization, directory entries are named with a trailing "/"; older
+// versions named them without it, so the same files now produce a layer with a different digest.
 func LayerFromFileReferences(
 	vfs []FileReference,
 	clampTime time.Time,
 	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, error) {
+	return LayerFromFileReferencesContext(context.Background(), vfs, clampTime, opts...)
+}
+
+// LayerFromFileReferencesContext is like LayerFromFileReferences, but it checks ctx between files,
+// and returns early if ctx is canceled.
+func LayerFromFileReferencesContext(
+	ctx context.Context,
+	vfs []FileReference,
+	clampTime time.Time,
+	opts ...ociv1tarball.LayerOption,
 ) (ociv1.Layer, error) {
 	sort.Slice(vfs, func(i, j int) bool {
-		// Do a part-wise comparison, rather than a simple string compare on .Fullname(),
-		// because "-" < "/" < EOF.
-		iParts := strings.Split(vfs[i].FullName(), "/")
-		jParts := strings.Split(vfs[j].FullName(), "/")
-		for idx := 0; idx < len(iParts) || idx < len(jParts); idx++ {
-			var iPart, jPart string
-			if idx < len(iParts) {
-				iPart = iParts[idx]
-			}
-			if idx < len(jParts) {
-				jPart = jParts[idx]
-			}
-			if iPart != jPart {
-				return iPart < jPart
-			}
-		}
-		return false
+		return PathLess(vfs[i].FullName(), vfs[j].FullName())
 	})
 
 	var byteWriter bytes.Buffer
 	tarWriter := tar.NewWriter(&byteWriter)
 
 	for _, file := range vfs {
-		header, err := tar.FileInfoHeader(file, "")
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var symlinkTarget string
+		if sys, ok := file.Sys().(*tar.Header); ok && sys.Typeflag == tar.TypeSymlink {
+			symlinkTarget = sys.Linkname
+		}
+		header, err := tar.FileInfoHeader(file, symlinkTarget)
 		if err != nil {
 			return nil, err
 		}
 		header.Name = file.FullName()
+		if err := tarnorm.Header(header, tarnorm.Lax); err != nil {
+			return nil, err
+		}
+		if xfile, ok := file.(XattrFileReference); ok {
+			SetXattrs(header, xfile.Xattrs())
+		}
 		if header.ModTime.After(clampTime) {
 			header.ModTime = clampTime
 		}
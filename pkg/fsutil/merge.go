@@ -0,0 +1,190 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrConflict is returned (wrapped) by Merge when two sets of files conflict and the policy is
+// ConflictError.
+var ErrConflict = errors.New("conflicting files")
+
+// A ConflictPolicy says what Merge should do when more than one set of files has something at the
+// same path.  Directories never conflict with each other; it is only a conflict if at least one of
+// the two is not a directory (including if one set has a non-directory at a path that another set
+// uses as a parent directory).
+//
+// ConflictPolicy implements pflag.Value, so it may be used directly as a command-line flag.
+type ConflictPolicy int
+
+const (
+	// ConflictError makes any conflict an error.  This is the zero value.
+	ConflictError ConflictPolicy = iota
+	// ConflictKeepFirst keeps whatever was in the earliest set, and drops the conflicting file
+	// (and anything in it, if it is a directory) from later sets.
+	ConflictKeepFirst
+	// ConflictKeepLast lets later sets replace what is in earlier sets, as if the sets were
+	// layers stacked on top of each other.
+	ConflictKeepLast
+)
+
+// String implements pflag.Value.
+func (p ConflictPolicy) String() string {
+	switch p {
+	case ConflictError:
+		return "error"
+	case ConflictKeepFirst:
+		return "keep-first"
+	case ConflictKeepLast:
+		return "keep-last"
+	default:
+		return fmt.Sprintf("ConflictPolicy(%d)", int(p))
+	}
+}
+
+// Set implements pflag.Value.
+func (p *ConflictPolicy) Set(str string) error {
+	for _, policy := range []ConflictPolicy{ConflictError, ConflictKeepFirst, ConflictKeepLast} {
+		if str == policy.String() {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid conflict policy %q: must be one of \"error\", \"keep-first\", or \"keep-last\"", str)
+}
+
+// Type implements pflag.Value.
+func (ConflictPolicy) Type() string {
+	return "policy"
+}
+
+type mergeEntry struct {
+	file FileReference
+	set  int
+}
+
+type mergeState struct {
+	entries map[string]mergeEntry
+	// under is the number of entries inside of each directory (recursively), whether or not
+	// the directory itself has an entry.
+	under map[string]int
+}
+
+func (m *mergeState) add(name string, entry mergeEntry) {
+	if _, exists := m.entries[name]; !exists {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			m.under[dir]++
+		}
+	}
+	m.entries[name] = entry
+}
+
+// removeTree removes the entry at name, and everything inside of it.
+func (m *mergeState) removeTree(name string) {
+	var names []string
+	if _, exists := m.entries[name]; exists {
+		names = append(names, name)
+	}
+	if m.under[name] > 0 {
+		for other := range m.entries {
+			if strings.HasPrefix(other, name+"/") {
+				names = append(names, other)
+			}
+		}
+	}
+	for _, other := range names {
+		delete(m.entries, other)
+		for dir := path.Dir(other); dir != "."; dir = path.Dir(dir) {
+			m.under[dir]--
+		}
+	}
+}
+
+// Merge combines several sets of files in to one, with conflicts handled according to the policy.
+// The result is sorted with SortFileReferences, and doesn't depend on the order of the files within
+// each set; it does depend on the order of the sets.  It is an error for a single set to contain two
+// files with the same name, regardless of the policy.  Whiteout markers are not interpreted; they
+// are merged like any other file (squash.Merge applies them before calling Merge).
+func Merge(policy ConflictPolicy, sets ...[]FileReference) ([]FileReference, error) {
+	state := &mergeState{
+		entries: make(map[string]mergeEntry),
+		under:   make(map[string]int),
+	}
+	conflict := func(name string, old mergeEntry, newSet int, what string) error {
+		return fmt.Errorf("fsutil.Merge: %w: %q from set %d %s %q from set %d",
+			ErrConflict, old.file.FullName(), old.set, what, name, newSet)
+	}
+
+	for setIdx, set := range sets {
+		seen := make(map[string]struct{}, len(set))
+	nextFile:
+		for _, file := range sortedCopy(set) {
+			name := file.FullName()
+			if _, dup := seen[name]; dup {
+				return nil, fmt.Errorf("fsutil.Merge: set %d contains %q more than once", setIdx, name)
+			}
+			seen[name] = struct{}{}
+			entry := mergeEntry{file: file, set: setIdx}
+
+			// Check whether an earlier set has a non-directory where this file needs a
+			// directory.
+			for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+				old, ok := state.entries[dir]
+				if !ok || old.file.IsDir() {
+					continue
+				}
+				switch policy {
+				case ConflictKeepFirst:
+					continue nextFile
+				case ConflictKeepLast:
+					state.removeTree(dir)
+				default:
+					return nil, conflict(name, old, setIdx, "is not a directory, but is the parent of")
+				}
+			}
+
+			old, exists := state.entries[name]
+			switch {
+			case exists && old.file.IsDir() && file.IsDir():
+				// Directories merge; the policy just decides whose metadata to use.
+				if policy == ConflictKeepLast {
+					state.add(name, entry)
+				}
+			case exists || (!file.IsDir() && state.under[name] > 0):
+				switch policy {
+				case ConflictKeepFirst:
+					continue nextFile
+				case ConflictKeepLast:
+					state.removeTree(name)
+					state.add(name, entry)
+				default:
+					if !exists {
+						// Report one of the files that is in the directory.
+						for _, other := range FileReferencesFromMap(entriesToMap(state.entries)) {
+							if strings.HasPrefix(other.FullName(), name+"/") {
+								old = state.entries[other.FullName()]
+								break
+							}
+						}
+						return nil, conflict(name, old, setIdx, "is inside of")
+					}
+					return nil, conflict(name, old, setIdx, "conflicts with")
+				}
+			default:
+				state.add(name, entry)
+			}
+		}
+	}
+
+	return FileReferencesFromMap(entriesToMap(state.entries)), nil
+}
+
+func entriesToMap(entries map[string]mergeEntry) map[string]FileReference {
+	ret := make(map[string]FileReference, len(entries))
+	for name, entry := range entries {
+		ret[name] = entry.file
+	}
+	return ret
+}
@@ -0,0 +1,177 @@
+package fsutil_test
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+func mergeDir(name string, mode int64) fsutil.FileReference {
+	return inMemFile(&tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: mode}, "")
+}
+
+func mergeReg(name, content string) fsutil.FileReference {
+	return inMemFile(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644}, content)
+}
+
+// describeFiles returns "NAME/ MODE" for each directory and "NAME=CONTENT" for each other file, in
+// order.
+func describeFiles(t *testing.T, files []fsutil.FileReference) []string {
+	t.Helper()
+	ret := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			ret = append(ret, fmt.Sprintf("%s/ %#o", file.FullName(), file.Mode().Perm()))
+			continue
+		}
+		reader, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		ret = append(ret, fmt.Sprintf("%s=%s", file.FullName(), content))
+	}
+	return ret
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	type result struct {
+		Files []string
+		Err   string
+	}
+	type testcase struct {
+		Sets     [][]fsutil.FileReference
+		Expected map[fsutil.ConflictPolicy]result
+	}
+	// same is for testcases where the policy doesn't matter.
+	same := func(res result) map[fsutil.ConflictPolicy]result {
+		return map[fsutil.ConflictPolicy]result{
+			fsutil.ConflictError:     res,
+			fsutil.ConflictKeepFirst: res,
+			fsutil.ConflictKeepLast:  res,
+		}
+	}
+	testcases := map[string]testcase{
+		"disjoint": {
+			Sets: [][]fsutil.FileReference{
+				{mergeReg("a", "0")},
+				{mergeReg("b", "1")},
+			},
+			Expected: same(result{Files: []string{"a=0", "b=1"}}),
+		},
+		"file-vs-file": {
+			Sets: [][]fsutil.FileReference{
+				{mergeReg("a", "0"), mergeReg("b", "0")},
+				{mergeReg("a", "1")},
+			},
+			Expected: map[fsutil.ConflictPolicy]result{
+				fsutil.ConflictError:     {Err: `"a" from set 0 conflicts with "a" from set 1`},
+				fsutil.ConflictKeepFirst: {Files: []string{"a=0", "b=0"}},
+				fsutil.ConflictKeepLast:  {Files: []string{"a=1", "b=0"}},
+			},
+		},
+		"file-then-dir": {
+			Sets: [][]fsutil.FileReference{
+				{mergeReg("x", "0")},
+				{mergeDir("x", 0o755), mergeReg("x/y", "1")},
+			},
+			Expected: map[fsutil.ConflictPolicy]result{
+				fsutil.ConflictError:     {Err: `"x" from set 0 conflicts with "x" from set 1`},
+				fsutil.ConflictKeepFirst: {Files: []string{"x=0"}},
+				fsutil.ConflictKeepLast:  {Files: []string{"x/ 0755", "x/y=1"}},
+			},
+		},
+		"file-then-implicit-dir": {
+			Sets: [][]fsutil.FileReference{
+				{mergeReg("x", "0")},
+				{mergeReg("x/y", "1")},
+			},
+			Expected: map[fsutil.ConflictPolicy]result{
+				fsutil.ConflictError:     {Err: `"x" from set 0 is not a directory, but is the parent of "x/y" from set 1`},
+				fsutil.ConflictKeepFirst: {Files: []string{"x=0"}},
+				fsutil.ConflictKeepLast:  {Files: []string{"x/y=1"}},
+			},
+		},
+		"dir-then-file": {
+			Sets: [][]fsutil.FileReference{
+				{mergeDir("x", 0o755), mergeReg("x/y", "0")},
+				{mergeReg("x", "1")},
+			},
+			Expected: map[fsutil.ConflictPolicy]result{
+				fsutil.ConflictError:     {Err: `"x" from set 0 conflicts with "x" from set 1`},
+				fsutil.ConflictKeepFirst: {Files: []string{"x/ 0755", "x/y=0"}},
+				fsutil.ConflictKeepLast:  {Files: []string{"x=1"}},
+			},
+		},
+		"implicit-dir-then-file": {
+			Sets: [][]fsutil.FileReference{
+				{mergeReg("x/y", "0")},
+				{mergeReg("x", "1")},
+			},
+			Expected: map[fsutil.ConflictPolicy]result{
+				fsutil.ConflictError:     {Err: `"x/y" from set 0 is inside of "x" from set 1`},
+				fsutil.ConflictKeepFirst: {Files: []string{"x/y=0"}},
+				fsutil.ConflictKeepLast:  {Files: []string{"x=1"}},
+			},
+		},
+		"dir-metadata": {
+			Sets: [][]fsutil.FileReference{
+				{mergeDir("d", 0o755), mergeReg("d/a", "0")},
+				{mergeDir("d", 0o700), mergeReg("d/b", "1")},
+			},
+			Expected: map[fsutil.ConflictPolicy]result{
+				fsutil.ConflictError:     {Files: []string{"d/ 0755", "d/a=0", "d/b=1"}},
+				fsutil.ConflictKeepFirst: {Files: []string{"d/ 0755", "d/a=0", "d/b=1"}},
+				fsutil.ConflictKeepLast:  {Files: []string{"d/ 0700", "d/a=0", "d/b=1"}},
+			},
+		},
+		"whiteouts": {
+			// Whiteout markers are just files to Merge; squash.Merge is what applies them.
+			Sets: [][]fsutil.FileReference{
+				{mergeReg("d/foo", "0"), mergeReg("d/.wh..wh..opq", "0")},
+				{mergeReg("d/.wh.foo", "1")},
+			},
+			Expected: same(result{Files: []string{"d/.wh..wh..opq=0", "d/.wh.foo=1", "d/foo=0"}}),
+		},
+		"order": {
+			Sets: [][]fsutil.FileReference{
+				{mergeReg("b", "0"), mergeReg("a/c", "0"), mergeReg("a-b", "0")},
+				{mergeReg("a/b", "1"), mergeDir("a", 0o755)},
+			},
+			Expected: same(result{Files: []string{"a/ 0755", "a/b=1", "a/c=0", "a-b=0", "b=0"}}),
+		},
+		"duplicate-in-set": {
+			Sets: [][]fsutil.FileReference{
+				{mergeReg("a", "0"), mergeReg("a", "1")},
+			},
+			Expected: same(result{Err: `set 0 contains "a" more than once`}),
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcName, tcData := tcName, tcData
+		for policy, expected := range tcData.Expected {
+			policy, expected := policy, expected
+			t.Run(tcName+"/"+policy.String(), func(t *testing.T) {
+				t.Parallel()
+				merged, err := fsutil.Merge(policy, tcData.Sets...)
+				if expected.Err != "" {
+					require.Error(t, err)
+					assert.Contains(t, err.Error(), expected.Err)
+					if policy == fsutil.ConflictError && tcName != "duplicate-in-set" {
+						assert.ErrorIs(t, err, fsutil.ErrConflict)
+					}
+					return
+				}
+				require.NoError(t, err)
+				assert.Equal(t, expected.Files, describeFiles(t, merged))
+			})
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+)
+
+// ErrSpecialFile is returned (wrapped) by SpecialFilePolicy.Check when the policy is
+// SpecialFilesError and the file is a device node or FIFO.
+var ErrSpecialFile = errors.New("special file")
+
+// A SpecialFilePolicy says what to do with character devices, block devices, and FIFOs (named
+// pipes) when reading files in to a layer.  Base images occasionally include these (usually
+// something like /dev/null left over from a build), and whether they make sense in the output
+// depends on what the output is for.
+//
+// SpecialFilePolicy implements pflag.Value, so it may be used directly as a command-line flag.
+type SpecialFilePolicy int
+
+const (
+	// SpecialFilesPreserve keeps special files as they are.  This is the zero value.
+	SpecialFilesPreserve SpecialFilePolicy = iota
+	// SpecialFilesStrip silently drops special files.
+	SpecialFilesStrip
+	// SpecialFilesError refuses to read anything containing a special file.
+	SpecialFilesError
+)
+
+// String implements pflag.Value.
+func (p SpecialFilePolicy) String() string {
+	switch p {
+	case SpecialFilesPreserve:
+		return "preserve"
+	case SpecialFilesStrip:
+		return "strip"
+	case SpecialFilesError:
+		return "error"
+	default:
+		return fmt.Sprintf("SpecialFilePolicy(%d)", int(p))
+	}
+}
+
+// Set implements pflag.Value.
+func (p *SpecialFilePolicy) Set(str string) error {
+	for _, policy := range []SpecialFilePolicy{SpecialFilesPreserve, SpecialFilesStrip, SpecialFilesError} {
+		if str == policy.String() {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid special file policy %q: must be one of \"preserve\", \"strip\", or \"error\"", str)
+}
+
+// Type implements pflag.Value.
+func (SpecialFilePolicy) Type() string {
+	return "policy"
+}
+
+// IsSpecialFile returns whether the tar header describes a character device, block device, or
+// FIFO.
+func IsSpecialFile(hdr *tar.Header) bool {
+	switch hdr.Typeflag {
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return true
+	default:
+		return false
+	}
+}
+
+// Check applies the policy to a tar header, returning whether the file should be kept.  An error is
+// only returned for special files under SpecialFilesError.
+func (p SpecialFilePolicy) Check(hdr *tar.Header) (keep bool, err error) {
+	if !IsSpecialFile(hdr) {
+		return true, nil
+	}
+	switch p {
+	case SpecialFilesStrip:
+		return false, nil
+	case SpecialFilesError:
+		var kind string
+		switch hdr.Typeflag {
+		case tar.TypeChar:
+			kind = "character device"
+		case tar.TypeBlock:
+			kind = "block device"
+		default:
+			kind = "FIFO"
+		}
+		return false, fmt.Errorf("%w: %q is a %s", ErrSpecialFile, hdr.Name, kind)
+	default:
+		return true, nil
+	}
+}
@@ -0,0 +1,255 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The functions in this file operate on sets of FileReferences.  None of them modify the slice
+// that they are passed; they all return a new slice sorted with SortFileReferences, and any
+// callbacks are called in that same order, so that the results are deterministic.
+
+// SortFileReferences sorts files in to the order that LayerFromFileReferences writes them (see
+// PathLess).
+func SortFileReferences(files []FileReference) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return PathLess(files[i].FullName(), files[j].FullName())
+	})
+}
+
+func sortedCopy(files []FileReference) []FileReference {
+	ret := make([]FileReference, len(files))
+	copy(ret, files)
+	SortFileReferences(ret)
+	return ret
+}
+
+// FileReferencesFromMap returns the values of a map of FileReferences (such as is passed to a
+// bdist.PostInstallHook), sorted with SortFileReferences.
+func FileReferencesFromMap(vfs map[string]FileReference) []FileReference {
+	ret := make([]FileReference, 0, len(vfs))
+	for _, file := range vfs {
+		ret = append(ret, file)
+	}
+	SortFileReferences(ret)
+	return ret
+}
+
+// FileReferencesToMap returns a map of FileReferences keyed by FullName.  It is an error for two
+// files to have the same name.
+func FileReferencesToMap(files []FileReference) (map[string]FileReference, error) {
+	ret := make(map[string]FileReference, len(files))
+	for _, file := range files {
+		name := file.FullName()
+		if _, dup := ret[name]; dup {
+			return nil, fmt.Errorf("fsutil.FileReferencesToMap: duplicate file: %q", name)
+		}
+		ret[name] = file
+	}
+	return ret, nil
+}
+
+// IsUnder returns whether the slash-separated path name is dir or is inside of dir.  An empty or
+// "." dir contains everything.
+func IsUnder(name, dir string) bool {
+	return dir == "" || dir == "." || name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// MatchGlob returns the first of the glob patterns (using path.Match syntax) that matches the
+// slash-separated path name, or an empty string if none of them match.  A glob without a "/"
+// matches against each path component individually (so "tests" matches "foo/tests" and
+// "foo/tests/bar.py"); a glob with a "/" is anchored, and matches against the leading path
+// components (so "foo/*.txt" matches "foo/a.txt" and "foo/a.txt/b", but not "bar/foo/a.txt").  In
+// a glob with a "/", a "**" component matches any number (including zero) of path components (so
+// "foo/**/*.txt" matches "foo/a.txt" and "foo/bar/baz/a.txt", and "**/tests" is the same as
+// "tests").
+func MatchGlob(globs []string, name string) string {
+	parts := strings.Split(name, "/")
+	for _, glob := range globs {
+		if strings.Contains(glob, "/") {
+			if matchLeadingParts(strings.Split(glob, "/"), parts) {
+				return glob
+			}
+			continue
+		}
+		for _, part := range parts {
+			if ok, _ := path.Match(glob, part); ok {
+				return glob
+			}
+		}
+	}
+	return ""
+}
+
+// matchLeadingParts returns whether the glob components match the leading path components of a
+// name.
+func matchLeadingParts(glob, parts []string) bool {
+	switch {
+	case len(glob) == 0:
+		return true
+	case glob[0] == "**":
+		return matchLeadingParts(glob[1:], parts) || (len(parts) > 0 && matchLeadingParts(glob, parts[1:]))
+	case len(parts) == 0:
+		return false
+	}
+	if ok, _ := path.Match(glob[0], parts[0]); !ok {
+		return false
+	}
+	return matchLeadingParts(glob[1:], parts[1:])
+}
+
+// Filter returns the files for which keep returns true.
+func Filter(files []FileReference, keep func(FileReference) bool) []FileReference {
+	var ret []FileReference //nolint:prealloc // 'continue' is quite likely
+	for _, file := range sortedCopy(files) {
+		if !keep(file) {
+			continue
+		}
+		ret = append(ret, file)
+	}
+	return ret
+}
+
+// Rename returns the files with each file's name replaced by rename(name).  Hardlinks (files whose
+// Sys() is a *tar.Header with a TypeLink Typeflag) have their targets renamed too.  It is an error
+// for rename to return an invalid name (see io/fs.ValidPath), or for two files to end up with the
+// same name.
+func Rename(files []FileReference, rename func(name string) string) ([]FileReference, error) {
+	ret := make([]FileReference, 0, len(files))
+	seen := make(map[string]string, len(files))
+	for _, file := range sortedCopy(files) {
+		oldName := file.FullName()
+		newName := rename(oldName)
+		if !fs.ValidPath(newName) || newName == "." {
+			return nil, fmt.Errorf("fsutil.Rename: %q: invalid new name: %q", oldName, newName)
+		}
+		if other, dup := seen[newName]; dup {
+			return nil, fmt.Errorf("fsutil.Rename: %q and %q would both be renamed to %q",
+				other, oldName, newName)
+		}
+		seen[newName] = oldName
+		if newName == oldName && !isHardlink(file) {
+			ret = append(ret, file)
+			continue
+		}
+		renamed := &modifiedFileReference{
+			FileReference: file,
+			fullName:      newName,
+			header:        nil,
+		}
+		if sys, ok := file.Sys().(*tar.Header); ok && sys.Typeflag == tar.TypeLink {
+			hdr := *sys // shallow copy
+			hdr.Linkname = rename(path.Clean(hdr.Linkname))
+			renamed.header = &hdr
+		}
+		ret = append(ret, renamed)
+	}
+	SortFileReferences(ret)
+	return ret, nil
+}
+
+// Relocate returns the files with any that are in the directory oldDir (or are oldDir itself) moved
+// to newDir, as with Rename.  Directory names are slash-separated and without a leading "/"; an
+// empty or "." oldDir relocates all files.
+func Relocate(files []FileReference, oldDir, newDir string) ([]FileReference, error) {
+	oldDir = strings.Trim(path.Clean("/"+oldDir), "/")
+	newDir = strings.Trim(path.Clean("/"+newDir), "/")
+	return Rename(files, func(name string) string {
+		switch {
+		case oldDir == "":
+			return path.Join(newDir, name)
+		case IsUnder(name, oldDir):
+			return path.Join(newDir, strings.TrimPrefix(strings.TrimPrefix(name, oldDir), "/"))
+		default:
+			return name
+		}
+	})
+}
+
+// ModifyHeaders returns the files with their metadata adjusted by modify, which is passed the tar
+// header that LayerFromFileReferences would otherwise write for each file (without the timestamp
+// clamping applied).  This is useful for changing ownership or permissions.  Changing the file type
+// or size is not permitted; the Name is ignored (use Rename for that).
+func ModifyHeaders(files []FileReference, modify func(*tar.Header)) ([]FileReference, error) {
+	ret := make([]FileReference, 0, len(files))
+	for _, file := range sortedCopy(files) {
+		var linkTarget string
+		sys, _ := file.Sys().(*tar.Header)
+		if sys != nil {
+			linkTarget = sys.Linkname
+		}
+		hdr, err := tar.FileInfoHeader(file, linkTarget)
+		if err != nil {
+			return nil, fmt.Errorf("fsutil.ModifyHeaders: %q: %w", file.FullName(), err)
+		}
+		hdr.Name = file.FullName()
+		if xfile, ok := file.(XattrFileReference); ok {
+			SetXattrs(hdr, xfile.Xattrs())
+		}
+		typeflag, size := hdr.Typeflag, hdr.Size
+		modify(hdr)
+		if hdr.Typeflag != typeflag || hdr.Size != size {
+			return nil, fmt.Errorf("fsutil.ModifyHeaders: %q: may not change the file type or size",
+				file.FullName())
+		}
+		ret = append(ret, &modifiedFileReference{
+			FileReference: file,
+			fullName:      file.FullName(),
+			header:        hdr,
+		})
+	}
+	return ret, nil
+}
+
+func isHardlink(file FileReference) bool {
+	sys, ok := file.Sys().(*tar.Header)
+	return ok && sys.Typeflag == tar.TypeLink
+}
+
+// modifiedFileReference is a FileReference with a different name and/or tar header.
+type modifiedFileReference struct {
+	FileReference
+	fullName string
+	header   *tar.Header // nil to use the FileReference's own metadata
+}
+
+var _ XattrFileReference = (*modifiedFileReference)(nil)
+
+func (f *modifiedFileReference) FullName() string { return f.fullName }
+func (f *modifiedFileReference) Name() string     { return path.Base(f.fullName) }
+
+func (f *modifiedFileReference) Mode() fs.FileMode {
+	if f.header != nil {
+		return f.header.FileInfo().Mode()
+	}
+	return f.FileReference.Mode()
+}
+
+func (f *modifiedFileReference) ModTime() time.Time {
+	if f.header != nil {
+		return f.header.ModTime
+	}
+	return f.FileReference.ModTime()
+}
+
+func (f *modifiedFileReference) Sys() interface{} {
+	if f.header != nil {
+		return f.header
+	}
+	return f.FileReference.Sys()
+}
+
+func (f *modifiedFileReference) Xattrs() map[string]string {
+	if f.header != nil {
+		return Xattrs(f.header)
+	}
+	if xfile, ok := f.FileReference.(XattrFileReference); ok {
+		return xfile.Xattrs()
+	}
+	return nil
+}
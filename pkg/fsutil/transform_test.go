@@ -0,0 +1,262 @@
+package fsutil_test
+
+import (
+	"archive/tar"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+func fileNames(files []fsutil.FileReference) []string {
+	ret := make([]string, 0, len(files))
+	for _, file := range files {
+		ret = append(ret, file.FullName())
+	}
+	return ret
+}
+
+func TestSortFileReferences(t *testing.T) {
+	t.Parallel()
+	files := []fsutil.FileReference{
+		mergeReg("b", ""),
+		mergeReg("a-b", ""),
+		mergeReg("a/b/c", ""),
+		mergeDir("a/b", 0o755),
+		mergeDir("a", 0o755),
+	}
+	fsutil.SortFileReferences(files)
+	assert.Equal(t, []string{"a", "a/b", "a/b/c", "a-b", "b"}, fileNames(files))
+}
+
+func TestIsUnder(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		Name     string
+		Dir      string
+		Expected bool
+	}{
+		{"usr/lib", "usr/lib", true},
+		{"usr/lib/a", "usr/lib", true},
+		{"usr/libx", "usr/lib", false},
+		{"usr", "usr/lib", false},
+		{"usr/lib", "", true},
+		{"usr/lib", ".", true},
+	}
+	for _, tc := range testcases {
+		assert.Equal(t, tc.Expected, fsutil.IsUnder(tc.Name, tc.Dir), "IsUnder(%q, %q)", tc.Name, tc.Dir)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Globs    []string
+		Matches  []string
+		NoMatch  []string
+		Expected string
+	}{
+		"component": {
+			Globs:   []string{"tests"},
+			Matches: []string{"tests", "foo/tests", "foo/tests/bar.py"},
+			NoMatch: []string{"foo/tests.py", "foo/mytests"},
+		},
+		"component-wildcard": {
+			Globs:   []string{"*.pyi"},
+			Matches: []string{"a.pyi", "foo/a.pyi"},
+			NoMatch: []string{"a.py", "foo.pyi.txt"},
+		},
+		"anchored": {
+			Globs:   []string{"foo/*.txt"},
+			Matches: []string{"foo/a.txt", "foo/a.txt/b"},
+			NoMatch: []string{"bar/foo/a.txt", "foo/bar/a.txt", "foo"},
+		},
+		"doublestar-middle": {
+			Globs:   []string{"foo/**/*.txt"},
+			Matches: []string{"foo/a.txt", "foo/bar/a.txt", "foo/bar/baz/a.txt"},
+			NoMatch: []string{"a.txt", "bar/foo/a.txt", "foo/a.py"},
+		},
+		"doublestar-leading": {
+			Globs:   []string{"**/tests"},
+			Matches: []string{"tests", "foo/tests", "foo/bar/tests/x.py"},
+			NoMatch: []string{"foo/mytests", "tests.py"},
+		},
+		"doublestar-trailing": {
+			Globs:   []string{"foo/**"},
+			Matches: []string{"foo", "foo/a", "foo/a/b"},
+			NoMatch: []string{"bar/foo", "foobar"},
+		},
+		"doublestar-then-anchored": {
+			Globs:   []string{"**/site-packages/*/tests"},
+			Matches: []string{"usr/lib/python3/site-packages/pkg/tests/t.py", "site-packages/pkg/tests"},
+			NoMatch: []string{"usr/lib/python3/site-packages/pkg/sub/tests"},
+		},
+		"bad-pattern": {
+			Globs:   []string{"["},
+			NoMatch: []string{"[", "a"},
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			for _, name := range tcData.Matches {
+				assert.Equal(t, tcData.Globs[0], fsutil.MatchGlob(tcData.Globs, name), name)
+			}
+			for _, name := range tcData.NoMatch {
+				assert.Equal(t, "", fsutil.MatchGlob(tcData.Globs, name), name)
+			}
+		})
+	}
+
+	// The first matching glob is returned.
+	assert.Equal(t, "*.py", fsutil.MatchGlob([]string{"*.txt", "*.py", "foo"}, "foo/a.py"))
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	files := []fsutil.FileReference{
+		mergeReg("pkg/tests/test_a.py", ""),
+		mergeReg("pkg/a.py", ""),
+		mergeDir("pkg/tests", 0o755),
+		mergeReg("pkg/a.pyi", ""),
+		mergeDir("pkg", 0o755),
+	}
+	orig := fileNames(files)
+
+	var calls []string
+	kept := fsutil.Filter(files, func(file fsutil.FileReference) bool {
+		calls = append(calls, file.FullName())
+		return strings.HasSuffix(file.FullName(), ".py")
+	})
+	assert.Equal(t, []string{"pkg/a.py", "pkg/tests/test_a.py"}, fileNames(kept))
+	// The callback is called in sorted order.
+	assert.Equal(t, []string{"pkg", "pkg/a.py", "pkg/a.pyi", "pkg/tests", "pkg/tests/test_a.py"}, calls)
+
+	// The input isn't modified.
+	assert.Equal(t, orig, fileNames(files))
+}
+
+func TestRename(t *testing.T) {
+	t.Parallel()
+	files := []fsutil.FileReference{
+		mergeReg("a/x", "x"),
+		inMemFile(&tar.Header{Typeflag: tar.TypeLink, Name: "a/y", Linkname: "a/x", Mode: 0o644}, ""),
+		mergeReg("b", "b"),
+	}
+	renamed, err := fsutil.Rename(files, func(name string) string {
+		return strings.Replace(name, "a/", "c/", 1)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c/x", "c/y"}, fileNames(renamed))
+	link, ok := renamed[2].Sys().(*tar.Header)
+	require.True(t, ok)
+	assert.Equal(t, "c/x", link.Linkname)
+	// The original hardlink header isn't modified.
+	orig, ok := files[1].Sys().(*tar.Header)
+	require.True(t, ok)
+	assert.Equal(t, "a/x", orig.Linkname)
+
+	_, err = fsutil.Rename(files, func(string) string { return "same" })
+	assert.EqualError(t, err, `fsutil.Rename: "a/x" and "a/y" would both be renamed to "same"`)
+	_, err = fsutil.Rename(files, func(name string) string { return "/" + name })
+	assert.EqualError(t, err, `fsutil.Rename: "a/x": invalid new name: "/a/x"`)
+}
+
+func TestRelocate(t *testing.T) {
+	t.Parallel()
+	files := []fsutil.FileReference{
+		mergeDir("usr", 0o755),
+		mergeDir("usr/lib", 0o755),
+		mergeReg("usr/lib/a", "a"),
+		mergeDir("usr/lib/sub", 0o755),
+		mergeReg("usr/lib/sub/b", "b"),
+		mergeReg("usr/libx/c", "c"),
+		mergeReg("usr/lib-d", "d"),
+		inMemFile(&tar.Header{Typeflag: tar.TypeLink, Name: "usr/lib/sub/e", Linkname: "usr/lib/a", Mode: 0o644}, ""),
+	}
+	testcases := map[string]struct {
+		OldDir, NewDir string
+		Expected       []string
+		ExpectedLink   string
+	}{
+		"dir": {
+			OldDir: "usr/lib",
+			NewDir: "opt/lib",
+			Expected: []string{
+				"opt/lib", "opt/lib/a", "opt/lib/sub", "opt/lib/sub/b", "opt/lib/sub/e",
+				"usr", "usr/lib-d", "usr/libx/c",
+			},
+			ExpectedLink: "opt/lib/a",
+		},
+		"slashes": {
+			OldDir: "/usr/lib/",
+			NewDir: "/opt/",
+			Expected: []string{
+				"opt", "opt/a", "opt/sub", "opt/sub/b", "opt/sub/e",
+				"usr", "usr/lib-d", "usr/libx/c",
+			},
+			ExpectedLink: "opt/a",
+		},
+		"all": {
+			OldDir: "",
+			NewDir: "prefix",
+			Expected: []string{
+				"prefix/usr", "prefix/usr/lib", "prefix/usr/lib/a", "prefix/usr/lib/sub",
+				"prefix/usr/lib/sub/b", "prefix/usr/lib/sub/e", "prefix/usr/lib-d", "prefix/usr/libx/c",
+			},
+			ExpectedLink: "prefix/usr/lib/a",
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			relocated, err := fsutil.Relocate(files, tcData.OldDir, tcData.NewDir)
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Expected, fileNames(relocated))
+			for _, file := range relocated {
+				if hdr, ok := file.Sys().(*tar.Header); ok && hdr.Typeflag == tar.TypeLink {
+					assert.Equal(t, tcData.ExpectedLink, hdr.Linkname)
+				}
+			}
+		})
+	}
+
+	// Moving a directory on to a file that isn't moved is a conflict.
+	_, err := fsutil.Relocate(files, "usr/lib/sub", "usr/lib")
+	assert.EqualError(t, err, `fsutil.Rename: "usr/lib" and "usr/lib/sub" would both be renamed to "usr/lib"`)
+}
+
+func TestModifyHeaders(t *testing.T) {
+	t.Parallel()
+	files := []fsutil.FileReference{
+		mergeReg("b", "b"),
+		mergeDir("a", 0o755),
+	}
+	modified, err := fsutil.ModifyHeaders(files, func(hdr *tar.Header) {
+		hdr.Uid, hdr.Uname = 1000, "user"
+		hdr.Mode &^= 0o022
+		hdr.Mode |= 0o040
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, fileNames(modified))
+	for _, file := range modified {
+		hdr, ok := file.Sys().(*tar.Header)
+		require.True(t, ok)
+		assert.Equal(t, 1000, hdr.Uid)
+		assert.Equal(t, "user", hdr.Uname)
+	}
+	assert.Equal(t, "drwxr-xr-x", modified[0].Mode().String())
+	assert.Equal(t, "-rw-r--r--", modified[1].Mode().String())
+	content := describeFiles(t, modified)
+	assert.Equal(t, []string{"a/ 0755", "b=b"}, content)
+
+	_, err = fsutil.ModifyHeaders(files, func(hdr *tar.Header) {
+		hdr.Typeflag = tar.TypeSymlink
+	})
+	assert.EqualError(t, err, `fsutil.ModifyHeaders: "a": may not change the file type or size`)
+}
@@ -0,0 +1,82 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"strconv"
+	"time"
+)
+
+// paxWindowsFileAttr is the PAX record that carries a file's Windows file attributes (as a decimal
+// integer) in a Windows container layer; this is the convention used by hcsshim and Docker.
+const paxWindowsFileAttr = "MSWINDOWS.fileattr"
+
+// The Windows file attributes that WindowsLayer uses as defaults; see python.StatFileAttribute for
+// the full list.
+const (
+	windowsAttrDirectory = 0x10
+	windowsAttrArchive   = 0x20
+)
+
+// WindowsFileAttributes returns the Windows file attributes recorded in a tar header, and whether
+// there were any.
+func WindowsFileAttributes(hdr *tar.Header) (uint32, bool) {
+	str, ok := hdr.PAXRecords[paxWindowsFileAttr]
+	if !ok {
+		return 0, false
+	}
+	attrs, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(attrs), true
+}
+
+// SetWindowsFileAttributes records Windows file attributes in a tar header, as a PAX record.
+func SetWindowsFileAttributes(hdr *tar.Header, attrs uint32) {
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string, 1)
+	}
+	hdr.PAXRecords[paxWindowsFileAttr] = strconv.FormatUint(uint64(attrs), 10)
+}
+
+// WindowsLayer returns the files rearranged in to the layout that Windows container layers use:
+// everything in the image's filesystem goes in a top-level "Files" directory, alongside a "Hives"
+// directory for registry hives (which is left empty).  Each file has its Windows file attributes
+// recorded (see SetWindowsFileAttributes); files that don't already have attributes get
+// FILE_ATTRIBUTE_DIRECTORY or FILE_ATTRIBUTE_ARCHIVE.  The "Files" and "Hives" directories
+// themselves get modTime.
+func WindowsLayer(files []FileReference, modTime time.Time) ([]FileReference, error) {
+	files, err := Relocate(files, "", "Files")
+	if err != nil {
+		return nil, err
+	}
+	files, err = ModifyHeaders(files, func(hdr *tar.Header) {
+		if _, ok := WindowsFileAttributes(hdr); ok {
+			return
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			SetWindowsFileAttributes(hdr, windowsAttrDirectory)
+		} else {
+			SetWindowsFileAttributes(hdr, windowsAttrArchive)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"Files", "Hives"} {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     name,
+			Mode:     0o755,
+			ModTime:  modTime,
+		}
+		SetWindowsFileAttributes(hdr, windowsAttrDirectory)
+		files = append(files, &InMemFileReference{
+			FileInfo:  hdr.FileInfo(),
+			MFullName: name,
+			MContent:  nil,
+		})
+	}
+	SortFileReferences(files)
+	return files, nil
+}
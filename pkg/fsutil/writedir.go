@@ -0,0 +1,207 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WriteToDir materializes files on to disk under the directory dest (which is created if it
+// doesn't exist), as if the layer that LayerFromFileReferences would generate were extracted there.
+// Regular files, symlinks, and hardlinks that already exist are replaced; directories that already
+// exist are left as-is, including their permissions, ownership, and timestamps.
+//
+// If chown is true, then the ownership from each file's *tar.Header (see LayerFromFileReferences)
+// is applied, so far as the operating system allows; when it is refused for lack of privileges
+// (such as when not running as root), the files are left owned by the current user.
+//
+// Names that would escape dest (absolute names, names with ".." components, or names below a
+// symlink) are rejected rather than written.  It checks ctx between files, and returns early if
+// ctx is canceled.
+func WriteToDir(ctx context.Context, dest string, files []FileReference, chown bool) error {
+	files = sortedCopy(files)
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return fmt.Errorf("fsutil.WriteToDir: %w", err)
+	}
+	w := &dirWriter{
+		dest:      dest,
+		chown:     chown,
+		checked:   make(map[string]struct{}),
+		chownDeny: false,
+	}
+	var dirs []FileReference
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		created, err := w.write(file)
+		if err != nil {
+			return fmt.Errorf("fsutil.WriteToDir: %s: %w", file.FullName(), err)
+		}
+		if created && file.IsDir() {
+			dirs = append(dirs, file)
+		}
+	}
+	// Set the directory timestamps last, since writing their contents bumps them; deepest first,
+	// for the same reason.
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return PathLess(dirs[j].FullName(), dirs[i].FullName())
+	})
+	for _, dir := range dirs {
+		filename := w.filename(dir.FullName())
+		if err := os.Chtimes(filename, dir.ModTime(), dir.ModTime()); err != nil {
+			return fmt.Errorf("fsutil.WriteToDir: %s: %w", dir.FullName(), err)
+		}
+	}
+	return nil
+}
+
+type dirWriter struct {
+	dest  string
+	chown bool
+	// checked is the set of directories (by slash-separated name) that are known not to be
+	// symlinks.
+	checked map[string]struct{}
+	// chownDeny is set once a chown has been refused for lack of privileges, so that it isn't
+	// attempted for every file.
+	chownDeny bool
+}
+
+func (w *dirWriter) filename(name string) string {
+	return filepath.Join(w.dest, filepath.FromSlash(name))
+}
+
+// checkName validates that name is a relative, clean name that doesn't escape w.dest, and that its
+// parent directories exist and aren't symlinks.
+func (w *dirWriter) checkName(name string) error {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || name == ".." ||
+		strings.HasPrefix(name, "../") {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if _, ok := w.checked[dir]; ok {
+			break
+		}
+		info, err := os.Lstat(w.filename(dir))
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("parent %q is not a directory", dir)
+		}
+		w.checked[dir] = struct{}{}
+	}
+	return nil
+}
+
+// write writes a single file, returning whether it created a new file (rather than leaving an
+// existing directory as-is).
+func (w *dirWriter) write(file FileReference) (bool, error) {
+	name := file.FullName()
+	if err := w.checkName(name); err != nil {
+		return false, err
+	}
+	filename := w.filename(name)
+	header, _ := file.Sys().(*tar.Header)
+
+	existing, err := os.Lstat(filename)
+	switch {
+	case err == nil && existing.IsDir():
+		if file.IsDir() {
+			w.checked[name] = struct{}{}
+			return false, nil
+		}
+		return false, fmt.Errorf("refusing to replace existing directory")
+	case err == nil:
+		if err := os.Remove(filename); err != nil {
+			return false, err
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return false, err
+	}
+
+	switch {
+	case header != nil && header.Typeflag == tar.TypeLink:
+		if err := w.checkName(header.Linkname); err != nil {
+			return false, fmt.Errorf("hardlink: %w", err)
+		}
+		return true, os.Link(w.filename(header.Linkname), filename)
+	case file.Mode().Type() == fs.ModeSymlink:
+		if header == nil {
+			return false, fmt.Errorf("symlink has no target")
+		}
+		if err := os.Symlink(header.Linkname, filename); err != nil {
+			return false, err
+		}
+		return true, w.setOwner(filename, header)
+	case file.IsDir():
+		if err := os.Mkdir(filename, 0o700); err != nil {
+			return false, err
+		}
+		w.checked[name] = struct{}{}
+	case file.Mode().IsRegular():
+		if err := writeFileContent(filename, file); err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("unsupported file type %v", file.Mode().Type())
+	}
+	// Chown before chmod, since chown may clear the setuid and setgid bits.
+	if err := w.setOwner(filename, header); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(filename, file.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return false, err
+	}
+	if !file.IsDir() {
+		if err := os.Chtimes(filename, file.ModTime(), file.ModTime()); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (w *dirWriter) setOwner(filename string, header *tar.Header) error {
+	if !w.chown || w.chownDeny || header == nil {
+		return nil
+	}
+	if err := os.Lchown(filename, header.Uid, header.Gid); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			w.chownDeny = true
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func writeFileContent(filename string, file FileReference) (err error) {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	fh, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _err := fh.Close(); _err != nil && err == nil {
+			err = _err
+		}
+	}()
+	if _, err := io.Copy(fh, reader); err != nil {
+		return err
+	}
+	return nil
+}
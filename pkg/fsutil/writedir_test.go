@@ -0,0 +1,107 @@
+package fsutil_test
+
+import (
+	"archive/tar"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+func inMemFile(header *tar.Header, content string) fsutil.FileReference {
+	header.Size = int64(len(content))
+	return &fsutil.InMemFileReference{
+		FileInfo:  header.FileInfo(),
+		MFullName: header.Name,
+		MContent:  []byte(content),
+	}
+}
+
+func TestWriteToDir(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	files := []fsutil.FileReference{
+		inMemFile(&tar.Header{Typeflag: tar.TypeReg, Name: "usr/bin/tool", Mode: 0o755, ModTime: mtime}, "#!/bin/sh\n"),
+		inMemFile(&tar.Header{Typeflag: tar.TypeDir, Name: "usr", Mode: 0o755, ModTime: mtime}, ""),
+		inMemFile(&tar.Header{Typeflag: tar.TypeDir, Name: "usr/bin", Mode: 0o750, ModTime: mtime}, ""),
+		inMemFile(&tar.Header{Typeflag: tar.TypeReg, Name: "usr/data", Mode: 0o644, ModTime: mtime}, "data"),
+		inMemFile(&tar.Header{Typeflag: tar.TypeLink, Name: "usr/bin/tool2", Linkname: "usr/bin/tool",
+			Mode: 0o755, ModTime: mtime}, ""),
+		inMemFile(&tar.Header{Typeflag: tar.TypeSymlink, Name: "usr/bin/tool3", Linkname: "tool",
+			Mode: 0o777, ModTime: mtime}, ""),
+	}
+
+	dest := filepath.Join(t.TempDir(), "rootfs")
+	require.NoError(t, fsutil.WriteToDir(ctx, dest, files, false))
+
+	content, err := os.ReadFile(filepath.Join(dest, "usr", "data"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(content))
+
+	for name, mode := range map[string]fs.FileMode{
+		"usr":          0o755 | fs.ModeDir,
+		"usr/bin":      0o750 | fs.ModeDir,
+		"usr/bin/tool": 0o755,
+		"usr/data":     0o644,
+	} {
+		info, err := os.Lstat(filepath.Join(dest, filepath.FromSlash(name)))
+		if assert.NoError(t, err) {
+			assert.Equal(t, mode, info.Mode(), name)
+			assert.True(t, mtime.Equal(info.ModTime()), name)
+		}
+	}
+
+	tool, err := os.Stat(filepath.Join(dest, "usr", "bin", "tool"))
+	require.NoError(t, err)
+	tool2, err := os.Stat(filepath.Join(dest, "usr", "bin", "tool2"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(tool, tool2))
+
+	target, err := os.Readlink(filepath.Join(dest, "usr", "bin", "tool3"))
+	require.NoError(t, err)
+	assert.Equal(t, "tool", target)
+
+	// Writing again replaces the files.
+	files[3] = inMemFile(&tar.Header{Typeflag: tar.TypeReg, Name: "usr/data", Mode: 0o600, ModTime: mtime}, "new")
+	require.NoError(t, fsutil.WriteToDir(ctx, dest, files, false))
+	content, err = os.ReadFile(filepath.Join(dest, "usr", "data"))
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+}
+
+func TestWriteToDirEscape(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testcases := map[string][]fsutil.FileReference{
+		"dotdot": {
+			inMemFile(&tar.Header{Typeflag: tar.TypeReg, Name: "../escape", Mode: 0o644}, "x"),
+		},
+		"symlink-parent": {
+			inMemFile(&tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "..", Mode: 0o777}, ""),
+			inMemFile(&tar.Header{Typeflag: tar.TypeReg, Name: "link/escape", Mode: 0o644}, "x"),
+		},
+		"hardlink": {
+			inMemFile(&tar.Header{Typeflag: tar.TypeLink, Name: "escape", Linkname: "../outside", Mode: 0o644}, ""),
+		},
+	}
+	for name, files := range testcases {
+		name, files := name, files
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			parent := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(parent, "outside"), []byte("x"), 0o644))
+			err := fsutil.WriteToDir(ctx, filepath.Join(parent, "rootfs"), files, false)
+			assert.Error(t, err)
+			_, err = os.Lstat(filepath.Join(parent, "escape"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package fsutil
+
+import (
+	"archive/tar"
+	"strings"
+)
+
+// paxSchilyXattr is the prefix of the PAX records that carry extended attributes; this is the
+// convention used by GNU tar, BSD tar, and Docker.
+const paxSchilyXattr = "SCHILY.xattr."
+
+// An XattrFileReference is a FileReference that has extended attributes (such as
+// "security.capability" for a binary that has had `setcap` run on it).  LayerFromFileReferences
+// records these in the layer as PAX records.
+type XattrFileReference interface {
+	FileReference
+
+	// Xattrs returns a map from attribute name (such as "security.capability") to raw value.
+	Xattrs() map[string]string
+}
+
+// Xattrs returns the extended attributes recorded in a tar header, or nil if there are none.
+func Xattrs(hdr *tar.Header) map[string]string {
+	var ret map[string]string
+	for key, val := range hdr.Xattrs { //nolint:staticcheck // we need to support the deprecated field too
+		if ret == nil {
+			ret = make(map[string]string)
+		}
+		ret[key] = val
+	}
+	for key, val := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxSchilyXattr) {
+			continue
+		}
+		if ret == nil {
+			ret = make(map[string]string)
+		}
+		ret[strings.TrimPrefix(key, paxSchilyXattr)] = val
+	}
+	return ret
+}
+
+// SetXattrs records extended attributes in a tar header, as PAX records.  Any existing extended
+// attributes with the same names are overwritten.
+func SetXattrs(hdr *tar.Header, xattrs map[string]string) {
+	if len(xattrs) == 0 {
+		return
+	}
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string, len(xattrs))
+	}
+	for key, val := range xattrs {
+		delete(hdr.Xattrs, key) //nolint:staticcheck // we need to support the deprecated field too
+		hdr.PAXRecords[paxSchilyXattr+key] = val
+	}
+}
+
+// SameXattrs returns whether two tar headers record the same extended attributes.
+func SameXattrs(a, b *tar.Header) bool {
+	aXattrs, bXattrs := Xattrs(a), Xattrs(b)
+	if len(aXattrs) != len(bXattrs) {
+		return false
+	}
+	for key, aVal := range aXattrs {
+		if bVal, ok := bXattrs[key]; !ok || aVal != bVal {
+			return false
+		}
+	}
+	return true
+}
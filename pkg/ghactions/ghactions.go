@@ -0,0 +1,83 @@
+// Package ghactions formats output as GitHub Actions workflow commands, so that errors and
+// warnings show up as annotations on a workflow run (and on the pull request that it is for).
+//
+// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions
+package ghactions
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Properties are the optional properties of an annotation, such as "file", "line", and "title".
+type Properties map[string]string
+
+//nolint:gochecknoglobals // these would be 'const' if they could
+var (
+	messageEscaper  = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	propertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// Command formats a workflow command, such as "::error file=app.py,line=1::Missing semicolon".
+// The properties are sorted by name, so that the output is deterministic.
+func Command(name string, props Properties, message string) string {
+	var ret strings.Builder
+	ret.WriteString("::")
+	ret.WriteString(name)
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		if props[key] != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if i == 0 {
+			ret.WriteString(" ")
+		} else {
+			ret.WriteString(",")
+		}
+		ret.WriteString(key)
+		ret.WriteString("=")
+		ret.WriteString(propertyEscaper.Replace(props[key]))
+	}
+	ret.WriteString("::")
+	ret.WriteString(messageEscaper.Replace(message))
+	return ret.String()
+}
+
+// Error formats an "error" annotation.
+func Error(props Properties, message string) string {
+	return Command("error", props, message)
+}
+
+// Warning formats a "warning" annotation.
+func Warning(props Properties, message string) string {
+	return Command("warning", props, message)
+}
+
+// Formatter is a logrus.Formatter that formats warning-and-higher log entries as annotations, and
+// everything else with the Fallback formatter.
+type Formatter struct {
+	Fallback logrus.Formatter
+}
+
+// Format implements logrus.Formatter.
+func (f Formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var line string
+	switch {
+	case entry.Level <= logrus.ErrorLevel:
+		line = Error(nil, entry.Message)
+	case entry.Level == logrus.WarnLevel:
+		line = Warning(nil, entry.Message)
+	default:
+		return f.Fallback.Format(entry)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(line)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
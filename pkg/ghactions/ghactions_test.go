@@ -0,0 +1,73 @@
+package ghactions_test
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/ghactions"
+)
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Name    string
+		Props   ghactions.Properties
+		Message string
+		Output  string
+	}{
+		"simple": {
+			Name:    "error",
+			Message: "something went wrong",
+			Output:  "::error::something went wrong",
+		},
+		"props": {
+			Name:    "warning",
+			Props:   ghactions.Properties{"title": "record", "file": "foo.whl", "line": ""},
+			Message: "missing",
+			Output:  "::warning file=foo.whl,title=record::missing",
+		},
+		"escaping": {
+			Name:    "error",
+			Props:   ghactions.Properties{"title": "a:b,c"},
+			Message: "100%\nsure",
+			Output:  "::error title=a%3Ab%2Cc::100%25%0Asure",
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tcData.Output, ghactions.Command(tcData.Name, tcData.Props, tcData.Message))
+		})
+	}
+}
+
+func TestFormatter(t *testing.T) {
+	t.Parallel()
+	formatter := ghactions.Formatter{
+		Fallback: &logrus.TextFormatter{ //nolint:exhaustivestruct
+			DisableTimestamp: true,
+			DisableColors:    true,
+		},
+	}
+	logger := logrus.New()
+
+	out, err := formatter.Format(&logrus.Entry{ //nolint:exhaustivestruct
+		Logger:  logger,
+		Level:   logrus.ErrorLevel,
+		Message: "oops",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "::error::oops\n", string(out))
+
+	out, err = formatter.Format(&logrus.Entry{ //nolint:exhaustivestruct
+		Logger:  logger,
+		Level:   logrus.InfoLevel,
+		Message: "hello",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "level=info msg=hello\n", string(out))
+}
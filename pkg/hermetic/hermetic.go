@@ -0,0 +1,35 @@
+// Package hermetic helps enforce that a build does not use the network, so that it can be shown to
+// depend only on its local inputs (vendored wheels, local base image files, and so on).
+package hermetic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNetwork is returned (wrapped) when something tries to use the network in hermetic mode.
+var ErrNetwork = errors.New("network access is forbidden in hermetic mode")
+
+// Transport is an http.RoundTripper that refuses every request with an error wrapping ErrNetwork.
+// Installing it as http.DefaultTransport catches any HTTP client that wasn't explicitly given a
+// different transport.
+type Transport struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNetwork, req.Method, req.URL.Redacted())
+}
+
+// Check returns an error wrapping ErrNetwork if enabled is set; what describes the network access
+// that would have been made.  Use it to fail fast, with a clear error, before starting work that
+// would need the network.
+func Check(enabled bool, what string) error {
+	if enabled {
+		return fmt.Errorf("%w: %s", ErrNetwork, what)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package hermetic_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/hermetic"
+)
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: hermetic.Transport{}} //nolint:exhaustivestruct
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+	assert.ErrorIs(t, err, hermetic.ErrNetwork)
+	assert.False(t, called)
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, hermetic.Check(false, "downloading"))
+	err := hermetic.Check(true, "downloading")
+	assert.ErrorIs(t, err, hermetic.ErrNetwork)
+	assert.Contains(t, err.Error(), "downloading")
+}
@@ -0,0 +1,71 @@
+// Package history edits the history entries in an image's config, which record how each layer
+// was created.  The history is informational-only (the layers themselves are unchanged), but some
+// scanners and policies inspect it.
+package history
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// A Rewrite is a regular-expression replacement to apply to the "created_by" of history entries.
+// The Replacement may refer to submatches as with regexp.Regexp.ReplaceAllString.
+type Rewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Options says which edits Edit should make.
+type Options struct {
+	// DropEmpty drops the history entries that don't correspond to a layer ("empty_layer"
+	// entries, such as those that a Dockerfile's ENV or LABEL instructions create in a base
+	// image).
+	DropEmpty bool
+
+	// CreatedBy is a list of rewrites to apply, in order, to the "created_by" of each entry.
+	CreatedBy []Rewrite
+
+	// ClampCreated, if non-zero, is the latest "created" timestamp to allow; later timestamps
+	// (on history entries, and on the image config itself) are set to ClampCreated.
+	ClampCreated time.Time
+}
+
+// Edit returns a copy of img with its history edited according to opts.
+func Edit(img ociv1.Image, opts Options) (ociv1.Image, error) {
+	origConfig, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("history.Edit: %w", err)
+	}
+	config := origConfig.DeepCopy()
+
+	clamp := func(t ociv1.Time) ociv1.Time {
+		if !opts.ClampCreated.IsZero() && t.After(opts.ClampCreated) {
+			return ociv1.Time{Time: opts.ClampCreated}
+		}
+		return t
+	}
+
+	history := make([]ociv1.History, 0, len(config.History))
+	for _, entry := range config.History {
+		if opts.DropEmpty && entry.EmptyLayer {
+			continue
+		}
+		for _, rewrite := range opts.CreatedBy {
+			entry.CreatedBy = rewrite.Pattern.ReplaceAllString(entry.CreatedBy, rewrite.Replacement)
+		}
+		entry.Created = clamp(entry.Created)
+		history = append(history, entry)
+	}
+	config.History = history
+	config.Created = clamp(config.Created)
+
+	ret, err := mutate.ConfigFile(img, config)
+	if err != nil {
+		return nil, fmt.Errorf("history.Edit: %w", err)
+	}
+	return ret, nil
+}
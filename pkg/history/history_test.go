@@ -0,0 +1,116 @@
+package history_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/history"
+)
+
+func TestEdit(t *testing.T) {
+	t.Parallel()
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	layer, err := random.Layer(64, "application/vnd.docker.image.rootfs.diff.tar.gzip")
+	require.NoError(t, err)
+	img, err := mutate.Append(empty.Image,
+		mutate.Addendum{ //nolint:exhaustivestruct
+			Layer: layer,
+			History: ociv1.History{ //nolint:exhaustivestruct
+				Created:   ociv1.Time{Time: t1},
+				CreatedBy: "/bin/sh -c #(nop) ADD file:0123456789abcdef in / ",
+			},
+		})
+	require.NoError(t, err)
+	configFile, err := img.ConfigFile()
+	require.NoError(t, err)
+	configFile = configFile.DeepCopy()
+	configFile.Created = ociv1.Time{Time: t2}
+	configFile.History = append(configFile.History, ociv1.History{ //nolint:exhaustivestruct
+		Created:    ociv1.Time{Time: t2},
+		CreatedBy:  "/bin/sh -c #(nop)  ENV SECRET=hunter2",
+		EmptyLayer: true,
+	})
+	img, err = mutate.ConfigFile(img, configFile)
+	require.NoError(t, err)
+
+	testcases := map[string]struct {
+		Input  history.Options
+		Output []ociv1.History
+	}{
+		"noop": {
+			Input:  history.Options{}, //nolint:exhaustivestruct
+			Output: configFile.History,
+		},
+		"drop-empty": {
+			Input: history.Options{ //nolint:exhaustivestruct
+				DropEmpty: true,
+			},
+			Output: configFile.History[:1],
+		},
+		"rewrite": {
+			Input: history.Options{ //nolint:exhaustivestruct
+				CreatedBy: []history.Rewrite{
+					{Pattern: regexp.MustCompile(`^/bin/sh -c #\(nop\) +`), Replacement: ""},
+					{Pattern: regexp.MustCompile(`(SECRET)=.*`), Replacement: "${1}=REDACTED"},
+				},
+			},
+			Output: []ociv1.History{
+				{Created: ociv1.Time{Time: t1}, CreatedBy: "ADD file:0123456789abcdef in / "},
+				{Created: ociv1.Time{Time: t2}, CreatedBy: "ENV SECRET=REDACTED", EmptyLayer: true},
+			},
+		},
+		"clamp": {
+			Input: history.Options{ //nolint:exhaustivestruct
+				ClampCreated: clamp,
+			},
+			Output: []ociv1.History{
+				{Created: ociv1.Time{Time: t1}, CreatedBy: configFile.History[0].CreatedBy},
+				{Created: ociv1.Time{Time: clamp}, CreatedBy: configFile.History[1].CreatedBy, EmptyLayer: true},
+			},
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			edited, err := history.Edit(img, tcData.Input)
+			require.NoError(t, err)
+			editedConfig, err := edited.ConfigFile()
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Output, editedConfig.History)
+			if tcData.Input.ClampCreated.IsZero() {
+				assert.True(t, editedConfig.Created.Equal(t2))
+			} else {
+				assert.True(t, editedConfig.Created.Equal(clamp))
+			}
+
+			// The layers are unchanged.
+			origLayers, err := img.Layers()
+			require.NoError(t, err)
+			editedLayers, err := edited.Layers()
+			require.NoError(t, err)
+			require.Len(t, editedLayers, len(origLayers))
+			origDigest, err := origLayers[0].Digest()
+			require.NoError(t, err)
+			editedDigest, err := editedLayers[0].Digest()
+			require.NoError(t, err)
+			assert.Equal(t, origDigest, editedDigest)
+		})
+	}
+
+	// The original image is unchanged.
+	origConfig, err := img.ConfigFile()
+	require.NoError(t, err)
+	assert.Len(t, origConfig.History, 2)
+}
@@ -0,0 +1,218 @@
+// Package httpconfig builds the HTTP transport that is used for talking to index servers and OCI
+// registries, with support for proxies, custom CA bundles, and client certificates (mTLS), either
+// for all hosts or for specific hosts.
+package httpconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// TLS is the TLS settings for talking to a server.
+type TLS struct {
+	// CACert is the name of a PEM file of CA certificates to trust in addition to the system's
+	// trusted CAs.
+	CACert string `json:"caCert,omitempty"`
+	// ClientCert is the name of a PEM file containing the client certificate to present to the
+	// server.  If ClientKey is empty, then the private key is also read from it.
+	ClientCert string `json:"clientCert,omitempty"`
+	// ClientKey is the name of a PEM file containing the private key for ClientCert.
+	ClientKey string `json:"clientKey,omitempty"`
+}
+
+// Config is the settings for the HTTP transport.
+type Config struct {
+	// Proxy is the URL of a proxy server to use for both "http://" and "https://" requests.  If
+	// empty, the proxy is taken from the $HTTPS_PROXY and $HTTP_PROXY environment variables (or
+	// lowercase versions of them).
+	Proxy string
+	// NoProxy is a comma-separated list of hosts, domains, and IP ranges that are reached
+	// without the proxy, in the same format as the $NO_PROXY environment variable.  If empty,
+	// it is taken from $NO_PROXY (or $no_proxy).
+	NoProxy string
+
+	// TLS is the settings for all hosts that are not in Hosts.
+	TLS
+
+	// Hosts is per-host TLS settings, keyed by either "HOST" or "HOST:PORT" (with "HOST:PORT"
+	// taking precedence).  The CA certificates in a host's settings are trusted in addition to
+	// the ones in the top-level TLS settings; a host's client certificate replaces the
+	// top-level one.
+	Hosts map[string]TLS
+}
+
+// IsZero returns whether cfg leaves everything at the default, such that http.DefaultTransport
+// would behave the same as cfg.Transport().
+func (cfg Config) IsZero() bool {
+	return cfg.Proxy == "" && cfg.NoProxy == "" && cfg.TLS == (TLS{}) && len(cfg.Hosts) == 0
+}
+
+// Transport returns an http.RoundTripper with the settings in cfg, based on
+// http.DefaultTransport.  Files named in cfg are read immediately, so that a problem with them
+// is reported up front rather than on the first request.
+func (cfg Config) Transport() (http.RoundTripper, error) {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("httpconfig.Config.Transport: http.DefaultTransport is not an *http.Transport")
+	}
+
+	proxyCfg := httpproxy.FromEnvironment()
+	if cfg.Proxy != "" {
+		if _, err := url.Parse(cfg.Proxy); err != nil {
+			return nil, fmt.Errorf("httpconfig.Config.Transport: invalid proxy: %w", err)
+		}
+		proxyCfg.HTTPProxy = cfg.Proxy
+		proxyCfg.HTTPSProxy = cfg.Proxy
+	}
+	if cfg.NoProxy != "" {
+		proxyCfg.NoProxy = cfg.NoProxy
+	}
+	proxyFunc := proxyCfg.ProxyFunc()
+
+	newTransport := func(settings []TLS) (*http.Transport, error) {
+		tlsConfig, err := tlsConfig(settings)
+		if err != nil {
+			return nil, err
+		}
+		transport := base.Clone()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+		transport.TLSClientConfig = tlsConfig
+		return transport, nil
+	}
+
+	fallback, err := newTransport([]TLS{cfg.TLS})
+	if err != nil {
+		return nil, fmt.Errorf("httpconfig.Config.Transport: %w", err)
+	}
+	if len(cfg.Hosts) == 0 {
+		return fallback, nil
+	}
+	hosts := make(map[string]*http.Transport, len(cfg.Hosts))
+	for host, settings := range cfg.Hosts {
+		hosts[host], err = newTransport([]TLS{cfg.TLS, settings})
+		if err != nil {
+			return nil, fmt.Errorf("httpconfig.Config.Transport: host %q: %w", host, err)
+		}
+	}
+	return &hostTransport{
+		fallback: fallback,
+		hosts:    hosts,
+	}, nil
+}
+
+// tlsConfig returns a *tls.Config for the merged settings; later entries take precedence, as
+// described for Config.Hosts.  It returns nil if the settings are all empty.
+func tlsConfig(settings []TLS) (*tls.Config, error) {
+	var ret *tls.Config
+	for _, setting := range settings {
+		if setting == (TLS{}) {
+			continue
+		}
+		if ret == nil {
+			ret = &tls.Config{ //nolint:exhaustivestruct // only set what we need
+				MinVersion: tls.VersionTLS12,
+			}
+		}
+		if setting.CACert != "" {
+			if ret.RootCAs == nil {
+				pool, err := x509.SystemCertPool()
+				if err != nil {
+					pool = x509.NewCertPool()
+				}
+				ret.RootCAs = pool
+			}
+			pem, err := os.ReadFile(setting.CACert)
+			if err != nil {
+				return nil, err
+			}
+			if !ret.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%s: no PEM certificates found", setting.CACert)
+			}
+		}
+		switch {
+		case setting.ClientCert != "":
+			keyFile := setting.ClientKey
+			if keyFile == "" {
+				keyFile = setting.ClientCert
+			}
+			cert, err := tls.LoadX509KeyPair(setting.ClientCert, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("client certificate: %w", err)
+			}
+			ret.Certificates = []tls.Certificate{cert}
+		case setting.ClientKey != "":
+			return nil, errors.New("a client key is set without a client certificate")
+		}
+	}
+	return ret, nil
+}
+
+// hostTransport dispatches each request to a per-host http.Transport.
+type hostTransport struct {
+	fallback *http.Transport
+	hosts    map[string]*http.Transport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := t.hosts[req.URL.Host]; ok {
+		return transport.RoundTrip(req)
+	}
+	if transport, ok := t.hosts[req.URL.Hostname()]; ok {
+		return transport.RoundTrip(req)
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections in all of the per-host transports; it is called by
+// (*http.Client).CloseIdleConnections.
+func (t *hostTransport) CloseIdleConnections() {
+	t.fallback.CloseIdleConnections()
+	for _, transport := range t.hosts {
+		transport.CloseIdleConnections()
+	}
+}
+
+// ParseHost parses a per-host TLS setting from the command line, of the form
+// "HOST[:PORT],SETTING=VALUE[,SETTING=VALUE...]", where SETTING is one of "ca-cert",
+// "client-cert", or "client-key".
+func ParseHost(str string) (string, TLS, error) {
+	var settings TLS
+	parts := strings.Split(str, ",")
+	host := parts[0]
+	if host == "" || strings.Contains(host, "=") {
+		return "", settings, fmt.Errorf("invalid host TLS setting %q: must start with 'HOST,'", str)
+	}
+	if len(parts) == 1 {
+		return "", settings, fmt.Errorf("invalid host TLS setting %q: no settings given", str)
+	}
+	for _, part := range parts[1:] {
+		eq := strings.Index(part, "=")
+		if eq < 0 {
+			return "", settings, fmt.Errorf("invalid host TLS setting %q: %q is not SETTING=VALUE", str, part)
+		}
+		key, val := part[:eq], part[eq+1:]
+		switch key {
+		case "ca-cert":
+			settings.CACert = val
+		case "client-cert":
+			settings.ClientCert = val
+		case "client-key":
+			settings.ClientKey = val
+		default:
+			return "", settings, fmt.Errorf("invalid host TLS setting %q: unknown setting %q: "+
+				"must be one of 'ca-cert', 'client-cert', or 'client-key'", str, key)
+		}
+	}
+	return host, settings, nil
+}
@@ -0,0 +1,260 @@
+package httpconfig_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/httpconfig"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate signed by parent (or self-signed if parent is nil).
+func newTestCert(t *testing.T, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{ //nolint:exhaustivestruct
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test"}, //nolint:exhaustivestruct
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{ //nolint:exhaustivestruct
+		Certificate: [][]byte{c.cert.Raw},
+		PrivateKey:  c.key,
+	}
+}
+
+// writePEM writes the certificate (and the key, if withKey) to a file.
+func (c *testCert) writePEM(t *testing.T, withKey bool) string {
+	t.Helper()
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}) //nolint:exhaustivestruct
+	if withKey {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		require.NoError(t, err)
+		keyBlock := &pem.Block{Type: "EC PRIVATE KEY", Bytes: der} //nolint:exhaustivestruct
+		content = append(content, pem.EncodeToMemory(keyBlock)...)
+	}
+	file, err := os.CreateTemp(t.TempDir(), "*.pem")
+	require.NoError(t, err)
+	_, err = file.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	return file.Name()
+}
+
+func get(t *testing.T, transport http.RoundTripper, url string) (string, error) {
+	t.Helper()
+	client := &http.Client{Transport: transport} //nolint:exhaustivestruct
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestTLS(t *testing.T) {
+	t.Parallel()
+	ca := newTestCert(t, nil, true)
+	serverCert := newTestCert(t, ca, false)
+	clientCert := newTestCert(t, ca, false)
+	caFile := ca.writePEM(t, false)
+	clientFile := clientCert.writePEM(t, true)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{ //nolint:exhaustivestruct
+		Certificates: []tls.Certificate{serverCert.tlsCert()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	hostPort := server.Listener.Addr().String()
+
+	testcases := map[string]struct {
+		Config httpconfig.Config
+		OK     bool
+	}{
+		"default": {
+			Config: httpconfig.Config{}, //nolint:exhaustivestruct
+			OK:     false,
+		},
+		"ca-only": {
+			Config: httpconfig.Config{ //nolint:exhaustivestruct
+				TLS: httpconfig.TLS{CACert: caFile}, //nolint:exhaustivestruct
+			},
+			OK: false,
+		},
+		"global": {
+			Config: httpconfig.Config{ //nolint:exhaustivestruct
+				TLS: httpconfig.TLS{CACert: caFile, ClientCert: clientFile}, //nolint:exhaustivestruct
+			},
+			OK: true,
+		},
+		"host": {
+			Config: httpconfig.Config{ //nolint:exhaustivestruct
+				TLS: httpconfig.TLS{CACert: caFile}, //nolint:exhaustivestruct
+				Hosts: map[string]httpconfig.TLS{
+					"127.0.0.1": {ClientCert: clientFile}, //nolint:exhaustivestruct
+				},
+			},
+			OK: true,
+		},
+		"host-port": {
+			Config: httpconfig.Config{ //nolint:exhaustivestruct
+				Hosts: map[string]httpconfig.TLS{
+					"127.0.0.1": {CACert: caFile},                         //nolint:exhaustivestruct
+					hostPort:    {CACert: caFile, ClientCert: clientFile}, //nolint:exhaustivestruct
+				},
+			},
+			OK: true,
+		},
+		"other-host": {
+			Config: httpconfig.Config{ //nolint:exhaustivestruct
+				Hosts: map[string]httpconfig.TLS{
+					"example.com": {CACert: caFile, ClientCert: clientFile}, //nolint:exhaustivestruct
+				},
+			},
+			OK: false,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			transport, err := tcData.Config.Transport()
+			require.NoError(t, err)
+			body, err := get(t, transport, server.URL)
+			if tcData.OK {
+				require.NoError(t, err)
+				assert.Equal(t, "test", body)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	_, err := httpconfig.Config{ //nolint:exhaustivestruct
+		TLS: httpconfig.TLS{CACert: clientFile, ClientKey: clientFile}, //nolint:exhaustivestruct
+	}.Transport()
+	assert.Error(t, err)
+	_, err = httpconfig.Config{ //nolint:exhaustivestruct
+		TLS: httpconfig.TLS{CACert: filepath.Join(t.TempDir(), "missing.pem")}, //nolint:exhaustivestruct
+	}.Transport()
+	assert.Error(t, err)
+}
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "proxied "+r.URL.String())
+	}))
+	t.Cleanup(proxy.Close)
+
+	transport, err := httpconfig.Config{ //nolint:exhaustivestruct
+		Proxy:   proxy.URL,
+		NoProxy: "direct.invalid",
+	}.Transport()
+	require.NoError(t, err)
+
+	body, err := get(t, transport, "http://example.invalid/simple/")
+	require.NoError(t, err)
+	assert.Equal(t, "proxied http://example.invalid/simple/", body)
+
+	// Hosts in NoProxy are dialed directly, which fails for a .invalid name.
+	_, err = get(t, transport, "http://direct.invalid/simple/")
+	assert.Error(t, err)
+}
+
+func TestParseHost(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Input    string
+		Host     string
+		Settings httpconfig.TLS
+		Err      bool
+	}{
+		"full": {
+			Input: "registry.example.com:5000,ca-cert=ca.pem,client-cert=c.pem,client-key=k.pem",
+			Host:  "registry.example.com:5000",
+			Settings: httpconfig.TLS{
+				CACert:     "ca.pem",
+				ClientCert: "c.pem",
+				ClientKey:  "k.pem",
+			},
+		},
+		"ca": {
+			Input:    "pypi.example.com,ca-cert=ca.pem",
+			Host:     "pypi.example.com",
+			Settings: httpconfig.TLS{CACert: "ca.pem"}, //nolint:exhaustivestruct
+		},
+		"no-host":    {Input: "ca-cert=ca.pem", Err: true},              //nolint:exhaustivestruct
+		"no-setting": {Input: "pypi.example.com", Err: true},            //nolint:exhaustivestruct
+		"bad-part":   {Input: "pypi.example.com,ca.pem", Err: true},     //nolint:exhaustivestruct
+		"unknown":    {Input: "pypi.example.com,cert=c.pem", Err: true}, //nolint:exhaustivestruct
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			host, settings, err := httpconfig.ParseHost(tcData.Input)
+			if tcData.Err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Host, host)
+			assert.Equal(t, tcData.Settings, settings)
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Package passwd edits the user and group databases (/etc/passwd, /etc/group, and their shadow
+// counterparts) of an image, so that non-root images can be built without running useradd in a
+// container.
+package passwd
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+// A User is a user account to add.
+type User struct {
+	// Name is the user name; it is required.
+	Name string
+	// UID is the numeric user ID.
+	UID int
+	// Group is the name of the user's primary group; if empty, it is the same as Name.
+	Group string
+	// GID is the numeric ID of the primary group; if negative, it is the same as UID.  If the
+	// group already exists then GID must match it (or be negative, to use the existing group's
+	// ID only if Group is also empty).
+	GID int
+	// Gecos is the "comment" field, usually the user's full name; it may be empty.
+	Gecos string
+	// Home is the absolute path of the home directory; if empty, it is "/home/NAME".  It is
+	// created (owned by the user, with mode HomeMode) if it doesn't already exist.
+	Home string
+	// HomeMode is the permissions of a newly-created home directory; if zero, it is 0o755.
+	HomeMode int64
+	// Shell is the login shell; if empty, it is "/sbin/nologin".
+	Shell string
+}
+
+func (u User) withDefaults() User {
+	if u.Group == "" {
+		u.Group = u.Name
+	}
+	if u.Home == "" {
+		u.Home = "/home/" + u.Name
+	}
+	if u.HomeMode == 0 {
+		u.HomeMode = 0o755
+	}
+	if u.Shell == "" {
+		u.Shell = "/sbin/nologin"
+	}
+	return u
+}
+
+func validField(str string) bool {
+	return !strings.ContainsAny(str, ":\n")
+}
+
+// AddUser adds user (and, if it doesn't already exist, the user's primary group) to the files
+// in editor, and creates the user's home directory; the files that it writes have their
+// modification time set to mtime.  /etc/shadow and /etc/gshadow are only updated if they already
+// exist, and the user is given a locked password.
+//
+// It is an error if the user name or UID is already in use, or if the group exists with a
+// different GID.
+func AddUser(editor *squash.Editor, user User, mtime time.Time) error {
+	user = user.withDefaults()
+	if user.Name == "" {
+		return fmt.Errorf("passwd.AddUser: user name is required")
+	}
+	for _, field := range []string{user.Name, user.Group, user.Gecos, user.Home, user.Shell} {
+		if !validField(field) {
+			return fmt.Errorf("passwd.AddUser: invalid field %q: must not contain ':' or newlines", field)
+		}
+	}
+	if user.UID < 0 {
+		return fmt.Errorf("passwd.AddUser: invalid UID %d", user.UID)
+	}
+	if !path.IsAbs(user.Home) {
+		return fmt.Errorf("passwd.AddUser: home directory must be absolute: %q", user.Home)
+	}
+
+	if err := addUser(editor, user, mtime); err != nil {
+		return fmt.Errorf("passwd.AddUser: %w", err)
+	}
+	return nil
+}
+
+func addUser(editor *squash.Editor, user User, mtime time.Time) error {
+	passwdLines, passwdHdr, err := readDB(editor, "etc/passwd")
+	if err != nil {
+		return err
+	}
+	groupLines, groupHdr, err := readDB(editor, "etc/group")
+	if err != nil {
+		return err
+	}
+
+	for _, fields := range passwdLines {
+		if len(fields) < 3 {
+			continue
+		}
+		if fields[0] == user.Name {
+			return fmt.Errorf("/etc/passwd: user %q already exists", user.Name)
+		}
+		if fields[2] == strconv.Itoa(user.UID) {
+			return fmt.Errorf("/etc/passwd: UID %d is already used by user %q", user.UID, fields[0])
+		}
+	}
+
+	newGroup := true
+	for _, fields := range groupLines {
+		if len(fields) < 3 {
+			continue
+		}
+		switch {
+		case fields[0] == user.Group:
+			gid, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return fmt.Errorf("/etc/group: group %q: invalid GID %q", user.Group, fields[2])
+			}
+			if user.GID >= 0 && user.GID != gid {
+				return fmt.Errorf("/etc/group: group %q already exists with GID %d, not %d",
+					user.Group, gid, user.GID)
+			}
+			user.GID = gid
+			newGroup = false
+		case user.GID >= 0 && fields[2] == strconv.Itoa(user.GID):
+			return fmt.Errorf("/etc/group: GID %d is already used by group %q", user.GID, fields[0])
+		}
+	}
+	if user.GID < 0 {
+		user.GID = user.UID
+		for _, fields := range groupLines {
+			if len(fields) >= 3 && fields[2] == strconv.Itoa(user.GID) {
+				return fmt.Errorf("/etc/group: GID %d is already used by group %q", user.GID, fields[0])
+			}
+		}
+	}
+
+	if err := ensureDir(editor, "etc", mtime); err != nil {
+		return err
+	}
+
+	passwdLines = append(passwdLines, []string{
+		user.Name, "x", strconv.Itoa(user.UID), strconv.Itoa(user.GID), user.Gecos, user.Home, user.Shell,
+	})
+	if err := writeDB(editor, "etc/passwd", passwdHdr, 0o644, passwdLines, mtime); err != nil {
+		return err
+	}
+	if newGroup {
+		groupLines = append(groupLines, []string{user.Group, "x", strconv.Itoa(user.GID), ""})
+		if err := writeDB(editor, "etc/group", groupHdr, 0o644, groupLines, mtime); err != nil {
+			return err
+		}
+	}
+
+	if shadowLines, shadowHdr, err := readDB(editor, "etc/shadow"); err != nil {
+		return err
+	} else if shadowHdr != nil {
+		shadowLines = append(shadowLines, []string{user.Name, "!", "", "", "", "", "", "", ""})
+		if err := writeDB(editor, "etc/shadow", shadowHdr, 0o640, shadowLines, mtime); err != nil {
+			return err
+		}
+	}
+	if newGroup {
+		if gshadowLines, gshadowHdr, err := readDB(editor, "etc/gshadow"); err != nil {
+			return err
+		} else if gshadowHdr != nil {
+			gshadowLines = append(gshadowLines, []string{user.Group, "!", "", ""})
+			if err := writeDB(editor, "etc/gshadow", gshadowHdr, 0o640, gshadowLines, mtime); err != nil {
+				return err
+			}
+		}
+	}
+
+	home := strings.TrimPrefix(path.Clean(user.Home), "/")
+	if home == "" {
+		return nil
+	}
+	if err := ensureDir(editor, path.Dir(home), mtime); err != nil {
+		return err
+	}
+	if _, err := stat(editor, home); err == nil {
+		return nil
+	} else if !notExist(err) {
+		return err
+	}
+	return editor.Add(&tar.Header{ //nolint:exhaustivestruct // only set what we need
+		Typeflag: tar.TypeDir,
+		Name:     home,
+		Mode:     user.HomeMode,
+		Uid:      user.UID,
+		Gid:      user.GID,
+		Uname:    user.Name,
+		Gname:    user.Group,
+		ModTime:  mtime,
+	}, nil)
+}
+
+func notExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, squash.ErrMissing)
+}
+
+func stat(editor *squash.Editor, name string) (*tar.Header, error) {
+	info, err := fs.Stat(editor, name)
+	if err != nil {
+		return nil, err
+	}
+	hdr, ok := info.Sys().(*tar.Header)
+	if !ok {
+		return nil, fmt.Errorf("%s: no tar header", name)
+	}
+	return hdr, nil
+}
+
+// ensureDir creates dir (and its parents) as root-owned 0755 directories, if they don't already
+// exist.
+func ensureDir(editor *squash.Editor, dir string, mtime time.Time) error {
+	if dir == "." || dir == "" {
+		return nil
+	}
+	if _, err := stat(editor, dir); err == nil {
+		return nil
+	} else if !notExist(err) {
+		return err
+	}
+	if err := ensureDir(editor, path.Dir(dir), mtime); err != nil {
+		return err
+	}
+	return editor.Add(&tar.Header{ //nolint:exhaustivestruct // only set what we need
+		Typeflag: tar.TypeDir,
+		Name:     dir,
+		Mode:     0o755,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  mtime,
+	}, nil)
+}
+
+// readDB reads a colon-separated database file, returning its lines split in to fields, and its
+// header (which is nil if the file doesn't exist).
+func readDB(editor *squash.Editor, name string) ([][]string, *tar.Header, error) {
+	hdr, err := stat(editor, name)
+	if err != nil {
+		if notExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	content, err := fs.ReadFile(editor, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var lines [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		lines = append(lines, strings.Split(line, ":"))
+	}
+	return lines, hdr, nil
+}
+
+// writeDB writes a colon-separated database file, keeping the mode and ownership of the existing
+// file (if hdr is non-nil), or else using mode and root ownership.
+func writeDB(
+	editor *squash.Editor, name string, hdr *tar.Header, mode int64, lines [][]string, mtime time.Time,
+) error {
+	var content strings.Builder
+	for _, fields := range lines {
+		content.WriteString(strings.Join(fields, ":"))
+		content.WriteString("\n")
+	}
+	newHdr := &tar.Header{ //nolint:exhaustivestruct // only set what we need
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     mode,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  mtime,
+	}
+	if hdr != nil {
+		newHdr.Mode = hdr.Mode
+		newHdr.Uid = hdr.Uid
+		newHdr.Gid = hdr.Gid
+		newHdr.Uname = hdr.Uname
+		newHdr.Gname = hdr.Gname
+	}
+	return editor.Add(newHdr, []byte(content.String()))
+}
@@ -0,0 +1,154 @@
+package passwd_test
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/passwd"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func baseLayer(t *testing.T, files map[string]string) ociv1.Layer {
+	t.Helper()
+	var refs []fsutil.FileReference
+	for name, content := range files {
+		hdr := &tar.Header{ //nolint:exhaustivestruct
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+		}
+		if content == "" {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Mode = 0o755
+		}
+		if name == "etc/shadow" {
+			hdr.Mode = 0o640
+			hdr.Gid = 42
+			hdr.Gname = "shadow"
+		}
+		refs = append(refs, &fsutil.InMemFileReference{
+			FileInfo:  hdr.FileInfo(),
+			MFullName: name,
+			MContent:  []byte(content),
+		})
+	}
+	layer, err := fsutil.LayerFromFileReferences(refs, time.Time{})
+	require.NoError(t, err)
+	return layer
+}
+
+func stat(t *testing.T, fsys fs.FS, name string) *tar.Header {
+	t.Helper()
+	info, err := fs.Stat(fsys, name)
+	require.NoError(t, err)
+	hdr, _ := info.Sys().(*tar.Header)
+	return hdr
+}
+
+func readFile(t *testing.T, fsys fs.FS, name string) (string, *tar.Header) {
+	t.Helper()
+	content, err := fs.ReadFile(fsys, name)
+	require.NoError(t, err)
+	return string(content), stat(t, fsys, name)
+}
+
+func TestAddUser(t *testing.T) {
+	t.Parallel()
+	mtime := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("scratch", func(t *testing.T) {
+		t.Parallel()
+		editor, err := squash.NewEditor(nil, fsutil.SpecialFilesError)
+		require.NoError(t, err)
+		require.NoError(t, passwd.AddUser(editor, passwd.User{ //nolint:exhaustivestruct
+			Name: "app",
+			UID:  10001,
+			GID:  -1,
+			Home: "/app",
+		}, mtime))
+
+		content, _ := readFile(t, editor, "etc/passwd")
+		assert.Equal(t, "app:x:10001:10001::/app:/sbin/nologin\n", content)
+		content, _ = readFile(t, editor, "etc/group")
+		assert.Equal(t, "app:x:10001:\n", content)
+		hdr := stat(t, editor, "app")
+		assert.Equal(t, byte(tar.TypeDir), hdr.Typeflag)
+		assert.Equal(t, 10001, hdr.Uid)
+		assert.Equal(t, 10001, hdr.Gid)
+		assert.Equal(t, mtime, hdr.ModTime)
+		_, err = fs.Stat(editor, "etc/shadow")
+		assert.Error(t, err)
+	})
+
+	t.Run("base", func(t *testing.T) {
+		t.Parallel()
+		base := baseLayer(t, map[string]string{
+			"etc":         "",
+			"etc/passwd":  "root:x:0:0:root:/root:/bin/sh\nnobody:x:65534:65534:nobody:/:/sbin/nologin\n",
+			"etc/group":   "root:x:0:\nusers:x:100:\nnogroup:x:65534:\n",
+			"etc/shadow":  "root:*:::::::\nnobody:*:::::::\n",
+			"home":        "",
+			"home/.keep":  "x",
+			"etc/motd":    "hello",
+			"usr":         "",
+			"usr/bin":     "",
+			"usr/bin/app": "#!/bin/sh\n",
+		})
+		editor, err := squash.NewEditor([]ociv1.Layer{base}, fsutil.SpecialFilesError)
+		require.NoError(t, err)
+
+		for _, bad := range []passwd.User{
+			{Name: "root", UID: 1000, GID: -1},                  // name in use
+			{Name: "app", UID: 65534, GID: -1},                  // UID in use
+			{Name: "app", UID: 1000, GID: 1000, Group: "users"}, // group GID mismatch
+			{Name: "app", UID: 100, GID: -1},                    // default GID in use
+			{Name: "app:x", UID: 1000, GID: -1},                 // invalid name
+			{Name: "app", UID: 1000, GID: -1, Home: "app"},      // relative home
+		} {
+			assert.Error(t, passwd.AddUser(editor, bad, mtime), bad.Name)
+		}
+
+		require.NoError(t, passwd.AddUser(editor, passwd.User{ //nolint:exhaustivestruct
+			Name:  "app",
+			UID:   1000,
+			GID:   -1,
+			Group: "users",
+		}, mtime))
+
+		content, _ := readFile(t, editor, "etc/passwd")
+		assert.Equal(t, "root:x:0:0:root:/root:/bin/sh\n"+
+			"nobody:x:65534:65534:nobody:/:/sbin/nologin\n"+
+			"app:x:1000:100::/home/app:/sbin/nologin\n", content)
+		content, shadowHdr := readFile(t, editor, "etc/shadow")
+		assert.Equal(t, "root:*:::::::\nnobody:*:::::::\napp:!:::::::\n", content)
+		assert.Equal(t, int64(0o640), shadowHdr.Mode)
+		assert.Equal(t, "shadow", shadowHdr.Gname)
+
+		delta, err := editor.Delta()
+		require.NoError(t, err)
+		var names []string
+		reader, err := delta.Uncompressed()
+		require.NoError(t, err)
+		tarReader := tar.NewReader(reader)
+		for {
+			hdr, err := tarReader.Next()
+			if err == io.EOF { //nolint:errorlint // io.EOF is not wrapped
+				break
+			}
+			require.NoError(t, err)
+			names = append(names, hdr.Name)
+		}
+		require.NoError(t, reader.Close())
+		// The group already existed, so /etc/group is unchanged.
+		assert.Equal(t, []string{"etc/passwd", "etc/shadow", "home/app/"}, names)
+	})
+}
@@ -0,0 +1,153 @@
+package platform
+
+import (
+	"archive/tar"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// elfArch returns the OCI architecture name (which are the same as GOARCH values) of an ELF
+// header, or "" if the header isn't for an ELF file or is for an architecture that isn't known.
+func elfArch(header []byte) string {
+	if len(header) < 20 || string(header[:4]) != elf.ELFMAG {
+		return ""
+	}
+	var order binary.ByteOrder
+	switch elf.Data(header[elf.EI_DATA]) {
+	case elf.ELFDATA2LSB:
+		order = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		order = binary.BigEndian
+	default:
+		return ""
+	}
+	le := order == binary.LittleEndian
+	is64 := elf.Class(header[elf.EI_CLASS]) == elf.ELFCLASS64
+	switch elf.Machine(order.Uint16(header[18:20])) {
+	case elf.EM_386:
+		return "386"
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_PPC64:
+		if le {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_S390:
+		if is64 {
+			return "s390x"
+		}
+		return "s390"
+	case elf.EM_RISCV:
+		if is64 {
+			return "riscv64"
+		}
+		return ""
+	case elf.EM_MIPS:
+		switch {
+		case is64 && le:
+			return "mips64le"
+		case is64:
+			return "mips64"
+		case le:
+			return "mipsle"
+		default:
+			return "mips"
+		}
+	default:
+		return ""
+	}
+}
+
+// DetectArchitectures scans the regular files in layers for ELF executables and shared
+// libraries, and returns a map from architecture name to the names of the files for that
+// architecture.  Files in later layers shadow files in earlier layers, but whiteouts are not
+// otherwise interpreted.
+func DetectArchitectures(layers []ociv1.Layer) (map[string][]string, error) {
+	archs := make(map[string]string) // filename => arch
+	for i, layer := range layers {
+		if err := detectLayer(layer, archs); err != nil {
+			return nil, fmt.Errorf("platform.DetectArchitectures: layer %d: %w", i, err)
+		}
+	}
+	ret := make(map[string][]string)
+	for filename, arch := range archs {
+		if arch != "" {
+			ret[arch] = append(ret[arch], filename)
+		}
+	}
+	for arch := range ret {
+		sort.Strings(ret[arch])
+	}
+	return ret, nil
+}
+
+func detectLayer(layer ociv1.Layer, archs map[string]string) (err error) {
+	layerReader, err := layer.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _err := layerReader.Close(); _err != nil && err == nil {
+			err = _err
+		}
+	}()
+	tarReader := tar.NewReader(layerReader)
+	header := make([]byte, 20)
+	for {
+		hdr, err := tarReader.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if hdr.Typeflag != tar.TypeReg {
+			delete(archs, name)
+			continue
+		}
+		n, err := io.ReadFull(tarReader, header)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return err
+		}
+		archs[name] = elfArch(header[:n])
+	}
+}
+
+// Validate returns an error if any ELF files in img's layers are for an architecture other than
+// plat.Architecture.  Only the architecture is checked (not the variant, or the OS); and files
+// that aren't ELF files (such as scripts, or Windows executables) are not considered.
+func Validate(img ociv1.Image, plat ociv1.Platform) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("platform.Validate: %w", err)
+	}
+	archs, err := DetectArchitectures(layers)
+	if err != nil {
+		return err
+	}
+	others := make([]string, 0, len(archs))
+	for arch, files := range archs {
+		if arch != plat.Architecture {
+			others = append(others, fmt.Sprintf("%d %s files (such as %q)", len(files), arch, files[0]))
+		}
+	}
+	if len(others) > 0 {
+		sort.Strings(others)
+		return fmt.Errorf("platform.Validate: image has ELF files for architectures other than %q: %s",
+			plat.Architecture, strings.Join(others, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Package platform deals with the platform (OS, architecture, and so on) that an image's config
+// says the image is for.
+//
+// go-containerregistry's ConfigFile doesn't have a field for the "variant", so this package
+// operates on the raw config JSON rather than on a ConfigFile.
+package platform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Parse parses a platform string of the form "OS/ARCH[/VARIANT]", such as "linux/amd64" or
+// "linux/arm64/v8".
+func Parse(str string) (ociv1.Platform, error) {
+	parts := strings.Split(str, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return ociv1.Platform{}, //nolint:exhaustivestruct // zero value
+			fmt.Errorf("platform.Parse: invalid platform %q: must be 'OS/ARCH[/VARIANT]'", str)
+	}
+	ret := ociv1.Platform{ //nolint:exhaustivestruct // the rest aren't part of the string
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		ret.Variant = parts[2]
+	}
+	return ret, nil
+}
+
+// String formats a platform as "OS/ARCH[/VARIANT]"; it is the inverse of Parse.
+func String(plat ociv1.Platform) string {
+	ret := plat.OS + "/" + plat.Architecture
+	if plat.Variant != "" {
+		ret += "/" + plat.Variant
+	}
+	return ret
+}
+
+// Get returns the platform that img's config says that it is for.
+func Get(img ociv1.Image) (ociv1.Platform, error) {
+	var ret ociv1.Platform
+	raw, err := img.RawConfigFile()
+	if err != nil {
+		return ret, fmt.Errorf("platform.Get: %w", err)
+	}
+	if err := json.Unmarshal(raw, &ret); err != nil {
+		return ret, fmt.Errorf("platform.Get: %w", err)
+	}
+	return ret, nil
+}
+
+// Set returns a copy of img with the "os", "architecture", "variant", and "os.version" fields of
+// its config set from plat; an empty Variant or OSVersion removes that field.  Other fields of
+// plat are ignored.  The layers are unchanged; see Validate to check them.
+func Set(img ociv1.Image, plat ociv1.Platform) (ociv1.Image, error) {
+	if plat.OS == "" || plat.Architecture == "" {
+		return nil, fmt.Errorf("platform.Set: OS and Architecture must be set: %q", String(plat))
+	}
+
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("platform.Set: %w", err)
+	}
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, fmt.Errorf("platform.Set: %w", err)
+	}
+	for key, val := range map[string]string{
+		"os":           plat.OS,
+		"architecture": plat.Architecture,
+		"variant":      plat.Variant,
+		"os.version":   plat.OSVersion,
+	} {
+		if val == "" {
+			delete(config, key)
+			continue
+		}
+		config[key], _ = json.Marshal(val)
+	}
+	rawConfig, err = json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("platform.Set: %w", err)
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("platform.Set: %w", err)
+	}
+	manifest = manifest.DeepCopy()
+	manifest.Config.Size = int64(len(rawConfig))
+	manifest.Config.Digest, _, err = ociv1.SHA256(bytes.NewReader(rawConfig))
+	if err != nil {
+		return nil, fmt.Errorf("platform.Set: %w", err)
+	}
+	rawManifest, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("platform.Set: %w", err)
+	}
+
+	ret, err := partial.CompressedToImage(&rawImage{
+		base:        img,
+		rawConfig:   rawConfig,
+		rawManifest: rawManifest,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("platform.Set: %w", err)
+	}
+	return ret, nil
+}
+
+// rawImage is an image with the same layers as base, but with a replacement config and manifest.
+type rawImage struct {
+	base        ociv1.Image
+	rawConfig   []byte
+	rawManifest []byte
+}
+
+var _ partial.CompressedImageCore = (*rawImage)(nil)
+
+func (img *rawImage) RawConfigFile() ([]byte, error) { return img.rawConfig, nil }
+func (img *rawImage) RawManifest() ([]byte, error)   { return img.rawManifest, nil }
+
+func (img *rawImage) MediaType() (types.MediaType, error) {
+	return img.base.MediaType()
+}
+
+func (img *rawImage) LayerByDigest(digest ociv1.Hash) (partial.CompressedLayer, error) {
+	return img.base.LayerByDigest(digest)
+}
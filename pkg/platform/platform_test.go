@@ -0,0 +1,178 @@
+package platform_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/platform"
+)
+
+func elfHeader(class elf.Class, order binary.ByteOrder, machine elf.Machine) []byte {
+	header := make([]byte, 64)
+	copy(header, elf.ELFMAG)
+	header[elf.EI_CLASS] = byte(class)
+	if order == binary.LittleEndian {
+		header[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	} else {
+		header[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+	}
+	order.PutUint16(header[18:], uint16(machine))
+	return header
+}
+
+func testLayer(t *testing.T, files map[string][]byte) ociv1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for name, content := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o755,
+			Size:     int64(len(content)),
+		}))
+		_, err := tarWriter.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Output ociv1.Platform
+		Err    bool
+	}{
+		"linux/amd64":    {Output: ociv1.Platform{OS: "linux", Architecture: "amd64"}},
+		"linux/arm64/v8": {Output: ociv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		"linux":          {Err: true},
+		"linux/":         {Err: true},
+		"a/b/c/d":        {Err: true},
+	}
+	for input, tcData := range testcases {
+		input, tcData := input, tcData
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+			plat, err := platform.Parse(input)
+			if tcData.Err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Output, plat)
+			assert.Equal(t, input, platform.String(plat))
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	t.Parallel()
+	img, err := mutate.AppendLayers(empty.Image, testLayer(t, map[string][]byte{
+		"usr/bin/app":  elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.EM_AARCH64),
+		"usr/bin/tool": []byte("#!/bin/sh\n"),
+	}))
+	require.NoError(t, err)
+
+	target := ociv1.Platform{ //nolint:exhaustivestruct
+		OS:           "linux",
+		Architecture: "arm64",
+		Variant:      "v8",
+	}
+	retargeted, err := platform.Set(img, target)
+	require.NoError(t, err)
+
+	plat, err := platform.Get(retargeted)
+	require.NoError(t, err)
+	assert.Equal(t, target, plat)
+
+	var rawConfig map[string]interface{}
+	rawConfigBytes, err := retargeted.RawConfigFile()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(rawConfigBytes, &rawConfig))
+	assert.Equal(t, "v8", rawConfig["variant"])
+	assert.NotContains(t, rawConfig, "os.version")
+
+	// The manifest and digest are consistent with the new config.
+	manifest, err := retargeted.Manifest()
+	require.NoError(t, err)
+	configName, err := retargeted.ConfigName()
+	require.NoError(t, err)
+	assert.Equal(t, configName, manifest.Config.Digest)
+	digest, err := retargeted.Digest()
+	require.NoError(t, err)
+	expectedDigest, err := partial.Digest(retargeted)
+	require.NoError(t, err)
+	assert.Equal(t, expectedDigest, digest)
+
+	// The layers are unchanged.
+	origLayers, err := img.Layers()
+	require.NoError(t, err)
+	newLayers, err := retargeted.Layers()
+	require.NoError(t, err)
+	require.Len(t, newLayers, 1)
+	origDigest, err := origLayers[0].Digest()
+	require.NoError(t, err)
+	newDigest, err := newLayers[0].Digest()
+	require.NoError(t, err)
+	assert.Equal(t, origDigest, newDigest)
+
+	// Removing the variant.
+	target.Variant = ""
+	retargeted, err = platform.Set(retargeted, target)
+	require.NoError(t, err)
+	plat, err = platform.Get(retargeted)
+	require.NoError(t, err)
+	assert.Equal(t, target, plat)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	img, err := mutate.AppendLayers(empty.Image,
+		testLayer(t, map[string][]byte{
+			"usr/bin/app":       elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.EM_X86_64),
+			"usr/lib/libfoo.so": elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.EM_AARCH64),
+			"usr/bin/script":    []byte("#!/bin/sh\n"),
+			"etc/short":         []byte("\x7fE"),
+		}),
+		testLayer(t, map[string][]byte{
+			// shadows the amd64 file in the lower layer
+			"usr/bin/app": elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.EM_AARCH64),
+		}),
+	)
+	require.NoError(t, err)
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	archs, err := platform.DetectArchitectures(layers)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"arm64": {"usr/bin/app", "usr/lib/libfoo.so"},
+	}, archs)
+
+	assert.NoError(t, platform.Validate(img, ociv1.Platform{ //nolint:exhaustivestruct
+		OS:           "linux",
+		Architecture: "arm64",
+	}))
+	assert.Error(t, platform.Validate(img, ociv1.Platform{ //nolint:exhaustivestruct
+		OS:           "linux",
+		Architecture: "amd64",
+	}))
+}
@@ -0,0 +1,102 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// BarReporter is a Reporter that draws a progress bar for downloads on a terminal, and passes all
+// events other than DownloadProgress along to another Reporter.
+type BarReporter struct {
+	// Out is the terminal to draw the progress bar on.
+	Out io.Writer
+	// Width is the width of the terminal; if it is zero, then 80 is assumed.
+	Width int
+	// Next is the Reporter to pass events other than DownloadProgress to; if it is nil then a
+	// LogReporter is used.
+	Next Reporter
+
+	mu     sync.Mutex
+	drawn  bool
+	latest Event
+}
+
+var _ Reporter = (*BarReporter)(nil)
+
+// Report implements Reporter.
+func (b *BarReporter) Report(ctx context.Context, ev Event) {
+	b.mu.Lock()
+	switch ev.Kind {
+	case DownloadStarted:
+		b.latest = Event{ //nolint:exhaustivestruct
+			Kind:  DownloadProgress,
+			Name:  ev.Name,
+			Total: ev.Total,
+		}
+		b.draw()
+	case DownloadProgress:
+		b.latest = ev
+		b.draw()
+	case DownloadFinished:
+		b.latest.Bytes = ev.Bytes
+		b.draw()
+	}
+	if b.drawn && ev.Kind != DownloadProgress && ev.Kind != DownloadStarted {
+		// Move off of the progress bar line before anything else gets written.
+		_, _ = io.WriteString(b.Out, "\n")
+		b.drawn = false
+	}
+	b.mu.Unlock()
+
+	if ev.Kind == DownloadProgress {
+		return
+	}
+	next := b.Next
+	if next == nil {
+		next = LogReporter{}
+	}
+	next.Report(ctx, ev)
+}
+
+// draw must be called with b.mu held.
+func (b *BarReporter) draw() {
+	width := b.Width
+	if width <= 0 {
+		width = 80
+	}
+	var count string
+	if b.latest.Total < 0 {
+		count = FormatBytes(b.latest.Bytes)
+	} else {
+		count = FormatBytes(b.latest.Bytes) + "/" + FormatBytes(b.latest.Total)
+	}
+
+	// name [=====>    ] count
+	barWidth := width / 3
+	name := b.latest.Name
+	if maxName := width - barWidth - len(count) - 5; len(name) > maxName {
+		if maxName < 4 {
+			maxName = 4
+		}
+		name = "..." + name[len(name)-(maxName-3):]
+	}
+	var bar string
+	if b.latest.Total > 0 {
+		filled := int(int64(barWidth) * b.latest.Bytes / b.latest.Total)
+		if filled > barWidth {
+			filled = barWidth
+		}
+		bar = strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+		if filled > 0 && filled < barWidth {
+			bar = bar[:filled-1] + ">" + bar[filled:]
+		}
+	} else {
+		bar = strings.Repeat("?", barWidth)
+	}
+	// "\r\x1b[K" is "go to the beginning of the line, and clear it".
+	_, _ = fmt.Fprintf(b.Out, "\r\x1b[K%s [%s] %s", name, bar, count)
+	b.drawn = true
+}
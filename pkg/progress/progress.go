@@ -0,0 +1,157 @@
+// Package progress reports on the progress of long-running operations (downloads, wheel installs,
+// layer generation) as structured events.
+//
+// Events are passed to the Reporter associated with the Context; if there isn't one, then they are
+// passed to the fallback Reporter, which by default logs them through dlog with the event's
+// attributes as structured fields (so that they appear as JSON keys when using a JSON log
+// formatter).
+package progress
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// Kind identifies what sort of thing happened.
+type Kind string
+
+const (
+	// DownloadStarted is reported when a download begins; Total is the expected size, or -1 if
+	// it is not known.
+	DownloadStarted Kind = "download-started"
+	// DownloadProgress is reported periodically while a download is in progress; Bytes is the
+	// number of bytes received so far.
+	DownloadProgress Kind = "download-progress"
+	// DownloadFinished is reported when a download completes successfully; Bytes is the total
+	// number of bytes received.
+	DownloadFinished Kind = "download-finished"
+	// WheelInstalled is reported when a wheel file has been installed in to a layer.
+	WheelInstalled Kind = "wheel-installed"
+	// LayerDigested is reported when a layer has been written out; Digest is the layer's
+	// DiffID (the digest of the uncompressed layer) and Bytes is its uncompressed size.
+	LayerDigested Kind = "layer-digested"
+)
+
+// Event is a single progress report.  Fields that don't apply to the Kind of event are left as
+// their zero value.
+type Event struct {
+	Kind Kind
+	// Name is a human-readable identifier for the thing that the event is about: a URL, a
+	// filename, or similar.
+	Name   string
+	Bytes  int64
+	Total  int64
+	Digest string
+}
+
+// String returns a human-readable one-line description of the event.
+func (ev Event) String() string {
+	switch ev.Kind {
+	case DownloadStarted:
+		if ev.Total < 0 {
+			return fmt.Sprintf("downloading %s", ev.Name)
+		}
+		return fmt.Sprintf("downloading %s (%s)", ev.Name, FormatBytes(ev.Total))
+	case DownloadProgress:
+		if ev.Total < 0 {
+			return fmt.Sprintf("downloading %s: %s", ev.Name, FormatBytes(ev.Bytes))
+		}
+		return fmt.Sprintf("downloading %s: %s/%s", ev.Name, FormatBytes(ev.Bytes), FormatBytes(ev.Total))
+	case DownloadFinished:
+		return fmt.Sprintf("downloaded %s (%s)", ev.Name, FormatBytes(ev.Bytes))
+	case WheelInstalled:
+		return fmt.Sprintf("installed %s", ev.Name)
+	case LayerDigested:
+		return fmt.Sprintf("wrote layer %s (%s)", ev.Digest, FormatBytes(ev.Bytes))
+	default:
+		return fmt.Sprintf("%s %s", ev.Kind, ev.Name)
+	}
+}
+
+// FormatBytes formats a byte count using binary ("KiB", "MiB", ...) units.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// A Reporter is something that progress events can be sent to.  Implementations must be safe to
+// call from multiple goroutines.
+type Reporter interface {
+	Report(ctx context.Context, ev Event)
+}
+
+// LogReporter is a Reporter that logs events through dlog, using structured fields for the event's
+// attributes.  DownloadProgress events are logged at the debug level, other events at the info
+// level.
+type LogReporter struct{}
+
+// Report implements Reporter.
+func (LogReporter) Report(ctx context.Context, ev Event) {
+	ctx = dlog.WithField(ctx, "event", string(ev.Kind))
+	if ev.Name != "" {
+		ctx = dlog.WithField(ctx, "name", ev.Name)
+	}
+	switch ev.Kind {
+	case DownloadStarted:
+		ctx = dlog.WithField(ctx, "total", ev.Total)
+	case DownloadProgress:
+		ctx = dlog.WithField(ctx, "bytes", ev.Bytes)
+		ctx = dlog.WithField(ctx, "total", ev.Total)
+	case DownloadFinished, LayerDigested:
+		ctx = dlog.WithField(ctx, "bytes", ev.Bytes)
+	}
+	if ev.Digest != "" {
+		ctx = dlog.WithField(ctx, "digest", ev.Digest)
+	}
+	if ev.Kind == DownloadProgress {
+		dlog.Debugln(ctx, ev)
+	} else {
+		dlog.Infoln(ctx, ev)
+	}
+}
+
+type reporterContextKey struct{}
+
+// WithReporter returns a copy of ctx that has reporter associated with it.
+func WithReporter(ctx context.Context, reporter Reporter) context.Context {
+	return context.WithValue(ctx, reporterContextKey{}, reporter)
+}
+
+//nolint:gochecknoglobals // Can't be a constant.
+var (
+	fallbackReporter   Reporter = LogReporter{}
+	fallbackReporterMu sync.RWMutex
+)
+
+// SetFallbackReporter sets the Reporter that is used for a Context that doesn't have a Reporter
+// associated with it.  The default fallback Reporter is a LogReporter.
+func SetFallbackReporter(reporter Reporter) {
+	fallbackReporterMu.Lock()
+	defer fallbackReporterMu.Unlock()
+	fallbackReporter = reporter
+}
+
+func getReporter(ctx context.Context) Reporter {
+	if reporter, ok := ctx.Value(reporterContextKey{}).(Reporter); ok {
+		return reporter
+	}
+	fallbackReporterMu.RLock()
+	defer fallbackReporterMu.RUnlock()
+	return fallbackReporter
+}
+
+// Report sends an event to the Reporter associated with ctx.
+func Report(ctx context.Context, ev Event) {
+	getReporter(ctx).Report(ctx, ev)
+}
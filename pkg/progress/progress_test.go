@@ -0,0 +1,105 @@
+package progress_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/progress"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []progress.Event
+}
+
+func (r *recorder) Report(_ context.Context, ev progress.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+	var rec recorder
+	ctx := progress.WithReporter(context.Background(), &rec)
+
+	content := bytes.Repeat([]byte("x"), 200*1024)
+	reader := progress.NewReader(ctx, "example.whl", int64(len(content)), bytes.NewReader(content))
+	// Read in 50KiB chunks, so that progress is reported every other read.
+	buf := make([]byte, 50*1024)
+	var total int
+	for {
+		n, err := reader.Read(buf)
+		total += n
+		if err == io.EOF { //nolint:errorlint // io.EOF is never wrapped
+			break
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, len(content), total)
+
+	//nolint:exhaustivestruct
+	assert.Equal(t, []progress.Event{
+		{Kind: progress.DownloadStarted, Name: "example.whl", Total: 200 * 1024},
+		{Kind: progress.DownloadProgress, Name: "example.whl", Bytes: 100 * 1024, Total: 200 * 1024},
+		{Kind: progress.DownloadProgress, Name: "example.whl", Bytes: 200 * 1024, Total: 200 * 1024},
+		{Kind: progress.DownloadFinished, Name: "example.whl", Bytes: 200 * 1024},
+	}, rec.events)
+}
+
+func TestBarReporter(t *testing.T) {
+	t.Parallel()
+	var rec recorder
+	var out strings.Builder
+	bar := &progress.BarReporter{ //nolint:exhaustivestruct
+		Out:   &out,
+		Width: 60,
+		Next:  &rec,
+	}
+	ctx := progress.WithReporter(context.Background(), bar)
+
+	// io.Discard reads in 8KiB chunks.
+	_, err := io.Copy(io.Discard,
+		progress.NewReader(ctx, "foo.whl", 128*1024, bytes.NewReader(make([]byte, 128*1024))))
+	require.NoError(t, err)
+
+	assert.Equal(t, ""+
+		"\r\x1b[Kfoo.whl [                    ] 0B/128.0KiB"+
+		"\r\x1b[Kfoo.whl [=========>          ] 64.0KiB/128.0KiB"+
+		"\r\x1b[Kfoo.whl [====================] 128.0KiB/128.0KiB"+
+		"\r\x1b[Kfoo.whl [====================] 128.0KiB/128.0KiB"+
+		"\n",
+		out.String())
+	// DownloadProgress events are not passed along.
+	kinds := make([]progress.Kind, 0, len(rec.events))
+	for _, ev := range rec.events {
+		kinds = append(kinds, ev.Kind)
+	}
+	assert.Equal(t, []progress.Kind{progress.DownloadStarted, progress.DownloadFinished}, kinds)
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+	testcases := map[int64]string{
+		0:             "0B",
+		1023:          "1023B",
+		1024:          "1.0KiB",
+		1536:          "1.5KiB",
+		5 * (1 << 20): "5.0MiB",
+		3 * (1 << 30): "3.0GiB",
+	}
+	for input, exp := range testcases {
+		input, exp := input, exp
+		t.Run(exp, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, exp, progress.FormatBytes(input))
+		})
+	}
+}
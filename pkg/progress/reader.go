@@ -0,0 +1,67 @@
+package progress
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// minProgressStep is the minimum number of bytes between DownloadProgress events, so that small
+// downloads don't generate a flood of events.
+const minProgressStep = 64 * 1024
+
+type reader struct {
+	ctx      context.Context //nolint:containedctx // it's only used for reporting
+	inner    io.Reader
+	name     string
+	total    int64
+	step     int64
+	bytes    int64
+	reported int64
+	done     bool
+}
+
+// NewReader reports a DownloadStarted event, and returns a wrapper around r that reports
+// DownloadProgress events as it is read from and a DownloadFinished event when it reaches EOF.
+// total is the expected size, or -1 if it is not known.
+func NewReader(ctx context.Context, name string, total int64, r io.Reader) io.Reader {
+	step := int64(minProgressStep)
+	if total/100 > step {
+		step = total / 100
+	}
+	Report(ctx, Event{ //nolint:exhaustivestruct
+		Kind:  DownloadStarted,
+		Name:  name,
+		Total: total,
+	})
+	return &reader{ //nolint:exhaustivestruct
+		ctx:   ctx,
+		inner: r,
+		name:  name,
+		total: total,
+		step:  step,
+	}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.inner.Read(p)
+	r.bytes += int64(n)
+	if r.bytes-r.reported >= r.step {
+		r.reported = r.bytes
+		Report(r.ctx, Event{ //nolint:exhaustivestruct
+			Kind:  DownloadProgress,
+			Name:  r.name,
+			Bytes: r.bytes,
+			Total: r.total,
+		})
+	}
+	if errors.Is(err, io.EOF) && !r.done {
+		r.done = true
+		Report(r.ctx, Event{ //nolint:exhaustivestruct
+			Kind:  DownloadFinished,
+			Name:  r.name,
+			Bytes: r.bytes,
+		})
+	}
+	return n, err
+}
@@ -0,0 +1,228 @@
+// Package checksumdb cross-checks the hashes of downloaded artifacts against an external source of
+// truth, such as PyPI's JSON API or an organization's own checksum database, so that an index
+// server (or a mirror or cache in front of it) that serves altered files is noticed.
+package checksumdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// A Source is an external source of truth for artifact hashes.
+type Source interface {
+	// Lookup returns the hashes that the source has for a file, as a map from hashlib
+	// algorithm names to hex digests.  It returns a nil map (and no error) if the source
+	// doesn't know about the file.
+	Lookup(ctx context.Context, project, filename string) (map[string]string, error)
+
+	// String returns a description of the source, for error messages.
+	String() string
+}
+
+// ErrMismatch is returned (wrapped) by Verify if a source has a different hash for a file.
+var ErrMismatch = errors.New("checksum database mismatch")
+
+// ErrUnknown is returned (wrapped) by Verify if requireKnown is set and no source knows about a
+// file.
+var ErrUnknown = errors.New("not in any checksum database")
+
+// Verify checks content (the content of the file filename, belonging to the given project)
+// against each of the sources, returning an error wrapping ErrMismatch if any source has a hash
+// that doesn't match.  Empty hashes, and hashes with algorithms that aren't in
+// python.HashlibAlgorithmsGuaranteed, are ignored.  If requireKnown is set, then it is also an
+// error (wrapping ErrUnknown) if none of the sources has a usable hash for the file.
+func Verify(
+	ctx context.Context,
+	sources []Source,
+	project, filename string,
+	content []byte,
+	requireKnown bool,
+) error {
+	known := false
+	for _, source := range sources {
+		hashes, err := source.Lookup(ctx, project, filename)
+		if err != nil {
+			return fmt.Errorf("checksumdb.Verify: %s: %w", source, err)
+		}
+		algs := make([]string, 0, len(hashes))
+		for alg := range hashes {
+			algs = append(algs, alg)
+		}
+		sort.Strings(algs)
+		for _, alg := range algs {
+			newHasher := python.HashlibAlgorithmsGuaranteed[alg]
+			if newHasher == nil || hashes[alg] == "" {
+				continue
+			}
+			hasher := newHasher()
+			_, _ = hasher.Write(content)
+			if actual := hex.EncodeToString(hasher.Sum(nil)); actual != strings.ToLower(hashes[alg]) {
+				return fmt.Errorf("checksumdb.Verify: %s: %w: %s: expected=%s actual=%s",
+					filename, ErrMismatch, source, hashes[alg], actual)
+			}
+			known = true
+		}
+	}
+	if requireKnown && !known {
+		return fmt.Errorf("checksumdb.Verify: %s: %w", filename, ErrUnknown)
+	}
+	return nil
+}
+
+// PyPIJSON is a Source that uses the hashes published by PyPI's JSON API
+// (https://warehouse.pypa.io/api-reference/json.html).  Only wheel filenames are supported (as
+// the version needs to be parsed from the filename); other files are unknown to it.
+type PyPIJSON struct {
+	// BaseURL is the base of the JSON API; if empty, PyPIJSONBaseURL is used.
+	BaseURL string
+	// HTTPClient is the client to use; if nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// PyPIJSONBaseURL is the base URL of PyPI's JSON API.
+const PyPIJSONBaseURL = "https://pypi.org/pypi/"
+
+func (src PyPIJSON) String() string {
+	if src.BaseURL == "" {
+		return PyPIJSONBaseURL
+	}
+	return src.BaseURL
+}
+
+// Lookup implements Source.
+func (src PyPIJSON) Lookup(ctx context.Context, project, filename string) (map[string]string, error) {
+	fileInfo, err := bdist.ParseFilename(filename)
+	if err != nil {
+		return nil, nil //nolint:nilerr // not a wheel; we don't know about it
+	}
+	u, err := url.Parse(src.String())
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, pep503.NormalizeName(project), fileInfo.Version.String(), "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	httpClient := src.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("GET %q => HTTP %s", u, resp.Status)
+	}
+
+	var body struct {
+		URLs []struct {
+			Filename string            `json:"filename"`
+			Digests  map[string]string `json:"digests"`
+		} `json:"urls"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("GET %q: %w", u, err)
+	}
+	for _, file := range body.URLs {
+		if file.Filename == filename {
+			return file.Digests, nil
+		}
+	}
+	return nil, nil
+}
+
+// File is a Source that reads hashes from a local file.  Each line of the file is
+// "FILENAME ALGORITHM:HEXDIGEST"; a file may be listed on multiple lines with different
+// algorithms.  Blank lines and lines starting with "#" are ignored.  The file is read once, on
+// first use.
+type File struct {
+	Filename string
+
+	once   sync.Once
+	hashes map[string]map[string]string
+	err    error
+}
+
+// NewFile returns a File source for a local file.
+func NewFile(filename string) *File {
+	return &File{ //nolint:exhaustivestruct // the rest is set on first use
+		Filename: filename,
+	}
+}
+
+func (src *File) String() string {
+	return src.Filename
+}
+
+// Lookup implements Source.
+func (src *File) Lookup(_ context.Context, _, filename string) (map[string]string, error) {
+	src.once.Do(func() {
+		var file *os.File
+		file, src.err = os.Open(src.Filename)
+		if src.err != nil {
+			return
+		}
+		defer file.Close()
+		src.hashes, src.err = ParseFile(file)
+	})
+	if src.err != nil {
+		return nil, src.err
+	}
+	return src.hashes[filename], nil
+}
+
+// ParseFile parses the content of a checksum database file (see File), returning a map from
+// filenames to hashes.
+func ParseFile(r io.Reader) (map[string]map[string]string, error) {
+	ret := make(map[string]map[string]string)
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("checksumdb.ParseFile: line %d: expected 2 fields, got %d",
+				lineno, len(fields))
+		}
+		idx := strings.Index(fields[1], ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("checksumdb.ParseFile: line %d: invalid hash %q: must be 'ALGORITHM:HEXDIGEST'",
+				lineno, fields[1])
+		}
+		if ret[fields[0]] == nil {
+			ret[fields[0]] = make(map[string]string)
+		}
+		ret[fields[0]][fields[1][:idx]] = strings.ToLower(fields[1][idx+1:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("checksumdb.ParseFile: %w", err)
+	}
+	return ret, nil
+}
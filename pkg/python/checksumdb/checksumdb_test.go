@@ -0,0 +1,82 @@
+package checksumdb_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/checksumdb"
+)
+
+const testFilename = "example-1.0-py3-none-any.whl"
+
+func testContent() ([]byte, string) {
+	content := []byte("not really a wheel")
+	sum := sha256.Sum256(content)
+	return content, hex.EncodeToString(sum[:])
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+	content, digest := testContent()
+	dbFile := filepath.Join(t.TempDir(), "sums.txt")
+	require.NoError(t, os.WriteFile(dbFile, []byte(""+
+		"# checksums\n"+
+		testFilename+" sha256:"+strings.ToUpper(digest)+"\n"+
+		testFilename+" blake2b_256:ignored-unknown-algorithm\n"+
+		"other-1.0-py3-none-any.whl sha256:0000\n"), 0o644))
+	sources := []checksumdb.Source{checksumdb.NewFile(dbFile)}
+	ctx := context.Background()
+
+	assert.NoError(t, checksumdb.Verify(ctx, sources, "example", testFilename, content, true))
+
+	err := checksumdb.Verify(ctx, sources, "other", "other-1.0-py3-none-any.whl", content, false)
+	assert.True(t, errors.Is(err, checksumdb.ErrMismatch), err)
+
+	assert.NoError(t, checksumdb.Verify(ctx, sources, "unknown", "unknown-1.0-py3-none-any.whl", content, false))
+	err = checksumdb.Verify(ctx, sources, "unknown", "unknown-1.0-py3-none-any.whl", content, true)
+	assert.True(t, errors.Is(err, checksumdb.ErrUnknown), err)
+
+	_, err = checksumdb.ParseFile(strings.NewReader("example.whl 0000\n"))
+	assert.Error(t, err)
+}
+
+func TestPyPIJSON(t *testing.T) {
+	t.Parallel()
+	content, digest := testContent()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pypi/example/1.0/json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"urls": [
+			{"filename": "example-1.0.tar.gz", "digests": {"sha256": "0000"}},
+			{"filename": "` + testFilename + `", "digests": {"md5": "", "sha256": "` + digest + `"}}
+		]}`))
+	}))
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	source := checksumdb.PyPIJSON{BaseURL: srv.URL + "/pypi/", HTTPClient: srv.Client()}
+
+	hashes, err := source.Lookup(ctx, "Example", testFilename)
+	require.NoError(t, err)
+	assert.Equal(t, digest, hashes["sha256"])
+
+	hashes, err = source.Lookup(ctx, "example", "example-2.0-py3-none-any.whl")
+	require.NoError(t, err)
+	assert.Nil(t, hashes)
+
+	assert.NoError(t, checksumdb.Verify(ctx, []checksumdb.Source{source}, "example", testFilename, content, true))
+	err = checksumdb.Verify(ctx, []checksumdb.Source{source}, "example", testFilename, []byte("tampered"), false)
+	assert.True(t, errors.Is(err, checksumdb.ErrMismatch), err)
+}
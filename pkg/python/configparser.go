@@ -170,3 +170,12 @@ func (p *ConfigParser) Parse(_file io.Reader) (Config, error) {
 func NoInterpolation(_ Config, val string) (string, error) {
 	return val, nil
 }
+
+// ParseEntryPoints parses an "entry_points.txt" file, which is in configparser format, but with
+// case-sensitive keys and with "=" as the only delimiter.
+func ParseEntryPoints(file io.Reader) (Config, error) {
+	parser := NewConfigParser()
+	parser.OptionTransform = func(str string) string { return str }
+	parser.Delimiters = []string{"="}
+	return parser.Parse(file)
+}
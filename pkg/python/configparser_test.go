@@ -0,0 +1,81 @@
+package python_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+func TestParseEntryPoints(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Input    string
+		Expected python.Config
+		Err      string
+	}{
+		"basic": {
+			Input: "" +
+				"[console_scripts]\n" +
+				"foo = foo.cli:main\n" +
+				"Foo-Admin = foo.admin:main [admin]\n" +
+				"\n" +
+				"# a comment\n" +
+				"[gui_scripts]\n" +
+				"foo-gui=foo.gui:main\n",
+			Expected: python.Config{
+				"console_scripts": {
+					"foo":       "foo.cli:main",
+					"Foo-Admin": "foo.admin:main [admin]",
+				},
+				"gui_scripts": {
+					"foo-gui": "foo.gui:main",
+				},
+			},
+		},
+		"colon-is-not-a-delimiter": {
+			Input: "[foo.plugins]\nc:d = pkg:obj\n",
+			Expected: python.Config{
+				"foo.plugins": {"c:d": "pkg:obj"},
+			},
+		},
+		"case-sensitive": {
+			Input: "[console_scripts]\nfoo = a:b\nFOO = c:d\n",
+			Expected: python.Config{
+				"console_scripts": {"foo": "a:b", "FOO": "c:d"},
+			},
+		},
+		"empty": {
+			Input:    "",
+			Expected: python.Config{},
+		},
+		"no-section": {
+			Input: "foo = a:b\n",
+			Err:   "line 1: no section header",
+		},
+		"duplicate-key": {
+			Input: "[console_scripts]\nfoo = a:b\nfoo = c:d\n",
+			Err:   `line 3: duplicate option name "foo"`,
+		},
+		"no-delimiter": {
+			Input: "[console_scripts]\nfoo: a:b\n",
+			Err:   `line 2: invalid line: "foo: a:b"`,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			config, err := python.ParseEntryPoints(strings.NewReader(tcData.Input))
+			if tcData.Err != "" {
+				assert.EqualError(t, err, tcData.Err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Expected, config)
+		})
+	}
+}
@@ -5,26 +5,56 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"errors"
 	"hash"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/sha3"
 )
 
+// ErrHashMismatch is returned (wrapped) when a file's content doesn't match the hash that it is
+// expected to have, such as a "#sha256=..." URL fragment or a hash recorded in a wheelhouse
+// manifest.
+var ErrHashMismatch = errors.New("checksum mismatch")
+
 // HashlibAlgorithmsGuaranteed is Python `hashlib.algorithms_guaranteed`.
 //
 //nolint:gochecknoglobals // Would be 'const'.
 var HashlibAlgorithmsGuaranteed = map[string]func() hash.Hash{
 	// This list is (sans TODOs) in-sync with Python 3.9.9.
-	"md5":    md5.New,
-	"sha1":   sha1.New,
-	"sha224": sha256.New224,
-	"sha256": sha256.New,
-	"sha384": sha512.New384,
-	"sha512": sha512.New,
-	// "blake2b":   TODO,
-	// "blake2s":   TODO,
-	// "sha3_224":  TODO,
-	// "sha3_256":  TODO,
-	// "sha3_384":  TODO,
-	// "sha3_512":  TODO,
-	// "shake_128": TODO,
-	// "shake_256": TODO,
+	"md5":      md5.New,
+	"sha1":     sha1.New,
+	"sha224":   sha256.New224,
+	"sha256":   sha256.New,
+	"sha384":   sha512.New384,
+	"sha512":   sha512.New,
+	"blake2b":  newBlake2b512,
+	"blake2s":  newBlake2s256,
+	"sha3_224": sha3.New224,
+	"sha3_256": sha3.New256,
+	"sha3_384": sha3.New384,
+	"sha3_512": sha3.New512,
+	// "shake_128": TODO, // variable-length output; doesn't fit hash.Hash
+	// "shake_256": TODO, // variable-length output; doesn't fit hash.Hash
+}
+
+// newBlake2b512 is Python `hashlib.blake2b()` with the default parameters.
+func newBlake2b512() hash.Hash {
+	h, err := blake2b.New512(nil)
+	if err != nil {
+		// Can only fail if given a key that is too long.
+		panic(err)
+	}
+	return h
+}
+
+// newBlake2s256 is Python `hashlib.blake2s()` with the default parameters.
+func newBlake2s256() hash.Hash {
+	h, err := blake2s.New256(nil)
+	if err != nil {
+		// Can only fail if given a key that is too long.
+		panic(err)
+	}
+	return h
 }
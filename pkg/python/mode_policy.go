@@ -0,0 +1,43 @@
+package python
+
+import (
+	"fmt"
+)
+
+// A ModePolicy says how to set the permission bits of installed files.  Without a policy, files
+// from the wheel are installed the way that pip installs them (0755 if any of the execute bits
+// are set in the wheel, or else 0644), and files that the installer generates (scripts, .pyc
+// files, dist-info files) keep whatever permission bits they were generated with.
+type ModePolicy struct {
+	// Normalize, if true, sets the permission bits of every installed file and directory:
+	// directories are set to 0755, and regular files to 0755 if the owner-execute bit is set
+	// (in the wheel, for files from the wheel) or else 0644.  This drops the setuid, setgid,
+	// and sticky bits, and ignores the group- and other-execute bits.
+	Normalize bool
+
+	// Umask is a mask of permission bits to clear (after Normalize, if set); for example 0o022
+	// to remove group and other write access.
+	Umask StatMode
+}
+
+// Validate returns an error if the policy is invalid.
+func (p ModePolicy) Validate() error {
+	if p.Umask&^0o777 != 0 {
+		return fmt.Errorf("ModePolicy.Umask has bits other than permission bits: %#o", p.Umask)
+	}
+	return nil
+}
+
+// Apply returns the permission bits that a file with the given permission bits (as in a
+// tar.Header's Mode) should be installed with.
+func (p ModePolicy) Apply(perm int64, isDir bool) int64 {
+	if p.Normalize {
+		switch {
+		case isDir, perm&0o100 != 0:
+			perm = 0o755
+		default:
+			perm = 0o644
+		}
+	}
+	return perm &^ int64(p.Umask)
+}
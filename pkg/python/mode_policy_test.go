@@ -0,0 +1,36 @@
+package python_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+func TestModePolicy(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Policy   python.ModePolicy
+		Perm     int64
+		IsDir    bool
+		Expected int64
+	}{
+		"zero":              {python.ModePolicy{}, 0o4751, false, 0o4751},
+		"normalize-file":    {python.ModePolicy{Normalize: true}, 0o666, false, 0o644},
+		"normalize-exec":    {python.ModePolicy{Normalize: true}, 0o700, false, 0o755},
+		"normalize-grpexec": {python.ModePolicy{Normalize: true}, 0o610, false, 0o644},
+		"normalize-dir":     {python.ModePolicy{Normalize: true}, 0o700, true, 0o755},
+		"umask":             {python.ModePolicy{Umask: 0o027}, 0o777, false, 0o750},
+		"both":              {python.ModePolicy{Normalize: true, Umask: 0o077}, 0o644, true, 0o700},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tcData.Expected, tcData.Policy.Apply(tcData.Perm, tcData.IsDir))
+		})
+	}
+	assert.Error(t, python.ModePolicy{Umask: 0o1022}.Validate())
+	assert.NoError(t, python.ModePolicy{Umask: 0o022}.Validate())
+}
@@ -0,0 +1,450 @@
+package pep345
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+// Environment markers
+// ===================
+//
+// PEP 345 defines environment markers for "Requires-Dist" (and friends); they were later extended
+// by PEP 426 (adding "extra") and codified by PEP 508 (renaming the dotted variable names to
+// underscored names).  Real-world metadata uses all of these, so this implements the PEP 508
+// grammar, while also accepting the PEP 345 variable names.
+//
+//     marker_or  = marker_and ('or' marker_and)*
+//     marker_and = marker_expr ('and' marker_expr)*
+//     marker_expr = marker_var marker_op marker_var
+//                 | '(' marker_or ')'
+//     marker_var = env_var | python_str
+//     marker_op  = version_cmp | 'in' | 'not' 'in'
+
+// Environment is the set of values that environment markers are evaluated against.  The values
+// correspond to the Python expressions noted by each field.
+type Environment struct {
+	OSName                       string // os.name
+	SysPlatform                  string // sys.platform
+	PlatformMachine              string // platform.machine()
+	PlatformPythonImplementation string // platform.python_implementation()
+	PlatformRelease              string // platform.release()
+	PlatformSystem               string // platform.system()
+	PlatformVersion              string // platform.version()
+	PythonVersion                string // '.'.join(platform.python_version_tuple()[:2])
+	PythonFullVersion            string // platform.python_version()
+	ImplementationName           string // sys.implementation.name
+	ImplementationVersion        string // see PEP 508
+
+	// Extras is the list of extras that have been requested; the "extra" marker variable
+	// matches if any of them match.
+	Extras []string
+}
+
+// NormalizeExtra normalizes the name of an extra, per PEP 685.
+func NormalizeExtra(name string) string {
+	return strings.ToLower(reExtraSep.ReplaceAllLiteralString(name, "-"))
+}
+
+var reExtraSep = regexp.MustCompile(`[-_.]+`)
+
+//nolint:gochecknoglobals // Would be 'const'.
+var markerVars = map[string]func(Environment) string{
+	"os_name":                        func(env Environment) string { return env.OSName },
+	"sys_platform":                   func(env Environment) string { return env.SysPlatform },
+	"platform_machine":               func(env Environment) string { return env.PlatformMachine },
+	"platform_python_implementation": func(env Environment) string { return env.PlatformPythonImplementation },
+	"platform_release":               func(env Environment) string { return env.PlatformRelease },
+	"platform_system":                func(env Environment) string { return env.PlatformSystem },
+	"platform_version":               func(env Environment) string { return env.PlatformVersion },
+	"python_version":                 func(env Environment) string { return env.PythonVersion },
+	"python_full_version":            func(env Environment) string { return env.PythonFullVersion },
+	"implementation_name":            func(env Environment) string { return env.ImplementationName },
+	"implementation_version":         func(env Environment) string { return env.ImplementationVersion },
+
+	// PEP 345 spellings
+	"os.name":                        func(env Environment) string { return env.OSName },
+	"sys.platform":                   func(env Environment) string { return env.SysPlatform },
+	"platform.machine":               func(env Environment) string { return env.PlatformMachine },
+	"platform.python_implementation": func(env Environment) string { return env.PlatformPythonImplementation },
+	"platform.version":               func(env Environment) string { return env.PlatformVersion },
+	// setuptools spelling
+	"python_implementation": func(env Environment) string { return env.PlatformPythonImplementation },
+}
+
+// Marker is a parsed environment marker expression.
+type Marker struct {
+	root markerNode
+}
+
+type markerNode interface {
+	eval(env Environment) (bool, error)
+	String() string
+}
+
+// ParseMarker parses an environment marker expression, such as
+// `python_version < "3.8" and extra == "test"`.
+func ParseMarker(str string) (*Marker, error) {
+	toks, err := tokenizeMarker(str)
+	if err != nil {
+		return nil, fmt.Errorf("pep345.ParseMarker: %w", err)
+	}
+	parser := &markerParser{toks: toks}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("pep345.ParseMarker: %q: %w", str, err)
+	}
+	if tok := parser.peek(); tok != nil {
+		return nil, fmt.Errorf("pep345.ParseMarker: %q: unexpected %q", str, tok.str)
+	}
+	return &Marker{root: root}, nil
+}
+
+// Evaluate returns whether the marker is true in the given environment.  An error is returned if
+// the marker performs a comparison that is not defined (such as `~=` between two strings that are
+// not versions).
+func (m *Marker) Evaluate(env Environment) (bool, error) {
+	if m == nil || m.root == nil {
+		return true, nil
+	}
+	ret, err := m.root.eval(env)
+	if err != nil {
+		return false, fmt.Errorf("pep345.Marker.Evaluate: %w", err)
+	}
+	return ret, nil
+}
+
+// String returns a normalized string representation of the marker.
+func (m *Marker) String() string {
+	if m == nil || m.root == nil {
+		return ""
+	}
+	return m.root.String()
+}
+
+// AST ////////////////////////////////////////////////////////////////////////
+
+type markerOr []markerNode
+
+func (node markerOr) eval(env Environment) (bool, error) {
+	for _, child := range node {
+		val, err := child.eval(env)
+		if err != nil {
+			return false, err
+		}
+		if val {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (node markerOr) String() string {
+	strs := make([]string, 0, len(node))
+	for _, child := range node {
+		strs = append(strs, child.String())
+	}
+	return strings.Join(strs, " or ")
+}
+
+type markerAnd []markerNode
+
+func (node markerAnd) eval(env Environment) (bool, error) {
+	for _, child := range node {
+		val, err := child.eval(env)
+		if err != nil {
+			return false, err
+		}
+		if !val {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (node markerAnd) String() string {
+	strs := make([]string, 0, len(node))
+	for _, child := range node {
+		str := child.String()
+		if _, isOr := child.(markerOr); isOr {
+			str = "(" + str + ")"
+		}
+		strs = append(strs, str)
+	}
+	return strings.Join(strs, " and ")
+}
+
+// markerValue is either a variable name or a string literal.
+type markerValue struct {
+	isVar bool
+	str   string
+}
+
+func (val markerValue) String() string {
+	if val.isVar {
+		return val.str
+	}
+	if strings.Contains(val.str, `"`) {
+		return `'` + val.str + `'`
+	}
+	return `"` + val.str + `"`
+}
+
+type markerCmp struct {
+	lhs markerValue
+	op  string
+	rhs markerValue
+}
+
+func (node markerCmp) String() string {
+	return node.lhs.String() + " " + node.op + " " + node.rhs.String()
+}
+
+func (node markerCmp) eval(env Environment) (bool, error) {
+	// The "extra" variable is special; it's a set rather than a single value.
+	if node.lhs.isVar && node.lhs.str == "extra" && !node.rhs.isVar {
+		return node.evalExtra(env.Extras, node.rhs.str)
+	}
+	if node.rhs.isVar && node.rhs.str == "extra" && !node.lhs.isVar {
+		return node.evalExtra(env.Extras, node.lhs.str)
+	}
+
+	resolve := func(val markerValue) (string, error) {
+		if !val.isVar {
+			return val.str, nil
+		}
+		fn, ok := markerVars[val.str]
+		if !ok {
+			return "", fmt.Errorf("unknown marker variable: %q", val.str)
+		}
+		return fn(env), nil
+	}
+	lhs, err := resolve(node.lhs)
+	if err != nil {
+		return false, err
+	}
+	rhs, err := resolve(node.rhs)
+	if err != nil {
+		return false, err
+	}
+
+	switch node.op {
+	case "in":
+		return strings.Contains(rhs, lhs), nil
+	case "not in":
+		return !strings.Contains(rhs, lhs), nil
+	}
+
+	// Use the PEP 440 version comparison rules when those are defined (that is when both
+	// sides have a valid version specifier).
+	if node.op != "===" {
+		if ver, err := pep440.ParseVersion(lhs); err == nil {
+			if spec, err := pep440.ParseSpecifier(node.op + rhs); err == nil && len(spec) == 1 {
+				return spec.Match(*ver), nil
+			}
+		}
+	}
+
+	// Otherwise, fall back to the Python string comparison.
+	switch node.op {
+	case "==", "===":
+		return lhs == rhs, nil
+	case "!=":
+		return lhs != rhs, nil
+	case "<":
+		return lhs < rhs, nil
+	case "<=":
+		return lhs <= rhs, nil
+	case ">":
+		return lhs > rhs, nil
+	case ">=":
+		return lhs >= rhs, nil
+	default:
+		return false, fmt.Errorf("invalid comparison: %q %s %q", lhs, node.op, rhs)
+	}
+}
+
+func (node markerCmp) evalExtra(extras []string, val string) (bool, error) {
+	val = NormalizeExtra(val)
+	has := false
+	for _, extra := range extras {
+		if NormalizeExtra(extra) == val {
+			has = true
+			break
+		}
+	}
+	switch node.op {
+	case "==", "===":
+		return has, nil
+	case "!=":
+		return !has, nil
+	default:
+		return false, fmt.Errorf("invalid comparison for extra: %s", node.op)
+	}
+}
+
+// Parser /////////////////////////////////////////////////////////////////////
+
+type markerTokenType int
+
+const (
+	markerTokVar markerTokenType = iota
+	markerTokStr
+	markerTokOp
+	markerTokLParen
+	markerTokRParen
+	markerTokAnd
+	markerTokOr
+)
+
+type markerToken struct {
+	typ markerTokenType
+	str string
+}
+
+var reMarkerToken = regexp.MustCompile(`^(?:` +
+	`(?P<space>\s+)|` +
+	`(?P<str>"[^"]*"|'[^']*')|` +
+	`(?P<op>===|==|!=|<=|>=|~=|<|>|not\s+in\b|in\b)|` +
+	`(?P<paren>[()])|` +
+	`(?P<word>[A-Za-z_][A-Za-z0-9_.]*)` +
+	`)`)
+
+func tokenizeMarker(str string) ([]markerToken, error) {
+	var ret []markerToken
+	for rest := str; rest != ""; {
+		match := reMarkerToken.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, fmt.Errorf("invalid marker: %q: unexpected character at %q", str, rest)
+		}
+		rest = rest[len(match[0]):]
+		switch {
+		case match[reMarkerToken.SubexpIndex("space")] != "":
+			// skip
+		case match[reMarkerToken.SubexpIndex("str")] != "":
+			quoted := match[reMarkerToken.SubexpIndex("str")]
+			ret = append(ret, markerToken{typ: markerTokStr, str: quoted[1 : len(quoted)-1]})
+		case match[reMarkerToken.SubexpIndex("op")] != "":
+			op := strings.Join(strings.Fields(match[reMarkerToken.SubexpIndex("op")]), " ")
+			ret = append(ret, markerToken{typ: markerTokOp, str: op})
+		case match[reMarkerToken.SubexpIndex("paren")] == "(":
+			ret = append(ret, markerToken{typ: markerTokLParen, str: "("})
+		case match[reMarkerToken.SubexpIndex("paren")] == ")":
+			ret = append(ret, markerToken{typ: markerTokRParen, str: ")"})
+		default:
+			word := match[reMarkerToken.SubexpIndex("word")]
+			switch word {
+			case "and":
+				ret = append(ret, markerToken{typ: markerTokAnd, str: word})
+			case "or":
+				ret = append(ret, markerToken{typ: markerTokOr, str: word})
+			default:
+				ret = append(ret, markerToken{typ: markerTokVar, str: word})
+			}
+		}
+	}
+	return ret, nil
+}
+
+type markerParser struct {
+	toks []markerToken
+}
+
+func (p *markerParser) peek() *markerToken {
+	if len(p.toks) == 0 {
+		return nil
+	}
+	return &p.toks[0]
+}
+
+func (p *markerParser) next() *markerToken {
+	tok := p.peek()
+	if tok != nil {
+		p.toks = p.toks[1:]
+	}
+	return tok
+}
+
+func (p *markerParser) parseOr() (markerNode, error) {
+	var ret markerOr
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, node)
+		if tok := p.peek(); tok == nil || tok.typ != markerTokOr {
+			break
+		}
+		p.next()
+	}
+	if len(ret) == 1 {
+		return ret[0], nil
+	}
+	return ret, nil
+}
+
+func (p *markerParser) parseAnd() (markerNode, error) {
+	var ret markerAnd
+	for {
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, node)
+		if tok := p.peek(); tok == nil || tok.typ != markerTokAnd {
+			break
+		}
+		p.next()
+	}
+	if len(ret) == 1 {
+		return ret[0], nil
+	}
+	return ret, nil
+}
+
+func (p *markerParser) parseExpr() (markerNode, error) {
+	if tok := p.peek(); tok != nil && tok.typ == markerTokLParen {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok == nil || tok.typ != markerTokRParen {
+			return nil, fmt.Errorf("expected %q", ")")
+		}
+		return node, nil
+	}
+	lhs, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	if op == nil || op.typ != markerTokOp {
+		return nil, fmt.Errorf("expected a comparison operator after %s", lhs)
+	}
+	rhs, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return markerCmp{lhs: lhs, op: op.str, rhs: rhs}, nil
+}
+
+func (p *markerParser) parseValue() (markerValue, error) {
+	tok := p.next()
+	switch {
+	case tok == nil:
+		return markerValue{}, fmt.Errorf("unexpected end of marker")
+	case tok.typ == markerTokStr:
+		return markerValue{isVar: false, str: tok.str}, nil
+	case tok.typ == markerTokVar:
+		if _, ok := markerVars[tok.str]; !ok && tok.str != "extra" {
+			return markerValue{}, fmt.Errorf("unknown marker variable: %q", tok.str)
+		}
+		return markerValue{isVar: true, str: tok.str}, nil
+	default:
+		return markerValue{}, fmt.Errorf("expected a marker variable or string, got %q", tok.str)
+	}
+}
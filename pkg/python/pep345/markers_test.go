@@ -0,0 +1,127 @@
+package pep345_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep345"
+)
+
+//nolint:gochecknoglobals // Would be 'const'.
+var linuxPy39 = pep345.Environment{
+	OSName:                       "posix",
+	SysPlatform:                  "linux",
+	PlatformMachine:              "x86_64",
+	PlatformPythonImplementation: "CPython",
+	PlatformRelease:              "5.15.0",
+	PlatformSystem:               "Linux",
+	PlatformVersion:              "#1 SMP",
+	PythonVersion:                "3.9",
+	PythonFullVersion:            "3.9.7",
+	ImplementationName:           "cpython",
+	ImplementationVersion:        "3.9.7",
+	Extras:                       []string{"Test_Utils"},
+}
+
+func TestMarker(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input     string
+		OutputStr string
+		OutputVal bool
+		OutputErr string
+	}
+	//nolint:lll // big table with string literals
+	testcases := map[string]TestCase{
+		"version-lt":        {`python_version < "3.8"`, `python_version < "3.8"`, false, ""},
+		"version-ge":        {`python_version>='3.6'`, `python_version >= "3.6"`, true, ""},
+		"version-compat":    {`python_full_version ~= "3.9.0"`, `python_full_version ~= "3.9.0"`, true, ""},
+		"version-prefix":    {`python_version == "3.*"`, `python_version == "3.*"`, true, ""},
+		"string-eq":         {`sys_platform == "win32"`, `sys_platform == "win32"`, false, ""},
+		"string-ne":         {`sys_platform != "win32"`, `sys_platform != "win32"`, true, ""},
+		"pep345-names":      {`sys.platform == "linux" and platform.python_implementation == 'CPython'`, `sys.platform == "linux" and platform.python_implementation == "CPython"`, true, ""},
+		"reversed":          {`"linux" == sys_platform`, `"linux" == sys_platform`, true, ""},
+		"in":                {`"86" in platform_machine`, `"86" in platform_machine`, true, ""},
+		"not-in":            {`platform_machine not  in "arm64 aarch64"`, `platform_machine not in "arm64 aarch64"`, true, ""},
+		"extra":             {`extra == "test-utils"`, `extra == "test-utils"`, true, ""},
+		"extra-other":       {`extra == "docs"`, `extra == "docs"`, false, ""},
+		"extra-ne":          {`extra != "docs"`, `extra != "docs"`, true, ""},
+		"precedence":        {`os_name == "nt" and python_version < "3" or extra == "test_utils"`, `os_name == "nt" and python_version < "3" or extra == "test_utils"`, true, ""},
+		"parens":            {`os_name == "nt" and (python_version < "3" or extra == "test_utils")`, `os_name == "nt" and (python_version < "3" or extra == "test_utils")`, false, ""},
+		"redundant-parens":  {`((os_name == "posix"))`, `os_name == "posix"`, true, ""},
+		"string-ordering":   {`platform_release > "5"`, `platform_release > "5"`, true, ""},
+		"triple-eq":         {`python_full_version === "3.9.7"`, `python_full_version === "3.9.7"`, true, ""},
+		"bad-compat-string": {`os_name ~= "posix"`, `os_name ~= "posix"`, false, `pep345.Marker.Evaluate: invalid comparison: "posix" ~= "posix"`},
+		"bad-var":           {`python_versoin < "3"`, ``, false, `pep345.ParseMarker: "python_versoin < \"3\"": unknown marker variable: "python_versoin"`},
+		"bad-op":            {`python_version "3"`, ``, false, `pep345.ParseMarker: "python_version \"3\"": expected a comparison operator after python_version`},
+		"bad-paren":         {`(python_version < "3"`, ``, false, `pep345.ParseMarker: "(python_version < \"3\"": expected ")"`},
+		"bad-trailing":      {`python_version < "3" "x"`, ``, false, `pep345.ParseMarker: "python_version < \"3\" \"x\"": unexpected "x"`},
+		"bad-char":          {`python_version < 3`, ``, false, `pep345.ParseMarker: invalid marker: "python_version < 3": unexpected character at "3"`},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			marker, err := pep345.ParseMarker(tc.Input)
+			if tc.OutputStr == "" {
+				assert.EqualError(t, err, tc.OutputErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.OutputStr, marker.String())
+			val, err := marker.Evaluate(linuxPy39)
+			if tc.OutputErr != "" {
+				assert.EqualError(t, err, tc.OutputErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.OutputVal, val)
+			}
+		})
+	}
+}
+
+func TestRequirement(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input      string
+		OutputStr  string
+		OutputName string
+		Applies    bool
+		OutputErr  string
+	}
+	//nolint:lll // big table with string literals
+	testcases := map[string]TestCase{
+		"bare":         {"zope.interface", "zope.interface", "zope.interface", true, ""},
+		"pep345":       {"zope.interface (>3.5.0)", "zope.interface>3.5.0", "zope.interface", true, ""},
+		"pep508":       {`requests[security,tests] >=2.8.1, ==2.8.* ; python_version < "2.7"`, `requests[security,tests]>=2.8.1,==2.8.*; python_version < "2.7"`, "requests", false, ""},
+		"extra":        {`pytest ; extra == 'test-utils'`, `pytest; extra == "test-utils"`, "pytest", true, ""},
+		"url":          {`pip @ https://example.com/pip.whl ; sys_platform == "linux"`, `pip @ https://example.com/pip.whl ; sys_platform == "linux"`, "pip", true, ""},
+		"pep508-paren": {`foo ( >= 1.0 , < 2 ) ; python_version >= "3"`, `foo>=1.0,<2; python_version >= "3"`, "foo", true, ""},
+		"bad-spec":     {"foo (3.1)", "", "", false, `pep345.ParseRequirement: invalid requirement: "foo (3.1)": pep440.ParseVersionSpec: pep440.ParseSpecifier: invalid comparison operator: "3.1"`},
+		"bad-paren":    {"foo (>=3.1", "", "", false, `pep345.ParseRequirement: invalid requirement: "foo (>=3.1": pep440.ParseVersionSpec: "(>=3.1": unbalanced parenthesis`},
+		"bad-nested":   {"foo ((>=3.1))", "", "", false, `pep345.ParseRequirement: invalid requirement: "foo ((>=3.1))": pep440.ParseVersionSpec: "(>=3.1)": unexpected '('`},
+		"bad-name":     {"-foo", "", "", false, `pep345.ParseRequirement: invalid requirement: "-foo"`},
+		"bad-extra":    {"foo[a,,b]", "", "", false, `pep345.ParseRequirement: invalid requirement: "foo[a,,b]": empty extra`},
+		"bad-marker":   {"foo; bogus == '1'", "", "", false, `pep345.ParseRequirement: invalid requirement: "foo; bogus == '1'": pep345.ParseMarker: " bogus == '1'": unknown marker variable: "bogus"`},
+		"empty-marker": {"foo;", "foo", "foo", true, ""},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			req, err := pep345.ParseRequirement(tc.Input)
+			if tc.OutputErr != "" {
+				assert.EqualError(t, err, tc.OutputErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.OutputStr, req.String())
+			assert.Equal(t, tc.OutputName, req.Name)
+			applies, err := req.Applies(linuxPy39)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Applies, applies)
+		})
+	}
+}
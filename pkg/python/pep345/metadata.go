@@ -1,6 +1,6 @@
 // Package pep345 implements PEP 345 -- Metadata for Python Software Packages 1.2.
 //
-// Well, just enough of PEP 345 to implement PEP 503.
+// Well, just enough of PEP 345 to implement PEP 503, and to evaluate "Requires-Dist" lines.
 //
 // https://www.python.org/dev/peps/pep-0345/
 package pep345
@@ -0,0 +1,35 @@
+package pep345
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// ParseMetadata parses the header fields of a core metadata file ("METADATA" in a .dist-info
+// directory, or "PKG-INFO" in an sdist).  The message body (which newer metadata versions use for
+// the long description) is not returned.
+//
+// Field names are canonicalized per textproto.CanonicalMIMEHeaderKey, so for example "Name" and
+// "Requires-Dist" are looked up as-is.
+func ParseMetadata(r io.Reader) (textproto.MIMEHeader, error) {
+	// Like WHEEL files, METADATA files may not have a blank line at the end of the header if
+	// there is no body; so add some trailing CRLFs to keep ReadMIMEHeader happy.
+	kvReader := textproto.NewReader(bufio.NewReader(io.MultiReader(
+		r,
+		strings.NewReader("\r\n\r\n\r\n"),
+	)))
+	header, err := kvReader.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("pep345.ParseMetadata: %w", err)
+	}
+	if header.Get("Name") == "" {
+		return nil, fmt.Errorf("pep345.ParseMetadata: missing required field %q", "Name")
+	}
+	if header.Get("Version") == "" {
+		return nil, fmt.Errorf("pep345.ParseMetadata: missing required field %q", "Version")
+	}
+	return header, nil
+}
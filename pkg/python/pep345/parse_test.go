@@ -0,0 +1,37 @@
+package pep345_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep345"
+)
+
+func TestParseMetadata(t *testing.T) {
+	t.Parallel()
+	metadata, err := pep345.ParseMetadata(strings.NewReader("" +
+		"Metadata-Version: 2.1\n" +
+		"Name: foo\n" +
+		"Version: 1.0\n" +
+		"Summary: A folded\n" +
+		"  summary\n" +
+		"Requires-Dist: bar\n" +
+		"Requires-Dist: baz ; extra == 'x'\n" +
+		"\n" +
+		"Name: not-a-header\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", metadata.Get("Name"))
+	assert.Equal(t, "1.0", metadata.Get("Version"))
+	assert.Equal(t, "A folded summary", metadata.Get("Summary"))
+	assert.Equal(t, []string{"bar", "baz ; extra == 'x'"}, metadata.Values("Requires-Dist"))
+
+	// No trailing newline.
+	_, err = pep345.ParseMetadata(strings.NewReader("Name: foo\nVersion: 1.0"))
+	assert.NoError(t, err)
+
+	_, err = pep345.ParseMetadata(strings.NewReader("Name: foo\n"))
+	assert.EqualError(t, err, `pep345.ParseMetadata: missing required field "Version"`)
+}
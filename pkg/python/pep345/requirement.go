@@ -0,0 +1,113 @@
+package pep345
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+// Requirement is a parsed "Requires-Dist" value, such as
+// `requests[security] (>=2.8.1,==2.8.*) ; python_version < "2.7"`.
+//
+// PEP 345 says that the version specifier is a PEP 345 VersionSpecifier, but in practice modern
+// metadata uses PEP 440 specifiers (and PEP 508 syntax for the rest of the line); so that's what
+// this uses.
+type Requirement struct {
+	Name      string
+	Extras    []string
+	Specifier pep440.Specifier
+	// URL is set for PEP 508 `name @ url` direct references; it is mutually exclusive with
+	// Specifier.
+	URL    string
+	Marker *Marker
+}
+
+var reRequirement = regexp.MustCompile(`^\s*` +
+	`(?P<name>[A-Za-z0-9](?:[A-Za-z0-9._-]*[A-Za-z0-9])?)\s*` +
+	`(?:\[(?P<extras>[^\]]*)\])?\s*` +
+	`(?P<rest>.*)$`)
+
+// ParseRequirement parses a "Requires-Dist" value.
+func ParseRequirement(str string) (*Requirement, error) {
+	var ret Requirement
+
+	body, markerStr := str, ""
+	if idx := strings.Index(str, ";"); idx >= 0 {
+		body, markerStr = str[:idx], str[idx+1:]
+	}
+
+	match := reRequirement.FindStringSubmatch(body)
+	if match == nil {
+		return nil, fmt.Errorf("pep345.ParseRequirement: invalid requirement: %q", str)
+	}
+	ret.Name = match[reRequirement.SubexpIndex("name")]
+	if extras := match[reRequirement.SubexpIndex("extras")]; strings.TrimSpace(extras) != "" {
+		for _, extra := range strings.Split(extras, ",") {
+			extra = strings.TrimSpace(extra)
+			if extra == "" {
+				return nil, fmt.Errorf("pep345.ParseRequirement: invalid requirement: %q: empty extra", str)
+			}
+			ret.Extras = append(ret.Extras, extra)
+		}
+	}
+
+	rest := strings.TrimSpace(match[reRequirement.SubexpIndex("rest")])
+	switch {
+	case strings.HasPrefix(rest, "@"):
+		ret.URL = strings.TrimSpace(strings.TrimPrefix(rest, "@"))
+		if ret.URL == "" {
+			return nil, fmt.Errorf("pep345.ParseRequirement: invalid requirement: %q: empty URL", str)
+		}
+	case rest != "":
+		spec, err := pep440.ParseVersionSpec(rest)
+		if err != nil {
+			return nil, fmt.Errorf("pep345.ParseRequirement: invalid requirement: %q: %w", str, err)
+		}
+		ret.Specifier = spec
+	}
+
+	if strings.TrimSpace(markerStr) != "" {
+		marker, err := ParseMarker(markerStr)
+		if err != nil {
+			return nil, fmt.Errorf("pep345.ParseRequirement: invalid requirement: %q: %w", str, err)
+		}
+		ret.Marker = marker
+	}
+
+	return &ret, nil
+}
+
+// String returns a normalized PEP 508 string representation of the requirement.
+func (req Requirement) String() string {
+	var ret strings.Builder
+	ret.WriteString(req.Name)
+	if len(req.Extras) > 0 {
+		ret.WriteString("[" + strings.Join(req.Extras, ",") + "]")
+	}
+	switch {
+	case req.URL != "":
+		ret.WriteString(" @ " + req.URL)
+		if req.Marker != nil {
+			// A space is required before the ';', or it would be part of the URL.
+			ret.WriteString(" ")
+		}
+	case len(req.Specifier) > 0:
+		ret.WriteString(req.Specifier.String())
+	}
+	if req.Marker != nil {
+		ret.WriteString("; " + req.Marker.String())
+	}
+	return ret.String()
+}
+
+// Applies returns whether the requirement applies in the given environment; that is, whether its
+// marker (if any) evaluates to true.
+func (req Requirement) Applies(env Environment) (bool, error) {
+	ok, err := req.Marker.Evaluate(env)
+	if err != nil {
+		return false, fmt.Errorf("requirement %q: %w", req.Name, err)
+	}
+	return ok, nil
+}
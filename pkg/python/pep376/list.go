@@ -0,0 +1,115 @@
+package pep376
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/datawire/ocibuild/pkg/python/pep345"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+// Installed describes a distribution found in an installation database.
+type Installed struct {
+	Name string `json:"name"`
+	// Version is the PEP 440 normalized version; or the version string as-is if it isn't a
+	// valid PEP 440 version.
+	Version     string `json:"version"`
+	Installer   string `json:"installer,omitempty"`
+	Requested   bool   `json:"requested"`
+	DistInfoDir string `json:"distInfoDir"`
+
+	parsedVersion *pep440.Version
+}
+
+// findDistInfoDirs returns all of the ".dist-info" directories in fsys, in sorted order.
+func findDistInfoDirs(fsys fs.FS) ([]string, error) {
+	var ret []string
+	// Don't use fs.WalkDir, because it stat()s each directory, and layer filesystems may be
+	// missing entries for parent directories.
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		dirents, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return err
+		}
+		for _, dirent := range dirents {
+			if !dirent.IsDir() {
+				continue
+			}
+			name := path.Join(dir, dirent.Name())
+			if strings.HasSuffix(name, ".dist-info") {
+				ret = append(ret, name)
+				continue
+			}
+			if err := walk(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk("."); err != nil {
+		return nil, err
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// ListInstalled returns all of the distributions installed in fsys, sorted by (normalized) name
+// and then by version.  The name and version are read from each .dist-info directory's METADATA
+// file, and the installer from its INSTALLER file (if there is one).
+func ListInstalled(fsys fs.FS) ([]Installed, error) {
+	distInfoDirs, err := findDistInfoDirs(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("pep376.ListInstalled: %w", err)
+	}
+	ret := make([]Installed, 0, len(distInfoDirs))
+	for _, distInfoDir := range distInfoDirs {
+		metadataBytes, err := fs.ReadFile(fsys, path.Join(distInfoDir, "METADATA"))
+		if err != nil {
+			return nil, fmt.Errorf("pep376.ListInstalled: %w", err)
+		}
+		metadata, err := pep345.ParseMetadata(bytes.NewReader(metadataBytes))
+		if err != nil {
+			return nil, fmt.Errorf("pep376.ListInstalled: %q: %w", distInfoDir, err)
+		}
+		dist := Installed{
+			Name:        metadata.Get("Name"),
+			Version:     metadata.Get("Version"),
+			DistInfoDir: distInfoDir,
+		}
+		if ver, err := pep440.ParseVersion(dist.Version); err == nil {
+			dist.parsedVersion = ver
+			dist.Version = ver.String()
+		}
+
+		installer, err := fs.ReadFile(fsys, path.Join(distInfoDir, "INSTALLER"))
+		switch {
+		case err == nil:
+			dist.Installer = strings.TrimSpace(string(installer))
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("pep376.ListInstalled: %w", err)
+		}
+		if _, err := fs.Stat(fsys, path.Join(distInfoDir, "REQUESTED")); err == nil {
+			dist.Requested = true
+		}
+
+		ret = append(ret, dist)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		iName, jName := pep503.NormalizeName(ret[i].Name), pep503.NormalizeName(ret[j].Name)
+		if iName != jName {
+			return iName < jName
+		}
+		if ret[i].parsedVersion != nil && ret[j].parsedVersion != nil {
+			return ret[i].parsedVersion.Cmp(*ret[j].parsedVersion) < 0
+		}
+		return ret[i].Version < ret[j].Version
+	})
+	return ret, nil
+}
@@ -0,0 +1,52 @@
+package pep376_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+)
+
+func TestListInstalled(t *testing.T) {
+	t.Parallel()
+	metadata := func(name, version string) *fstest.MapFile {
+		return &fstest.MapFile{ //nolint:exhaustivestruct
+			Data: []byte("Metadata-Version: 2.1\nName: " + name + "\nVersion: " + version + "\n\nLong description.\n"),
+		}
+	}
+	const sitePackages = "usr/lib/python3.9/site-packages/"
+	fsys := fstest.MapFS{
+		sitePackages + "zed-1.0.dist-info/METADATA":             metadata("zed", "1.0"),
+		sitePackages + "Foo_Bar-2.0.dist-info/METADATA":         metadata("Foo.Bar", "2.0"),
+		sitePackages + "Foo_Bar-2.0.dist-info/INSTALLER":        {Data: []byte("pip\n")},
+		sitePackages + "Foo_Bar-2.0.dist-info/REQUESTED":        {},
+		"usr/local/lib/python3.9/foo_bar-10.dist-info/METADATA": metadata("foo-bar", "10"),
+		"usr/local/lib/python3.9/legacy-1.dist-info/METADATA":   metadata("legacy", "not-a-pep440-version"),
+	}
+
+	dists, err := pep376.ListInstalled(fsys)
+	require.NoError(t, err)
+	type result struct {
+		Name, Version, Installer string
+		Requested                bool
+	}
+	actual := make([]result, 0, len(dists))
+	for _, dist := range dists {
+		actual = append(actual, result{dist.Name, dist.Version, dist.Installer, dist.Requested})
+	}
+	assert.Equal(t, []result{
+		{"Foo.Bar", "2.0", "pip", true},
+		{"foo-bar", "10", "", false},
+		{"legacy", "not-a-pep440-version", "", false},
+		{"zed", "1.0", "", false},
+	}, actual)
+
+	fsys[sitePackages+"zed-1.0.dist-info/METADATA"] = &fstest.MapFile{ //nolint:exhaustivestruct
+		Data: []byte("Metadata-Version: 2.1\nName: zed\n"),
+	}
+	_, err = pep376.ListInstalled(fsys)
+	assert.Error(t, err)
+}
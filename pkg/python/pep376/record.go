@@ -0,0 +1,258 @@
+package pep376
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+// A RecordHash is the hash of a file, as written in the second column of a RECORD file:
+// "ALGORITHM=DIGEST", where DIGEST is the urlsafe-base64-nopad encoding of the digest.
+type RecordHash struct {
+	Algorithm string
+	Digest    []byte
+}
+
+// ParseRecordHash parses the hash column of a RECORD row.  An empty string parses as the zero
+// RecordHash.
+func ParseRecordHash(str string) (RecordHash, error) {
+	if str == "" {
+		return RecordHash{}, nil //nolint:exhaustivestruct // zero value
+	}
+	eq := strings.Index(str, "=")
+	if eq <= 0 {
+		return RecordHash{}, //nolint:exhaustivestruct // zero value
+			fmt.Errorf("invalid hash %q: must be 'ALGORITHM=DIGEST'", str)
+	}
+	digest, err := base64.RawURLEncoding.DecodeString(str[eq+1:])
+	if err != nil {
+		return RecordHash{}, //nolint:exhaustivestruct // zero value
+			fmt.Errorf("invalid hash %q: %w", str, err)
+	}
+	return RecordHash{
+		Algorithm: str[:eq],
+		Digest:    digest,
+	}, nil
+}
+
+// IsZero returns whether the hash is empty (the file was recorded without a hash).
+func (h RecordHash) IsZero() bool {
+	return h.Algorithm == ""
+}
+
+// String formats the hash as it is written in RECORD; it is the inverse of ParseRecordHash.
+func (h RecordHash) String() string {
+	if h.IsZero() {
+		return ""
+	}
+	return h.Algorithm + "=" + base64.RawURLEncoding.EncodeToString(h.Digest)
+}
+
+// Compute returns the hash of the content read from r, using the same algorithm as h.
+func (h RecordHash) Compute(r io.Reader) (RecordHash, error) {
+	newHasher, ok := python.HashlibAlgorithmsGuaranteed[h.Algorithm]
+	if !ok {
+		return RecordHash{}, //nolint:exhaustivestruct // zero value
+			fmt.Errorf("unsupported hash algorithm: %q", h.Algorithm)
+	}
+	hasher := newHasher()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return RecordHash{}, err //nolint:exhaustivestruct // zero value
+	}
+	return RecordHash{
+		Algorithm: h.Algorithm,
+		Digest:    hasher.Sum(nil),
+	}, nil
+}
+
+// A RecordEntry is a single row of a RECORD file.
+type RecordEntry struct {
+	// Path is the path of the file as written in RECORD: relative to the directory that
+	// contains the .dist-info directory (that is: relative to site-packages), or absolute.
+	Path string
+	// Hash is zero for files that are recorded without a hash (such as RECORD itself, and .pyc
+	// files).
+	Hash RecordHash
+	// Size is -1 for files that are recorded without a size.
+	Size int64
+}
+
+// ParseRecord parses the content of a RECORD file.  Rows may omit trailing columns (which is
+// treated the same as the column being empty), but must have a path.
+func ParseRecord(r io.Reader) ([]RecordEntry, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+	rows, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("pep376.ParseRecord: %w", err)
+	}
+	ret := make([]RecordEntry, 0, len(rows))
+	for i, row := range rows {
+		if len(row) == 0 || row[0] == "" {
+			return nil, fmt.Errorf("pep376.ParseRecord: row %d: empty path", i+1)
+		}
+		if len(row) > 3 {
+			return nil, fmt.Errorf("pep376.ParseRecord: row %d: too many columns: %q", i+1, row)
+		}
+		for len(row) < 3 {
+			row = append(row, "")
+		}
+		entry := RecordEntry{
+			Path: row[0],
+			Hash: RecordHash{}, //nolint:exhaustivestruct // zero value
+			Size: -1,
+		}
+		entry.Hash, err = ParseRecordHash(row[1])
+		if err != nil {
+			return nil, fmt.Errorf("pep376.ParseRecord: row %d: %w", i+1, err)
+		}
+		if row[2] != "" {
+			entry.Size, err = strconv.ParseInt(row[2], 10, 64)
+			if err != nil || entry.Size < 0 {
+				return nil, fmt.Errorf("pep376.ParseRecord: row %d: invalid size: %q", i+1, row[2])
+			}
+		}
+		ret = append(ret, entry)
+	}
+	return ret, nil
+}
+
+// WriteRecord writes entries in the RECORD file format, in the order given.
+func WriteRecord(w io.Writer, entries []RecordEntry) error {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.UseCRLF = true
+	for _, entry := range entries {
+		size := ""
+		if entry.Size >= 0 {
+			size = strconv.FormatInt(entry.Size, 10)
+		}
+		if err := csvWriter.Write([]string{entry.Path, entry.Hash.String(), size}); err != nil {
+			return fmt.Errorf("pep376.WriteRecord: %w", err)
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("pep376.WriteRecord: %w", err)
+	}
+	return nil
+}
+
+// resolveRecordPath returns the io/fs path of a RECORD entry's path, given the io/fs path of the
+// .dist-info directory.
+func resolveRecordPath(distInfoDir, recordPath string) string {
+	if path.IsAbs(recordPath) {
+		return strings.TrimPrefix(path.Clean(recordPath), "/")
+	}
+	return strings.TrimPrefix(path.Join("/", path.Dir(distInfoDir), recordPath), "/")
+}
+
+// RecordDiffKind is the kind of a RecordDifference.
+type RecordDiffKind string
+
+const (
+	// RecordDiffMissing is for files that are listed in RECORD but don't exist.
+	RecordDiffMissing RecordDiffKind = "missing"
+	// RecordDiffHash is for files whose content doesn't match the hash in RECORD.
+	RecordDiffHash RecordDiffKind = "hash"
+	// RecordDiffSize is for files whose size doesn't match the size in RECORD.
+	RecordDiffSize RecordDiffKind = "size"
+)
+
+// A RecordDifference is a way in which the files on a filesystem don't match a RECORD file.
+type RecordDifference struct {
+	Kind RecordDiffKind
+	// Path is the io/fs path of the file.
+	Path string
+	// Expected and Actual are the values from RECORD and from the filesystem; they are empty
+	// for RecordDiffMissing.
+	Expected string
+	Actual   string
+}
+
+func (d RecordDifference) String() string {
+	if d.Kind == RecordDiffMissing {
+		return fmt.Sprintf("%s: missing", d.Path)
+	}
+	return fmt.Sprintf("%s: %s mismatch: RECORD=%s actual=%s", d.Path, d.Kind, d.Expected, d.Actual)
+}
+
+// DiffRecord compares the entries of a RECORD file against the actual files in fsys, returning
+// the differences in the order of the entries.  distInfoDir is the io/fs path of the .dist-info
+// directory that the RECORD file is in.  Entries without a hash or size (such as RECORD itself,
+// .pyc files, and symlinks) are only checked for existence.  Files that exist but aren't listed
+// in RECORD are not reported, as RECORD doesn't say which directories a distribution owns.
+func DiffRecord(fsys fs.FS, distInfoDir string, entries []RecordEntry) ([]RecordDifference, error) {
+	var ret []RecordDifference
+	for _, entry := range entries {
+		name := resolveRecordPath(distInfoDir, entry.Path)
+		if !lexists(fsys, name) {
+			ret = append(ret, RecordDifference{
+				Kind:     RecordDiffMissing,
+				Path:     name,
+				Expected: "",
+				Actual:   "",
+			})
+			continue
+		}
+		if entry.Size >= 0 {
+			info, err := fs.Stat(fsys, name)
+			if err != nil {
+				return nil, fmt.Errorf("pep376.DiffRecord: %w", err)
+			}
+			if info.Size() != entry.Size {
+				ret = append(ret, RecordDifference{
+					Kind:     RecordDiffSize,
+					Path:     name,
+					Expected: strconv.FormatInt(entry.Size, 10),
+					Actual:   strconv.FormatInt(info.Size(), 10),
+				})
+			}
+		}
+		if !entry.Hash.IsZero() {
+			actual, err := func() (RecordHash, error) {
+				file, err := fsys.Open(name)
+				if err != nil {
+					return RecordHash{}, err //nolint:exhaustivestruct // zero value
+				}
+				defer func() {
+					_ = file.Close()
+				}()
+				return entry.Hash.Compute(file)
+			}()
+			if err != nil {
+				return nil, fmt.Errorf("pep376.DiffRecord: %q: %w", name, err)
+			}
+			if actual.String() != entry.Hash.String() {
+				ret = append(ret, RecordDifference{
+					Kind:     RecordDiffHash,
+					Path:     name,
+					Expected: entry.Hash.String(),
+					Actual:   actual.String(),
+				})
+			}
+		}
+	}
+	return ret, nil
+}
+
+// lexists returns whether name exists in fsys, without following symlinks (which may point
+// outside of fsys).
+func lexists(fsys fs.FS, name string) bool {
+	dirents, err := fs.ReadDir(fsys, path.Dir(name))
+	if err != nil {
+		return false
+	}
+	for _, dirent := range dirents {
+		if dirent.Name() == path.Base(name) {
+			return true
+		}
+	}
+	return false
+}
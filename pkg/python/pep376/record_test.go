@@ -0,0 +1,103 @@
+package pep376_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+)
+
+func recordHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256=" + base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestParseRecord(t *testing.T) {
+	t.Parallel()
+	record := strings.Join([]string{
+		"../../../bin/foo," + recordHash("#!/usr/bin/python3\n") + ",19",
+		"foo/__pycache__/__init__.cpython-39.pyc,,",
+		`"foo/with,comma.py",` + recordHash("") + ",0",
+		"foo_bar-1.0.dist-info/RECORD",
+	}, "\r\n") + "\r\n"
+
+	entries, err := pep376.ParseRecord(strings.NewReader(record))
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "../../../bin/foo", entries[0].Path)
+	assert.Equal(t, "sha256", entries[0].Hash.Algorithm)
+	assert.Equal(t, recordHash("#!/usr/bin/python3\n"), entries[0].Hash.String())
+	assert.Equal(t, int64(19), entries[0].Size)
+	assert.True(t, entries[1].Hash.IsZero())
+	assert.Equal(t, int64(-1), entries[1].Size)
+	assert.Equal(t, "foo/with,comma.py", entries[2].Path)
+	assert.Equal(t, int64(0), entries[2].Size)
+	assert.Equal(t, "foo_bar-1.0.dist-info/RECORD", entries[3].Path)
+	assert.True(t, entries[3].Hash.IsZero())
+	assert.Equal(t, int64(-1), entries[3].Size)
+
+	// Round-trip; WriteRecord always writes 3 columns.
+	var buf bytes.Buffer
+	require.NoError(t, pep376.WriteRecord(&buf, entries))
+	assert.Equal(t, strings.Replace(record, "RECORD\r\n", "RECORD,,\r\n", 1), buf.String())
+
+	for name, bad := range map[string]string{
+		"empty-path":  ",,\r\n",
+		"bad-hash":    "foo.py,nohash,1\r\n",
+		"bad-base64":  "foo.py,sha256=!!!,1\r\n",
+		"bad-size":    "foo.py,,big\r\n",
+		"neg-size":    "foo.py,,-1\r\n",
+		"too-many":    "foo.py,,,\r\n",
+		"bad-quoting": "\"foo.py,,\r\n",
+	} {
+		_, err := pep376.ParseRecord(strings.NewReader(bad))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestDiffRecord(t *testing.T) {
+	t.Parallel()
+	fsys := fstest.MapFS{
+		"usr/bin/foo": &fstest.MapFile{Data: []byte("#!/usr/bin/python3\n")},
+		"usr/lib/python3.9/site-packages/foo/__init__.py":              &fstest.MapFile{Data: []byte("changed\n")},
+		"usr/lib/python3.9/site-packages/foo/mod.py":                   &fstest.MapFile{Data: []byte("x = 1\n")},
+		"usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info/RECORD": &fstest.MapFile{},
+	}
+	record := strings.Join([]string{
+		"../../../bin/foo," + recordHash("#!/usr/bin/python3\n") + ",19",
+		"foo/__init__.py," + recordHash("original\n") + ",9",
+		"foo/mod.py," + recordHash("x = 1\n") + ",6",
+		"foo/__pycache__/__init__.cpython-39.pyc,,",
+		"foo_bar-1.0.dist-info/RECORD,,",
+	}, "\r\n") + "\r\n"
+	entries, err := pep376.ParseRecord(strings.NewReader(record))
+	require.NoError(t, err)
+
+	diffs, err := pep376.DiffRecord(fsys, "usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info", entries)
+	require.NoError(t, err)
+	assert.Equal(t, []pep376.RecordDifference{
+		{
+			Kind:     pep376.RecordDiffSize,
+			Path:     "usr/lib/python3.9/site-packages/foo/__init__.py",
+			Expected: "9",
+			Actual:   "8",
+		},
+		{
+			Kind:     pep376.RecordDiffHash,
+			Path:     "usr/lib/python3.9/site-packages/foo/__init__.py",
+			Expected: recordHash("original\n"),
+			Actual:   recordHash("changed\n"),
+		},
+		{
+			Kind: pep376.RecordDiffMissing,
+			Path: "usr/lib/python3.9/site-packages/foo/__pycache__/__init__.cpython-39.pyc",
+		},
+	}, diffs)
+}
@@ -1,5 +1,5 @@
-// Package pep376 implements the REQUESTED metadata of PEP 375 -- Database of Installed Python
-// Distributions.
+// Package pep376 implements the REQUESTED metadata and the uninstall side of PEP 376 -- Database of
+// Installed Python Distributions.
 //
 // https://packaging.python.org/en/latest/specifications/recording-installed-packages/
 package pep376
@@ -8,12 +8,46 @@ import (
 	"archive/tar"
 	"context"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
 	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
 )
 
+// RecordRequestedFor is like RecordRequested, but only marks the distribution as REQUESTED if its
+// name is one of distNames; this is for installing a dependency closure, where only some of the
+// distributions were asked for by the user and the others were pulled in as dependencies.  Names
+// are compared after PEP 503 normalization.
+func RecordRequestedFor(requested string, distNames ...string) bdist.PostInstallHook {
+	names := make(map[string]struct{}, len(distNames))
+	for _, name := range distNames {
+		names[pep503.NormalizeName(name)] = struct{}{}
+	}
+	hook := RecordRequested(requested)
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		vfs map[string]fsutil.FileReference,
+		installedDistInfoDir string,
+	) error {
+		if _, ok := names[pep503.NormalizeName(distInfoName(installedDistInfoDir))]; !ok {
+			return nil
+		}
+		return hook(ctx, clampTime, vfs, installedDistInfoDir)
+	}
+}
+
+// distInfoName returns the distribution name from a "{name}-{version}.dist-info" directory name.
+func distInfoName(distInfoDir string) string {
+	name := strings.TrimSuffix(path.Base(distInfoDir), ".dist-info")
+	if idx := strings.LastIndex(name, "-"); idx >= 0 {
+		name = name[:idx]
+	}
+	return name
+}
+
 func RecordRequested(requested string) bdist.PostInstallHook {
 	return func(
 		ctx context.Context,
@@ -0,0 +1,267 @@
+package pep376
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// UninstallManifest is a machine-readable description of everything that needs to be removed in
+// order to uninstall a distribution.  It is derived from the distribution's RECORD file.
+//
+// All paths follow io/fs rules: they use forward-slashes, and are absolute paths but without the
+// leading "/".
+type UninstallManifest struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	DistInfoDir string `json:"dist_info_dir"`
+
+	// Files is the sorted list of files listed in RECORD (including RECORD itself).
+	Files []string `json:"files"`
+
+	// PycacheGlobs is a list of path.Match patterns matching compiled bytecode for the .py files
+	// in Files.  Installers are not required to list .pyc files in RECORD, so uninstallers
+	// should remove these even if they aren't mentioned in Files.
+	PycacheGlobs []string `json:"pycache_globs,omitempty"`
+
+	// Dirs is the list of directories that were created for the distribution, deepest-first;
+	// they should be removed if they are empty after removing the files.  Only directories
+	// inside of the directory containing the .dist-info directory (that is: inside of
+	// site-packages) are listed; shared directories such as the scripts directory are not.
+	Dirs []string `json:"dirs"`
+}
+
+// NewUninstallManifest builds an UninstallManifest from the contents of the RECORD file of the
+// distribution installed at installedDistInfoDir.
+func NewUninstallManifest(installedDistInfoDir string, record io.Reader) (*UninstallManifest, error) {
+	installedDistInfoDir = strings.Trim(path.Clean("/"+installedDistInfoDir), "/")
+	baseDir := path.Dir("/" + installedDistInfoDir)
+
+	nameVer := strings.TrimSuffix(path.Base(installedDistInfoDir), ".dist-info")
+	name := distInfoName(installedDistInfoDir)
+	ret := &UninstallManifest{
+		Name:        name,
+		Version:     strings.TrimPrefix(nameVer[len(name):], "-"),
+		DistInfoDir: installedDistInfoDir,
+	}
+
+	entries, err := ParseRecord(record)
+	if err != nil {
+		return nil, fmt.Errorf("pep376.NewUninstallManifest: parse RECORD: %w", err)
+	}
+
+	files := make(map[string]struct{}, len(entries))
+	globs := make(map[string]struct{})
+	dirs := map[string]struct{}{
+		installedDistInfoDir: {},
+	}
+	for _, entry := range entries {
+		fullname := "/" + resolveRecordPath(installedDistInfoDir, entry.Path)
+		files[fullname[1:]] = struct{}{}
+
+		if strings.HasSuffix(fullname, ".py") {
+			dir, file := path.Split(fullname)
+			globs[path.Join(dir, "__pycache__", strings.TrimSuffix(file, ".py")+".*.pyc")[1:]] = struct{}{}
+		}
+
+		for dir := path.Dir(fullname); strings.HasPrefix(dir, baseDir+"/"); dir = path.Dir(dir) {
+			dirs[dir[1:]] = struct{}{}
+		}
+	}
+	for glob := range globs {
+		dirs[path.Dir(glob)] = struct{}{}
+	}
+
+	ret.Files = sortedKeys(files)
+	ret.PycacheGlobs = sortedKeys(globs)
+	ret.Dirs = sortedKeys(dirs)
+	// Reverse-sorting puts children before their parents.
+	sort.Sort(sort.Reverse(sort.StringSlice(ret.Dirs)))
+
+	return ret, nil
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	ret := make([]string, 0, len(set))
+	for key := range set {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// RecordUninstallManifest returns a bdist.PostInstallHook that builds an UninstallManifest for the
+// installed distribution and passes it to fn.  Because it reads the RECORD file, it must run after
+// the hook that writes RECORD (recording_installs.Record).
+func RecordUninstallManifest(fn func(*UninstallManifest) error) bdist.PostInstallHook {
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		vfs map[string]fsutil.FileReference,
+		installedDistInfoDir string,
+	) error {
+		recordFile, ok := vfs[path.Join(installedDistInfoDir, "RECORD")]
+		if !ok {
+			return fmt.Errorf("pep376.RecordUninstallManifest: %q has no RECORD file", installedDistInfoDir)
+		}
+		reader, err := recordFile.Open()
+		if err != nil {
+			return fmt.Errorf("pep376.RecordUninstallManifest: %w", err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		manifest, err := NewUninstallManifest(installedDistInfoDir, reader)
+		if err != nil {
+			return err
+		}
+		return fn(manifest)
+	}
+}
+
+// FindDistInfo searches fsys for the .dist-info directory of the installed distribution named
+// distName (compared after PEP 503 normalization), returning its path.  It is an error if there is
+// not exactly one such directory.
+func FindDistInfo(fsys fs.FS, distName string) (string, error) {
+	want := pep503.NormalizeName(distName)
+	distInfoDirs, err := findDistInfoDirs(fsys)
+	if err != nil {
+		return "", fmt.Errorf("pep376.FindDistInfo: %w", err)
+	}
+	var matches []string
+	for _, distInfoDir := range distInfoDirs {
+		if pep503.NormalizeName(distInfoName(distInfoDir)) == want {
+			matches = append(matches, distInfoDir)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("pep376.FindDistInfo: distribution %q is not installed", distName)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("pep376.FindDistInfo: distribution %q is installed multiple times: %q",
+			distName, matches)
+	}
+}
+
+// Uninstall returns a layer of whiteout entries that, when applied on top of fsys, removes the
+// installed distribution named distName; including any compiled bytecode and any directories that
+// would be left empty.
+func Uninstall(
+	fsys fs.FS,
+	distName string,
+	clampTime time.Time,
+	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, *UninstallManifest, error) {
+	return UninstallContext(context.Background(), fsys, distName, clampTime, opts...)
+}
+
+// UninstallContext is like Uninstall, but generating the layer stops early if ctx is canceled.
+func UninstallContext(
+	ctx context.Context,
+	fsys fs.FS,
+	distName string,
+	clampTime time.Time,
+	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, *UninstallManifest, error) {
+	distInfoDir, err := FindDistInfo(fsys, distName)
+	if err != nil {
+		return nil, nil, err
+	}
+	record, err := fsys.Open(path.Join(distInfoDir, "RECORD"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("pep376.Uninstall: %w", err)
+	}
+	manifest, err := NewUninstallManifest(distInfoDir, record)
+	_ = record.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listings := make(map[string][]fs.DirEntry)
+	readDir := func(dir string) []fs.DirEntry {
+		if _, ok := listings[dir]; !ok {
+			// A missing directory just has no entries.
+			listings[dir], _ = fs.ReadDir(fsys, dir)
+		}
+		return listings[dir]
+	}
+	exists := func(name string) bool {
+		for _, dirent := range readDir(path.Dir(name)) {
+			if dirent.Name() == path.Base(name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	removed := make(map[string]struct{})
+	for _, file := range manifest.Files {
+		if exists(file) {
+			removed[file] = struct{}{}
+		}
+	}
+	for _, glob := range manifest.PycacheGlobs {
+		for _, dirent := range readDir(path.Dir(glob)) {
+			name := path.Join(path.Dir(glob), dirent.Name())
+			if fsutil.MatchGlob([]string{glob}, name) != "" {
+				removed[name] = struct{}{}
+			}
+		}
+	}
+	for _, dir := range manifest.Dirs { // deepest-first
+		entries := readDir(dir)
+		if len(entries) == 0 {
+			continue
+		}
+		empty := true
+		for _, dirent := range entries {
+			if _, ok := removed[path.Join(dir, dirent.Name())]; !ok {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			removed[dir] = struct{}{}
+		}
+	}
+
+	var vfs []fsutil.FileReference //nolint:prealloc // 'continue' is quite likely
+	for name := range removed {
+		if _, parentRemoved := removed[path.Dir(name)]; parentRemoved {
+			continue
+		}
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(path.Dir(name), ".wh."+path.Base(name)),
+			Mode:     0o644,
+			ModTime:  clampTime,
+		}
+		vfs = append(vfs, &fsutil.InMemFileReference{
+			FileInfo:  header.FileInfo(),
+			MFullName: header.Name,
+		})
+	}
+	layer, err := fsutil.LayerFromFileReferencesContext(ctx, vfs, clampTime, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pep376.Uninstall: %w", err)
+	}
+	return layer, manifest, nil
+}
@@ -0,0 +1,127 @@
+package pep376_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+)
+
+func TestNewUninstallManifest(t *testing.T) {
+	t.Parallel()
+	record := strings.Join([]string{
+		"../../../bin/foo,sha256=AAAA,10",
+		"foo/__init__.py,sha256=BBBB,20",
+		"foo/__pycache__/__init__.cpython-39.pyc,,",
+		"foo/sub/mod.py,sha256=CCCC,30",
+		"foo_bar-1.0.dist-info/METADATA,sha256=DDDD,40",
+		"foo_bar-1.0.dist-info/RECORD,,",
+	}, "\r\n") + "\r\n"
+	manifest, err := pep376.NewUninstallManifest("usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info",
+		strings.NewReader(record))
+	require.NoError(t, err)
+	assert.Equal(t, &pep376.UninstallManifest{
+		Name:        "foo_bar",
+		Version:     "1.0",
+		DistInfoDir: "usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info",
+		Files: []string{
+			"usr/bin/foo",
+			"usr/lib/python3.9/site-packages/foo/__init__.py",
+			"usr/lib/python3.9/site-packages/foo/__pycache__/__init__.cpython-39.pyc",
+			"usr/lib/python3.9/site-packages/foo/sub/mod.py",
+			"usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info/METADATA",
+			"usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info/RECORD",
+		},
+		PycacheGlobs: []string{
+			"usr/lib/python3.9/site-packages/foo/__pycache__/__init__.*.pyc",
+			"usr/lib/python3.9/site-packages/foo/sub/__pycache__/mod.*.pyc",
+		},
+		Dirs: []string{
+			"usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info",
+			"usr/lib/python3.9/site-packages/foo/sub/__pycache__",
+			"usr/lib/python3.9/site-packages/foo/sub",
+			"usr/lib/python3.9/site-packages/foo/__pycache__",
+			"usr/lib/python3.9/site-packages/foo",
+		},
+	}, manifest)
+}
+
+func TestRecordRequestedFor(t *testing.T) {
+	t.Parallel()
+	hook := pep376.RecordRequestedFor("", "Foo.Bar", "baz")
+	testcases := map[string]bool{
+		"site-packages/foo_bar-1.0.dist-info": true,
+		"site-packages/baz-2.0.dist-info":     true,
+		"site-packages/qux-1.0.dist-info":     false,
+		"site-packages/foo-1.0.dist-info":     false,
+	}
+	for distInfoDir, expRequested := range testcases {
+		distInfoDir := distInfoDir
+		expRequested := expRequested
+		t.Run(distInfoDir, func(t *testing.T) {
+			t.Parallel()
+			vfs := make(map[string]fsutil.FileReference)
+			require.NoError(t, hook(context.Background(), time.Time{}, vfs, distInfoDir))
+			_, actRequested := vfs[distInfoDir+"/REQUESTED"]
+			assert.Equal(t, expRequested, actRequested)
+		})
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	t.Parallel()
+	record := "../../../bin/foo,sha256=AAAA,10\r\n" +
+		"foo/__init__.py,sha256=BBBB,20\r\n" +
+		"foo/data.txt,sha256=CCCC,30\r\n" +
+		"foo_bar-1.0.dist-info/METADATA,sha256=DDDD,40\r\n" +
+		"foo_bar-1.0.dist-info/RECORD,,\r\n"
+	fsys := fstest.MapFS{
+		"usr/bin/foo":    {},
+		"usr/bin/python": {},
+		"usr/lib/python3.9/site-packages/foo/__init__.py":                         {},
+		"usr/lib/python3.9/site-packages/foo/__pycache__/__init__.cpython-39.pyc": {},
+		"usr/lib/python3.9/site-packages/foo/data.txt":                            {},
+		"usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info/METADATA":          {},
+		"usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info/RECORD":            {Data: []byte(record)},
+		"usr/lib/python3.9/site-packages/other/__init__.py":                       {},
+		"usr/lib/python3.9/site-packages/other-2.0.dist-info/RECORD":              {},
+	}
+
+	layer, manifest, err := pep376.Uninstall(fsys, "Foo.Bar", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, "usr/lib/python3.9/site-packages/foo_bar-1.0.dist-info", manifest.DistInfoDir)
+
+	layerReader, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, layerReader.Close())
+	}()
+	var names []string
+	tarReader := tar.NewReader(layerReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{
+		"usr/bin/.wh.foo",
+		"usr/lib/python3.9/site-packages/.wh.foo",
+		"usr/lib/python3.9/site-packages/.wh.foo_bar-1.0.dist-info",
+	}, names)
+
+	_, _, err = pep376.Uninstall(fsys, "baz", time.Time{})
+	assert.EqualError(t, err, `pep376.FindDistInfo: distribution "baz" is not installed`)
+}
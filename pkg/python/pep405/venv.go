@@ -0,0 +1,203 @@
+// Package pep405 implements PEP 405 -- Python Virtual Environments.
+//
+// https://peps.python.org/pep-0405/
+package pep405
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// Config is the content of a "pyvenv.cfg" file.
+type Config struct {
+	// Home is the directory containing the base interpreter.
+	Home string
+	// IncludeSystemSitePackages is whether the base interpreter's site-packages are visible
+	// in the virtual environment.
+	IncludeSystemSitePackages bool
+	// Version is the version of the base interpreter, as "{major}.{minor}.{micro}".
+	Version string
+	// Extra is any other keys, such as the "executable" and "command" keys that newer versions
+	// of `python -m venv` write.
+	Extra map[string]string
+}
+
+// Bytes returns the config in the format that `python -m venv` writes.
+func (cfg Config) Bytes() []byte {
+	var ret strings.Builder
+	fmt.Fprintf(&ret, "home = %s\n", cfg.Home)
+	fmt.Fprintf(&ret, "include-system-site-packages = %t\n", cfg.IncludeSystemSitePackages)
+	if cfg.Version != "" {
+		fmt.Fprintf(&ret, "version = %s\n", cfg.Version)
+	}
+	keys := make([]string, 0, len(cfg.Extra))
+	for key := range cfg.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&ret, "%s = %s\n", key, cfg.Extra[key])
+	}
+	return []byte(ret.String())
+}
+
+// ParseConfig parses a "pyvenv.cfg" file.  This mimics the parsing in Python's `site.py`: each line
+// containing a "=" is a "key = value" pair, keys are case-insensitive, and any other line is
+// ignored.  It is an error for the "home" key to be missing.
+func ParseConfig(r io.Reader) (*Config, error) {
+	var ret Config
+	haveHome := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, val, ok := cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+		switch key {
+		case "home":
+			ret.Home = val
+			haveHome = true
+		case "include-system-site-packages":
+			ret.IncludeSystemSitePackages = strings.ToLower(val) == "true"
+		case "version":
+			ret.Version = val
+		default:
+			if ret.Extra == nil {
+				ret.Extra = make(map[string]string)
+			}
+			ret.Extra[key] = val
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("pep405.ParseConfig: %w", err)
+	}
+	if !haveHome {
+		return nil, fmt.Errorf("pep405.ParseConfig: missing %q key", "home")
+	}
+	return &ret, nil
+}
+
+// cut is strings.Cut, which isn't available until Go 1.18.
+func cut(str, sep string) (before, after string, found bool) {
+	if i := strings.Index(str, sep); i >= 0 {
+		return str[:i], str[i+len(sep):], true
+	}
+	return str, "", false
+}
+
+// VenvConfig returns the "pyvenv.cfg" config for a virtual environment.
+func VenvConfig(venv python.Venv) Config {
+	return Config{
+		Home:                      venv.Home(),
+		IncludeSystemSitePackages: venv.IncludeSystemSitePackages,
+		Version: fmt.Sprintf("%d.%d.%d",
+			venv.Version.Major, venv.Version.Minor, venv.Version.Micro),
+		Extra: nil,
+	}
+}
+
+// Venv returns the python.Venv for a virtual environment at root with the given config, as found
+// when inspecting an interpreter in that virtual environment.  The baseExecutable and version are
+// those of the base interpreter (`sys._base_executable` and `sys.version_info`).
+func (cfg Config) Venv(root, baseExecutable string, version python.VersionInfo) python.Venv {
+	if baseExecutable == "" {
+		baseExecutable = cfg.Extra["executable"]
+	}
+	return python.Venv{
+		Root:                      root,
+		BaseExecutable:            baseExecutable,
+		Version:                   version,
+		IncludeSystemSitePackages: cfg.IncludeSystemSitePackages,
+	}
+}
+
+// CreateVenv returns a PostInstallHook that adds the skeleton of the plat.Venv virtual environment
+// to the layer, so that the layer is a self-contained virtual environment: "pyvenv.cfg", and (for a
+// non-Windows platform) the "bin/python" symlinks to the base interpreter, and the "lib64" symlink.
+// Windows virtual environments have a copy of the interpreter in "Scripts" rather than a symlink,
+// which can't be created without access to the base interpreter, so for a Windows platform only
+// "pyvenv.cfg" is added.  If plat.Venv is nil, the hook does nothing.
+//
+// The hook should run after recording_installs.Record, so that the virtual environment's own files
+// don't get recorded as belonging to the package (and removed when the package is uninstalled).
+func CreateVenv(plat python.Platform) bdist.PostInstallHook {
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		vfs map[string]fsutil.FileReference,
+		installedDistInfoDir string,
+	) error {
+		if plat.Venv == nil {
+			return nil
+		}
+		root := strings.TrimPrefix(plat.ToSlash(plat.Venv.Root), "/")
+
+		var headers []*tar.Header
+		headers = append(headers, &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(root, "pyvenv.cfg"),
+			Mode:     0o644,
+		})
+		content := map[string][]byte{
+			path.Join(root, "pyvenv.cfg"): VenvConfig(*plat.Venv).Bytes(),
+		}
+		if !plat.Windows {
+			pythonXY := fmt.Sprintf("python%d.%d", plat.Venv.Version.Major, plat.Venv.Version.Minor)
+			symlinks := []struct {
+				name   string
+				target string
+			}{
+				{"bin/python", plat.Venv.BaseExecutable},
+				{fmt.Sprintf("bin/python%d", plat.Venv.Version.Major), "python"},
+				{"bin/" + pythonXY, "python"},
+				{"lib64", "lib"},
+			}
+			for _, symlink := range symlinks {
+				name := path.Join(root, symlink.name)
+				headers = append(headers, &tar.Header{
+					Typeflag: tar.TypeSymlink,
+					Name:     name,
+					Linkname: symlink.target,
+					Mode:     0o777,
+				})
+				// Like a ZIP file, the content of a symlink is the path that it points to.
+				content[name] = []byte(symlink.target)
+			}
+			headers = append(headers, &tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     path.Join(root, "include"),
+				Mode:     0o755,
+			})
+		}
+
+		for _, header := range headers {
+			header.ModTime = clampTime
+			header.Size = int64(len(content[header.Name]))
+			if header.Typeflag != tar.TypeReg {
+				header.Size = 0
+			}
+			if _, exists := vfs[header.Name]; exists {
+				continue
+			}
+			vfs[header.Name] = &fsutil.InMemFileReference{
+				FileInfo:  header.FileInfo(),
+				MFullName: header.Name,
+				MContent:  content[header.Name],
+			}
+		}
+		return nil
+	}
+}
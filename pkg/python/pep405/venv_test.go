@@ -0,0 +1,142 @@
+package pep405_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep405"
+)
+
+func TestCreateVenv(t *testing.T) {
+	t.Parallel()
+	base := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3.9",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3.9/site-packages",
+			PlatLib: "/usr/lib64/python3.9/site-packages",
+			Headers: "/usr/include/site/python3.9",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		VersionInfo: &python.VersionInfo{Major: 3, Minor: 9, Micro: 7, ReleaseLevel: "final"},
+	}
+	plat, err := base.WithVenv("/app/venv")
+	require.NoError(t, err)
+	assert.Equal(t, python.Scheme{
+		PureLib: "/app/venv/lib/python3.9/site-packages",
+		PlatLib: "/app/venv/lib/python3.9/site-packages",
+		Headers: "/app/venv/include/site/python3.9",
+		Scripts: "/app/venv/bin",
+		Data:    "/app/venv",
+		Include: "/app/venv/include/python3.9",
+	}, plat.Scheme)
+	assert.Equal(t, "/app/venv/bin/python", plat.ConsoleShebang)
+	assert.Equal(t, "/usr/bin", plat.Venv.Home())
+
+	_, err = plat.WithVenv("/app/other")
+	assert.Error(t, err, "nested venv")
+	_, err = base.WithVenv("app/venv")
+	assert.Error(t, err, "relative root")
+
+	vfs := make(map[string]fsutil.FileReference)
+	require.NoError(t, pep405.CreateVenv(plat)(context.Background(), time.Time{}, vfs, ""))
+	names := make([]string, 0, len(vfs))
+	for name := range vfs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{
+		"app/venv/bin/python",
+		"app/venv/bin/python3",
+		"app/venv/bin/python3.9",
+		"app/venv/include",
+		"app/venv/lib64",
+		"app/venv/pyvenv.cfg",
+	}, names)
+
+	read := func(name string) string {
+		reader, err := vfs[name].Open()
+		require.NoError(t, err)
+		defer reader.Close()
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "home = /usr/bin\ninclude-system-site-packages = false\nversion = 3.9.7\n",
+		read("app/venv/pyvenv.cfg"))
+	assert.Equal(t, fs.ModeSymlink, vfs["app/venv/bin/python"].Mode().Type())
+	assert.Equal(t, "/usr/bin/python3.9", read("app/venv/bin/python"))
+	assert.Equal(t, "python", read("app/venv/bin/python3.9"))
+}
+
+func TestCreateVenvWindows(t *testing.T) {
+	t.Parallel()
+	base := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: `C:\Python39\python.exe`,
+		Scheme: python.Scheme{
+			PureLib: `C:\Python39\Lib\site-packages`,
+			PlatLib: `C:\Python39\Lib\site-packages`,
+			Headers: `C:\Python39\Include\site`,
+			Scripts: `C:\Python39\Scripts`,
+			Data:    `C:\Python39`,
+		},
+		Windows:     true,
+		VersionInfo: &python.VersionInfo{Major: 3, Minor: 9, Micro: 7, ReleaseLevel: "final"},
+	}
+	plat, err := base.WithVenv(`C:\app\venv\`)
+	require.NoError(t, err)
+	assert.Equal(t, `C:\app\venv\Lib\site-packages`, plat.Scheme.PureLib)
+	assert.Equal(t, `C:\app\venv\Scripts`, plat.Scheme.Scripts)
+	assert.Equal(t, `C:\app\venv\Scripts\python.exe`, plat.ConsoleShebang)
+	assert.Equal(t, `C:\Python39`, plat.Venv.Home())
+
+	vfs := make(map[string]fsutil.FileReference)
+	require.NoError(t, pep405.CreateVenv(plat)(context.Background(), time.Time{}, vfs, ""))
+	assert.Len(t, vfs, 1)
+	assert.Contains(t, vfs, "app/venv/pyvenv.cfg")
+}
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+	cfg, err := pep405.ParseConfig(strings.NewReader("" +
+		"home = /usr/local/bin\n" +
+		"Include-System-Site-Packages = True\n" +
+		"version = 3.11.2\n" +
+		"executable = /usr/local/bin/python3.11\n" +
+		"command = /usr/local/bin/python3 -m venv /app/venv\n" +
+		"this line is ignored\n"))
+	require.NoError(t, err)
+	assert.Equal(t, &pep405.Config{
+		Home:                      "/usr/local/bin",
+		IncludeSystemSitePackages: true,
+		Version:                   "3.11.2",
+		Extra: map[string]string{
+			"executable": "/usr/local/bin/python3.11",
+			"command":    "/usr/local/bin/python3 -m venv /app/venv",
+		},
+	}, cfg)
+
+	venv := cfg.Venv("/app/venv", "", python.VersionInfo{Major: 3, Minor: 11, Micro: 2, ReleaseLevel: "final"})
+	assert.Equal(t, "/usr/local/bin/python3.11", venv.BaseExecutable)
+	assert.True(t, venv.IncludeSystemSitePackages)
+
+	// Round-trip
+	again, err := pep405.ParseConfig(bytes.NewReader(cfg.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, cfg, again)
+
+	_, err = pep405.ParseConfig(strings.NewReader("version = 3.11.2\n"))
+	assert.Error(t, err, "missing home")
+}
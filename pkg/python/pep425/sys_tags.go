@@ -0,0 +1,139 @@
+package pep425
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// This file implements the tag-list generation of `packaging.tags.sys_tags()` for CPython, so
+// that an Installer can be computed for a Python version and platform without running Python.
+//
+// https://packaging.pypa.io/en/latest/tags.html
+
+// CPythonInstaller returns the tags supported by CPython major.minor on the given platforms, in the
+// same order as `packaging.tags.sys_tags()` would list them.  If abis is empty, the default ABI
+// for that version is used ("cp311", or "cp37m" for versions before 3.8).  Each of the platforms
+// is expanded with PlatformTags.
+func CPythonInstaller(major, minor int, abis, platforms []string) Installer {
+	interpreter := fmt.Sprintf("cp%d%d", major, minor)
+	if len(abis) == 0 {
+		abi := interpreter
+		if major == 3 && minor < 8 {
+			abi += "m"
+		}
+		abis = []string{abi}
+	}
+	var expandedPlatforms []string
+	for _, platform := range platforms {
+		expandedPlatforms = append(expandedPlatforms, PlatformTags(platform)...)
+	}
+	abi3 := major == 3 && minor >= 2
+
+	var ret Installer
+	add := func(python, abi string, platforms ...string) {
+		for _, platform := range platforms {
+			ret = append(ret, Tag{Python: python, ABI: abi, Platform: platform})
+		}
+	}
+
+	// packaging.tags.cpython_tags()
+	for _, abi := range abis {
+		if abi == "abi3" || abi == "none" {
+			continue
+		}
+		add(interpreter, abi, expandedPlatforms...)
+	}
+	if abi3 {
+		add(interpreter, "abi3", expandedPlatforms...)
+	}
+	add(interpreter, "none", expandedPlatforms...)
+	if abi3 {
+		for m := minor - 1; m > 1; m-- {
+			add(fmt.Sprintf("cp%d%d", major, m), "abi3", expandedPlatforms...)
+		}
+	}
+
+	// packaging.tags.compatible_tags()
+	pyVersions := []string{fmt.Sprintf("py%d%d", major, minor), fmt.Sprintf("py%d", major)}
+	for m := minor - 1; m >= 0; m-- {
+		pyVersions = append(pyVersions, fmt.Sprintf("py%d%d", major, m))
+	}
+	for _, py := range pyVersions {
+		add(py, "none", expandedPlatforms...)
+	}
+	add(interpreter, "none", "any")
+	for _, py := range pyVersions {
+		add(py, "none", "any")
+	}
+
+	return Expand(ret)
+}
+
+var (
+	reManylinux       = regexp.MustCompile(`^manylinux_([0-9]+)_([0-9]+)_(.+)$`)
+	reMusllinux       = regexp.MustCompile(`^musllinux_([0-9]+)_([0-9]+)_(.+)$`)
+	reLegacyManylinux = regexp.MustCompile(`^(manylinux1|manylinux2010|manylinux2014)_(.+)$`)
+
+	//nolint:gochecknoglobals // Would be 'const'.
+	legacyManylinux = map[string]int{ // legacy name => glibc 2.x minor version
+		"manylinux1":    5,
+		"manylinux2010": 12,
+		"manylinux2014": 17,
+	}
+)
+
+// PlatformTags returns the list of platform tags that a system with the given platform tag
+// supports, most-preferred first; the same as `packaging.tags` does for the running system:
+//
+//  - "manylinux_2_X_ARCH" (PEP 600) expands to every manylinux tag for glibc 2.X and older,
+//    including the legacy "manylinux2014", "manylinux2010", and "manylinux1" aliases.
+//  - The legacy "manylinux2014_ARCH", "manylinux2010_ARCH", and "manylinux1_ARCH" tags are
+//    treated as their PEP 600 equivalents.
+//  - "musllinux_1_X_ARCH" (PEP 656) expands to every musllinux tag for musl 1.X and older.
+//
+// Any other platform tag (such as "linux_x86_64" or "win_amd64") is returned as-is.  In
+// particular, "macosx_*" tags are not expanded to older macOS versions.
+func PlatformTags(platform string) []string {
+	if match := reLegacyManylinux.FindStringSubmatch(platform); match != nil {
+		platform = fmt.Sprintf("manylinux_2_%d_%s", legacyManylinux[match[1]], match[2])
+	}
+	if match := reManylinux.FindStringSubmatch(platform); match != nil && match[1] == "2" {
+		glibcMinor, err := strconv.Atoi(match[2])
+		if err != nil {
+			return []string{platform}
+		}
+		arch := match[3]
+		// manylinux1 and manylinux2010 only exist for x86; other architectures start at
+		// manylinux2014.
+		minMinor := legacyManylinux["manylinux2014"]
+		if arch == "x86_64" || arch == "i686" {
+			minMinor = legacyManylinux["manylinux1"]
+		}
+		var ret []string
+		for m := glibcMinor; m >= minMinor; m-- {
+			ret = append(ret, fmt.Sprintf("manylinux_2_%d_%s", m, arch))
+			for legacy, legacyMinor := range legacyManylinux {
+				if legacyMinor == m {
+					ret = append(ret, legacy+"_"+arch)
+				}
+			}
+		}
+		if len(ret) == 0 {
+			return []string{platform}
+		}
+		return ret
+	}
+	if match := reMusllinux.FindStringSubmatch(platform); match != nil && match[1] == "1" {
+		muslMinor, err := strconv.Atoi(match[2])
+		if err != nil {
+			return []string{platform}
+		}
+		var ret []string
+		for m := muslMinor; m >= 0; m-- {
+			ret = append(ret, fmt.Sprintf("musllinux_1_%d_%s", m, match[3]))
+		}
+		return ret
+	}
+	return []string{platform}
+}
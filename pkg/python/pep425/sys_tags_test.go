@@ -0,0 +1,86 @@
+package pep425_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/python/pep425"
+)
+
+func TestPlatformTags(t *testing.T) {
+	t.Parallel()
+	testcases := map[string][]string{
+		"linux_x86_64": {"linux_x86_64"},
+		"win_amd64":    {"win_amd64"},
+		"manylinux2010_x86_64": {
+			"manylinux_2_12_x86_64", "manylinux2010_x86_64",
+			"manylinux_2_11_x86_64", "manylinux_2_10_x86_64", "manylinux_2_9_x86_64",
+			"manylinux_2_8_x86_64", "manylinux_2_7_x86_64", "manylinux_2_6_x86_64",
+			"manylinux_2_5_x86_64", "manylinux1_x86_64",
+		},
+		"manylinux_2_19_aarch64": {
+			"manylinux_2_19_aarch64", "manylinux_2_18_aarch64",
+			"manylinux_2_17_aarch64", "manylinux2014_aarch64",
+		},
+		"manylinux_2_5_aarch64": {"manylinux_2_5_aarch64"},
+		"musllinux_1_1_x86_64":  {"musllinux_1_1_x86_64", "musllinux_1_0_x86_64"},
+	}
+	for in, exp := range testcases {
+		in, exp := in, exp
+		t.Run(in, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, exp, pep425.PlatformTags(in))
+		})
+	}
+}
+
+func TestCPythonInstaller(t *testing.T) {
+	t.Parallel()
+	strs := func(inst pep425.Installer) []string {
+		ret := make([]string, 0, len(inst))
+		for _, tag := range inst {
+			ret = append(ret, tag.String())
+		}
+		return ret
+	}
+
+	// The same as packaging.tags.sys_tags() on CPython 3.9 on musl 1.1.
+	assert.Equal(t, []string{
+		"cp39-cp39-musllinux_1_1_x86_64", "cp39-cp39-musllinux_1_0_x86_64",
+		"cp39-abi3-musllinux_1_1_x86_64", "cp39-abi3-musllinux_1_0_x86_64",
+		"cp39-none-musllinux_1_1_x86_64", "cp39-none-musllinux_1_0_x86_64",
+		"cp38-abi3-musllinux_1_1_x86_64", "cp38-abi3-musllinux_1_0_x86_64",
+		"cp37-abi3-musllinux_1_1_x86_64", "cp37-abi3-musllinux_1_0_x86_64",
+		"cp36-abi3-musllinux_1_1_x86_64", "cp36-abi3-musllinux_1_0_x86_64",
+		"cp35-abi3-musllinux_1_1_x86_64", "cp35-abi3-musllinux_1_0_x86_64",
+		"cp34-abi3-musllinux_1_1_x86_64", "cp34-abi3-musllinux_1_0_x86_64",
+		"cp33-abi3-musllinux_1_1_x86_64", "cp33-abi3-musllinux_1_0_x86_64",
+		"cp32-abi3-musllinux_1_1_x86_64", "cp32-abi3-musllinux_1_0_x86_64",
+		"py39-none-musllinux_1_1_x86_64", "py39-none-musllinux_1_0_x86_64",
+		"py3-none-musllinux_1_1_x86_64", "py3-none-musllinux_1_0_x86_64",
+		"py38-none-musllinux_1_1_x86_64", "py38-none-musllinux_1_0_x86_64",
+		"py37-none-musllinux_1_1_x86_64", "py37-none-musllinux_1_0_x86_64",
+		"py36-none-musllinux_1_1_x86_64", "py36-none-musllinux_1_0_x86_64",
+		"py35-none-musllinux_1_1_x86_64", "py35-none-musllinux_1_0_x86_64",
+		"py34-none-musllinux_1_1_x86_64", "py34-none-musllinux_1_0_x86_64",
+		"py33-none-musllinux_1_1_x86_64", "py33-none-musllinux_1_0_x86_64",
+		"py32-none-musllinux_1_1_x86_64", "py32-none-musllinux_1_0_x86_64",
+		"py31-none-musllinux_1_1_x86_64", "py31-none-musllinux_1_0_x86_64",
+		"py30-none-musllinux_1_1_x86_64", "py30-none-musllinux_1_0_x86_64",
+		"cp39-none-any",
+		"py39-none-any", "py3-none-any", "py38-none-any", "py37-none-any", "py36-none-any",
+		"py35-none-any", "py34-none-any", "py33-none-any", "py32-none-any", "py31-none-any",
+		"py30-none-any",
+	}, strs(pep425.CPythonInstaller(3, 9, nil, []string{"musllinux_1_1_x86_64"})))
+
+	// Older versions have a different default ABI, and explicit ABIs are used as given.
+	assert.Equal(t, "cp37-cp37m-win_amd64", strs(pep425.CPythonInstaller(3, 7, nil, []string{"win_amd64"}))[0])
+	inst := pep425.CPythonInstaller(3, 11, []string{"cp311d", "abi3"}, []string{"linux_x86_64"})
+	assert.Equal(t, []string{"cp311-cp311d-linux_x86_64", "cp311-abi3-linux_x86_64"}, strs(inst)[:2])
+
+	inst = pep425.CPythonInstaller(3, 11, nil, []string{"manylinux2014_x86_64"})
+	assert.Len(t, inst, 414)
+	assert.True(t, inst.Supports(pep425.Tag{Python: "cp36", ABI: "abi3", Platform: "manylinux1_x86_64"}))
+	assert.False(t, inst.Supports(pep425.Tag{Python: "cp311", ABI: "cp311", Platform: "manylinux_2_28_x86_64"}))
+}
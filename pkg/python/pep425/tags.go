@@ -26,11 +26,21 @@ func (t Tag) Decompress() []Tag {
 	return ret
 }
 
+// ParseTag parses a tag string (such as "py3-none-any"), which may be a compressed tag set (such as
+// "py2.py3-none-any").  The returned Tag is not decompressed; use .Decompress() or ParseTagSet() for
+// that.
 func ParseTag(str string) (Tag, error) {
 	parts := strings.Split(str, "-")
 	if len(parts) != 3 {
 		return Tag{}, fmt.Errorf("pep425.ParseTag: invalid tag: %q", str)
 	}
+	for _, part := range parts {
+		for _, item := range strings.Split(part, ".") {
+			if item == "" || strings.TrimSpace(item) != item {
+				return Tag{}, fmt.Errorf("pep425.ParseTag: invalid tag: %q", str)
+			}
+		}
+	}
 	return Tag{
 		Python:   parts[0],
 		ABI:      parts[1],
@@ -38,6 +48,53 @@ func ParseTag(str string) (Tag, error) {
 	}, nil
 }
 
+// ParseTagSet parses a compressed tag set (such as "py2.py3-none-any", as used in wheel filenames)
+// and returns the expanded list of tags that it represents (such as "py2-none-any" and
+// "py3-none-any", as used in WHEEL "Tag:" lines).
+func ParseTagSet(str string) ([]Tag, error) {
+	tag, err := ParseTag(str)
+	if err != nil {
+		return nil, fmt.Errorf("pep425.ParseTagSet: %w", err)
+	}
+	return Expand([]Tag{tag}), nil
+}
+
+// Expand returns the decompressed form of a list of tags, with any duplicates removed.  The order
+// of the tags is otherwise preserved.
+func Expand(tags []Tag) []Tag {
+	var ret []Tag
+	seen := make(map[Tag]struct{})
+	for _, compressed := range tags {
+		for _, tag := range compressed.Decompress() {
+			if _, dup := seen[tag]; dup {
+				continue
+			}
+			seen[tag] = struct{}{}
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
+// Equal returns whether tag-lists 'a' and 'b' represent the same set of tags; considering
+// compressed tag sets, but ignoring order and duplicates.
+func Equal(a, b []Tag) bool {
+	aSet := make(map[Tag]struct{})
+	for _, tag := range Expand(a) {
+		aSet[tag] = struct{}{}
+	}
+	bTags := Expand(b)
+	if len(bTags) != len(aSet) {
+		return false
+	}
+	for _, tag := range bTags {
+		if _, ok := aSet[tag]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func (t Tag) String() string {
 	return t.Python + "-" + t.ABI + "-" + t.Platform
 }
@@ -0,0 +1,78 @@
+package pep425_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/python/pep425"
+)
+
+func TestParseTagSet(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		In     string
+		Out    []string
+		OutErr string
+	}
+	testcases := map[string]TestCase{
+		"simple":     {"py3-none-any", []string{"py3-none-any"}, ""},
+		"compressed": {"py2.py3-none-any", []string{"py2-none-any", "py3-none-any"}, ""},
+		"multi": {
+			"cp39-cp39-manylinux_2_17_x86_64.manylinux2014_x86_64",
+			[]string{"cp39-cp39-manylinux_2_17_x86_64", "cp39-cp39-manylinux2014_x86_64"},
+			"",
+		},
+		"cross": {
+			"py2.py3-none.abi3-any",
+			[]string{"py2-none-any", "py2-abi3-any", "py3-none-any", "py3-abi3-any"},
+			"",
+		},
+		"dups":        {"py3.py3-none-any", []string{"py3-none-any"}, ""},
+		"too-few":     {"py3-none", nil, `pep425.ParseTagSet: pep425.ParseTag: invalid tag: "py3-none"`},
+		"too-many":    {"py3-none-any-x", nil, `pep425.ParseTagSet: pep425.ParseTag: invalid tag: "py3-none-any-x"`},
+		"empty-part":  {"py3--any", nil, `pep425.ParseTagSet: pep425.ParseTag: invalid tag: "py3--any"`},
+		"empty-item":  {"py2.-none-any", nil, `pep425.ParseTagSet: pep425.ParseTag: invalid tag: "py2.-none-any"`},
+		"whitespace":  {"py3-none-any ", nil, `pep425.ParseTagSet: pep425.ParseTag: invalid tag: "py3-none-any "`},
+		"empty-input": {"", nil, `pep425.ParseTagSet: pep425.ParseTag: invalid tag: ""`},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			tags, err := pep425.ParseTagSet(tc.In)
+			if tc.OutErr != "" {
+				assert.EqualError(t, err, tc.OutErr)
+				assert.Nil(t, tags)
+				return
+			}
+			assert.NoError(t, err)
+			strs := make([]string, 0, len(tags))
+			for _, tag := range tags {
+				strs = append(strs, tag.String())
+			}
+			assert.Equal(t, tc.Out, strs)
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	t.Parallel()
+	parse := func(strs ...string) []pep425.Tag {
+		ret := make([]pep425.Tag, 0, len(strs))
+		for _, str := range strs {
+			tag, err := pep425.ParseTag(str)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ret = append(ret, tag)
+		}
+		return ret
+	}
+	assert.True(t, pep425.Equal(parse("py2.py3-none-any"), parse("py3-none-any", "py2-none-any")))
+	assert.True(t, pep425.Equal(parse("py2.py3-none-any"), parse("py2-none-any", "py3-none-any", "py3-none-any")))
+	assert.False(t, pep425.Equal(parse("py2.py3-none-any"), parse("py3-none-any")))
+	assert.False(t, pep425.Equal(parse("py3-none-any"), parse("py2.py3-none-any")))
+	assert.False(t, pep425.Equal(parse("py3-none-any"), parse("cp39-cp39-linux_x86_64")))
+	assert.True(t, pep425.Equal(nil, nil))
+}
@@ -2,6 +2,7 @@ package pep440
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -99,12 +100,11 @@ func (ver PublicVersion) writeTo(ret *strings.Builder) {
 	if ver.Epoch > 0 {
 		fmt.Fprintf(ret, "%d!", ver.Epoch)
 	}
-	if len(ver.Release) == 0 {
-		panic("invalid version: no release segments")
-	}
-	fmt.Fprintf(ret, "%d", ver.Release[0])
-	for _, segment := range ver.Release[1:] {
-		fmt.Fprintf(ret, ".%d", segment)
+	// An empty release segment isn't valid (see Validate), but it compares equal to "0", so
+	// that's how it is written.
+	fmt.Fprintf(ret, "%d", ver.releaseSegment(0))
+	for i := 1; i < len(ver.Release); i++ {
+		fmt.Fprintf(ret, ".%d", ver.Release[i])
 	}
 	if ver.Pre != nil {
 		fmt.Fprintf(ret, "%s%d", ver.Pre.L, ver.Pre.N)
@@ -124,6 +124,47 @@ func (ver PublicVersion) String() string {
 	return ret.String()
 }
 
+// Validate returns an error if ver is not a valid version: if it has no release segment, if any of
+// its numeric components are negative, or if its pre-release phase is not one of the spellings
+// that ParseVersion accepts.  Versions returned by ParseVersion are always valid; Validate is for
+// versions that were constructed or decoded some other way.  Invalid versions don't cause any
+// method to panic, but they may not compare or match in a meaningful way.
+func (ver PublicVersion) Validate() error {
+	if err := ver.validate(); err != nil {
+		return fmt.Errorf("pep440.PublicVersion.Validate: %w", err)
+	}
+	return nil
+}
+
+func (ver PublicVersion) validate() error {
+	if ver.Epoch < 0 {
+		return fmt.Errorf("negative epoch: %d", ver.Epoch)
+	}
+	if len(ver.Release) == 0 {
+		return fmt.Errorf("no release segments")
+	}
+	for _, seg := range ver.Release {
+		if seg < 0 {
+			return fmt.Errorf("negative release segment: %d", seg)
+		}
+	}
+	if ver.Pre != nil {
+		if _, ok := preReleaseOrder[ver.Pre.L]; !ok {
+			return fmt.Errorf("invalid pre-release phase: %q", ver.Pre.L)
+		}
+		if ver.Pre.N < 0 {
+			return fmt.Errorf("negative pre-release number: %d", ver.Pre.N)
+		}
+	}
+	if ver.Post != nil && *ver.Post < 0 {
+		return fmt.Errorf("negative post-release number: %d", *ver.Post)
+	}
+	if ver.Dev != nil && *ver.Dev < 0 {
+		return fmt.Errorf("negative dev-release number: %d", *ver.Dev)
+	}
+	return nil
+}
+
 //
 // Any given release will be a "final release", "pre-release", "post-release" or
 // "developmental release" as defined in the following sections.
@@ -211,6 +252,39 @@ func (ver LocalVersion) String() string {
 	return ret.String()
 }
 
+// Validate returns an error if ver is not a valid version; see PublicVersion.Validate.  Each
+// segment of the local version label must be a non-negative integer or a non-empty string of
+// ASCII letters and digits.
+func (ver LocalVersion) Validate() error {
+	if err := ver.validate(); err != nil {
+		return fmt.Errorf("pep440.LocalVersion.Validate: %w", err)
+	}
+	return nil
+}
+
+func (ver LocalVersion) validate() error {
+	if err := ver.PublicVersion.validate(); err != nil {
+		return err
+	}
+	for _, seg := range ver.Local {
+		switch seg.Type {
+		case intstr.Int:
+			if seg.IntVal < 0 {
+				return fmt.Errorf("negative local segment: %d", seg.IntVal)
+			}
+		case intstr.String:
+			if !reLocalSegment.MatchString(seg.StrVal) {
+				return fmt.Errorf("invalid local segment: %q", seg.StrVal)
+			}
+		default:
+			return fmt.Errorf("invalid local segment type: %d", seg.Type)
+		}
+	}
+	return nil
+}
+
+var reLocalSegment = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
 // Comparison and ordering of local versions considers each segment of the local
 // version (divided by a ``.``) separately. If a segment consists entirely of
 // ASCII digits then that section should be considered an integer for comparison
@@ -222,20 +296,35 @@ func (ver LocalVersion) String() string {
 // segments, as long as the shorter local version's segments match the beginning
 // of the longer local version's segments exactly.
 
+// cmpInt returns -1, 0, or 1; without doing arithmetic that might overflow.
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
 func cmpLocalSegment(a, b *intstr.IntOrString) int {
 	// handle one or both of them being nil
 	switch {
 	case a == nil && b == nil:
-		panic("should not happen: cmpLocal shouldn't have bothered calling this")
+		return 0
 	case a == nil && b != nil:
 		return -1
 	case a != nil && b == nil:
 		return 1
 	}
+	// Anything that isn't an Int is treated as a String, so that an invalid Type still gives a
+	// consistent ordering.
+	aIsInt, bIsInt := a.Type == intstr.Int, b.Type == intstr.Int
 	switch {
-	case a.Type == intstr.Int && b.Type == intstr.Int:
-		return int(a.IntVal - b.IntVal)
-	case a.Type == intstr.String && b.Type == intstr.String:
+	case aIsInt && bIsInt:
+		return cmpInt(int(a.IntVal), int(b.IntVal))
+	case !aIsInt && !bIsInt:
 		switch {
 		case a.StrVal < b.StrVal:
 			return -1
@@ -243,12 +332,10 @@ func cmpLocalSegment(a, b *intstr.IntOrString) int {
 			return 1
 		}
 		return 0
-	case a.Type == intstr.Int && b.Type == intstr.String:
+	case aIsInt:
 		return 1
-	case a.Type == intstr.String && b.Type == intstr.Int:
-		return -1
 	default:
-		panic("should not happen: invalid intstr.IntOrString")
+		return -1
 	}
 }
 
@@ -268,10 +355,8 @@ func cmpLocal(a, b LocalVersion) int {
 	return 0
 }
 
-// Cmp returns a number < 0 if version 'a' is less than version 'b', > 0 if 'a' is greater than 'b',
-// or 0 if they are equal.  This is similar to the C-language strcmp.  You may think of this as
-// returning the result of arithmetic subtraction "a-b"; though only the sign is defined; the
-// magnitude may be anything.
+// Cmp returns -1 if version 'a' is less than version 'b', 1 if 'a' is greater than 'b', or 0 if
+// they are equal.  This is similar to the C-language strcmp.
 func (a LocalVersion) Cmp(b LocalVersion) int {
 	if d := a.PublicVersion.Cmp(b.PublicVersion); d != 0 {
 		return d
@@ -337,8 +422,8 @@ func (ver PublicVersion) releaseSegment(n int) int {
 
 func cmpRelease(a, b PublicVersion) int {
 	for i := 0; i < len(a.Release) || i < len(b.Release); i++ {
-		if diff := a.releaseSegment(i) - b.releaseSegment(i); diff != 0 {
-			return diff
+		if d := cmpInt(a.releaseSegment(i), b.releaseSegment(i)); d != 0 {
+			return d
 		}
 	}
 	return 0
@@ -353,6 +438,57 @@ func (ver PublicVersion) Major() int { return ver.releaseSegment(0) }
 func (ver PublicVersion) Minor() int { return ver.releaseSegment(1) }
 func (ver PublicVersion) Micro() int { return ver.releaseSegment(2) }
 
+// NextMajor returns the first final release of the next "major" release series after ver.  For
+// example, the next major after "1.4.5" is "2.0.0".  See NextRelease.
+func (ver PublicVersion) NextMajor() PublicVersion { return ver.NextRelease(0) }
+
+// NextMinor returns the first final release of the next "minor" release series after ver.  For
+// example, the next minor after "1.4.5" is "1.5.0".  See NextRelease.
+func (ver PublicVersion) NextMinor() PublicVersion { return ver.NextRelease(1) }
+
+// NextMicro returns the next "micro" final release after ver.  For example, the next micro after
+// "1.4.5" is "1.4.6".  See NextRelease.
+func (ver PublicVersion) NextMicro() PublicVersion { return ver.NextRelease(2) }
+
+// NextRelease returns the lowest final release greater than ver that differs from ver in the nth
+// (0-indexed) component of the release segment; all of the following components are zero.  The
+// epoch is preserved, and the returned version has at least as many release components as ver
+// (padding with zeros as necessary).
+//
+// Pre-releases and developmental releases sort before their final release, so if ver is a pre-,
+// or dev-release of a version in which all components after the nth are already zero, then the
+// final release of it is returned: the next major after "2.0rc1" is "2.0", not "3.0".
+func (ver PublicVersion) NextRelease(n int) PublicVersion {
+	if n < 0 {
+		panic(fmt.Errorf("pep440.PublicVersion.NextRelease: negative segment index: %d", n))
+	}
+	size := len(ver.Release)
+	if size < n+1 {
+		size = n + 1
+	}
+	ret := PublicVersion{
+		Epoch:   ver.Epoch,
+		Release: make([]int, size),
+	}
+	copy(ret.Release, ver.Release)
+
+	isBeforeRelease := ver.Pre != nil || (ver.Dev != nil && ver.Post == nil)
+	restIsZero := true
+	for _, seg := range ret.Release[n+1:] {
+		if seg != 0 {
+			restIsZero = false
+		}
+	}
+	if !(isBeforeRelease && restIsZero) {
+		ret.Release[n]++
+		for i := n + 1; i < len(ret.Release); i++ {
+			ret.Release[i] = 0
+		}
+	}
+
+	return ret
+}
+
 //
 // For example::
 //
@@ -440,13 +576,18 @@ var preReleaseOrder = map[string]int{
 	// absent: 0,
 }
 
+// preReleaseInvalid is the order of pre-release phases that aren't in preReleaseOrder (which
+// Validate rejects); they sort before everything else, and by their spelling among themselves.
+const preReleaseInvalid = -5
+
 func cmpPreRelease(a, b PublicVersion) int {
 	var aL, aN, bL, bN int
+	var aStr, bStr string
 	var ok bool
 	if a.Pre != nil {
 		aL, ok = preReleaseOrder[a.Pre.L]
 		if !ok {
-			panic(fmt.Errorf("invalid pre-release string: %q", a.Pre.L))
+			aL, aStr = preReleaseInvalid, a.Pre.L
 		}
 		aN = a.Pre.N
 	} else if a.Dev != nil && a.Post == nil {
@@ -455,16 +596,19 @@ func cmpPreRelease(a, b PublicVersion) int {
 	if b.Pre != nil {
 		bL, ok = preReleaseOrder[b.Pre.L]
 		if !ok {
-			panic(fmt.Errorf("invalid pre-release string: %q", b.Pre.L))
+			bL, bStr = preReleaseInvalid, b.Pre.L
 		}
 		bN = b.Pre.N
 	} else if b.Dev != nil && b.Post == nil {
 		bL = -4
 	}
 	if aL != bL {
-		return aL - bL
+		return cmpInt(aL, bL)
+	}
+	if aStr != bStr {
+		return strings.Compare(aStr, bStr)
 	}
-	return aN - bN
+	return cmpInt(aN, bN)
 }
 
 // Post-releases
@@ -516,7 +660,7 @@ func cmpPostRelease(a, b PublicVersion) int {
 	if b.Post != nil {
 		bPost = *b.Post
 	}
-	return aPost - bPost
+	return cmpInt(aPost, bPost)
 }
 
 //
@@ -580,7 +724,7 @@ func cmpDevRelease(a, b PublicVersion) int {
 	case a.Dev != nil && b.Dev == nil:
 		return -1
 	default:
-		return (*a.Dev) - (*b.Dev)
+		return cmpInt(*a.Dev, *b.Dev)
 	}
 }
 
@@ -619,7 +763,7 @@ func cmpDevRelease(a, b PublicVersion) int {
 //     1!2.0
 
 func cmpEpoch(a, b PublicVersion) int {
-	return a.Epoch - b.Epoch
+	return cmpInt(a.Epoch, b.Epoch)
 }
 
 //
@@ -863,10 +1007,8 @@ func (ver LocalVersion) Normalize() (*LocalVersion, error) {
 //    of Python distributions deciding on a versioning scheme.
 //
 
-// Cmp returns a number < 0 if version 'a' is less than version 'b', > 0 if 'a' is greater than 'b',
-// or 0 if they are equal.  This is similar to the C-language strcmp.  You may think of this as
-// returning the result of arithmetic subtraction "a-b"; though only the sign is defined; the
-// magnitude may be anything.
+// Cmp returns -1 if version 'a' is less than version 'b', 1 if 'a' is greater than 'b', or 0 if
+// they are equal.  This is similar to the C-language strcmp.
 func (a PublicVersion) Cmp(b PublicVersion) int {
 	// The epoch segment of version identifiers MUST be sorted according to the
 	// numeric value of the given epoch. If no epoch segment is present, the
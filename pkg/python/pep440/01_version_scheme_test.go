@@ -1,6 +1,7 @@
 package pep440_test
 
 import (
+	"math"
 	"math/rand"
 	"sort"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/datawire/ocibuild/pkg/python/pep440"
 	"github.com/datawire/ocibuild/pkg/testutil"
@@ -163,13 +165,13 @@ func TestSort(t *testing.T) {
 			rand := rand.New(rand.NewSource(time.Now().UnixNano()))
 
 			// Parse the slice of strings in to a slice of parsed Version objects.
-			vers := make([]*pep440.Version, 0, len(strs))
+			vers := make([]pep440.Version, 0, len(strs))
 			exps := make([]string, 0, len(strs))
 			for _, str := range strs {
 				ver, err := pep440.ParseVersion(str)
 				require.NoError(t, err)
 				require.NotNil(t, ver)
-				vers = append(vers, ver)
+				vers = append(vers, *ver)
 				exps = append(exps, ver.String())
 			}
 
@@ -179,9 +181,7 @@ func TestSort(t *testing.T) {
 			})
 
 			// Sort the list.
-			sort.Slice(vers, func(i, j int) bool {
-				return vers[i].Cmp(*vers[j]) < 1
-			})
+			pep440.Sort(vers)
 
 			// Check that the ordering of the sorted list matches the original input
 			// list.
@@ -405,3 +405,89 @@ func TestUtilMethods(t *testing.T) {
 		})
 	}
 }
+
+func TestNextRelease(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		In        string
+		NextMajor string
+		NextMinor string
+		NextMicro string
+	}
+	testcases := []TestCase{
+		{"1", "2", "1.1", "1.0.1"},
+		{"1.4", "2.0", "1.5", "1.4.1"},
+		{"1.4.5", "2.0.0", "1.5.0", "1.4.6"},
+		{"1.4.5.7", "2.0.0.0", "1.5.0.0", "1.4.6.0"},
+		{"1!1.4.5", "1!2.0.0", "1!1.5.0", "1!1.4.6"},
+		{"1.4.5+local", "2.0.0", "1.5.0", "1.4.6"},
+		{"1.4.5.post1", "2.0.0", "1.5.0", "1.4.6"},
+		{"1.4.5.post1.dev3", "2.0.0", "1.5.0", "1.4.6"},
+		{"2.0rc1", "2.0", "2.0", "2.0.0"},
+		{"2.0.0.dev3", "2.0.0", "2.0.0", "2.0.0"},
+		{"2.1rc1", "3.0", "2.1", "2.1.0"},
+		{"2.1.1a1", "3.0.0", "2.2.0", "2.1.1"},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.In, func(t *testing.T) {
+			t.Parallel()
+			ver := mustParseVersion(t, tc.In)
+			assert.Equal(t, tc.NextMajor, ver.NextMajor().String())
+			assert.Equal(t, tc.NextMinor, ver.NextMinor().String())
+			assert.Equal(t, tc.NextMicro, ver.NextMicro().String())
+		})
+	}
+}
+
+func TestCmpOverflow(t *testing.T) {
+	t.Parallel()
+	const maxInt = int(^uint(0) >> 1)
+	const minInt = -maxInt - 1
+	big := pep440.Version{PublicVersion: pep440.PublicVersion{Epoch: maxInt, Release: []int{maxInt}}}
+	small := pep440.Version{PublicVersion: pep440.PublicVersion{Epoch: minInt, Release: []int{minInt}}}
+	assert.Equal(t, 1, big.Cmp(small))
+	assert.Equal(t, -1, small.Cmp(big))
+	assert.Equal(t, 0, big.Cmp(big))
+
+	big.Epoch, small.Epoch = 0, 0
+	assert.Equal(t, 1, big.Cmp(small))
+	assert.Equal(t, -1, small.Cmp(big))
+
+	big.Release, small.Release = []int{1}, []int{1}
+	big.Post, small.Post = intPtr(maxInt), intPtr(-2)
+	assert.Equal(t, 1, big.Cmp(small))
+	assert.Equal(t, -1, small.Cmp(big))
+
+	big.Post, small.Post = nil, nil
+	big.Dev, small.Dev = intPtr(maxInt), intPtr(minInt)
+	assert.Equal(t, 1, big.Cmp(small))
+	assert.Equal(t, -1, small.Cmp(big))
+
+	big.Dev, small.Dev = nil, nil
+	big.Local = []intstr.IntOrString{intstr.FromInt(math.MaxInt32)}
+	small.Local = []intstr.IntOrString{intstr.FromInt(math.MinInt32)}
+	assert.Equal(t, 1, big.Cmp(small))
+	assert.Equal(t, -1, small.Cmp(big))
+}
+
+func TestSortVersions(t *testing.T) {
+	t.Parallel()
+	strs := []string{"2.0", "1.0.0", "1.0a1", "1.0", "1!0.1", "1.0.post1"}
+	vers := make([]pep440.Version, 0, len(strs))
+	for _, str := range strs {
+		vers = append(vers, mustParseVersion(t, str))
+	}
+
+	stable := append([]pep440.Version(nil), vers...)
+	pep440.Sort(stable)
+	acts := make([]string, 0, len(stable))
+	for _, ver := range stable {
+		acts = append(acts, ver.String())
+	}
+	assert.Equal(t, []string{"1.0a1", "1.0.0", "1.0", "1.0.post1", "2.0", "1!0.1"}, acts)
+
+	sort.Sort(sort.Reverse(pep440.Versions(vers)))
+	assert.Equal(t, "1!0.1", vers[0].String())
+	assert.Equal(t, "1.0a1", vers[len(vers)-1].String())
+}
@@ -67,6 +67,17 @@ func (spec Specifier) String() string {
 	return strings.Join(clauses, ",")
 }
 
+// Validate returns an error if any of the clauses in spec are invalid; see
+// SpecifierClause.Validate.
+func (spec Specifier) Validate() error {
+	for _, clause := range spec {
+		if err := clause.validate(); err != nil {
+			return fmt.Errorf("pep440.Specifier.Validate: %w", err)
+		}
+	}
+	return nil
+}
+
 func (spec Specifier) Match(ver Version) bool {
 	for _, clause := range spec {
 		if !clause.Match(ver) {
@@ -105,7 +116,7 @@ func (op CmpOp) String() string {
 		CmpOpGT:            ">",
 	}[op]
 	if !ok {
-		panic(fmt.Errorf("invalid CmpOp: %d", op))
+		return fmt.Sprintf("CmpOp(%d)", op)
 	}
 	return str
 }
@@ -123,7 +134,8 @@ func (op CmpOp) match(spec, ver Version) bool {
 		CmpOpGT:            matchGT,
 	}[op]
 	if !ok {
-		panic(fmt.Errorf("invalid CmpOp: %d", op))
+		// An invalid CmpOp (see SpecifierClause.Validate) matches nothing.
+		return false
 	}
 	return fn(spec, ver)
 }
@@ -172,10 +184,10 @@ func parseSpecifierClause(str string) (SpecifierClause, error) {
 		str = str[2:]
 	case strings.HasPrefix(str, "<"):
 		ret.CmpOp = CmpOpLT
-		str = str[2:]
+		str = str[1:]
 	case strings.HasPrefix(str, ">"):
 		ret.CmpOp = CmpOpGT
-		str = str[2:]
+		str = str[1:]
 	case strings.HasPrefix(str, "==="):
 		return ret, fmt.Errorf("specifiers with === are not supported; versions must be PEP 440 compliant")
 	default:
@@ -212,9 +224,33 @@ func (spec SpecifierClause) String() string {
 		CmpOpGT:            ">",
 	}[spec.CmpOp]
 	if !ok {
-		panic(fmt.Errorf("invalid CmpOp: %d", spec.CmpOp))
+		opStr = spec.CmpOp.String()
 	}
-	return opStr + spec.Version.String()
+	ret := opStr + spec.Version.String()
+	if spec.CmpOp == CmpOpPrefixMatch || spec.CmpOp == CmpOpPrefixExclude {
+		ret += ".*"
+	}
+	return ret
+}
+
+// Validate returns an error if spec is not a valid specifier clause: if its CmpOp is not one of
+// the defined operators, or if its Version is not valid (see LocalVersion.Validate).  Clauses
+// returned by ParseSpecifier are always valid.
+func (spec SpecifierClause) Validate() error {
+	if err := spec.validate(); err != nil {
+		return fmt.Errorf("pep440.SpecifierClause.Validate: %w", err)
+	}
+	return nil
+}
+
+func (spec SpecifierClause) validate() error {
+	if spec.CmpOp < 0 || spec.CmpOp >= _CmpOpEnd {
+		return fmt.Errorf("invalid CmpOp: %d", spec.CmpOp)
+	}
+	if err := spec.Version.validate(); err != nil {
+		return fmt.Errorf("%q: %w", spec, err)
+	}
+	return nil
 }
 
 func (spec SpecifierClause) Match(ver Version) bool {
@@ -621,31 +657,17 @@ func (m MultiExcluder) Allow(ver Version) bool {
 	return true
 }
 
+// Select returns the greatest of the choices that matches spec, preferring versions that
+// exclusionBehavior allows; if it allows none of them, then the greatest excluded match is
+// returned instead.  It returns nil if none of the choices match.  See SelectAll for the full
+// ranking.
 func (spec Specifier) Select(choices []Version, exclusionBehavior ExclusionBehavior) *Version {
-	var best *Version
-	var bestExcluded *Version
-	for _, choice := range choices {
-		if spec.Match(choice) {
-			if exclusionBehavior == nil || !exclusionBehavior.Allow(choice) {
-				if best == nil || best.Cmp(choice) < 0 {
-					val := choice
-					best = &val
-				}
-			} else {
-				if bestExcluded == nil || bestExcluded.Cmp(choice) < 0 {
-					val := choice
-					bestExcluded = &val
-				}
-			}
-		}
-	}
-	if best != nil {
-		return best
+	candidates := spec.SelectAll(choices, exclusionBehavior)
+	if len(candidates) == 0 || !candidates[0].Selectable() {
+		return nil
 	}
-	if bestExcluded != nil {
-		return bestExcluded
-	}
-	return nil
+	best := candidates[0].Version
+	return &best
 }
 
 //
@@ -26,6 +26,8 @@ func TestParseSpecifier(t *testing.T) {
 		"emptycommas": {", ,", pep440.Specifier{}, ""},
 		"eq":          {"==1.0", pep440.Specifier{{pep440.CmpOpStrictMatch, mustParseVersion(t, "1.0")}}, ""},
 		"missing-op":  {"1.0", nil, `pep440.ParseSpecifier: invalid comparison operator: "1.0"`},
+		"lt-nospace":  {"<1.0", pep440.Specifier{{pep440.CmpOpLT, mustParseVersion(t, "1.0")}}, ""},
+		"gt-nospace":  {">1.0", pep440.Specifier{{pep440.CmpOpGT, mustParseVersion(t, "1.0")}}, ""},
 		"1seg-ok":     {"==1", pep440.Specifier{{pep440.CmpOpStrictMatch, mustParseVersion(t, "1")}}, ""},
 		"1seg-bad":    {"~=1", nil, `pep440.ParseSpecifier: at least 2 release segments required in ~= specifier clauses`},
 		"bad-dev":     {"==1.0dev.*", nil, `pep440.ParseSpecifier: dev-part not permitted in prefix == specifier clauses`},
@@ -0,0 +1,136 @@
+package pep440
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// This file isn't part of PEP 440; it implements helpers for constructing versions
+// programmatically, such as for release tooling that promotes a release candidate to a final
+// release, or that stamps a build with a local version label.  Each helper returns a modified
+// copy; the receiver is never modified, and the copy shares no memory with it.
+
+func (ver PublicVersion) clone() PublicVersion {
+	ret := PublicVersion{
+		Epoch:   ver.Epoch,
+		Release: append([]int(nil), ver.Release...),
+		Pre:     nil,
+		Post:    nil,
+		Dev:     nil,
+	}
+	if ver.Pre != nil {
+		pre := *ver.Pre
+		ret.Pre = &pre
+	}
+	if ver.Post != nil {
+		post := *ver.Post
+		ret.Post = &post
+	}
+	if ver.Dev != nil {
+		dev := *ver.Dev
+		ret.Dev = &dev
+	}
+	return ret
+}
+
+func (ver LocalVersion) clone() LocalVersion {
+	return LocalVersion{
+		PublicVersion: ver.PublicVersion.clone(),
+		Local:         append([]intstr.IntOrString(nil), ver.Local...),
+	}
+}
+
+// preReleaseAliases maps the alternative spellings of pre-release phases to their normal form;
+// see the "Pre-release spelling" section.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var preReleaseAliases = map[string]string{
+	"alpha":   "a",
+	"beta":    "b",
+	"c":       "rc",
+	"pre":     "rc",
+	"preview": "rc",
+}
+
+// WithPre returns a copy of ver with the pre-release segment set to phase l, number n; replacing
+// any existing pre-release segment.  The phase is normalized ("alpha" becomes "a", "c" becomes
+// "rc", and so on); an unrecognized phase is kept as-is, and is reported by Validate.
+func (ver PublicVersion) WithPre(l string, n int) PublicVersion {
+	l = strings.ToLower(l)
+	if canonical, ok := preReleaseAliases[l]; ok {
+		l = canonical
+	}
+	ret := ver.clone()
+	ret.Pre = &PreRelease{L: l, N: n}
+	return ret
+}
+
+// WithPost returns a copy of ver with the post-release number set to n.
+func (ver PublicVersion) WithPost(n int) PublicVersion {
+	ret := ver.clone()
+	ret.Post = &n
+	return ret
+}
+
+// WithDev returns a copy of ver with the development release number set to n.
+func (ver PublicVersion) WithDev(n int) PublicVersion {
+	ret := ver.clone()
+	ret.Dev = &n
+	return ret
+}
+
+// Final returns the final release that ver is a pre-, post-, or development release of; that is,
+// a copy of ver with only the epoch and release segments.  This promotes "1.0rc2" to "1.0".
+//
+// When called on a LocalVersion, the local version label is dropped too.
+func (ver PublicVersion) Final() PublicVersion {
+	ret := ver.clone()
+	ret.Pre = nil
+	ret.Post = nil
+	ret.Dev = nil
+	return ret
+}
+
+// WithLocal returns a copy of ver with the local version label set to label (such as
+// "gitabcdef" or "ubuntu-1"), replacing any existing label.  The label is normalized the same way
+// that ParseVersion normalizes it; an empty label removes the local version label.  It is an error
+// if the label contains characters other than ASCII letters, digits, and separators.
+func (ver PublicVersion) WithLocal(label string) (LocalVersion, error) {
+	ret := LocalVersion{
+		PublicVersion: ver.clone(),
+		Local:         nil,
+	}
+	for _, part := range strings.FieldsFunc(label, func(r rune) bool {
+		return strings.ContainsRune("-_.", r)
+	}) {
+		if !reLocalSegment.MatchString(part) {
+			return LocalVersion{}, //nolint:exhaustivestruct // zero value
+				fmt.Errorf("pep440.PublicVersion.WithLocal: invalid local version label: %q", label)
+		}
+		ret.Local = append(ret.Local, intstr.Parse(strings.ToLower(part)))
+	}
+	return ret, nil
+}
+
+// WithPre is like PublicVersion.WithPre, but preserves the local version label.
+func (ver LocalVersion) WithPre(l string, n int) LocalVersion {
+	ret := ver.clone()
+	ret.PublicVersion = ver.PublicVersion.WithPre(l, n)
+	return ret
+}
+
+// WithPost is like PublicVersion.WithPost, but preserves the local version label.
+func (ver LocalVersion) WithPost(n int) LocalVersion {
+	ret := ver.clone()
+	ret.PublicVersion = ver.PublicVersion.WithPost(n)
+	return ret
+}
+
+// WithDev is like PublicVersion.WithDev, but preserves the local version label.
+func (ver LocalVersion) WithDev(n int) LocalVersion {
+	ret := ver.clone()
+	ret.PublicVersion = ver.PublicVersion.WithDev(n)
+	return ret
+}
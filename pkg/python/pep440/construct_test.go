@@ -0,0 +1,71 @@
+package pep440_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func TestConstruct(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Fn  func(pep440.Version) pep440.Version
+		In  string
+		Out string
+	}
+	//nolint:lll // big table
+	testcases := map[string]TestCase{
+		"pre":         {func(v pep440.Version) pep440.Version { return v.WithPre("rc", 1) }, "1.0", "1.0rc1"},
+		"pre-alias":   {func(v pep440.Version) pep440.Version { return v.WithPre("Preview", 2) }, "1.0", "1.0rc2"},
+		"pre-replace": {func(v pep440.Version) pep440.Version { return v.WithPre("b", 0) }, "1.0a3.dev1", "1.0b0.dev1"},
+		"pre-local":   {func(v pep440.Version) pep440.Version { return v.WithPre("a", 1) }, "1.0+local", "1.0a1+local"},
+		"post":        {func(v pep440.Version) pep440.Version { return v.WithPost(2) }, "1!1.0rc1", "1!1.0rc1.post2"},
+		"dev":         {func(v pep440.Version) pep440.Version { return v.WithDev(0) }, "2.0", "2.0.dev0"},
+		"final":       {func(v pep440.Version) pep440.Version { return pep440.Version{PublicVersion: v.Final(), Local: nil} }, "1!2.0rc1.post3.dev4+local", "1!2.0"},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			in := mustParseVersion(t, tc.In)
+			out := tc.Fn(in)
+			assert.Equal(t, tc.Out, out.String())
+			assert.NoError(t, out.Validate())
+			// The input must not have been modified.
+			assert.Equal(t, mustParseVersion(t, tc.In), in)
+		})
+	}
+}
+
+func TestConstructNoAliasing(t *testing.T) {
+	t.Parallel()
+	in := mustParseVersion(t, "1.0rc1.post1.dev1+a.1")
+	out := in.WithDev(2)
+	out.Release[0] = 5
+	out.Pre.N = 5
+	*out.Post = 5
+	out.Local[0].StrVal = "b"
+	assert.Equal(t, "1.0rc1.post1.dev1+a.1", in.String())
+	assert.Equal(t, "5.0rc5.post5.dev2+b.1", out.String())
+}
+
+func TestWithLocal(t *testing.T) {
+	t.Parallel()
+	ver := mustParseVersion(t, "1.0+old")
+
+	out, err := ver.WithLocal("git-ABCDEF.0012")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0+git.abcdef.12", out.String())
+	assert.Equal(t, mustParseVersion(t, "1.0+git-ABCDEF.0012"), out)
+
+	out, err = ver.WithLocal("")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", out.String())
+
+	_, err = ver.WithLocal("git+abc")
+	assert.EqualError(t, err, `pep440.PublicVersion.WithLocal: invalid local version label: "git+abc"`)
+	assert.Equal(t, "1.0+old", ver.String())
+}
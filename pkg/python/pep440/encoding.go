@@ -0,0 +1,95 @@
+package pep440
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// This file isn't part of PEP 440; it implements encoding.TextMarshaler, encoding.TextUnmarshaler,
+// and json.Marshaler for the types in this package, so that they may be used directly in config
+// files and lockfiles.  Everything is encoded as the normal string representation.
+
+// MarshalText implements encoding.TextMarshaler.
+func (ver PublicVersion) MarshalText() ([]byte, error) {
+	return []byte(ver.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (ver PublicVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ver.String())
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.  The version is normalized, and it is an
+// error for it to have a local version label.
+func (ver *PublicVersion) UnmarshalText(txt []byte) error {
+	_ver, err := ParseVersion(string(txt))
+	if err != nil {
+		return err
+	}
+	if len(_ver.Local) > 0 {
+		return fmt.Errorf("pep440.PublicVersion.UnmarshalText: local version label not permitted: %q",
+			txt)
+	}
+	*ver = _ver.PublicVersion
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (ver LocalVersion) MarshalText() ([]byte, error) {
+	return []byte(ver.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (ver LocalVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ver.String())
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.  The version is normalized.
+func (ver *LocalVersion) UnmarshalText(txt []byte) error {
+	_ver, err := ParseVersion(string(txt))
+	if err != nil {
+		return err
+	}
+	*ver = *_ver
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (spec SpecifierClause) MarshalText() ([]byte, error) {
+	return []byte(spec.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (spec SpecifierClause) MarshalJSON() ([]byte, error) {
+	return json.Marshal(spec.String())
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (spec *SpecifierClause) UnmarshalText(txt []byte) error {
+	_spec, err := parseSpecifierClause(string(txt))
+	if err != nil {
+		return fmt.Errorf("pep440.SpecifierClause.UnmarshalText: %w", err)
+	}
+	*spec = _spec
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (spec Specifier) MarshalText() ([]byte, error) {
+	return []byte(spec.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (spec Specifier) MarshalJSON() ([]byte, error) {
+	return json.Marshal(spec.String())
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (spec *Specifier) UnmarshalText(txt []byte) error {
+	_spec, err := ParseSpecifier(string(txt))
+	if err != nil {
+		return err
+	}
+	*spec = _spec
+	return nil
+}
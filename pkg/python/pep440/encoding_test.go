@@ -0,0 +1,77 @@
+package pep440_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yamlv2 "gopkg.in/yaml.v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+type encodingTestStruct struct {
+	Public    pep440.PublicVersion   `json:"public"    yaml:"public"`
+	Version   pep440.Version         `json:"version"   yaml:"version"`
+	Clause    pep440.SpecifierClause `json:"clause"    yaml:"clause"`
+	Specifier pep440.Specifier       `json:"specifier" yaml:"specifier"`
+	Pinned    *pep440.Version        `json:"pinned"    yaml:"pinned"`
+}
+
+func TestEncoding(t *testing.T) {
+	t.Parallel()
+	ver := mustParseVersion(t, "1!2.0rc1.post3.dev4+local.7")
+	in := encodingTestStruct{
+		Public:    mustParseVersion(t, "1.2.3").PublicVersion,
+		Version:   ver,
+		Clause:    mustParseSpecifier(t, "<3")[0],
+		Specifier: mustParseSpecifier(t, "~=1.4, !=1.5.*, >1.4.2"),
+		Pinned:    &ver,
+	}
+	// encoding/json escapes '<' and '>' by default.
+	const expJSON = `{"public":"1.2.3","version":"1!2.0rc1.post3.dev4+local.7","clause":"\u003c3",` +
+		`"specifier":"~=1.4,!=1.5.*,\u003e1.4.2","pinned":"1!2.0rc1.post3.dev4+local.7"}`
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		bs, err := json.Marshal(in)
+		require.NoError(t, err)
+		assert.Equal(t, expJSON, string(bs))
+		var out encodingTestStruct
+		require.NoError(t, json.Unmarshal(bs, &out))
+		assert.Equal(t, in, out)
+	})
+	t.Run("k8s-yaml", func(t *testing.T) {
+		t.Parallel()
+		bs, err := yaml.Marshal(in)
+		require.NoError(t, err)
+		var out encodingTestStruct
+		require.NoError(t, yaml.Unmarshal(bs, &out))
+		assert.Equal(t, in, out)
+	})
+	t.Run("yaml-v2", func(t *testing.T) {
+		t.Parallel()
+		bs, err := yamlv2.Marshal(in)
+		require.NoError(t, err)
+		var out encodingTestStruct
+		require.NoError(t, yamlv2.Unmarshal(bs, &out))
+		assert.Equal(t, in, out)
+	})
+	t.Run("normalize", func(t *testing.T) {
+		t.Parallel()
+		var out encodingTestStruct
+		require.NoError(t, json.Unmarshal([]byte(`{"version":"1.0-RC1","specifier":" >= 1.0 , < 2 "}`), &out))
+		assert.Equal(t, "1.0rc1", out.Version.String())
+		assert.Equal(t, ">=1.0,<2", out.Specifier.String())
+	})
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		var out encodingTestStruct
+		assert.Error(t, json.Unmarshal([]byte(`{"public":"1.0+local"}`), &out))
+		assert.Error(t, json.Unmarshal([]byte(`{"version":"x"}`), &out))
+		assert.Error(t, json.Unmarshal([]byte(`{"clause":"1.0"}`), &out))
+		assert.Error(t, json.Unmarshal([]byte(`{"specifier":"~=1"}`), &out))
+	})
+}
@@ -0,0 +1,78 @@
+//go:build go1.18
+// +build go1.18
+
+package pep440_test
+
+import (
+	"testing"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+// FuzzParseVersion checks that ParseVersion doesn't panic on any input, and that any version that
+// it returns is valid and survives a round-trip through String.
+func FuzzParseVersion(f *testing.F) {
+	for _, seed := range []string{
+		"1.0", "1!2.0rc1.post3.dev4+local.7", "v1.0-alpha_2", "1.0.post", "2012.10", "0.9.10+ubuntu.1",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, str string) {
+		ver, err := pep440.ParseVersion(str)
+		if err != nil {
+			return
+		}
+		if err := ver.Validate(); err != nil {
+			t.Fatalf("ParseVersion(%q) returned an invalid version: %v", str, err)
+		}
+		again, err := pep440.ParseVersion(ver.String())
+		if err != nil {
+			t.Fatalf("ParseVersion(%q).String() = %q, which doesn't parse: %v", str, ver.String(), err)
+		}
+		if again.Cmp(*ver) != 0 {
+			t.Fatalf("ParseVersion(%q).String() = %q, which parses as a different version", str, ver.String())
+		}
+	})
+}
+
+// FuzzParseSpecifier checks that ParseSpecifier doesn't panic on any input, and that any specifier
+// that it returns is valid, survives a round-trip through String, and can be matched against (with
+// the same results whether or not it is compiled).
+func FuzzParseSpecifier(f *testing.F) {
+	for _, seed := range []string{
+		"~=1.4, !=1.5.*, >1.4.2", "==1.0+local", "<3", ">=1!2.0rc1", "===foo", "==1.*,!=1.0.post1",
+	} {
+		f.Add(seed)
+	}
+	vers := []pep440.Version{}
+	for _, str := range []string{"0", "1.0", "1.5rc1", "2.0.post1", "1!1.0+local.7"} {
+		ver, err := pep440.ParseVersion(str)
+		if err != nil {
+			f.Fatal(err)
+		}
+		vers = append(vers, *ver)
+	}
+	f.Fuzz(func(t *testing.T, str string) {
+		spec, err := pep440.ParseSpecifier(str)
+		if err != nil {
+			return
+		}
+		if err := spec.Validate(); err != nil {
+			t.Fatalf("ParseSpecifier(%q) returned an invalid specifier: %v", str, err)
+		}
+		again, err := pep440.ParseSpecifier(spec.String())
+		if err != nil {
+			t.Fatalf("ParseSpecifier(%q).String() = %q, which doesn't parse: %v", str, spec.String(), err)
+		}
+		matcher := spec.Compile()
+		for _, ver := range vers {
+			if spec.Match(ver) != again.Match(ver) {
+				t.Fatalf("ParseSpecifier(%q).String() = %q, which matches %q differently",
+					str, spec.String(), ver)
+			}
+			if spec.Match(ver) != matcher.Match(ver) {
+				t.Fatalf("ParseSpecifier(%q).Compile() matches %q differently", str, ver)
+			}
+		}
+	})
+}
@@ -0,0 +1,346 @@
+package pep440
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// This file isn't part of PEP 440; it is an optimization of Specifier.Match for resolvers, which
+// match the same few specifiers against the same few thousand versions over and over.  Rather than
+// re-deriving everything from the Version structs on every comparison (as the code that follows
+// the text of the PEP does), versions and specifiers are compiled once in to flat keys that are
+// cheap to compare.
+
+// versionKey is a Version pre-processed for fast comparison; comparing two versionKeys with
+// cmpKey gives the same result as Version.Cmp.
+type versionKey struct {
+	epoch int
+	// release has trailing zeros trimmed, since they never affect a comparison (release
+	// segments are compared as if zero-padded).
+	release []int
+	// preL is the rank of the pre-release phase, as in cmpPreRelease; preStr is only set for
+	// an invalid phase.
+	preL   int
+	preStr string
+	preN   int
+	post   int // -1 for none
+	dev    int // math.MaxInt for none
+	local  []intstr.IntOrString
+	// public is the original public version, for prefix matching.
+	public PublicVersion
+}
+
+func newVersionKey(ver Version) versionKey {
+	release := ver.Release
+	for len(release) > 0 && release[len(release)-1] == 0 {
+		release = release[:len(release)-1]
+	}
+	key := versionKey{
+		epoch:   ver.Epoch,
+		release: release,
+		preL:    0,
+		preStr:  "",
+		preN:    0,
+		post:    -1,
+		dev:     math.MaxInt,
+		local:   ver.Local,
+		public:  ver.PublicVersion,
+	}
+	switch {
+	case ver.Pre != nil:
+		l, ok := preReleaseOrder[ver.Pre.L]
+		if !ok {
+			l, key.preStr = preReleaseInvalid, ver.Pre.L
+		}
+		key.preL, key.preN = l, ver.Pre.N
+	case ver.Dev != nil && ver.Post == nil:
+		key.preL = -4
+	}
+	if ver.Post != nil {
+		key.post = *ver.Post
+	}
+	if ver.Dev != nil {
+		key.dev = *ver.Dev
+	}
+	return key
+}
+
+// cmpPublicKey is like PublicVersion.Cmp.
+func cmpPublicKey(a, b *versionKey) int {
+	if a.epoch != b.epoch {
+		return cmpInt(a.epoch, b.epoch)
+	}
+	for i := 0; i < len(a.release) || i < len(b.release); i++ {
+		aSeg, bSeg := 0, 0
+		if i < len(a.release) {
+			aSeg = a.release[i]
+		}
+		if i < len(b.release) {
+			bSeg = b.release[i]
+		}
+		if aSeg != bSeg {
+			return cmpInt(aSeg, bSeg)
+		}
+	}
+	if a.preL != b.preL {
+		return cmpInt(a.preL, b.preL)
+	}
+	if a.preStr != b.preStr {
+		return strings.Compare(a.preStr, b.preStr)
+	}
+	if a.preN != b.preN {
+		return cmpInt(a.preN, b.preN)
+	}
+	if a.post != b.post {
+		return cmpInt(a.post, b.post)
+	}
+	return cmpInt(a.dev, b.dev)
+}
+
+// cmpKey is like Version.Cmp.
+func cmpKey(a, b *versionKey) int {
+	if d := cmpPublicKey(a, b); d != 0 {
+		return d
+	}
+	for i := 0; i < len(a.local) || i < len(b.local); i++ {
+		var aSeg, bSeg *intstr.IntOrString
+		if i < len(a.local) {
+			aSeg = &(a.local[i])
+		}
+		if i < len(b.local) {
+			bSeg = &(b.local[i])
+		}
+		if d := cmpLocalSegment(aSeg, bSeg); d != 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// compiledClause is a SpecifierClause pre-processed for matching against versionKeys.
+type compiledClause struct {
+	op  CmpOp
+	key versionKey
+	// prefix is the release segments that a prefix match (or the prefix half of a
+	// compatible-release match) must start with, padded with zeros as needed.
+	prefix []int
+}
+
+func compileClause(clause SpecifierClause) compiledClause {
+	ret := compiledClause{
+		op:     clause.CmpOp,
+		key:    newVersionKey(clause.Version),
+		prefix: nil,
+	}
+	switch clause.CmpOp {
+	case CmpOpPrefixMatch, CmpOpPrefixExclude:
+		ret.prefix = clause.Version.Release
+	case CmpOpCompatible:
+		if len(clause.Version.Release) > 0 {
+			ret.prefix = clause.Version.Release[:len(clause.Version.Release)-1]
+		}
+	}
+	return ret
+}
+
+func (c *compiledClause) hasPrefix(ver *versionKey) bool {
+	if ver.epoch != c.key.epoch {
+		return false
+	}
+	for i, seg := range c.prefix {
+		verSeg := 0
+		if i < len(ver.release) {
+			verSeg = ver.release[i]
+		}
+		if verSeg != seg {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPrefix is like matchPrefixMatch.
+func (c *compiledClause) matchPrefix(ver *versionKey) bool {
+	if !c.hasPrefix(ver) {
+		return false
+	}
+	spec := &c.key.public
+	if spec.Pre == nil && spec.Post == nil {
+		return true
+	}
+	// A prefix with a pre- or post-release part must match the version's release exactly,
+	// not just as a prefix.
+	if len(ver.release) > len(c.prefix) {
+		for _, seg := range ver.release[len(c.prefix):] {
+			if seg != 0 {
+				return false
+			}
+		}
+	}
+	verPre := ver.public.Pre
+	if (verPre == nil) != (spec.Pre == nil) {
+		return false
+	} else if spec.Pre != nil && (preReleaseOrder[verPre.L] != preReleaseOrder[spec.Pre.L] ||
+		verPre.N != spec.Pre.N) {
+		return false
+	}
+	if spec.Post == nil {
+		return true
+	}
+	return ver.post == c.key.post
+}
+
+func (c *compiledClause) match(ver *versionKey) bool {
+	switch c.op {
+	case CmpOpCompatible:
+		return cmpKey(&c.key, ver) <= 0 && c.hasPrefix(ver)
+	case CmpOpStrictMatch:
+		if len(c.key.local) == 0 {
+			return cmpPublicKey(&c.key, ver) == 0
+		}
+		return cmpKey(&c.key, ver) == 0
+	case CmpOpPrefixMatch:
+		return c.matchPrefix(ver)
+	case CmpOpStrictExclude:
+		if len(c.key.local) == 0 {
+			return cmpPublicKey(&c.key, ver) != 0
+		}
+		return cmpKey(&c.key, ver) != 0
+	case CmpOpPrefixExclude:
+		return !c.matchPrefix(ver)
+	case CmpOpLE:
+		return cmpKey(&c.key, ver) >= 0
+	case CmpOpGE:
+		return cmpKey(&c.key, ver) <= 0
+	case CmpOpLT:
+		return cmpKey(&c.key, ver) > 0
+	case CmpOpGT:
+		return cmpKey(&c.key, ver) < 0
+	default:
+		// An invalid CmpOp (see SpecifierClause.Validate) matches nothing.
+		return false
+	}
+}
+
+// A Matcher is a Specifier that has been compiled (by Specifier.Compile) for fast repeated
+// matching.  It always gives the same results as the Specifier's Match method.  A Matcher is safe
+// to use from multiple goroutines.
+type Matcher struct {
+	spec    Specifier
+	clauses []compiledClause
+}
+
+// Compile compiles spec in to a Matcher.  Only bother with this if spec is going to be matched
+// many times; see also CompileCached.
+func (spec Specifier) Compile() *Matcher {
+	ret := &Matcher{
+		spec:    spec,
+		clauses: make([]compiledClause, 0, len(spec)),
+	}
+	for _, clause := range spec {
+		ret.clauses = append(ret.clauses, compileClause(clause))
+	}
+	return ret
+}
+
+//nolint:gochecknoglobals // it's a cache
+var matcherCache sync.Map // map[string]*Matcher
+
+// CompileCached is like Compile, but returns the same Matcher for specifiers that have the same
+// String(); a resolver encounters the same handful of specifiers (from the dependencies of many
+// different packages) again and again.
+func (spec Specifier) CompileCached() *Matcher {
+	key := spec.String()
+	if m, ok := matcherCache.Load(key); ok {
+		return m.(*Matcher) //nolint:forcetypeassert // we control what goes in the map
+	}
+	m, _ := matcherCache.LoadOrStore(key, spec.Compile())
+	return m.(*Matcher) //nolint:forcetypeassert // we control what goes in the map
+}
+
+// Specifier returns the Specifier that m was compiled from.
+func (m *Matcher) Specifier() Specifier {
+	return m.spec
+}
+
+// Match is like Specifier.Match.  Matching against a VersionSet is faster still, as then each
+// version only needs to be pre-processed once.
+func (m *Matcher) Match(ver Version) bool {
+	key := newVersionKey(ver)
+	return m.matchKey(&key)
+}
+
+func (m *Matcher) matchKey(key *versionKey) bool {
+	for i := range m.clauses {
+		if !m.clauses[i].match(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// A VersionSet is a list of versions that have been pre-processed for fast matching against many
+// Matchers.
+type VersionSet struct {
+	versions []Version
+	keys     []versionKey
+}
+
+// NewVersionSet pre-processes versions in to a VersionSet.  The versions are kept in the order
+// given.
+func NewVersionSet(versions []Version) *VersionSet {
+	ret := &VersionSet{
+		versions: versions,
+		keys:     make([]versionKey, len(versions)),
+	}
+	for i, ver := range versions {
+		ret.keys[i] = newVersionKey(ver)
+	}
+	return ret
+}
+
+// Versions returns the versions in the set.
+func (s *VersionSet) Versions() []Version {
+	return s.versions
+}
+
+// Len returns the number of versions in the set.
+func (s *VersionSet) Len() int {
+	return len(s.versions)
+}
+
+// Filter returns the versions in set that m matches, in the order that they appear in the set.
+func (m *Matcher) Filter(set *VersionSet) []Version {
+	var ret []Version
+	for i := range set.keys {
+		if m.matchKey(&set.keys[i]) {
+			ret = append(ret, set.versions[i])
+		}
+	}
+	return ret
+}
+
+// MatchIndexes is like Filter, but returns the indexes in to set.Versions() rather than the
+// versions themselves.
+func (m *Matcher) MatchIndexes(set *VersionSet) []int {
+	var ret []int
+	for i := range set.keys {
+		if m.matchKey(&set.keys[i]) {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// ContainsAny returns whether m matches any of the versions in set.
+func (m *Matcher) ContainsAny(set *VersionSet) bool {
+	for i := range set.keys {
+		if m.matchKey(&set.keys[i]) {
+			return true
+		}
+	}
+	return false
+}
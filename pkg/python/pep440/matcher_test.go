@@ -0,0 +1,104 @@
+package pep440_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+//nolint:gochecknoglobals // Would be 'const'.
+var matcherVersions = []string{
+	"0", "0.9", "1", "1.0", "1.0.0", "1.0.1", "1.0.post1", "1.0.post2", "1.0.dev1", "1.0a1",
+	"1.0a1.dev2", "1.0a1.post1", "1.0b2", "1.0rc1", "1.0c1", "1.0+local.1", "1.0+local.a",
+	"1.0.1+abc", "1.1", "1.1.0.0", "1.1.post1.dev3", "1.4.5", "1.5", "1.5.0", "1.5.1", "2.0",
+	"2!1.0", "1!1.0", "10.0", "1.0.0.1",
+}
+
+//nolint:gochecknoglobals // Would be 'const'.
+var matcherSpecifiers = []string{
+	"", ">=1.0", ">1.0", "<=1.0", "<1.0", "==1.0", "==1", "==1.0.0", "!=1.0", "==1.0+local.1",
+	"!=1.0+local.1", "==1.*", "==1.0.*", "!=1.0.*", "==1.0a1.*", "==1.0.post1.*", "==1.0rc1.*",
+	"!=1.0a1.*", "~=1.0", "~=1.0.0", "~=1.4.5", "~=1.0a1", "~=1.0.post1", ">=1.0a1", "<1.0rc1",
+	">=1.0,<2", "~=1.4,!=1.5.*,>1.4.2", "==2!1.*", ">=1!1.0", "<=1.0.dev1", ">1.0.post1",
+	"==1.1.0.0.0", "!=1.1",
+}
+
+func TestMatcher(t *testing.T) {
+	t.Parallel()
+	versions := make([]pep440.Version, 0, len(matcherVersions))
+	for _, str := range matcherVersions {
+		versions = append(versions, mustParseVersion(t, str))
+	}
+	set := pep440.NewVersionSet(versions)
+	assert.Equal(t, len(versions), set.Len())
+	for _, specStr := range matcherSpecifiers {
+		specStr := specStr
+		t.Run(specStr, func(t *testing.T) {
+			t.Parallel()
+			spec := mustParseSpecifier(t, specStr)
+			matcher := spec.Compile()
+			var expected []pep440.Version
+			var expectedIdxs []int
+			for i, ver := range versions {
+				exp := spec.Match(ver)
+				assert.Equal(t, exp, matcher.Match(ver), "version %q", ver)
+				if exp {
+					expected = append(expected, ver)
+					expectedIdxs = append(expectedIdxs, i)
+				}
+			}
+			assert.Equal(t, expected, matcher.Filter(set))
+			assert.Equal(t, expectedIdxs, matcher.MatchIndexes(set))
+			assert.Equal(t, len(expected) > 0, matcher.ContainsAny(set))
+			assert.Equal(t, spec, matcher.Specifier())
+		})
+	}
+}
+
+func TestCompileCached(t *testing.T) {
+	t.Parallel()
+	a := mustParseSpecifier(t, ">=1.0, <2").CompileCached()
+	b := mustParseSpecifier(t, ">=1.0,<2").CompileCached()
+	c := mustParseSpecifier(t, ">=1.0,<3").CompileCached()
+	assert.Same(t, a, b)
+	assert.NotSame(t, a, c)
+}
+
+func BenchmarkMatch(b *testing.B) {
+	versions := make([]pep440.Version, 0, len(matcherVersions))
+	for _, str := range matcherVersions {
+		ver, err := pep440.ParseVersion(str)
+		if err != nil {
+			b.Fatal(err)
+		}
+		versions = append(versions, *ver)
+	}
+	spec, err := pep440.ParseSpecifier("~=1.4,!=1.5.*,>1.4.2")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Specifier", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, ver := range versions {
+				_ = spec.Match(ver)
+			}
+		}
+	})
+	b.Run("Matcher", func(b *testing.B) {
+		matcher := spec.Compile()
+		for i := 0; i < b.N; i++ {
+			for _, ver := range versions {
+				_ = matcher.Match(ver)
+			}
+		}
+	})
+	b.Run("VersionSet", func(b *testing.B) {
+		matcher := spec.Compile()
+		set := pep440.NewVersionSet(versions)
+		for i := 0; i < b.N; i++ {
+			_ = matcher.Filter(set)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package pep440
+
+import (
+	"fmt"
+)
+
+// This file isn't part of PEP 440; it implements the user-selectable pre-release behaviors that
+// the "Handling of pre-releases" section says that tools SHOULD offer, with names and semantics
+// matching pip's.
+
+// A PreReleasePolicy says whether to select pre-release (and developmental release) versions.
+type PreReleasePolicy int
+
+const (
+	// PreReleasesIfNecessary, the default, is pip's behavior without --pre: pre-releases are
+	// only selected if the specifier explicitly names one (see Specifier.NamesPreRelease), or if
+	// no final release matches.
+	PreReleasesIfNecessary PreReleasePolicy = iota
+	// PreReleasesAllow is pip's behavior with --pre: pre-releases are selected just like final
+	// releases.
+	PreReleasesAllow
+	// PreReleasesForbid never selects a pre-release, even if it is the only match.
+	PreReleasesForbid
+)
+
+// PreReleasePolicies is the list of all PreReleasePolicy values.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var PreReleasePolicies = []PreReleasePolicy{PreReleasesIfNecessary, PreReleasesAllow, PreReleasesForbid}
+
+func (p PreReleasePolicy) String() string {
+	switch p {
+	case PreReleasesIfNecessary:
+		return "if-necessary"
+	case PreReleasesAllow:
+		return "allow"
+	case PreReleasesForbid:
+		return "forbid"
+	default:
+		return fmt.Sprintf("PreReleasePolicy(%d)", int(p))
+	}
+}
+
+// ParsePreReleasePolicy parses the String form of a PreReleasePolicy.
+func ParsePreReleasePolicy(str string) (PreReleasePolicy, error) {
+	for _, p := range PreReleasePolicies {
+		if p.String() == str {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("pep440.ParsePreReleasePolicy: invalid pre-release policy: %q", str)
+}
+
+// NamesPreRelease returns whether any of the inclusive clauses of spec (~=, ==, <=, or >=) names
+// a pre-release; per PEP 440, such a specifier opts in to pre-releases.
+func (spec Specifier) NamesPreRelease() bool {
+	for _, clause := range spec {
+		switch clause.CmpOp {
+		case CmpOpCompatible, CmpOpStrictMatch, CmpOpPrefixMatch, CmpOpLE, CmpOpGE:
+			if clause.Version.IsPreRelease() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Select is like spec.Select, but applies the policy p as well as the exclusionBehavior (which
+// may be nil).
+func (p PreReleasePolicy) Select(spec Specifier, choices []Version, exclusionBehavior ExclusionBehavior) *Version {
+	switch {
+	case p == PreReleasesForbid:
+		finals := make([]Version, 0, len(choices))
+		for _, choice := range choices {
+			if !choice.IsPreRelease() {
+				finals = append(finals, choice)
+			}
+		}
+		return spec.Select(finals, exclusionBehavior)
+	case p == PreReleasesAllow || spec.NamesPreRelease():
+		return spec.Select(choices, exclusionBehavior)
+	default:
+		multi := MultiExcluder{ExcludePreReleases{AllowList: nil}}
+		if exclusionBehavior != nil {
+			multi = append(multi, exclusionBehavior)
+		}
+		return spec.Select(choices, multi)
+	}
+}
@@ -0,0 +1,101 @@
+package pep440_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func TestParsePreReleasePolicy(t *testing.T) {
+	t.Parallel()
+	for _, policy := range pep440.PreReleasePolicies {
+		parsed, err := pep440.ParsePreReleasePolicy(policy.String())
+		require.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+	_, err := pep440.ParsePreReleasePolicy("sometimes")
+	assert.EqualError(t, err, `pep440.ParsePreReleasePolicy: invalid pre-release policy: "sometimes"`)
+}
+
+func TestNamesPreRelease(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]bool{
+		"":               false,
+		">=1.0":          false,
+		">=1.0rc1":       true,
+		"==2.0b2":        true,
+		"~=2.0.dev1":     true,
+		"<=3.0a1":        true,
+		"<2.0rc1":        false,
+		">2.0rc1":        false,
+		"!=2.0rc1":       false,
+		">=1.0,!=2.0rc1": false,
+		">=1.0,<=2.0rc1": true,
+	}
+	for spec, exp := range testcases {
+		spec, exp := spec, exp
+		t.Run(spec, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, exp, mustParseSpecifier(t, spec).NamesPreRelease())
+		})
+	}
+}
+
+func TestPreReleasePolicySelect(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Policy   pep440.PreReleasePolicy
+		Spec     string
+		Choices  []string
+		Expected string // "" for nil
+	}
+	//nolint:lll // big table with string literals
+	testcases := map[string]TestCase{
+		"if-necessary/final":     {pep440.PreReleasesIfNecessary, ">=1.0", []string{"1.0", "1.1", "2.0rc1"}, "1.1"},
+		"if-necessary/only-pre":  {pep440.PreReleasesIfNecessary, ">=2.0.dev0", []string{"1.0", "2.0rc1"}, "2.0rc1"},
+		"if-necessary/necessary": {pep440.PreReleasesIfNecessary, ">1.1", []string{"1.0", "1.1", "2.0rc1"}, "2.0rc1"},
+		"if-necessary/named":     {pep440.PreReleasesIfNecessary, ">=1.0rc1", []string{"1.0", "2.0rc1"}, "2.0rc1"},
+		"if-necessary/none":      {pep440.PreReleasesIfNecessary, ">=3", []string{"1.0", "2.0rc1"}, ""},
+		"allow/newest":           {pep440.PreReleasesAllow, ">=1.0", []string{"1.0", "1.1", "2.0rc1"}, "2.0rc1"},
+		"allow/dev":              {pep440.PreReleasesAllow, ">=1.0", []string{"1.0", "1.1.dev3"}, "1.1.dev3"},
+		"forbid/final":           {pep440.PreReleasesForbid, ">=1.0", []string{"1.0", "1.1", "2.0rc1"}, "1.1"},
+		"forbid/only-pre":        {pep440.PreReleasesForbid, ">1.1", []string{"1.0", "1.1", "2.0rc1"}, ""},
+		"forbid/named":           {pep440.PreReleasesForbid, "==2.0rc1", []string{"1.0", "2.0rc1"}, ""},
+		"forbid/post-is-not-pre": {pep440.PreReleasesForbid, ">=1.0", []string{"1.0", "1.0.post1"}, "1.0.post1"},
+	}
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			choices := make([]pep440.Version, 0, len(tc.Choices))
+			for _, choice := range tc.Choices {
+				choices = append(choices, mustParseVersion(t, choice))
+			}
+			selected := tc.Policy.Select(mustParseSpecifier(t, tc.Spec), choices, nil)
+			if tc.Expected == "" {
+				assert.Nil(t, selected)
+			} else {
+				require.NotNil(t, selected)
+				assert.Equal(t, tc.Expected, selected.String())
+			}
+		})
+	}
+}
+
+func TestSelectExclusion(t *testing.T) {
+	t.Parallel()
+	spec := mustParseSpecifier(t, ">=1.0")
+	choices := []pep440.Version{mustParseVersion(t, "1.0"), mustParseVersion(t, "2.0rc1")}
+	excludePre := pep440.ExcludePreReleases{AllowList: nil}
+
+	selected := spec.Select(choices, excludePre)
+	require.NotNil(t, selected)
+	assert.Equal(t, "1.0", selected.String(), "an allowed version is preferred")
+
+	selected = spec.Select(choices[1:], excludePre)
+	require.NotNil(t, selected)
+	assert.Equal(t, "2.0rc1", selected.String(), "falls back to an excluded version")
+}
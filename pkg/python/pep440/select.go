@@ -0,0 +1,165 @@
+package pep440
+
+import (
+	"fmt"
+	"sort"
+)
+
+// This file isn't part of PEP 440; it extends Specifier.Select to rank all of the choices, so that
+// a resolver can backtrack to the next-best version, and so that diagnostics can say why each
+// version wasn't selected.
+
+// A CandidateRank says how good a choice a Candidate is; lower is better.
+type CandidateRank int
+
+const (
+	// CandidateAllowed is a version that matches the specifier and that isn't excluded.
+	CandidateAllowed CandidateRank = iota
+	// CandidateExcluded is a version that matches the specifier, but that the
+	// ExclusionBehavior excludes; it is only selected if there are no allowed versions.
+	CandidateExcluded
+	// CandidateRejected is a version that is never selected, because it doesn't match the
+	// specifier (or because a PreReleasePolicy forbids it).
+	CandidateRejected
+)
+
+func (r CandidateRank) String() string {
+	switch r {
+	case CandidateAllowed:
+		return "allowed"
+	case CandidateExcluded:
+		return "excluded"
+	case CandidateRejected:
+		return "rejected"
+	default:
+		return fmt.Sprintf("CandidateRank(%d)", int(r))
+	}
+}
+
+// A Candidate is one of the choices passed to SelectAll, along with how it ranked.
+type Candidate struct {
+	Version Version
+	Rank    CandidateRank
+	// Reason is a human-readable explanation of why the candidate isn't CandidateAllowed; it
+	// is empty for allowed candidates.
+	Reason string
+}
+
+func (c Candidate) String() string {
+	if c.Reason == "" {
+		return fmt.Sprintf("%s (%s)", c.Version, c.Rank)
+	}
+	return fmt.Sprintf("%s (%s: %s)", c.Version, c.Rank, c.Reason)
+}
+
+// Selectable returns whether Select would ever return this candidate.
+func (c Candidate) Selectable() bool {
+	return c.Rank < CandidateRejected
+}
+
+// An ExclusionExplainer is an ExclusionBehavior that can explain why it excludes a version;
+// SelectAll uses it for the Candidate.Reason.  ExclusionBehaviors that don't implement it get a
+// generic reason.
+type ExclusionExplainer interface {
+	ExclusionBehavior
+	// Explain returns why ver is excluded; it is only called if Allow(ver) returns false.
+	Explain(ver Version) string
+}
+
+// Explain implements ExclusionExplainer.
+func (ExcludePreReleases) Explain(_ Version) string {
+	return "pre-releases are excluded unless they are the only match"
+}
+
+// Explain implements ExclusionExplainer; it returns the explanation from the first of m that
+// excludes ver.
+func (m MultiExcluder) Explain(ver Version) string {
+	for _, e := range m {
+		if !e.Allow(ver) {
+			return explainExclusion(e, ver)
+		}
+	}
+	return ""
+}
+
+func explainExclusion(e ExclusionBehavior, ver Version) string {
+	if explainer, ok := e.(ExclusionExplainer); ok {
+		if reason := explainer.Explain(ver); reason != "" {
+			return reason
+		}
+	}
+	return "excluded"
+}
+
+// SelectAll ranks all of the choices against spec and exclusionBehavior (which may be nil): first
+// the allowed matches, then the excluded matches, then the rejected non-matches; each group
+// ordered from greatest to least version, and equal versions kept in the order given.  The first
+// candidate, if it is Selectable, is what Select returns.
+func (spec Specifier) SelectAll(choices []Version, exclusionBehavior ExclusionBehavior) []Candidate {
+	ret := make([]Candidate, 0, len(choices))
+	for _, choice := range choices {
+		ret = append(ret, spec.rank(choice, exclusionBehavior))
+	}
+	sortCandidates(ret)
+	return ret
+}
+
+func (spec Specifier) rank(ver Version, exclusionBehavior ExclusionBehavior) Candidate {
+	for _, clause := range spec {
+		if !clause.Match(ver) {
+			return Candidate{
+				Version: ver,
+				Rank:    CandidateRejected,
+				Reason:  fmt.Sprintf("does not match %q", clause.String()),
+			}
+		}
+	}
+	if exclusionBehavior != nil && !exclusionBehavior.Allow(ver) {
+		return Candidate{
+			Version: ver,
+			Rank:    CandidateExcluded,
+			Reason:  explainExclusion(exclusionBehavior, ver),
+		}
+	}
+	return Candidate{
+		Version: ver,
+		Rank:    CandidateAllowed,
+		Reason:  "",
+	}
+}
+
+func sortCandidates(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Rank != candidates[j].Rank {
+			return candidates[i].Rank < candidates[j].Rank
+		}
+		return candidates[i].Version.Cmp(candidates[j].Version) > 0
+	})
+}
+
+// SelectAll is like spec.SelectAll, but applies the policy p as well as the exclusionBehavior
+// (which may be nil); the first candidate, if it is Selectable, is what p.Select returns.
+func (p PreReleasePolicy) SelectAll(
+	spec Specifier, choices []Version, exclusionBehavior ExclusionBehavior,
+) []Candidate {
+	switch {
+	case p == PreReleasesForbid:
+		ret := spec.SelectAll(choices, exclusionBehavior)
+		for i := range ret {
+			if ret[i].Version.IsPreRelease() && ret[i].Rank < CandidateRejected {
+				ret[i].Rank = CandidateRejected
+				ret[i].Reason = "pre-releases are forbidden"
+			}
+		}
+		sortCandidates(ret)
+		return ret
+	case p == PreReleasesAllow || spec.NamesPreRelease():
+		return spec.SelectAll(choices, exclusionBehavior)
+	default:
+		multi := MultiExcluder{ExcludePreReleases{AllowList: nil}}
+		if exclusionBehavior != nil {
+			multi = append(multi, exclusionBehavior)
+		}
+		return spec.SelectAll(choices, multi)
+	}
+}
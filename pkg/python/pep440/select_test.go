@@ -0,0 +1,94 @@
+package pep440_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+type excludeVersion string
+
+func (e excludeVersion) Allow(ver pep440.Version) bool {
+	return ver.String() != string(e)
+}
+
+func TestSelectAll(t *testing.T) {
+	t.Parallel()
+	choices := make([]pep440.Version, 0, 6)
+	for _, str := range []string{"1.0", "3.0", "1.1", "2.0rc1", "0.9", "1.2"} {
+		choices = append(choices, mustParseVersion(t, str))
+	}
+	type TestCase struct {
+		Policy   pep440.PreReleasePolicy
+		Spec     string
+		Excluder pep440.ExclusionBehavior
+		Expected []string
+	}
+	testcases := map[string]TestCase{
+		"if-necessary": {pep440.PreReleasesIfNecessary, ">=1.0,<3", nil, []string{
+			`1.2 (allowed)`,
+			`1.1 (allowed)`,
+			`1.0 (allowed)`,
+			`2.0rc1 (excluded: pre-releases are excluded unless they are the only match)`,
+			`3.0 (rejected: does not match "<3")`,
+			`0.9 (rejected: does not match ">=1.0")`,
+		}},
+		"allow+excluder": {pep440.PreReleasesAllow, ">=1.0,<3", excludeVersion("1.2"), []string{
+			`2.0rc1 (allowed)`,
+			`1.1 (allowed)`,
+			`1.0 (allowed)`,
+			`1.2 (excluded: excluded)`,
+			`3.0 (rejected: does not match "<3")`,
+			`0.9 (rejected: does not match ">=1.0")`,
+		}},
+		"forbid": {pep440.PreReleasesForbid, ">1.2", nil, []string{
+			`3.0 (allowed)`,
+			`2.0rc1 (rejected: pre-releases are forbidden)`,
+			`1.2 (rejected: does not match ">1.2")`,
+			`1.1 (rejected: does not match ">1.2")`,
+			`1.0 (rejected: does not match ">1.2")`,
+			`0.9 (rejected: does not match ">1.2")`,
+		}},
+		"if-necessary+excluder": {pep440.PreReleasesIfNecessary, ">=1.1", excludeVersion("1.2"), []string{
+			`3.0 (allowed)`,
+			`1.1 (allowed)`,
+			`2.0rc1 (excluded: pre-releases are excluded unless they are the only match)`,
+			`1.2 (excluded: excluded)`,
+			`1.0 (rejected: does not match ">=1.1")`,
+			`0.9 (rejected: does not match ">=1.1")`,
+		}},
+	}
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			spec := mustParseSpecifier(t, tc.Spec)
+			candidates := tc.Policy.SelectAll(spec, choices, tc.Excluder)
+			actual := make([]string, 0, len(candidates))
+			for _, candidate := range candidates {
+				actual = append(actual, candidate.String())
+			}
+			assert.Equal(t, tc.Expected, actual)
+
+			// SelectAll and Select must agree.
+			selected := tc.Policy.Select(spec, choices, tc.Excluder)
+			if candidates[0].Selectable() {
+				if assert.NotNil(t, selected) {
+					assert.Equal(t, candidates[0].Version.String(), selected.String())
+				}
+			} else {
+				assert.Nil(t, selected)
+			}
+		})
+	}
+}
+
+func TestSelectAllEmpty(t *testing.T) {
+	t.Parallel()
+	spec := mustParseSpecifier(t, ">=1.0")
+	assert.Empty(t, spec.SelectAll(nil, nil))
+	assert.Nil(t, spec.Select(nil, nil))
+	assert.Nil(t, spec.Select([]pep440.Version{mustParseVersion(t, "0.1")}, nil))
+}
@@ -0,0 +1,18 @@
+package pep440
+
+import (
+	"sort"
+)
+
+// Versions implements sort.Interface, sorting versions in ascending order.
+type Versions []Version
+
+func (vs Versions) Len() int           { return len(vs) }
+func (vs Versions) Less(i, j int) bool { return vs[i].Cmp(vs[j]) < 0 }
+func (vs Versions) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
+
+// Sort sorts a list of versions in ascending order.  The sort is stable, so that versions that
+// compare as equal (such as "1.0" and "1.0.0") retain their original relative order.
+func Sort(vs []Version) {
+	sort.Stable(Versions(vs))
+}
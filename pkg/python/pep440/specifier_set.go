@@ -0,0 +1,409 @@
+package pep440
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// This file isn't part of PEP 440; it implements set operations on Specifiers, building on the
+// semantics that PEP 440 defines.
+//
+// Other than exclusion clauses (`!=`), every kind of clause matches exactly a contiguous interval
+// of the total ordering of public versions:
+//
+//  - `~=V` matches [V, P.dev0) where P is the bumped prefix of V
+//  - `==V.*` matches [V.dev0, P.dev0) where P is V with its terminal part bumped
+//  - `==V` matches [V, V]
+//  - `<=V`, `>=V`, `<V`, and `>V` match the obvious half-open intervals
+//
+// So, the intersection of all non-exclusion clauses is itself a single interval, which makes
+// reasoning about a Specifier as a whole tractable.  As the spec requires, local version labels
+// are ignored when doing this reasoning, except when a `==` or `!=` clause explicitly includes
+// one.
+
+// An UnsatisfiableError is returned when the clauses of a Specifier are mutually exclusive; that
+// is, when no version could possibly match the specifier.
+type UnsatisfiableError struct {
+	Clauses []SpecifierClause
+}
+
+func newUnsatisfiableError(clauses ...SpecifierClause) *UnsatisfiableError {
+	ret := &UnsatisfiableError{}
+	seen := map[string]bool{}
+	for _, clause := range clauses {
+		if !seen[clause.String()] {
+			seen[clause.String()] = true
+			ret.Clauses = append(ret.Clauses, clause)
+		}
+	}
+	return ret
+}
+
+func (e *UnsatisfiableError) Error() string {
+	clauses := make([]string, 0, len(e.Clauses))
+	for _, clause := range e.Clauses {
+		clauses = append(clauses, fmt.Sprintf("%q", clause.String()))
+	}
+	return fmt.Sprintf("unsatisfiable specifier: clauses %s are mutually exclusive",
+		strings.Join(clauses, " and "))
+}
+
+// A Bound is one end of an interval of versions.
+type Bound struct {
+	Version   PublicVersion
+	Inclusive bool
+
+	// clause is the clause that imposes this bound.
+	clause SpecifierClause
+}
+
+// cmpLower compares two lower bounds, returning >0 if 'a' is more restrictive than 'b'.
+func cmpLower(a, b Bound) int {
+	if d := a.Version.Cmp(b.Version); d != 0 {
+		return d
+	}
+	switch {
+	case a.Inclusive == b.Inclusive:
+		return 0
+	case a.Inclusive:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// cmpUpper compares two upper bounds, returning >0 if 'a' is more restrictive than 'b'.
+func cmpUpper(a, b Bound) int {
+	if d := b.Version.Cmp(a.Version); d != 0 {
+		return d
+	}
+	switch {
+	case a.Inclusive == b.Inclusive:
+		return 0
+	case a.Inclusive:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func (a Bound) equal(b Bound) bool {
+	return a.Inclusive == b.Inclusive && a.Version.Cmp(b.Version) == 0
+}
+
+func copyPublicVersion(ver PublicVersion) PublicVersion {
+	ret := ver
+	ret.Release = append([]int(nil), ver.Release...)
+	if ver.Pre != nil {
+		pre := *ver.Pre
+		ret.Pre = &pre
+	}
+	if ver.Post != nil {
+		post := *ver.Post
+		ret.Post = &post
+	}
+	if ver.Dev != nil {
+		dev := *ver.Dev
+		ret.Dev = &dev
+	}
+	return ret
+}
+
+// prefixBounds returns the interval of versions that have the given version as a prefix, as used
+// by `==V.*` clauses.  The prefix must not have a dev-part.
+func prefixBounds(prefix PublicVersion) (lo, hi PublicVersion) {
+	zero := 0
+
+	lo = copyPublicVersion(prefix)
+	lo.Dev = &zero
+
+	hi = copyPublicVersion(prefix)
+	switch {
+	case hi.Post != nil:
+		*hi.Post++
+	case hi.Pre != nil:
+		hi.Pre.N++
+	default:
+		hi.Release[len(hi.Release)-1]++
+	}
+	hi.Dev = &zero
+
+	return lo, hi
+}
+
+// interval returns the interval of versions matched by the clause.  Either or both ends may be
+// nil, indicating that the interval is unbounded in that direction.  Exclusion clauses return an
+// unbounded interval, as they do not match a single contiguous interval.
+func (spec SpecifierClause) interval() (lo, hi *Bound) {
+	switch spec.CmpOp {
+	case CmpOpCompatible:
+		prefix := copyPublicVersion(spec.Version.PublicVersion)
+		prefix.Release = prefix.Release[:len(prefix.Release)-1]
+		prefix.Pre = nil
+		prefix.Post = nil
+		prefix.Dev = nil
+		_, prefixHi := prefixBounds(prefix)
+		lo = &Bound{Version: spec.Version.PublicVersion, Inclusive: true, clause: spec}
+		hi = &Bound{Version: prefixHi, Inclusive: false, clause: spec}
+	case CmpOpPrefixMatch:
+		prefixLo, prefixHi := prefixBounds(spec.Version.PublicVersion)
+		lo = &Bound{Version: prefixLo, Inclusive: true, clause: spec}
+		hi = &Bound{Version: prefixHi, Inclusive: false, clause: spec}
+	case CmpOpStrictMatch:
+		lo = &Bound{Version: spec.Version.PublicVersion, Inclusive: true, clause: spec}
+		hi = &Bound{Version: spec.Version.PublicVersion, Inclusive: true, clause: spec}
+	case CmpOpGE:
+		lo = &Bound{Version: spec.Version.PublicVersion, Inclusive: true, clause: spec}
+	case CmpOpGT:
+		lo = &Bound{Version: spec.Version.PublicVersion, Inclusive: false, clause: spec}
+	case CmpOpLE:
+		hi = &Bound{Version: spec.Version.PublicVersion, Inclusive: true, clause: spec}
+	case CmpOpLT:
+		hi = &Bound{Version: spec.Version.PublicVersion, Inclusive: false, clause: spec}
+	}
+	return lo, hi
+}
+
+// bounds returns the interval of public versions that the non-exclusion clauses of the specifier
+// narrow the candidates down to.
+func (spec Specifier) bounds() (lo, hi *Bound) {
+	for _, clause := range spec {
+		clauseLo, clauseHi := clause.interval()
+		if clauseLo != nil && (lo == nil || cmpLower(*clauseLo, *lo) > 0) {
+			lo = clauseLo
+		}
+		if clauseHi != nil && (hi == nil || cmpUpper(*clauseHi, *hi) > 0) {
+			hi = clauseHi
+		}
+	}
+	return lo, hi
+}
+
+// LowerBound returns the lowest version that may match the specifier, or nil if the specifier has
+// no lower bound.  Exclusion clauses (`!=`) are not taken in to account; so it is possible that the
+// bound itself is excluded even if the bound is inclusive.
+func (spec Specifier) LowerBound() *Bound {
+	lo, _ := spec.bounds()
+	if lo == nil {
+		return nil
+	}
+	ret := *lo
+	ret.Version = copyPublicVersion(ret.Version)
+	return &ret
+}
+
+// UpperBound returns the highest version that may match the specifier, or nil if the specifier has
+// no upper bound.  Exclusion clauses (`!=`) are not taken in to account; so it is possible that the
+// bound itself is excluded even if the bound is inclusive.
+func (spec Specifier) UpperBound() *Bound {
+	_, hi := spec.bounds()
+	if hi == nil {
+		return nil
+	}
+	ret := *hi
+	ret.Version = copyPublicVersion(ret.Version)
+	return &ret
+}
+
+// Intersect returns a simplified Specifier that matches only the versions that are matched by
+// both spec and other.  If there are no such versions, an *UnsatisfiableError is returned.
+func (spec Specifier) Intersect(other Specifier) (Specifier, error) {
+	combined := make(Specifier, 0, len(spec)+len(other))
+	combined = append(combined, spec...)
+	combined = append(combined, other...)
+	ret, err := combined.simplify()
+	if err != nil {
+		return nil, fmt.Errorf("pep440.Specifier.Intersect: %w", err)
+	}
+	return ret, nil
+}
+
+// Simplify returns a minimal canonical Specifier that matches the same versions as spec: redundant
+// clauses are dropped, and the remaining clauses are put in a consistent order (lower bound, upper
+// bound, then exclusions).  If the clauses of spec are mutually exclusive, an
+// *UnsatisfiableError is returned.
+//
+// Simplify only reports a conflict if it can prove that no version can match; because local
+// version labels are ignored, it is possible for a Specifier that Simplify accepts to only be
+// satisfiable by versions that no sane project would publish (such as `>1.0,<1.0.post0.dev0`).
+func (spec Specifier) Simplify() (Specifier, error) {
+	ret, err := spec.simplify()
+	if err != nil {
+		return nil, fmt.Errorf("pep440.Specifier.Simplify: %w", err)
+	}
+	return ret, nil
+}
+
+// Satisfiable returns whether it is possible for any version to match the specifier.  See
+// Simplify for the caveats.
+func (spec Specifier) Satisfiable() bool {
+	_, err := spec.simplify()
+	return err == nil
+}
+
+func (spec Specifier) simplify() (Specifier, error) {
+	lo, hi := spec.bounds()
+
+	if lo != nil && hi != nil {
+		if d := lo.Version.Cmp(hi.Version); d > 0 || (d == 0 && !(lo.Inclusive && hi.Inclusive)) {
+			return nil, newUnsatisfiableError(lo.clause, hi.clause)
+		}
+		if lo.Version.Cmp(hi.Version) == 0 {
+			for _, clause := range spec {
+				if clause.CmpOp == CmpOpStrictMatch {
+					return spec.simplifyPoint()
+				}
+			}
+		}
+	}
+
+	var ret Specifier
+
+	// Choose the clauses to express the bounds with.
+	if lo != nil {
+		loClause := pickBoundClause(spec, func(clauseLo, clauseHi *Bound) bool {
+			return clauseLo != nil && clauseLo.equal(*lo)
+		}, hi)
+		ret = append(ret, loClause)
+		if _, loClauseHi := loClause.interval(); hi != nil && (loClauseHi == nil || !loClauseHi.equal(*hi)) {
+			ret = append(ret, pickBoundClause(spec, func(_, clauseHi *Bound) bool {
+				return clauseHi != nil && clauseHi.equal(*hi)
+			}, nil))
+		}
+	} else if hi != nil {
+		ret = append(ret, pickBoundClause(spec, func(_, clauseHi *Bound) bool {
+			return clauseHi != nil && clauseHi.equal(*hi)
+		}, nil))
+	}
+
+	// Keep any exclusions that actually exclude something.
+	exclusions, err := spec.relevantExclusions(lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, exclusions...)
+
+	return ret, nil
+}
+
+// pickBoundClause returns the first clause in spec for which the predicate is true, preferring
+// clauses that also match the 'hi' bound (so that a single clause can express both bounds), and
+// preferring `~=` and `==V.*` clauses over plain ordered comparisons (as they better capture the
+// intent of the author).
+func pickBoundClause(spec Specifier, pred func(lo, hi *Bound) bool, hi *Bound) SpecifierClause {
+	var ret *SpecifierClause
+	score := func(clause SpecifierClause) int {
+		n := 0
+		if _, clauseHi := clause.interval(); hi != nil && clauseHi != nil && clauseHi.equal(*hi) {
+			n += 2
+		}
+		if clause.CmpOp == CmpOpCompatible || clause.CmpOp == CmpOpPrefixMatch {
+			n++
+		}
+		return n
+	}
+	for i := range spec {
+		if !pred(spec[i].interval()) {
+			continue
+		}
+		if ret == nil || score(spec[i]) > score(*ret) {
+			ret = &spec[i]
+		}
+	}
+	if ret == nil {
+		panic("pep440: no clause imposes the bound")
+	}
+	return *ret
+}
+
+// simplifyPoint is the part of simplify that handles the case where a `==` clause narrows the
+// candidates down to a single public version.
+func (spec Specifier) simplifyPoint() (Specifier, error) {
+	// Identify the == clause to use; preferring one with a local version label.
+	var point *SpecifierClause
+	for i, clause := range spec {
+		if clause.CmpOp != CmpOpStrictMatch {
+			continue
+		}
+		switch {
+		case point == nil:
+			point = &spec[i]
+		case len(clause.Version.Local) > 0 && len(point.Version.Local) == 0:
+			point = &spec[i]
+		case len(clause.Version.Local) > 0 && cmpLocal(clause.Version, point.Version) != 0:
+			return nil, newUnsatisfiableError(*point, clause)
+		}
+	}
+
+	ret := Specifier{*point}
+	seen := map[string]bool{}
+	for _, clause := range spec {
+		if clause.CmpOp != CmpOpStrictExclude && clause.CmpOp != CmpOpPrefixExclude {
+			continue
+		}
+		if !clause.Match(point.Version) {
+			return nil, newUnsatisfiableError(*point, clause)
+		}
+		// `==1.0,!=1.0+foo` excludes a local version of the public version that was
+		// matched; keep it.
+		if clause.CmpOp == CmpOpStrictExclude &&
+			len(point.Version.Local) == 0 && len(clause.Version.Local) > 0 &&
+			clause.Version.PublicVersion.Cmp(point.Version.PublicVersion) == 0 &&
+			!seen[clause.String()] {
+			seen[clause.String()] = true
+			ret = append(ret, clause)
+		}
+	}
+	return ret, nil
+}
+
+// relevantExclusions returns the (deduplicated, sorted) exclusion clauses of spec that exclude at
+// least one version within the interval [lo, hi].
+func (spec Specifier) relevantExclusions(lo, hi *Bound) (Specifier, error) {
+	var ret Specifier
+	seen := map[string]bool{}
+	for _, clause := range spec {
+		if seen[clause.String()] {
+			continue
+		}
+		switch clause.CmpOp {
+		case CmpOpStrictExclude:
+			ver := Bound{Version: clause.Version.PublicVersion, Inclusive: true}
+			if (lo != nil && cmpLower(ver, *lo) < 0) || (hi != nil && cmpUpper(ver, *hi) < 0) {
+				continue // outside of the interval
+			}
+			if lo != nil && hi != nil && lo.Version.Cmp(hi.Version) == 0 && len(clause.Version.Local) == 0 {
+				// The interval is a single public version, and this excludes it.
+				return nil, newUnsatisfiableError(lo.clause, hi.clause, clause)
+			}
+		case CmpOpPrefixExclude:
+			exLo, exHi := prefixBounds(clause.Version.PublicVersion)
+			if lo != nil && exHi.Cmp(lo.Version) <= 0 {
+				continue // entirely below the interval
+			}
+			if hi != nil {
+				if d := exLo.Cmp(hi.Version); d > 0 || (d == 0 && !hi.Inclusive) {
+					continue // entirely above the interval
+				}
+			}
+			if lo != nil && hi != nil && exLo.Cmp(lo.Version) <= 0 {
+				if d := hi.Version.Cmp(exHi); d < 0 || (d == 0 && !hi.Inclusive) {
+					// The exclusion covers the entire interval.
+					return nil, newUnsatisfiableError(lo.clause, hi.clause, clause)
+				}
+			}
+		default:
+			continue
+		}
+		seen[clause.String()] = true
+		ret = append(ret, clause)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if d := ret[i].Version.Cmp(ret[j].Version); d != 0 {
+			return d < 0
+		}
+		return ret[i].CmpOp < ret[j].CmpOp
+	})
+	return ret, nil
+}
@@ -0,0 +1,181 @@
+package pep440_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func mustParseSpecifier(t *testing.T, str string) pep440.Specifier {
+	t.Helper()
+	spec, err := pep440.ParseSpecifier(str)
+	require.NoError(t, err)
+	return spec
+}
+
+func TestSimplify(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		InSpec  string
+		OutSpec string
+		OutErr  string
+	}
+	//nolint:lll // big table with string literals
+	testcases := map[string]TestCase{
+		"empty":              {"", "", ""},
+		"single":             {">= 1.0", ">=1.0", ""},
+		"redundant-lower":    {">= 1.0, >= 2.0, > 0.5", ">=2.0", ""},
+		"redundant-upper":    {"< 3.0, <= 2.0, < 4", "<=2.0", ""},
+		"exclusive-wins-tie": {">= 2.0, > 2.0", ">2.0", ""},
+		"range":              {"< 2.0, >= 1.0", ">=1.0,<2.0", ""},
+		"compatible-implies": {"~= 2.2, >= 2.0, == 2.*", "~=2.2", ""},
+		"compatible-upper":   {"~= 2.2, < 2.5", "~=2.2,<2.5", ""},
+		"compatible-lower":   {"~= 2.2, >= 2.5", ">=2.5,~=2.2", ""},
+		"prefix-in-prefix":   {"== 1.*, == 1.4.*", "==1.4.*", ""},
+		"point-from-range":   {">= 1.0, <= 1.0, != 1.0+foo", ">=1.0,<=1.0,!=1.0+foo", ""},
+		"point-keeps-local":  {"== 1.0, != 1.0+foo, != 2.0", "==1.0,!=1.0+foo", ""},
+		"point-local":        {"== 1.0, == 1.0+foo, >= 0.5", "==1.0+foo", ""},
+		"drop-exclusions":    {">= 1.0, < 2.0, != 2.5, != 0.5, != 0.*, != 3.*", ">=1.0,<2.0", ""},
+		"keep-exclusions":    {">= 1.0, < 2.0, != 1.5, != 1.2, != 1.2, != 1.3.*", ">=1.0,<2.0,!=1.2,!=1.3.*,!=1.5", ""},
+		"only-exclusions":    {"!= 1.0, != 0.5", "!=0.5,!=1.0", ""},
+
+		"conflict-range":        {"> 2, < 1", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses ">2" and "<1" are mutually exclusive`},
+		"conflict-touching":     {"> 1, <= 1", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses ">1" and "<=1" are mutually exclusive`},
+		"conflict-eq":           {"== 1.0, == 2.0", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses "==2.0" and "==1.0" are mutually exclusive`},
+		"conflict-local":        {"== 1.0+foo, == 1.0+bar", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses "==1.0+foo" and "==1.0+bar" are mutually exclusive`},
+		"conflict-exclude":      {"== 1.0, != 1.0", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses "==1.0" and "!=1.0" are mutually exclusive`},
+		"conflict-prefixes":     {"== 1.*, == 2.*", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses "==2.*" and "==1.*" are mutually exclusive`},
+		"conflict-prefix-excl":  {"~= 1.4.2, != 1.4.*", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses "~=1.4.2" and "!=1.4.*" are mutually exclusive`},
+		"conflict-point-excl":   {">= 1.0, <= 1.0, != 1.*", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses ">=1.0" and "<=1.0" and "!=1.*" are mutually exclusive`},
+		"conflict-point-strict": {">= 1.0, <= 1.0, != 1.0", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses ">=1.0" and "<=1.0" and "!=1.0" are mutually exclusive`},
+		"conflict-compat-upper": {"~= 2.2, < 2.2", "", `pep440.Specifier.Simplify: unsatisfiable specifier: clauses "~=2.2" and "<2.2" are mutually exclusive`},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			spec := mustParseSpecifier(t, tc.InSpec)
+			out, err := spec.Simplify()
+			if tc.OutErr == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.OutSpec, out.String())
+				assert.True(t, spec.Satisfiable())
+			} else {
+				assert.EqualError(t, err, tc.OutErr)
+				var unsatErr *pep440.UnsatisfiableError
+				assert.True(t, errors.As(err, &unsatErr))
+				assert.False(t, spec.Satisfiable())
+			}
+		})
+	}
+}
+
+func TestSimplifyEquivalent(t *testing.T) {
+	t.Parallel()
+	specs := []string{
+		">= 1.0, >= 2.0, > 0.5",
+		"~= 2.2, >= 2.0, == 2.*",
+		"~= 2.2, < 2.5",
+		"~= 2.2, >= 2.5",
+		"== 1.*, == 1.4.*",
+		">= 1.0, <= 1.0, != 1.0+foo",
+		"== 1.0, != 1.0+foo, != 2.0",
+		">= 1.0, < 2.0, != 2.5, != 0.5, != 0.*, != 3.*",
+		">= 1.0, < 2.0, != 1.5, != 1.2, != 1.2, != 1.3.*",
+	}
+	versions := []string{
+		"0.5", "0.9", "1.0.dev0", "1.0a1", "1.0", "1.0+foo", "1.0+bar", "1.0.post1", "1.2", "1.3.1",
+		"1.4", "1.4.1", "1.5", "1.9", "2.0", "2.1", "2.2", "2.3", "2.5", "2.9", "3.0.dev0", "3.0",
+	}
+	for _, specStr := range specs {
+		specStr := specStr
+		t.Run(specStr, func(t *testing.T) {
+			t.Parallel()
+			spec := mustParseSpecifier(t, specStr)
+			simplified, err := spec.Simplify()
+			require.NoError(t, err)
+			for _, verStr := range versions {
+				ver := mustParseVersion(t, verStr)
+				assert.Equal(t, spec.Match(ver), simplified.Match(ver), "version %q", verStr)
+			}
+		})
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		InA    string
+		InB    string
+		Out    string
+		OutErr string
+	}
+	//nolint:lll // big table with string literals
+	testcases := map[string]TestCase{
+		"disjoint-ish": {">= 1.0", "< 2.0", ">=1.0,<2.0", ""},
+		"narrow":       {">= 1.0, < 3.0", "~= 2.1", "~=2.1", ""},
+		"exclusions":   {">= 1.0, != 1.5", "!= 1.5, != 1.7, < 1.6", ">=1.0,<1.6,!=1.5", ""},
+		"empty":        {"", "== 1.2", "==1.2", ""},
+		"conflict":     {"> 2", "< 1", "", `pep440.Specifier.Intersect: unsatisfiable specifier: clauses ">2" and "<1" are mutually exclusive`},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			out, err := mustParseSpecifier(t, tc.InA).Intersect(mustParseSpecifier(t, tc.InB))
+			if tc.OutErr == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Out, out.String())
+			} else {
+				assert.EqualError(t, err, tc.OutErr)
+			}
+		})
+	}
+}
+
+func TestBounds(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		InSpec string
+		OutLo  string
+		OutHi  string
+	}
+	testcases := map[string]TestCase{
+		"empty":       {"", "", ""},
+		"exclusions":  {"!= 1.0", "", ""},
+		"lower":       {">= 1.0, > 0.5", ">=1.0", ""},
+		"upper":       {"< 2.0, <= 3", "", "<2.0"},
+		"both":        {">= 1.0, <= 2.0", ">=1.0", "<=2.0"},
+		"compatible":  {"~= 1.4.5", ">=1.4.5", "<1.5.dev0"},
+		"prefix":      {"== 1.4.*", ">=1.4.dev0", "<1.5.dev0"},
+		"strict":      {"== 1.4", ">=1.4", "<=1.4"},
+		"exclusive":   {"> 1.4, >= 1.4", ">1.4", ""},
+		"tightest":    {"~= 1.4, < 1.9", ">=1.4", "<1.9"},
+		"pre-release": {"== 2.0rc1.*", ">=2.0rc1.dev0", "<2.0rc2.dev0"},
+	}
+	boundStr := func(b *pep440.Bound, lower bool) string {
+		if b == nil {
+			return ""
+		}
+		op := map[[2]bool]string{
+			{true, true}:   ">=",
+			{true, false}:  ">",
+			{false, true}:  "<=",
+			{false, false}: "<",
+		}[[2]bool{lower, b.Inclusive}]
+		return op + b.Version.String()
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			spec := mustParseSpecifier(t, tc.InSpec)
+			assert.Equal(t, tc.OutLo, boundStr(spec.LowerBound(), true))
+			assert.Equal(t, tc.OutHi, boundStr(spec.UpperBound(), false))
+		})
+	}
+}
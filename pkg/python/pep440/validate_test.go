@@ -0,0 +1,97 @@
+package pep440_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	public := func(release ...int) pep440.PublicVersion {
+		return pep440.PublicVersion{Epoch: 0, Release: release, Pre: nil, Post: nil, Dev: nil}
+	}
+	testcases := map[string]struct {
+		Input    pep440.Version
+		ExpError string
+	}{
+		"valid": {
+			Input:    mustParseVersion(t, "1!2.0rc1.post3.dev4+local.7"),
+			ExpError: "",
+		},
+		"zero": {
+			Input:    pep440.Version{PublicVersion: public(), Local: nil},
+			ExpError: "no release segments",
+		},
+		"negative-epoch": {
+			Input: pep440.Version{
+				PublicVersion: pep440.PublicVersion{Epoch: -1, Release: []int{1}, Pre: nil, Post: nil, Dev: nil},
+				Local:         nil,
+			},
+			ExpError: "negative epoch: -1",
+		},
+		"negative-release": {
+			Input:    pep440.Version{PublicVersion: public(1, -2), Local: nil},
+			ExpError: "negative release segment: -2",
+		},
+		"bad-pre": {
+			Input: pep440.Version{
+				PublicVersion: pep440.PublicVersion{
+					Epoch: 0, Release: []int{1}, Pre: &pep440.PreRelease{L: "x", N: 1}, Post: nil, Dev: nil,
+				},
+				Local: nil,
+			},
+			ExpError: `invalid pre-release phase: "x"`,
+		},
+		"negative-dev": {
+			Input: pep440.Version{
+				PublicVersion: pep440.PublicVersion{Epoch: 0, Release: []int{1}, Pre: nil, Post: nil, Dev: intPtr(-1)},
+				Local:         nil,
+			},
+			ExpError: "negative dev-release number: -1",
+		},
+		"bad-local": {
+			Input:    pep440.Version{PublicVersion: public(1), Local: []intstr.IntOrString{intstr.FromString("a-b")}},
+			ExpError: `invalid local segment: "a-b"`,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			err := tcData.Input.Validate()
+			if tcData.ExpError == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tcData.ExpError)
+			}
+			// None of these should panic, even for invalid versions.
+			assert.NotPanics(t, func() {
+				_ = tcData.Input.String()
+				_ = tcData.Input.Cmp(mustParseVersion(t, "1.0a1"))
+				_ = mustParseVersion(t, "1.0a1").Cmp(tcData.Input)
+				_ = mustParseSpecifier(t, "~=1.0").Match(tcData.Input)
+			})
+		})
+	}
+}
+
+func TestValidateSpecifier(t *testing.T) {
+	t.Parallel()
+	spec := mustParseSpecifier(t, ">=1.0, <2")
+	assert.NoError(t, spec.Validate())
+
+	spec[1].CmpOp = 42
+	err := spec.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid CmpOp: 42")
+	assert.NotPanics(t, func() {
+		assert.Equal(t, ">=1.0,CmpOp(42)2", spec.String())
+		assert.False(t, spec.Match(mustParseVersion(t, "1.5")))
+	})
+}
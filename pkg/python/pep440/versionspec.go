@@ -0,0 +1,38 @@
+package pep440
+
+import (
+	"fmt"
+	"strings"
+)
+
+// This file isn't part of PEP 440; it implements the "versionspec" production of the PEP 508
+// dependency-specification grammar, which is how specifiers appear in "Requires-Dist" lines and
+// requirements files:
+//
+//     versionspec = ( '(' version_many ')' ) | version_many
+//
+// PEP 345 metadata always wrapped the specifier in parentheses (`zope.interface (>3.5.0)`), and
+// plenty of wheels on PyPI still have metadata written that way.
+//
+// https://peps.python.org/pep-0508/#grammar
+
+// ParseVersionSpec is like ParseSpecifier, but also accepts a specifier that is wrapped in a
+// single pair of parentheses, with optional whitespace anywhere that PEP 508 permits it (around
+// the parentheses, around the commas, and between an operator and its version).
+func ParseVersionSpec(str string) (Specifier, error) {
+	str = strings.TrimSpace(str)
+	if strings.HasPrefix(str, "(") {
+		if !strings.HasSuffix(str, ")") {
+			return nil, fmt.Errorf("pep440.ParseVersionSpec: %q: unbalanced parenthesis", str)
+		}
+		str = str[1 : len(str)-1]
+	}
+	if idx := strings.IndexAny(str, "()"); idx >= 0 {
+		return nil, fmt.Errorf("pep440.ParseVersionSpec: %q: unexpected %q", str, str[idx])
+	}
+	spec, err := ParseSpecifier(str)
+	if err != nil {
+		return nil, fmt.Errorf("pep440.ParseVersionSpec: %w", err)
+	}
+	return spec, nil
+}
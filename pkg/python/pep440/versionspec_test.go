@@ -0,0 +1,45 @@
+package pep440_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+func TestParseVersionSpec(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		InStr  string
+		OutStr string
+		OutErr string
+	}
+	//nolint:lll // big table with string literals
+	testcases := map[string]TestCase{
+		"empty":        {"", "", ""},
+		"empty-parens": {"()", "", ""},
+		"plain":        {">=1.0,<2", ">=1.0,<2", ""},
+		"parens":       {"(>=1.0,<2)", ">=1.0,<2", ""},
+		"spaces":       {"  ( >= 1.0 , != 1.3.* , < 2 )  ", ">=1.0,!=1.3.*,<2", ""},
+		"pep345":       {"(>3.5.0)", ">3.5.0", ""},
+		"bad-open":     {"(>=1.0", "", `pep440.ParseVersionSpec: "(>=1.0": unbalanced parenthesis`},
+		"bad-close":    {">=1.0)", "", `pep440.ParseVersionSpec: ">=1.0)": unexpected ')'`},
+		"bad-nested":   {"((>=1.0))", "", `pep440.ParseVersionSpec: "(>=1.0)": unexpected '('`},
+		"bad-clause":   {"(1.0)", "", `pep440.ParseVersionSpec: pep440.ParseSpecifier: invalid comparison operator: "1.0"`},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			spec, err := pep440.ParseVersionSpec(tc.InStr)
+			if tc.OutErr != "" {
+				assert.EqualError(t, err, tc.OutErr)
+				assert.Nil(t, spec)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.OutStr, spec.String())
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package pep503
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/datawire/dlib/dexec"
+)
+
+// Credentials are what a Client uses to authenticate to an index server.
+type Credentials struct {
+	// Username and Password are sent using HTTP basic authentication.
+	Username string
+	Password string
+	// Token, if set, is sent as an HTTP bearer token instead of using basic authentication.
+	Token string
+}
+
+func (creds Credentials) apply(req *http.Request) {
+	if creds.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+	} else {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+}
+
+// A CredentialProvider returns the credentials to use for a request to the given URL, or nil if
+// it has no credentials for that URL.  Providers are called for every request (including requests
+// for the files linked to from an index page, which are often on a different host), so they
+// should only return credentials for hosts that they are meant for; see ForHosts.
+type CredentialProvider func(ctx context.Context, u *url.URL) (*Credentials, error)
+
+// getCredentials returns the credentials from the first of the client's providers that has any.
+func (c Client) getCredentials(ctx context.Context, u *url.URL) (*Credentials, error) {
+	for _, provider := range c.Credentials {
+		creds, err := provider(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("credentials for %q: %w", u.Host, err)
+		}
+		if creds != nil {
+			return creds, nil
+		}
+	}
+	return nil, nil
+}
+
+// ForHosts scopes a provider to only return credentials for the given hosts.  A host may include
+// a port ("example.com:8443"), in which case it only matches that port; otherwise it matches any
+// port.
+func ForHosts(provider CredentialProvider, hosts ...string) CredentialProvider {
+	return func(ctx context.Context, u *url.URL) (*Credentials, error) {
+		for _, host := range hosts {
+			if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+				return provider(ctx, u)
+			}
+		}
+		return nil, nil
+	}
+}
+
+// StaticCredentials returns a provider that always returns creds; it should usually be wrapped
+// with ForHosts.
+func StaticCredentials(creds Credentials) CredentialProvider {
+	return func(_ context.Context, _ *url.URL) (*Credentials, error) {
+		return &creds, nil
+	}
+}
+
+// NetrcCredentials returns a provider that reads credentials from a netrc file, as curl and pip
+// do.  If filename is empty, then $NETRC is used, or else "~/.netrc" ("~/_netrc" on Windows).  A
+// missing file is not an error; the provider just doesn't have any credentials.  The file is read
+// once, on first use.
+func NetrcCredentials(filename string) CredentialProvider {
+	var (
+		once    sync.Once
+		entries []netrcEntry
+		readErr error
+	)
+	return func(_ context.Context, u *url.URL) (*Credentials, error) {
+		once.Do(func() {
+			entries, readErr = readNetrc(filename)
+		})
+		if readErr != nil {
+			return nil, readErr
+		}
+		for _, entry := range entries {
+			if entry.machine == "" || strings.EqualFold(entry.machine, u.Hostname()) {
+				return &Credentials{
+					Username: entry.login,
+					Password: entry.password,
+					Token:    "",
+				}, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+// netrcEntry is a "machine" entry in a netrc file; "default" entries have an empty machine.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+func readNetrc(filename string) ([]netrcEntry, error) {
+	if filename == "" {
+		filename = os.Getenv("NETRC")
+	}
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		filename = filepath.Join(home, ".netrc")
+		if _, err := os.Stat(filename); err != nil && filepath.Separator == '\\' {
+			filename = filepath.Join(home, "_netrc")
+		}
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseNetrc(string(content)), nil
+}
+
+// parseNetrc parses the content of a netrc file.  Entries that come after a "default" entry are
+// ignored, as they can never match.
+func parseNetrc(content string) []netrcEntry {
+	var (
+		ret     []netrcEntry
+		cur     *netrcEntry
+		inMacro bool
+	)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// A macro definition runs until a blank line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		words := strings.Fields(line)
+		for i := 0; i < len(words); i++ {
+			arg := func() string {
+				if i+1 < len(words) {
+					i++
+					return words[i]
+				}
+				return ""
+			}
+			switch words[i] {
+			case "machine":
+				ret = append(ret, netrcEntry{machine: arg(), login: "", password: ""})
+				cur = &ret[len(ret)-1]
+			case "default":
+				ret = append(ret, netrcEntry{machine: "", login: "", password: ""})
+				cur = &ret[len(ret)-1]
+			case "login":
+				if login := arg(); cur != nil {
+					cur.login = login
+				}
+			case "password":
+				if password := arg(); cur != nil {
+					cur.password = password
+				}
+			case "account":
+				_ = arg()
+			case "macdef":
+				_ = arg()
+				inMacro = true
+				i = len(words)
+			}
+		}
+	}
+	for i, entry := range ret {
+		if entry.machine == "" {
+			return ret[:i+1]
+		}
+	}
+	return ret
+}
+
+// EnvCredentials returns a provider that reads credentials from environment variables named
+// "{prefix}{HOST}", where HOST is the request's hostname uppercased and with each character that
+// isn't a letter or digit replaced with "_"; for example, with the prefix
+// "OCIBUILD_INDEX_CREDENTIALS_", credentials for "pkgs.example.com" are read from
+// $OCIBUILD_INDEX_CREDENTIALS_PKGS_EXAMPLE_COM.  A value of the form "USERNAME:PASSWORD" is used
+// for basic authentication; any other value is used as a bearer token.
+func EnvCredentials(prefix string) CredentialProvider {
+	return func(_ context.Context, u *url.URL) (*Credentials, error) {
+		val := os.Getenv(prefix + envHostname(u.Hostname()))
+		if val == "" {
+			return nil, nil
+		}
+		if idx := strings.Index(val, ":"); idx >= 0 {
+			return &Credentials{
+				Username: val[:idx],
+				Password: val[idx+1:],
+				Token:    "",
+			}, nil
+		}
+		return &Credentials{
+			Username: "",
+			Password: "",
+			Token:    val,
+		}, nil
+	}
+}
+
+func envHostname(hostname string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z':
+			return r - 'a' + 'A'
+		case ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'):
+			return r
+		default:
+			return '_'
+		}
+	}, hostname)
+}
+
+// CommandCredentials returns a provider that runs an external command to get a token, such as
+// `gcloud auth print-access-token`, `aws codeartifact get-authorization-token --query
+// authorizationToken --output text`, a CI system's OIDC token exchange, or `keyring get`.  The
+// command's stdout (with surrounding whitespace trimmed) is used as the password with the given
+// username if username is non-empty, or else as a bearer token.  The request's hostname is passed
+// to the command as $OCIBUILD_INDEX_HOST.  The command is run at most once per hostname, and its
+// output is not logged.  It should usually be wrapped with ForHosts.
+func CommandCredentials(username string, cmdline ...string) CredentialProvider {
+	var (
+		mu    sync.Mutex
+		cache = make(map[string]*Credentials)
+	)
+	return func(ctx context.Context, u *url.URL) (*Credentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if creds, ok := cache[u.Hostname()]; ok {
+			return creds, nil
+		}
+
+		cmd := dexec.CommandContext(ctx, cmdline[0], cmdline[1:]...)
+		cmd.DisableLogging = true
+		cmd.Env = append(os.Environ(), "OCIBUILD_INDEX_HOST="+u.Hostname())
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", cmdline, err)
+		}
+		secret := strings.TrimSpace(string(out))
+		if secret == "" {
+			return nil, fmt.Errorf("%q: no output", cmdline)
+		}
+		creds := &Credentials{
+			Username: username,
+			Password: "",
+			Token:    "",
+		}
+		if username != "" {
+			creds.Password = secret
+		} else {
+			creds.Token = secret
+		}
+		cache[u.Hostname()] = creds
+		return creds, nil
+	}
+}
@@ -0,0 +1,98 @@
+package pep503_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+func TestNetrcCredentials(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), "netrc")
+	require.NoError(t, os.WriteFile(filename, []byte(""+
+		"# comment\n"+
+		"machine pkgs.example.com login alice password s3cret\n"+
+		"macdef init\n"+
+		"  cd /pub\n"+
+		"\n"+
+		"machine other.example.com\n"+
+		"  login bob\n"+
+		"  password hunter2\n"+
+		"default login anonymous password guest\n"+
+		"machine never.example.com login carol password unreachable\n"), 0o600))
+	provider := pep503.NetrcCredentials(filename)
+
+	testcases := map[string]pep503.Credentials{
+		"https://pkgs.example.com/simple/":       {Username: "alice", Password: "s3cret", Token: ""},
+		"https://other.example.com:8443/simple/": {Username: "bob", Password: "hunter2", Token: ""},
+		"https://never.example.com/simple/":      {Username: "anonymous", Password: "guest", Token: ""},
+	}
+	for tcName, tcData := range testcases {
+		tcName := tcName
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			u, err := url.Parse(tcName)
+			require.NoError(t, err)
+			creds, err := provider(context.Background(), u)
+			require.NoError(t, err)
+			require.NotNil(t, creds)
+			assert.Equal(t, tcData, *creds)
+		})
+	}
+
+	missing := pep503.NetrcCredentials(filepath.Join(t.TempDir(), "nonexistent"))
+	u, err := url.Parse("https://pkgs.example.com/simple/")
+	require.NoError(t, err)
+	creds, err := missing(context.Background(), u)
+	assert.NoError(t, err)
+	assert.Nil(t, creds)
+}
+
+func TestClientCredentials(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "aws" || pass != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`<a href="/files/example-1.0-py3-none-any.whl">example-1.0-py3-none-any.whl</a>`))
+	}))
+	t.Cleanup(srv.Close)
+	srvURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	client := pep503.Client{ //nolint:exhaustivestruct
+		BaseURL:    srv.URL + "/simple/",
+		HTTPClient: srv.Client(),
+	}
+	_, err = client.ListPackageFiles(context.Background(), "example")
+	var httpErr *pep503.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusUnauthorized, httpErr.StatusCode)
+
+	// Credentials scoped to a different host aren't sent.
+	client.Credentials = []pep503.CredentialProvider{
+		pep503.ForHosts(pep503.StaticCredentials(pep503.Credentials{Username: "aws", Password: "tok", Token: ""}),
+			"pkgs.example.com"),
+	}
+	_, err = client.ListPackageFiles(context.Background(), "example")
+	require.ErrorAs(t, err, &httpErr)
+
+	client.Credentials = append(client.Credentials,
+		pep503.ForHosts(pep503.StaticCredentials(pep503.Credentials{Username: "aws", Password: "tok", Token: ""}),
+			srvURL.Hostname()))
+	links, err := client.ListPackageFiles(context.Background(), "example")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "example-1.0-py3-none-any.whl", links[0].Text)
+}
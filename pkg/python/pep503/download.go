@@ -0,0 +1,472 @@
+package pep503
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/datawire/dlib/dlog"
+
+	"github.com/datawire/ocibuild/pkg/progress"
+)
+
+// DefaultSegmentSize is the size of the segments that a file is split in to for parallel and
+// resumable downloads, if Client.SegmentSize isn't set.
+const DefaultSegmentSize = 16 * 1024 * 1024
+
+// ErrFileChanged is returned if a file changes on the server partway through downloading it.
+var ErrFileChanged = errors.New("file changed on the server during the download")
+
+func (c Client) segmentSize() int64 {
+	if c.SegmentSize > 0 {
+		return c.SegmentSize
+	}
+	return DefaultSegmentSize
+}
+
+// fetch does the networking for .get(): it downloads the file at fileURL (which must not have a
+// fragment).  The caller must have already called c.fillDefaults().
+func (c Client) fetch(ctx context.Context, fileURL string) (*url.URL, []byte, error) {
+	if c.Connections > 1 || c.PartialDir != "" {
+		return c.fetchSegmented(ctx, fileURL)
+	}
+	return c.fetchWhole(ctx, fileURL)
+}
+
+// fetchWhole downloads a file with a single request; if the download fails partway through, then
+// it is resumed (up to c.Retries times), if the server supports that.
+func (c Client) fetchWhole(ctx context.Context, fileURL string) (*url.URL, []byte, error) {
+	req, err := c.newRequest(ctx, fileURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, nil, &HTTPError{Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+	body := &resumingReader{
+		ctx:       ctx,
+		client:    c,
+		url:       fileURL,
+		validator: resumeValidator(resp),
+		resp:      resp,
+		off:       0,
+		last:      -1,
+		retries:   c.Retries,
+	}
+	defer body.Close()
+	content, err := io.ReadAll(progress.NewReader(ctx, fileURL, resp.ContentLength, body))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Request.URL, content, nil
+}
+
+// resumeValidator returns the validator (a strong ETag, or else the Last-Modified time) to send
+// in the If-Range header of requests to resume the response, or "" if the response can't be
+// resumed.
+func resumeValidator(resp *http.Response) string {
+	if resp.Uncompressed {
+		// The transport decompressed it, so offsets in the body aren't offsets in the file.
+		return ""
+	}
+	if resp.StatusCode == http.StatusOK && resp.Header.Get("Accept-Ranges") != "bytes" {
+		return ""
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// getRange requests the bytes first through last (or through the end of the file, if last is -1)
+// of the file at fileURL, and checks that the server responded with that range of the same
+// version of the file (as identified by validator, which may be "" for the first request).  It
+// returns the response and the total size of the file.  If the server doesn't support Range
+// requests, it returns ErrNoRanges.
+func (c Client) getRange(
+	ctx context.Context,
+	fileURL, validator string,
+	first, last int64,
+) (*http.Response, int64, error) {
+	req, err := c.newRequest(ctx, fileURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	if last < 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", first))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	}
+	// Don't let the transport transparently decompress the response, as that would change the
+	// offsets.
+	req.Header.Set("Accept-Encoding", "identity")
+	if validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK && validator != "":
+		// The If-Range didn't match.
+		_ = resp.Body.Close()
+		return nil, 0, ErrFileChanged
+	case resp.StatusCode == http.StatusOK:
+		_ = resp.Body.Close()
+		return nil, 0, ErrNoRanges
+	case resp.StatusCode != http.StatusPartialContent:
+		_ = resp.Body.Close()
+		return nil, 0, &HTTPError{Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+	// Content-Range: bytes FIRST-LAST/SIZE
+	contentRange := resp.Header.Get("Content-Range")
+	var respFirst, respLast, size int64
+	_, err = fmt.Sscanf(contentRange, "bytes %d-%d/%d", &respFirst, &respLast, &size)
+	expectedLast := last
+	if last < 0 || last >= size {
+		expectedLast = size - 1
+	}
+	if err != nil || respFirst != first || respLast != expectedLast {
+		_ = resp.Body.Close()
+		return nil, 0, fmt.Errorf("invalid Content-Range for range %d-%d: %q", first, last, contentRange)
+	}
+	return resp, size, nil
+}
+
+// resumingReader reads a range of a remote file from an HTTP response body; if reading fails
+// partway through, then it requests the rest of the range and carries on, up to retries times.
+type resumingReader struct {
+	ctx       context.Context //nolint:containedctx // it's used for the requests to resume
+	client    Client
+	url       string
+	validator string // "" if the download can't be resumed
+	resp      *http.Response
+	off       int64 // the offset in the file of the next byte to read
+	last      int64 // the offset in the file of the last byte in the range, or -1 for EOF
+	retries   int
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	n, err := r.resp.Body.Read(p)
+	r.off += int64(n)
+	if errors.Is(err, io.EOF) && r.last >= 0 && r.off <= r.last {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil || errors.Is(err, io.EOF) || r.retries <= 0 || r.validator == "" || r.ctx.Err() != nil {
+		return n, err
+	}
+	r.retries--
+	_ = r.resp.Body.Close()
+	dlog.Warnf(r.ctx, "GET %q: resuming at byte %d after error: %v", r.url, r.off, err)
+	resp, _, resumeErr := r.client.getRange(r.ctx, r.url, r.validator, r.off, r.last)
+	if resumeErr != nil {
+		// Leave the old (closed) body in place for .Close().
+		return n, fmt.Errorf("%w (resuming: %v)", err, resumeErr) //nolint:errorlint // only wrap 1
+	}
+	r.resp = resp
+	return n, nil
+}
+
+func (r *resumingReader) Close() error {
+	return r.resp.Body.Close()
+}
+
+// fetchSegmented downloads a file as segments of c.segmentSize() bytes, using up to c.Connections
+// connections at once.  Each segment is resumed (up to c.Retries times) if it fails partway
+// through.  If c.PartialDir is set, then completed segments are saved there, so that if the
+// download fails, the next attempt only needs to fetch the missing segments.
+//
+// If the server doesn't support Range requests, then it falls back to fetchWhole.
+func (c Client) fetchSegmented(ctx context.Context, fileURL string) (*url.URL, []byte, error) {
+	segSize := c.segmentSize()
+
+	// Request the first segment; this tells us whether the server supports Range requests,
+	// and the size of the file.
+	firstResp, size, err := c.getRange(ctx, fileURL, "", 0, segSize-1)
+	var httpErr *HTTPError
+	switch {
+	case errors.Is(err, ErrNoRanges),
+		errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The server doesn't support Range requests, or the file is empty.
+		return c.fetchWhole(ctx, fileURL)
+	case err != nil:
+		return nil, nil, err
+	}
+	location := firstResp.Request.URL
+	validator := resumeValidator(firstResp)
+
+	numSegs := int((size + segSize - 1) / segSize)
+	content := make([]byte, size)
+	done := make([]bool, numSegs)
+	segment := func(i int) []byte {
+		end := int64(i+1) * segSize
+		if end > size {
+			end = size
+		}
+		return content[int64(i)*segSize : end]
+	}
+
+	var partial *partialDownload
+	if c.PartialDir != "" && validator != "" && numSegs > 1 {
+		partial, err = openPartial(c.PartialDir, fileURL, validator, size, segSize, numSegs)
+		if err != nil {
+			dlog.Warnf(ctx, "GET %q: not saving partial download: %v", fileURL, err)
+			partial = nil
+		} else if resumed := partial.load(segment, done); resumed > 0 {
+			dlog.Infof(ctx, "GET %q: resuming partial download; have %d of %d segments",
+				fileURL, resumed, numSegs)
+		}
+	}
+
+	progress.Report(ctx, progress.Event{ //nolint:exhaustivestruct
+		Kind:  progress.DownloadStarted,
+		Name:  fileURL,
+		Total: size,
+	})
+	var received int64
+	for i := range done {
+		if done[i] {
+			received += int64(len(segment(i)))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		errMu    sync.Mutex
+		firstErr error
+	)
+	fetchSegment := func(i int, resp *http.Response) error {
+		off := int64(i) * segSize
+		buf := segment(i)
+		if resp == nil {
+			var err error
+			resp, _, err = c.getRange(ctx, fileURL, validator, off, off+int64(len(buf))-1)
+			if err != nil {
+				return err
+			}
+		}
+		body := &resumingReader{
+			ctx:       ctx,
+			client:    c,
+			url:       fileURL,
+			validator: validator,
+			resp:      resp,
+			off:       off,
+			last:      off + int64(len(buf)) - 1,
+			retries:   c.Retries,
+		}
+		defer body.Close()
+		if _, err := io.ReadFull(body, buf); err != nil {
+			return err
+		}
+		if partial != nil {
+			if err := partial.save(i, buf); err != nil {
+				dlog.Warnf(ctx, "GET %q: saving partial download: %v", fileURL, err)
+			}
+		}
+		progress.Report(ctx, progress.Event{ //nolint:exhaustivestruct
+			Kind:  progress.DownloadProgress,
+			Name:  fileURL,
+			Bytes: atomic.AddInt64(&received, int64(len(buf))),
+			Total: size,
+		})
+		return nil
+	}
+
+	jobs := make(chan int)
+	numWorkers := c.Connections
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var resp *http.Response
+				if i == 0 {
+					resp = firstResp
+				}
+				if err := fetchSegment(i, resp); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+	func() {
+		defer close(jobs)
+		for i := range done {
+			if done[i] {
+				if i == 0 {
+					_ = firstResp.Body.Close()
+				}
+				continue
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				if i == 0 {
+					_ = firstResp.Body.Close()
+				}
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if partial != nil {
+		partial.remove()
+	}
+	progress.Report(ctx, progress.Event{ //nolint:exhaustivestruct
+		Kind:  progress.DownloadFinished,
+		Name:  fileURL,
+		Bytes: size,
+	})
+	return location, content, nil
+}
+
+// partialState is the JSON-encoded state of a partial download, stored next to the partial file.
+type partialState struct {
+	URL         string `json:"url"`
+	Validator   string `json:"validator"`
+	Size        int64  `json:"size"`
+	SegmentSize int64  `json:"segmentSize"`
+	// Segments is the "sha256:HEXDIGEST" of each segment that has been written to the partial
+	// file, or "" for each segment that hasn't.
+	Segments []string `json:"segments"`
+}
+
+// partialDownload is a partially-downloaded file in a Client.PartialDir: the segments that have
+// been downloaded so far are written in to "{key}.part" at their offsets, and their digests are
+// recorded in "{key}.json", so that they can be verified before being used to resume.
+type partialDownload struct {
+	dataFilename  string
+	stateFilename string
+
+	mu    sync.Mutex
+	state partialState
+}
+
+func openPartial(dir, fileURL, validator string, size, segSize int64, numSegs int) (*partialDownload, error) {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(fileURL))
+	key := hex.EncodeToString(sum[:])
+	ret := &partialDownload{ //nolint:exhaustivestruct // mu
+		dataFilename:  filepath.Join(dir, key+".part"),
+		stateFilename: filepath.Join(dir, key+".json"),
+		state: partialState{
+			URL:         fileURL,
+			Validator:   validator,
+			Size:        size,
+			SegmentSize: segSize,
+			Segments:    make([]string, numSegs),
+		},
+	}
+	var old partialState
+	if bs, err := os.ReadFile(ret.stateFilename); err == nil && json.Unmarshal(bs, &old) == nil &&
+		old.URL == fileURL && old.Validator == validator && old.Size == size &&
+		old.SegmentSize == segSize && len(old.Segments) == numSegs {
+		ret.state.Segments = old.Segments
+	} else {
+		_ = os.Remove(ret.dataFilename)
+	}
+	return ret, nil
+}
+
+// load reads the previously-downloaded segments in to their place in the content, and marks them
+// as done; segments whose digest doesn't match are forgotten.  It returns the number of segments
+// loaded.
+func (p *partialDownload) load(segment func(int) []byte, done []bool) int {
+	file, err := os.Open(p.dataFilename)
+	if err != nil {
+		return 0
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	cnt := 0
+	for i, digest := range p.state.Segments {
+		if digest == "" {
+			continue
+		}
+		buf := segment(i)
+		if _, err := file.ReadAt(buf, int64(i)*p.state.SegmentSize); err == nil && segmentDigest(buf) == digest {
+			done[i] = true
+			cnt++
+		} else {
+			p.state.Segments[i] = ""
+		}
+	}
+	return cnt
+}
+
+// save writes a completed segment to the partial file, and then records it in the state file.
+func (p *partialDownload) save(i int, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	file, err := os.OpenFile(p.dataFilename, os.O_WRONLY|os.O_CREATE, 0o666)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(data, int64(i)*p.state.SegmentSize); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	p.state.Segments[i] = segmentDigest(data)
+	bs, err := json.Marshal(p.state)
+	if err != nil {
+		return err
+	}
+	tmpFilename := p.stateFilename + ".tmp" + strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(tmpFilename, bs, 0o666); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, p.stateFilename)
+}
+
+// remove removes the partial download, once it has been completed.
+func (p *partialDownload) remove() {
+	_ = os.Remove(p.stateFilename)
+	_ = os.Remove(p.dataFilename)
+}
+
+func segmentDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,192 @@
+package pep503_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+// flakyServer serves a single file with support for Range requests, and can be told to fail
+// requests partway through.
+type flakyServer struct {
+	content []byte
+
+	mu sync.Mutex
+	// failAt makes the next request whose response would include the byte at the given offset
+	// fail just before that byte; it is reset after each failure.
+	failAt int64
+	// ranges is the Range header of each request.
+	ranges []string
+}
+
+func newFlakyServer(t *testing.T, size int) (*flakyServer, *httptest.Server) {
+	t.Helper()
+	content := make([]byte, size)
+	rand.New(rand.NewSource(0)).Read(content) //nolint:gosec // not security-sensitive
+	fs := &flakyServer{content: content, failAt: -1}
+	srv := httptest.NewServer(fs)
+	t.Cleanup(srv.Close)
+	return fs, srv
+}
+
+func (fs *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	fs.ranges = append(fs.ranges, r.Header.Get("Range"))
+	failAt := fs.failAt
+	fs.mu.Unlock()
+
+	w.Header().Set("ETag", `"v1"`)
+	first, last := int64(0), int64(len(fs.content)-1)
+	if rng := r.Header.Get("Range"); rng != "" {
+		// Let http.ServeContent parse the Range header for us.
+		rec := httptest.NewRecorder()
+		rec.Header().Set("ETag", `"v1"`)
+		http.ServeContent(rec, r, "", time.Time{}, bytes.NewReader(fs.content))
+		if rec.Code == http.StatusPartialContent {
+			var size int64
+			if _, err := fmt.Sscanf(rec.Header().Get("Content-Range"), "bytes %d-%d/%d",
+				&first, &last, &size); err != nil {
+				panic(err)
+			}
+		}
+	}
+	if failAt < first || failAt > last {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(fs.content))
+		return
+	}
+	fs.mu.Lock()
+	fs.failAt = -1
+	fs.mu.Unlock()
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.FormatInt(last-first+1, 10))
+	if first != 0 || last != int64(len(fs.content)-1) {
+		w.Header().Set("Content-Range", "bytes "+strconv.FormatInt(first, 10)+"-"+
+			strconv.FormatInt(last, 10)+"/"+strconv.Itoa(len(fs.content)))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	_, _ = w.Write(fs.content[first:failAt])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func (fs *flakyServer) setFailAt(off int64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.failAt = off
+}
+
+func (fs *flakyServer) takeRanges() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	ret := fs.ranges
+	fs.ranges = nil
+	return ret
+}
+
+func (fs *flakyServer) url(srv *httptest.Server) string {
+	sum := sha256.Sum256(fs.content)
+	return srv.URL + "/example-1.0-py3-none-any.whl#sha256=" + hex.EncodeToString(sum[:])
+}
+
+func TestDownloadResume(t *testing.T) {
+	t.Parallel()
+	fs, srv := newFlakyServer(t, 10000)
+	client := pep503.Client{ //nolint:exhaustivestruct
+		HTTPClient: srv.Client(),
+	}
+
+	// Without retries, a failure is an error.
+	fs.setFailAt(4000)
+	_, err := client.Get(context.Background(), fs.url(srv))
+	assert.Error(t, err)
+	fs.takeRanges()
+
+	// With retries, the download resumes from where it failed.
+	client.Retries = 1
+	fs.setFailAt(4000)
+	content, err := client.Get(context.Background(), fs.url(srv))
+	require.NoError(t, err)
+	assert.Equal(t, fs.content, content)
+	assert.Equal(t, []string{"", "bytes=4000-"}, fs.takeRanges())
+}
+
+func TestDownloadSegmented(t *testing.T) {
+	t.Parallel()
+	fs, srv := newFlakyServer(t, 10000)
+	client := pep503.Client{ //nolint:exhaustivestruct
+		HTTPClient:  srv.Client(),
+		Connections: 4,
+		SegmentSize: 1000,
+		Retries:     1,
+	}
+
+	fs.setFailAt(5500)
+	content, err := client.Get(context.Background(), fs.url(srv))
+	require.NoError(t, err)
+	assert.Equal(t, fs.content, content)
+	ranges := fs.takeRanges()
+	assert.Len(t, ranges, 11)
+	assert.Contains(t, ranges, "bytes=5000-5999")
+	assert.Contains(t, ranges, "bytes=5500-5999")
+
+	// The overall hash is still verified.
+	_, err = client.Get(context.Background(), srv.URL+"/example-1.0-py3-none-any.whl#sha256=00")
+	assert.ErrorIs(t, err, python.ErrHashMismatch)
+}
+
+func TestDownloadPartialDir(t *testing.T) {
+	t.Parallel()
+	fs, srv := newFlakyServer(t, 10000)
+	partialDir := t.TempDir()
+	client := pep503.Client{ //nolint:exhaustivestruct
+		HTTPClient:  srv.Client(),
+		SegmentSize: 1000,
+		PartialDir:  partialDir,
+	}
+
+	// The first attempt fails in the 4th segment, leaving the first 3 segments behind.
+	fs.setFailAt(3500)
+	_, err := client.Get(context.Background(), fs.url(srv))
+	require.Error(t, err)
+	fs.takeRanges()
+	parts, err := filepath.Glob(filepath.Join(partialDir, "*.part"))
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+
+	// Corrupt the 2nd segment; it should get downloaded again.
+	partFile, err := os.OpenFile(parts[0], os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = partFile.WriteAt([]byte("corrupt"), 1500)
+	require.NoError(t, err)
+	require.NoError(t, partFile.Close())
+
+	content, err := client.Get(context.Background(), fs.url(srv))
+	require.NoError(t, err)
+	assert.Equal(t, fs.content, content)
+	ranges := fs.takeRanges()
+	assert.Contains(t, ranges, "bytes=1000-1999")
+	assert.NotContains(t, ranges, "bytes=2000-2999")
+	assert.Contains(t, ranges, "bytes=3000-3999")
+
+	// The partial download is removed once it completes.
+	leftover, err := os.ReadDir(partialDir)
+	require.NoError(t, err)
+	assert.Empty(t, leftover)
+}
@@ -0,0 +1,127 @@
+package pep503_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+func TestGetMetadata(t *testing.T) {
+	t.Parallel()
+	const metadata = "Metadata-Version: 2.1\nName: example\nVersion: 1.0\n"
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(metadata)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/simple/example":
+			_, _ = fmt.Fprintf(w, ``+
+				`<a href="/files/example-1.0-py3-none-any.whl#sha256=00">example-1.0-py3-none-any.whl</a>`+
+				`<a href="/files/example-2.0-py3-none-any.whl" data-core-metadata="sha256=%s">`+
+				`example-2.0-py3-none-any.whl</a>`+
+				`<a href="/files/example-3.0-py3-none-any.whl" data-dist-info-metadata="true">`+
+				`example-3.0-py3-none-any.whl</a>`+
+				`<a href="/files/example-4.0-py3-none-any.whl" data-core-metadata="sha256=00">`+
+				`example-4.0-py3-none-any.whl</a>`,
+				sum)
+		case "/files/example-2.0-py3-none-any.whl.metadata",
+			"/files/example-3.0-py3-none-any.whl.metadata",
+			"/files/example-4.0-py3-none-any.whl.metadata":
+			_, _ = w.Write([]byte(metadata))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := pep503.Client{ //nolint:exhaustivestruct
+		BaseURL:    srv.URL + "/simple/",
+		HTTPClient: srv.Client(),
+	}
+	links, err := client.ListPackageFiles(context.Background(), "example")
+	require.NoError(t, err)
+	require.Len(t, links, 4)
+
+	// no metadata
+	assert.Equal(t, "", links[0].MetadataAttr())
+	_, err = links[0].GetMetadata(context.Background())
+	assert.ErrorIs(t, err, pep503.ErrNoMetadata)
+
+	// data-core-metadata, with a hash
+	content, err := links[1].GetMetadata(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, metadata, string(content))
+
+	// data-dist-info-metadata, without a hash
+	assert.Equal(t, "true", links[2].MetadataAttr())
+	content, err = links[2].GetMetadata(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, metadata, string(content))
+
+	// hash mismatch
+	_, err = links[3].GetMetadata(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestClientGet(t *testing.T) {
+	t.Parallel()
+	const content = "not really a wheel"
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := pep503.Client{ //nolint:exhaustivestruct
+		HTTPClient: srv.Client(),
+	}
+	got, err := client.Get(context.Background(), srv.URL+"/example-1.0-py3-none-any.whl#sha256="+sum)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(got))
+
+	_, err = client.Get(context.Background(), srv.URL+"/example-1.0-py3-none-any.whl#sha256=00")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+	assert.ErrorIs(t, err, python.ErrHashMismatch)
+}
+
+func TestErrNotFound(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case "/simple/gone":
+			http.Error(w, "gone", http.StatusGone)
+		case "/simple/broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := pep503.Client{ //nolint:exhaustivestruct
+		BaseURL:    srv.URL + "/simple/",
+		HTTPClient: srv.Client(),
+	}
+	for pkgname, expected := range map[string]bool{
+		"missing": true,
+		"gone":    true,
+		"broken":  false,
+	} {
+		_, err := client.ListPackageFiles(context.Background(), pkgname)
+		require.Error(t, err, pkgname)
+		var httpErr *pep503.HTTPError
+		assert.True(t, errors.As(err, &httpErr), pkgname)
+		assert.Equal(t, expected, errors.Is(err, pep503.ErrNotFound), pkgname)
+	}
+}
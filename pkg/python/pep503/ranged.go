@@ -0,0 +1,196 @@
+package pep503
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoRanges is returned by Client.OpenZip if the server doesn't support HTTP Range requests for
+// the file.
+var ErrNoRanges = errors.New("server does not support range requests")
+
+// rangeChunkSize is the minimum number of bytes to request at once.  The zip central directory is
+// at the end of the file, so the first request (for the last rangeChunkSize bytes) usually gets
+// all of it; and .dist-info files are usually small enough that one more request gets each of
+// them.
+const rangeChunkSize = 64 * 1024
+
+// OpenZip opens a remote zip archive (such as a wheel) for reading, without downloading all of
+// it: HTTP Range requests are used to fetch the archive's central directory and then only the
+// members that are actually read.  This allows inspecting a wheel's .dist-info files when the
+// index server doesn't serve the metadata separately (see FileLink.GetMetadata).  It also
+// returns the total size of the archive.
+//
+// If the server doesn't support Range requests, then ErrNoRanges is returned, and the caller
+// should fall back to downloading the whole file.  Because the whole file is never read, a
+// "#sha256=HEXDIGEST" fragment on fileURL is NOT verified.
+//
+// The context is used for all requests made while reading from the returned zip.Reader.
+func (c Client) OpenZip(ctx context.Context, fileURL string) (*zip.Reader, int64, error) {
+	if i := strings.Index(fileURL, "#"); i >= 0 {
+		fileURL = fileURL[:i]
+	}
+	c.fillDefaults()
+	reader := &rangeReader{ //nolint:exhaustivestruct // filled in by .init()
+		ctx:    ctx,
+		client: c,
+		url:    fileURL,
+	}
+	if err := reader.init(); err != nil {
+		return nil, 0, fmt.Errorf("GET %q => %w", fileURL, err)
+	}
+	zipReader, err := zip.NewReader(reader, reader.size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", fileURL, err)
+	}
+	return zipReader, reader.size, nil
+}
+
+// OpenZip is like Client.OpenZip, for the link's file.
+func (l FileLink) OpenZip(ctx context.Context) (*zip.Reader, int64, error) {
+	return l.client.OpenZip(ctx, l.HRef)
+}
+
+// rangeReader is an io.ReaderAt for a remote file, implemented with HTTP Range requests.
+type rangeReader struct {
+	ctx    context.Context
+	client Client
+	url    string
+
+	size int64
+	etag string
+
+	mu     sync.Mutex
+	chunks []rangeChunk
+}
+
+type rangeChunk struct {
+	off  int64
+	data []byte
+}
+
+// init fetches the last rangeChunkSize bytes of the file, which tells us the file's size.
+func (r *rangeReader) init() error {
+	resp, err := r.do("-" + strconv.Itoa(rangeChunkSize))
+	if err != nil {
+		return err
+	}
+	r.etag = resp.Header.Get("ETag")
+	if strings.HasPrefix(r.etag, "W/") {
+		// A weak ETag can't be used with If-Match.
+		r.etag = ""
+	}
+	return r.addChunk(resp)
+}
+
+// do makes a request for the given byte range (in the syntax of the HTTP Range header, without
+// the "bytes=" prefix), and checks that the server responded with partial content.
+func (r *rangeReader) do(byteRange string) (*http.Response, error) {
+	req, err := r.client.newRequest(r.ctx, r.url)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+byteRange)
+	// Don't let the transport transparently decompress the response, as that would change the
+	// offsets.
+	req.Header.Set("Accept-Encoding", "identity")
+	if r.etag != "" {
+		// Make sure that the file doesn't change out from under us.
+		req.Header.Set("If-Match", r.etag)
+	}
+	resp, err := r.client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp, nil
+	case http.StatusOK:
+		_ = resp.Body.Close()
+		return nil, ErrNoRanges
+	default:
+		_ = resp.Body.Close()
+		return nil, &HTTPError{Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+}
+
+// addChunk reads a 206 response in to the chunk cache, and sets r.size from its Content-Range.
+func (r *rangeReader) addChunk(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	// Content-Range: bytes FIRST-LAST/SIZE
+	contentRange := resp.Header.Get("Content-Range")
+	var first, last, size int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &first, &last, &size); err != nil {
+		return fmt.Errorf("invalid Content-Range: %q: %w", contentRange, err)
+	}
+	if first > last || last >= size || (r.size != 0 && size != r.size) {
+		return fmt.Errorf("invalid Content-Range: %q", contentRange)
+	}
+	data := make([]byte, last-first+1)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return err
+	}
+	r.size = size
+	r.chunks = append(r.chunks, rangeChunk{off: first, data: data})
+	return nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("pep503.rangeReader.ReadAt: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off+int64(n) < r.size {
+		pos := off + int64(n)
+		chunk := r.findChunk(pos)
+		if chunk == nil {
+			end := pos + int64(len(p)-n)
+			if end < pos+rangeChunkSize {
+				end = pos + rangeChunkSize
+			}
+			if end > r.size {
+				end = r.size
+			}
+			resp, err := r.do(fmt.Sprintf("%d-%d", pos, end-1))
+			if err != nil {
+				return n, fmt.Errorf("GET %q => %w", r.url, err)
+			}
+			if err := r.addChunk(resp); err != nil {
+				return n, fmt.Errorf("GET %q => %w", r.url, err)
+			}
+			if chunk = r.findChunk(pos); chunk == nil {
+				return n, fmt.Errorf("GET %q => server responded with the wrong range", r.url)
+			}
+		}
+		n += copy(p[n:], chunk.data[pos-chunk.off:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// findChunk returns the cached chunk containing the byte at off, or nil.
+func (r *rangeReader) findChunk(off int64) *rangeChunk {
+	for i := range r.chunks {
+		if chunk := &r.chunks[i]; chunk.off <= off && off < chunk.off+int64(len(chunk.data)) {
+			return chunk
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package pep503_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+func TestOpenZip(t *testing.T) {
+	t.Parallel()
+
+	// A "wheel" with a big incompressible file in it, that we shouldn't have to download.
+	const metadata = "Metadata-Version: 2.1\nName: example\nVersion: 1.0\n"
+	big := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0)).Read(big) //nolint:gosec // not security-sensitive
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name    string
+		content []byte
+	}{
+		{"example/big.bin", big},
+		{"example-1.0.dist-info/METADATA", []byte(metadata)},
+	} {
+		w, err := zipWriter.Create(file.name)
+		require.NoError(t, err)
+		_, err = w.Write(file.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zipWriter.Close())
+	wheel := buf.Bytes()
+
+	var served int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ranges/example-1.0-py3-none-any.whl":
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(countingResponseWriter{w, &served}, r, "", time.Time{}, bytes.NewReader(wheel))
+		case "/noranges/example-1.0-py3-none-any.whl":
+			_, _ = w.Write(wheel)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client := pep503.Client{ //nolint:exhaustivestruct
+		HTTPClient: srv.Client(),
+	}
+
+	zipReader, size, err := client.OpenZip(context.Background(),
+		srv.URL+"/ranges/example-1.0-py3-none-any.whl#sha256=00")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(wheel)), size)
+	require.Len(t, zipReader.File, 2)
+	file, err := zipReader.File[1].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, metadata, string(content))
+	assert.Less(t, atomic.LoadInt64(&served), int64(len(big)/4))
+
+	// Reading the big file still works.
+	file, err = zipReader.File[0].Open()
+	require.NoError(t, err)
+	content, err = io.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, big, content)
+
+	_, _, err = client.OpenZip(context.Background(), srv.URL+"/noranges/example-1.0-py3-none-any.whl")
+	assert.ErrorIs(t, err, pep503.ErrNoRanges)
+
+	_, _, err = client.OpenZip(context.Background(), srv.URL+"/missing/example-1.0-py3-none-any.whl")
+	var httpErr *pep503.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,29 @@
+package pep503
+
+import (
+	"fmt"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+// HaveRequiredPython returns whether the Python version `have` satisfies the `requiresPython`
+// value of a link's "data-requires-python" attribute (which is the file's "Requires-Python"
+// metadata).
+//
+// The value is evaluated as a full PEP 440 version specifier, so real-world values such as
+// ">=2.7, !=3.0.*, !=3.1.*, <4" and "~=3.6" work.  Like pip, only the release segment of `have`
+// is considered; a pre-release interpreter such as 3.11.0rc1 is treated as 3.11.0, so that it
+// satisfies ">=3.11" rather than being excluded by the pre-release rules.
+func HaveRequiredPython(have pep440.Version, requiresPython string) (bool, error) {
+	spec, err := pep440.ParseSpecifier(requiresPython)
+	if err != nil {
+		return false, fmt.Errorf("pep503.HaveRequiredPython: %w", err)
+	}
+	release := pep440.Version{ //nolint:exhaustivestruct
+		PublicVersion: pep440.PublicVersion{ //nolint:exhaustivestruct
+			Epoch:   have.Epoch,
+			Release: have.Release,
+		},
+	}
+	return spec.Match(release), nil
+}
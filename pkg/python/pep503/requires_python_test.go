@@ -0,0 +1,106 @@
+package pep503_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+func TestHaveRequiredPython(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		InputPy   string
+		InputReq  string
+		OutputVal bool
+		OutputErr string
+	}
+	testcases := []TestCase{
+		// Values seen in the wild on PyPI.
+		{"2.7.18", ">=2.7,!=3.0.*,!=3.1.*", true, ""},
+		{"3.0.1", ">=2.7,!=3.0.*,!=3.1.*", false, ""},
+		{"3.1", ">=2.7,!=3.0.*,!=3.1.*", false, ""},
+		{"3.2.0", ">=2.7,!=3.0.*,!=3.1.*", true, ""},
+		{"3.3.7", ">=2.7, !=3.0.*, !=3.1.*, !=3.2.*, !=3.3.*, <4", false, ""},
+		{"3.9.2", ">=2.7, !=3.0.*, !=3.1.*, !=3.2.*, !=3.3.*, <4", true, ""},
+		{"4.0", ">=2.7, !=3.0.*, !=3.1.*, !=3.2.*, !=3.3.*, <4", false, ""},
+		{"3.9.2", ">= 3.6", true, ""},
+		{"3.9.2", " >=3.6 , <3.10 ", true, ""},
+		{"3.10.0", " >=3.6 , <3.10 ", false, ""},
+		{"3.9.2", ">=3.6,", true, ""},
+		{"3.6.15", "~=3.6", true, ""},
+		{"3.11.4", "~=3.6", true, ""},
+		{"4.0", "~=3.6", false, ""},
+		{"3.6.15", "~=3.6.0", true, ""},
+		{"3.7.0", "~=3.6.0", false, ""},
+		{"3.8.10", "==3.8.*", true, ""},
+		{"3.9.0", "==3.8.*", false, ""},
+		{"3.6.0", ">3.5", true, ""},
+		{"3.5.2", ">3.5", true, ""},
+		{"3.5.0", ">3.5", false, ""},
+		{"2.7.18", "", true, ""},
+
+		// A pre-release interpreter is treated as its final release.
+		{"3.11.0rc1", ">=3.11", true, ""},
+		{"3.11.0a7", "<3.11", false, ""},
+		{"3.6.0rc1", ">3.5", true, ""},
+		{"3.13.0b1", "==3.13.*", true, ""},
+
+		// Operator soup that isn't valid PEP 440.
+		{"3.9.2", "3.6", false, `pep503.HaveRequiredPython: pep440.ParseSpecifier: invalid comparison operator: "3.6"`},                //nolint:lll
+		{"3.9.2", ">=3.6.*", false, `pep503.HaveRequiredPython: pep440.ParseSpecifier: pep440.ParseVersion: invalid version: "3.6.*"`}, //nolint:lll
+		{"3.9.2", "=>3.6", false, `pep503.HaveRequiredPython: pep440.ParseSpecifier: invalid comparison operator: "=>3.6"`},            //nolint:lll
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.InputPy+"::"+tc.InputReq, func(t *testing.T) {
+			t.Parallel()
+			py, err := pep440.ParseVersion(tc.InputPy)
+			require.NoError(t, err)
+			have, err := pep503.HaveRequiredPython(*py, tc.InputReq)
+			if tc.OutputErr != "" {
+				assert.EqualError(t, err, tc.OutputErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.OutputVal, have)
+			}
+		})
+	}
+}
+
+func TestListPackageFilesRequiresPython(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, ``+
+			`<a href="/files/example-1.0-py2.py3-none-any.whl" `+
+			`data-requires-python="&gt;=2.7,!=3.0.*,!=3.1.*">example-1.0-py2.py3-none-any.whl</a>`+
+			`<a href="/files/example-2.0-py3-none-any.whl" `+
+			`data-requires-python="&gt;=3.10">example-2.0-py3-none-any.whl</a>`+
+			`<a href="/files/example-3.0-py3-none-any.whl" `+
+			`data-requires-python="&gt;=3.6.*">example-3.0-py3-none-any.whl</a>`)
+	}))
+	t.Cleanup(srv.Close)
+
+	py, err := pep440.ParseVersion("3.9.0rc2")
+	require.NoError(t, err)
+	client := pep503.Client{ //nolint:exhaustivestruct
+		BaseURL:    srv.URL + "/simple/",
+		HTTPClient: srv.Client(),
+		Python:     py,
+	}
+	links, err := client.ListPackageFiles(context.Background(), "example")
+	require.NoError(t, err)
+	var names []string
+	for _, link := range links {
+		names = append(names, link.Text)
+	}
+	// 2.0 requires a newer Python; 3.0's value is unparsable, so it is kept.
+	assert.Equal(t, []string{"example-1.0-py2.py3-none-any.whl", "example-3.0-py3-none-any.whl"}, names)
+}
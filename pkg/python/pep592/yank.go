@@ -36,5 +36,10 @@ func ExcludeYanked(links []pep503.FileLink) pep440.ExclusionBehavior {
 
 func (e excludeYanked) Allow(v pep440.Version) bool {
 	_, yanked := e.yankedVersions[v.String()]
-	return yanked
+	return !yanked
+}
+
+// Explain implements pep440.ExclusionExplainer.
+func (e excludeYanked) Explain(_ pep440.Version) string {
+	return "yanked"
 }
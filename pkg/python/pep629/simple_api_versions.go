@@ -7,11 +7,11 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/datawire/dlib/dlog"
 	"golang.org/x/net/html"
 
 	"github.com/datawire/ocibuild/pkg/htmlutil"
 	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/warnings"
 )
 
 //nolint:gochecknoglobals // Would be 'const'.
@@ -52,7 +52,8 @@ func HTMLVersionCheck(ctx context.Context, doc *html.Node) error {
 		return fmt.Errorf("server's pypi:repository version (%s) is not compatible with this client", version)
 	}
 	if version.Minor() > SupportedVersion.Minor() {
-		dlog.Warnf(ctx, "server's pypi:repository version (%s) is newer than this client", version)
+		return warnings.Warnf(ctx, warnings.RepositoryVersion,
+			"server's pypi:repository version (%s) is newer than this client", version)
 	}
 	return nil
 }
@@ -0,0 +1,141 @@
+// Package pep668 implements PEP 668 -- Marking Python base environments as "externally managed".
+//
+// https://peps.python.org/pep-0668/
+package pep668
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// Filename is the name of the marker file, which is in the interpreter's "stdlib" directory (per
+// `sysconfig.get_path("stdlib")`).
+const Filename = "EXTERNALLY-MANAGED"
+
+// OverrideFilename is the name of the file that RecordOverride adds to the ".dist-info" directory
+// of a package that was installed in to an externally-managed environment anyway.  This is not
+// part of PEP 668; it is so that the override can be noticed later.
+const OverrideFilename = "EXTERNALLY-MANAGED-OVERRIDE"
+
+// DefaultVenvRoot is where PolicyVenv puts the virtual environment, if no other location is given.
+const DefaultVenvRoot = "/opt/venv"
+
+// defaultError is the message to use if the marker file doesn't specify one; this is the message
+// that pip uses.
+const defaultError = "The Python environment is managed externally, and may not be manipulated by " +
+	"the user.  Please use specific tooling from the distributor of the Python installation to " +
+	"interact with this environment instead."
+
+// ErrExternallyManaged is returned (wrapped) by Check for an externally-managed platform.
+var ErrExternallyManaged = errors.New("externally-managed-environment")
+
+// Parse parses an "EXTERNALLY-MANAGED" file, returning the error message that it specifies (or a
+// generic message, if it doesn't specify one).  Localized messages ("Error-{locale}" keys) are
+// ignored.
+func Parse(r io.Reader) (string, error) {
+	parser := python.NewConfigParser()
+	parser.Strict = false
+	config, err := parser.Parse(r)
+	if err != nil {
+		return "", fmt.Errorf("pep668.Parse: %w", err)
+	}
+	if msg := config["externally-managed"]["error"]; msg != "" {
+		return msg, nil
+	}
+	return defaultError, nil
+}
+
+// A Policy says what to do when installing in to an externally-managed platform.
+//
+// Policy implements pflag.Value, so it may be used directly as a command-line flag.
+type Policy int
+
+const (
+	// PolicyError refuses to install.  This is the zero value.
+	PolicyError Policy = iota
+	// PolicyVenv installs in to a virtual environment (PEP 405) instead.
+	PolicyVenv
+	// PolicyOverride installs anyway (like pip's --break-system-packages), and records that it
+	// did so with RecordOverride.
+	PolicyOverride
+)
+
+// String implements pflag.Value.
+func (p Policy) String() string {
+	switch p {
+	case PolicyError:
+		return "error"
+	case PolicyVenv:
+		return "venv"
+	case PolicyOverride:
+		return "override"
+	default:
+		return fmt.Sprintf("Policy(%d)", int(p))
+	}
+}
+
+// Set implements pflag.Value.
+func (p *Policy) Set(str string) error {
+	for _, policy := range []Policy{PolicyError, PolicyVenv, PolicyOverride} {
+		if str == policy.String() {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid externally-managed policy %q: must be one of \"error\", \"venv\", or \"override\"",
+		str)
+}
+
+// Type implements pflag.Value.
+func (Policy) Type() string {
+	return "policy"
+}
+
+// Check returns an error wrapping ErrExternallyManaged if plat is externally managed (and isn't a
+// virtual environment), and the policy is PolicyError.  For the other policies, it is up to the
+// caller to act on the policy: to call python.Platform.WithVenv for PolicyVenv, or to use
+// RecordOverride for PolicyOverride.
+func Check(plat python.Platform, policy Policy) error {
+	if plat.ExternallyManaged == "" || plat.Venv != nil || policy != PolicyError {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrExternallyManaged, plat.ExternallyManaged)
+}
+
+// RecordOverride returns a PostInstallHook that records that the package was installed in to an
+// externally-managed platform anyway, by adding an OverrideFilename file to the ".dist-info"
+// directory.  It should run before recording_installs.Record, so that the file is included in the
+// RECORD.
+func RecordOverride() bdist.PostInstallHook {
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		vfs map[string]fsutil.FileReference,
+		installedDistInfoDir string,
+	) error {
+		content := []byte("# Installed despite the environment being marked as externally managed (PEP 668)\n")
+		fullname := path.Join(installedDistInfoDir, OverrideFilename)
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     fullname,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			ModTime:  clampTime,
+		}
+		vfs[fullname] = &fsutil.InMemFileReference{
+			FileInfo:  header.FileInfo(),
+			MFullName: fullname,
+			MContent:  content,
+		}
+		return nil
+	}
+}
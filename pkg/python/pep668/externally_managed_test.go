@@ -0,0 +1,65 @@
+package pep668_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep668"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Input  string
+		Output string
+	}{
+		"debian": {
+			Input: "[externally-managed]\n" +
+				"Error=To install Python packages system-wide, try apt install\n" +
+				" python3-xyz, where xyz is the package you are trying to\n" +
+				" install.\n" +
+				"Error-de_DE=Lokalisiert\n",
+			Output: "To install Python packages system-wide, try apt install\n" +
+				"python3-xyz, where xyz is the package you are trying to\n" +
+				"install.",
+		},
+		"no-message": {
+			Input: "[externally-managed]\n",
+		},
+		"empty": {
+			Input: "",
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			msg, err := pep668.Parse(strings.NewReader(tcData.Input))
+			require.NoError(t, err)
+			if tcData.Output == "" {
+				assert.NotEmpty(t, msg)
+			} else {
+				assert.Equal(t, tcData.Output, msg)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	plat := python.Platform{ExternallyManaged: "go away"} //nolint:exhaustivestruct
+	err := pep668.Check(plat, pep668.PolicyError)
+	assert.True(t, errors.Is(err, pep668.ErrExternallyManaged))
+	assert.NoError(t, pep668.Check(plat, pep668.PolicyOverride))
+	assert.NoError(t, pep668.Check(plat, pep668.PolicyVenv))
+
+	plat.Venv = &python.Venv{Root: "/app/venv"} //nolint:exhaustivestruct
+	assert.NoError(t, pep668.Check(plat, pep668.PolicyError))
+
+	assert.NoError(t, pep668.Check(python.Platform{}, pep668.PolicyError)) //nolint:exhaustivestruct
+}
@@ -3,12 +3,20 @@ package python
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/datawire/ocibuild/pkg/python/pep425"
 	"github.com/datawire/ocibuild/pkg/python/pep440"
 )
 
 type Platform struct {
+	// SchemaVersion is the version of the platform file format; see PlatformSchemaVersion.
+	SchemaVersion int `json:",omitempty" yaml:",omitempty"`
+
+	// Layout, if non-empty, fills in the shebangs and Scheme paths that aren't otherwise
+	// specified; see ApplyLayout.
+	Layout Layout `json:",omitempty" yaml:",omitempty"`
+
 	ConsoleShebang   string // "/usr/bin/python3"
 	GraphicalShebang string // "/usr/bin/python3"
 
@@ -19,11 +27,52 @@ type Platform struct {
 	UName string
 	GName string
 
+	// Modes, if non-nil, normalizes the permission bits of installed files; if nil, then the
+	// permission bits from the wheel are used as-is.
+	Modes *ModePolicy `json:",omitempty" yaml:",omitempty"`
+
 	VersionInfo *VersionInfo
+	// MagicNumber is the target Python's importlib.util.MAGIC_NUMBER.  If set, then the .pyc
+	// files emitted by PyCompile are checked against it (see CheckPycMagicNumber).
 	MagicNumber []byte
 	Tags        pep425.Installer
 
 	PyCompile Compiler `json:"-" yaml:"-"`
+
+	// Windows indicates that the platform is Windows-flavored: the Scheme paths are Windows paths
+	// (such as `C:\Python39\Lib\site-packages`), and layers are written in the layout that
+	// Windows containers use (see fsutil.WindowsLayer), with Windows file attributes.  It is
+	// implied by WindowsLaunchers.
+	Windows bool
+
+	// WindowsLaunchers, if non-nil, indicates that the platform is Windows-flavored: entry-point
+	// scripts get wrapped in ".exe" launchers instead of relying on a "#!" shebang.
+	WindowsLaunchers *WindowsLaunchers `json:"-" yaml:"-"`
+
+	// ScriptTemplate, if non-empty, is a Go text/template that replaces the default template
+	// for the entry-point scripts that are generated from a wheel's entry_points.txt (such as to
+	// pass extra flags to the interpreter, or to run it via a shell); see
+	// entry_points.DefaultScriptTemplate.
+	ScriptTemplate string `json:",omitempty" yaml:",omitempty"`
+
+	// Venv, if non-nil, indicates that the Scheme is that of a virtual environment (PEP 405)
+	// layered on top of a base interpreter, rather than that of the base interpreter itself;
+	// see WithVenv.
+	Venv *Venv `json:",omitempty" yaml:",omitempty"`
+
+	// ExternallyManaged, if non-empty, is the error message from the interpreter's
+	// "EXTERNALLY-MANAGED" file (PEP 668), indicating that packages should not be installed in to
+	// its Scheme; see the pep668 package.  It does not apply if Venv is set.
+	ExternallyManaged string `json:",omitempty" yaml:",omitempty"`
+}
+
+// WindowsLaunchers are the launcher stubs used to generate ".exe" wrappers for scripts on Windows,
+// such as the "t64.exe" and "w64.exe" files that are included with distlib (and so are vendored in
+// pip).  The wrapper is the launcher, followed by a "#!" line, followed by a ZIP file containing
+// a "__main__.py"; see distlib.scripts.ScriptMaker._write_script.
+type WindowsLaunchers struct {
+	Console   []byte // "t64.exe"
+	Graphical []byte // "w64.exe"
 }
 
 type VersionInfo struct {
@@ -66,10 +115,18 @@ type Scheme struct {
 	Headers string `json:"headers"` // "/usr/include/python3.9/$name/" (e.g. $name=cpython)
 	Scripts string `json:"scripts"` // "/usr/bin"
 	Data    string `json:"data"`    // "/usr"
+
+	// Include is the "include" path from Python's sysconfig, which newer wheels may install
+	// files in to (as "{name}-{version}.data/include/"); it is optional, and defaults to
+	// Headers.
+	Include string `json:"include,omitempty"` // "/usr/include/python3.9"
 }
 
 // Init normalizes the shebangs and validates that the scheme has absolute paths.
 func (plat *Platform) Init() error {
+	if plat.WindowsLaunchers != nil {
+		plat.Windows = true
+	}
 	if plat.ConsoleShebang == "" && plat.GraphicalShebang == "" {
 		return fmt.Errorf("Platform specification does not specify a path to use for shebangs")
 	}
@@ -79,6 +136,9 @@ func (plat *Platform) Init() error {
 	if plat.GraphicalShebang == "" {
 		plat.GraphicalShebang = plat.ConsoleShebang
 	}
+	if plat.Scheme.Include == "" {
+		plat.Scheme.Include = plat.Scheme.Headers
+	}
 	for _, pair := range []struct {
 		name string
 		val  string
@@ -88,10 +148,43 @@ func (plat *Platform) Init() error {
 		{"headers", plat.Scheme.Headers},
 		{"scripts", plat.Scheme.Scripts},
 		{"data", plat.Scheme.Data},
+		{"include", plat.Scheme.Include},
 	} {
-		if !filepath.IsAbs(pair.val) {
+		if !plat.isAbs(pair.val) {
 			return fmt.Errorf("Platform install scheme %q is not an absolute path: %q", pair.name, pair.val)
 		}
 	}
+	if plat.Modes != nil {
+		if err := plat.Modes.Validate(); err != nil {
+			return fmt.Errorf("Platform specification: %w", err)
+		}
+	}
 	return nil
 }
+
+func (plat Platform) isAbs(p string) bool {
+	if !plat.Windows {
+		return filepath.IsAbs(p)
+	}
+	p = p[windowsVolumeLen(p):]
+	return strings.HasPrefix(p, `\`) || strings.HasPrefix(p, "/")
+}
+
+// windowsVolumeLen returns the length of the drive letter ("C:") at the start of a Windows path, or
+// 0 if there isn't one.
+func windowsVolumeLen(p string) int {
+	if len(p) >= 2 && p[1] == ':' && ('a' <= p[0]|0x20 && p[0]|0x20 <= 'z') {
+		return 2
+	}
+	return 0
+}
+
+// ToSlash is like filepath.ToSlash, but for the platform's paths rather than the host's.  For a
+// Windows-flavored platform, it strips any drive letter and replaces each backslash with a slash,
+// so that `C:\Python39\Lib` becomes "/Python39/Lib".
+func (plat Platform) ToSlash(p string) string {
+	if !plat.Windows {
+		return filepath.ToSlash(p)
+	}
+	return strings.ReplaceAll(p[windowsVolumeLen(p):], `\`, "/")
+}
@@ -0,0 +1,374 @@
+package python
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// PlatformSchemaVersion is the version of the platform file format (that is, of the Platform
+// struct's YAML/JSON encoding) that this version of ocibuild reads and writes.  It is incremented
+// whenever the meaning of an existing field changes in an incompatible way; adding new optional
+// fields does not change it.  A platform file that doesn't specify a SchemaVersion is version 1.
+const PlatformSchemaVersion = 1
+
+// A Layout names a common way that distributions lay out their Python installations, so that a
+// platform file need not spell out every Scheme path; see Platform.ApplyLayout.
+type Layout string
+
+const (
+	// LayoutDebian is Debian's (and Ubuntu's) "python3" package, installing the way that
+	// Debian's pip does outside of a virtual environment: in to "/usr/local", with
+	// "dist-packages" rather than "site-packages".
+	LayoutDebian Layout = "debian"
+	// LayoutAlpine is Alpine's "python3" package, installing in to "/usr".
+	LayoutAlpine Layout = "alpine"
+	// LayoutFedora is Fedora's (and RHEL's) "python3" package, installing the way that
+	// Fedora's pip does outside of a virtual environment: in to "/usr/local", with separate
+	// "lib" and "lib64" directories.
+	LayoutFedora Layout = "fedora"
+	// LayoutUpstream is Python built from the upstream source with the default "/usr/local"
+	// prefix, as in the official "python" Docker images.
+	LayoutUpstream Layout = "upstream"
+	// LayoutVenv is a virtual environment (see WithVenv) at Venv.Root.
+	LayoutVenv Layout = "venv"
+)
+
+//nolint:gochecknoglobals // Would be 'const'.
+var Layouts = []Layout{LayoutDebian, LayoutAlpine, LayoutFedora, LayoutUpstream, LayoutVenv}
+
+// ApplyLayout fills in the shebangs and Scheme paths that the platform doesn't specify from its
+// Layout (if it has one); paths that the platform does specify are left alone.  The paths depend
+// on the Python version, so all layouts require a VersionInfo (for LayoutVenv, Venv.Version is
+// used if VersionInfo isn't set), and LayoutVenv requires Venv.Root to be set.
+func (plat *Platform) ApplyLayout() error {
+	if plat.Layout == "" {
+		return nil
+	}
+	if plat.Layout == LayoutVenv && plat.VersionInfo == nil && plat.Venv != nil {
+		version := plat.Venv.Version
+		plat.VersionInfo = &version
+	}
+	if plat.VersionInfo == nil {
+		return fmt.Errorf("python.Platform.ApplyLayout: Layout %q requires VersionInfo", plat.Layout)
+	}
+	pythonXY := fmt.Sprintf("python%d.%d", plat.VersionInfo.Major, plat.VersionInfo.Minor)
+
+	var consoleShebang, graphicalShebang string
+	var scheme Scheme
+	switch plat.Layout {
+	case LayoutDebian:
+		consoleShebang = "/usr/bin/" + pythonXY
+		scheme = Scheme{
+			PureLib: "/usr/local/lib/" + pythonXY + "/dist-packages",
+			PlatLib: "/usr/local/lib/" + pythonXY + "/dist-packages",
+			Headers: "/usr/local/include/" + pythonXY,
+			Scripts: "/usr/local/bin",
+			Data:    "/usr/local",
+			Include: "/usr/include/" + pythonXY,
+		}
+	case LayoutAlpine:
+		consoleShebang = "/usr/bin/" + pythonXY
+		scheme = Scheme{
+			PureLib: "/usr/lib/" + pythonXY + "/site-packages",
+			PlatLib: "/usr/lib/" + pythonXY + "/site-packages",
+			Headers: "/usr/include/" + pythonXY,
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "/usr/include/" + pythonXY,
+		}
+	case LayoutFedora:
+		consoleShebang = "/usr/bin/" + pythonXY
+		scheme = Scheme{
+			PureLib: "/usr/local/lib/" + pythonXY + "/site-packages",
+			PlatLib: "/usr/local/lib64/" + pythonXY + "/site-packages",
+			Headers: "/usr/local/include/" + pythonXY,
+			Scripts: "/usr/local/bin",
+			Data:    "/usr/local",
+			Include: "/usr/include/" + pythonXY,
+		}
+	case LayoutUpstream:
+		consoleShebang = "/usr/local/bin/" + pythonXY
+		scheme = Scheme{
+			PureLib: "/usr/local/lib/" + pythonXY + "/site-packages",
+			PlatLib: "/usr/local/lib/" + pythonXY + "/site-packages",
+			Headers: "/usr/local/include/" + pythonXY,
+			Scripts: "/usr/local/bin",
+			Data:    "/usr/local",
+			Include: "/usr/local/include/" + pythonXY,
+		}
+	case LayoutVenv:
+		if plat.Venv == nil || plat.Venv.Root == "" {
+			return fmt.Errorf("python.Platform.ApplyLayout: Layout %q requires Venv.Root", plat.Layout)
+		}
+		scheme, consoleShebang, graphicalShebang = venvScheme(*plat, plat.Venv.Root, pythonXY)
+		if plat.Venv.Version == (VersionInfo{}) { //nolint:exhaustivestruct // zero value
+			plat.Venv.Version = *plat.VersionInfo
+		}
+	default:
+		return fmt.Errorf("python.Platform.ApplyLayout: unknown Layout %q (must be one of %q)",
+			plat.Layout, Layouts)
+	}
+
+	if graphicalShebang == "" {
+		graphicalShebang = consoleShebang
+	}
+	switch {
+	case plat.ConsoleShebang == "" && plat.GraphicalShebang == "":
+		plat.ConsoleShebang, plat.GraphicalShebang = consoleShebang, graphicalShebang
+	case plat.ConsoleShebang == "":
+		plat.ConsoleShebang = plat.GraphicalShebang
+	case plat.GraphicalShebang == "":
+		plat.GraphicalShebang = plat.ConsoleShebang
+	}
+	for _, pair := range []struct {
+		dst *string
+		val string
+	}{
+		{&plat.Scheme.PureLib, scheme.PureLib},
+		{&plat.Scheme.PlatLib, scheme.PlatLib},
+		{&plat.Scheme.Headers, scheme.Headers},
+		{&plat.Scheme.Scripts, scheme.Scripts},
+		{&plat.Scheme.Data, scheme.Data},
+		{&plat.Scheme.Include, scheme.Include},
+	} {
+		if *pair.dst == "" {
+			*pair.dst = pair.val
+		}
+	}
+	return nil
+}
+
+// PlatformError is returned by Platform.Validate, and lists every problem with the platform, rather
+// than just the first.
+type PlatformError struct {
+	Problems []string
+}
+
+func (e *PlatformError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid platform: " + e.Problems[0]
+	}
+	return "invalid platform:\n - " + strings.Join(e.Problems, "\n - ")
+}
+
+// Validate checks the platform for all of the problems that would otherwise only be found part
+// of the way through installing a package (by Init), and some more besides, so that a bad platform
+// file can be rejected up front.  Any error returned is a *PlatformError.  Validate should be called
+// after ApplyLayout.
+func (plat Platform) Validate() error {
+	var problems []string
+	problemf := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if plat.SchemaVersion < 0 || plat.SchemaVersion > PlatformSchemaVersion {
+		problemf("SchemaVersion %d is not supported by this version of ocibuild (it supports version %d)",
+			plat.SchemaVersion, PlatformSchemaVersion)
+	}
+	if plat.Layout != "" {
+		known := false
+		for _, layout := range Layouts {
+			known = known || plat.Layout == layout
+		}
+		if !known {
+			problemf("Layout %q is not one of %q", plat.Layout, Layouts)
+		}
+	}
+	if plat.WindowsLaunchers != nil {
+		plat.Windows = true
+	}
+	if plat.ConsoleShebang == "" && plat.GraphicalShebang == "" {
+		problemf("ConsoleShebang is not set (set it, or set Layout and VersionInfo)")
+	}
+	for _, pair := range []struct {
+		name string
+		val  string
+	}{
+		{"ConsoleShebang", plat.ConsoleShebang},
+		{"GraphicalShebang", plat.GraphicalShebang},
+	} {
+		if pair.val != "" && !plat.isAbs(pair.val) {
+			problemf("%s is not an absolute path: %q", pair.name, pair.val)
+		}
+	}
+	for _, pair := range []struct {
+		name     string
+		val      string
+		optional bool
+	}{
+		{"purelib", plat.Scheme.PureLib, false},
+		{"platlib", plat.Scheme.PlatLib, false},
+		{"headers", plat.Scheme.Headers, false},
+		{"scripts", plat.Scheme.Scripts, false},
+		{"data", plat.Scheme.Data, false},
+		{"include", plat.Scheme.Include, true},
+	} {
+		switch {
+		case pair.val == "" && pair.optional:
+		case pair.val == "":
+			problemf("Scheme.%s is not set (set it, or set Layout and VersionInfo)", pair.name)
+		case !plat.isAbs(pair.val):
+			problemf("Scheme.%s is not an absolute path: %q", pair.name, pair.val)
+		}
+	}
+	if plat.UID < 0 {
+		problemf("UID is negative: %d", plat.UID)
+	}
+	if plat.GID < 0 {
+		problemf("GID is negative: %d", plat.GID)
+	}
+	if plat.Modes != nil {
+		if err := plat.Modes.Validate(); err != nil {
+			problemf("Modes: %v", err)
+		}
+	}
+	if plat.VersionInfo != nil {
+		if _, err := plat.VersionInfo.PEP440(); err != nil {
+			problemf("VersionInfo: invalid releaselevel %q (must be one of %q)",
+				plat.VersionInfo.ReleaseLevel, []string{"alpha", "beta", "candidate", "final"})
+		}
+	}
+	if plat.Venv != nil && !plat.isAbs(plat.Venv.Root) {
+		problemf("Venv.Root is not an absolute path: %q", plat.Venv.Root)
+	}
+
+	if len(problems) > 0 {
+		return &PlatformError{Problems: problems}
+	}
+	return nil
+}
+
+//nolint:gochecknoglobals // Would be 'const'.
+var (
+	reJSONErrPrefix    = regexp.MustCompile(`^error (?:un)?marshaling JSON: (?:while decoding JSON: )?(?:json: )?`)
+	reJSONUnknownField = regexp.MustCompile(`^unknown field "([^"]*)"$`)
+)
+
+// UnmarshalPlatform strictly decodes a YAML (or JSON) platform file in to out, which is a
+// *Platform or a pointer to a struct that embeds a Platform (so that callers can accept extra
+// fields).  Unlike a plain yaml.Unmarshal, unknown fields are an error (with a suggestion, if the
+// unknown field looks like a misspelling of a known one), and a SchemaVersion that is newer than
+// this version of ocibuild supports is an error; it does not otherwise validate the platform (see
+// Platform.Validate).
+func UnmarshalPlatform(data []byte, out interface{}) error {
+	if err := yaml.Unmarshal(data, out, yaml.DisallowUnknownFields); err != nil {
+		msg := reJSONErrPrefix.ReplaceAllString(err.Error(), "")
+		if m := reJSONUnknownField.FindStringSubmatch(msg); m != nil {
+			if suggestion := suggestName(m[1], fieldNames(reflect.TypeOf(out))); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+			}
+		}
+		return fmt.Errorf("python.UnmarshalPlatform: %s", msg)
+	}
+	if plat := findPlatform(reflect.ValueOf(out)); plat != nil && plat.SchemaVersion > PlatformSchemaVersion {
+		return fmt.Errorf("python.UnmarshalPlatform: SchemaVersion %d is newer than this version of ocibuild "+
+			"supports (version %d); upgrade ocibuild", plat.SchemaVersion, PlatformSchemaVersion)
+	}
+	return nil
+}
+
+func findPlatform(val reflect.Value) *Platform {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+	if plat, ok := val.Addr().Interface().(*Platform); ok {
+		return plat
+	}
+	for i := 0; i < val.NumField(); i++ {
+		if val.Type().Field(i).Anonymous {
+			if plat := findPlatform(val.Field(i).Addr()); plat != nil {
+				return plat
+			}
+		}
+	}
+	return nil
+}
+
+// fieldNames returns the JSON names of all of the fields (including nested fields) of typ.
+func fieldNames(typ reflect.Type) []string {
+	set := make(map[string]struct{})
+	var walk func(reflect.Type)
+	walk = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+			if !field.Anonymous || name != "" {
+				if name == "" {
+					name = field.Name
+				}
+				set[name] = struct{}{}
+			}
+			walk(field.Type)
+		}
+	}
+	walk(typ)
+	ret := make([]string, 0, len(set))
+	for name := range set {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// suggestName returns the name in candidates that is most similar to name (case-insensitively),
+// or "" if none of them are similar enough to plausibly be what was meant.
+func suggestName(name string, candidates []string) string {
+	best, bestDist := "", 3 // only suggest names within an edit distance of 2
+	for _, candidate := range candidates {
+		if dist := editDistance(strings.ToLower(name), strings.ToLower(candidate)); dist < bestDist {
+			best, bestDist = candidate, dist
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	ret := first
+	for _, v := range rest {
+		if v < ret {
+			ret = v
+		}
+	}
+	return ret
+}
@@ -0,0 +1,181 @@
+package python_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+func TestApplyLayout(t *testing.T) {
+	t.Parallel()
+	version := &python.VersionInfo{Major: 3, Minor: 11, Micro: 2, ReleaseLevel: "final", Serial: 0}
+	type TestCase struct {
+		Input           python.Platform
+		ExpectedShebang string
+		ExpectedScheme  python.Scheme
+	}
+	//nolint:exhaustivestruct // partial
+	testcases := map[string]TestCase{
+		"debian": {
+			Input:           python.Platform{Layout: python.LayoutDebian, VersionInfo: version},
+			ExpectedShebang: "/usr/bin/python3.11",
+			ExpectedScheme: python.Scheme{
+				PureLib: "/usr/local/lib/python3.11/dist-packages",
+				PlatLib: "/usr/local/lib/python3.11/dist-packages",
+				Headers: "/usr/local/include/python3.11",
+				Scripts: "/usr/local/bin",
+				Data:    "/usr/local",
+				Include: "/usr/include/python3.11",
+			},
+		},
+		"alpine-override": {
+			Input: python.Platform{
+				Layout:         python.LayoutAlpine,
+				VersionInfo:    version,
+				ConsoleShebang: "/usr/bin/python3",
+				Scheme:         python.Scheme{Scripts: "/usr/local/bin"},
+			},
+			ExpectedShebang: "/usr/bin/python3",
+			ExpectedScheme: python.Scheme{
+				PureLib: "/usr/lib/python3.11/site-packages",
+				PlatLib: "/usr/lib/python3.11/site-packages",
+				Headers: "/usr/include/python3.11",
+				Scripts: "/usr/local/bin",
+				Data:    "/usr",
+				Include: "/usr/include/python3.11",
+			},
+		},
+		"fedora": {
+			Input:           python.Platform{Layout: python.LayoutFedora, VersionInfo: version},
+			ExpectedShebang: "/usr/bin/python3.11",
+			ExpectedScheme: python.Scheme{
+				PureLib: "/usr/local/lib/python3.11/site-packages",
+				PlatLib: "/usr/local/lib64/python3.11/site-packages",
+				Headers: "/usr/local/include/python3.11",
+				Scripts: "/usr/local/bin",
+				Data:    "/usr/local",
+				Include: "/usr/include/python3.11",
+			},
+		},
+		"venv": {
+			Input: python.Platform{
+				Layout: python.LayoutVenv,
+				Venv:   &python.Venv{Root: "/app/venv", BaseExecutable: "/usr/bin/python3", Version: *version},
+			},
+			ExpectedShebang: "/app/venv/bin/python",
+			ExpectedScheme: python.Scheme{
+				PureLib: "/app/venv/lib/python3.11/site-packages",
+				PlatLib: "/app/venv/lib/python3.11/site-packages",
+				Headers: "/app/venv/include/site/python3.11",
+				Scripts: "/app/venv/bin",
+				Data:    "/app/venv",
+				Include: "/app/venv/include/python3.11",
+			},
+		},
+	}
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			plat := tc.Input
+			require.NoError(t, plat.ApplyLayout())
+			assert.Equal(t, tc.ExpectedShebang, plat.ConsoleShebang)
+			assert.Equal(t, tc.ExpectedShebang, plat.GraphicalShebang)
+			assert.Equal(t, tc.ExpectedScheme, plat.Scheme)
+			assert.NoError(t, plat.Validate())
+		})
+	}
+
+	//nolint:exhaustivestruct // partial
+	for name, plat := range map[string]python.Platform{
+		"no-version": {Layout: python.LayoutDebian},
+		"venv-root":  {Layout: python.LayoutVenv, VersionInfo: version},
+		"unknown":    {Layout: "gentoo", VersionInfo: version},
+	} {
+		assert.Error(t, plat.ApplyLayout(), name)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	//nolint:exhaustivestruct // partial
+	plat := python.Platform{
+		SchemaVersion:  python.PlatformSchemaVersion + 1,
+		ConsoleShebang: "python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "lib",
+		},
+		UID:         -1,
+		VersionInfo: &python.VersionInfo{Major: 3, Minor: 9, ReleaseLevel: "gamma"},
+	}
+	err := plat.Validate()
+	var platErr *python.PlatformError
+	require.ErrorAs(t, err, &platErr)
+	assert.Equal(t, []string{
+		`SchemaVersion 2 is not supported by this version of ocibuild (it supports version 1)`,
+		`ConsoleShebang is not an absolute path: "python3"`,
+		`Scheme.platlib is not an absolute path: "lib"`,
+		`Scheme.headers is not set (set it, or set Layout and VersionInfo)`,
+		`Scheme.scripts is not set (set it, or set Layout and VersionInfo)`,
+		`Scheme.data is not set (set it, or set Layout and VersionInfo)`,
+		`UID is negative: -1`,
+		`VersionInfo: invalid releaselevel "gamma" (must be one of ["alpha" "beta" "candidate" "final"])`,
+	}, platErr.Problems)
+}
+
+func TestUnmarshalPlatform(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Input    string
+		ExpError string
+	}{
+		"ok": {
+			Input: "SchemaVersion: 1\nLayout: alpine\nScheme:\n  purelib: /usr/lib\n",
+		},
+		"misspelled": {
+			Input:    "ConsoleShebnag: /usr/bin/python3\n",
+			ExpError: `unknown field "ConsoleShebnag" (did you mean "ConsoleShebang"?)`,
+		},
+		"misspelled-nested": {
+			Input:    "Scheme:\n  purelibs: /usr/lib\n",
+			ExpError: `unknown field "purelibs" (did you mean "purelib"?)`,
+		},
+		"unknown": {
+			Input:    "Frobnicate: true\n",
+			ExpError: `unknown field "Frobnicate"`,
+		},
+		"extra-field": {
+			Input:    "PyCompyle: [python3]\n",
+			ExpError: `unknown field "PyCompyle" (did you mean "PyCompile"?)`,
+		},
+		"newer": {
+			Input:    "SchemaVersion: 99\n",
+			ExpError: `SchemaVersion 99 is newer than this version of ocibuild supports`,
+		},
+	}
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var out struct {
+				python.Platform
+				PyCompile []string
+			}
+			err := python.UnmarshalPlatform([]byte(tc.Input), &out)
+			if tc.ExpError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.ExpError)
+				assert.Equal(t, strings.Contains(tc.ExpError, "did you mean"),
+					strings.Contains(err.Error(), "did you mean"))
+			}
+		})
+	}
+}
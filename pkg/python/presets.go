@@ -0,0 +1,132 @@
+package python
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Preset is a built-in description of the Python in a commonly used base image, so that most
+// users needn't write (or generate with `ocibuild python inspect`) a platform file of their own.
+type Preset struct {
+	// Name is what the user asks for the preset by; such as "python:3.12-slim" (named after
+	// the image) or "debian12-python3.11" (named after the distribution and its package).
+	Name string
+	// Description is a human-readable note on what the preset is for.
+	Description string
+
+	Layout  Layout
+	Version VersionInfo
+	// ExternallyManaged is the message from the image's "EXTERNALLY-MANAGED" file (PEP 668),
+	// if it has one; abbreviated to its first sentence.
+	ExternallyManaged string
+}
+
+const (
+	debianExternallyManaged = "To install Python packages system-wide, try apt install python3-xyz, " +
+		"where xyz is the package you are trying to install."
+	alpineExternallyManaged = "The system-wide python installation should be maintained using the " +
+		"system package manager (apk) only."
+)
+
+// magicNumbers maps a Python minor version ("3.12") to its importlib.util.MAGIC_NUMBER.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var magicNumbers = map[string]string{
+	"3.8":  "U\r\r\n",
+	"3.9":  "a\r\r\n",
+	"3.10": "o\r\r\n",
+	"3.11": "\xa7\r\r\n",
+	"3.12": "\xcb\r\r\n",
+	"3.13": "\xf3\r\r\n",
+}
+
+func presetVersion(minor int) VersionInfo {
+	return VersionInfo{Major: 3, Minor: minor, Micro: 0, ReleaseLevel: "final", Serial: 0}
+}
+
+// Presets is the table of built-in presets, sorted by name.  Each preset's Version has a Micro
+// version of 0, since the images that they describe track a minor version.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var Presets = func() []Preset {
+	ret := []Preset{
+		{"debian11-python3.9", "Debian 11 (bullseye) with the python3 package",
+			LayoutDebian, presetVersion(9), ""},
+		{"debian12-python3.11", "Debian 12 (bookworm) with the python3 package",
+			LayoutDebian, presetVersion(11), debianExternallyManaged},
+		{"ubuntu20.04-python3.8", "Ubuntu 20.04 (focal) with the python3 package",
+			LayoutDebian, presetVersion(8), ""},
+		{"ubuntu22.04-python3.10", "Ubuntu 22.04 (jammy) with the python3 package",
+			LayoutDebian, presetVersion(10), ""},
+		{"ubuntu24.04-python3.12", "Ubuntu 24.04 (noble) with the python3 package",
+			LayoutDebian, presetVersion(12), debianExternallyManaged},
+		{"alpine3.18-python3.11", "Alpine 3.18 with the python3 package",
+			LayoutAlpine, presetVersion(11), ""},
+		{"alpine3.19-python3.11", "Alpine 3.19 with the python3 package",
+			LayoutAlpine, presetVersion(11), alpineExternallyManaged},
+		{"alpine3.20-python3.12", "Alpine 3.20 with the python3 package",
+			LayoutAlpine, presetVersion(12), alpineExternallyManaged},
+		{"fedora39-python3.12", "Fedora 39 with the python3 package",
+			LayoutFedora, presetVersion(12), ""},
+		{"fedora40-python3.12", "Fedora 40 with the python3 package",
+			LayoutFedora, presetVersion(12), ""},
+	}
+	// The official "python" images all install Python the same way, regardless of the variant.
+	for minor := 8; minor <= 13; minor++ {
+		for _, variant := range []string{"", "-slim", "-alpine"} {
+			ret = append(ret, Preset{
+				Name:              fmt.Sprintf("python:3.%d%s", minor, variant),
+				Description:       fmt.Sprintf("The official Docker \"python:3.%d%s\" image", minor, variant),
+				Layout:            LayoutUpstream,
+				Version:           presetVersion(minor),
+				ExternallyManaged: "",
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}()
+
+// Platform returns the platform that the preset describes, with its Layout applied.  Files are
+// owned by root.  The PyCompile compiler is not set.
+func (p Preset) Platform() (Platform, error) {
+	version := p.Version
+	plat := Platform{ //nolint:exhaustivestruct // the rest are zero
+		SchemaVersion:     PlatformSchemaVersion,
+		Layout:            p.Layout,
+		UID:               0,
+		GID:               0,
+		UName:             "root",
+		GName:             "root",
+		VersionInfo:       &version,
+		ExternallyManaged: p.ExternallyManaged,
+	}
+	if magic, ok := magicNumbers[fmt.Sprintf("%d.%d", version.Major, version.Minor)]; ok {
+		plat.MagicNumber = []byte(magic)
+	}
+	if err := plat.ApplyLayout(); err != nil {
+		return plat, fmt.Errorf("python.Preset.Platform: %q: %w", p.Name, err)
+	}
+	return plat, nil
+}
+
+// LookupPreset returns the preset with the given name.
+func LookupPreset(name string) (Preset, error) {
+	names := make([]string, 0, len(Presets))
+	for _, preset := range Presets {
+		if preset.Name == name {
+			return preset, nil
+		}
+		names = append(names, preset.Name)
+	}
+	err := fmt.Errorf("python.LookupPreset: no such preset %q", name)
+	if suggestion := suggestName(name, names); suggestion != "" {
+		err = fmt.Errorf("%w (did you mean %q?)", err, suggestion)
+	} else {
+		err = fmt.Errorf("%w (must be one of %s)", err, strings.Join(names, ", "))
+	}
+	return Preset{}, err //nolint:exhaustivestruct // zero value
+}
@@ -0,0 +1,65 @@
+package python_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+func TestPresets(t *testing.T) {
+	t.Parallel()
+	names := make([]string, 0, len(python.Presets))
+	for _, preset := range python.Presets {
+		names = append(names, preset.Name)
+	}
+	assert.True(t, sort.StringsAreSorted(names), "Presets must be sorted by name")
+
+	seen := make(map[string]struct{}, len(names))
+	for _, preset := range python.Presets {
+		preset := preset
+		t.Run(preset.Name, func(t *testing.T) {
+			t.Parallel()
+			plat, err := preset.Platform()
+			require.NoError(t, err)
+			assert.NoError(t, plat.Validate())
+			assert.Equal(t, python.PlatformSchemaVersion, plat.SchemaVersion)
+			assert.Equal(t, "root", plat.UName)
+			assert.Len(t, plat.MagicNumber, 4, "MagicNumber")
+			assert.NotEmpty(t, preset.Description)
+			assert.Contains(t, plat.Scheme.PureLib, fmt.Sprintf("/python%d.%d/", plat.VersionInfo.Major,
+				plat.VersionInfo.Minor))
+		})
+		_, dup := seen[preset.Name]
+		assert.False(t, dup, "duplicate preset %q", preset.Name)
+		seen[preset.Name] = struct{}{}
+	}
+}
+
+func TestLookupPreset(t *testing.T) {
+	t.Parallel()
+	preset, err := python.LookupPreset("python:3.12-slim")
+	require.NoError(t, err)
+	plat, err := preset.Platform()
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/local/bin/python3.12", plat.ConsoleShebang)
+	assert.Equal(t, "/usr/local/lib/python3.12/site-packages", plat.Scheme.PureLib)
+	assert.Equal(t, []byte("\xcb\r\r\n"), plat.MagicNumber)
+
+	preset, err = python.LookupPreset("debian12-python3.11")
+	require.NoError(t, err)
+	plat, err = preset.Platform()
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/python3.11", plat.ConsoleShebang)
+	assert.Equal(t, "/usr/local/lib/python3.11/dist-packages", plat.Scheme.PureLib)
+	assert.NotEmpty(t, plat.ExternallyManaged)
+
+	_, err = python.LookupPreset("python:3.12-slm")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `did you mean "python:3.12-slim"?`)
+	}
+}
@@ -1,6 +1,7 @@
 package python
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
@@ -30,8 +31,11 @@ type Compiler func(
 ) ([]fsutil.FileReference, error)
 
 // ExternalCompiler returns a `Compiler` that uses an external command to compile .py files to .pyc
-// files.  It is designed for use with Python's "compileall" module.  It makes use of the "-p" flag
-// and passes a directory rather than a single file; so the "py_compile" module is not appropriate.
+// files.  It is designed for use with Python's "compileall" module.  It makes use of the "-s", "-p",
+// and "-i" flags, passing all of the files in a single invocation by way of a manifest file; so the
+// "py_compile" module is not appropriate.
+//
+// The compiler process is killed if the Context is canceled.
 //
 // For example:
 //
@@ -118,17 +122,40 @@ func ExternalCompiler(cmdline ...string) (Compiler, error) {
 			return nil
 		}
 
+		// The manifest lists the files to compile, one per line; it goes outside of tmpdir so
+		// that it can't collide with an input file.
+		manifest, err := os.CreateTemp("", "ocibuild-pycompile-manifest.")
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			maybeSetErr(os.Remove(manifest.Name()))
+		}()
+		manifestWriter := bufio.NewWriter(manifest)
 		for _, inFile := range inFiles {
+			if err := ctx.Err(); err != nil {
+				_ = manifest.Close()
+				return nil, err
+			}
 			if err := writeFile(inFile); err != nil {
+				_ = manifest.Close()
 				return nil, err
 			}
+			_, _ = fmt.Fprintln(manifestWriter, filepath.Join(tmpdir, filepath.FromSlash(inFile.FullName())))
+		}
+		if err := manifestWriter.Flush(); err != nil {
+			_ = manifest.Close()
+			return nil, err
+		}
+		if err := manifest.Close(); err != nil {
+			return nil, err
 		}
 
 		// Run the compiler
 		cmd := dexec.CommandContext(ctx, exe, append(cmdline[1:],
 			"-s", tmpdir, // strip-dir for the in-.pyc filename
 			"-p", "/", // prepend-dir for the in-.pyc filename
-			tmpdir, // directory to compile
+			"-i", manifest.Name(), // files to compile
 		)...)
 
 		cmd.Env = append(os.Environ(),
@@ -163,6 +190,9 @@ func ExternalCompiler(cmdline ...string) (Compiler, error) {
 			if e != nil {
 				return e
 			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			if dirent.IsDir() || !strings.HasSuffix(fullname, ".pyc") {
 				return nil
 			}
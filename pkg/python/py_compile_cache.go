@@ -0,0 +1,198 @@
+package python
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datawire/dlib/dexec"
+	"github.com/datawire/dlib/dlog"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+// A CompileCache stores the output of a Compiler, keyed by a hash of its inputs; see
+// CachingCompiler.  It is implemented by cache.Store.
+type CompileCache interface {
+	GetByKey(key string) ([]byte, bool, error)
+	PutByKey(key string, content []byte) error
+}
+
+// CachingCompiler wraps a Compiler so that its output is stored in a CompileCache, so that
+// compiling the same files again (such as when re-building a layer for an unchanged wheel) skips
+// running the compiler entirely.
+//
+// The cache key is a hash of the identity, the clampTime, the pythonPath, and the names,
+// permissions, timestamps, and content of the input files.  The identity must identify everything
+// else that affects the compiler's output: which compiler it is, the Python version, the
+// optimization level, and so on; see ExternalCompilerIdentity.
+//
+// Problems with the cache are logged, and fall back to running the compiler; they are not errors.
+func CachingCompiler(compiler Compiler, identity string, cache CompileCache) Compiler {
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		pythonPath []string,
+		inFiles []fsutil.FileReference,
+	) ([]fsutil.FileReference, error) {
+		key, err := compileCacheKey(identity, clampTime, pythonPath, inFiles)
+		if err != nil {
+			return nil, err
+		}
+		content, ok, err := cache.GetByKey(key)
+		if err != nil {
+			dlog.Warnf(ctx, "py_compile cache: %v", err)
+		}
+		if ok {
+			outFiles, err := readCompileOutput(bytes.NewReader(content))
+			if err == nil {
+				dlog.Debugf(ctx, "py_compile cache: using cached output for %d files", len(inFiles))
+				return outFiles, nil
+			}
+			dlog.Warnf(ctx, "py_compile cache: invalid entry: %v", err)
+		}
+
+		outFiles, err := compiler(ctx, clampTime, pythonPath, inFiles)
+		if err != nil {
+			return nil, err
+		}
+		content, err = marshalCompileOutput(outFiles)
+		if err != nil {
+			dlog.Warnf(ctx, "py_compile cache: %v", err)
+			return outFiles, nil
+		}
+		if err := cache.PutByKey(key, content); err != nil {
+			dlog.Warnf(ctx, "py_compile cache: %v", err)
+		}
+		return outFiles, nil
+	}
+}
+
+// ExternalCompilerIdentity returns an identity string for use with CachingCompiler for
+// ExternalCompiler(cmdline...).  Besides the command line itself (which includes any optimization
+// flags), it includes the size and modification time of the resolved executable, so that
+// upgrading the Python interpreter invalidates the cache.
+func ExternalCompilerIdentity(cmdline ...string) (string, error) {
+	exe, err := dexec.LookPath(cmdline[0])
+	if err != nil {
+		return "", err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return "", err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("external:%q exe=%q size=%d mtime=%d",
+		cmdline, exe, info.Size(), info.ModTime().UnixNano()), nil
+}
+
+func compileCacheKey(
+	identity string,
+	clampTime time.Time,
+	pythonPath []string,
+	inFiles []fsutil.FileReference,
+) (string, error) {
+	sorted := make([]fsutil.FileReference, len(inFiles))
+	copy(sorted, inFiles)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].FullName() < sorted[j].FullName()
+	})
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "py_compile\x00%s\x00", identity)
+	if !clampTime.IsZero() {
+		fmt.Fprintf(hasher, "clamp=%d\x00", clampTime.Unix())
+	}
+	fmt.Fprintf(hasher, "path=%s\x00", strings.Join(pythonPath, "\x01"))
+	for _, file := range sorted {
+		fileHasher := sha256.New()
+		reader, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(fileHasher, reader)
+		_ = reader.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hasher, "%s\x00%o\x00%d\x00%x\x00",
+			file.FullName(), file.Mode(), file.ModTime().UnixNano(), fileHasher.Sum(nil))
+	}
+	return "py_compile:sha256:" + hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// marshalCompileOutput serializes the output of a Compiler as a tar archive.
+func marshalCompileOutput(files []fsutil.FileReference) ([]byte, error) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, file := range files {
+		header, err := tar.FileInfoHeader(file, "")
+		if err != nil {
+			return nil, err
+		}
+		header.Name = file.FullName()
+		header.Format = tar.FormatPAX // for sub-second mtimes
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(tarWriter, reader)
+		_ = reader.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readCompileOutput reads the output of a Compiler from a tar archive, such as one written by
+// marshalCompileOutput.
+func readCompileOutput(r io.Reader) ([]fsutil.FileReference, error) {
+	var ret []fsutil.FileReference
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &fsutil.InMemFileReference{
+			FileInfo:  header.FileInfo(),
+			MFullName: header.Name,
+			MContent:  content,
+		})
+	}
+	return ret, nil
+}
@@ -0,0 +1,91 @@
+package python_test
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/cache"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+func inMemFile(t *testing.T, name, content string, mtime time.Time) fsutil.FileReference {
+	t.Helper()
+	return &fsutil.InMemFileReference{
+		FileInfo: (&tar.Header{ //nolint:exhaustivestruct
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			ModTime:  mtime,
+		}).FileInfo(),
+		MFullName: name,
+		MContent:  []byte(content),
+	}
+}
+
+func TestCachingCompiler(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	mtime := time.Date(2021, 1, 1, 0, 0, 0, 500, time.UTC)
+
+	calls := 0
+	compiler := python.CachingCompiler(func(
+		_ context.Context,
+		clampTime time.Time,
+		_ []string,
+		inFiles []fsutil.FileReference,
+	) ([]fsutil.FileReference, error) {
+		calls++
+		var outFiles []fsutil.FileReference
+		for _, inFile := range inFiles {
+			reader, err := inFile.Open()
+			require.NoError(t, err)
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			outFiles = append(outFiles, inMemFile(t, inFile.FullName()+"c",
+				"compiled:"+string(content), clampTime))
+		}
+		return outFiles, nil
+	}, "test-compiler", cache.Store{Dir: t.TempDir(), Remote: nil})
+
+	compile := func(clampTime time.Time, content string) []fsutil.FileReference {
+		t.Helper()
+		outFiles, err := compiler(ctx, clampTime, []string{"lib"}, []fsutil.FileReference{
+			inMemFile(t, "lib/a.py", content, mtime),
+			inMemFile(t, "lib/b.py", "b", mtime),
+		})
+		require.NoError(t, err)
+		return outFiles
+	}
+
+	first := compile(mtime, "a")
+	assert.Equal(t, 1, calls)
+
+	// A cache hit returns the same files, without calling the compiler.
+	second := compile(mtime, "a")
+	assert.Equal(t, 1, calls)
+	require.Len(t, second, len(first))
+	for i := range first {
+		assert.Equal(t, first[i].FullName(), second[i].FullName())
+		assert.Equal(t, first[i].Mode(), second[i].Mode())
+		assert.True(t, first[i].ModTime().Equal(second[i].ModTime()))
+		reader, err := second[i].Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, first[i].(*fsutil.InMemFileReference).MContent, content) //nolint:forcetypeassert
+	}
+
+	// Changing the content or the clampTime is a miss.
+	compile(mtime, "a2")
+	assert.Equal(t, 2, calls)
+	compile(mtime.Add(time.Second), "a")
+	assert.Equal(t, 3, calls)
+}
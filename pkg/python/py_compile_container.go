@@ -0,0 +1,209 @@
+package python
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/datawire/ocibuild/pkg/dockerutil"
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+// containerCompileDriver is a Python script that is run inside of the container by
+// ContainerCompiler.  It reads a tar archive of the .py files on stdin, runs the compiler command
+// (its arguments, with sys.executable prepended) on all of them at once, and writes a tar archive
+// of the resulting .pyc files to stdout.
+const containerCompileDriver = `
+import os, subprocess, sys, tarfile, tempfile
+tmpdir = tempfile.mkdtemp(prefix="ocibuild-pycompile.")
+names = []
+with tarfile.open(fileobj=sys.stdin.buffer, mode="r|") as archive:
+    archive.extraction_filter = getattr(tarfile, "fully_trusted_filter", None)
+    for member in archive:
+        archive.extract(member, tmpdir)
+        if member.isfile():
+            names.append(os.path.join(tmpdir, member.name))
+manifest = tmpdir + ".manifest"
+with open(manifest, "w") as f:
+    f.writelines(name + "\n" for name in names)
+env = dict(os.environ)
+path = [os.path.join(tmpdir, d) for d in env.pop("OCIBUILD_PYTHONPATH", "").split("\n") if d]
+if env.get("PYTHONPATH"):
+    path.append(env["PYTHONPATH"])
+if path:
+    env["PYTHONPATH"] = os.pathsep.join(path)
+subprocess.run([sys.executable] + sys.argv[1:] + ["-s", tmpdir, "-p", "/", "-i", manifest],
+               env=env, stdout=sys.stderr, check=True)
+with tarfile.open(fileobj=sys.stdout.buffer, mode="w|", format=tarfile.PAX_FORMAT) as archive:
+    for dirpath, dirnames, filenames in os.walk(tmpdir):
+        dirnames.sort()
+        for filename in sorted(filenames):
+            if filename.endswith(".pyc"):
+                fullname = os.path.join(dirpath, filename)
+                archive.add(fullname, arcname=os.path.relpath(fullname, tmpdir))
+`
+
+// ContainerCompiler is like ExternalCompiler, but runs the compiler command inside of a container
+// of the given image (using `docker run`), rather than on the host; so that the Python that
+// compiles the files is exactly the target's Python, and the .pyc files always have the correct
+// magic number.  The image is typically the base image that the layer is for.
+//
+// The first element of cmdline must be a Python interpreter in the image (such as
+// "/usr/bin/python3"), and the rest its arguments (such as "-m", "compileall").  The container
+// is run without network access.
+//
+// The image is loaded in to the Docker daemon for each call to the Compiler, and removed
+// afterward; CachingCompiler avoids that for files that have been compiled before.
+func ContainerCompiler(image ociv1.Image, cmdline ...string) (Compiler, error) {
+	if len(cmdline) == 0 {
+		return nil, fmt.Errorf("python.ContainerCompiler: empty command line")
+	}
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		pythonPath []string,
+		inFiles []fsutil.FileReference,
+	) (outFiles []fsutil.FileReference, err error) {
+		err = dockerutil.WithImage(ctx, "pycompile", image, func(ctx context.Context, tag name.Tag) error {
+			var err error
+			outFiles, err = containerCompile(ctx, tag.String(), cmdline, clampTime, pythonPath, inFiles)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("python.ContainerCompiler: %w", err)
+		}
+		return outFiles, nil
+	}, nil
+}
+
+// ContainerRefCompiler is like ContainerCompiler, but for an image that Docker already has (or
+// can pull) by name, such as "python:3.12-slim"; rather than for an image file.
+func ContainerRefCompiler(imageRef string, cmdline ...string) (Compiler, error) {
+	if len(cmdline) == 0 {
+		return nil, fmt.Errorf("python.ContainerRefCompiler: empty command line")
+	}
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		pythonPath []string,
+		inFiles []fsutil.FileReference,
+	) ([]fsutil.FileReference, error) {
+		outFiles, err := containerCompile(ctx, imageRef, cmdline, clampTime, pythonPath, inFiles)
+		if err != nil {
+			return nil, fmt.Errorf("python.ContainerRefCompiler: %w", err)
+		}
+		return outFiles, nil
+	}, nil
+}
+
+// containerCompile runs containerCompileDriver in a container of the named image.
+func containerCompile(
+	ctx context.Context,
+	imageRef string,
+	cmdline []string,
+	clampTime time.Time,
+	pythonPath []string,
+	inFiles []fsutil.FileReference,
+) ([]fsutil.FileReference, error) {
+	args := []string{"run", "--rm", "--interactive", "--network=none",
+		"--entrypoint=" + cmdline[0],
+		"--env=PYTHONHASHSEED=0",
+		"--env=OCIBUILD_PYTHONPATH=" + strings.Join(pythonPath, "\n"),
+	}
+	if !clampTime.IsZero() {
+		args = append(args, fmt.Sprintf("--env=SOURCE_DATE_EPOCH=%d", clampTime.Unix()))
+	}
+	args = append(args, imageRef, "-c", containerCompileDriver)
+	args = append(args, cmdline[1:]...)
+	cmd, err := dockerutil.Command(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	// Don't log the tar archives; but do keep the compiler's output for error messages.
+	cmd.DisableLogging = true
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	writeErr := make(chan error, 1)
+	go func() {
+		err := writeCompileInput(stdin, inFiles)
+		if closeErr := stdin.Close(); err == nil {
+			err = closeErr
+		}
+		writeErr <- err
+	}()
+	outFiles, readErr := readCompileOutput(stdout)
+	// Drain the rest, so that the command doesn't block writing to stdout.
+	_, _ = io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("%w\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+	if err := <-writeErr; err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return outFiles, nil
+}
+
+// ContainerCompilerIdentity returns an identity string for use with CachingCompiler for
+// ContainerCompiler(image, cmdline...).
+func ContainerCompilerIdentity(image ociv1.Image, cmdline ...string) (string, error) {
+	digest, err := image.Digest()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("container:%q image=%s", cmdline, digest), nil
+}
+
+// writeCompileInput writes the input files of a Compiler as a tar archive.
+func writeCompileInput(w io.Writer, inFiles []fsutil.FileReference) error {
+	tarWriter := tar.NewWriter(w)
+	for _, inFile := range inFiles {
+		// Read the content first, rather than trusting inFile.Size(); the content may have been
+		// rewritten (such as a script's "#!python" line).
+		reader, err := inFile.Open()
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			return err
+		}
+		if err := tarWriter.WriteHeader(&tar.Header{ //nolint:exhaustivestruct
+			Typeflag: tar.TypeReg,
+			Name:     inFile.FullName(),
+			Mode:     int64(inFile.Mode().Perm()),
+			Size:     int64(len(content)),
+			ModTime:  inFile.ModTime(),
+			Format:   tar.FormatPAX,
+		}); err != nil {
+			return err
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
@@ -0,0 +1,112 @@
+package python
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// PycHeaderSize is the size of the header at the start of a .pyc file (for Python 3.7 and later;
+// see PEP 552).
+const PycHeaderSize = 16
+
+// The bits of PycHeader.Flags.
+const (
+	// PycFlagHashBased indicates that the .pyc is validated against the source file's hash,
+	// rather than against its mtime and size.
+	PycFlagHashBased = 1 << 0
+	// PycFlagCheckSource indicates, for a hash-based .pyc, that Python should check the hash
+	// against the source file ("checked") rather than trusting the .pyc ("unchecked").
+	PycFlagCheckSource = 1 << 1
+)
+
+// PycHeader is the parsed header of a .pyc file.
+type PycHeader struct {
+	// MagicNumber identifies the bytecode version; it must match the importlib.util.MAGIC_NUMBER
+	// of the Python that loads the file (see Platform.MagicNumber).
+	MagicNumber []byte
+	Flags       uint32
+
+	// SourceMtime and SourceSize are set if Flags doesn't have PycFlagHashBased.
+	SourceMtime uint32
+	SourceSize  uint32
+	// SourceHash is set if Flags has PycFlagHashBased.
+	SourceHash []byte
+}
+
+// ErrMagicNumber is returned by CheckPycMagicNumber if a .pyc file is for a different Python
+// version than expected.
+var ErrMagicNumber = errors.New("wrong .pyc magic number")
+
+// ParsePycHeader parses the header at the start of the content of a .pyc file.
+func ParsePycHeader(content []byte) (PycHeader, error) {
+	var zero PycHeader
+	if len(content) < PycHeaderSize {
+		return zero, fmt.Errorf("python.ParsePycHeader: truncated header: %d bytes", len(content))
+	}
+	// The magic number is a 2-byte little-endian number followed by "\r\n".
+	if !bytes.Equal(content[2:4], []byte("\r\n")) {
+		return zero, fmt.Errorf("python.ParsePycHeader: invalid magic number: %x", content[:4])
+	}
+	header := PycHeader{ //nolint:exhaustivestruct // filled in below
+		MagicNumber: append([]byte(nil), content[:4]...),
+		Flags:       binary.LittleEndian.Uint32(content[4:8]),
+	}
+	if header.Flags&^(PycFlagHashBased|PycFlagCheckSource) != 0 {
+		return zero, fmt.Errorf("python.ParsePycHeader: invalid flags: %#x", header.Flags)
+	}
+	if header.Flags&PycFlagHashBased != 0 {
+		header.SourceHash = append([]byte(nil), content[8:16]...)
+	} else {
+		header.SourceMtime = binary.LittleEndian.Uint32(content[8:12])
+		header.SourceSize = binary.LittleEndian.Uint32(content[12:16])
+	}
+	return header, nil
+}
+
+// pycMagicVersions maps the magic numbers of final Python releases to their version numbers.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var pycMagicVersions = map[uint16]string{
+	3379: "3.6",
+	3394: "3.7",
+	3413: "3.8",
+	3425: "3.9",
+	3439: "3.10",
+	3495: "3.11",
+	3531: "3.12",
+	3571: "3.13",
+}
+
+// PycMagicVersion returns the "MAJOR.MINOR" Python version that a .pyc magic number is for, or ""
+// if it isn't known (such as for a pre-release version of Python).
+func PycMagicVersion(magic []byte) string {
+	if len(magic) != 4 {
+		return ""
+	}
+	return pycMagicVersions[binary.LittleEndian.Uint16(magic)]
+}
+
+func describeMagic(magic []byte) string {
+	if version := PycMagicVersion(magic); version != "" {
+		return fmt.Sprintf("%x (Python %s)", magic, version)
+	}
+	return fmt.Sprintf("%x", magic)
+}
+
+// CheckPycMagicNumber parses the header of a .pyc file, and checks that its magic number is the
+// expected one (typically Platform.MagicNumber); if it isn't, then the error wraps ErrMagicNumber.
+// This catches .pyc files that were compiled by the wrong Python version, which the target Python
+// would otherwise silently ignore (or fail to write replacements for, in a read-only container).
+func CheckPycMagicNumber(expected []byte, content []byte) error {
+	header, err := ParsePycHeader(content)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(header.MagicNumber, expected) {
+		return fmt.Errorf("%w: got %s, but expected %s", ErrMagicNumber,
+			describeMagic(header.MagicNumber), describeMagic(expected))
+	}
+	return nil
+}
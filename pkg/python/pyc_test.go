@@ -0,0 +1,54 @@
+package python_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+func TestParsePycHeader(t *testing.T) {
+	t.Parallel()
+
+	// Python 3.11, timestamp-based
+	header, err := python.ParsePycHeader([]byte("\xa7\x0d\r\n\x00\x00\x00\x00\x00\xad\xeeY\x0b\x00\x00\x00"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\xa7\x0d\r\n"), header.MagicNumber)
+	assert.Equal(t, "3.11", python.PycMagicVersion(header.MagicNumber))
+	assert.Equal(t, uint32(0), header.Flags)
+	assert.Equal(t, uint32(0x59eead00), header.SourceMtime)
+	assert.Equal(t, uint32(11), header.SourceSize)
+	assert.Nil(t, header.SourceHash)
+
+	// Python 3.9, checked-hash-based
+	header, err = python.ParsePycHeader([]byte("\x61\x0d\r\n\x03\x00\x00\x00\x01\x02\x03\x04\x05\x06\x07\x08\xe3"))
+	require.NoError(t, err)
+	assert.Equal(t, "3.9", python.PycMagicVersion(header.MagicNumber))
+	assert.Equal(t, uint32(python.PycFlagHashBased|python.PycFlagCheckSource), header.Flags)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, header.SourceHash)
+
+	for name, content := range map[string]string{
+		"truncated": "\xa7\x0d\r\n\x00\x00\x00\x00",
+		"not-pyc":   "#!/usr/bin/env python3\n",
+		"bad-flags": "\xa7\x0d\r\n\x04\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+	} {
+		_, err := python.ParsePycHeader([]byte(content))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCheckPycMagicNumber(t *testing.T) {
+	t.Parallel()
+	py311 := []byte("\xa7\x0d\r\n")
+	py312 := []byte("\xcb\x0d\r\n")
+	pyc := append(append([]byte(nil), py312...), make([]byte, 12)...)
+
+	assert.NoError(t, python.CheckPycMagicNumber(py312, pyc))
+
+	err := python.CheckPycMagicNumber(py311, pyc)
+	assert.ErrorIs(t, err, python.ErrMagicNumber)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "got cb0d0d0a (Python 3.12), but expected a70d0d0a (Python 3.11)")
+}
@@ -77,7 +77,8 @@ func (sys *ImageFS) ensureInitialized() error {
 			if err != nil {
 				return err
 			}
-			vfs, err := squash.Load(layers, true)
+			// File content isn't held in memory, so there's no need to omit it.
+			vfs, err := squash.Load(layers, false)
 			if err != nil {
 				return err
 			}
@@ -114,6 +115,20 @@ func (sys *ImageFS) Stat(name string) (FileInfo, error) {
 	}, nil
 }
 
+func (sys *ImageFS) ReadFile(name string) ([]byte, error) {
+	if !path.IsAbs(name) {
+		return nil, &fs.PathError{
+			Op:   "read",
+			Path: name,
+			Err:  fs.ErrInvalid,
+		}
+	}
+	if err := sys.ensureInitialized(); err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(sys.imgFS, name[1:])
+}
+
 func (sys *ImageFS) checkExecutable(fullfilename string) error {
 	fileinfo, err := sys.Stat(fullfilename)
 	if err != nil {
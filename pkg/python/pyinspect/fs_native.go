@@ -57,3 +57,10 @@ func (NativeFS) LookPath(file string) (string, error) {
 	}
 	return val, err
 }
+
+func (NativeFS) ReadFile(name string) ([]byte, error) {
+	if !filepath.IsAbs(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.ReadFile(name)
+}
@@ -49,6 +49,10 @@ type FS interface {
 
 	// LookPath mimics os/exec.LookPath, but io/fs.PathError is used instead of exec.Error.
 	LookPath(file string) (string, error)
+
+	// ReadFile mimics os.ReadFile, but with the additional requirement that name must be an
+	// absolute path.
+	ReadFile(name string) ([]byte, error)
 }
 
 // Shebangs takes an interpreter command (like "python3") and turns it in to a pair of paths to put
@@ -84,12 +88,23 @@ type DynamicInfo struct {
 	Tags           pep425.Installer
 	VersionInfo    python.VersionInfo
 	Scheme         python.Scheme
+
+	// Prefix and BasePrefix are `sys.prefix` and `sys.base_prefix`; they differ if the
+	// interpreter is in a virtual environment (PEP 405), in which case Prefix is the root of the
+	// virtual environment and BaseExecutable is the base interpreter.
+	Prefix         string
+	BasePrefix     string
+	BaseExecutable string
+	// Stdlib is the directory of the standard library, which is where an "EXTERNALLY-MANAGED"
+	// file (PEP 668) would be.
+	Stdlib string
 }
 
 func Dynamic(ctx context.Context, cmdline ...string) (*DynamicInfo, error) {
 	cmd := dexec.CommandContext(ctx, cmdline[0], append(cmdline[1:], "-c", `
 import json
 import sys
+import sysconfig
 from base64 import b64encode
 from importlib.util import MAGIC_NUMBER
 from packaging.tags import sys_tags
@@ -103,7 +118,12 @@ json.dump({
   "MagicNumberB64": b64encode(MAGIC_NUMBER).decode('utf-8'),
   "Tags": [str(tag) for tag in sys_tags()],
   "VersionInfo": {slot: getattr(sys.version_info, slot) for slot in version_info_slots},
-  "Scheme": {slot: getattr(scheme, slot) for slot in scheme.__slots__},
+  "Scheme": dict({slot: getattr(scheme, slot) for slot in scheme.__slots__},
+                 include=sysconfig.get_path('include')),
+  "Prefix": sys.prefix,
+  "BasePrefix": sys.base_prefix,
+  "BaseExecutable": getattr(sys, '_base_executable', sys.executable),
+  "Stdlib": sysconfig.get_path('stdlib'),
 }, sys.stdout)
 `)...)
 	cmd.DisableLogging = true
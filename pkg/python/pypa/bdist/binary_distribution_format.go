@@ -14,30 +14,38 @@ import (
 	"context"
 	"crypto/sha256"
 	"crypto/sha512"
-	"encoding/base64"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"io/fs"
 	"net/textproto"
+	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/datawire/dlib/derror"
 	"github.com/datawire/dlib/dlog"
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
 	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"golang.org/x/crypto/blake2b"
 
 	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/progress"
 	"github.com/datawire/ocibuild/pkg/python"
 	"github.com/datawire/ocibuild/pkg/python/pep425"
 	"github.com/datawire/ocibuild/pkg/python/pep440"
 	"github.com/datawire/ocibuild/pkg/reproducible"
+	"github.com/datawire/ocibuild/pkg/warnings"
 )
 
 //
@@ -85,6 +93,12 @@ func (wh *wheel) Open(filename string) (io.ReadCloser, error) {
 // it is zero then the timestamps in the wheel file are preserved.
 //
 // If maxTime is zero, then it defaults based on the maximum timestamp in the wheel file.
+//
+// minTime and maxTime are overridden by any MtimePolicy set with WithMtimePolicy.
+//
+// Directory entries in the layer are named with a trailing "/" (see tarnorm).  This is a deliberate
+// break in reproducibility: older versions named them without it, so the same wheel now produces a
+// layer with a different digest.
 func InstallWheel(
 	ctx context.Context,
 	plat python.Platform,
@@ -92,28 +106,158 @@ func InstallWheel(
 	wheelfilename string,
 	hook PostInstallHook,
 	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, error) {
+	wheelFile, err := os.Open(wheelfilename)
+	if err != nil {
+		return nil, fmt.Errorf("bdist.InstallWheel: open wheel: %w", err)
+	}
+	defer wheelFile.Close()
+	wheelInfo, err := wheelFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("bdist.InstallWheel: open wheel: %w", err)
+	}
+	return InstallWheelFromReader(ctx, plat, minTime, maxTime,
+		wheelfilename, wheelFile, wheelInfo.Size(),
+		hook, opts...)
+}
+
+// InstallWheelFromReader is like InstallWheel, but reads the wheel file from r (which is size bytes
+// long) rather than opening a file; this allows installing a wheel that has been downloaded in to
+// memory, without writing it to a temporary file.  The wheelfilename is still needed (it may be
+// just the base name), because the compatibility tags in the filename are checked against the
+// wheel's metadata.
+func InstallWheelFromReader(
+	ctx context.Context,
+	plat python.Platform,
+	minTime, maxTime time.Time,
+	wheelfilename string,
+	r io.ReaderAt,
+	size int64,
+	hook PostInstallHook,
+	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, error) {
+	return InstallWheelFromReaderWithTimeouts(ctx, plat, minTime, maxTime,
+		wheelfilename, r, size,
+		hook, StepTimeouts{}, opts...)
+}
+
+// InstallWheelFromReaderWithTimeouts is like InstallWheelFromReader, but each of the potentially
+// slow steps of installation is subject to the corresponding timeout in timeouts.
+func InstallWheelFromReaderWithTimeouts(
+	ctx context.Context,
+	plat python.Platform,
+	minTime, maxTime time.Time,
+	wheelfilename string,
+	r io.ReaderAt,
+	size int64,
+	hook PostInstallHook,
+	timeouts StepTimeouts,
+	opts ...ociv1tarball.LayerOption,
 ) (ociv1.Layer, error) {
 	plat, err := sanitizePlatformForLayer(plat)
 	if err != nil {
 		return nil, fmt.Errorf("bdist.InstallWheel: validate python.Platform: %w", err)
 	}
+	vfs, _, maxTime, err := installWheelToVFS(ctx, plat, minTime, maxTime, wheelfilename, r, size,
+		hook, timeouts)
+	if err != nil {
+		return nil, fmt.Errorf("bdist.InstallWheel: %w", err)
+	}
 
-	zipReader, err := zip.OpenReader(wheelfilename)
+	refs := fsutil.FileReferencesFromMap(vfs)
+	if plat.Windows {
+		refs, err = fsutil.WindowsLayer(refs, maxTime)
+		if err != nil {
+			return nil, fmt.Errorf("bdist.InstallWheel: windows layout: %w", err)
+		}
+	}
+
+	var layer ociv1.Layer
+	err = runStep(ctx, timeouts.GenerateLayer, func(ctx context.Context) error {
+		var err error
+		layer, err = fsutil.LayerFromFileReferencesContext(ctx, refs, maxTime, opts...)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("bdist.Installwheel: open wheel: %w", err)
+		return nil, fmt.Errorf("bdist.InstallWheel: generate layer: %w", err)
+	}
+	progress.Report(ctx, progress.Event{ //nolint:exhaustivestruct
+		Kind: progress.WheelInstalled,
+		Name: filepath.Base(wheelfilename),
+	})
+	return layer, nil
+}
+
+// InstallWheelToVFS is like InstallWheelFromReader, but rather than generating a layer, it returns
+// the files that would be in the layer, keyed by FullName (slash-separated, relative to the root),
+// along with the FullName of the installed .dist-info directory.  This is for callers that want to
+// do something else with the installed files, such as merging several wheels in to one layer, or
+// writing them to disk.
+//
+// The files are exactly as they would be in the layer: the post-install hook has been run, parent
+// directories have been filled in, timestamps have been clamped to maxTime, and ownership,
+// permissions, and hardlinks have been set from plat (each file's Sys() is a *tar.Header).  The
+// one exception is that for a plat.Windows platform, the files haven't been moved in to the
+// "Files/" directory of a Windows layer; see fsutil.WindowsLayer.
+func InstallWheelToVFS(
+	ctx context.Context,
+	plat python.Platform,
+	minTime, maxTime time.Time,
+	wheelfilename string,
+	r io.ReaderAt,
+	size int64,
+	hook PostInstallHook,
+) (map[string]fsutil.FileReference, string, error) {
+	plat, err := sanitizePlatformForLayer(plat)
+	if err != nil {
+		return nil, "", fmt.Errorf("bdist.InstallWheelToVFS: validate python.Platform: %w", err)
+	}
+	vfs, distInfoDir, _, err := installWheelToVFS(ctx, plat, minTime, maxTime, wheelfilename, r, size,
+		hook, StepTimeouts{})
+	if err != nil {
+		return nil, "", fmt.Errorf("bdist.InstallWheelToVFS: %w", err)
+	}
+	return vfs, distInfoDir, nil
+}
+
+// installWheelToVFS is the body of InstallWheelToVFS (and the first half of
+// InstallWheelFromReader); plat must have already been sanitized.  It also returns the effective
+// maxTime.
+func installWheelToVFS(
+	ctx context.Context,
+	plat python.Platform,
+	minTime, maxTime time.Time,
+	wheelfilename string,
+	r io.ReaderAt,
+	size int64,
+	hook PostInstallHook,
+	timeouts StepTimeouts,
+) (map[string]fsutil.FileReference, string, time.Time, error) {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("open wheel: %w", err)
 	}
-	defer zipReader.Close()
 
 	wh := &wheel{ //nolint:varnamelen // same as receiver name
-		zip: &zipReader.Reader,
+		zip: zipReader,
 
 		cachedDistInfoDir: "", // don't know it yet
 	}
 
-	if err := wh.integrityCheck(); err != nil {
-		return nil, fmt.Errorf("bdist.InstallWheel: wheel integrity: %w", err)
+	if skipRecordVerification(ctx) {
+		dlog.Debugf(ctx, "skipping RECORD verification for %s", filepath.Base(wheelfilename))
+	} else if err := runStep(ctx, timeouts.IntegrityCheck, wh.integrityCheck); err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("wheel integrity: %w", err)
+	}
+
+	if err := wh.checkTags(ctx, filepath.Base(wheelfilename)); err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("compatibility tags: %w", err)
 	}
 
+	minTime, maxTime, err = getMtimePolicy(ctx).times(minTime, maxTime)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
 	if maxTime.IsZero() {
 		var maxWheelTime time.Time
 		for _, file := range wh.zip.File {
@@ -134,14 +278,14 @@ func InstallWheel(
 		}
 	}
 
-	vfs, installedDistInfoDir, err := wh.installToVFS(ctx, plat, minTime, maxTime)
+	vfs, installedDistInfoDir, err := wh.installToVFS(ctx, plat, minTime, maxTime, timeouts.PyCompile)
 	if err != nil {
-		return nil, fmt.Errorf("bdist.InstallWheel: %w", err)
+		return nil, "", time.Time{}, err
 	}
 
 	if hook != nil {
 		if err := hook(ctx, maxTime, vfs, installedDistInfoDir); err != nil {
-			return nil, fmt.Errorf("bdist.InstallWheel: post-install hook: %w", err)
+			return nil, "", time.Time{}, fmt.Errorf("post-install hook: %w", err)
 		}
 	}
 
@@ -163,26 +307,49 @@ func InstallWheel(
 		}
 	}
 
+	// ZIP files can't contain hardlinks, but they can have multiple entries that point at the
+	// same data; install those as hardlinks.
+	linkTargets := make(map[string]string)
+	for _, group := range hardlinkGroups(vfs) {
+		for _, name := range group[1:] {
+			linkTargets[name] = group[0]
+		}
+	}
+
 	// chown
-	refs := make([]fsutil.FileReference, 0, len(vfs))
-	for _, file := range vfs {
+	ret := make(map[string]fsutil.FileReference, len(vfs))
+	for name, file := range vfs {
+		linkTarget, isLink := linkTargets[name]
 		ref, err := newTarEntry(file, func(header *tar.Header) {
 			header.Uid = plat.UID
 			header.Gid = plat.GID
 			header.Uname = plat.UName
 			header.Gname = plat.GName
+			if header.ModTime.After(maxTime) {
+				header.ModTime = maxTime
+			}
+			if plat.Modes != nil && header.Typeflag != tar.TypeSymlink {
+				perm := header.Mode
+				if plat.Modes.Normalize {
+					perm = wheelPerm(file)
+				}
+				header.Mode = plat.Modes.Apply(perm, header.Typeflag == tar.TypeDir)
+			}
+			if plat.Windows {
+				fsutil.SetWindowsFileAttributes(header, uint32(windowsFileAttributes(file)))
+			}
+			if isLink {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = linkTarget
+				header.Size = 0
+			}
 		})
 		if err != nil {
-			return nil, fmt.Errorf("bdist.InstallWheel: chown: %w", err)
+			return nil, "", time.Time{}, fmt.Errorf("chown: %w", err)
 		}
-		refs = append(refs, ref)
+		ret[name] = ref
 	}
-
-	layer, err := fsutil.LayerFromFileReferences(refs, maxTime, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("bdist.InstallWheel: generate layer: %w", err)
-	}
-	return layer, nil
+	return ret, installedDistInfoDir, maxTime, nil
 }
 
 //
@@ -225,6 +392,7 @@ func (wh *wheel) installToVFS(
 	plat python.Platform,
 	minTime,
 	maxTime time.Time,
+	pyCompileTimeout time.Duration,
 ) (map[string]fsutil.FileReference, string, error) {
 	// Installing a wheel 'distribution-1.0-py32-none-any.whl'
 	// -------------------------------------------------------
@@ -249,7 +417,10 @@ func (wh *wheel) installToVFS(
 			wheelVersion)
 	}
 	if wheelVersion.Cmp(*specVersion) > 0 {
-		dlog.Warnf(ctx, "wheel file's Wheel-Version (%s) is newer than this wheel parser", wheelVersion)
+		if err := warnings.Warnf(ctx, warnings.WheelVersion,
+			"wheel file's Wheel-Version (%s) is newer than this wheel parser", wheelVersion); err != nil {
+			return nil, "", err
+		}
 	}
 	//   c. If Root-Is-Purelib == 'true', unpack archive into purelib
 	//      (site-packages).
@@ -262,9 +433,14 @@ func (wh *wheel) installToVFS(
 	}
 	vfs := make(map[string]fsutil.FileReference)
 	for _, file := range wh.zip.File {
+		dataOffset, err := file.DataOffset()
+		if err != nil {
+			return nil, "", fmt.Errorf("unpack %q: %w", file.Name, err)
+		}
 		create(vfs, minTime, path.Join(dstDir, file.FileHeader.Name), &zipEntry{
-			header: file.FileHeader,
-			open:   file.Open,
+			header:     file.FileHeader,
+			open:       file.Open,
+			dataOffset: dataOffset,
 		})
 	}
 
@@ -286,6 +462,7 @@ func (wh *wheel) installToVFS(
 		panic("should not happen")
 	}
 	vfsTypes := make(map[string]string)
+	schemeDirs := make(map[string]string)
 	dataDir := path.Join(dstDir, strings.TrimSuffix(distInfoDir, ".dist-info")+".data")
 	for fullName := range vfs {
 		if !strings.HasPrefix(fullName, dataDir+"/") {
@@ -311,16 +488,24 @@ func (wh *wheel) installToVFS(
 			dstDataDir = plat.Scheme.Scripts
 		case "data":
 			dstDataDir = plat.Scheme.Data
+		case "include":
+			dstDataDir = plat.Scheme.Include
 		default:
 			return nil, "", fmt.Errorf("unsupported wheel data type %q: %q",
 				key, path.Join(strings.TrimSuffix(distInfoDir, ".dist-info")+".data", relName))
 		}
 		newFullName := path.Join(dstDataDir, rest)
 		vfsTypes[newFullName] = key
+		schemeDirs[newFullName] = dstDataDir
 		if err := rename(vfs, fullName, newFullName); err != nil {
 			return nil, "", fmt.Errorf("spread: %w", err)
 		}
 	}
+	//      (The spec doesn't mention symlinks, but they do appear in real-world wheels; make
+	//      sure that none of them escape the directory that they're installed in to.)
+	if err := checkSymlinks(vfs, dstDir, schemeDirs); err != nil {
+		return nil, "", fmt.Errorf("spread: %w", err)
+	}
 	//   c. If applicable, update scripts starting with ``#!python`` to point
 	//      to the correct interpreter.
 	if err := rewritePython(plat, vfs, vfsTypes); err != nil {
@@ -344,19 +529,31 @@ func (wh *wheel) installToVFS(
 	//      enough to remove .pyc even if it is not mentioned in RECORD.)
 	var srcs []fsutil.FileReference //nolint:prealloc // 'continue' is quite likely
 	for _, file := range vfs {
-		if !strings.HasSuffix(file.Name(), ".py") {
+		if !strings.HasSuffix(file.Name(), ".py") || !file.Mode().IsRegular() {
 			continue
 		}
 		srcs = append(srcs, file)
 	}
-	outs, err := plat.PyCompile(ctx, maxTime, []string{
-		plat.Scheme.PureLib,
-		plat.Scheme.PlatLib,
-	}, srcs)
+	var outs []fsutil.FileReference
+	err = runStep(ctx, pyCompileTimeout, func(ctx context.Context) error {
+		var err error
+		outs, err = plat.PyCompile(ctx, maxTime, []string{
+			plat.Scheme.PureLib,
+			plat.Scheme.PlatLib,
+		}, srcs)
+		return err
+	})
 	if err != nil {
 		return nil, "", fmt.Errorf("py_compile: %w", err)
 	}
 	for _, newFile := range outs {
+		// Catch .pyc files compiled by a different Python version than the target's now, rather
+		// than when the target Python ignores them.
+		if len(plat.MagicNumber) > 0 {
+			if err := checkPycMagicNumber(plat.MagicNumber, newFile); err != nil {
+				return nil, "", fmt.Errorf("py_compile: %q: %w", newFile.FullName(), err)
+			}
+		}
 		vfs[newFile.FullName()] = newFile
 	}
 
@@ -379,7 +576,7 @@ func rewritePython(plat python.Platform, vfs map[string]fsutil.FileReference, vf
 	//     The ``b'#!pythonw'`` convention is allowed. ``b'#!pythonw'`` indicates
 	//     a GUI script instead of a console script.
 	for filename, key := range vfsTypes {
-		if key != "scripts" {
+		if key != "scripts" || !vfs[filename].Mode().IsRegular() {
 			continue
 		}
 		header, err := func() ([]byte, error) {
@@ -400,6 +597,7 @@ func rewritePython(plat python.Platform, vfs map[string]fsutil.FileReference, vf
 		entry := vfs[filename].(*zipEntry) //nolint:forcetypeassert // it's a bug if it's not true
 
 		originalOpen := entry.open
+		entry.dataOffset = -1
 		shebang := plat.ConsoleShebang
 		skip := len("#!python")
 		if bytes.Equal(header, []byte("#!pythonw")) {
@@ -425,9 +623,9 @@ func rewritePython(plat python.Platform, vfs map[string]fsutil.FileReference, vf
 		entry.header.UncompressedSize64 += 2 + uint64(len(shebang))
 		entry.header.UncompressedSize64 -= uint64(skip)
 
-		externalAttrs := python.ParseZIPExternalAttributes(entry.header.ExternalAttrs)
-		externalAttrs.UNIX |= 0o111
-		entry.header.ExternalAttrs = externalAttrs.Raw()
+		// The wheel might have been created on Windows, with no UNIX mode to add +x to.
+		setEntryMode(&entry.header,
+			python.ParseZIPExternalAttributes(entry.header.ExternalAttrs).Mode()|0o111)
 
 		// Arrange for RECORD to contain the pre-rewritten hash and size.
 		// https://github.com/pypa/pip/issues/10744
@@ -517,18 +715,30 @@ var reFilename = regexp.MustCompile(regexp.MustCompile(`\s+`).ReplaceAllString(`
 		-(?P<platform>[^-]+)
 		\.whl$`, ``))
 
+// ParseFilename parses a wheel filename.  The Distribution is returned as it appears in the
+// filename (possibly escaped, and possibly not in normalized form); it is an error if it isn't a
+// name that can be unambiguously normalized (see NormalizeDistribution).
 func ParseFilename(filename string) (*FileNameData, error) {
 	match := reFilename.FindStringSubmatch(filename)
 	if match == nil {
+		if err := unescapedDistributionError(filename); err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("invalid wheel filename: %q", filename)
 	}
 
 	var ret FileNameData
 
 	ret.Distribution = match[reFilename.SubexpIndex("distribution")]
+	if _, err := NormalizeDistribution(ret.Distribution); err != nil {
+		return nil, fmt.Errorf("invalid wheel filename: %q: %w", filename, err)
+	}
 
 	ver, err := pep440.ParseVersion(match[reFilename.SubexpIndex("version")])
 	if err != nil {
+		if err := unescapedDistributionError(filename); err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("invalid wheel filename: %q: %w", filename, err)
 	}
 	ret.Version = *ver
@@ -589,12 +799,18 @@ func (a *BuildTag) Cmp(b *BuildTag) int {
 // this character cannot appear within any component. This is handled as follows:
 //
 
+// GenerateFilename returns the filename for a wheel, with each component escaped and normalized;
+// for a valid filename x, GenerateFilename(ParseFilename(x)) == NormalizeFilename(x).
 func GenerateFilename(data FileNameData) (string, error) {
 	var ret strings.Builder
 	// - In distribution names, any run of ``-_.`` characters (HYPHEN-MINUS, LOW LINE
 	//   and FULL STOP) should be replaced with ``_`` (LOW LINE). This is equivalent
 	//   to :pep:`503` normalisation followed by replacing ``-`` with ``_``.
-	ret.WriteString(regexp.MustCompile("[-_.]+").ReplaceAllLiteralString(data.Distribution, "_"))
+	dist, err := NormalizeDistribution(data.Distribution)
+	if err != nil {
+		return "", err
+	}
+	ret.WriteString(dist)
 	// - Version numbers should be normalised according to :pep:`440`. Normalised
 	//   version numbers cannot contain ``-``.
 	ver, err := data.Version.Normalize()
@@ -630,6 +846,86 @@ func GenerateFilename(data FileNameData) (string, error) {
 // The archive filename is Unicode.  It will be some time before the tools
 // are updated to support non-ASCII filenames, but they are supported in
 // this specification.
+//
+
+var reDistributionSeparators = regexp.MustCompile("[-_.]+")
+
+// NormalizeDistribution returns the escaped form of a distribution name, as it should appear in
+// a wheel filename: normalized per PEP 503 (lower-cased, with runs of "-_." collapsed), and with
+// "-" replaced by "_".  Non-ASCII letters and digits are allowed (and lower-cased), per the
+// Unicode note above.
+//
+// It returns an error if the name can't be unambiguously normalized: if it is empty, if it
+// begins or ends with punctuation, if it contains characters other than letters, digits, and
+// "-_.", or if it contains combining characters (which means that it isn't in Unicode NFC
+// form, and that the same name could be spelled with different code points).
+func NormalizeDistribution(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("invalid distribution name: empty")
+	}
+	if strings.Trim(name, "-_.") != name {
+		return "", fmt.Errorf("invalid distribution name %q: must begin and end with a letter or digit",
+			name)
+	}
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError:
+			return "", fmt.Errorf("invalid distribution name %q: not valid UTF-8", name)
+		case unicode.Is(unicode.Mn, r):
+			return "", fmt.Errorf("invalid distribution name %q: contains combining character %U; "+
+				"use the precomposed (Unicode NFC) form of the name", name, r)
+		case r == '-' || r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			// OK
+		default:
+			return "", fmt.Errorf("invalid distribution name %q: contains %q; "+
+				"only letters, digits, \"-\", \"_\", and \".\" are allowed", name, r)
+		}
+	}
+	return reDistributionSeparators.ReplaceAllLiteralString(strings.ToLower(name), "_"), nil
+}
+
+// NormalizeFilename returns the normalized form of a wheel filename; the filename that
+// GenerateFilename would return for it.
+func NormalizeFilename(filename string) (string, error) {
+	data, err := ParseFilename(filename)
+	if err != nil {
+		return "", err
+	}
+	return GenerateFilename(*data)
+}
+
+// unescapedDistributionError returns an error if filename is invalid because its distribution
+// name contains unescaped "-" characters, or nil if that isn't the problem.
+func unescapedDistributionError(filename string) error {
+	stem := strings.TrimSuffix(filename, ".whl")
+	if stem == filename {
+		return nil
+	}
+	parts := strings.Split(stem, "-")
+	// The version is followed by a build tag and 3 compatibility tag components, or by just the
+	// 3 compatibility tag components.
+	for _, nTrailing := range []int{4, 3} {
+		verIdx := len(parts) - nTrailing - 1
+		if verIdx < 2 {
+			continue
+		}
+		if nTrailing == 4 && (parts[verIdx+1] == "" || !unicode.IsDigit(rune(parts[verIdx+1][0]))) {
+			continue
+		}
+		if _, err := pep440.ParseVersion(parts[verIdx]); err != nil {
+			continue
+		}
+		dist := strings.Join(parts[:verIdx], "-")
+		if _, err := NormalizeDistribution(dist); err != nil {
+			continue
+		}
+		return fmt.Errorf("invalid wheel filename: %q: distribution name %q contains \"-\", "+
+			"which must be escaped as \"_\" (did you mean %q?)",
+			filename, dist, strings.ReplaceAll(dist, "-", "_")+strings.TrimPrefix(filename, dist))
+	}
+	return nil
+}
+
 //
 // The filenames *inside* the archive are encoded as UTF-8.  Although some
 // ZIP clients in common use do not properly display UTF-8 filenames,
@@ -699,6 +995,39 @@ func (wh *wheel) parseDistInfoWheel() (textproto.MIMEHeader, error) {
 	// #. ``Build`` is the build number and is omitted if there is no build number.
 }
 
+// checkTags validates that the compatibility tags in the wheel's filename match the expanded
+// ``Tag`` lines in WHEEL.
+func (wh *wheel) checkTags(ctx context.Context, filename string) error {
+	filenameData, err := ParseFilename(filename)
+	if err != nil {
+		return warnings.Warnf(ctx, warnings.Tags,
+			"unable to verify compatibility tags against the filename: %v", err)
+	}
+	metadata, err := wh.parseDistInfoWheel()
+	if err != nil {
+		return fmt.Errorf("parse .dist-info/WHEEL: %w", err)
+	}
+	tagStrs := metadata.Values("Tag")
+	if len(tagStrs) == 0 {
+		return warnings.Warnf(ctx, warnings.Tags,
+			"unable to verify compatibility tags: .dist-info/WHEEL has no Tag lines")
+	}
+	metadataTags := make([]pep425.Tag, 0, len(tagStrs))
+	for _, tagStr := range tagStrs {
+		tag, err := pep425.ParseTag(tagStr)
+		if err != nil {
+			return fmt.Errorf("parse .dist-info/WHEEL: %w", err)
+		}
+		metadataTags = append(metadataTags, tag)
+	}
+	filenameTags := []pep425.Tag{filenameData.CompatibilityTag}
+	if !pep425.Equal(filenameTags, metadataTags) {
+		return fmt.Errorf("filename tags %q do not match .dist-info/WHEEL tags %q",
+			pep425.Expand(filenameTags), pep425.Expand(metadataTags))
+	}
+	return nil
+}
+
 // #. A wheel installer should warn if Wheel-Version is greater than the
 //    version it supports, and must fail if Wheel-Version has a greater
 //    major version than the version it supports.
@@ -727,13 +1056,54 @@ func (wh *wheel) parseDistInfoWheel() (textproto.MIMEHeader, error) {
 //    not permitted, as signed wheel files rely on the strong hashes in
 //    RECORD to validate the integrity of the archive.
 
-//nolint:gochecknoglobals // Would be 'const'.
-var strongHashes = map[string]func() hash.Hash{
-	// The spec is an open-ended list of hashes, so here's what PIP 20.3.4
-	// pip/_internal/utils/hashes.py includes:
-	"sha256": sha256.New,
-	"sha384": sha512.New384,
-	"sha512": sha512.New,
+//nolint:gochecknoglobals // Can't be a constant.
+var (
+	strongHashes = map[string]func() hash.Hash{
+		// The spec is an open-ended list of hashes, so here's what PIP 20.3.4
+		// pip/_internal/utils/hashes.py includes:
+		"sha256": sha256.New,
+		"sha384": sha512.New384,
+		"sha512": sha512.New,
+		// Plus the other strong hashes in Python's hashlib.algorithms_guaranteed, which
+		// some build backends use:
+		"blake2b":  python.HashlibAlgorithmsGuaranteed["blake2b"],
+		"blake2s":  python.HashlibAlgorithmsGuaranteed["blake2s"],
+		"sha3_256": python.HashlibAlgorithmsGuaranteed["sha3_256"],
+		"sha3_384": python.HashlibAlgorithmsGuaranteed["sha3_384"],
+		"sha3_512": python.HashlibAlgorithmsGuaranteed["sha3_512"],
+		// Plus BLAKE2b with a 256-bit digest, under the name that PyPI uses for it.
+		"blake2b_256": newBlake2b256,
+	}
+	strongHashesMu sync.RWMutex
+)
+
+func newBlake2b256() hash.Hash {
+	h, err := blake2b.New256(nil)
+	if err != nil {
+		// Can only fail if given a key that is too long.
+		panic(err)
+	}
+	return h
+}
+
+// RegisterHash adds a hash algorithm to the set that may be used in a wheel's RECORD file, or
+// replaces the implementation of an algorithm that is already in the set.  The name is the name
+// that appears in RECORD (such as "sha256").  Per the spec, the algorithm must be "sha256 or
+// better"; it is up to the caller to not register a weak algorithm such as md5 or sha1.
+//
+// RegisterHash is safe to call concurrently with InstallWheel, but usually it should be called
+// during program initialization.
+func RegisterHash(name string, newHash func() hash.Hash) {
+	strongHashesMu.Lock()
+	defer strongHashesMu.Unlock()
+	strongHashes[name] = newHash
+}
+
+func lookupHash(name string) (func() hash.Hash, bool) {
+	strongHashesMu.RLock()
+	defer strongHashesMu.RUnlock()
+	newHash, ok := strongHashes[name]
+	return newHash, ok
 }
 
 // #. PEP 376's INSTALLER and REQUESTED are not included in the archive.
@@ -810,7 +1180,7 @@ var strongHashes = map[string]func() hash.Hash{
 //
 //
 
-func (wh *wheel) integrityCheck() error {
+func (wh *wheel) integrityCheck(ctx context.Context) error {
 	distInfoDir, err := wh.distInfoDir()
 	if err != nil {
 		return err
@@ -832,10 +1202,15 @@ func (wh *wheel) integrityCheck() error {
 		}
 	}
 
+	permissive := permissiveRecord(ctx)
+
 	recordData, err := func() ([][]string, error) {
 		recordName := path.Join(distInfoDir, "RECORD")
 		reader, err := wh.Open(recordName)
 		if err != nil {
+			if permissive && errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
 			return nil, err
 		}
 		defer func() {
@@ -848,43 +1223,36 @@ func (wh *wheel) integrityCheck() error {
 		return data, nil
 	}()
 	if err != nil {
-		return err
+		return integrityError{err}
+	}
+	if recordData == nil && permissive {
+		return warnings.Warnf(ctx, warnings.Record,
+			"wheel has no (or an empty) %s; not verifying any files", path.Join(distInfoDir, "RECORD"))
 	}
 
-	checkFile := func(filename, algo string) (hashsum string, size int64, err error) {
-		reader, err := wh.Open(filename)
-		if err != nil {
-			return "", 0, err
-		}
-		defer func() {
-			_ = reader.Close()
-		}()
-
-		var (
-			hasher hash.Hash
-			dst    = io.Discard
-		)
-		if algo != "" {
-			newHasher, ok := strongHashes[algo]
-			if !ok {
-				return "", 0, fmt.Errorf("unsupported hash algorithm: %q", algo)
-			}
-			hasher = newHasher()
-			dst = hasher
-		}
-
-		size, err = io.Copy(dst, reader)
-		if err != nil {
-			return "", 0, err
-		}
-
-		if hasher != nil {
-			hashsum = algo + "=" + base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+	// Validate the rows, and figure out which files need to be hashed.
+	var jobs []recordJob
+	for i, row := range recordData {
+		if len(row) != 3 {
+			continue
 		}
+		name, recHashsum := path.Clean(row[0]), row[1]
+		delete(todo, name)
+		jobs = append(jobs, recordJob{
+			Row:  i,
+			Name: name,
+			Algo: strings.SplitN(recHashsum, "=", 2)[0],
+		})
+	}
 
-		return hashsum, size, err
+	// Hash the files; this is the slow part, so it is done in parallel.
+	results := make([]recordResult, len(recordData))
+	if err := wh.hashFiles(ctx, jobs, results); err != nil {
+		return err
 	}
 
+	// Report errors in the order of the RECORD rows, regardless of the order that the files
+	// were hashed in.
 	var errs derror.MultiError
 	for i, row := range recordData {
 		if len(row) != 3 {
@@ -892,30 +1260,32 @@ func (wh *wheel) integrityCheck() error {
 			continue
 		}
 		name, recHashsum, recSize := path.Clean(row[0]), row[1], row[2]
-		delete(todo, name)
 		if recHashsum == "" || recSize == "" {
-			switch name {
-			case path.Join(distInfoDir, "RECORD"):
+			switch {
+			case name == path.Join(distInfoDir, "RECORD"):
 				// skip
+			case permissive:
+				if err := warnings.Warnf(ctx, warnings.Record, "RECORD row %d: missing hash or size: %q", i, row); err != nil {
+					errs = append(errs, err)
+				}
 			default:
 				errs = append(errs, fmt.Errorf("RECORD row %d: missing hash or size: %q", i, row))
 			}
 		}
 
-		algo := strings.SplitN(recHashsum, "=", 2)[0]
-		actHashsum, actSize, err := checkFile(name, algo)
-		if err != nil {
+		result := results[i]
+		if result.Err != nil {
 			errs = append(errs, fmt.Errorf("RECORD row %d: file %q: %w",
-				i, name, err))
+				i, name, result.Err))
 			continue
 		}
-		if recHashsum != "" && actHashsum != recHashsum {
+		if recHashsum != "" && result.Hashsum != recHashsum {
 			errs = append(errs, fmt.Errorf("RECORD row %d: file %q: checksum mismatch: RECORD=%q actual=%q",
-				i, name, recHashsum, actHashsum))
+				i, name, recHashsum, result.Hashsum))
 		}
-		if recSize != "" && strconv.FormatInt(actSize, 10) != recSize {
+		if recSize != "" && strconv.FormatInt(result.Size, 10) != recSize {
 			errs = append(errs, fmt.Errorf("RECORD row %d: file %q: size mismatch: RECORD=%s actual=%d",
-				i, name, recSize, actSize))
+				i, name, recSize, result.Size))
 		}
 	}
 
@@ -925,11 +1295,17 @@ func (wh *wheel) integrityCheck() error {
 			todoNames = append(todoNames, name)
 		}
 		sort.Strings(todoNames)
-		errs = append(errs, fmt.Errorf("files not mentioned in RECORD: %q", todoNames))
+		if permissive {
+			if err := warnings.Warnf(ctx, warnings.Record, "files not mentioned in RECORD: %q", todoNames); err != nil {
+				errs = append(errs, err)
+			}
+		} else {
+			errs = append(errs, fmt.Errorf("files not mentioned in RECORD: %q", todoNames))
+		}
 	}
 
 	if len(errs) > 0 {
-		return errs
+		return integrityError{errs}
 	}
 
 	return nil
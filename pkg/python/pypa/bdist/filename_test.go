@@ -0,0 +1,77 @@
+package bdist_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestFilenameRoundTrip(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]string{
+		"foo-1.0-py3-none-any.whl":                        "foo-1.0-py3-none-any.whl",
+		"Foo_Bar-1.0-py3-none-any.whl":                    "foo_bar-1.0-py3-none-any.whl",
+		"zope.interface-5.4.0-cp39-cp39-linux_x86_64.whl": "zope_interface-5.4.0-cp39-cp39-linux_x86_64.whl",
+		"a__b..c-1.0-1build-py2.py3-none-any.whl":         "a_b_c-1.0-1build-py2.py3-none-any.whl",
+		"foo-1.0.0rc1-py3-none-any.whl":                   "foo-1.0.0rc1-py3-none-any.whl",
+		"foo-1.0.0-RC1-py3-none-any.whl":                  "",
+		"Ñandú-2.0-py3-none-any.whl":                      "ñandú-2.0-py3-none-any.whl",
+		"Straße-1.0-py3-none-any.whl":                     "straße-1.0-py3-none-any.whl",
+	}
+	for input, expected := range testcases {
+		input, expected := input, expected
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+			normalized, err := bdist.NormalizeFilename(input)
+			if expected == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, expected, normalized)
+
+			data, err := bdist.ParseFilename(input)
+			require.NoError(t, err)
+			generated, err := bdist.GenerateFilename(*data)
+			require.NoError(t, err)
+			assert.Equal(t, normalized, generated)
+
+			// Normalizing is idempotent.
+			again, err := bdist.NormalizeFilename(normalized)
+			require.NoError(t, err)
+			assert.Equal(t, normalized, again)
+		})
+	}
+}
+
+func TestFilenameInvalid(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]string{
+		"foo-bar-1.0-py3-none-any.whl": `invalid wheel filename: "foo-bar-1.0-py3-none-any.whl": ` +
+			`distribution name "foo-bar" contains "-", which must be escaped as "_" ` +
+			`(did you mean "foo_bar-1.0-py3-none-any.whl"?)`,
+		"foo-bar-1.0-2-py3-none-any.whl": `invalid wheel filename: "foo-bar-1.0-2-py3-none-any.whl": ` +
+			`distribution name "foo-bar" contains "-", which must be escaped as "_" ` +
+			`(did you mean "foo_bar-1.0-2-py3-none-any.whl"?)`,
+		"_foo-1.0-py3-none-any.whl": `invalid wheel filename: "_foo-1.0-py3-none-any.whl": ` +
+			`invalid distribution name "_foo": must begin and end with a letter or digit`,
+		"foo+bar-1.0-py3-none-any.whl": `invalid wheel filename: "foo+bar-1.0-py3-none-any.whl": ` +
+			`invalid distribution name "foo+bar": contains '+'; ` +
+			`only letters, digits, "-", "_", and "." are allowed`,
+		"Nañdu-1.0-py3-none-any.whl": `invalid wheel filename: "Nañdu-1.0-py3-none-any.whl": ` +
+			`invalid distribution name "Nañdu": contains combining character U+0303; ` +
+			`use the precomposed (Unicode NFC) form of the name`,
+		"foo-1.0-py3-none.whl": `invalid wheel filename: "foo-1.0-py3-none.whl"`,
+	}
+	for input, expected := range testcases {
+		input, expected := input, expected
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+			_, err := bdist.ParseFilename(input)
+			assert.EqualError(t, err, expected)
+		})
+	}
+}
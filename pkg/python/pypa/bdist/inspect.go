@@ -0,0 +1,175 @@
+package bdist
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"path"
+	"path/filepath"
+
+	"github.com/datawire/dlib/derror"
+
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep345"
+)
+
+// WheelInfo is a summary of a wheel file's contents, for debugging wheels.
+type WheelInfo struct {
+	// Filename is the parsed wheel filename; it is nil if the filename couldn't be parsed.
+	Filename    *FileNameData        `json:"filename"`
+	DistInfoDir string               `json:"distInfoDir"`
+	Wheel       textproto.MIMEHeader `json:"wheel"`
+	Metadata    textproto.MIMEHeader `json:"metadata"`
+	EntryPoints python.Config        `json:"entryPoints,omitempty"`
+	// RecordErrors are the problems found when verifying the files in the wheel against
+	// RECORD; if it is empty then RECORD is fine, and if it is nil then RECORD wasn't checked.
+	RecordErrors []string `json:"recordErrors"`
+	// InstalledSize is the total size of the files in the wheel once extracted; it does not
+	// include compiled bytecode or generated scripts, so the real installed size will be
+	// somewhat larger.
+	InstalledSize int64 `json:"installedSize"`
+	// Errors are problems that prevented filling in other fields.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (data FileNameData) MarshalJSON() ([]byte, error) {
+	var buildTag *string
+	if data.BuildTag != nil {
+		str := data.BuildTag.String()
+		buildTag = &str
+	}
+	return json.Marshal(struct {
+		Distribution     string  `json:"distribution"`
+		Version          string  `json:"version"`
+		BuildTag         *string `json:"buildTag"`
+		CompatibilityTag string  `json:"compatibilityTag"`
+	}{
+		Distribution:     data.Distribution,
+		Version:          data.Version.String(),
+		BuildTag:         buildTag,
+		CompatibilityTag: data.CompatibilityTag.String(),
+	})
+}
+
+// InspectWheel reads as much information as it can from a wheel file, without installing it.
+// Unlike InstallWheel, problems with the wheel are reported in the returned WheelInfo rather than
+// as errors; an error is only returned if the file isn't a readable zip archive with a .dist-info
+// directory.
+func InspectWheel(wheelfilename string) (*WheelInfo, error) {
+	zipReader, err := zip.OpenReader(wheelfilename)
+	if err != nil {
+		return nil, fmt.Errorf("bdist.InspectWheel: open wheel: %w", err)
+	}
+	defer zipReader.Close()
+
+	info, err := inspectWheel(filepath.Base(wheelfilename), &zipReader.Reader, true)
+	if err != nil {
+		return nil, fmt.Errorf("bdist.InspectWheel: %w", err)
+	}
+	return info, nil
+}
+
+// InspectWheelMetadata is like InspectWheel, but for an already-opened zip archive (such as a
+// remote wheel opened with pep503.Client.OpenZip), and it only reads the files in the .dist-info
+// directory; it does not verify the files against RECORD, as that would require reading every
+// file in the wheel.  RecordErrors is nil in the returned WheelInfo.
+func InspectWheelMetadata(wheelfilename string, zipReader *zip.Reader) (*WheelInfo, error) {
+	info, err := inspectWheel(wheelfilename, zipReader, false)
+	if err != nil {
+		return nil, fmt.Errorf("bdist.InspectWheelMetadata: %w", err)
+	}
+	return info, nil
+}
+
+func inspectWheel(wheelfilename string, zipReader *zip.Reader, checkRecord bool) (*WheelInfo, error) {
+	wh := &wheel{ //nolint:varnamelen // same as receiver name
+		zip: zipReader,
+
+		cachedDistInfoDir: "", // don't know it yet
+	}
+
+	distInfoDir, err := wh.distInfoDir()
+	if err != nil {
+		return nil, err
+	}
+	info := &WheelInfo{ //nolint:exhaustivestruct // filled in below
+		DistInfoDir: distInfoDir,
+	}
+
+	if info.Filename, err = ParseFilename(wheelfilename); err != nil {
+		info.Errors = append(info.Errors, err.Error())
+	}
+
+	if info.Wheel, err = wh.parseDistInfoWheel(); err != nil {
+		info.Errors = append(info.Errors, fmt.Sprintf("WHEEL: %v", err))
+	}
+
+	if metadataFile, err := wh.Open(path.Join(distInfoDir, "METADATA")); err != nil {
+		info.Errors = append(info.Errors, fmt.Sprintf("METADATA: %v", err))
+	} else {
+		info.Metadata, err = pep345.ParseMetadata(metadataFile)
+		_ = metadataFile.Close()
+		if err != nil {
+			info.Errors = append(info.Errors, fmt.Sprintf("METADATA: %v", err))
+		}
+	}
+
+	if entryPointsFile, err := wh.Open(path.Join(distInfoDir, "entry_points.txt")); err == nil {
+		info.EntryPoints, err = python.ParseEntryPoints(entryPointsFile)
+		_ = entryPointsFile.Close()
+		if err != nil {
+			info.Errors = append(info.Errors, fmt.Sprintf("entry_points.txt: %v", err))
+		}
+	}
+
+	if checkRecord {
+		info.RecordErrors = []string{}
+		if err := wh.integrityCheck(context.Background()); err != nil {
+			var errs derror.MultiError
+			if errors.As(err, &errs) {
+				for _, err := range errs {
+					info.RecordErrors = append(info.RecordErrors, err.Error())
+				}
+			} else {
+				info.RecordErrors = append(info.RecordErrors, err.Error())
+			}
+		}
+	}
+
+	for _, file := range wh.zip.File {
+		if !file.FileInfo().IsDir() {
+			info.InstalledSize += int64(file.UncompressedSize64)
+		}
+	}
+
+	return info, nil
+}
+
+// ReadMetadataFile returns the raw content of a wheel's .dist-info/METADATA file, such as for
+// serving it separately from the wheel (PEP 658).
+func ReadMetadataFile(zipReader *zip.Reader) ([]byte, error) {
+	wh := &wheel{ //nolint:varnamelen // same as receiver name
+		zip: zipReader,
+
+		cachedDistInfoDir: "", // don't know it yet
+	}
+	distInfoDir, err := wh.distInfoDir()
+	if err != nil {
+		return nil, fmt.Errorf("bdist.ReadMetadataFile: %w", err)
+	}
+	metadataFile, err := wh.Open(path.Join(distInfoDir, "METADATA"))
+	if err != nil {
+		return nil, fmt.Errorf("bdist.ReadMetadataFile: %w", err)
+	}
+	defer metadataFile.Close()
+	content, err := io.ReadAll(metadataFile)
+	if err != nil {
+		return nil, fmt.Errorf("bdist.ReadMetadataFile: %w", err)
+	}
+	return content, nil
+}
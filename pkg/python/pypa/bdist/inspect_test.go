@@ -0,0 +1,76 @@
+package bdist_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestInspectWheel(t *testing.T) {
+	t.Parallel()
+	const wheelFile = "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n"
+
+	t.Run("good", func(t *testing.T) {
+		t.Parallel()
+		info, err := bdist.InspectWheel(writeWheel(t, "foo-1.0-1-py3-none-any.whl", map[string]string{
+			"foo/__init__.py":                    "print('hello')\n",
+			"foo-1.0.dist-info/WHEEL":            wheelFile,
+			"foo-1.0.dist-info/METADATA":         "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n",
+			"foo-1.0.dist-info/entry_points.txt": "[console_scripts]\nFoo = foo:main\n",
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, "foo-1.0.dist-info", info.DistInfoDir)
+		require.NotNil(t, info.Filename)
+		assert.Equal(t, "foo", info.Filename.Distribution)
+		assert.Equal(t, []string{"py3-none-any"}, info.Wheel["Tag"])
+		assert.Equal(t, "foo", info.Metadata.Get("Name"))
+		assert.Equal(t, python.Config{"console_scripts": {"Foo": "foo:main"}}, info.EntryPoints)
+		assert.Equal(t, []string{}, info.RecordErrors)
+		assert.Nil(t, info.Errors)
+		assert.Greater(t, info.InstalledSize, int64(len(wheelFile)))
+
+		jsonBytes, err := json.Marshal(info.Filename)
+		require.NoError(t, err)
+		assert.JSONEq(t,
+			`{"distribution":"foo","version":"1.0","buildTag":"1","compatibilityTag":"py3-none-any"}`,
+			string(jsonBytes))
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		t.Parallel()
+		// Problems with the wheel are reported in the WheelInfo, rather than as an error.
+		info, err := bdist.InspectWheel(writeWheel(t, "foo.whl", map[string]string{
+			"foo-1.0.dist-info/METADATA":         "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n",
+			"foo-1.0.dist-info/entry_points.txt": "console_scripts = foo:main\n",
+		}))
+		require.NoError(t, err)
+		assert.Nil(t, info.Filename)
+		assert.Nil(t, info.EntryPoints)
+		require.Len(t, info.Errors, 3)
+		assert.Contains(t, info.Errors[1], "WHEEL: ")
+		assert.Contains(t, info.Errors[2], "entry_points.txt: line 1: no section header")
+	})
+
+	t.Run("record", func(t *testing.T) {
+		t.Parallel()
+		info, err := bdist.InspectWheel(writeRecordWheel(t, 3, "sha256", sha256.New, 1))
+		require.NoError(t, err)
+		assert.Nil(t, info.Errors)
+		require.Len(t, info.RecordErrors, 3)
+		assert.Contains(t, info.RecordErrors[0], `file "foo/data000.txt": size mismatch`)
+	})
+
+	t.Run("not-a-wheel", func(t *testing.T) {
+		t.Parallel()
+		_, err := bdist.InspectWheel(writeWheel(t, "foo-1.0-py3-none-any.whl", map[string]string{
+			"foo/__init__.py": "",
+		}))
+		assert.Error(t, err)
+	})
+}
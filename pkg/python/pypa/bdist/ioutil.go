@@ -4,10 +4,12 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -43,6 +45,15 @@ type readCloser struct {
 type zipEntry struct {
 	header zip.FileHeader
 	open   func() (io.ReadCloser, error)
+
+	// dataOffset is the offset of the file's content within the wheel file, or -1 if the
+	// content has been altered.  Multiple entries with the same dataOffset share content, and
+	// are installed as hardlinks to one another.
+	dataOffset int64
+
+	// wheelMode is the UNIX mode that the wheel recorded for the file, before create()
+	// normalized it; it is zero if the wheel didn't record one.
+	wheelMode python.StatMode
 }
 
 func (f *zipEntry) FullName() string             { return path.Clean(f.header.Name) }
@@ -81,18 +92,19 @@ func create(vfs map[string]fsutil.FileReference, mtime time.Time, name string, c
 		content.header.Name += "/"
 	}
 
+	content.wheelMode = python.ParseZIPExternalAttributes(content.header.ExternalAttrs).UNIX
+
 	// Discard all permission info except the "execute" bit.
-	var externalAttrs python.ZIPExternalAttributes
 	switch {
 	case isDir:
-		externalAttrs.UNIX = python.ModeFmtDir | 0o755
+		setEntryMode(&content.header, fs.ModeDir|0o755)
+	case isSymlink(content.header):
+		setEntryMode(&content.header, fs.ModeSymlink|0o777)
 	case isExecutable(content.header):
-		externalAttrs.UNIX = python.ModeFmtRegular | 0o755
+		setEntryMode(&content.header, 0o755)
 	default:
-		externalAttrs.UNIX = python.ModeFmtRegular | 0o644
+		setEntryMode(&content.header, 0o644)
 	}
-	content.header.CreatorVersion = 3 << 8 // force Creator=UNIX
-	content.header.ExternalAttrs = externalAttrs.Raw()
 
 	if !mtime.IsZero() {
 		// this kills me, but it reflects what `pip` does
@@ -117,7 +129,14 @@ func (f *tarEntry) Sys() interface{}             { return f.header }
 func (f *tarEntry) Open() (io.ReadCloser, error) { return f.open() }
 
 func newTarEntry(inFile fsutil.FileReference, fn func(*tar.Header)) (fsutil.FileReference, error) {
-	header, err := tar.FileInfoHeader(inFile, "")
+	var symlinkTarget string
+	if inFile.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		if symlinkTarget, err = readSymlink(inFile); err != nil {
+			return nil, err
+		}
+	}
+	header, err := tar.FileInfoHeader(inFile, symlinkTarget)
 	if err != nil {
 		return nil, err
 	}
@@ -128,3 +147,73 @@ func newTarEntry(inFile fsutil.FileReference, fn func(*tar.Header)) (fsutil.File
 		open:   inFile.Open,
 	}, nil
 }
+
+// hardlinkGroups returns the names of files in vfs that are unaltered ZIP entries sharing content
+// with another such entry, grouped by the content that they share.  Within each group the names
+// are sorted with fsutil.PathLess, so that the first name is the one that comes first in the
+// layer and is the one that the others should be hardlinks to.
+func hardlinkGroups(vfs map[string]fsutil.FileReference) [][]string {
+	byOffset := make(map[int64][]string)
+	for name, file := range vfs {
+		entry, ok := file.(*zipEntry)
+		if !ok || entry.dataOffset < 0 || !entry.Mode().IsRegular() {
+			continue
+		}
+		byOffset[entry.dataOffset] = append(byOffset[entry.dataOffset], name)
+	}
+	var groups [][]string
+	for _, names := range byOffset {
+		if len(names) < 2 {
+			continue
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return fsutil.PathLess(names[i], names[j])
+		})
+		groups = append(groups, names)
+	}
+	return groups
+}
+
+// readSymlink returns the path that a symlink points to; like a ZIP file, the content of a symlink
+// is that path.
+func readSymlink(file fsutil.FileReference) (string, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("read symlink %q: %w", file.FullName(), err)
+	}
+	defer reader.Close()
+	target, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("read symlink %q: %w", file.FullName(), err)
+	}
+	return string(target), nil
+}
+
+// checkSymlinks returns an error if any symlink in vfs points somewhere other than inside of the
+// scheme directory that it is installed in to; schemeDirs maps the names of files from the
+// wheel's .data directory to their scheme directory, and every other file is in rootDir.  A wheel
+// with an absolute symlink, or with a ".." symlink that climbs out of the scheme directory, would
+// depend on (or expose) files that aren't part of the package.
+func checkSymlinks(vfs map[string]fsutil.FileReference, rootDir string, schemeDirs map[string]string) error {
+	for name, file := range vfs {
+		if file.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		target, err := readSymlink(file)
+		if err != nil {
+			return err
+		}
+		schemeDir, ok := schemeDirs[name]
+		if !ok {
+			schemeDir = rootDir
+		}
+		switch {
+		case path.IsAbs(target):
+			return fmt.Errorf("symlink %q: absolute target %q is not permitted", name, target)
+		case !fsutil.IsUnder(path.Join(path.Dir(name), target), schemeDir):
+			return fmt.Errorf("symlink %q: target %q is outside of the scheme directory %q",
+				name, target, schemeDir)
+		}
+	}
+	return nil
+}
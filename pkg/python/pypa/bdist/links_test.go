@@ -0,0 +1,201 @@
+package bdist_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+type linkTestFile struct {
+	Name    string
+	Content string
+	Mode    fs.FileMode
+	// SameAs is the index of an earlier file that this file's ZIP entry should share data with.
+	SameAs int
+}
+
+// writeLinkWheel writes a wheel containing the given files (plus a RECORD).  Entries with SameAs
+// set have their central directory record pointed at the data of an earlier entry, which is how a
+// ZIP file can express a hardlink.
+func writeLinkWheel(t *testing.T, files []linkTestFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	var record strings.Builder
+	for _, file := range files {
+		header := &zip.FileHeader{Name: file.Name, Method: zip.Store} //nolint:exhaustivestruct
+		header.SetMode(file.Mode)
+		w, err := zipWriter.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, file.Content)
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte(file.Content))
+		fmt.Fprintf(&record, "%s,sha256=%s,%d\n",
+			file.Name, base64.RawURLEncoding.EncodeToString(sum[:]), len(file.Content))
+	}
+	w, err := zipWriter.Create("foo-1.0.dist-info/RECORD")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, record.String()+"foo-1.0.dist-info/RECORD,,\n")
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+
+	// Patch the "relative offset of local header" field of the central directory records.
+	zipBytes := buf.Bytes()
+	sig := []byte{0x50, 0x4b, 0x01, 0x02}
+	offsetFields := make([][]byte, 0, len(files))
+	for pos := 0; len(offsetFields) < len(files); pos += len(sig) {
+		idx := bytes.Index(zipBytes[pos:], sig)
+		require.GreaterOrEqual(t, idx, 0)
+		pos += idx
+		offsetFields = append(offsetFields, zipBytes[pos+42:pos+46])
+	}
+	for i, file := range files {
+		if file.SameAs > 0 {
+			copy(offsetFields[i], offsetFields[file.SameAs])
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "foo-1.0-py3-none-any.whl")
+	require.NoError(t, os.WriteFile(filename, zipBytes, 0o644))
+	return filename
+}
+
+const (
+	linkTestMetadata = "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n"
+	linkTestWheel    = "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n"
+)
+
+func linkTestPlatform() python.Platform {
+	return python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			return nil, nil
+		},
+	}
+}
+
+func TestInstallWheelLinks(t *testing.T) {
+	t.Parallel()
+	filename := writeLinkWheel(t, []linkTestFile{
+		{Name: "foo-1.0.dist-info/METADATA", Content: linkTestMetadata, Mode: 0o644},
+		{Name: "foo-1.0.dist-info/WHEEL", Content: linkTestWheel, Mode: 0o644},
+		{Name: "foo/data.txt", Content: "shared data", Mode: 0o644},
+		{Name: "foo/a/copy.txt", Content: "shared data", Mode: 0o644, SameAs: 2},
+		{Name: "foo/current", Content: "a", Mode: fs.ModeSymlink | 0o777},
+		{Name: "foo/a/up", Content: "../data.txt", Mode: fs.ModeSymlink | 0o777},
+	})
+	layer, err := bdist.InstallWheel(context.Background(), linkTestPlatform(), time.Time{}, time.Time{},
+		filename, nil)
+	require.NoError(t, err)
+
+	layerReader, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer layerReader.Close()
+	type entry struct {
+		Type     byte
+		Linkname string
+		Content  string
+	}
+	entries := make(map[string]entry)
+	tarReader := tar.NewReader(layerReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		entries[strings.TrimPrefix(header.Name, "usr/lib/python3/site-packages/")] = entry{
+			Type:     header.Typeflag,
+			Linkname: header.Linkname,
+			Content:  string(content),
+		}
+	}
+	// "foo/a/copy.txt" sorts before "foo/data.txt", so it is the one that gets the content.
+	assert.Equal(t, entry{Type: tar.TypeReg, Content: "shared data"}, entries["foo/a/copy.txt"])
+	assert.Equal(t, entry{Type: tar.TypeLink, Linkname: "usr/lib/python3/site-packages/foo/a/copy.txt"},
+		entries["foo/data.txt"])
+	assert.Equal(t, entry{Type: tar.TypeSymlink, Linkname: "a"}, entries["foo/current"])
+	assert.Equal(t, entry{Type: tar.TypeSymlink, Linkname: "../data.txt"}, entries["foo/a/up"])
+}
+
+func TestInstallWheelMaliciousSymlinks(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Name   string
+		Target string
+		Err    string
+	}{
+		"absolute": {
+			Name:   "foo/passwd",
+			Target: "/etc/passwd",
+			Err: `symlink "usr/lib/python3/site-packages/foo/passwd": ` +
+				`absolute target "/etc/passwd" is not permitted`,
+		},
+		"dotdot": {
+			Name:   "foo/passwd",
+			Target: "../../../../../etc/passwd",
+			Err: `symlink "usr/lib/python3/site-packages/foo/passwd": target "../../../../../etc/passwd" ` +
+				`is outside of the scheme directory "usr/lib/python3/site-packages"`,
+		},
+		"dotdot-sibling": {
+			Name:   "foo/other",
+			Target: "../../dist-packages/other",
+			Err: `symlink "usr/lib/python3/site-packages/foo/other": target "../../dist-packages/other" ` +
+				`is outside of the scheme directory "usr/lib/python3/site-packages"`,
+		},
+		"data-scripts": {
+			// Even though purelib is also in the layer, a script may only point within
+			// the scripts directory.
+			Name:   "foo-1.0.data/scripts/foo",
+			Target: "../lib/python3/site-packages/foo/__main__.py",
+			Err: `symlink "usr/bin/foo": target "../lib/python3/site-packages/foo/__main__.py" ` +
+				`is outside of the scheme directory "usr/bin"`,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			filename := writeLinkWheel(t, []linkTestFile{
+				{Name: "foo-1.0.dist-info/METADATA", Content: linkTestMetadata, Mode: 0o644},
+				{Name: "foo-1.0.dist-info/WHEEL", Content: linkTestWheel, Mode: 0o644},
+				{Name: tcData.Name, Content: tcData.Target, Mode: fs.ModeSymlink | 0o777},
+			})
+			_, err := bdist.InstallWheel(context.Background(), linkTestPlatform(), time.Time{}, time.Time{},
+				filename, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tcData.Err)
+		})
+	}
+}
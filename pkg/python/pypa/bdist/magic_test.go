@@ -0,0 +1,94 @@
+package bdist_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestPycMagicNumber(t *testing.T) {
+	t.Parallel()
+	filename := writeWheel(t, "foo-1.0-py3-none-any.whl", map[string]string{
+		"foo/__init__.py":            "",
+		"foo-1.0.dist-info/METADATA": "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n",
+		"foo-1.0.dist-info/WHEEL":    "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n",
+	})
+	py311 := []byte("\xa7\x0d\r\n")
+	py312 := []byte("\xcb\x0d\r\n")
+
+	// compilerFor returns a fake compiler that emits .pyc files with the given magic number.
+	compilerFor := func(magic []byte) python.Compiler {
+		return func(_ context.Context, _ time.Time, _ []string, inFiles []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			var outFiles []fsutil.FileReference
+			for _, inFile := range inFiles {
+				name := strings.TrimSuffix(inFile.FullName(), ".py") + ".pyc"
+				content := append(append([]byte(nil), magic...), make([]byte, 12)...)
+				outFiles = append(outFiles, &fsutil.InMemFileReference{
+					FileInfo: (&tar.Header{
+						Typeflag: tar.TypeReg,
+						Name:     name,
+						Mode:     0o644,
+						Size:     int64(len(content)),
+					}).FileInfo(),
+					MFullName: name,
+					MContent:  content,
+				})
+			}
+			return outFiles, nil
+		}
+	}
+
+	type testcase struct {
+		PlatformMagic  []byte
+		CompilerMagic  []byte
+		ExpectedSubstr string
+	}
+	testcases := map[string]testcase{
+		"match":    {PlatformMagic: py311, CompilerMagic: py311},
+		"no-check": {PlatformMagic: nil, CompilerMagic: py312},
+		"mismatch": {
+			PlatformMagic:  py311,
+			CompilerMagic:  py312,
+			ExpectedSubstr: "got cb0d0d0a (Python 3.12), but expected a70d0d0a (Python 3.11)",
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			plat := python.Platform{ //nolint:exhaustivestruct
+				ConsoleShebang: "/usr/bin/python3",
+				MagicNumber:    tcData.PlatformMagic,
+				Scheme: python.Scheme{
+					PureLib: "/usr/lib/python3/site-packages",
+					PlatLib: "/usr/lib/python3/site-packages",
+					Headers: "/usr/include/python3",
+					Scripts: "/usr/bin",
+					Data:    "/usr",
+					Include: "",
+				},
+				PyCompile: compilerFor(tcData.CompilerMagic),
+			}
+			_, err := bdist.InstallWheel(context.Background(), plat, time.Time{}, time.Time{}, filename, nil)
+			if tcData.ExpectedSubstr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, python.ErrMagicNumber), err.Error())
+			assert.Contains(t, err.Error(), tcData.ExpectedSubstr)
+		})
+	}
+}
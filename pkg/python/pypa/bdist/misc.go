@@ -3,9 +3,11 @@ package bdist
 import (
 	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"path"
-	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -25,21 +27,82 @@ func sanitizePlatformForLayer(plat python.Platform) (python.Platform, error) {
 		&plat.Scheme.Headers,
 		&plat.Scheme.Scripts,
 		&plat.Scheme.Data,
+		&plat.Scheme.Include,
 	}
 	for _, pathPtr := range paths {
-		clean := strings.TrimPrefix(filepath.ToSlash(*pathPtr), "/")
+		clean := strings.TrimPrefix(plat.ToSlash(*pathPtr), "/")
 		*pathPtr = clean
 	}
 
 	return plat, nil
 }
 
+// isSymlink returns whether the ZIP entry is a symbolic link; as with Info-ZIP, the content of the
+// entry is the path that the link points to.
+func isSymlink(fh zip.FileHeader) bool {
+	return fh.Mode()&fs.ModeSymlink != 0
+}
+
 // This is based off of pip/_internal/utils/unpacking.py:zip_item_is_executable()`
 func isExecutable(fh zip.FileHeader) bool {
 	externalAttrs := python.ParseZIPExternalAttributes(fh.ExternalAttrs)
 	return externalAttrs.UNIX.IsRegular() && (externalAttrs.UNIX&0o111 != 0)
 }
 
+// setEntryMode sets the external attributes of the ZIP entry header to describe the mode goMode,
+// keeping the MS-DOS "hidden" and "system" attributes (for Windows-flavored platforms), and marks
+// the entry as created on UNIX so that readers look at the UNIX half.
+func setEntryMode(header *zip.FileHeader, goMode fs.FileMode) {
+	oldAttrs := python.ParseZIPExternalAttributes(header.ExternalAttrs)
+	newAttrs := python.ZIPExternalAttributesFromMode(goMode)
+	newAttrs.MSDOS |= oldAttrs.MSDOS & (python.DOSHidden | python.DOSSystem)
+	header.CreatorVersion = 3 << 8 // force Creator=UNIX
+	header.ExternalAttrs = newAttrs.Raw()
+}
+
+// windowsFileAttributes returns the Windows file attributes that file should be installed with on a
+// Windows-flavored platform.
+func windowsFileAttributes(file fsutil.FileReference) python.StatFileAttribute {
+	if rec, ok := file.(*withRecord); ok {
+		file = rec.FileReference
+	}
+	if entry, ok := file.(*zipEntry); ok {
+		return python.ParseZIPExternalAttributes(entry.header.ExternalAttrs).FileAttributes()
+	}
+	return python.ZIPExternalAttributes{ //nolint:exhaustivestruct
+		UNIX: python.ModeFromGo(file.Mode()),
+	}.FileAttributes()
+}
+
+// wheelPerm returns the permission bits that file had in the wheel (for a python.ModePolicy to look
+// at), falling back to its current permission bits for files that didn't come from the wheel or
+// that the wheel didn't record a UNIX mode for.
+func wheelPerm(file fsutil.FileReference) int64 {
+	if rec, ok := file.(*withRecord); ok {
+		file = rec.FileReference
+	}
+	if entry, ok := file.(*zipEntry); ok && entry.wheelMode&python.ModeFmt != 0 {
+		return int64(entry.wheelMode &^ python.ModeFmt)
+	}
+	return int64(python.ModeFromGo(file.Mode()) &^ python.ModeFmt)
+}
+
+// checkPycMagicNumber checks that a .pyc file output by the Platform's PyCompile has the expected
+// magic number.
+func checkPycMagicNumber(expected []byte, file fsutil.FileReference) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	header := make([]byte, python.PycHeaderSize)
+	n, err := io.ReadFull(reader, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return python.CheckPycMagicNumber(expected, header[:n])
+}
+
 // distInfoDir returns the "{name}.dist-info" directory for the wheel file.
 //
 // This is based off of `pip/_internal/utils/wheel.py:wheel_dist_info_dir()`, since PEP 427 doesn't
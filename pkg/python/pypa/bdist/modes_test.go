@@ -0,0 +1,211 @@
+package bdist_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestInstallWheelModes(t *testing.T) {
+	t.Parallel()
+	filename := writeLinkWheel(t, []linkTestFile{
+		{Name: "foo-1.0.dist-info/METADATA", Content: "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n", Mode: 0o600},
+		{Name: "foo-1.0.dist-info/WHEEL", Content: "Wheel-Version: 1.0\nRoot-Is-Purelib: true\n", Mode: 0o664},
+		{Name: "foo/tool", Content: "#!/bin/sh\n", Mode: 0o775},
+		{Name: "foo/secret", Content: "x", Mode: 0o4700},
+		{Name: "foo/grpexec", Content: "x", Mode: 0o610},
+		{Name: "foo/current", Content: "tool", Mode: fs.ModeSymlink | 0o777},
+	})
+	testcases := map[string]struct {
+		Modes    *python.ModePolicy
+		Expected map[string]int64
+	}{
+		"nil": {
+			Modes: nil,
+			Expected: map[string]int64{
+				"foo-1.0.dist-info/WHEEL": 0o644,
+				"foo/tool":                0o755,
+				"foo/grpexec":             0o755,
+				"foo/current":             0o777,
+			},
+		},
+		"normalize": {
+			Modes: &python.ModePolicy{Normalize: true},
+			Expected: map[string]int64{
+				"foo/":                       0o755,
+				"foo-1.0.dist-info/METADATA": 0o644,
+				"foo-1.0.dist-info/WHEEL":    0o644,
+				"foo/tool":                   0o755,
+				"foo/secret":                 0o755,
+				"foo/grpexec":                0o644,
+				"foo/current":                0o777,
+			},
+		},
+		"umask": {
+			Modes: &python.ModePolicy{Umask: 0o027},
+			Expected: map[string]int64{
+				"foo-1.0.dist-info/METADATA": 0o640,
+				"foo/tool":                   0o750,
+				"foo/current":                0o777,
+			},
+		},
+		"both": {
+			Modes: &python.ModePolicy{Normalize: true, Umask: 0o077},
+			Expected: map[string]int64{
+				"foo/":                    0o700,
+				"foo-1.0.dist-info/WHEEL": 0o600,
+				"foo/tool":                0o700,
+			},
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			plat := python.Platform{ //nolint:exhaustivestruct
+				ConsoleShebang: "/usr/bin/python3",
+				Scheme: python.Scheme{
+					PureLib: "/usr/lib/python3/site-packages",
+					PlatLib: "/usr/lib/python3/site-packages",
+					Headers: "/usr/include/python3",
+					Scripts: "/usr/bin",
+					Data:    "/usr",
+					Include: "",
+				},
+				Modes: tcData.Modes,
+				PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+					[]fsutil.FileReference, error,
+				) {
+					return nil, nil
+				},
+			}
+			layer, err := bdist.InstallWheel(context.Background(), plat, time.Time{}, time.Time{}, filename, nil)
+			require.NoError(t, err)
+
+			layerReader, err := layer.Uncompressed()
+			require.NoError(t, err)
+			defer layerReader.Close()
+			actual := make(map[string]int64)
+			tarReader := tar.NewReader(layerReader)
+			for {
+				header, err := tarReader.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				actual[strings.TrimPrefix(header.Name, "usr/lib/python3/site-packages/")] = header.Mode
+			}
+			for name, mode := range tcData.Expected {
+				assert.Equalf(t, mode, actual[name], "%s: expected=%#o actual=%#o", name, mode, actual[name])
+			}
+		})
+	}
+}
+
+// TestInstallWheelCreatedOnWindows checks that a wheel whose ZIP entries only have MS-DOS
+// attributes (as when it is created on Windows) installs with sensible UNIX modes, and that its
+// `#!python` scripts get the +x bit.
+func TestInstallWheelCreatedOnWindows(t *testing.T) {
+	t.Parallel()
+	files := []struct {
+		Name    string
+		Content string
+		Attrs   python.DOSAttribute
+	}{
+		{"foo-1.0.dist-info/METADATA", "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n", python.DOSArchive},
+		{"foo-1.0.dist-info/WHEEL", "Wheel-Version: 1.0\nRoot-Is-Purelib: true\n", python.DOSArchive},
+		{"foo/", "", python.DOSDirectory},
+		{"foo/sub/", "", python.DOSDirectory},
+		{"foo/sub/data.txt", "data", python.DOSArchive},
+		{"foo/readonly.txt", "ro", python.DOSArchive | python.DOSReadOnly},
+		{"foo-1.0.data/scripts/foo", "#!python\nprint('hi')\n", python.DOSArchive},
+	}
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	var record strings.Builder
+	for _, file := range files {
+		header := &zip.FileHeader{ //nolint:exhaustivestruct
+			Name:           file.Name,
+			Method:         zip.Store,
+			CreatorVersion: 0, // MS-DOS
+			ExternalAttrs:  uint32(file.Attrs),
+		}
+		w, err := zipWriter.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, file.Content)
+		require.NoError(t, err)
+		if !strings.HasSuffix(file.Name, "/") {
+			sum := sha256.Sum256([]byte(file.Content))
+			fmt.Fprintf(&record, "%s,sha256=%s,%d\n",
+				file.Name, base64.RawURLEncoding.EncodeToString(sum[:]), len(file.Content))
+		}
+	}
+	w, err := zipWriter.Create("foo-1.0.dist-info/RECORD")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, record.String()+"foo-1.0.dist-info/RECORD,,\n")
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+	filename := filepath.Join(t.TempDir(), "foo-1.0-py3-none-any.whl")
+	require.NoError(t, os.WriteFile(filename, buf.Bytes(), 0o644))
+
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			return nil, nil
+		},
+	}
+	layer, err := bdist.InstallWheel(context.Background(), plat, time.Time{}, time.Time{}, filename, nil)
+	require.NoError(t, err)
+
+	layerReader, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer layerReader.Close()
+	actual := make(map[string]string)
+	tarReader := tar.NewReader(layerReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		actual[strings.TrimPrefix(header.Name, "usr/lib/python3/site-packages/")] = header.FileInfo().Mode().String()
+	}
+	for name, mode := range map[string]string{
+		"foo/":             "drwxr-xr-x",
+		"foo/sub/":         "drwxr-xr-x",
+		"foo/sub/data.txt": "-rw-r--r--",
+		"foo/readonly.txt": "-rw-r--r--",
+		"usr/bin/foo":      "-rwxr-xr-x",
+	} {
+		assert.Equalf(t, mode, actual[name], "%s", name)
+	}
+}
@@ -0,0 +1,88 @@
+package bdist
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// An MtimeMode is a strategy for the timestamps of installed files; see MtimePolicy.
+type MtimeMode string
+
+const (
+	// MtimePip (the default) is what pip does, as described for InstallWheel: files extracted
+	// from the wheel get minTime (or keep their timestamps from the wheel if minTime is zero),
+	// and generated files (.pyc files, entry-point scripts, RECORD, and directories) get
+	// maxTime (or, if maxTime is zero, one second after the newest timestamp in the wheel).
+	MtimePip MtimeMode = "pip"
+	// MtimePreserve keeps the timestamps from the wheel, ignoring minTime; generated files get
+	// maxTime as with MtimePip.
+	MtimePreserve MtimeMode = "preserve"
+	// MtimeClampToEpoch keeps the timestamps from the wheel, except that timestamps after the
+	// Epoch are set to the Epoch; generated files get the Epoch.
+	MtimeClampToEpoch MtimeMode = "clamp-to-epoch"
+	// MtimeForceEpoch sets every timestamp to the Epoch.
+	MtimeForceEpoch MtimeMode = "force-epoch"
+	// MtimeSourceDateEpoch sets the timestamps of files extracted from the wheel to the Epoch,
+	// and of generated files to one second after the Epoch, so that .pyc files are newer than
+	// their .py sources (as with MtimePip).
+	MtimeSourceDateEpoch MtimeMode = "source-date-epoch"
+)
+
+// MtimeModes lists the valid MtimeModes.
+//
+//nolint:gochecknoglobals // would be 'const'
+var MtimeModes = []MtimeMode{
+	MtimePip,
+	MtimePreserve,
+	MtimeClampToEpoch,
+	MtimeForceEpoch,
+	MtimeSourceDateEpoch,
+}
+
+// An MtimePolicy says what timestamps InstallWheel gives installed files; it overrides the
+// minTime and maxTime arguments to InstallWheel.  The zero MtimePolicy is the same as MtimePip.
+type MtimePolicy struct {
+	Mode MtimeMode
+	// Epoch is the reference time for the MtimeClampToEpoch, MtimeForceEpoch, and
+	// MtimeSourceDateEpoch modes (usually $SOURCE_DATE_EPOCH); it is required for those modes,
+	// and ignored for others.
+	Epoch time.Time
+}
+
+// times returns the minTime and maxTime to install with, given the minTime and maxTime that were
+// passed to InstallWheel.
+func (p MtimePolicy) times(minTime, maxTime time.Time) (time.Time, time.Time, error) {
+	switch p.Mode {
+	case "", MtimePip:
+		return minTime, maxTime, nil
+	case MtimePreserve:
+		return time.Time{}, maxTime, nil
+	}
+	if p.Epoch.IsZero() {
+		return time.Time{}, time.Time{}, fmt.Errorf("mtime policy %q requires an epoch", p.Mode)
+	}
+	switch p.Mode {
+	case MtimeClampToEpoch:
+		return time.Time{}, p.Epoch, nil
+	case MtimeForceEpoch:
+		return p.Epoch, p.Epoch, nil
+	case MtimeSourceDateEpoch:
+		return p.Epoch, p.Epoch.Add(time.Second), nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid mtime policy %q", p.Mode)
+	}
+}
+
+type mtimePolicyContextKey struct{}
+
+// WithMtimePolicy returns a copy of ctx that has an MtimePolicy associated with it, which
+// InstallWheel uses in place of its minTime and maxTime arguments.
+func WithMtimePolicy(ctx context.Context, policy MtimePolicy) context.Context {
+	return context.WithValue(ctx, mtimePolicyContextKey{}, policy)
+}
+
+func getMtimePolicy(ctx context.Context) MtimePolicy {
+	policy, _ := ctx.Value(mtimePolicyContextKey{}).(MtimePolicy)
+	return policy
+}
@@ -0,0 +1,156 @@
+package bdist_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestMtimePolicy(t *testing.T) {
+	t.Parallel()
+	var (
+		oldTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		newTime = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		epoch   = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		minTime = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	filename := filepath.Join(t.TempDir(), "foo-1.0-py3-none-any.whl")
+	fh, err := os.Create(filename)
+	require.NoError(t, err)
+	zipWriter := zip.NewWriter(fh)
+	var record strings.Builder
+	for _, file := range []struct {
+		Name    string
+		Content string
+		Time    time.Time
+	}{
+		{"foo-1.0.dist-info/METADATA", "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n", oldTime},
+		{"foo-1.0.dist-info/WHEEL", "Wheel-Version: 1.0\nRoot-Is-Purelib: true\n", oldTime},
+		{"foo/old.py", "", oldTime},
+		{"foo/new.py", "", newTime},
+	} {
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{ //nolint:exhaustivestruct
+			Name:     file.Name,
+			Method:   zip.Store,
+			Modified: file.Time,
+		})
+		require.NoError(t, err)
+		_, err = io.WriteString(w, file.Content)
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte(file.Content))
+		fmt.Fprintf(&record, "%s,sha256=%s,%d\n",
+			file.Name, base64.RawURLEncoding.EncodeToString(sum[:]), len(file.Content))
+	}
+	w, err := zipWriter.Create("foo-1.0.dist-info/RECORD")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, record.String()+"foo-1.0.dist-info/RECORD,,\n")
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+	require.NoError(t, fh.Close())
+
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		PyCompile: func(_ context.Context, clampTime time.Time, _ []string, _ []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			return []fsutil.FileReference{
+				&fsutil.InMemFileReference{
+					FileInfo: (&tar.Header{
+						Typeflag: tar.TypeReg,
+						Name:     "usr/lib/python3/site-packages/foo/__pycache__/new.cpython-39.pyc",
+						Mode:     0o644,
+						ModTime:  clampTime,
+					}).FileInfo(),
+					MFullName: "usr/lib/python3/site-packages/foo/__pycache__/new.cpython-39.pyc",
+					MContent:  nil,
+				},
+			}, nil
+		},
+	}
+
+	type mtimes struct {
+		Old, New, Pyc time.Time
+	}
+	// The wheel's newest timestamp is newTime, so pip's default maxTime is one second later.
+	autoMax := newTime.Add(time.Second)
+	testcases := map[string]struct {
+		Mode     bdist.MtimeMode // "" for no MtimePolicy
+		MinTime  time.Time
+		Expected mtimes
+	}{
+		"none":              {"", time.Time{}, mtimes{oldTime, newTime, autoMax}},
+		"none-mintime":      {"", minTime, mtimes{minTime, minTime, autoMax}},
+		"pip":               {bdist.MtimePip, time.Time{}, mtimes{oldTime, newTime, autoMax}},
+		"pip-mintime":       {bdist.MtimePip, minTime, mtimes{minTime, minTime, autoMax}},
+		"preserve":          {bdist.MtimePreserve, minTime, mtimes{oldTime, newTime, autoMax}},
+		"clamp-to-epoch":    {bdist.MtimeClampToEpoch, minTime, mtimes{oldTime, epoch, epoch}},
+		"force-epoch":       {bdist.MtimeForceEpoch, minTime, mtimes{epoch, epoch, epoch}},
+		"source-date-epoch": {bdist.MtimeSourceDateEpoch, minTime, mtimes{epoch, epoch, epoch.Add(time.Second)}},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			if tcData.Mode != "" {
+				ctx = bdist.WithMtimePolicy(ctx, bdist.MtimePolicy{Mode: tcData.Mode, Epoch: epoch})
+			}
+			layer, err := bdist.InstallWheel(ctx, plat, tcData.MinTime, time.Time{}, filename, nil)
+			require.NoError(t, err)
+
+			layerReader, err := layer.Uncompressed()
+			require.NoError(t, err)
+			defer layerReader.Close()
+			var actual mtimes
+			tarReader := tar.NewReader(layerReader)
+			for {
+				header, err := tarReader.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				switch path.Base(header.Name) {
+				case "old.py":
+					actual.Old = header.ModTime.UTC()
+				case "new.py":
+					actual.New = header.ModTime.UTC()
+				case "new.cpython-39.pyc":
+					actual.Pyc = header.ModTime.UTC()
+				}
+			}
+			assert.Equal(t, tcData.Expected, actual)
+		})
+	}
+
+	_, err = bdist.InstallWheel(bdist.WithMtimePolicy(context.Background(),
+		bdist.MtimePolicy{Mode: bdist.MtimeForceEpoch, Epoch: time.Time{}}),
+		plat, time.Time{}, time.Time{}, filename, nil)
+	assert.EqualError(t, err, `bdist.InstallWheel: mtime policy "force-epoch" requires an epoch`)
+}
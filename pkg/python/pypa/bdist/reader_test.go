@@ -0,0 +1,88 @@
+package bdist_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestInstallWheelFromReader(t *testing.T) {
+	t.Parallel()
+	filename := writeLinkWheel(t, []linkTestFile{
+		{Name: "foo-1.0.dist-info/METADATA", Content: linkTestMetadata, Mode: 0o644},
+		{Name: "foo-1.0.dist-info/WHEEL", Content: linkTestWheel, Mode: 0o644},
+		{Name: "foo/__init__.py", Content: "print('hello')\n", Mode: 0o644},
+		{Name: "foo/current", Content: "__init__.py", Mode: fs.ModeSymlink | 0o777},
+	})
+	wheel, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	basename := filepath.Base(filename)
+
+	// Serve the wheel the same way that an index server does for 'layer wheel --download'.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/simple/foo":
+			_, _ = fmt.Fprintf(w, `<a href="/files/%s#sha256=%x">%s</a>`,
+				basename, sha256.Sum256(wheel), basename)
+		case "/files/" + basename:
+			http.ServeContent(w, r, basename, time.Time{}, bytes.NewReader(wheel))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client := pep503.Client{ //nolint:exhaustivestruct
+		BaseURL:    srv.URL + "/simple/",
+		HTTPClient: srv.Client(),
+	}
+	links, err := client.ListPackageFiles(context.Background(), "foo")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	content, err := links[0].Get(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, wheel, content)
+
+	// Installing from the downloaded bytes gives the same layer as installing from the file.
+	fromReader, err := bdist.InstallWheelFromReader(context.Background(), linkTestPlatform(),
+		time.Time{}, time.Time{},
+		basename, bytes.NewReader(content), int64(len(content)),
+		nil)
+	require.NoError(t, err)
+	fromFile, err := bdist.InstallWheel(context.Background(), linkTestPlatform(),
+		time.Time{}, time.Time{},
+		filename, nil)
+	require.NoError(t, err)
+	readerDigest, err := fromReader.Digest()
+	require.NoError(t, err)
+	fileDigest, err := fromFile.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, fileDigest, readerDigest)
+
+	// A truncated download is an error, not a partial layer.
+	_, err = bdist.InstallWheelFromReader(context.Background(), linkTestPlatform(),
+		time.Time{}, time.Time{},
+		basename, bytes.NewReader(content[:len(content)/2]), int64(len(content)/2),
+		nil)
+	assert.Error(t, err)
+
+	// The compatibility tags are still checked against the filename.
+	_, err = bdist.InstallWheelFromReader(context.Background(), linkTestPlatform(),
+		time.Time{}, time.Time{},
+		"foo-1.0-cp39-cp39-manylinux1_x86_64.whl", bytes.NewReader(content), int64(len(content)),
+		nil)
+	assert.Error(t, err)
+}
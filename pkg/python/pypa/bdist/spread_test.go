@@ -0,0 +1,88 @@
+package bdist_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestInstallWheelDataInclude(t *testing.T) {
+	t.Parallel()
+	filename := writeLinkWheel(t, []linkTestFile{
+		{Name: "foo-1.0.dist-info/METADATA", Content: "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n", Mode: 0o644},
+		{Name: "foo-1.0.dist-info/WHEEL", Content: "Wheel-Version: 1.0\nRoot-Is-Purelib: true\n", Mode: 0o644},
+		{Name: "foo-1.0.data/headers/foo.h", Content: "/* headers */", Mode: 0o644},
+		{Name: "foo-1.0.data/include/foo/api.h", Content: "/* include */", Mode: 0o644},
+	})
+	testcases := map[string]struct {
+		Include  string
+		Expected []string
+	}{
+		"explicit": {
+			Include: "/usr/include/python3",
+			Expected: []string{
+				"usr/include/python3/foo/api.h",
+				"usr/include/site/python3/foo/foo.h",
+			},
+		},
+		"default": {
+			Include: "",
+			Expected: []string{
+				"usr/include/site/python3/foo/foo.h",
+				"usr/include/site/python3/foo/foo/api.h",
+			},
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			plat := python.Platform{ //nolint:exhaustivestruct
+				ConsoleShebang: "/usr/bin/python3",
+				Scheme: python.Scheme{
+					PureLib: "/usr/lib/python3/site-packages",
+					PlatLib: "/usr/lib/python3/site-packages",
+					Headers: "/usr/include/site/python3/foo",
+					Scripts: "/usr/bin",
+					Data:    "/usr",
+					Include: tcData.Include,
+				},
+				PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+					[]fsutil.FileReference, error,
+				) {
+					return nil, nil
+				},
+			}
+			layer, err := bdist.InstallWheel(context.Background(), plat, time.Time{}, time.Time{}, filename, nil)
+			require.NoError(t, err)
+
+			layerReader, err := layer.Uncompressed()
+			require.NoError(t, err)
+			defer layerReader.Close()
+			var actual []string
+			tarReader := tar.NewReader(layerReader)
+			for {
+				header, err := tarReader.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				if header.Typeflag == tar.TypeReg && strings.HasPrefix(header.Name, "usr/include/") {
+					actual = append(actual, header.Name)
+				}
+			}
+			assert.ElementsMatch(t, tcData.Expected, actual)
+		})
+	}
+}
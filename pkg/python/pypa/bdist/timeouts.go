@@ -0,0 +1,36 @@
+package bdist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StepTimeouts limits how long each of the potentially slow steps of
+// InstallWheelFromReaderWithTimeouts may take.  A zero duration means that the step has no timeout
+// of its own (though it still stops if the Context passed to InstallWheelFromReaderWithTimeouts is
+// canceled or reaches its deadline).
+type StepTimeouts struct {
+	// IntegrityCheck limits verifying the hashes in the wheel's RECORD file.
+	IntegrityCheck time.Duration
+	// PyCompile limits compiling the installed .py files to .pyc files.
+	PyCompile time.Duration
+	// GenerateLayer limits writing the installed files to a layer.
+	GenerateLayer time.Duration
+}
+
+// runStep calls fn with a Context that is subject to the given timeout; if the step's own timeout
+// is what causes it to fail, then the returned error says so.
+func runStep(ctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := fn(stepCtx)
+	if err != nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("timed out after %v: %w", timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package bdist_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestStepTimeouts(t *testing.T) {
+	t.Parallel()
+	filename := writeWheel(t, "foo-1.0-py3-none-any.whl", map[string]string{
+		"foo/__init__.py":            "",
+		"foo-1.0.dist-info/METADATA": "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n",
+		"foo-1.0.dist-info/WHEEL":    "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n",
+	})
+	content, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		// A compiler that never finishes on its own.
+		PyCompile: func(ctx context.Context, _ time.Time, _ []string, _ []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	type testcase struct {
+		Timeouts       bdist.StepTimeouts
+		Cancel         bool
+		ExpectedErr    error
+		ExpectedSubstr string
+	}
+	testcases := map[string]testcase{
+		"pycompile-timeout": {
+			Timeouts:       bdist.StepTimeouts{PyCompile: 10 * time.Millisecond}, //nolint:exhaustivestruct
+			ExpectedErr:    context.DeadlineExceeded,
+			ExpectedSubstr: "py_compile: timed out after 10ms",
+		},
+		"canceled": {
+			Timeouts:       bdist.StepTimeouts{PyCompile: time.Hour}, //nolint:exhaustivestruct
+			Cancel:         true,
+			ExpectedErr:    context.Canceled,
+			ExpectedSubstr: "wheel integrity: context canceled",
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tcData.Cancel {
+				cancel()
+			}
+			_, err := bdist.InstallWheelFromReaderWithTimeouts(ctx, plat, time.Time{}, time.Time{},
+				filepath.Base(filename), bytes.NewReader(content), int64(len(content)),
+				nil, tcData.Timeouts)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, tcData.ExpectedErr), err.Error())
+			assert.Contains(t, err.Error(), tcData.ExpectedSubstr)
+		})
+	}
+}
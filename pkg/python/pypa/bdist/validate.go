@@ -0,0 +1,227 @@
+package bdist
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/datawire/dlib/derror"
+
+	"github.com/datawire/ocibuild/pkg/python/pep345"
+	"github.com/datawire/ocibuild/pkg/python/pep425"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+// Severity is how serious a Finding is.
+type Severity string
+
+const (
+	// SeverityError is for violations of the wheel specification; InstallWheel may refuse to
+	// install the wheel.
+	SeverityError Severity = "error"
+	// SeverityWarning is for things that are allowed, but are likely mistakes.
+	SeverityWarning Severity = "warning"
+)
+
+// A Finding is a single problem found by Validate.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	// Check is a short identifier for the kind of problem, such as "record" or "tags".
+	Check string `json:"check"`
+	// File is the file within the wheel that the problem is with, if it is about a specific
+	// file.
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+type findingList []Finding
+
+func (l *findingList) add(severity Severity, check, file, format string, args ...interface{}) {
+	*l = append(*l, Finding{
+		Severity: severity,
+		Check:    check,
+		File:     file,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (f Finding) String() string {
+	if f.File != "" {
+		return fmt.Sprintf("%s: [%s] %s: %s", f.Severity, f.Check, f.File, f.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s", f.Severity, f.Check, f.Message)
+}
+
+// Validate checks a wheel file against the wheel specification, returning a list of findings.  In
+// addition to the RECORD verification that InstallWheel does, it checks that:
+//
+//  - the filename is valid, and its compatibility tags match the WHEEL file's Tag lines;
+//  - the name and version in the filename, the .dist-info directory name, and METADATA agree,
+//    and the version is in PEP 440 normalized form;
+//  - the WHEEL file's Wheel-Version is supported;
+//  - the wheel does not contain setup.py, setup.cfg, or .egg-info (errors), or .pyc files
+//    (warnings).
+//
+// An error is only returned if the file can't be read as a zip archive at all.
+func Validate(wheelfilename string) ([]Finding, error) {
+	zipReader, err := zip.OpenReader(wheelfilename)
+	if err != nil {
+		return nil, fmt.Errorf("bdist.Validate: open wheel: %w", err)
+	}
+	defer zipReader.Close()
+
+	wh := &wheel{ //nolint:varnamelen // same as receiver name
+		zip: &zipReader.Reader,
+
+		cachedDistInfoDir: "", // don't know it yet
+	}
+
+	var findings findingList
+	add := findings.add
+
+	distInfoDir, err := wh.distInfoDir()
+	if err != nil {
+		add(SeverityError, "dist-info", "", "%v", err)
+		// Nothing else can be checked without the .dist-info directory.
+		return findings, nil
+	}
+
+	// filename
+	basename := filepath.Base(wheelfilename)
+	filenameData, err := ParseFilename(basename)
+	if err != nil {
+		add(SeverityError, "filename", "", "%v", err)
+	} else {
+		rawVersion := reFilename.FindStringSubmatch(basename)[reFilename.SubexpIndex("version")]
+		if normalized := filenameData.Version.String(); rawVersion != normalized {
+			add(SeverityWarning, "version", "", "filename version %q is not normalized; should be %q",
+				rawVersion, normalized)
+		}
+		want := strings.ReplaceAll(pep503.NormalizeName(filenameData.Distribution), "-", "_")
+		if !strings.EqualFold(filenameData.Distribution, want) {
+			add(SeverityWarning, "filename", "", "filename distribution %q is not escaped; should be %q",
+				filenameData.Distribution, want)
+		}
+	}
+
+	// WHEEL
+	wheelMetadata, err := wh.parseDistInfoWheel()
+	if err != nil {
+		add(SeverityError, "wheel", path.Join(distInfoDir, "WHEEL"), "%v", err)
+	} else {
+		switch wheelVersion, err := pep440.ParseVersion(wheelMetadata.Get("Wheel-Version")); {
+		case err != nil:
+			add(SeverityError, "wheel", path.Join(distInfoDir, "WHEEL"), "Wheel-Version: %v", err)
+		case wheelVersion.Major() > specVersion.Major():
+			add(SeverityError, "wheel", path.Join(distInfoDir, "WHEEL"),
+				"Wheel-Version %s is not supported", wheelVersion)
+		case wheelVersion.Cmp(*specVersion) > 0:
+			add(SeverityWarning, "wheel", path.Join(distInfoDir, "WHEEL"),
+				"Wheel-Version %s is newer than %s", wheelVersion, specVersion)
+		}
+		tagStrs := wheelMetadata.Values("Tag")
+		metadataTags := make([]pep425.Tag, 0, len(tagStrs))
+		for _, tagStr := range tagStrs {
+			tag, err := pep425.ParseTag(tagStr)
+			if err != nil {
+				add(SeverityError, "tags", path.Join(distInfoDir, "WHEEL"), "%v", err)
+				continue
+			}
+			metadataTags = append(metadataTags, tag)
+		}
+		switch {
+		case len(tagStrs) == 0:
+			add(SeverityWarning, "tags", path.Join(distInfoDir, "WHEEL"), "no Tag lines")
+		case filenameData != nil && len(metadataTags) == len(tagStrs):
+			filenameTags := []pep425.Tag{filenameData.CompatibilityTag}
+			if !pep425.Equal(filenameTags, metadataTags) {
+				add(SeverityError, "tags", "", "filename tags %q do not match WHEEL tags %q",
+					pep425.Expand(filenameTags), pep425.Expand(metadataTags))
+			}
+		}
+	}
+
+	// METADATA
+	metadataName := path.Join(distInfoDir, "METADATA")
+	if metadataFile, err := wh.Open(metadataName); err != nil {
+		add(SeverityError, "metadata", metadataName, "%v", err)
+	} else {
+		metadata, err := pep345.ParseMetadata(metadataFile)
+		_ = metadataFile.Close()
+		if err != nil {
+			add(SeverityError, "metadata", metadataName, "%v", err)
+		} else {
+			findings.checkNameVersion(distInfoDir, filenameData,
+				metadata.Get("Name"), metadata.Get("Version"))
+		}
+	}
+
+	// forbidden files
+	for _, file := range wh.zip.File {
+		name := path.Clean(file.Name)
+		switch {
+		case name == "setup.py" || name == "setup.cfg":
+			add(SeverityError, "forbidden-file", name, "wheels must not contain %s", name)
+		case strings.HasSuffix(strings.SplitN(name, "/", 2)[0], ".egg-info"):
+			add(SeverityError, "forbidden-file", name, "wheels must not contain .egg-info directories")
+		case strings.HasSuffix(name, ".pyc"):
+			add(SeverityWarning, "forbidden-file", name, "wheels should not contain compiled bytecode")
+		}
+	}
+
+	// RECORD
+	if err := wh.integrityCheck(context.Background()); err != nil {
+		var errs derror.MultiError
+		if !errors.As(err, &errs) {
+			errs = derror.MultiError{err}
+		}
+		for _, err := range errs {
+			add(SeverityError, "record", "", "%v", err)
+		}
+	}
+
+	return findings, nil
+}
+
+// checkNameVersion checks that the name and version from METADATA are consistent with the filename
+// and the .dist-info directory name.
+func (l *findingList) checkNameVersion(distInfoDir string, filenameData *FileNameData, name, version string) {
+	metadataName := path.Join(distInfoDir, "METADATA")
+	add := l.add
+
+	ver, err := pep440.ParseVersion(version)
+	if err != nil {
+		add(SeverityError, "version", metadataName, "%v", err)
+	} else if normalized := ver.String(); version != normalized {
+		add(SeverityWarning, "version", metadataName, "Version %q is not normalized; should be %q",
+			version, normalized)
+	}
+
+	if filenameData != nil {
+		if pep503.NormalizeName(name) != pep503.NormalizeName(filenameData.Distribution) {
+			add(SeverityError, "name", metadataName, "Name %q does not match the filename's %q",
+				name, filenameData.Distribution)
+		}
+		if ver != nil && ver.Cmp(filenameData.Version) != 0 {
+			add(SeverityError, "version", metadataName, "Version %q does not match the filename's %q",
+				version, filenameData.Version.String())
+		}
+	}
+
+	dirName := strings.TrimSuffix(distInfoDir, ".dist-info")
+	dirVersion := ""
+	if idx := strings.LastIndex(dirName, "-"); idx >= 0 {
+		dirName, dirVersion = dirName[:idx], dirName[idx+1:]
+	}
+	if pep503.NormalizeName(dirName) != pep503.NormalizeName(name) {
+		add(SeverityError, "name", distInfoDir, "directory name does not match Name %q", name)
+	}
+	if dirVer, err := pep440.ParseVersion(dirVersion); err != nil || ver == nil || dirVer.Cmp(*ver) != 0 {
+		add(SeverityError, "version", distInfoDir, "directory name does not match Version %q", version)
+	}
+}
@@ -0,0 +1,99 @@
+package bdist_test
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// writeWheel writes a wheel file with the given files, generating a correct RECORD.
+func writeWheel(t *testing.T, filename string, files map[string]string) string {
+	t.Helper()
+	filename = filepath.Join(t.TempDir(), filename)
+	fh, err := os.Create(filename)
+	require.NoError(t, err)
+	defer fh.Close()
+	zipWriter := zip.NewWriter(fh)
+	var record strings.Builder
+	var distInfoDir string
+	for name, content := range files {
+		if strings.HasSuffix(name, ".dist-info/METADATA") {
+			distInfoDir = strings.TrimSuffix(name, "/METADATA")
+		}
+		w, err := zipWriter.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte(content))
+		fmt.Fprintf(&record, "%s,sha256=%s,%d\n", name, base64.RawURLEncoding.EncodeToString(sum[:]), len(content))
+	}
+	fmt.Fprintf(&record, "%s/RECORD,,\n", distInfoDir)
+	w, err := zipWriter.Create(distInfoDir + "/RECORD")
+	require.NoError(t, err)
+	_, err = w.Write([]byte(record.String()))
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+	return filename
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	const wheelFile = "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n"
+	type testcase struct {
+		Filename string
+		Files    map[string]string
+		Expected []string
+	}
+	testcases := map[string]testcase{
+		"good": {
+			Filename: "foo-1.0-py3-none-any.whl",
+			Files: map[string]string{
+				"foo/__init__.py":            "",
+				"foo-1.0.dist-info/WHEEL":    wheelFile,
+				"foo-1.0.dist-info/METADATA": "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n",
+			},
+			Expected: nil,
+		},
+		"bad": {
+			Filename: "foo-1.00-py2-none-any.whl",
+			Files: map[string]string{
+				"setup.py":                         "",
+				"foo/__pycache__/x.cpython-39.pyc": "",
+				"foo-1.0.dist-info/WHEEL":          wheelFile,
+				"foo-1.0.dist-info/METADATA":       "Metadata-Version: 2.1\nName: bar\nVersion: v1.0\n",
+			},
+			Expected: []string{
+				`warning: [version] filename version "1.00" is not normalized; should be "1.0"`,
+				`error: [tags] filename tags ["py2-none-any"] do not match WHEEL tags ["py3-none-any"]`,
+				`warning: [version] foo-1.0.dist-info/METADATA: Version "v1.0" is not normalized; should be "1.0"`,
+				`error: [name] foo-1.0.dist-info/METADATA: Name "bar" does not match the filename's "foo"`,
+				`error: [name] foo-1.0.dist-info: directory name does not match Name "bar"`,
+				`warning: [forbidden-file] foo/__pycache__/x.cpython-39.pyc: wheels should not contain compiled bytecode`,
+				`error: [forbidden-file] setup.py: wheels must not contain setup.py`,
+			},
+		},
+	}
+	for tcName, tc := range testcases {
+		tc := tc
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			findings, err := bdist.Validate(writeWheel(t, tc.Filename, tc.Files))
+			require.NoError(t, err)
+			var actual []string
+			for _, finding := range findings {
+				actual = append(actual, finding.String())
+			}
+			assert.ElementsMatch(t, tc.Expected, actual)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package bdist
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"runtime"
+	"sync"
+)
+
+// ErrIntegrity matches (with errors.Is) the error from InstallWheel if the wheel's content doesn't
+// match its RECORD file: a file's hash or size differs, a file isn't listed, or RECORD itself is
+// missing.
+var ErrIntegrity = errors.New("wheel integrity check failed")
+
+// integrityError wraps the errors from verifying RECORD, so that they match ErrIntegrity without
+// changing the message.
+type integrityError struct {
+	err error
+}
+
+func (e integrityError) Error() string { return e.err.Error() }
+func (e integrityError) Unwrap() error { return e.err }
+
+// Is implements errors.Is.
+func (e integrityError) Is(target error) bool {
+	return target == ErrIntegrity //nolint:errorlint // this IS the errors.Is implementation
+}
+
+type skipVerifyContextKey struct{}
+
+// WithoutRecordVerification returns a copy of ctx that tells InstallWheel to not verify the hashes
+// and sizes in the wheel's RECORD file.  This is only appropriate for wheels from a trusted source
+// that have already been verified, such as a local cache that checks the digest of each wheel
+// that it stores.
+func WithoutRecordVerification(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipVerifyContextKey{}, true)
+}
+
+func skipRecordVerification(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipVerifyContextKey{}).(bool)
+	return skip
+}
+
+type permissiveRecordContextKey struct{}
+
+// WithPermissiveRecord returns a copy of ctx that tells InstallWheel to tolerate an incomplete
+// RECORD file, as produced by some internal build tools and by certain old versions of wheel-building
+// tools: a missing RECORD file, rows that are missing a hash or size, and files that aren't
+// mentioned in RECORD are logged as warnings instead of being errors.  The hashes and sizes that
+// are present are still verified.
+func WithPermissiveRecord(ctx context.Context) context.Context {
+	return context.WithValue(ctx, permissiveRecordContextKey{}, true)
+}
+
+func permissiveRecord(ctx context.Context) bool {
+	permissive, _ := ctx.Value(permissiveRecordContextKey{}).(bool)
+	return permissive
+}
+
+// recordJob is a file listed in RECORD that needs to be hashed.
+type recordJob struct {
+	Row  int
+	Name string
+	// Algo is the hash algorithm to use, or "" to only measure the size.
+	Algo string
+}
+
+// recordResult is the outcome of a recordJob.
+type recordResult struct {
+	Hashsum string
+	Size    int64
+	Err     error
+}
+
+// hashFiles runs the jobs using a pool of runtime.GOMAXPROCS(0) workers, storing the result of each
+// job in results[job.Row].  Per-file problems are reported in the results; the returned error is
+// only non-nil if ctx is canceled.
+func (wh *wheel) hashFiles(ctx context.Context, jobs []recordJob, results []recordResult) error {
+	// Index the archive up front; looking up each file with wh.Open would be quadratic.
+	files := make(map[string]*zip.File, len(wh.zip.File))
+	for _, file := range wh.zip.File {
+		name := path.Clean(file.Name)
+		if _, dup := files[name]; !dup {
+			files[name] = file
+		}
+	}
+
+	numWorkers := runtime.GOMAXPROCS(0)
+	if numWorkers > len(jobs) {
+		numWorkers = len(jobs)
+	}
+	jobCh := make(chan recordJob)
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				var result recordResult
+				result.Hashsum, result.Size, result.Err = hashFile(files[job.Name], job.Name, job.Algo)
+				results[job.Row] = result
+			}
+		}()
+	}
+	func() {
+		defer close(jobCh)
+		for _, job := range jobs {
+			select {
+			case jobCh <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func hashFile(file *zip.File, name, algo string) (hashsum string, size int64, err error) {
+	if file == nil {
+		return "", 0, fmt.Errorf("%w in wheel zip archive: %q", fs.ErrNotExist, name)
+	}
+
+	var (
+		hasher hash.Hash
+		dst    = io.Discard
+	)
+	if algo != "" {
+		newHasher, ok := lookupHash(algo)
+		if !ok {
+			return "", 0, fmt.Errorf("unsupported hash algorithm: %q", algo)
+		}
+		hasher = newHasher()
+		dst = hasher
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	size, err = io.Copy(dst, reader)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if hasher != nil {
+		hashsum = algo + "=" + base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+	}
+
+	return hashsum, size, nil
+}
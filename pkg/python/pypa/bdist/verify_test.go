@@ -0,0 +1,263 @@
+package bdist_test
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// writeRecordWheel writes a wheel with numFiles data files, using the algo hash algorithm in RECORD.
+// The RECORD entry for each data file has its size off by sizeSkew.
+func writeRecordWheel(t *testing.T, numFiles int, algo string, newHash func() hash.Hash, sizeSkew int) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "foo-1.0-py3-none-any.whl")
+	fh, err := os.Create(filename)
+	require.NoError(t, err)
+	defer fh.Close()
+	zipWriter := zip.NewWriter(fh)
+	files := map[string]string{
+		"foo-1.0.dist-info/METADATA": "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n",
+		"foo-1.0.dist-info/WHEEL":    "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n",
+	}
+	for i := 0; i < numFiles; i++ {
+		files[fmt.Sprintf("foo/data%03d.txt", i)] = strings.Repeat("x", i)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var record strings.Builder
+	for _, name := range names {
+		content := files[name]
+		w, err := zipWriter.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	for _, name := range names {
+		content := files[name]
+		size := len(content)
+		if strings.HasPrefix(name, "foo/") {
+			size += sizeSkew
+		}
+		hasher := newHash()
+		_, _ = hasher.Write([]byte(content))
+		fmt.Fprintf(&record, "%s,%s=%s,%d\n",
+			name, algo, base64.RawURLEncoding.EncodeToString(hasher.Sum(nil)), size)
+	}
+	record.WriteString("foo-1.0.dist-info/RECORD,,\n")
+	w, err := zipWriter.Create("foo-1.0.dist-info/RECORD")
+	require.NoError(t, err)
+	_, err = w.Write([]byte(record.String()))
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+	return filename
+}
+
+func TestRecordVerification(t *testing.T) {
+	t.Parallel()
+	const numFiles = 100
+	filename := writeRecordWheel(t, numFiles, "sha256", sha256.New, 1)
+
+	// Errors are reported in RECORD order, even though files are hashed in parallel.
+	info, err := bdist.InspectWheel(filename)
+	require.NoError(t, err)
+	expected := make([]string, 0, numFiles)
+	for i := 0; i < numFiles; i++ {
+		// Rows 0 and 1 are METADATA and WHEEL.
+		expected = append(expected, fmt.Sprintf(
+			"RECORD row %d: file \"foo/data%03d.txt\": size mismatch: RECORD=%d actual=%d",
+			i+2, i, i+1, i))
+	}
+	assert.Equal(t, expected, info.RecordErrors)
+
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			return nil, nil
+		},
+	}
+	ctx := context.Background()
+
+	_, err = bdist.InstallWheel(ctx, plat, time.Time{}, time.Time{}, filename, nil)
+	assert.ErrorIs(t, err, bdist.ErrIntegrity)
+
+	_, err = bdist.InstallWheel(bdist.WithoutRecordVerification(ctx),
+		plat, time.Time{}, time.Time{}, filename, nil)
+	assert.NoError(t, err)
+}
+
+func TestRecordHashes(t *testing.T) {
+	t.Parallel()
+	type testcase struct {
+		Algo        string
+		NewHash     func() hash.Hash
+		ExpectedErr bool
+	}
+	testcases := map[string]testcase{
+		"sha256":      {Algo: "sha256", NewHash: sha256.New},
+		"blake2b":     {Algo: "blake2b", NewHash: python.HashlibAlgorithmsGuaranteed["blake2b"]},
+		"blake2b_256": {Algo: "blake2b_256", NewHash: func() hash.Hash { h, _ := blake2b.New256(nil); return h }},
+		"blake2s":     {Algo: "blake2s", NewHash: python.HashlibAlgorithmsGuaranteed["blake2s"]},
+		"sha3_256":    {Algo: "sha3_256", NewHash: sha3.New256},
+		"sha3_512":    {Algo: "sha3_512", NewHash: sha3.New512},
+		"weak":        {Algo: "md5", NewHash: md5.New, ExpectedErr: true},
+		"registered":  {Algo: "test_registered", NewHash: fnv.New128a},
+	}
+	bdist.RegisterHash("test_registered", fnv.New128a)
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			filename := writeRecordWheel(t, 3, tcData.Algo, tcData.NewHash, 0)
+			info, err := bdist.InspectWheel(filename)
+			require.NoError(t, err)
+			if tcData.ExpectedErr {
+				require.Len(t, info.RecordErrors, 5)
+				assert.Contains(t, info.RecordErrors[0], "unsupported hash algorithm")
+			} else {
+				assert.Empty(t, info.RecordErrors)
+			}
+		})
+	}
+}
+
+func TestPermissiveRecord(t *testing.T) {
+	t.Parallel()
+	recordHash := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return "sha256=" + base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	const (
+		metadata = "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n"
+		wheel    = "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n"
+		data     = "hello\n"
+	)
+	testcases := map[string]struct {
+		Record             *string
+		ExpectedStrict     bool
+		ExpectedPermissive bool
+	}{
+		"complete": {
+			Record: func() *string {
+				str := fmt.Sprintf("foo-1.0.dist-info/METADATA,%s,%d\n", recordHash(metadata), len(metadata)) +
+					fmt.Sprintf("foo-1.0.dist-info/WHEEL,%s,%d\n", recordHash(wheel), len(wheel)) +
+					"foo/data.txt," + recordHash(data) + ",6\n" +
+					"foo-1.0.dist-info/RECORD,,\n"
+				return &str
+			}(),
+			ExpectedStrict:     true,
+			ExpectedPermissive: true,
+		},
+		"no-record": {
+			Record:             nil,
+			ExpectedStrict:     false,
+			ExpectedPermissive: true,
+		},
+		"incomplete": {
+			Record: func() *string {
+				str := "foo-1.0.dist-info/METADATA,,\n" +
+					"foo/data.txt," + recordHash(data) + ",6\n"
+				return &str
+			}(),
+			ExpectedStrict:     false,
+			ExpectedPermissive: true,
+		},
+		"mismatch": {
+			Record: func() *string {
+				str := "foo/data.txt," + recordHash("changed\n") + ",6\n"
+				return &str
+			}(),
+			ExpectedStrict:     false,
+			ExpectedPermissive: false,
+		},
+	}
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			return nil, nil
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			filename := filepath.Join(t.TempDir(), "foo-1.0-py3-none-any.whl")
+			fh, err := os.Create(filename)
+			require.NoError(t, err)
+			zipWriter := zip.NewWriter(fh)
+			files := [][2]string{
+				{"foo-1.0.dist-info/METADATA", metadata},
+				{"foo-1.0.dist-info/WHEEL", wheel},
+				{"foo/data.txt", data},
+			}
+			if tcData.Record != nil {
+				files = append(files, [2]string{"foo-1.0.dist-info/RECORD", *tcData.Record})
+			}
+			for _, file := range files {
+				w, err := zipWriter.Create(file[0])
+				require.NoError(t, err)
+				_, err = w.Write([]byte(file[1]))
+				require.NoError(t, err)
+			}
+			require.NoError(t, zipWriter.Close())
+			require.NoError(t, fh.Close())
+
+			ctx := context.Background()
+			_, err = bdist.InstallWheel(ctx, plat, time.Time{}, time.Time{}, filename, nil)
+			if tcData.ExpectedStrict {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, bdist.ErrIntegrity)
+			}
+			_, err = bdist.InstallWheel(bdist.WithPermissiveRecord(ctx),
+				plat, time.Time{}, time.Time{}, filename, nil)
+			if tcData.ExpectedPermissive {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package bdist_test
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/testutil"
+)
+
+func TestInstallWheelToVFS(t *testing.T) {
+	t.Parallel()
+	const (
+		metadataFile = "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n"
+		wheelFile    = "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n"
+	)
+	filename := writeLinkWheel(t, []linkTestFile{
+		{Name: "foo-1.0.dist-info/METADATA", Content: metadataFile, Mode: 0o644},
+		{Name: "foo-1.0.dist-info/WHEEL", Content: wheelFile, Mode: 0o644},
+		{Name: "foo/data.txt", Content: "shared data", Mode: 0o644},
+		{Name: "foo/a/copy.txt", Content: "shared data", Mode: 0o644, SameAs: 2},
+	})
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		UID:   1000,
+		UName: "app",
+		PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			return nil, nil
+		},
+	}
+	ctx := context.Background()
+	maxTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	wheelFH, err := os.Open(filename)
+	require.NoError(t, err)
+	defer wheelFH.Close()
+	wheelInfo, err := wheelFH.Stat()
+	require.NoError(t, err)
+
+	vfs, distInfoDir, err := bdist.InstallWheelToVFS(ctx, plat, time.Time{}, maxTime,
+		filename, wheelFH, wheelInfo.Size(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "usr/lib/python3/site-packages/foo-1.0.dist-info", distInfoDir)
+
+	const sitePackages = "usr/lib/python3/site-packages/"
+	for _, name := range []string{"usr", "usr/lib", sitePackages + "foo/a", distInfoDir + "/WHEEL"} {
+		assert.Contains(t, vfs, name)
+	}
+	for name, file := range vfs {
+		assert.Equal(t, name, file.FullName())
+		header, ok := file.Sys().(*tar.Header)
+		require.True(t, ok, "%q: Sys() is not a *tar.Header", name)
+		assert.Equal(t, 1000, header.Uid, name)
+		assert.Equal(t, "app", header.Uname, name)
+		assert.False(t, header.ModTime.After(maxTime), name)
+	}
+	link, ok := vfs[sitePackages+"foo/data.txt"].Sys().(*tar.Header)
+	require.True(t, ok)
+	assert.Equal(t, byte(tar.TypeLink), link.Typeflag)
+	assert.Equal(t, sitePackages+"foo/a/copy.txt", link.Linkname)
+
+	reader, err := vfs[distInfoDir+"/METADATA"].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, metadataFile, string(content))
+
+	// The layer is just the VFS.
+	expLayer, err := fsutil.LayerFromFileReferencesContext(ctx, fsutil.FileReferencesFromMap(vfs), maxTime)
+	require.NoError(t, err)
+	actLayer, err := bdist.InstallWheel(ctx, plat, time.Time{}, maxTime, filename, nil)
+	require.NoError(t, err)
+	testutil.AssertEqualLayers(t, expLayer, actLayer)
+}
@@ -0,0 +1,59 @@
+package bdist_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/warnings"
+)
+
+func TestWarnings(t *testing.T) {
+	t.Parallel()
+	filename := writeWheel(t, "foo-1.0-py3-none-any.whl", map[string]string{
+		"foo/__init__.py":            "",
+		"foo-1.0.dist-info/METADATA": "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n",
+		"foo-1.0.dist-info/WHEEL":    "Wheel-Version: 1.9\nRoot-Is-Purelib: true\n",
+	})
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: "/usr/bin/python3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			return nil, nil
+		},
+	}
+
+	collector := &warnings.Collector{} //nolint:exhaustivestruct
+	ctx := warnings.WithCollector(context.Background(), collector)
+	_, err := bdist.InstallWheel(ctx, plat, time.Time{}, time.Time{}, filename, nil)
+	require.NoError(t, err)
+	classes := make([]warnings.Class, 0, 2)
+	for _, warning := range collector.Warnings() {
+		classes = append(classes, warning.Class)
+	}
+	assert.Equal(t, []warnings.Class{warnings.Tags, warnings.WheelVersion}, classes)
+
+	for _, class := range []warnings.Class{warnings.Tags, warnings.WheelVersion} {
+		strict := &warnings.Collector{Strict: []warnings.Class{class}} //nolint:exhaustivestruct
+		ctx := warnings.WithCollector(context.Background(), strict)
+		_, err := bdist.InstallWheel(ctx, plat, time.Time{}, time.Time{}, filename, nil)
+		require.Error(t, err, class)
+		assert.True(t, errors.Is(err, warnings.ErrStrict), class)
+	}
+}
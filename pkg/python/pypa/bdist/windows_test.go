@@ -0,0 +1,99 @@
+package bdist_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+func TestInstallWheelWindows(t *testing.T) {
+	t.Parallel()
+	const (
+		metadataFile = "Metadata-Version: 2.1\nName: foo\nVersion: 1.0\n"
+		wheelFile    = "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n"
+	)
+	filename := writeLinkWheel(t, []linkTestFile{
+		{Name: "foo-1.0.dist-info/METADATA", Content: metadataFile, Mode: 0o644},
+		{Name: "foo-1.0.dist-info/WHEEL", Content: wheelFile, Mode: 0o644},
+		{Name: "foo/data.txt", Content: "shared data", Mode: 0o644},
+		{Name: "foo/a/copy.txt", Content: "shared data", Mode: 0o644, SameAs: 2},
+	})
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang: `C:\Python39\python.exe`,
+		Scheme: python.Scheme{
+			PureLib: `C:\Python39\Lib\site-packages`,
+			PlatLib: `C:\Python39\Lib\site-packages`,
+			Headers: `C:\Python39\Include\foo`,
+			Scripts: `C:\Python39\Scripts`,
+			Data:    `C:\Python39`,
+			Include: "",
+		},
+		Windows: true,
+		PyCompile: func(context.Context, time.Time, []string, []fsutil.FileReference) (
+			[]fsutil.FileReference, error,
+		) {
+			return nil, nil
+		},
+	}
+	layer, err := bdist.InstallWheel(context.Background(), plat, time.Time{}, time.Time{}, filename, nil)
+	require.NoError(t, err)
+
+	layerReader, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer layerReader.Close()
+	type entry struct {
+		Type     byte
+		Linkname string
+		Attrs    uint32
+	}
+	var names []string
+	entries := make(map[string]entry)
+	tarReader := tar.NewReader(layerReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		attrs, ok := fsutil.WindowsFileAttributes(header)
+		assert.True(t, ok, "%q has no file attributes", header.Name)
+		names = append(names, header.Name)
+		entries[header.Name] = entry{
+			Type:     header.Typeflag,
+			Linkname: header.Linkname,
+			Attrs:    attrs,
+		}
+	}
+	const sitePackages = "Files/Python39/Lib/site-packages/"
+	assert.Equal(t, []string{
+		"Files/",
+		"Files/Python39/",
+		"Files/Python39/Lib/",
+		sitePackages,
+		sitePackages + "foo/",
+		sitePackages + "foo/a/",
+		sitePackages + "foo/a/copy.txt",
+		sitePackages + "foo/data.txt",
+		sitePackages + "foo-1.0.dist-info/",
+		sitePackages + "foo-1.0.dist-info/METADATA",
+		sitePackages + "foo-1.0.dist-info/WHEEL",
+		"Hives/",
+	}, names)
+	dirAttrs := uint32(python.FileAttributeDirectory)
+	fileAttrs := uint32(python.FileAttributeArchive)
+	assert.Equal(t, entry{Type: tar.TypeDir, Attrs: dirAttrs}, entries["Hives/"])
+	assert.Equal(t, entry{Type: tar.TypeDir, Attrs: dirAttrs}, entries[sitePackages+"foo/"])
+	assert.Equal(t, entry{Type: tar.TypeReg, Attrs: fileAttrs}, entries[sitePackages+"foo/a/copy.txt"])
+	assert.Equal(t, entry{Type: tar.TypeLink, Linkname: sitePackages + "foo/a/copy.txt", Attrs: fileAttrs},
+		entries[sitePackages+"foo/data.txt"])
+}
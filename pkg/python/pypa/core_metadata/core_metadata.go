@@ -0,0 +1,145 @@
+// Package core_metadata implements editing the core metadata ("METADATA") and "WHEEL" files of a
+// distribution at install time, for the PyPA Core metadata specifications.
+//
+// https://packaging.python.org/en/latest/specifications/core-metadata/
+package core_metadata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Field is a single "Name: Value" header field.
+type Field struct {
+	Name string
+	// Value is the value as written in the file, after the ": " separator; for a value that
+	// spans multiple lines, it contains the newlines and the indentation of the continuation
+	// lines.
+	Value string
+}
+
+// A File is an email-header-style file, as used for both the METADATA and WHEEL files in a
+// .dist-info directory.  The order and spelling of the fields are preserved.
+type File struct {
+	Fields []Field
+	// Body is everything after the blank line that ends the header; newer versions of METADATA
+	// use it for the long description.  It is empty if there is no body.
+	Body string
+
+	newline string
+}
+
+// Parse parses the content of a METADATA or WHEEL file.
+func Parse(content []byte) (*File, error) {
+	str := string(content)
+	file := &File{ //nolint:exhaustivestruct // filled in below
+		newline: "\n",
+	}
+	if idx := strings.Index(str, "\n"); idx > 0 && str[idx-1] == '\r' {
+		file.newline = "\r\n"
+	}
+	for str != "" {
+		var line string
+		if idx := strings.Index(str, file.newline); idx >= 0 {
+			line, str = str[:idx], str[idx+len(file.newline):]
+		} else {
+			line, str = str, ""
+		}
+		switch {
+		case line == "":
+			file.Body = str
+			return file, nil
+		case line[0] == ' ' || line[0] == '\t':
+			if len(file.Fields) == 0 {
+				return nil, fmt.Errorf("core_metadata.Parse: continuation line before any field: %q", line)
+			}
+			file.Fields[len(file.Fields)-1].Value += file.newline + line
+		default:
+			colon := strings.Index(line, ":")
+			if colon <= 0 {
+				return nil, fmt.Errorf("core_metadata.Parse: invalid header line: %q", line)
+			}
+			file.Fields = append(file.Fields, Field{
+				Name:  line[:colon],
+				Value: strings.TrimLeft(line[colon+1:], " \t"),
+			})
+		}
+	}
+	return file, nil
+}
+
+// Bytes returns the content of the file.
+func (f *File) Bytes() []byte {
+	newline := f.newline
+	if newline == "" {
+		newline = "\n"
+	}
+	var ret strings.Builder
+	for _, field := range f.Fields {
+		ret.WriteString(field.Name + ": " + field.Value + newline)
+	}
+	if f.Body != "" {
+		ret.WriteString(newline + f.Body)
+	}
+	return []byte(ret.String())
+}
+
+// Get returns the value of the first field with the given name (compared case-insensitively), or
+// an empty string if there is no such field.
+func (f *File) Get(name string) string {
+	for _, field := range f.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// GetAll returns the values of all fields with the given name (compared case-insensitively), for
+// multiple-use fields such as "Requires-Dist" or "Tag".
+func (f *File) GetAll(name string) []string {
+	var ret []string
+	for _, field := range f.Fields {
+		if strings.EqualFold(field.Name, name) {
+			ret = append(ret, field.Value)
+		}
+	}
+	return ret
+}
+
+// Set sets the value of the field with the given name; replacing the first existing field of that
+// name (and removing any others), or appending a new field if there are none.
+func (f *File) Set(name, value string) {
+	fields := f.Fields[:0]
+	found := false
+	for _, field := range f.Fields {
+		if strings.EqualFold(field.Name, name) {
+			if found {
+				continue
+			}
+			found = true
+			field.Value = value
+		}
+		fields = append(fields, field)
+	}
+	f.Fields = fields
+	if !found {
+		f.Add(name, value)
+	}
+}
+
+// Add appends a field, without touching any existing fields of the same name.
+func (f *File) Add(name, value string) {
+	f.Fields = append(f.Fields, Field{Name: name, Value: value})
+}
+
+// Del removes all fields with the given name (compared case-insensitively).
+func (f *File) Del(name string) {
+	fields := f.Fields[:0]
+	for _, field := range f.Fields {
+		if !strings.EqualFold(field.Name, name) {
+			fields = append(fields, field)
+		}
+	}
+	f.Fields = fields
+}
@@ -0,0 +1,150 @@
+package core_metadata_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/python/pypa/core_metadata"
+)
+
+const testMetadata = "Metadata-Version: 2.1\n" +
+	"Name: example\n" +
+	"Version: 1.2.3\n" +
+	"Classifier: A\n" +
+	"Classifier: B\n" +
+	"License: Line one\n" +
+	"        Line two\n" +
+	"Description-Content-Type: text/markdown\n" +
+	"\n" +
+	"# Example\n" +
+	"\n" +
+	"A long description.\n"
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	for name, input := range map[string]string{
+		"metadata": testMetadata,
+		"crlf":     "Wheel-Version: 1.0\r\nGenerator: bdist_wheel\r\nTag: py3-none-any\r\n",
+		"no-body":  "Name: example\nVersion: 1.0\n",
+	} {
+		file, err := core_metadata.Parse([]byte(input))
+		require.NoError(t, err, name)
+		assert.Equal(t, input, string(file.Bytes()), name)
+	}
+
+	file, err := core_metadata.Parse([]byte(testMetadata))
+	require.NoError(t, err)
+	assert.Equal(t, "example", file.Get("name"))
+	assert.Equal(t, []string{"A", "B"}, file.GetAll("Classifier"))
+	assert.Equal(t, "Line one\n        Line two", file.Get("License"))
+	assert.Equal(t, "# Example\n\nA long description.\n", file.Body)
+
+	file.Set("Classifier", "C")
+	file.Del("License")
+	file.Add("X-Extra", "yes")
+	assert.Equal(t, "Metadata-Version: 2.1\n"+
+		"Name: example\n"+
+		"Version: 1.2.3\n"+
+		"Classifier: C\n"+
+		"Description-Content-Type: text/markdown\n"+
+		"X-Extra: yes\n"+
+		"\n"+
+		"# Example\n"+
+		"\n"+
+		"A long description.\n", string(file.Bytes()))
+
+	_, err = core_metadata.Parse([]byte(" continuation\n"))
+	assert.Error(t, err)
+	_, err = core_metadata.Parse([]byte("no colon\n"))
+	assert.Error(t, err)
+}
+
+func inMemFile(name string, content []byte) fsutil.FileReference {
+	return &fsutil.InMemFileReference{
+		FileInfo: (&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+		}).FileInfo(),
+		MFullName: name,
+		MContent:  content,
+	}
+}
+
+func readVFSFile(t *testing.T, vfs map[string]fsutil.FileReference, name string) []byte {
+	t.Helper()
+	reader, err := vfs[name].Open()
+	require.NoError(t, err)
+	defer func() {
+		_ = reader.Close()
+	}()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return content
+}
+
+func TestMutate(t *testing.T) {
+	t.Parallel()
+	const distInfo = "site-packages/example-1.2.3.dist-info"
+
+	sha256 := pep376.RecordHash{Algorithm: "sha256", Digest: nil}
+	wheelContent := []byte("Wheel-Version: 1.0\nTag: py3-none-any\n")
+	wheelHash, err := sha256.Compute(bytes.NewReader(wheelContent))
+	require.NoError(t, err)
+	var record bytes.Buffer
+	require.NoError(t, pep376.WriteRecord(&record, []pep376.RecordEntry{
+		{Path: "example-1.2.3.dist-info/METADATA", Hash: sha256, Size: 1},
+		{Path: "example-1.2.3.dist-info/RECORD", Hash: pep376.RecordHash{}, Size: -1}, //nolint:exhaustivestruct
+		{Path: "example-1.2.3.dist-info/WHEEL", Hash: wheelHash, Size: int64(len(wheelContent))},
+	}))
+	vfs := map[string]fsutil.FileReference{
+		distInfo + "/METADATA": inMemFile(distInfo+"/METADATA", []byte(testMetadata)),
+		distInfo + "/WHEEL":    inMemFile(distInfo+"/WHEEL", wheelContent),
+		distInfo + "/RECORD":   inMemFile(distInfo+"/RECORD", record.Bytes()),
+	}
+
+	localVersion, err := core_metadata.LocalVersion("acme.1")
+	require.NoError(t, err)
+	setField, err := core_metadata.SetField(core_metadata.MetadataFile, "X-Built-By", "ocibuild")
+	require.NoError(t, err)
+	hook := core_metadata.Mutate(localVersion, setField, core_metadata.StripDescription())
+	require.NoError(t, hook(context.Background(), time.Unix(0, 0), vfs, distInfo))
+
+	metadata := readVFSFile(t, vfs, distInfo+"/METADATA")
+	assert.Equal(t, "Metadata-Version: 2.1\n"+
+		"Name: example\n"+
+		"Version: 1.2.3+acme.1\n"+
+		"Classifier: A\n"+
+		"Classifier: B\n"+
+		"License: Line one\n"+
+		"        Line two\n"+
+		"X-Built-By: ocibuild\n", string(metadata))
+	assert.Equal(t, wheelContent, readVFSFile(t, vfs, distInfo+"/WHEEL"))
+
+	entries, err := pep376.ParseRecord(bytes.NewReader(readVFSFile(t, vfs, distInfo+"/RECORD")))
+	require.NoError(t, err)
+	metadataHash, err := sha256.Compute(bytes.NewReader(metadata))
+	require.NoError(t, err)
+	assert.Equal(t, []pep376.RecordEntry{
+		{Path: "example-1.2.3.dist-info/METADATA", Hash: metadataHash, Size: int64(len(metadata))},
+		{Path: "example-1.2.3.dist-info/RECORD", Hash: pep376.RecordHash{}, Size: -1}, //nolint:exhaustivestruct
+		{Path: "example-1.2.3.dist-info/WHEEL", Hash: wheelHash, Size: int64(len(wheelContent))},
+	}, entries)
+
+	_, err = core_metadata.LocalVersion("not+valid")
+	assert.Error(t, err)
+	_, err = core_metadata.SetField("RECORD", "X", "y")
+	assert.Error(t, err)
+	_, err = core_metadata.SetField(core_metadata.MetadataFile, "X", "multi\nline")
+	assert.Error(t, err)
+}
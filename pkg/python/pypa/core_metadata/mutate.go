@@ -0,0 +1,229 @@
+package core_metadata
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// The names of the files in the .dist-info directory that a Mutator may be called on.
+const (
+	MetadataFile = "METADATA"
+	WheelFile    = "WHEEL"
+)
+
+// A Mutator edits an installed METADATA or WHEEL file in place.  The filename is either
+// MetadataFile or WheelFile; a Mutator that only cares about one of them should ignore the other.
+type Mutator func(ctx context.Context, filename string, file *File) error
+
+// Mutate returns a bdist.PostInstallHook that runs each of the mutators, in order, on the
+// installed METADATA and WHEEL files, and writes back any files that they changed.
+//
+// If the RECORD file has already been written (that is: recording_installs.Record runs before
+// this hook), then the hashes and sizes of the changed files are updated in it; otherwise
+// recording_installs.Record will record the changed files when it runs.
+func Mutate(mutators ...Mutator) bdist.PostInstallHook {
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		vfs map[string]fsutil.FileReference,
+		installedDistInfoDir string,
+	) error {
+		changed := make(map[string][]byte)
+		for _, filename := range []string{MetadataFile, WheelFile} {
+			fullname := path.Join(installedDistInfoDir, filename)
+			ref, ok := vfs[fullname]
+			if !ok {
+				continue
+			}
+			content, err := readFile(ref)
+			if err != nil {
+				return fmt.Errorf("core_metadata: %s: %w", filename, err)
+			}
+			file, err := Parse(content)
+			if err != nil {
+				return fmt.Errorf("core_metadata: %s: %w", filename, err)
+			}
+			before := file.Bytes()
+			for _, mutator := range mutators {
+				if err := mutator(ctx, filename, file); err != nil {
+					return fmt.Errorf("core_metadata: %s: %w", filename, err)
+				}
+			}
+			after := file.Bytes()
+			if bytes.Equal(before, after) {
+				continue
+			}
+			header := &tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     fullname,
+				Mode:     int64(ref.Mode().Perm()),
+				Size:     int64(len(after)),
+				ModTime:  clampTime,
+			}
+			vfs[fullname] = &fsutil.InMemFileReference{
+				FileInfo:  header.FileInfo(),
+				MFullName: fullname,
+				MContent:  after,
+			}
+			changed[path.Join(path.Base(installedDistInfoDir), filename)] = after
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+		if err := updateRecord(clampTime, vfs, installedDistInfoDir, changed); err != nil {
+			return fmt.Errorf("core_metadata: RECORD: %w", err)
+		}
+		return nil
+	}
+}
+
+// updateRecord updates the RECORD entries for the changed files (keyed by their path as written
+// in RECORD), if RECORD exists.
+func updateRecord(
+	clampTime time.Time,
+	vfs map[string]fsutil.FileReference,
+	installedDistInfoDir string,
+	changed map[string][]byte,
+) error {
+	fullname := path.Join(installedDistInfoDir, "RECORD")
+	ref, ok := vfs[fullname]
+	if !ok {
+		return nil
+	}
+	content, err := readFile(ref)
+	if err != nil {
+		return err
+	}
+	entries, err := pep376.ParseRecord(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		newContent, ok := changed[entry.Path]
+		if !ok {
+			continue
+		}
+		if !entry.Hash.IsZero() {
+			entries[i].Hash, err = entry.Hash.Compute(bytes.NewReader(newContent))
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.Path, err)
+			}
+		}
+		if entry.Size >= 0 {
+			entries[i].Size = int64(len(newContent))
+		}
+	}
+	var buf bytes.Buffer
+	if err := pep376.WriteRecord(&buf, entries); err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     fullname,
+		Mode:     int64(ref.Mode().Perm()),
+		Size:     int64(buf.Len()),
+		ModTime:  clampTime,
+	}
+	vfs[fullname] = &fsutil.InMemFileReference{
+		FileInfo:  header.FileInfo(),
+		MFullName: fullname,
+		MContent:  buf.Bytes(),
+	}
+	return nil
+}
+
+func readFile(ref fsutil.FileReference) ([]byte, error) {
+	reader, err := ref.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	return io.ReadAll(reader)
+}
+
+// reLocalLabel is the syntax of a PEP 440 local version label.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var reLocalLabel = regexp.MustCompile(`^[a-zA-Z0-9]+([-_.][a-zA-Z0-9]+)*$`)
+
+// LocalVersion returns a Mutator that adds a PEP 440 local version label (such as "acme.1") to the
+// Version in METADATA; "1.2.3" becomes "1.2.3+acme.1", and "1.2.3+ubuntu" becomes
+// "1.2.3+ubuntu.acme.1".
+//
+// The name of the .dist-info directory is not changed; importlib.metadata and pip take the version
+// from METADATA, not from the directory name.
+func LocalVersion(label string) (Mutator, error) {
+	if !reLocalLabel.MatchString(label) {
+		return nil, fmt.Errorf("core_metadata.LocalVersion: invalid local version label: %q", label)
+	}
+	return func(_ context.Context, filename string, file *File) error {
+		if filename != MetadataFile {
+			return nil
+		}
+		oldVersion := file.Get("Version")
+		ver, err := pep440.ParseVersion(oldVersion)
+		if err != nil {
+			return err
+		}
+		sep := "+"
+		if len(ver.Local) > 0 {
+			sep = "."
+		}
+		newVersion := oldVersion + sep + label
+		if _, err := pep440.ParseVersion(newVersion); err != nil {
+			return err
+		}
+		file.Set("Version", newVersion)
+		return nil
+	}, nil
+}
+
+// SetField returns a Mutator that sets a field in the given file (MetadataFile or WheelFile),
+// replacing any existing fields of the same name; see File.Set.
+func SetField(filename, name, value string) (Mutator, error) {
+	if filename != MetadataFile && filename != WheelFile {
+		return nil, fmt.Errorf("core_metadata.SetField: invalid file name %q: must be %q or %q",
+			filename, MetadataFile, WheelFile)
+	}
+	if name == "" || strings.ContainsAny(name, ": \t\r\n") {
+		return nil, fmt.Errorf("core_metadata.SetField: invalid field name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return nil, fmt.Errorf("core_metadata.SetField: %s: value must be a single line", name)
+	}
+	return func(_ context.Context, fname string, file *File) error {
+		if fname == filename {
+			file.Set(name, value)
+		}
+		return nil
+	}, nil
+}
+
+// StripDescription returns a Mutator that removes the long description from METADATA (both the
+// message body and the older "Description" field, along with "Description-Content-Type"), which
+// for some packages is most of the size of the .dist-info directory.
+func StripDescription() Mutator {
+	return func(_ context.Context, filename string, file *File) error {
+		if filename != MetadataFile {
+			return nil
+		}
+		file.Del("Description")
+		file.Del("Description-Content-Type")
+		file.Body = ""
+		return nil
+	}
+}
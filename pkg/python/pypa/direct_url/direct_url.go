@@ -7,7 +7,11 @@ package direct_url
 import (
 	"archive/tar"
 	"context"
+	"fmt"
+	"net/url"
 	"path"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/datawire/ocibuild/pkg/fsutil"
@@ -28,13 +32,178 @@ type VCSInfo struct {
 }
 
 type ArchiveInfo struct {
-	Hash string `json:"hash,omitempty"`
+	// Hash is deprecated in favor of Hashes, but should still be set for compatibility with
+	// older installers.
+	Hash   string            `json:"hash,omitempty"`   // "<hash-algorithm>=<expected-hash>"
+	Hashes map[string]string `json:"hashes,omitempty"` // {"<hash-algorithm>": "<expected-hash>"}
 }
 
 type DirInfo struct {
 	Editable bool `json:"editable,omitempty"`
 }
 
+//nolint:gochecknoglobals // Would be 'const'.
+var (
+	reHash = regexp.MustCompile(`^[a-z0-9_]+=[0-9a-f]+$`)
+	reEnv  = regexp.MustCompile(`^\$\{[A-Za-z0-9-_]+\}(:\$\{[A-Za-z0-9-_]+\})?$`)
+)
+
+// Validate returns an error if the DirectURL does not conform to the specification.
+func (urlData DirectURL) Validate() error {
+	if urlData.URL == "" {
+		return fmt.Errorf("direct_url: missing url")
+	}
+	// When the url refers to a VCS repository, ... it MUST be stripped of any sensitive
+	// authentication information, for security reasons.  The user:password section of the URL
+	// MAY however be composed of environment variables, matching the following regular
+	// expression: \$\{[A-Za-z0-9-_]+\}(:\$\{[A-Za-z0-9-_]+\})?  Additionally, the
+	// user:password section of the URL MAY be a well-known, non security sensitive string. A
+	// typical example is git in the case of a URL such as ssh://git@gitlab.com/user/repo.
+	//
+	// Go's url.Parse won't accept "${...}" in the userinfo, so check for that before parsing.
+	urlStr := urlData.URL
+	if userinfo, rest, ok := splitUserinfo(urlStr); ok && reEnv.MatchString(userinfo) {
+		urlStr = rest
+	}
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return fmt.Errorf("direct_url: invalid url: %w", err)
+	}
+	if parsedURL.User != nil {
+		if _, hasPassword := parsedURL.User.Password(); hasPassword {
+			return fmt.Errorf("direct_url: url contains credentials: %q", parsedURL.Redacted())
+		}
+	}
+
+	nInfos := 0
+	if urlData.VCSInfo != nil {
+		nInfos++
+		if urlData.VCSInfo.VCS == "" {
+			return fmt.Errorf("direct_url: vcs_info: missing vcs")
+		}
+		if urlData.VCSInfo.CommitID == "" {
+			return fmt.Errorf("direct_url: vcs_info: missing commit_id")
+		}
+		if strings.HasPrefix(parsedURL.Scheme, urlData.VCSInfo.VCS+"+") {
+			return fmt.Errorf("direct_url: url must not include the %q prefix: %q",
+				urlData.VCSInfo.VCS+"+", urlData.URL)
+		}
+	}
+	if urlData.ArchiveInfo != nil {
+		nInfos++
+		if urlData.ArchiveInfo.Hash != "" && !reHash.MatchString(urlData.ArchiveInfo.Hash) {
+			return fmt.Errorf("direct_url: archive_info: invalid hash: %q", urlData.ArchiveInfo.Hash)
+		}
+		for algo, val := range urlData.ArchiveInfo.Hashes {
+			if !reHash.MatchString(algo + "=" + val) {
+				return fmt.Errorf("direct_url: archive_info: invalid hash: %q: %q", algo, val)
+			}
+		}
+	}
+	if urlData.DirInfo != nil {
+		nInfos++
+		if parsedURL.Scheme != "file" {
+			return fmt.Errorf("direct_url: dir_info: url must be a file:// URL: %q", urlData.URL)
+		}
+	}
+	if nInfos != 1 {
+		return fmt.Errorf("direct_url: exactly one of vcs_info, archive_info, or dir_info must be present; got %d",
+			nInfos)
+	}
+	return nil
+}
+
+// splitUserinfo splits the "user:password@" section out of a URL string, returning the userinfo and
+// the URL without it.
+func splitUserinfo(str string) (userinfo, rest string, ok bool) {
+	schemeEnd := strings.Index(str, "://")
+	if schemeEnd < 0 {
+		return "", str, false
+	}
+	authorityBeg := schemeEnd + len("://")
+	authorityEnd := len(str)
+	if idx := strings.IndexAny(str[authorityBeg:], "/?#"); idx >= 0 {
+		authorityEnd = authorityBeg + idx
+	}
+	at := strings.LastIndex(str[authorityBeg:authorityEnd], "@")
+	if at < 0 {
+		return "", str, false
+	}
+	return str[authorityBeg : authorityBeg+at], str[:authorityBeg] + str[authorityBeg+at+1:], true
+}
+
+//nolint:gochecknoglobals // Would be 'const'.
+var vcsSchemes = map[string]struct{}{
+	"git": {},
+	"hg":  {},
+	"bzr": {},
+	"svn": {},
+}
+
+//nolint:gochecknoglobals // Would be 'const'.
+var archiveExts = []string{".whl", ".zip", ".tar.gz", ".tgz", ".tar.bz2", ".tbz", ".tar.xz", ".txz", ".tar"}
+
+// ParseRequirementURL parses a URL in the form that pip accepts for a direct reference, and returns
+// the DirectURL that it corresponds to.  For example:
+//
+//   - "git+https://github.com/pypa/pip.git@main" is a VCS reference; the "@main" is the requested
+//     revision.
+//   - "file:///home/user/project" is a local directory.
+//   - "https://example.com/foo-1.0-py3-none-any.whl" is an archive.
+//
+// Because the information isn't present in the URL, the caller must fill in VCSInfo.CommitID for
+// VCS references, and should fill in ArchiveInfo.Hashes for archives.
+func ParseRequirementURL(str string) (*DirectURL, error) {
+	parsedURL, err := url.Parse(str)
+	if err != nil {
+		return nil, fmt.Errorf("direct_url.ParseRequirementURL: %w", err)
+	}
+	if parsedURL.Scheme == "" {
+		return nil, fmt.Errorf("direct_url.ParseRequirementURL: not an absolute URL: %q", str)
+	}
+	// Strip any "#egg=" or "#sha256=" fragment.
+	parsedURL.Fragment = ""
+	parsedURL.RawFragment = ""
+
+	if idx := strings.Index(parsedURL.Scheme, "+"); idx >= 0 {
+		vcs, scheme := parsedURL.Scheme[:idx], parsedURL.Scheme[idx+1:]
+		if _, known := vcsSchemes[vcs]; !known {
+			return nil, fmt.Errorf("direct_url.ParseRequirementURL: unknown VCS: %q", vcs)
+		}
+		parsedURL.Scheme = scheme
+		var rev string
+		if idx := strings.LastIndex(parsedURL.Path, "@"); idx >= 0 {
+			parsedURL.Path, rev = parsedURL.Path[:idx], parsedURL.Path[idx+1:]
+			parsedURL.RawPath = ""
+		}
+		return &DirectURL{
+			URL: parsedURL.String(),
+			VCSInfo: &VCSInfo{
+				VCS:               vcs,
+				RequestedRevision: rev,
+				CommitID:          "",
+			},
+		}, nil
+	}
+
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(parsedURL.Path, ext) {
+			return &DirectURL{
+				URL:         parsedURL.String(),
+				ArchiveInfo: &ArchiveInfo{},
+			}, nil
+		}
+	}
+	if parsedURL.Scheme == "file" {
+		return &DirectURL{
+			URL:     parsedURL.String(),
+			DirInfo: &DirInfo{},
+		}, nil
+	}
+	return nil, fmt.Errorf("direct_url.ParseRequirementURL: URL is not a VCS reference, an archive, "+
+		"or a local directory: %q", str)
+}
+
 func Record(urlData DirectURL) bdist.PostInstallHook {
 	return func(
 		ctx context.Context,
@@ -42,6 +211,9 @@ func Record(urlData DirectURL) bdist.PostInstallHook {
 		vfs map[string]fsutil.FileReference,
 		installedDistInfoDir string,
 	) error {
+		if err := urlData.Validate(); err != nil {
+			return err
+		}
 		bs, err := jsonDumps(urlData)
 		if err != nil {
 			return err
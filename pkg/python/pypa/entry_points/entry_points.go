@@ -5,6 +5,7 @@ package entry_points
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"context"
 	"fmt"
@@ -19,31 +20,47 @@ import (
 	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
 )
 
-//nolint:gochecknoglobals // Would be 'const'.
-var (
-	scriptTmpl = template.Must(template.
-			New("entry_point.py").
-			Parse(`#!{{ .Shebang }}
+// DefaultScriptTemplate is the text/template that generates entry-point scripts if the Platform
+// doesn't specify a ScriptTemplate; it is the same as what pip generates.
+//
+// The template is executed with the following fields:
+//
+//   - .Shebang: the interpreter (Platform.ConsoleShebang or Platform.GraphicalShebang)
+//   - .Section: "console_scripts" or "gui_scripts"
+//   - .Name: the name of the script
+//   - .Module: the module to import the function from ("foo.cli")
+//   - .ImportName: the top-level name to import from the module ("main")
+//   - .Func: the (possibly dotted) function to call ("main" or "main.run")
+//
+// The output must begin with a "#!" line; for a Platform with WindowsLaunchers, that line is
+// what the launcher reads to find the interpreter, and the rest is the script that it runs.
+const DefaultScriptTemplate = `#!{{ .Shebang }}
 # -*- coding: utf-8 -*-
 import re
 import sys
-from {{ .Module }} import {{ .Func }}
+from {{ .Module }} import {{ .ImportName }}
 if __name__ == '__main__':
     sys.argv[0] = re.sub(r'(-script\.pyw|\.exe)?$', '', sys.argv[0])
     sys.exit({{ .Func }}())
-`))
+`
 
-	configParser = func() *python.ConfigParser {
-		configParser := python.NewConfigParser()
-		configParser.OptionTransform = func(str string) string { return str }
-		configParser.Delimiters = []string{"="}
-		return configParser
-	}()
+// This is lax on validation of the [extras] part, but that's OK; we don't care about that part.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var reFuncRef = regexp.MustCompile(`^(?P<callable>\w+([:.]\w+)*)(?:\s*\[.*\])?$`)
 
-	// This is lax on validation of the [extras] part, but that's OK; we don't care about that
-	// part.
-	reFuncRef = regexp.MustCompile(`^(?P<callable>\w+([:.]\w+)*)(?:\s*\[.*\])?$`)
-)
+// ParseScriptTemplate parses a Platform.ScriptTemplate; if it is empty, then DefaultScriptTemplate
+// is used.
+func ParseScriptTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultScriptTemplate
+	}
+	tmpl, err := template.New("entry_point.py").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("ScriptTemplate: %w", err)
+	}
+	return tmpl, nil
+}
 
 func CreateScripts(plat python.Platform) bdist.PostInstallHook {
 	return func(
@@ -55,6 +72,10 @@ func CreateScripts(plat python.Platform) bdist.PostInstallHook {
 		if err := plat.Init(); err != nil {
 			return err
 		}
+		scriptTmpl, err := ParseScriptTemplate(plat.ScriptTemplate)
+		if err != nil {
+			return err
+		}
 		configFile, ok := vfs[path.Join(installedDistInfoDir, "entry_points.txt")]
 		if !ok {
 			return nil
@@ -64,17 +85,27 @@ func CreateScripts(plat python.Platform) bdist.PostInstallHook {
 			return err
 		}
 
-		configData, err := configParser.Parse(configReader)
+		configData, err := python.ParseEntryPoints(configReader)
 		if err != nil {
 			return err
 		}
 
-		interesting := map[string]string{
-			"console_scripts": plat.ConsoleShebang,
-			"gui_scripts":     plat.GraphicalShebang,
+		var consoleLauncher, graphicalLauncher []byte
+		if plat.WindowsLaunchers != nil {
+			consoleLauncher = plat.WindowsLaunchers.Console
+			graphicalLauncher = plat.WindowsLaunchers.Graphical
+		}
+		interesting := []struct {
+			sectionName string
+			shebang     string
+			launcher    []byte
+		}{
+			{"console_scripts", plat.ConsoleShebang, consoleLauncher},
+			{"gui_scripts", plat.GraphicalShebang, graphicalLauncher},
 		}
 
-		for sectionName, shebang := range interesting {
+		for _, section := range interesting {
+			sectionName := section.sectionName
 			sectionData, ok := configData[sectionName]
 			if !ok {
 				continue
@@ -91,29 +122,89 @@ func CreateScripts(plat python.Platform) bdist.PostInstallHook {
 					return fmt.Errorf("entry_points.txt: %q: %q: not a function reference: %q",
 						sectionName, key, val)
 				}
+				shebang := section.shebang
+				if plat.WindowsLaunchers != nil &&
+					strings.Contains(shebang, " ") && !strings.HasPrefix(shebang, `"`) {
+					shebang = `"` + shebang + `"`
+				}
 				var buf bytes.Buffer
 				if err := scriptTmpl.Execute(&buf, map[string]string{
 					"Shebang":    shebang,
+					"Section":    sectionName,
+					"Name":       key,
 					"Module":     parts[0],
 					"ImportName": strings.SplitN(parts[1], ".", 2)[0],
 					"Func":       parts[1],
 				}); err != nil {
 					return fmt.Errorf("%s: %s: %w", sectionName, key, err)
 				}
+				if !bytes.HasPrefix(buf.Bytes(), []byte("#!")) {
+					return fmt.Errorf("%s: %s: ScriptTemplate output does not begin with a \"#!\" line",
+						sectionName, key)
+				}
+				filename := key
+				content := buf.Bytes()
+				if plat.WindowsLaunchers != nil {
+					if len(section.launcher) == 0 {
+						return fmt.Errorf("%s: %s: Platform does not specify a launcher for %s",
+							sectionName, key, sectionName)
+					}
+					filename += ".exe"
+					content, err = windowsLauncher(section.launcher, content, clampTime)
+					if err != nil {
+						return fmt.Errorf("%s: %s: %w", sectionName, key, err)
+					}
+				}
 				header := &tar.Header{
 					Typeflag: tar.TypeReg,
-					Name:     path.Join(plat.Scheme.Scripts[1:], key),
+					Name:     path.Join(strings.TrimPrefix(plat.ToSlash(plat.Scheme.Scripts), "/"), filename),
 					Mode:     0o755,
-					Size:     int64(buf.Len()),
+					Size:     int64(len(content)),
 					ModTime:  clampTime,
 				}
 				vfs[header.Name] = &fsutil.InMemFileReference{
 					FileInfo:  header.FileInfo(),
 					MFullName: header.Name,
-					MContent:  buf.Bytes(),
+					MContent:  content,
 				}
 			}
 		}
 		return nil
 	}
 }
+
+// windowsLauncher builds a ".exe" wrapper for a script, the same way that
+// distlib.scripts.ScriptMaker._write_script does: the launcher stub, followed by the script's "#!"
+// line (which the launcher reads to find the interpreter), followed by a ZIP file containing the
+// rest of the script as "__main__.py" (which the interpreter runs).
+func windowsLauncher(launcher []byte, script []byte, clampTime time.Time) ([]byte, error) {
+	var shebangLine []byte
+	if nl := bytes.IndexByte(script, '\n'); nl >= 0 {
+		shebangLine, script = script[:nl+1], script[nl+1:]
+	} else {
+		shebangLine, script = append(script, '\n'), nil
+	}
+
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	fileWriter, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     "__main__.py",
+		Method:   zip.Store,
+		Modified: clampTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fileWriter.Write(script); err != nil {
+		return nil, err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(launcher)
+	buf.Write(shebangLine)
+	buf.Write(zipBuf.Bytes())
+	return buf.Bytes(), nil
+}
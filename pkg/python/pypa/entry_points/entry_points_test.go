@@ -0,0 +1,197 @@
+package entry_points_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/entry_points"
+)
+
+const distInfo = "usr/lib/python3/site-packages/foo-1.0.dist-info"
+
+// entryPointsVFS returns a VFS containing just an installed entry_points.txt with the given
+// content.
+func entryPointsVFS(entryPointsTxt string) map[string]fsutil.FileReference {
+	return map[string]fsutil.FileReference{
+		distInfo + "/entry_points.txt": &fsutil.InMemFileReference{
+			FileInfo: (&tar.Header{ //nolint:exhaustivestruct
+				Typeflag: tar.TypeReg,
+				Name:     distInfo + "/entry_points.txt",
+				Mode:     0o644,
+				Size:     int64(len(entryPointsTxt)),
+			}).FileInfo(),
+			MFullName: distInfo + "/entry_points.txt",
+			MContent:  []byte(entryPointsTxt),
+		},
+	}
+}
+
+func TestScriptTemplate(t *testing.T) {
+	t.Parallel()
+	const entryPointsTxt = "[console_scripts]\nfoo = foo.cli:main.run\n"
+
+	type testcase struct {
+		ScriptTemplate string
+		ExpectedScript string
+		ExpectedErr    string
+	}
+	testcases := map[string]testcase{
+		"default": {
+			ExpectedScript: "#!/usr/bin/python3\n" +
+				"# -*- coding: utf-8 -*-\n" +
+				"import re\n" +
+				"import sys\n" +
+				"from foo.cli import main\n" +
+				"if __name__ == '__main__':\n" +
+				"    sys.argv[0] = re.sub(r'(-script\\.pyw|\\.exe)?$', '', sys.argv[0])\n" +
+				"    sys.exit(main.run())\n",
+		},
+		"flags": {
+			ScriptTemplate: "#!{{ .Shebang }} -sE\nfrom {{ .Module }} import {{ .ImportName }}\n" +
+				"{{ .Func }}()\n",
+			ExpectedScript: "#!/usr/bin/python3 -sE\nfrom foo.cli import main\nmain.run()\n",
+		},
+		"shell": {
+			ScriptTemplate: "#!/bin/sh\n" +
+				"exec {{ .Shebang }} -I -c 'import {{ .Module }}; {{ .Module }}.{{ .Func }}()' {{ .Name }} \"$@\"\n",
+			ExpectedScript: "#!/bin/sh\n" +
+				"exec /usr/bin/python3 -I -c 'import foo.cli; foo.cli.main.run()' foo \"$@\"\n",
+		},
+		"bad-field": {
+			ScriptTemplate: "#!{{ .Interpreter }}\n",
+			ExpectedErr:    "console_scripts: foo:",
+		},
+		"no-shebang": {
+			ScriptTemplate: "import {{ .Module }}\n",
+			ExpectedErr:    "does not begin with a \"#!\" line",
+		},
+		"syntax": {
+			ScriptTemplate: "#!{{ .Shebang\n",
+			ExpectedErr:    "ScriptTemplate:",
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			plat := python.Platform{ //nolint:exhaustivestruct
+				ConsoleShebang: "/usr/bin/python3",
+				ScriptTemplate: tcData.ScriptTemplate,
+				Scheme: python.Scheme{
+					PureLib: "/usr/lib/python3/site-packages",
+					PlatLib: "/usr/lib/python3/site-packages",
+					Headers: "/usr/include/python3",
+					Scripts: "/usr/bin",
+					Data:    "/usr",
+					Include: "",
+				},
+			}
+			vfs := entryPointsVFS(entryPointsTxt)
+			err := entry_points.CreateScripts(plat)(context.Background(), time.Time{}, vfs, distInfo)
+			if tcData.ExpectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tcData.ExpectedErr)
+				return
+			}
+			require.NoError(t, err)
+			script, ok := vfs["usr/bin/foo"]
+			require.True(t, ok)
+			assert.Equal(t, int64(len(tcData.ExpectedScript)), script.Size())
+			reader, err := script.Open()
+			require.NoError(t, err)
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, tcData.ExpectedScript, string(content))
+		})
+	}
+}
+
+func TestWindowsLaunchers(t *testing.T) {
+	t.Parallel()
+	const entryPointsTxt = "[console_scripts]\nfoo = foo.cli:main\n[gui_scripts]\nfoo-gui = foo.gui:main\n"
+	plat := python.Platform{ //nolint:exhaustivestruct
+		ConsoleShebang:   "/opt/my python/bin/python3",
+		GraphicalShebang: "/opt/my python/bin/pythonw3",
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3/site-packages",
+			PlatLib: "/usr/lib/python3/site-packages",
+			Headers: "/usr/include/python3",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+		WindowsLaunchers: &python.WindowsLaunchers{
+			Console:   []byte("MZ console launcher\x00"),
+			Graphical: []byte("MZ graphical launcher\x00"),
+		},
+	}
+	clampTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	vfs := entryPointsVFS(entryPointsTxt)
+	require.NoError(t, entry_points.CreateScripts(plat)(context.Background(), clampTime, vfs, distInfo))
+
+	// No shebang-script is generated alongside the .exe.
+	_, ok := vfs["usr/bin/foo"]
+	assert.False(t, ok)
+
+	testcases := map[string]struct {
+		Launcher string
+		Shebang  string
+		Func     string
+	}{
+		"usr/bin/foo.exe": {
+			Launcher: "MZ console launcher\x00",
+			Shebang:  "#!\"/opt/my python/bin/python3\"\n",
+			Func:     "from foo.cli import main\n",
+		},
+		"usr/bin/foo-gui.exe": {
+			Launcher: "MZ graphical launcher\x00",
+			Shebang:  "#!\"/opt/my python/bin/pythonw3\"\n",
+			Func:     "from foo.gui import main\n",
+		},
+	}
+	for filename, tcData := range testcases {
+		file, ok := vfs[filename]
+		require.True(t, ok, filename)
+		assert.Equal(t, "-rwxr-xr-x", file.Mode().String(), filename)
+		reader, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), file.Size(), filename)
+
+		// The launcher, then the "#!" line, then a ZIP file with the rest of the script.
+		require.True(t, bytes.HasPrefix(content, []byte(tcData.Launcher+tcData.Shebang)), filename)
+		zipBytes := content[len(tcData.Launcher)+len(tcData.Shebang):]
+		zipReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		require.NoError(t, err)
+		require.Len(t, zipReader.File, 1)
+		assert.Equal(t, "__main__.py", zipReader.File[0].Name)
+		assert.True(t, clampTime.Equal(zipReader.File[0].Modified), filename)
+		mainReader, err := zipReader.File[0].Open()
+		require.NoError(t, err)
+		mainPy, err := io.ReadAll(mainReader)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(mainPy), "# -*- coding: utf-8 -*-\n"), filename)
+		assert.Contains(t, string(mainPy), tcData.Func, filename)
+	}
+
+	// Each section that has scripts needs a launcher.
+	plat.WindowsLaunchers = &python.WindowsLaunchers{ //nolint:exhaustivestruct
+		Console: []byte("MZ console launcher\x00"),
+	}
+	err := entry_points.CreateScripts(plat)(context.Background(), clampTime,
+		entryPointsVFS(entryPointsTxt), distInfo)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gui_scripts: foo-gui: Platform does not specify a launcher for gui_scripts")
+}
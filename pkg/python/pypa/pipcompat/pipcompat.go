@@ -0,0 +1,359 @@
+// Package pipcompat compares ocibuild's installation of a wheel against what pip (the Package
+// Installer for Python) does when installing the same wheel, so that divergences from pip can be
+// found across a matrix of Python and pip versions.
+//
+// The comparison installs the wheel twice: once with `pip install --no-deps --ignore-installed
+// --prefix=DIR`, and once with bdist.InstallWheel (with the same post-install hooks that pip
+// effectively runs), using a python.Platform that mimics what pip did.  The two resulting layers
+// should be identical.
+package pipcompat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/datawire/dlib/dexec"
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/datawire/ocibuild/pkg/dir"
+	"github.com/datawire/ocibuild/pkg/dockerutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pep376"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+	"github.com/datawire/ocibuild/pkg/python/pypa/direct_url"
+	"github.com/datawire/ocibuild/pkg/python/pypa/entry_points"
+	"github.com/datawire/ocibuild/pkg/python/pypa/recording_installs"
+	"github.com/datawire/ocibuild/pkg/reproducible"
+	"github.com/datawire/ocibuild/pkg/testutil"
+)
+
+// pipDriver is a Python script that is run (on the host, or inside of a container) to do pip's
+// side of the comparison.  Its arguments are PREFIX WHEELFILE PIPVERSION OWNER; PIPVERSION and
+// OWNER may be empty.  OWNER ("UID:GID") is who to chown the files that it creates in PREFIX's
+// parent to.  It writes the progress of pip to stderr, and a JSON object describing where pip
+// put things to stdout.
+const pipDriver = `
+import json, os, subprocess, sys
+prefix, wheel, pip_version, owner = sys.argv[1:5]
+env = dict(os.environ, PIP_DISABLE_PIP_VERSION_CHECK="1", PIP_NO_WARN_SCRIPT_LOCATION="1")
+def run(*args):
+    subprocess.run((sys.executable,) + args, env=env, stdout=sys.stderr, check=True)
+if pip_version:
+    # Install the requested pip off to the side, rather than upgrading the environment's pip.
+    pip_dir = os.path.join(os.path.dirname(prefix), "pip")
+    run("-m", "pip", "install", "--quiet", "--target=" + pip_dir, "pip==" + pip_version)
+    env["PYTHONPATH"] = os.pathsep.join(filter(None, [pip_dir, env.get("PYTHONPATH")]))
+    sys.path.insert(0, pip_dir)
+run("-m", "pip", "install", "--no-deps", "--ignore-installed", "--prefix=" + prefix, wheel)
+# Remove each of the .pyc files and then re-compile them with "python -m compileall", in hopes of
+# working around https://bugs.python.org/issue34093 .  Manually remove the .pyc files instead of
+# passing "--no-compile" to pip because that would result in them being missing from the RECORD.
+for dirpath, dirnames, filenames in os.walk(prefix):
+    for filename in filenames:
+        if filename.endswith(".pyc"):
+            os.remove(os.path.join(dirpath, filename))
+run("-m", "compileall", "-q", prefix)
+if owner:
+    uid, gid = (int(n) for n in owner.split(":"))
+    for dirpath, dirnames, filenames in os.walk(os.path.dirname(prefix)):
+        for name in [dirpath] + [os.path.join(dirpath, n) for n in dirnames + filenames]:
+            os.lchown(name, uid, gid)
+from pip._internal.locations import get_scheme
+scheme = get_scheme("", prefix=prefix)
+json.dump({
+    "Scheme": {slot: getattr(scheme, slot) for slot in scheme.__slots__},
+    "Shebang": sys.executable,
+}, sys.stdout)
+`
+
+type driverOutput struct {
+	Scheme  python.Scheme
+	Shebang string
+}
+
+// An Env is a Python environment to run pip in.
+type Env struct {
+	// Image is the Docker image to run pip in (such as "python:3.12-slim"), or empty to run pip
+	// on the host.
+	Image string
+	// Python is the Python interpreter to run pip with; "python3" if empty.
+	Python string
+	// Pip is the version of pip to compare against (installed to a scratch directory with the
+	// environment's existing pip), or empty to use whichever version of pip the environment
+	// already has.
+	Pip string
+}
+
+// ParseEnv parses an Env from a string of the form "host[:PYTHON]" or "IMAGE[:TAG][=PYTHON]",
+// along with a pip version (which may be empty).
+func ParseEnv(str, pip string) (Env, error) {
+	env := Env{Pip: pip} //nolint:exhaustivestruct // filled in below
+	switch {
+	case str == "":
+		return env, fmt.Errorf("pipcompat.ParseEnv: empty environment")
+	case str == "host":
+	case strings.HasPrefix(str, "host:"):
+		env.Python = strings.TrimPrefix(str, "host:")
+		if env.Python == "" {
+			return env, fmt.Errorf("pipcompat.ParseEnv: %q: empty interpreter", str)
+		}
+	default:
+		env.Image = str
+		if eq := strings.LastIndex(str, "="); eq >= 0 {
+			env.Image, env.Python = str[:eq], str[eq+1:]
+			if env.Python == "" {
+				return env, fmt.Errorf("pipcompat.ParseEnv: %q: empty interpreter", str)
+			}
+		}
+		if env.Image == "" {
+			return env, fmt.Errorf("pipcompat.ParseEnv: %q: empty image name", str)
+		}
+	}
+	return env, nil
+}
+
+// String returns a form of the Env that is suitable for ParseEnv, followed by the pip version (if
+// set).
+func (env Env) String() string {
+	var ret string
+	if env.Image == "" {
+		ret = "host"
+		if env.Python != "" {
+			ret += ":" + env.Python
+		}
+	} else {
+		ret = env.Image
+		if env.Python != "" {
+			ret += "=" + env.Python
+		}
+	}
+	if env.Pip != "" {
+		ret += " pip==" + env.Pip
+	}
+	return ret
+}
+
+func (env Env) python() string {
+	if env.Python == "" {
+		return "python3"
+	}
+	return env.Python
+}
+
+// runPip runs pipDriver in the environment, installing wheelFile in to destDir.
+func (env Env) runPip(ctx context.Context, destDir, wheelFile string) (*driverOutput, error) {
+	environ := []string{
+		"PYTHONHASHSEED=0",
+		fmt.Sprintf("SOURCE_DATE_EPOCH=%d", reproducible.Now().Unix()),
+	}
+	args := []string{"-c", pipDriver, destDir, wheelFile, env.Pip}
+
+	var cmd *dexec.Cmd
+	if env.Image == "" {
+		cmd = dexec.CommandContext(ctx, env.python(), append(args, "")...)
+		cmd.Env = append(os.Environ(), environ...)
+	} else {
+		// Mount the directories at the same paths inside of the container as on the host, so
+		// that the paths that pip writes in to the installed files (such as direct_url.json)
+		// are the same as the ones that we write.
+		dockerArgs := []string{"run", "--rm",
+			"--volume=" + filepath.Dir(destDir) + ":" + filepath.Dir(destDir),
+			"--volume=" + wheelFile + ":" + wheelFile + ":ro",
+			"--entrypoint=" + env.python(),
+		}
+		for _, kv := range environ {
+			dockerArgs = append(dockerArgs, "--env="+kv)
+		}
+		dockerArgs = append(dockerArgs, env.Image)
+		dockerArgs = append(dockerArgs, args...)
+		dockerArgs = append(dockerArgs, fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+		var err error
+		cmd, err = dockerutil.Command(ctx, dockerArgs...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	outBytes, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", env, err)
+	}
+	var out driverOutput
+	if err := json.Unmarshal(outBytes, &out); err != nil {
+		return nil, fmt.Errorf("%s: %w", env, err)
+	}
+	return &out, nil
+}
+
+// Layers installs the wheel file both with pip (in the Env) and with ocibuild, returning the
+// layers that each produced; exp is pip's and act is ocibuild's.  Scratch files are written to
+// workDir, which must be an absolute path (and, for an Env with an Image, must be a path that
+// Docker is able to mount in to the container).
+func Layers(ctx context.Context, env Env, workDir, wheelFile string) (exp, act ociv1.Layer, err error) {
+	exp, act, err = layers(ctx, env, workDir, wheelFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pipcompat.Layers: %w", err)
+	}
+	return exp, act, nil
+}
+
+func layers(ctx context.Context, env Env, workDir, wheelFile string) (exp, act ociv1.Layer, err error) {
+	usr, err := user.Current()
+	if err != nil {
+		return nil, nil, err
+	}
+	grp, err := user.LookupGroupId(fmt.Sprint(os.Getgid()))
+	if err != nil {
+		return nil, nil, err
+	}
+	ownership := dir.Ownership{
+		UID:   os.Getuid(),
+		GID:   os.Getgid(),
+		UName: usr.Username,
+		GName: grp.Name,
+	}
+
+	// 1. pip reference install
+	destDir := filepath.Join(workDir, "dst")
+	if err := os.MkdirAll(destDir, 0o777); err != nil {
+		return nil, nil, err
+	}
+	pipOut, err := env.runPip(ctx, destDir, wheelFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	layerPrefix, err := filepath.Rel("/", destDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	exp, err = dir.LayerFromDir(
+		destDir,
+		&dir.Prefix{
+			DirName:   filepath.ToSlash(layerPrefix),
+			Mode:      0, // default
+			Ownership: ownership,
+		},
+		nil, // use actual file's ownership
+		reproducible.Now(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 2. build platform data to mimic what pip did
+	var compiler python.Compiler
+	if env.Image == "" {
+		compiler, err = python.ExternalCompiler(env.python(), "-m", "compileall")
+	} else {
+		compiler, err = python.ContainerRefCompiler(env.Image, env.python(), "-m", "compileall")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	plat := python.Platform{ //nolint:exhaustivestruct // the rest are zero
+		ConsoleShebang:   pipOut.Shebang,
+		GraphicalShebang: pipOut.Shebang,
+		Scheme:           pipOut.Scheme,
+		UID:              ownership.UID,
+		GID:              ownership.GID,
+		UName:            ownership.UName,
+		GName:            ownership.GName,
+		PyCompile:        compiler,
+	}
+
+	// 3. our own install
+	act, err = bdist.InstallWheel(ctx,
+		plat,
+		reproducible.Now(), // minTime
+		reproducible.Now(), // maxTime
+		wheelFile,
+		bdist.PostInstallHooks(
+			pep376.RecordRequested(""),
+			entry_points.CreateScripts(plat),
+			recording_installs.Record(
+				"sha256",
+				"pip",
+				&direct_url.DirectURL{ //nolint:exhaustivestruct
+					URL: "file://" + filepath.ToSlash(wheelFile),
+					//nolint:exhaustivestruct
+					ArchiveInfo: &direct_url.ArchiveInfo{},
+				},
+			),
+		),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return exp, act, nil
+}
+
+// Compare installs the wheel file both with pip (in the Env) and with ocibuild, returning a diff
+// of the resulting layers (see testutil.DiffLayers), or an empty string if they are identical.
+// The workDir is as for Layers.
+func Compare(ctx context.Context, env Env, workDir, wheelFile string) (string, error) {
+	exp, act, err := Layers(ctx, env, workDir, wheelFile)
+	if err != nil {
+		return "", err
+	}
+	diff, err := testutil.DiffLayers(exp, act)
+	if err != nil {
+		return "", fmt.Errorf("pipcompat.Compare: %w", err)
+	}
+	return diff, nil
+}
+
+// A Result is the outcome of comparing one wheel file in one Env.
+type Result struct {
+	Env   Env
+	Wheel string
+	// Diff is the difference between pip's install and ocibuild's install; empty if they are
+	// identical.
+	Diff string
+	// Err is set if the comparison could not be performed at all.
+	Err error
+}
+
+// OK returns whether the comparison was performed and found no divergence.
+func (r Result) OK() bool {
+	return r.Err == nil && r.Diff == ""
+}
+
+// RunMatrix compares each of the wheel files in each of the Envs, calling report with each result
+// as it becomes available.  Scratch files are written to (and removed from) subdirectories of
+// workDir (or of os.TempDir() if workDir is empty); see Layers.
+func RunMatrix(ctx context.Context, envs []Env, workDir string, wheelFiles []string, report func(Result)) error {
+	if workDir == "" {
+		workDir = os.TempDir()
+	}
+	workDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return fmt.Errorf("pipcompat.RunMatrix: %w", err)
+	}
+	for _, env := range envs {
+		for _, wheelFile := range wheelFiles {
+			absWheel, err := filepath.Abs(wheelFile)
+			if err != nil {
+				return fmt.Errorf("pipcompat.RunMatrix: %w", err)
+			}
+			scratch, err := os.MkdirTemp(workDir, "pipcompat.")
+			if err != nil {
+				return fmt.Errorf("pipcompat.RunMatrix: %w", err)
+			}
+			diff, err := Compare(ctx, env, scratch, absWheel)
+			report(Result{
+				Env:   env,
+				Wheel: wheelFile,
+				Diff:  diff,
+				Err:   err,
+			})
+			if err := os.RemoveAll(scratch); err != nil {
+				return fmt.Errorf("pipcompat.RunMatrix: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package pipcompat_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/python/pypa/pipcompat"
+)
+
+func TestParseEnv(t *testing.T) {
+	t.Parallel()
+	//nolint:exhaustivestruct // partial
+	testcases := map[string]struct {
+		Input    string
+		Pip      string
+		Expected pipcompat.Env
+		ExpError bool
+	}{
+		"host":           {Input: "host", Expected: pipcompat.Env{}},
+		"host-python":    {Input: "host:python3.11", Expected: pipcompat.Env{Python: "python3.11"}},
+		"host-empty":     {Input: "host:", ExpError: true},
+		"image":          {Input: "python:3.12-slim", Expected: pipcompat.Env{Image: "python:3.12-slim"}},
+		"image-pip":      {Input: "python:3.12", Pip: "24.0", Expected: pipcompat.Env{Image: "python:3.12", Pip: "24.0"}},
+		"image-python":   {Input: "debian:12=/usr/bin/python3", Expected: pipcompat.Env{Image: "debian:12", Python: "/usr/bin/python3"}},
+		"image-empty-py": {Input: "debian:12=", ExpError: true},
+		"empty-image":    {Input: "=python3", ExpError: true},
+		"empty":          {Input: "", ExpError: true},
+	}
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env, err := pipcompat.ParseEnv(tc.Input, tc.Pip)
+			if tc.ExpError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Expected, env)
+			roundTrip := env.String()
+			if tc.Pip != "" {
+				assert.Equal(t, tc.Input+" pip=="+tc.Pip, roundTrip)
+			} else {
+				assert.Equal(t, tc.Input, roundTrip)
+			}
+		})
+	}
+}
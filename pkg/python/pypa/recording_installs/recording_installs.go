@@ -33,12 +33,13 @@ func recordFile(file fsutil.FileReference, hashName string, hasher hash.Hash, ba
 		return nil, err
 	}
 	name := filepath.ToSlash(fpName)
+	// .pyc files and symlinks are recorded without a hash or size.
 	var hash, size string
 	if rfile, ok := file.(bdist.Recordable); ok {
 		var _size int64
 		hash, _size = rfile.Record()
 		size = strconv.FormatInt(_size, 10)
-	} else if !strings.HasSuffix(name, ".pyc") {
+	} else if !strings.HasSuffix(name, ".pyc") && file.Mode().IsRegular() {
 		hasher.Reset()
 		reader, err := file.Open()
 		if err != nil {
@@ -56,6 +57,21 @@ func recordFile(file fsutil.FileReference, hashName string, hasher hash.Hash, ba
 	return []string{name, hash, size}, nil
 }
 
+// validateInstaller checks that the installer name is suitable for the INSTALLER file: "The
+// INSTALLER file ... should contain a single line of printable ASCII".
+func validateInstaller(installer string) error {
+	for _, r := range installer {
+		if r < 0x20 || r > 0x7e {
+			return fmt.Errorf("recording-installed-packages: INSTALLER: name must be printable ASCII: %q",
+				installer)
+		}
+	}
+	return nil
+}
+
+// Record returns a bdist.PostInstallHook that writes the INSTALLER, direct_url.json (if urlData is
+// non-nil), and RECORD files.  If installer is empty, then the (optional) INSTALLER file is not
+// written.
 func Record(hashName, installer string, urlData *direct_url.DirectURL) bdist.PostInstallHook {
 	return func(
 		ctx context.Context,
@@ -72,18 +88,23 @@ func Record(hashName, installer string, urlData *direct_url.DirectURL) bdist.Pos
 		// Trust the wheel to have METADATA.
 
 		// 4. The INSTALLER file
-		content := []byte(installer + "\n")
-		header := &tar.Header{
-			Typeflag: tar.TypeReg,
-			Name:     path.Join(installedDistInfoDir, "INSTALLER"),
-			Mode:     0o644,
-			Size:     int64(len(content)),
-			ModTime:  clampTime,
-		}
-		vfs[header.Name] = &fsutil.InMemFileReference{
-			FileInfo:  header.FileInfo(),
-			MFullName: header.Name,
-			MContent:  content,
+		if installer != "" {
+			if err := validateInstaller(installer); err != nil {
+				return err
+			}
+			content := []byte(installer + "\n")
+			header := &tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     path.Join(installedDistInfoDir, "INSTALLER"),
+				Mode:     0o644,
+				Size:     int64(len(content)),
+				ModTime:  clampTime,
+			}
+			vfs[header.Name] = &fsutil.InMemFileReference{
+				FileInfo:  header.FileInfo(),
+				MFullName: header.Name,
+				MContent:  content,
+			}
 		}
 
 		// 5. The direct_url.json file
@@ -130,7 +151,7 @@ func Record(hashName, installer string, urlData *direct_url.DirectURL) bdist.Pos
 		if err := csvWriter.Error(); err != nil {
 			return err
 		}
-		header = &tar.Header{
+		header := &tar.Header{
 			Typeflag: tar.TypeReg,
 			Name:     path.Join(installedDistInfoDir, "RECORD"),
 			Mode:     0o644,
@@ -0,0 +1,95 @@
+package simple_repo_api
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pep592"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// A Candidate is a wheel file listed by the index server for a package, along with everything that
+// the server and the filename say about it.  Unlike SelectWheel, ListCandidates doesn't apply any
+// policy; the fields here are the inputs that a caller needs to implement its own policy.
+type Candidate struct {
+	// Link is the raw link from the index page; use Link.Get to download the file.
+	Link pep503.FileLink
+
+	// The parsed wheel filename: Distribution, Version, BuildTag, and CompatibilityTag.
+	bdist.FileNameData
+
+	// URL is the URL of the file, without the hash fragment.
+	URL string
+	// Hashes maps hashlib algorithm names to hex digests, as given in the URL's fragment.
+	Hashes map[string]string
+
+	// RequiresPython is the "data-requires-python" attribute; "" if the server didn't specify
+	// one.
+	RequiresPython string
+	// PythonCompatible is whether the client's Python version satisfies RequiresPython.  It is
+	// true if the client has no Python version set, if RequiresPython is empty, or if
+	// RequiresPython can't be parsed (matching the leniency of pep503.Client.ListPackageFiles).
+	PythonCompatible bool
+
+	// Yanked is whether the file has been yanked (PEP 592), and YankedReason is the reason that
+	// the server gave, if any.
+	Yanked       bool
+	YankedReason string
+
+	// Supported is whether the client's SupportedTags support the wheel's CompatibilityTag, and
+	// Preference is how preferred that tag is (see pep425.Installer.Preference; lower is more
+	// preferred).
+	Supported  bool
+	Preference int
+}
+
+// ListCandidates returns all of the wheel files that the index server lists for a package.  Files
+// that are not wheels (sdists, or files with unparsable names) are omitted, but nothing else is
+// filtered out: incompatible, unsupported, and yanked files are all included, with the Candidate
+// fields saying why they might not be desirable.
+func (c Client) ListCandidates(ctx context.Context, pkgname string) ([]Candidate, error) {
+	python := c.Python
+	c.Python = nil // don't let ListPackageFiles filter anything out; we report it instead
+	links, err := c.ListPackageFiles(ctx, pkgname)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Candidate //nolint:prealloc // 'continue' is quite likely
+	for _, link := range links {
+		fileInfo, err := bdist.ParseFilename(link.Text)
+		if err != nil {
+			continue
+		}
+		candidate := Candidate{
+			Link:             link,
+			FileNameData:     *fileInfo,
+			URL:              link.HRef,
+			Hashes:           nil,
+			RequiresPython:   link.DataAttrs["data-requires-python"],
+			PythonCompatible: true,
+			Yanked:           pep592.IsYanked(link),
+			YankedReason:     link.DataAttrs["data-yanked"],
+			Supported:        c.SupportedTags.Supports(fileInfo.CompatibilityTag),
+			Preference:       c.SupportedTags.Preference(fileInfo.CompatibilityTag),
+		}
+		if u, err := url.Parse(link.HRef); err == nil && u.Fragment != "" {
+			if keyvals, err := url.ParseQuery(u.Fragment); err == nil {
+				candidate.Hashes = make(map[string]string, len(keyvals))
+				for key, vals := range keyvals {
+					candidate.Hashes[key] = vals[0]
+				}
+			}
+			u.Fragment = ""
+			candidate.URL = u.String()
+		}
+		if python != nil && candidate.RequiresPython != "" {
+			ok, err := pep503.HaveRequiredPython(*python, candidate.RequiresPython)
+			if err == nil && !ok {
+				candidate.PythonCompatible = false
+			}
+		}
+		ret = append(ret, candidate)
+	}
+	return ret, nil
+}
@@ -0,0 +1,71 @@
+package simple_repo_api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep425"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pypa/simple_repo_api"
+)
+
+const testIndex = `<!DOCTYPE html>
+<html>
+  <body>
+    <a href="/files/example-1.0.tar.gz#sha256=aaaa">example-1.0.tar.gz</a>
+    <a href="/files/example-1.0-py3-none-any.whl#sha256=bbbb">example-1.0-py3-none-any.whl</a>
+    <a href="/files/example-2.0-py3-none-any.whl#sha256=cccc" data-yanked="broken metadata"
+       >example-2.0-py3-none-any.whl</a>
+    <a href="/files/example-3.0-cp311-cp311-win_amd64.whl" data-requires-python="&gt;=3.11"
+       >example-3.0-cp311-cp311-win_amd64.whl</a>
+  </body>
+</html>
+`
+
+func TestListCandidates(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/simple/example" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testIndex))
+	}))
+	t.Cleanup(srv.Close)
+
+	python, err := pep440.ParseVersion("3.9.7")
+	require.NoError(t, err)
+	client := simple_repo_api.NewClient(python, pep425.Installer{
+		{Python: "py3", ABI: "none", Platform: "any"},
+	})
+	client.BaseURL = srv.URL + "/simple/"
+	client.HTTPClient = srv.Client()
+
+	candidates, err := client.ListCandidates(context.Background(), "Example")
+	require.NoError(t, err)
+	require.Len(t, candidates, 3)
+
+	assert.Equal(t, "1.0", candidates[0].Version.String())
+	assert.Equal(t, srv.URL+"/files/example-1.0-py3-none-any.whl", candidates[0].URL)
+	assert.Equal(t, map[string]string{"sha256": "bbbb"}, candidates[0].Hashes)
+	assert.True(t, candidates[0].Supported)
+	assert.Equal(t, 1, candidates[0].Preference)
+	assert.True(t, candidates[0].PythonCompatible)
+	assert.False(t, candidates[0].Yanked)
+
+	assert.Equal(t, "2.0", candidates[1].Version.String())
+	assert.True(t, candidates[1].Yanked)
+	assert.Equal(t, "broken metadata", candidates[1].YankedReason)
+
+	assert.Equal(t, "3.0", candidates[2].Version.String())
+	assert.Nil(t, candidates[2].Hashes)
+	assert.Equal(t, ">=3.11", candidates[2].RequiresPython)
+	assert.False(t, candidates[2].PythonCompatible)
+	assert.False(t, candidates[2].Supported)
+	assert.Equal(t, 2, candidates[2].Preference)
+}
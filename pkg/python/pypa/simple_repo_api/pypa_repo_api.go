@@ -5,8 +5,10 @@ package simple_repo_api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/datawire/ocibuild/pkg/python/pep425"
 	"github.com/datawire/ocibuild/pkg/python/pep440"
@@ -21,9 +23,79 @@ import (
 // deletion) as defined in PEP 592 and specifying the interface version provided by an index server
 // in PEP 629.
 
+// ErrNoMatch is returned (wrapped) if the index server has no wheel that satisfies the version
+// specifier and the supported tags; SelectWheel returns it as a *NoMatchError.
+var ErrNoMatch = errors.New("no matching wheel")
+
+// A NoMatchError is returned by SelectWheel and SelectWheelOrSdist if the index server has no
+// suitable file.  It lists what the server did have for matching versions, so that the user can
+// tell whether the problem is the version specifier or the platform.  It matches ErrNoMatch with
+// errors.Is.
+type NoMatchError struct {
+	Project   string
+	Specifier pep440.Specifier
+	// Available is the list of filenames on the index server that are for versions matching
+	// Specifier (but are for other platforms, are sdists, or the like).
+	Available []string
+	// OtherVersions is the number of files on the index server for non-matching versions.
+	OtherVersions int
+}
+
+func newNoMatchError(pkgname string, version pep440.Specifier, links []pep503.FileLink) *NoMatchError {
+	ret := &NoMatchError{ //nolint:exhaustivestruct // filled in below
+		Project:   pkgname,
+		Specifier: version,
+	}
+	for _, link := range links {
+		if ver := linkVersion(pkgname, link); ver != nil && version.Match(*ver) {
+			ret.Available = append(ret.Available, link.Text)
+		} else {
+			ret.OtherVersions++
+		}
+	}
+	sort.Strings(ret.Available)
+	return ret
+}
+
+func (e *NoMatchError) Error() string {
+	msg := fmt.Sprintf("%v for %q %q", ErrNoMatch, e.Project, e.Specifier.String())
+	switch {
+	case len(e.Available) > 0:
+		msg += fmt.Sprintf("; the index server has only: %s", strings.Join(e.Available, ", "))
+	case e.OtherVersions > 0:
+		msg += fmt.Sprintf("; the index server has %d files, but none for a matching version",
+			e.OtherVersions)
+	default:
+		msg += "; the index server has no files for it"
+	}
+	return msg
+}
+
+func (e *NoMatchError) Is(target error) bool {
+	return target == ErrNoMatch //nolint:errorlint // this IS the errors.Is implementation
+}
+
+// linkVersion returns the version of a wheel or sdist of the project pkgname, or nil if the link
+// is neither.
+func linkVersion(pkgname string, link pep503.FileLink) *pep440.Version {
+	if info, err := bdist.ParseFilename(link.Text); err == nil {
+		return &info.Version
+	}
+	if sdist, err := ParseSdistFilename(pkgname, link.Text); err == nil {
+		return &sdist.Version
+	}
+	return nil
+}
+
 type Client struct {
 	pep503.Client
 	SupportedTags pep425.Installer
+
+	// PreReleases is the policy for selecting pre-release versions; and PreReleasePackages is a
+	// list of projects that pre-releases are allowed for regardless of PreReleases (so that
+	// specific projects can be opted in to release candidates).
+	PreReleases        pep440.PreReleasePolicy
+	PreReleasePackages []string
 }
 
 func NewClient(python *pep440.Version, supportedTags pep425.Installer) Client {
@@ -35,17 +107,51 @@ func NewClient(python *pep440.Version, supportedTags pep425.Installer) Client {
 			BaseURL:    "",  // default, let user override after initialization
 			HTTPClient: nil, // default, let user override after initialization
 			UserAgent:  "",  // default, let user override after initialization
+
+			Credentials: nil, // let user set after initialization
+
+			Connections: 0,  // default, let user override after initialization
+			SegmentSize: 0,  // default, let user override after initialization
+			Retries:     0,  // default, let user override after initialization
+			PartialDir:  "", // default, let user override after initialization
 		},
 		SupportedTags: supportedTags,
+
+		PreReleases:        pep440.PreReleasesIfNecessary, // default, let user override after initialization
+		PreReleasePackages: nil,                           // let user set after initialization
 	}
 }
 
+// PreReleasePolicy returns the policy for selecting pre-releases of the project pkgname:
+// PreReleasesAllow if it is listed in PreReleasePackages, and PreReleases otherwise.
+func (c Client) PreReleasePolicy(pkgname string) pep440.PreReleasePolicy {
+	for _, allowed := range c.PreReleasePackages {
+		if pep503.NormalizeName(allowed) == pep503.NormalizeName(pkgname) {
+			return pep440.PreReleasesAllow
+		}
+	}
+	return c.PreReleases
+}
+
+// SelectWheel returns the best wheel that the index server has for the project pkgname that
+// satisfies the version specifier and is supported by the client's SupportedTags.  If there is
+// no such wheel, then the error is a *NoMatchError; see SelectWheelOrSdist to fall back to a
+// source distribution.
 func (c Client) SelectWheel(ctx context.Context, pkgname string, version pep440.Specifier) (*pep503.FileLink, error) {
 	// 0. Filter by pkgname
 	links, err := c.ListPackageFiles(ctx, pkgname)
 	if err != nil {
 		return nil, err
 	}
+	if wheel := c.selectWheel(pkgname, links, version); wheel != nil {
+		return wheel, nil
+	}
+	return nil, newNoMatchError(pkgname, version, links)
+}
+
+// selectWheel is the body of SelectWheel after listing the files; it returns nil if there is no
+// suitable wheel.
+func (c Client) selectWheel(pkgname string, links []pep503.FileLink, version pep440.Specifier) *pep503.FileLink {
 	// 1. Filter by version
 	version2links := make(map[string][]pep503.FileLink)
 	var whlLinks []pep503.FileLink //nolint:prealloc // 'continue' is quite likely
@@ -62,19 +168,14 @@ func (c Client) SelectWheel(ctx context.Context, pkgname string, version pep440.
 		whlLinks = append(whlLinks, link)
 		versions = append(versions, linkInfo.Version)
 	}
-	selectedVersion := version.Select(versions, pep440.MultiExcluder{
-		pep440.ExcludePreReleases{
-			AllowList: nil, // TODO
-		},
-		pep592.ExcludeYanked(whlLinks),
-	})
+	selectedVersion := c.PreReleasePolicy(pkgname).Select(version, versions, pep592.ExcludeYanked(whlLinks))
 	if selectedVersion == nil {
-		return nil, fmt.Errorf("no matches for %q %q", pkgname, version.String())
+		return nil
 	}
 	links = version2links[selectedVersion.String()]
 	if len(links) == 1 {
 		ret := links[0]
-		return &ret, nil
+		return &ret
 	}
 	// 2. Filter by perferred compatibility tag
 	var minRank int
@@ -93,7 +194,7 @@ func (c Client) SelectWheel(ctx context.Context, pkgname string, version pep440.
 	links = minList
 	if len(links) == 1 {
 		ret := links[0]
-		return &ret, nil
+		return &ret
 	}
 	// 3. Finally, tie-break by build tag.
 	sort.Slice(links, func(i, j int) bool {
@@ -102,5 +203,5 @@ func (c Client) SelectWheel(ctx context.Context, pkgname string, version pep440.
 		return iInfo.BuildTag.Cmp(jInfo.BuildTag) < 0
 	})
 	ret := links[0]
-	return &ret, nil
+	return &ret
 }
@@ -0,0 +1,72 @@
+package simple_repo_api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep425"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pypa/simple_repo_api"
+)
+
+const testPreReleaseIndex = `<!DOCTYPE html>
+<html>
+  <body>
+    <a href="/files/example-1.0-py3-none-any.whl">example-1.0-py3-none-any.whl</a>
+    <a href="/files/example-1.1-py3-none-any.whl" data-yanked="">example-1.1-py3-none-any.whl</a>
+    <a href="/files/example-2.0rc1-py3-none-any.whl">example-2.0rc1-py3-none-any.whl</a>
+  </body>
+</html>
+`
+
+func TestSelectWheelPreReleases(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testPreReleaseIndex))
+	}))
+	t.Cleanup(srv.Close)
+
+	type TestCase struct {
+		Policy   pep440.PreReleasePolicy
+		Packages []string
+		Spec     string
+		Expected string // "" for an error
+	}
+	testcases := map[string]TestCase{
+		"if-necessary":         {pep440.PreReleasesIfNecessary, nil, ">=1.0", "example-1.0-py3-none-any.whl"},
+		"if-necessary/only":    {pep440.PreReleasesIfNecessary, nil, ">=1.5", "example-2.0rc1-py3-none-any.whl"},
+		"if-necessary/yanked":  {pep440.PreReleasesIfNecessary, nil, "==1.1", "example-1.1-py3-none-any.whl"},
+		"allow":                {pep440.PreReleasesAllow, nil, ">=1.0", "example-2.0rc1-py3-none-any.whl"},
+		"forbid":               {pep440.PreReleasesForbid, nil, ">=1.5", ""},
+		"forbid/package":       {pep440.PreReleasesForbid, []string{"Example"}, ">=1.5", "example-2.0rc1-py3-none-any.whl"},
+		"forbid/other-package": {pep440.PreReleasesForbid, []string{"other"}, ">=1.5", ""},
+	}
+	for name, tc := range testcases {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := simple_repo_api.NewClient(nil, pep425.Installer{
+				{Python: "py3", ABI: "none", Platform: "any"},
+			})
+			client.BaseURL = srv.URL + "/simple/"
+			client.HTTPClient = srv.Client()
+			client.PreReleases = tc.Policy
+			client.PreReleasePackages = tc.Packages
+
+			spec, err := pep440.ParseSpecifier(tc.Spec)
+			require.NoError(t, err)
+			link, err := client.SelectWheel(context.Background(), "example", spec)
+			if tc.Expected == "" {
+				assert.ErrorIs(t, err, simple_repo_api.ErrNoMatch)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.Expected, link.Text)
+		})
+	}
+}
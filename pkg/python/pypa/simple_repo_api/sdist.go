@@ -0,0 +1,130 @@
+package simple_repo_api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pep592"
+)
+
+// sdistExts is the list of file extensions that source distributions are published with; the
+// modern standard is just ".tar.gz", but older projects have all of these on PyPI.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var sdistExts = []string{
+	".tar.gz", ".tgz",
+	".tar.bz2", ".tbz",
+	".tar.xz", ".txz",
+	".tar.lz", ".tlz", ".tar.lzma",
+	".tar",
+	".zip",
+}
+
+// An SdistLink is a source distribution (an "sdist") listed by the index server.  ocibuild can't
+// install an sdist itself; it must first be built in to a wheel.
+type SdistLink struct {
+	pep503.FileLink
+
+	// Distribution and Version are parsed from the filename.
+	Distribution string
+	Version      pep440.Version
+}
+
+// ParseSdistFilename parses the filename of a source distribution of the project pkgname, such as
+// "example-1.0.tar.gz".  The pkgname is required because legacy sdist filenames don't escape "-"
+// in the project name, and so can't be split unambiguously on their own.
+func ParseSdistFilename(pkgname, filename string) (*SdistLink, error) {
+	base := ""
+	for _, ext := range sdistExts {
+		if strings.HasSuffix(filename, ext) {
+			base = strings.TrimSuffix(filename, ext)
+			break
+		}
+	}
+	if base == "" {
+		return nil, fmt.Errorf("simple_repo_api.ParseSdistFilename: %q: not an sdist filename", filename)
+	}
+	want := pep503.NormalizeName(pkgname)
+	for i := strings.IndexByte(base, '-'); i >= 0; i = nextIndexByte(base, '-', i) {
+		if pep503.NormalizeName(base[:i]) != want {
+			continue
+		}
+		ver, err := pep440.ParseVersion(base[i+1:])
+		if err != nil {
+			continue
+		}
+		return &SdistLink{ //nolint:exhaustivestruct // FileLink is filled in by the caller
+			Distribution: base[:i],
+			Version:      *ver,
+		}, nil
+	}
+	return nil, fmt.Errorf("simple_repo_api.ParseSdistFilename: %q: not an sdist of %q", filename, pkgname)
+}
+
+func nextIndexByte(str string, c byte, prev int) int {
+	i := strings.IndexByte(str[prev+1:], c)
+	if i < 0 {
+		return -1
+	}
+	return prev + 1 + i
+}
+
+// selectSdist is the sdist counterpart of SelectWheel's version selection: it returns the sdist
+// of the best version that matches the specifier, preferring versions that aren't yanked.  It
+// returns nil if there is no matching sdist.
+func (c Client) selectSdist(pkgname string, links []pep503.FileLink, version pep440.Specifier) *SdistLink {
+	var sdists []SdistLink
+	for _, link := range links {
+		sdist, err := ParseSdistFilename(pkgname, link.Text)
+		if err != nil {
+			continue
+		}
+		sdist.FileLink = link
+		sdists = append(sdists, *sdist)
+	}
+	for _, allowYanked := range []bool{false, true} {
+		var versions []pep440.Version
+		for _, sdist := range sdists {
+			if allowYanked || !pep592.IsYanked(sdist.FileLink) {
+				versions = append(versions, sdist.Version)
+			}
+		}
+		selected := c.PreReleasePolicy(pkgname).Select(version, versions, nil)
+		if selected == nil {
+			continue
+		}
+		for _, sdist := range sdists {
+			if sdist.Version.Cmp(*selected) == 0 && (allowYanked || !pep592.IsYanked(sdist.FileLink)) {
+				ret := sdist
+				return &ret
+			}
+		}
+	}
+	return nil
+}
+
+// SelectWheelOrSdist is like SelectWheel, but if the index server has no suitable wheel, then it
+// falls back to selecting a source distribution; so that the caller can build a wheel from it, or
+// at least tell the user what to do.  Exactly one of the returned wheel and sdist is non-nil
+// unless there is an error.  If there is neither a suitable wheel nor a matching sdist, then the
+// error is a *NoMatchError.
+func (c Client) SelectWheelOrSdist(
+	ctx context.Context,
+	pkgname string,
+	version pep440.Specifier,
+) (*pep503.FileLink, *SdistLink, error) {
+	links, err := c.ListPackageFiles(ctx, pkgname)
+	if err != nil {
+		return nil, nil, err
+	}
+	if wheel := c.selectWheel(pkgname, links, version); wheel != nil {
+		return wheel, nil, nil
+	}
+	if sdist := c.selectSdist(pkgname, links, version); sdist != nil {
+		return nil, sdist, nil
+	}
+	return nil, nil, newNoMatchError(pkgname, version, links)
+}
@@ -0,0 +1,138 @@
+package simple_repo_api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep425"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/pypa/simple_repo_api"
+)
+
+func TestParseSdistFilename(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		InputName  string
+		InputFile  string
+		OutputDist string
+		OutputVer  string
+		OutputErr  string
+	}
+	testcases := []TestCase{
+		{"example", "example-1.0.tar.gz", "example", "1.0", ""},
+		{"Example", "example-1.0.zip", "example", "1.0", ""},
+		{"zope.interface", "zope.interface-5.4.0.tar.gz", "zope.interface", "5.4.0", ""},
+		{"python-dateutil", "python-dateutil-2.8.2.tar.gz", "python-dateutil", "2.8.2", ""},
+		{"python-dateutil", "python_dateutil-2.8.2.tar.gz", "python_dateutil", "2.8.2", ""},
+		{"example", "example-2.0rc1.tar.bz2", "example", "2.0rc1", ""},
+		{"example", "example-1.0-py3-none-any.whl", "", "",
+			`simple_repo_api.ParseSdistFilename: "example-1.0-py3-none-any.whl": not an sdist filename`},
+		{"example", "other-1.0.tar.gz", "", "",
+			`simple_repo_api.ParseSdistFilename: "other-1.0.tar.gz": not an sdist of "example"`},
+		{"example", "example-latest.tar.gz", "", "",
+			`simple_repo_api.ParseSdistFilename: "example-latest.tar.gz": not an sdist of "example"`},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.InputFile, func(t *testing.T) {
+			t.Parallel()
+			sdist, err := simple_repo_api.ParseSdistFilename(tc.InputName, tc.InputFile)
+			if tc.OutputErr != "" {
+				assert.EqualError(t, err, tc.OutputErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.OutputDist, sdist.Distribution)
+			assert.Equal(t, tc.OutputVer, sdist.Version.String())
+		})
+	}
+}
+
+const testSdistIndex = `<!DOCTYPE html>
+<html>
+  <body>
+    <a href="/files/example-1.0.tar.gz#sha256=aaaa">example-1.0.tar.gz</a>
+    <a href="/files/example-1.0-py3-none-any.whl#sha256=bbbb">example-1.0-py3-none-any.whl</a>
+    <a href="/files/example-2.0.tar.gz#sha256=cccc">example-2.0.tar.gz</a>
+    <a href="/files/example-2.0-cp39-cp39-win_amd64.whl">example-2.0-cp39-cp39-win_amd64.whl</a>
+    <a href="/files/example-2.1.tar.gz" data-yanked="">example-2.1.tar.gz</a>
+  </body>
+</html>
+`
+
+func TestSelectWheelOrSdist(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/simple/example" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testSdistIndex))
+	}))
+	t.Cleanup(srv.Close)
+
+	python, err := pep440.ParseVersion("3.9.7")
+	require.NoError(t, err)
+	client := simple_repo_api.NewClient(python, pep425.Installer{
+		{Python: "py3", ABI: "none", Platform: "any"},
+	})
+	client.BaseURL = srv.URL + "/simple/"
+	client.HTTPClient = srv.Client()
+
+	parseSpec := func(t *testing.T, str string) pep440.Specifier {
+		t.Helper()
+		spec, err := pep440.ParseSpecifier(str)
+		require.NoError(t, err)
+		return spec
+	}
+
+	t.Run("wheel", func(t *testing.T) {
+		t.Parallel()
+		wheel, sdist, err := client.SelectWheelOrSdist(context.Background(), "example", parseSpec(t, "<2"))
+		require.NoError(t, err)
+		assert.Nil(t, sdist)
+		require.NotNil(t, wheel)
+		assert.Equal(t, "example-1.0-py3-none-any.whl", wheel.Text)
+	})
+	t.Run("sdist", func(t *testing.T) {
+		t.Parallel()
+		wheel, sdist, err := client.SelectWheelOrSdist(context.Background(), "example", parseSpec(t, "==2.*"))
+		require.NoError(t, err)
+		assert.Nil(t, wheel)
+		require.NotNil(t, sdist)
+		assert.Equal(t, "example-2.0.tar.gz", sdist.Text)
+		assert.Equal(t, "2.0", sdist.Version.String())
+	})
+	t.Run("yanked-sdist", func(t *testing.T) {
+		t.Parallel()
+		wheel, sdist, err := client.SelectWheelOrSdist(context.Background(), "example", parseSpec(t, "==2.1"))
+		require.NoError(t, err)
+		assert.Nil(t, wheel)
+		require.NotNil(t, sdist)
+		assert.Equal(t, "example-2.1.tar.gz", sdist.Text)
+	})
+	t.Run("SelectWheel", func(t *testing.T) {
+		t.Parallel()
+		_, err := client.SelectWheel(context.Background(), "example", parseSpec(t, "==2.0"))
+		assert.ErrorIs(t, err, simple_repo_api.ErrNoMatch)
+		var noMatch *simple_repo_api.NoMatchError
+		require.True(t, errors.As(err, &noMatch))
+		assert.Equal(t, []string{"example-2.0-cp39-cp39-win_amd64.whl", "example-2.0.tar.gz"}, noMatch.Available)
+		assert.Equal(t, 3, noMatch.OtherVersions)
+		assert.EqualError(t, err, `no matching wheel for "example" "==2.0"; the index server has only: `+
+			`example-2.0-cp39-cp39-win_amd64.whl, example-2.0.tar.gz`)
+	})
+	t.Run("none", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := client.SelectWheelOrSdist(context.Background(), "example", parseSpec(t, ">=3"))
+		assert.ErrorIs(t, err, simple_repo_api.ErrNoMatch)
+		assert.EqualError(t, err, `no matching wheel for "example" ">=3"; `+
+			`the index server has 5 files, but none for a matching version`)
+	})
+}
@@ -0,0 +1,88 @@
+package requirements
+
+import (
+	"fmt"
+
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+)
+
+// Constrain applies constraints (the requirements from a constraints file; see pip's "-c"
+// option) to reqs, returning the constrained requirements.  A constraint doesn't add a project; it
+// only bounds the versions of a project that is already required.  So, constraints for projects
+// that aren't in reqs are ignored, and each requirement's specifier is intersected with those of
+// the constraints for the same project (so `flask>=2.0` constrained by `flask==2.2.2` becomes
+// `flask==2.2.2`, which is pinned).
+//
+// If a constraint has --hash options, then the requirement may only match files with those
+// hashes too.  It is an error for the constraints to be unsatisfiable along with the requirement
+// (in which case the error wraps a *pep440.UnsatisfiableError); and it is an error for a
+// constraint to have extras, an environment marker, or a URL, since pip doesn't permit those in
+// constraints files either.
+func Constrain(reqs []Requirement, constraints []Requirement) ([]Requirement, error) {
+	byName := make(map[string][]Requirement)
+	for _, constraint := range constraints {
+		switch {
+		case len(constraint.Extras) > 0:
+			return nil, fmt.Errorf("requirements.Constrain: line %d: %s: constraints may not have extras",
+				constraint.Line, constraint.Name)
+		case constraint.Marker != nil:
+			return nil, fmt.Errorf("requirements.Constrain: line %d: %s: "+
+				"environment markers are not supported in constraints", constraint.Line, constraint.Name)
+		case constraint.URL != "":
+			return nil, fmt.Errorf("requirements.Constrain: line %d: %s: constraints may not have a URL",
+				constraint.Line, constraint.Name)
+		}
+		name := pep503.NormalizeName(constraint.Name)
+		byName[name] = append(byName[name], constraint)
+	}
+
+	ret := make([]Requirement, 0, len(reqs))
+	for _, req := range reqs {
+		for _, constraint := range byName[pep503.NormalizeName(req.Name)] {
+			if req.URL != "" {
+				return nil, fmt.Errorf("requirements.Constrain: %s (line %d): "+
+					"a requirement with a URL can't be constrained (constraint on line %d)",
+					req.Name, req.Line, constraint.Line)
+			}
+			spec, err := req.Specifier.Intersect(constraint.Specifier)
+			if err != nil {
+				return nil, fmt.Errorf("requirements.Constrain: %s (line %d): conflicts with the "+
+					"constraint on line %d: %w", req.Name, req.Line, constraint.Line, err)
+			}
+			hashes, err := intersectHashes(req.Hashes, constraint.Hashes)
+			if err != nil {
+				return nil, fmt.Errorf("requirements.Constrain: %s (line %d): conflicts with the "+
+					"constraint on line %d: %w", req.Name, req.Line, constraint.Line, err)
+			}
+			req.Specifier = spec
+			req.Hashes = hashes
+		}
+		ret = append(ret, req)
+	}
+	return ret, nil
+}
+
+// intersectHashes returns the hashes that a file must have to satisfy both a and b; nil meaning
+// that any file is acceptable.
+func intersectHashes(a, b map[string][]string) (map[string][]string, error) {
+	switch {
+	case len(a) == 0:
+		return b, nil
+	case len(b) == 0:
+		return a, nil
+	}
+	ret := make(map[string][]string)
+	for alg, aDigests := range a {
+		for _, digest := range aDigests {
+			for _, bDigest := range b[alg] {
+				if digest == bDigest {
+					ret[alg] = append(ret[alg], digest)
+				}
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("the --hash options have no digest in common")
+	}
+	return ret, nil
+}
@@ -0,0 +1,91 @@
+package requirements_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+	"github.com/datawire/ocibuild/pkg/python/requirements"
+)
+
+func mustParse(t *testing.T, str string) []requirements.Requirement {
+	t.Helper()
+	file, err := requirements.Parse(strings.NewReader(str))
+	require.NoError(t, err)
+	return file.Requirements
+}
+
+func TestConstrain(t *testing.T) {
+	t.Parallel()
+	reqs := mustParse(t, ""+
+		"Flask>=2.0\n"+
+		"click\n"+
+		"colorama==0.4.6 --hash=sha256:aaaa --hash=sha256:bbbb\n"+
+		"unconstrained==1.0\n")
+	constraints := mustParse(t, ""+
+		"flask==2.2.2\n"+
+		"click<9,>=8.0\n"+
+		"click!=8.1.0\n"+
+		"colorama --hash=sha256:bbbb --hash=sha256:cccc\n"+
+		"not-required==3.0\n")
+
+	constrained, err := requirements.Constrain(reqs, constraints)
+	require.NoError(t, err)
+	require.Len(t, constrained, 4, "constraints must not add requirements")
+
+	assert.Equal(t, "Flask", constrained[0].Name)
+	assert.Equal(t, "==2.2.2", constrained[0].Specifier.String())
+	ver, ok := constrained[0].Pinned()
+	require.True(t, ok)
+	assert.Equal(t, "2.2.2", ver.String())
+	assert.Equal(t, 1, constrained[0].Line)
+
+	assert.Equal(t, ">=8.0,<9,!=8.1.0", constrained[1].Specifier.String())
+
+	assert.Equal(t, "==0.4.6", constrained[2].Specifier.String())
+	assert.Equal(t, map[string][]string{"sha256": {"bbbb"}}, constrained[2].Hashes)
+
+	assert.Equal(t, "==1.0", constrained[3].Specifier.String())
+
+	// The input must not have been modified.
+	assert.Equal(t, ">=2.0", reqs[0].Specifier.String())
+}
+
+func TestConstrainErrors(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Reqs        string
+		Constraints string
+		Err         string
+	}
+	testcases := map[string]TestCase{
+		"unsatisfiable": {"flask>=2.0\n", "flask<2\n",
+			`requirements.Constrain: flask (line 1): conflicts with the constraint on line 1: ` +
+				`pep440.Specifier.Intersect: unsatisfiable specifier: clauses ">=2.0" and "<2" are mutually exclusive`},
+		"hashes": {"click==8.1.3 --hash=sha256:aaaa\n", "click --hash=sha256:bbbb\n",
+			`requirements.Constrain: click (line 1): conflicts with the constraint on line 1: ` +
+				`the --hash options have no digest in common`},
+		"extras": {"flask\n", "flask[async]==2.2.2\n",
+			`requirements.Constrain: line 1: flask: constraints may not have extras`},
+		"marker": {"flask\n", "flask==2.2.2 ; python_version < \"3.8\"\n",
+			`requirements.Constrain: line 1: flask: environment markers are not supported in constraints`},
+		"url": {"flask\n", "flask @ https://example.com/flask-2.2.2-py3-none-any.whl\n",
+			`requirements.Constrain: line 1: flask: constraints may not have a URL`},
+	}
+	for name, tc := range testcases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := requirements.Constrain(mustParse(t, tc.Reqs), mustParse(t, tc.Constraints))
+			assert.EqualError(t, err, tc.Err)
+		})
+	}
+
+	_, err := requirements.Constrain(mustParse(t, "flask>=2.0\n"), mustParse(t, "flask<2\n"))
+	var unsatisfiable *pep440.UnsatisfiableError
+	assert.True(t, errors.As(err, &unsatisfiable))
+}
@@ -0,0 +1,198 @@
+// Package requirements parses pip's "requirements file" format, as written by `pip freeze` and
+// `pip-compile`.
+//
+// https://pip.pypa.io/en/stable/reference/requirements-file-format/
+//
+// Only the subset of the format that appears in lock files is supported: one PEP 508 requirement
+// per line, each optionally followed by "--hash" options; and the "--index-url",
+// "--extra-index-url", "--find-links", and "--constraint" global options.  Other options (such as
+// "-r" to include another file, or "-e" for editable installs) are rejected.
+//
+// A constraints file has the same format; see Constrain.
+package requirements
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/datawire/ocibuild/pkg/python/pep345"
+	"github.com/datawire/ocibuild/pkg/python/pep440"
+)
+
+// A File is a parsed requirements file.
+type File struct {
+	IndexURL       string
+	ExtraIndexURLs []string
+	FindLinks      []string
+	// Constraints is the list of constraints files named by "-c" options, as written (that is,
+	// relative to the directory of the requirements file).
+	Constraints []string
+
+	Requirements []Requirement
+}
+
+// A Requirement is a single requirement line from a requirements file.
+type Requirement struct {
+	pep345.Requirement
+
+	// Hashes maps hashlib algorithm names to the hex digests that are acceptable for the
+	// requirement; for example {"sha256": ["0123...", "4567..."]}.
+	Hashes map[string][]string
+
+	// Line is the line number that the requirement starts on, for error messages.
+	Line int
+}
+
+// Pinned returns the exact version that the requirement pins, if it is pinned with a single
+// "==" clause (as is the case for lock files).
+func (req Requirement) Pinned() (*pep440.Version, bool) {
+	if len(req.Specifier) != 1 || req.Specifier[0].CmpOp != pep440.CmpOpStrictMatch {
+		return nil, false
+	}
+	ver := req.Specifier[0].Version
+	return &ver, true
+}
+
+// reComment matches a comment; a "#" at the beginning of a line or preceded by whitespace.
+var reComment = regexp.MustCompile(`(^|\s+)#.*$`)
+
+// reOptionStart matches the start of the per-requirement options on a requirement line.
+var reOptionStart = regexp.MustCompile(`\s+-`)
+
+// logicalLines splits the file in to logical lines (joining lines ending with "\"), with comments
+// stripped.  Each line is returned along with its starting (physical) line number.
+func logicalLines(r io.Reader) ([]string, []int, error) {
+	var (
+		lines    []string
+		linenos  []int
+		buf      strings.Builder
+		startNum int
+	)
+	scanner := bufio.NewScanner(r)
+	for num := 1; scanner.Scan(); num++ {
+		line := reComment.ReplaceAllString(scanner.Text(), "")
+		if buf.Len() == 0 {
+			startNum = num
+		}
+		if strings.HasSuffix(line, `\`) {
+			buf.WriteString(strings.TrimSuffix(line, `\`))
+			buf.WriteString(" ")
+			continue
+		}
+		buf.WriteString(line)
+		if str := strings.TrimSpace(buf.String()); str != "" {
+			lines = append(lines, str)
+			linenos = append(linenos, startNum)
+		}
+		buf.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if str := strings.TrimSpace(buf.String()); str != "" {
+		lines = append(lines, str)
+		linenos = append(linenos, startNum)
+	}
+	return lines, linenos, nil
+}
+
+// splitOption splits an "--opt=val" or "--opt val" word (with the following words) in to the
+// option name and value, returning the number of words consumed.
+func splitOption(words []string) (name, val string, n int, err error) {
+	if idx := strings.Index(words[0], "="); idx >= 0 {
+		return words[0][:idx], words[0][idx+1:], 1, nil
+	}
+	if len(words) < 2 {
+		return words[0], "", 1, fmt.Errorf("option %q requires an argument", words[0])
+	}
+	return words[0], words[1], 2, nil
+}
+
+// Parse parses a requirements file.
+func Parse(r io.Reader) (*File, error) {
+	lines, linenos, err := logicalLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("requirements.Parse: %w", err)
+	}
+	var ret File
+	for i, line := range lines {
+		if err := ret.parseLine(line, linenos[i]); err != nil {
+			return nil, fmt.Errorf("requirements.Parse: line %d: %w", linenos[i], err)
+		}
+	}
+	return &ret, nil
+}
+
+func (f *File) parseLine(line string, lineno int) error {
+	if strings.HasPrefix(line, "-") {
+		words := strings.Fields(line)
+		name, val, n, err := splitOption(words)
+		if err != nil {
+			return err
+		}
+		if n != len(words) {
+			return fmt.Errorf("unexpected text after option %q: %q", name, strings.Join(words[n:], " "))
+		}
+		switch name {
+		case "-i", "--index-url":
+			f.IndexURL = val
+		case "--extra-index-url":
+			f.ExtraIndexURLs = append(f.ExtraIndexURLs, val)
+		case "-f", "--find-links":
+			f.FindLinks = append(f.FindLinks, val)
+		case "-c", "--constraint":
+			f.Constraints = append(f.Constraints, val)
+		default:
+			return fmt.Errorf("unsupported option %q", name)
+		}
+		return nil
+	}
+
+	// Per-requirement options start with whitespace followed by "-"; everything before that is
+	// the PEP 508 requirement (which may itself contain spaces).
+	reqStr, optStr := line, ""
+	if loc := reOptionStart.FindStringIndex(line); loc != nil {
+		reqStr, optStr = line[:loc[0]], line[loc[0]:]
+	}
+	req, err := pep345.ParseRequirement(reqStr)
+	if err != nil {
+		return err
+	}
+	ret := Requirement{
+		Requirement: *req,
+		Hashes:      nil,
+		Line:        lineno,
+	}
+	words := strings.Fields(optStr)
+	for len(words) > 0 {
+		name, val, n, err := splitOption(words)
+		if err != nil {
+			return err
+		}
+		words = words[n:]
+		if name != "--hash" {
+			return fmt.Errorf("unsupported per-requirement option %q", name)
+		}
+		alg, digest, ok := cut(val, ":")
+		if !ok || alg == "" || digest == "" {
+			return fmt.Errorf("invalid --hash value %q: must be 'ALGORITHM:HEXDIGEST'", val)
+		}
+		if ret.Hashes == nil {
+			ret.Hashes = make(map[string][]string)
+		}
+		ret.Hashes[alg] = append(ret.Hashes[alg], strings.ToLower(digest))
+	}
+	f.Requirements = append(f.Requirements, ret)
+	return nil
+}
+
+// cut is strings.Cut, which isn't available until Go 1.18.
+func cut(str, sep string) (before, after string, found bool) {
+	if i := strings.Index(str, sep); i >= 0 {
+		return str[:i], str[i+len(sep):], true
+	}
+	return str, "", false
+}
@@ -0,0 +1,82 @@
+package requirements_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/requirements"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	file, err := requirements.Parse(strings.NewReader(`#
+# This file is autogenerated by pip-compile
+#
+--index-url https://example.com/simple/
+--extra-index-url=https://mirror.example.com/simple/
+-c constraints.txt
+
+click==8.1.3 \
+    --hash=sha256:AAAA \
+    --hash=sha256:bbbb
+    # via flask
+colorama==0.4.6 ; platform_system == "Windows" --hash=sha256:cccc
+flask==2.2.2  # a comment
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/simple/", file.IndexURL)
+	assert.Equal(t, []string{"https://mirror.example.com/simple/"}, file.ExtraIndexURLs)
+	assert.Equal(t, []string{"constraints.txt"}, file.Constraints)
+	require.Len(t, file.Requirements, 3)
+
+	click := file.Requirements[0]
+	assert.Equal(t, "click", click.Name)
+	assert.Equal(t, 8, click.Line)
+	assert.Equal(t, map[string][]string{"sha256": {"aaaa", "bbbb"}}, click.Hashes)
+	ver, ok := click.Pinned()
+	require.True(t, ok)
+	assert.Equal(t, "8.1.3", ver.String())
+
+	colorama := file.Requirements[1]
+	assert.Equal(t, "colorama", colorama.Name)
+	assert.NotNil(t, colorama.Marker)
+	assert.Equal(t, map[string][]string{"sha256": {"cccc"}}, colorama.Hashes)
+
+	flask := file.Requirements[2]
+	assert.Equal(t, "flask", flask.Name)
+	assert.Nil(t, flask.Hashes)
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]string{
+		"include":      "-r other.txt\n",
+		"editable":     "-e ./src\n",
+		"bad-hash":     "click==8.1.3 --hash=AAAA\n",
+		"bad-option":   "click==8.1.3 --install-option=--prefix=/opt\n",
+		"missing-arg":  "--index-url\n",
+		"bad-req":      "click===\n",
+		"trailing-arg": "--index-url https://example.com/ extra\n",
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			_, err := requirements.Parse(strings.NewReader(tcData))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPinned(t *testing.T) {
+	t.Parallel()
+	file, err := requirements.Parse(strings.NewReader("a>=1.0\nb==1.*\nc\nd==2.0,!=2.0.1\n"))
+	require.NoError(t, err)
+	for _, req := range file.Requirements {
+		_, ok := req.Pinned()
+		assert.False(t, ok, req.Name)
+	}
+}
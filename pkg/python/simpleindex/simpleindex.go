@@ -0,0 +1,327 @@
+// Package simpleindex serves a directory of wheel files as a PEP 503 "simple" repository, so that
+// pip (or ocibuild itself) can resolve and download from it, with PEP 658 metadata files so that
+// resolvers need not download whole wheels just to read their dependencies.
+//
+// https://www.python.org/dev/peps/pep-0503/
+// https://www.python.org/dev/peps/pep-0658/
+package simpleindex
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+
+	"github.com/datawire/ocibuild/pkg/python/pep345"
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// Server is an http.Handler that serves the wheel files in Dir.  The directory is re-read on each
+// request, so wheels may be added or removed while the server is running; the hash and metadata of
+// each file are computed the first time that they are needed, and remembered until the file
+// changes.
+//
+// It serves the project list at "/simple/", the file list of each project at
+// "/simple/{project}/", the wheel files themselves at "/files/{filename}", and their metadata at
+// "/files/{filename}.metadata".  Files in Dir that aren't wheels (or that don't have a valid wheel
+// filename) are ignored.
+type Server struct {
+	Dir string
+
+	mu    sync.Mutex
+	files map[string]*fileInfo
+}
+
+// fileInfo is what the Server knows about a single wheel file.
+type fileInfo struct {
+	Filename string
+	Project  string
+	ModTime  time.Time
+	Size     int64
+
+	SHA256         string
+	Metadata       []byte
+	MetadataSHA256 string
+	RequiresPython string
+}
+
+const filesPrefix = "/files/"
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/":
+		http.Redirect(w, r, "/simple/", http.StatusFound)
+	case r.URL.Path == "/simple":
+		http.Redirect(w, r, "/simple/", http.StatusMovedPermanently)
+	case r.URL.Path == "/simple/":
+		s.serveProjectList(w, r)
+	case strings.HasPrefix(r.URL.Path, "/simple/"):
+		project := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/simple/"), "/")
+		if strings.Contains(project, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		// PEP 503 says that clients should use the normalized name, but that servers may
+		// redirect other names to it; pip relies on the trailing "/".
+		if normalized := pep503.NormalizeName(project); r.URL.Path != "/simple/"+normalized+"/" {
+			http.Redirect(w, r, "/simple/"+normalized+"/", http.StatusMovedPermanently)
+			return
+		}
+		s.serveFileList(w, r, project)
+	case strings.HasPrefix(r.URL.Path, filesPrefix):
+		s.serveFile(w, r, strings.TrimPrefix(r.URL.Path, filesPrefix))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// scan lists the wheel files in s.Dir, without reading them.
+func (s *Server) scan() ([]*fileInfo, error) {
+	dirents, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string]*fileInfo)
+	}
+	ret := make([]*fileInfo, 0, len(dirents))
+	seen := make(map[string]struct{}, len(dirents))
+	for _, dirent := range dirents {
+		if !strings.HasSuffix(dirent.Name(), ".whl") {
+			continue
+		}
+		info, err := dirent.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		filenameInfo, err := bdist.ParseFilename(dirent.Name())
+		if err != nil {
+			continue
+		}
+		seen[dirent.Name()] = struct{}{}
+		file := s.files[dirent.Name()]
+		if file == nil || !file.ModTime.Equal(info.ModTime()) || file.Size != info.Size() {
+			file = &fileInfo{ //nolint:exhaustivestruct // the rest is filled in by load
+				Filename: dirent.Name(),
+				Project:  pep503.NormalizeName(filenameInfo.Distribution),
+				ModTime:  info.ModTime(),
+				Size:     info.Size(),
+			}
+			s.files[dirent.Name()] = file
+		}
+		ret = append(ret, file)
+	}
+	for filename := range s.files {
+		if _, ok := seen[filename]; !ok {
+			delete(s.files, filename)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Filename < ret[j].Filename
+	})
+	return ret, nil
+}
+
+// load fills in the hash and metadata of a file, if they aren't already known.
+func (s *Server) load(file *fileInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if file.SHA256 != "" {
+		return nil
+	}
+	content, err := os.ReadFile(filepath.Join(s.Dir, file.Filename))
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return fmt.Errorf("%s: %w", file.Filename, err)
+	}
+	metadata, err := bdist.ReadMetadataFile(zipReader)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file.Filename, err)
+	}
+	header, err := pep345.ParseMetadata(bytes.NewReader(metadata))
+	if err != nil {
+		return fmt.Errorf("%s: METADATA: %w", file.Filename, err)
+	}
+	metadataSum := sha256.Sum256(metadata)
+
+	file.Metadata = metadata
+	file.MetadataSHA256 = hex.EncodeToString(metadataSum[:])
+	file.RequiresPython = header.Get("Requires-Python")
+	file.SHA256 = hex.EncodeToString(sum[:])
+	return nil
+}
+
+//nolint:gochecknoglobals // Would be 'const'.
+var projectListTmpl = template.Must(template.New("projects").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta name="pypi:repository-version" content="1.0">
+    <title>Simple index</title>
+  </head>
+  <body>
+{{- range .}}
+    <a href="/simple/{{.}}/">{{.}}</a><br>
+{{- end}}
+  </body>
+</html>
+`))
+
+//nolint:gochecknoglobals // Would be 'const'.
+var fileListTmpl = template.Must(template.New("files").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta name="pypi:repository-version" content="1.0">
+    <title>Links for {{.Project}}</title>
+  </head>
+  <body>
+    <h1>Links for {{.Project}}</h1>
+{{- range .Files}}
+    <a href="/files/{{.Filename}}{{if .SHA256}}#sha256={{.SHA256}}{{end}}"
+      {{- if .RequiresPython}} data-requires-python="{{.RequiresPython}}"{{end}}
+      {{- if .MetadataSHA256}} data-core-metadata="sha256={{.MetadataSHA256}}"
+      data-dist-info-metadata="sha256={{.MetadataSHA256}}"{{end}}>{{.Filename}}</a><br>
+{{- end}}
+  </body>
+</html>
+`))
+
+func (s *Server) serveProjectList(w http.ResponseWriter, r *http.Request) {
+	files, err := s.scan()
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	var projects []string
+	seen := make(map[string]struct{})
+	for _, file := range files {
+		if _, ok := seen[file.Project]; !ok {
+			seen[file.Project] = struct{}{}
+			projects = append(projects, file.Project)
+		}
+	}
+	sort.Strings(projects)
+	s.serveTemplate(w, r, projectListTmpl, projects)
+}
+
+func (s *Server) serveFileList(w http.ResponseWriter, r *http.Request, project string) {
+	files, err := s.scan()
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	var projectFiles []fileInfo
+	for _, file := range files {
+		if file.Project != project {
+			continue
+		}
+		if err := s.load(file); err != nil {
+			// Still list the file, just without the hash or the metadata, so that the
+			// problem shows up when the client tries to use it.
+			dlog.Warnf(r.Context(), "simpleindex: %v", err)
+			projectFiles = append(projectFiles, fileInfo{ //nolint:exhaustivestruct // zero value
+				Filename: file.Filename,
+			})
+			continue
+		}
+		projectFiles = append(projectFiles, *file)
+	}
+	if len(projectFiles) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveTemplate(w, r, fileListTmpl, struct {
+		Project string
+		Files   []fileInfo
+	}{
+		Project: project,
+		Files:   projectFiles,
+	})
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	wantMetadata := strings.HasSuffix(name, ".whl.metadata")
+	filename := strings.TrimSuffix(name, ".metadata")
+	if path.Base(filename) != filename {
+		http.NotFound(w, r)
+		return
+	}
+	files, err := s.scan()
+	if err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	for _, file := range files {
+		if file.Filename != filename {
+			continue
+		}
+		if wantMetadata {
+			if err := s.load(file); err != nil {
+				s.serveError(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			http.ServeContent(w, r, "", file.ModTime, bytes.NewReader(file.Metadata))
+			return
+		}
+		content, err := os.Open(filepath.Join(s.Dir, file.Filename))
+		if err != nil {
+			s.serveError(w, r, err)
+			return
+		}
+		defer func() {
+			_ = content.Close()
+		}()
+		// http.ServeContent handles Range requests, which pep503.Client uses to resume and
+		// to segment downloads.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, file.Filename, file.ModTime, content)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) serveTemplate(w http.ResponseWriter, r *http.Request, tmpl *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		s.serveError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = io.Copy(w, &buf)
+}
+
+func (s *Server) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	dlog.Errorf(r.Context(), "simpleindex: %s %s: %v", r.Method, r.URL.Path, err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
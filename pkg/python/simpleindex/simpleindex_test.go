@@ -0,0 +1,106 @@
+package simpleindex_test
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python/pep503"
+	"github.com/datawire/ocibuild/pkg/python/simpleindex"
+)
+
+// writeWheel writes a minimal wheel file to dir.
+func writeWheel(t *testing.T, dir, filename, distInfoDir, metadata string) []byte {
+	t.Helper()
+	file, err := os.Create(filepath.Join(dir, filename))
+	require.NoError(t, err)
+	zipWriter := zip.NewWriter(file)
+	for name, content := range map[string]string{
+		distInfoDir + "/METADATA": metadata,
+		distInfoDir + "/WHEEL":    "Wheel-Version: 1.0\nRoot-Is-Purelib: true\nTag: py3-none-any\n",
+		distInfoDir + "/RECORD":   "",
+	} {
+		w, err := zipWriter.Create(name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zipWriter.Close())
+	require.NoError(t, file.Close())
+	content, err := os.ReadFile(filepath.Join(dir, filename))
+	require.NoError(t, err)
+	return content
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	const metadata1 = "Metadata-Version: 2.1\nName: Example.Pkg\nVersion: 1.0\nRequires-Python: >=3.6\n"
+	whl1 := writeWheel(t, dir, "Example.Pkg-1.0-py3-none-any.whl", "Example.Pkg-1.0.dist-info", metadata1)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a wheel"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "not-a-wheel.whl"), []byte("junk"), 0o644))
+
+	srv := httptest.NewServer(&simpleindex.Server{Dir: dir}) //nolint:exhaustivestruct
+	t.Cleanup(srv.Close)
+	client := pep503.Client{ //nolint:exhaustivestruct
+		BaseURL:    srv.URL + "/simple/",
+		HTTPClient: srv.Client(),
+	}
+
+	packages, err := client.ListPackages(ctx)
+	require.NoError(t, err)
+	require.Len(t, packages, 1)
+	assert.Equal(t, "example-pkg", packages[0].Text)
+
+	// Non-normalized names redirect to the normalized name.
+	for _, name := range []string{"example-pkg", "Example_Pkg"} {
+		links, err := client.ListPackageFiles(ctx, name)
+		require.NoError(t, err, name)
+		require.Len(t, links, 1, name)
+		assert.Equal(t, "Example.Pkg-1.0-py3-none-any.whl", links[0].Text)
+		assert.Equal(t, ">=3.6", links[0].DataAttrs["data-requires-python"])
+	}
+
+	links, err := client.ListPackageFiles(ctx, "example-pkg")
+	require.NoError(t, err)
+	content, err := links[0].Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, whl1, content)
+	gotMetadata, err := links[0].GetMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, metadata1, string(gotMetadata))
+
+	// Files that are added while the server is running show up.
+	const metadata2 = "Metadata-Version: 2.1\nName: Example.Pkg\nVersion: 2.0\n"
+	whl2 := writeWheel(t, dir, "Example.Pkg-2.0-py3-none-any.whl", "Example.Pkg-2.0.dist-info", metadata2)
+	links, err = client.ListPackageFiles(ctx, "example-pkg")
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "Example.Pkg-2.0-py3-none-any.whl", links[1].Text)
+	assert.NotContains(t, links[1].DataAttrs, "data-requires-python")
+	content, err = links[1].Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, whl2, content)
+
+	for _, path := range []string{
+		"/simple/missing/",
+		"/files/README.txt",
+		"/files/not-a-wheel.whl",
+		"/files/../README.txt",
+		"/other",
+	} {
+		resp, err := srv.Client().Get(srv.URL + path) //nolint:noctx // it's a test
+		require.NoError(t, err, path)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
@@ -0,0 +1,169 @@
+// Package slim implements filters that remove files that aren't needed at runtime (test suites,
+// type stubs, documentation, translations...) from installed Python distributions, in order to
+// reduce the size of the resulting layers.
+package slim
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/pypa/bdist"
+)
+
+// DefaultGlobs is a reasonable set of patterns to pass to Filter.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var DefaultGlobs = []string{
+	"tests",
+	"test",
+	"*.pyi",
+	"doc",
+	"docs",
+	"locale",
+}
+
+// Report describes what a Filter removed.
+type Report struct {
+	// Distribution is the name of the .dist-info directory of the distribution that the report
+	// is for.
+	Distribution string
+
+	Files int
+	Bytes int64
+
+	// ByGlob is the number of bytes removed by each glob pattern.
+	ByGlob map[string]int64
+}
+
+func (r Report) String() string {
+	globs := make([]string, 0, len(r.ByGlob))
+	for glob := range r.ByGlob {
+		globs = append(globs, glob)
+	}
+	sort.Strings(globs)
+	parts := make([]string, 0, len(globs))
+	for _, glob := range globs {
+		parts = append(parts, fmt.Sprintf("%q: %d bytes", glob, r.ByGlob[glob]))
+	}
+	return fmt.Sprintf("%s: removed %d files (%d bytes) {%s}",
+		r.Distribution, r.Files, r.Bytes, strings.Join(parts, ", "))
+}
+
+// pycSource returns the name of the .py file that a "__pycache__/{module}.{tag}.pyc" file was
+// compiled from, or an empty string if name isn't a file in __pycache__.
+func pycSource(name string) string {
+	dir, file := path.Split(name)
+	if path.Base(dir) != "__pycache__" || !strings.HasSuffix(file, ".pyc") {
+		return ""
+	}
+	module := file
+	if idx := strings.Index(file, "."); idx >= 0 {
+		module = file[:idx]
+	}
+	return path.Join(path.Dir(path.Dir(name)), module+".py")
+}
+
+// Filter returns a bdist.PostInstallHook that removes files that match any of the glob patterns
+// (using path.Match syntax).  Patterns are matched against paths relative to whichever of the
+// platform's scheme directories the file is installed in; for instance "tests" drops any
+// "tests/" directory in site-packages, and "*.pyi" drops all type stubs.  Compiled bytecode for
+// any removed .py files is also removed.  Files in the .dist-info directory are never removed.
+//
+// Because it changes which files are installed, Filter must run before the hook that writes
+// RECORD (recording_installs.Record).
+//
+// If report is non-nil, it is called with a summary of what was removed.
+func Filter(plat python.Platform, globs []string, report func(Report)) bdist.PostInstallHook {
+	var roots []string
+	for _, dir := range []string{
+		plat.Scheme.PureLib,
+		plat.Scheme.PlatLib,
+		plat.Scheme.Headers,
+		plat.Scheme.Scripts,
+		plat.Scheme.Data,
+		plat.Scheme.Include,
+	} {
+		if dir == "" {
+			continue
+		}
+		roots = append(roots, strings.Trim(path.Clean("/"+dir), "/"))
+	}
+	// Check longer (more specific) roots first, since "data" is usually a parent of the others.
+	sort.Slice(roots, func(i, j int) bool {
+		return len(roots[i]) > len(roots[j])
+	})
+
+	relName := func(name string) string {
+		for _, root := range roots {
+			if strings.HasPrefix(name, root+"/") {
+				return strings.TrimPrefix(name, root+"/")
+			}
+		}
+		return name
+	}
+
+	return func(
+		ctx context.Context,
+		clampTime time.Time,
+		vfs map[string]fsutil.FileReference,
+		installedDistInfoDir string,
+	) error {
+		if len(globs) == 0 {
+			return nil
+		}
+		rpt := Report{
+			Distribution: path.Base(installedDistInfoDir),
+			ByGlob:       make(map[string]int64),
+		}
+		matches := make(map[string]string)
+		for name := range vfs {
+			if fsutil.IsUnder(name, installedDistInfoDir) {
+				continue
+			}
+			if glob := fsutil.MatchGlob(globs, relName(name)); glob != "" {
+				matches[name] = glob
+			}
+		}
+		// Also remove the compiled bytecode for any removed .py files.
+		for name := range vfs {
+			if _, ok := matches[name]; ok {
+				continue
+			}
+			if src := pycSource(name); src != "" {
+				if glob, ok := matches[src]; ok {
+					matches[name] = glob
+				}
+			}
+		}
+
+		kept := fsutil.Filter(fsutil.FileReferencesFromMap(vfs), func(file fsutil.FileReference) bool {
+			glob, ok := matches[file.FullName()]
+			if !ok {
+				return true
+			}
+			if !file.IsDir() {
+				rpt.Files++
+				rpt.Bytes += file.Size()
+				rpt.ByGlob[glob] += file.Size()
+			}
+			return false
+		})
+		for name := range vfs {
+			delete(vfs, name)
+		}
+		for _, file := range kept {
+			vfs[file.FullName()] = file
+		}
+
+		if report != nil {
+			report(rpt)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package slim_test
+
+import (
+	"archive/tar"
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/slim"
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	plat := python.Platform{ //nolint:exhaustivestruct
+		Scheme: python.Scheme{
+			PureLib: "/usr/lib/python3.9/site-packages",
+			PlatLib: "/usr/lib/python3.9/site-packages",
+			Headers: "/usr/include/python3.9/foo",
+			Scripts: "/usr/bin",
+			Data:    "/usr",
+			Include: "",
+		},
+	}
+	files := []string{
+		"usr/bin/foo",
+		"usr/lib/python3.9/site-packages/foo/__init__.py",
+		"usr/lib/python3.9/site-packages/foo/__init__.pyi",
+		"usr/lib/python3.9/site-packages/foo/__pycache__/__init__.cpython-39.pyc",
+		"usr/lib/python3.9/site-packages/foo/__pycache__/test_util.cpython-39.pyc",
+		"usr/lib/python3.9/site-packages/foo/tests/__init__.py",
+		"usr/lib/python3.9/site-packages/foo/tests/__pycache__/__init__.cpython-39.pyc",
+		"usr/lib/python3.9/site-packages/foo/test_util.py",
+		"usr/lib/python3.9/site-packages/foo-1.0.dist-info/METADATA",
+		"usr/lib/python3.9/site-packages/foo-1.0.dist-info/tests/keep.txt",
+		"usr/share/locale/de/LC_MESSAGES/foo.mo",
+	}
+	vfs := make(map[string]fsutil.FileReference, len(files))
+	for _, name := range files {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     10,
+		}
+		vfs[name] = &fsutil.InMemFileReference{
+			FileInfo:  header.FileInfo(),
+			MFullName: name,
+			MContent:  make([]byte, 10),
+		}
+	}
+
+	var rpt slim.Report
+	hook := slim.Filter(plat, []string{"tests", "*.pyi", "foo/test_*.py", "share/locale"}, func(r slim.Report) {
+		rpt = r
+	})
+	require.NoError(t, hook(context.Background(), time.Time{}, vfs,
+		"usr/lib/python3.9/site-packages/foo-1.0.dist-info"))
+
+	remaining := make([]string, 0, len(vfs))
+	for name := range vfs {
+		remaining = append(remaining, name)
+	}
+	sort.Strings(remaining)
+	assert.Equal(t, []string{
+		"usr/bin/foo",
+		"usr/lib/python3.9/site-packages/foo-1.0.dist-info/METADATA",
+		"usr/lib/python3.9/site-packages/foo-1.0.dist-info/tests/keep.txt",
+		"usr/lib/python3.9/site-packages/foo/__init__.py",
+		"usr/lib/python3.9/site-packages/foo/__pycache__/__init__.cpython-39.pyc",
+	}, remaining)
+	assert.Equal(t, slim.Report{
+		Distribution: "foo-1.0.dist-info",
+		Files:        6,
+		Bytes:        60,
+		ByGlob: map[string]int64{
+			"tests":         20,
+			"*.pyi":         10,
+			"foo/test_*.py": 20,
+			"share/locale":  10,
+		},
+	}, rpt)
+}
@@ -0,0 +1,110 @@
+package python
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// A Venv describes a virtual environment (as created by `python -m venv`; see PEP 405).
+type Venv struct {
+	// Root is the directory that the virtual environment is in; the directory that contains
+	// "pyvenv.cfg".
+	Root string // "/app/venv"
+
+	// BaseExecutable is the base interpreter that the virtual environment is layered on top
+	// of.
+	BaseExecutable string // "/usr/bin/python3.9"
+
+	// Version is the version of the base interpreter.
+	Version VersionInfo
+
+	// IncludeSystemSitePackages is whether the base interpreter's site-packages are visible in
+	// the virtual environment.
+	IncludeSystemSitePackages bool
+}
+
+// Home returns the directory containing the base interpreter, as is recorded in "pyvenv.cfg".
+func (v Venv) Home() string {
+	if idx := strings.LastIndexAny(v.BaseExecutable, `/\`); idx > 0 {
+		return v.BaseExecutable[:idx]
+	}
+	return v.BaseExecutable
+}
+
+// join joins path elements using the platform's path separator.
+func (plat Platform) join(elem ...string) string {
+	if !plat.Windows {
+		return path.Join(elem...)
+	}
+	parts := make([]string, 0, len(elem))
+	for i, part := range elem {
+		if i > 0 {
+			part = strings.TrimLeft(part, `\/`)
+		}
+		if i < len(elem)-1 {
+			part = strings.TrimRight(part, `\/`)
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, `\`)
+}
+
+// WithVenv returns a copy of the platform for installing in to a virtual environment at root,
+// using the platform's interpreter (its ConsoleShebang) as the base interpreter.  The scheme and
+// shebangs are those that `python -m venv` would give the virtual environment.  The platform must
+// specify a VersionInfo, as it determines the name of the "site-packages" directory.
+func (plat Platform) WithVenv(root string) (Platform, error) {
+	if err := plat.Init(); err != nil {
+		return plat, err
+	}
+	if plat.Venv != nil {
+		return plat, fmt.Errorf("python.Platform.WithVenv: platform is already a virtual environment: %q",
+			plat.Venv.Root)
+	}
+	if plat.VersionInfo == nil {
+		return plat, fmt.Errorf("python.Platform.WithVenv: platform does not specify a VersionInfo")
+	}
+	if !plat.isAbs(root) {
+		return plat, fmt.Errorf("python.Platform.WithVenv: virtual environment root is not an absolute path: %q",
+			root)
+	}
+
+	ret := plat
+	ret.Venv = &Venv{
+		Root:                      root,
+		BaseExecutable:            plat.ConsoleShebang,
+		Version:                   *plat.VersionInfo,
+		IncludeSystemSitePackages: false,
+	}
+	pythonXY := fmt.Sprintf("python%d.%d", plat.VersionInfo.Major, plat.VersionInfo.Minor)
+	ret.Scheme, ret.ConsoleShebang, ret.GraphicalShebang = venvScheme(plat, root, pythonXY)
+	return ret, nil
+}
+
+// venvScheme returns the scheme and shebangs that `python -m venv` would give a virtual environment
+// at root.
+func venvScheme(plat Platform, root, pythonXY string) (scheme Scheme, consoleShebang, graphicalShebang string) {
+	if plat.Windows {
+		// This mimics the "nt_venv" scheme in Python's sysconfig.
+		return Scheme{
+			PureLib: plat.join(root, "Lib", "site-packages"),
+			PlatLib: plat.join(root, "Lib", "site-packages"),
+			Headers: plat.join(root, "Include", "site", pythonXY),
+			Scripts: plat.join(root, "Scripts"),
+			Data:    root,
+			Include: plat.join(root, "Include"),
+		}, plat.join(root, "Scripts", "python.exe"), plat.join(root, "Scripts", "pythonw.exe")
+	}
+	// This mimics the "posix_venv" scheme in Python's sysconfig.
+	return Scheme{
+		PureLib: plat.join(root, "lib", pythonXY, "site-packages"),
+		PlatLib: plat.join(root, "lib", pythonXY, "site-packages"),
+		Headers: plat.join(root, "include", "site", pythonXY),
+		Scripts: plat.join(root, "bin"),
+		Data:    root,
+		Include: plat.join(root, "include", pythonXY),
+	}, plat.join(root, "bin", "python"), plat.join(root, "bin", "python")
+}
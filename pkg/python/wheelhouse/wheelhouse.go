@@ -0,0 +1,135 @@
+// Package wheelhouse implements a local directory of vendored wheel files (a "wheelhouse"), along
+// with a manifest that records where each wheel came from and its hashes, so that builds can run
+// offline against the directory (like pip's "--find-links") while still verifying what they
+// install.
+package wheelhouse
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/datawire/ocibuild/pkg/python"
+)
+
+// ManifestFilename is the name of the manifest file within a wheelhouse directory.
+const ManifestFilename = "wheelhouse.json"
+
+// A Manifest lists the wheels in a wheelhouse.
+type Manifest struct {
+	Wheels []Wheel `json:"wheels"`
+}
+
+// A Wheel is a single wheel file in a wheelhouse.
+type Wheel struct {
+	// Name and Version are the normalized project name and the version of the wheel.
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Filename is the name of the file within the wheelhouse directory.
+	Filename string `json:"filename"`
+	// Hashes maps hashlib algorithm names to hex digests of the file.
+	Hashes map[string]string `json:"hashes"`
+	// URL is where the file was downloaded from, if known.
+	URL string `json:"url,omitempty"`
+}
+
+// ErrNotFound is returned (wrapped) by Open if the wheelhouse doesn't have a file.
+var ErrNotFound = errors.New("not in wheelhouse")
+
+// ReadManifest reads the manifest of the wheelhouse in dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, ManifestFilename))
+	if err != nil {
+		return nil, fmt.Errorf("wheelhouse.ReadManifest: %w", err)
+	}
+	var ret Manifest
+	if err := json.Unmarshal(content, &ret); err != nil {
+		return nil, fmt.Errorf("wheelhouse.ReadManifest: %s: %w", ManifestFilename, err)
+	}
+	return &ret, nil
+}
+
+// WriteManifest writes the manifest of the wheelhouse in dir, with the wheels sorted by filename.
+func WriteManifest(dir string, manifest Manifest) error {
+	sort.Slice(manifest.Wheels, func(i, j int) bool {
+		return manifest.Wheels[i].Filename < manifest.Wheels[j].Filename
+	})
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("wheelhouse.WriteManifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFilename), append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("wheelhouse.WriteManifest: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the manifest entry for a filename.
+func (m Manifest) Lookup(filename string) (Wheel, bool) {
+	for _, whl := range m.Wheels {
+		if whl.Filename == filename {
+			return whl, true
+		}
+	}
+	return Wheel{}, false //nolint:exhaustivestruct // zero value
+}
+
+// Add adds a wheel to the manifest, replacing any existing entry with the same filename.
+func (m *Manifest) Add(whl Wheel) {
+	for i := range m.Wheels {
+		if m.Wheels[i].Filename == whl.Filename {
+			m.Wheels[i] = whl
+			return
+		}
+	}
+	m.Wheels = append(m.Wheels, whl)
+}
+
+// Verify returns an error if content doesn't match the wheel's hashes.  Every hash that uses a
+// recognized algorithm must match, and there must be at least one such hash.
+func (whl Wheel) Verify(content []byte) error {
+	checked := false
+	for alg, expected := range whl.Hashes {
+		newHasher := python.HashlibAlgorithmsGuaranteed[alg]
+		if newHasher == nil {
+			continue
+		}
+		hasher := newHasher()
+		_, _ = hasher.Write(content)
+		if actual := hex.EncodeToString(hasher.Sum(nil)); actual != expected {
+			return fmt.Errorf("%w: %s: %s: expected=%s actual=%s",
+				python.ErrHashMismatch, whl.Filename, alg, expected, actual)
+		}
+		checked = true
+	}
+	if !checked {
+		return fmt.Errorf("%s: no hashes with a recognized algorithm", whl.Filename)
+	}
+	return nil
+}
+
+// Open reads a wheel file from the wheelhouse in dir, verifying it against the manifest.  Files
+// that aren't listed in the manifest are not returned, even if they are present in the directory.
+func Open(dir, filename string) ([]byte, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	whl, ok := manifest.Lookup(filename)
+	if !ok {
+		return nil, fmt.Errorf("wheelhouse.Open: %q: %w", filename, ErrNotFound)
+	}
+	content, err := fs.ReadFile(os.DirFS(dir), whl.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("wheelhouse.Open: %w", err)
+	}
+	if err := whl.Verify(content); err != nil {
+		return nil, fmt.Errorf("wheelhouse.Open: %w", err)
+	}
+	return content, nil
+}
@@ -0,0 +1,64 @@
+package wheelhouse_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/python/wheelhouse"
+)
+
+func TestWheelhouse(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	content := []byte("not really a wheel")
+	sum := sha256.Sum256(content)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "example-1.0-py3-none-any.whl"), content, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unlisted-1.0-py3-none-any.whl"), content, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad-1.0-py3-none-any.whl"), content, 0o644))
+
+	var manifest wheelhouse.Manifest
+	manifest.Add(wheelhouse.Wheel{ //nolint:exhaustivestruct
+		Name:     "example",
+		Version:  "1.0",
+		Filename: "example-1.0-py3-none-any.whl",
+		Hashes:   map[string]string{"sha256": "0000"},
+	})
+	manifest.Add(wheelhouse.Wheel{ //nolint:exhaustivestruct
+		Name:     "bad",
+		Version:  "1.0",
+		Filename: "bad-1.0-py3-none-any.whl",
+		Hashes:   map[string]string{"sha256": "0000"},
+	})
+	manifest.Add(wheelhouse.Wheel{ //nolint:exhaustivestruct
+		Name:     "example",
+		Version:  "1.0",
+		Filename: "example-1.0-py3-none-any.whl",
+		Hashes:   map[string]string{"sha256": hex.EncodeToString(sum[:])},
+	})
+	require.Len(t, manifest.Wheels, 2)
+	require.NoError(t, wheelhouse.WriteManifest(dir, manifest))
+
+	again, err := wheelhouse.ReadManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "bad-1.0-py3-none-any.whl", again.Wheels[0].Filename)
+	assert.Equal(t, "example-1.0-py3-none-any.whl", again.Wheels[1].Filename)
+
+	got, err := wheelhouse.Open(dir, "example-1.0-py3-none-any.whl")
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	_, err = wheelhouse.Open(dir, "unlisted-1.0-py3-none-any.whl")
+	assert.True(t, errors.Is(err, wheelhouse.ErrNotFound))
+
+	_, err = wheelhouse.Open(dir, "bad-1.0-py3-none-any.whl")
+	assert.ErrorIs(t, err, python.ErrHashMismatch)
+}
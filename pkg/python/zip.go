@@ -2,6 +2,10 @@
 
 package python
 
+import (
+	"io/fs"
+)
+
 // A DOSAttribute represents an "MS-DOS directory attribute byte" (as referenced by the ZIP file
 // format specification[1]).
 //
@@ -49,7 +53,8 @@ func (ea ZIPExternalAttributes) Raw() uint32 {
 }
 
 // ParseZIPExternalAttributes turns an unstructured 32-bit unsigned integer in to a 32-bit
-// ZIPExternalAttributes struct.
+// ZIPExternalAttributes struct.  It is the inverse of Raw; ParseZIPExternalAttributes(raw).Raw()
+// == raw for every raw value.
 func ParseZIPExternalAttributes(raw uint32) ZIPExternalAttributes {
 	return ZIPExternalAttributes{
 		UNIX:   StatMode(raw >> 16),
@@ -57,3 +62,63 @@ func ParseZIPExternalAttributes(raw uint32) ZIPExternalAttributes {
 		MSDOS:  DOSAttribute(raw),
 	}
 }
+
+// FileAttributes returns the Windows file attributes that a file with these external attributes
+// should have when installed on Windows.  The ReadOnly, Hidden, and System bits are taken from the
+// MS-DOS attributes; ReadOnly is also set if the UNIX mode has no write bits, Directory is set for
+// directories, and Archive is set for everything else (as Windows does for any newly-created file).
+func (ea ZIPExternalAttributes) FileAttributes() StatFileAttribute {
+	ret := StatFileAttribute(ea.MSDOS & (DOSReadOnly | DOSHidden | DOSSystem))
+	if ea.UNIX&ModeFmt != 0 && ea.UNIX&0o222 == 0 {
+		ret |= FileAttributeReadonly
+	}
+	if ea.UNIX.IsDir() || ea.MSDOS&DOSDirectory != 0 {
+		ret |= FileAttributeDirectory
+	} else {
+		ret |= FileAttributeArchive
+	}
+	return ret
+}
+
+// ZIPExternalAttributesFromMode returns the external attributes for a file with the mode goMode,
+// set the way that Python's `zipfile.ZipInfo.from_file` sets them: the UNIX half is the full
+// mode, and the MS-DOS Directory bit is set for directories.  Additionally (like Info-ZIP, but
+// unlike `zipfile`), the MS-DOS ReadOnly bit is set if the mode has no write bits, so that the
+// MS-DOS half is meaningful on its own.
+//
+// For any goMode that a StatMode can represent (regular files, directories, symlinks, devices,
+// named pipes, and sockets; with any permission, setuid, setgid, or sticky bits),
+// ZIPExternalAttributesFromMode(goMode).Mode() == goMode.
+func ZIPExternalAttributesFromMode(goMode fs.FileMode) ZIPExternalAttributes {
+	ret := ZIPExternalAttributes{
+		UNIX:   ModeFromGo(goMode),
+		Unused: 0,
+		MSDOS:  0,
+	}
+	if goMode.IsDir() {
+		ret.MSDOS |= DOSDirectory
+	}
+	if goMode&0o222 == 0 {
+		ret.MSDOS |= DOSReadOnly
+	}
+	return ret
+}
+
+// Mode returns the Go file mode that ea describes.  If the UNIX half is set (that is, if it has
+// any file-type bits), then that is used.  Otherwise (as for a ZIP file created on Windows), the
+// mode is derived from the MS-DOS half: a 0755 directory if the Directory bit is set, or else a
+// regular file that is 0644 (or 0444 if the ReadOnly bit is set).  MS-DOS has no notion of an
+// executable bit, so it is never set for files from the MS-DOS half.
+func (ea ZIPExternalAttributes) Mode() fs.FileMode {
+	if ea.UNIX&ModeFmt != 0 {
+		return ea.UNIX.ToGo()
+	}
+	switch {
+	case ea.MSDOS&DOSDirectory != 0:
+		return fs.ModeDir | 0o755
+	case ea.MSDOS&DOSReadOnly != 0:
+		return 0o444
+	default:
+		return 0o644
+	}
+}
@@ -0,0 +1,130 @@
+package python_test
+
+import (
+	"io/fs"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/datawire/ocibuild/pkg/python"
+	"github.com/datawire/ocibuild/pkg/testutil"
+)
+
+func TestZIPExternalAttributesFileAttributes(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Input  python.ZIPExternalAttributes
+		Output python.StatFileAttribute
+	}{
+		"unix-file": {
+			Input:  python.ZIPExternalAttributes{UNIX: python.ModeFromGo(0o644)}, //nolint:exhaustivestruct
+			Output: python.FileAttributeArchive,
+		},
+		"unix-readonly-file": {
+			Input:  python.ZIPExternalAttributes{UNIX: python.ModeFromGo(0o444)}, //nolint:exhaustivestruct
+			Output: python.FileAttributeArchive | python.FileAttributeReadonly,
+		},
+		"unix-dir": {
+			Input:  python.ZIPExternalAttributes{UNIX: python.ModeFromGo(fs.ModeDir | 0o755)}, //nolint:exhaustivestruct
+			Output: python.FileAttributeDirectory,
+		},
+		"dos-hidden-file": {
+			Input:  python.ZIPExternalAttributes{MSDOS: python.DOSHidden | python.DOSArchive}, //nolint:exhaustivestruct
+			Output: python.FileAttributeArchive | python.FileAttributeHidden,
+		},
+		"dos-system-dir": {
+			Input:  python.ZIPExternalAttributes{MSDOS: python.DOSSystem | python.DOSDirectory}, //nolint:exhaustivestruct
+			Output: python.FileAttributeDirectory | python.FileAttributeSystem,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tcData.Output, tcData.Input.FileAttributes())
+		})
+	}
+}
+
+func TestZIPExternalAttributesRoundTrip(t *testing.T) {
+	t.Parallel()
+	testutil.QuickCheck(t, func(raw uint32) bool {
+		return python.ParseZIPExternalAttributes(raw).Raw() == raw
+	}, quick.Config{MaxCount: 10000}) //nolint:exhaustivestruct
+
+	for _, typ := range []fs.FileMode{
+		0, fs.ModeDir, fs.ModeSymlink, fs.ModeDevice, fs.ModeDevice | fs.ModeCharDevice,
+		fs.ModeNamedPipe, fs.ModeSocket,
+	} {
+		for _, perm := range []fs.FileMode{
+			0, 0o444, 0o644, 0o755, 0o777, 0o700 | fs.ModeSetuid, 0o755 | fs.ModeSetgid,
+			0o777 | fs.ModeSticky,
+		} {
+			mode := typ | perm
+			assert.Equal(t, mode, python.ZIPExternalAttributesFromMode(mode).Mode(), "mode=%v", mode)
+		}
+	}
+}
+
+func TestZIPExternalAttributesMode(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Input     python.ZIPExternalAttributes
+		ExpMode   fs.FileMode
+		ExpRaw    uint32
+		FileAttrs python.StatFileAttribute
+	}{
+		"unix-file": {
+			Input:     python.ZIPExternalAttributesFromMode(0o644),
+			ExpMode:   0o644,
+			ExpRaw:    0o100644 << 16,
+			FileAttrs: python.FileAttributeArchive,
+		},
+		"unix-readonly-file": {
+			Input:     python.ZIPExternalAttributesFromMode(0o444),
+			ExpMode:   0o444,
+			ExpRaw:    0o100444<<16 | uint32(python.DOSReadOnly),
+			FileAttrs: python.FileAttributeArchive | python.FileAttributeReadonly,
+		},
+		"unix-dir": {
+			Input:     python.ZIPExternalAttributesFromMode(fs.ModeDir | 0o755),
+			ExpMode:   fs.ModeDir | 0o755,
+			ExpRaw:    0o040755<<16 | uint32(python.DOSDirectory),
+			FileAttrs: python.FileAttributeDirectory,
+		},
+		"unix-readonly-dir": {
+			Input:     python.ZIPExternalAttributesFromMode(fs.ModeDir | 0o555),
+			ExpMode:   fs.ModeDir | 0o555,
+			ExpRaw:    0o040555<<16 | uint32(python.DOSDirectory|python.DOSReadOnly),
+			FileAttrs: python.FileAttributeDirectory | python.FileAttributeReadonly,
+		},
+		"dos-file": {
+			Input:     python.ParseZIPExternalAttributes(uint32(python.DOSArchive)),
+			ExpMode:   0o644,
+			ExpRaw:    uint32(python.DOSArchive),
+			FileAttrs: python.FileAttributeArchive,
+		},
+		"dos-readonly-file": {
+			Input:     python.ParseZIPExternalAttributes(uint32(python.DOSArchive | python.DOSReadOnly)),
+			ExpMode:   0o444,
+			ExpRaw:    uint32(python.DOSArchive | python.DOSReadOnly),
+			FileAttrs: python.FileAttributeArchive | python.FileAttributeReadonly,
+		},
+		"dos-dir": {
+			Input:     python.ParseZIPExternalAttributes(uint32(python.DOSDirectory)),
+			ExpMode:   fs.ModeDir | 0o755,
+			ExpRaw:    uint32(python.DOSDirectory),
+			FileAttrs: python.FileAttributeDirectory,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tcData.ExpMode, tcData.Input.Mode())
+			assert.Equal(t, tcData.ExpRaw, tcData.Input.Raw())
+			assert.Equal(t, tcData.FileAttrs, tcData.Input.FileAttributes())
+		})
+	}
+}
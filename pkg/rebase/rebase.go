@@ -0,0 +1,160 @@
+// Package rebase replaces the base layers of an image with those of a different base image, without
+// rebuilding the layers on top of them.
+//
+// This is only correct if the layers on top of the base don't depend on the exact contents of the
+// old base (for instance, a layer that installs Python packages in to a directory that both bases
+// agree on); rebasing doesn't re-run anything, it just swaps which layers are underneath.
+package rebase
+
+import (
+	"fmt"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"github.com/datawire/ocibuild/pkg/platform"
+)
+
+// Rebase returns a copy of img with the layers of oldBase replaced by the layers of newBase.
+//
+// It is an error if the bottom-most layers of img are not the layers of oldBase; layers are
+// compared by their DiffIDs (the digest of the uncompressed layer), so it doesn't matter if img
+// and oldBase compress their layers differently.
+//
+// The config of the returned image is that of img, except that:
+//
+//   - the "rootfs.diff_ids" are those of newBase followed by those of the non-base layers of img,
+//   - the "history" is that of newBase followed by the non-base entries of img, and
+//   - the "os", "architecture", "variant", and "os.version" are those of newBase (if newBase
+//     says what platform it is for).
+//
+// The "config" (environment variables, entrypoint, and such) is kept from img as-is, even if it
+// was inherited from oldBase.
+func Rebase(img, oldBase, newBase ociv1.Image) (ociv1.Image, error) {
+	imgConfig, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: image: %w", err)
+	}
+	oldConfig, err := oldBase.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: old base: %w", err)
+	}
+	newConfig, err := newBase.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: new base: %w", err)
+	}
+
+	// Verify that img is actually based on oldBase.
+	imgDiffIDs := imgConfig.RootFS.DiffIDs
+	oldDiffIDs := oldConfig.RootFS.DiffIDs
+	if len(oldDiffIDs) > len(imgDiffIDs) {
+		return nil, fmt.Errorf("rebase.Rebase: image is not based on the old base: "+
+			"the old base has %d layers, but the image only has %d",
+			len(oldDiffIDs), len(imgDiffIDs))
+	}
+	for i := range oldDiffIDs {
+		if imgDiffIDs[i] != oldDiffIDs[i] {
+			return nil, fmt.Errorf("rebase.Rebase: image is not based on the old base: "+
+				"layer %d is %s in the image, but %s in the old base",
+				i, imgDiffIDs[i], oldDiffIDs[i])
+		}
+	}
+
+	imgLayers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: image: %w", err)
+	}
+	newLayers, err := newBase.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: new base: %w", err)
+	}
+	if len(imgLayers) != len(imgDiffIDs) {
+		return nil, fmt.Errorf("rebase.Rebase: image: manifest has %d layers, but config has %d diff_ids",
+			len(imgLayers), len(imgDiffIDs))
+	}
+	if len(newLayers) != len(newConfig.RootFS.DiffIDs) {
+		return nil, fmt.Errorf("rebase.Rebase: new base: manifest has %d layers, but config has %d diff_ids",
+			len(newLayers), len(newConfig.RootFS.DiffIDs))
+	}
+
+	baseHistory := newConfig.History
+	topHistory := imgConfig.History[baseHistoryLen(imgConfig.History, oldConfig.History, len(oldDiffIDs)):]
+	// If only one of the halves has a history, then give the other half blank entries so that
+	// the history still lines up with the layers.
+	switch {
+	case len(baseHistory) == 0 && len(topHistory) > 0:
+		baseHistory = make([]ociv1.History, len(newLayers))
+	case len(baseHistory) > 0 && len(topHistory) == 0:
+		topHistory = make([]ociv1.History, len(imgLayers)-len(oldDiffIDs))
+	}
+
+	config := imgConfig.DeepCopy()
+	config.RootFS.DiffIDs = append(append([]ociv1.Hash(nil), newConfig.RootFS.DiffIDs...),
+		imgDiffIDs[len(oldDiffIDs):]...)
+	config.History = append(append([]ociv1.History(nil), baseHistory...), topHistory...)
+
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: image: %w", err)
+	}
+	ret := mutate.MediaType(empty.Image, mediaType)
+	ret, err = mutate.AppendLayers(ret,
+		append(append([]ociv1.Layer(nil), newLayers...), imgLayers[len(oldDiffIDs):]...)...)
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: %w", err)
+	}
+	ret, err = mutate.ConfigFile(ret, config)
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: %w", err)
+	}
+
+	plat, err := platform.Get(newBase)
+	if err != nil {
+		return nil, fmt.Errorf("rebase.Rebase: new base: %w", err)
+	}
+	if plat.OS != "" && plat.Architecture != "" {
+		ret, err = platform.Set(ret, plat)
+		if err != nil {
+			return nil, fmt.Errorf("rebase.Rebase: %w", err)
+		}
+	}
+	return ret, nil
+}
+
+// baseHistoryLen returns how many of the entries at the start of imgHistory belong to the base
+// image; the base image having the history baseHistory and numBaseLayers layers.
+//
+// Usually this is just len(baseHistory), but if the history has been edited since the image was
+// built (such as by `ocibuild image history --drop-empty`), then it is the entries up to and
+// including the entry for the last base layer.
+func baseHistoryLen(imgHistory, baseHistory []ociv1.History, numBaseLayers int) int {
+	if len(baseHistory) > 0 && len(imgHistory) >= len(baseHistory) {
+		match := true
+		for i := range baseHistory {
+			if imgHistory[i].CreatedBy != baseHistory[i].CreatedBy ||
+				imgHistory[i].EmptyLayer != baseHistory[i].EmptyLayer {
+				match = false
+				break
+			}
+		}
+		if match {
+			return len(baseHistory)
+		}
+	}
+	if numBaseLayers == 0 {
+		return 0
+	}
+	layers := 0
+	for i, entry := range imgHistory {
+		if !entry.EmptyLayer {
+			layers++
+		}
+		if layers == numBaseLayers {
+			return i + 1
+		}
+	}
+	// The history doesn't describe all of the layers; treat all of it as belonging to the
+	// base.
+	return len(imgHistory)
+}
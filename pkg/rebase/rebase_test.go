@@ -0,0 +1,118 @@
+package rebase_test
+
+import (
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/platform"
+	"github.com/datawire/ocibuild/pkg/rebase"
+)
+
+func randomLayer(t *testing.T) ociv1.Layer {
+	t.Helper()
+	layer, err := random.Layer(64, "application/vnd.docker.image.rootfs.diff.tar.gzip")
+	require.NoError(t, err)
+	return layer
+}
+
+func testImage(t *testing.T, base ociv1.Image, plat string, entries ...mutate.Addendum) ociv1.Image {
+	t.Helper()
+	img, err := mutate.Append(base, entries...)
+	require.NoError(t, err)
+	if plat != "" {
+		parsed, err := platform.Parse(plat)
+		require.NoError(t, err)
+		img, err = platform.Set(img, parsed)
+		require.NoError(t, err)
+	}
+	return img
+}
+
+func diffIDs(t *testing.T, img ociv1.Image) []ociv1.Hash {
+	t.Helper()
+	config, err := img.ConfigFile()
+	require.NoError(t, err)
+	return config.RootFS.DiffIDs
+}
+
+func createdBy(t *testing.T, img ociv1.Image) []string {
+	t.Helper()
+	config, err := img.ConfigFile()
+	require.NoError(t, err)
+	ret := make([]string, 0, len(config.History))
+	for _, entry := range config.History {
+		ret = append(ret, entry.CreatedBy)
+	}
+	return ret
+}
+
+func TestRebase(t *testing.T) {
+	t.Parallel()
+
+	oldBase := testImage(t, empty.Image, "linux/amd64",
+		mutate.Addendum{Layer: randomLayer(t), History: ociv1.History{CreatedBy: "old-1"}}, //nolint:exhaustivestruct
+		mutate.Addendum{History: ociv1.History{CreatedBy: "old-env", EmptyLayer: true}},    //nolint:exhaustivestruct
+		mutate.Addendum{Layer: randomLayer(t), History: ociv1.History{CreatedBy: "old-2"}}) //nolint:exhaustivestruct
+	newBase := testImage(t, empty.Image, "linux/arm64/v8",
+		mutate.Addendum{Layer: randomLayer(t), History: ociv1.History{CreatedBy: "new-1"}}) //nolint:exhaustivestruct
+	app := testImage(t, oldBase, "",
+		mutate.Addendum{History: ociv1.History{CreatedBy: "app-env", EmptyLayer: true}},    //nolint:exhaustivestruct
+		mutate.Addendum{Layer: randomLayer(t), History: ociv1.History{CreatedBy: "app-1"}}) //nolint:exhaustivestruct
+
+	rebased, err := rebase.Rebase(app, oldBase, newBase)
+	require.NoError(t, err)
+
+	assert.Equal(t, append(diffIDs(t, newBase), diffIDs(t, app)[2:]...), diffIDs(t, rebased))
+	assert.Equal(t, []string{"new-1", "app-env", "app-1"}, createdBy(t, rebased))
+	plat, err := platform.Get(rebased)
+	require.NoError(t, err)
+	assert.Equal(t, "linux/arm64/v8", platform.String(plat))
+
+	layers, err := rebased.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+	for i, layer := range layers {
+		diffID, err := layer.DiffID()
+		require.NoError(t, err)
+		assert.Equal(t, diffIDs(t, rebased)[i], diffID)
+	}
+
+	// Rebasing back gets the original layers back.
+	roundtrip, err := rebase.Rebase(rebased, newBase, oldBase)
+	require.NoError(t, err)
+	assert.Equal(t, diffIDs(t, app), diffIDs(t, roundtrip))
+	assert.Equal(t, createdBy(t, app), createdBy(t, roundtrip))
+
+	// The history may have been edited since the image was built.
+	appConfig, err := app.ConfigFile()
+	require.NoError(t, err)
+	appConfig = appConfig.DeepCopy()
+	appConfig.History = []ociv1.History{appConfig.History[0], appConfig.History[2], appConfig.History[4]}
+	edited, err := mutate.ConfigFile(app, appConfig)
+	require.NoError(t, err)
+	rebased, err = rebase.Rebase(edited, oldBase, newBase)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-1", "app-1"}, createdBy(t, rebased))
+}
+
+func TestRebaseMismatch(t *testing.T) {
+	t.Parallel()
+
+	oldBase := testImage(t, empty.Image, "", mutate.Addendum{Layer: randomLayer(t)})   //nolint:exhaustivestruct
+	otherBase := testImage(t, empty.Image, "", mutate.Addendum{Layer: randomLayer(t)}) //nolint:exhaustivestruct
+	app := testImage(t, otherBase, "", mutate.Addendum{Layer: randomLayer(t)})         //nolint:exhaustivestruct
+
+	_, err := rebase.Rebase(app, oldBase, empty.Image)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not based on the old base")
+
+	_, err = rebase.Rebase(otherBase, app, empty.Image)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not based on the old base")
+}
@@ -0,0 +1,131 @@
+// Package sarif implements enough of the Static Analysis Results Interchange Format (SARIF) 2.1.0
+// to report lint findings, so that they show up in code scanning UIs (such as GitHub's).
+//
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+package sarif
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Version and Schema are the SARIF version that this package implements.
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Levels of a Result.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelNote    = "note"
+)
+
+// A Log is a complete SARIF document.
+type Log struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []Run  `json:"runs"`
+}
+
+// A Run is the results of a single invocation of a tool.
+type Run struct {
+	Tool    Tool     `json:"tool"`
+	Results []Result `json:"results"`
+}
+
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+type Driver struct {
+	Name           string `json:"name"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Rules          []Rule `json:"rules,omitempty"`
+}
+
+type Rule struct {
+	ID string `json:"id"`
+}
+
+// A Result is a single finding.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	Level     string     `json:"level"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+}
+
+type Message struct {
+	Text string `json:"text"`
+}
+
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+}
+
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// NewLog returns a Log with a single Run (with no results yet) for the named tool.
+func NewLog(toolName, informationURI string) *Log {
+	return &Log{
+		Schema:  Schema,
+		Version: Version,
+		Runs: []Run{{
+			Tool: Tool{
+				Driver: Driver{
+					Name:           toolName,
+					InformationURI: informationURI,
+					Rules:          nil,
+				},
+			},
+			Results: []Result{},
+		}},
+	}
+}
+
+// AddResult adds a result to the Log's last Run, adding ruleID to the tool's list of rules if it
+// isn't already there.  If uri is non-empty, it is the location of the file that the result is
+// about.
+func (l *Log) AddResult(ruleID, level, message, uri string) {
+	run := &l.Runs[len(l.Runs)-1]
+	haveRule := false
+	for _, rule := range run.Tool.Driver.Rules {
+		if rule.ID == ruleID {
+			haveRule = true
+			break
+		}
+	}
+	if !haveRule {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, Rule{ID: ruleID})
+	}
+	result := Result{
+		RuleID:    ruleID,
+		Level:     level,
+		Message:   Message{Text: message},
+		Locations: nil,
+	}
+	if uri != "" {
+		result.Locations = []Location{{
+			PhysicalLocation: PhysicalLocation{
+				ArtifactLocation: ArtifactLocation{URI: uri},
+			},
+		}}
+	}
+	run.Results = append(run.Results, result)
+}
+
+// Write writes the Log as indented JSON.
+func (l *Log) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(l)
+}
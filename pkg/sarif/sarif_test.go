@@ -0,0 +1,52 @@
+package sarif_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/sarif"
+)
+
+func TestLog(t *testing.T) {
+	t.Parallel()
+	log := sarif.NewLog("ocibuild", "https://github.com/datawire/ocibuild")
+	log.AddResult("record", sarif.LevelError, "foo.py: hash mismatch", "dist/foo-1.0-py3-none-any.whl")
+	log.AddResult("record", sarif.LevelWarning, "bar.py: not in RECORD", "dist/foo-1.0-py3-none-any.whl")
+	log.AddResult("version", sarif.LevelWarning, "not normalized", "")
+
+	var buf bytes.Buffer
+	require.NoError(t, log.Write(&buf))
+	assert.JSONEq(t, `{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": [{
+			"tool": {"driver": {
+				"name": "ocibuild",
+				"informationUri": "https://github.com/datawire/ocibuild",
+				"rules": [{"id": "record"}, {"id": "version"}]
+			}},
+			"results": [
+				{
+					"ruleId": "record",
+					"level": "error",
+					"message": {"text": "foo.py: hash mismatch"},
+					"locations": [{"physicalLocation": {"artifactLocation": {"uri": "dist/foo-1.0-py3-none-any.whl"}}}]
+				},
+				{
+					"ruleId": "record",
+					"level": "warning",
+					"message": {"text": "bar.py: not in RECORD"},
+					"locations": [{"physicalLocation": {"artifactLocation": {"uri": "dist/foo-1.0-py3-none-any.whl"}}}]
+				},
+				{
+					"ruleId": "version",
+					"level": "warning",
+					"message": {"text": "not normalized"}
+				}
+			]
+		}]
+	}`, buf.String())
+}
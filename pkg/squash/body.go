@@ -0,0 +1,256 @@
+// body.go implements lazy references to file content in layers, so that squashing doesn't need to
+// hold the content of every file in memory at once.
+
+package squash
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// A layerSource is a layer that file content is read from on demand.
+type layerSource struct {
+	layer ociv1.Layer
+
+	// shared is used by reads through the io/fs.FS interface; reads that generate an output
+	// layer use their own cursors (from a cursorSet), so that multiple readers of the output
+	// layer may run at once.
+	sharedMu sync.Mutex
+	shared   *layerCursor
+}
+
+// A fileBody is a reference to the content of a file in a layer (or, if src is nil, content that is
+// held in memory).  A nil *fileBody is empty.
+type fileBody struct {
+	src    *layerSource
+	index  int // the number of tar entries before this one in the layer
+	data   []byte
+	size   int64
+	digest [sha256.Size]byte
+}
+
+// newMemBody returns a fileBody for content that is held in memory.
+func newMemBody(data []byte) *fileBody {
+	return &fileBody{ //nolint:exhaustivestruct
+		data:   data,
+		size:   int64(len(data)),
+		digest: sha256.Sum256(data),
+	}
+}
+
+// Size returns the length of the content.
+func (b *fileBody) Size() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.size
+}
+
+// sameBody returns whether two bodies have the same content, without reading either of them.
+func sameBody(a, b *fileBody) bool {
+	if a == nil || b == nil {
+		return a.Size() == 0 && b.Size() == 0
+	}
+	return a.size == b.size && a.digest == b.digest
+}
+
+// ReadAll reads the content in to memory.
+func (b *fileBody) ReadAll() ([]byte, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if b.src == nil {
+		return b.data, nil
+	}
+	b.src.sharedMu.Lock()
+	defer b.src.sharedMu.Unlock()
+	if b.src.shared == nil {
+		b.src.shared = &layerCursor{layer: b.src.layer} //nolint:exhaustivestruct
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(b.size))
+	if err := b.src.shared.copyEntry(&buf, b); err != nil {
+		// Don't leave the cursor in an unknown state.
+		_ = b.src.shared.Close()
+		b.src.shared = nil
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Limits on how much content a layerCursor keeps from the entries that it skips over.
+const (
+	maxSkippedEntrySize = 256 * 1024
+	maxSkippedTotalSize = 32 * 1024 * 1024
+)
+
+// A layerCursor is a position within the uncompressed stream of a layer.  Reading entries in the
+// order that they appear in the layer is linear.  Reading an entry that is before the current
+// position is free if it is small, since the content of small entries that are skipped over is
+// kept (up to a limit) in case it is wanted later; otherwise it requires re-reading the layer from
+// the beginning.
+type layerCursor struct {
+	layer ociv1.Layer
+
+	readCloser io.ReadCloser
+	tarReader  *tar.Reader
+	pos        int // the number of entries that tarReader.Next() has returned
+
+	skipped     map[int][]byte // entry index => content
+	skippedSize int64
+}
+
+// copyEntry writes the content of the body (which must be from the cursor's layer) to dst.
+func (c *layerCursor) copyEntry(dst io.Writer, body *fileBody) error {
+	if content, ok := c.skipped[body.index]; ok {
+		delete(c.skipped, body.index)
+		c.skippedSize -= int64(len(content))
+		return verifyCopy(dst, bytes.NewReader(content), body)
+	}
+	if c.tarReader == nil || body.index < c.pos {
+		if err := c.reopen(); err != nil {
+			return err
+		}
+	}
+	for c.pos <= body.index {
+		header, err := c.tarReader.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("reading tar: %w", err)
+		}
+		c.pos++
+		if c.pos <= body.index {
+			if err := c.skip(c.pos-1, header); err != nil {
+				return err
+			}
+		}
+	}
+	return verifyCopy(dst, c.tarReader, body)
+}
+
+// reopen starts reading the layer from the beginning again.
+func (c *layerCursor) reopen() error {
+	if c.readCloser != nil {
+		if err := c.readCloser.Close(); err != nil {
+			return err
+		}
+	}
+	readCloser, err := c.layer.Uncompressed()
+	if err != nil {
+		return fmt.Errorf("reading layer contents: %w", err)
+	}
+	c.readCloser = readCloser
+	c.tarReader = tar.NewReader(readCloser)
+	c.pos = 0
+	return nil
+}
+
+// skip keeps the content of the current entry (the index'th), if it is small and there is room.
+func (c *layerCursor) skip(index int, header *tar.Header) error {
+	if _, have := c.skipped[index]; have || header.Size <= 0 || header.Size > maxSkippedEntrySize ||
+		c.skippedSize+header.Size > maxSkippedTotalSize {
+		return nil
+	}
+	content, err := io.ReadAll(c.tarReader)
+	if err != nil {
+		return fmt.Errorf("reading tar: %w", err)
+	}
+	if c.skipped == nil {
+		c.skipped = make(map[int][]byte)
+	}
+	c.skipped[index] = content
+	c.skippedSize += int64(len(content))
+	return nil
+}
+
+// verifyCopy copies the content of the body from src to dst, checking that it is what was
+// originally read from the layer.
+func verifyCopy(dst io.Writer, src io.Reader, body *fileBody) error {
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(dst, hasher), src)
+	if err != nil {
+		return fmt.Errorf("reading tar: %w", err)
+	}
+	var digest [sha256.Size]byte
+	copy(digest[:], hasher.Sum(nil))
+	if n != body.size || digest != body.digest {
+		return fmt.Errorf("layer content changed since it was first read (entry %d)", body.index)
+	}
+	return nil
+}
+
+// Close releases the cursor's reader and any content that it has kept; the cursor may still be
+// used after it is closed.
+func (c *layerCursor) Close() error {
+	c.skipped = nil
+	c.skippedSize = 0
+	if c.readCloser == nil {
+		return nil
+	}
+	err := c.readCloser.Close()
+	c.readCloser = nil
+	c.tarReader = nil
+	return err
+}
+
+// A cursorSet is a set of cursors, one per layer, for a single pass of writing an output layer.
+type cursorSet map[*layerSource]*layerCursor
+
+// copyBody writes the content of the body to dst.
+func (cs cursorSet) copyBody(dst io.Writer, body *fileBody) error {
+	if body == nil {
+		return nil
+	}
+	if body.src == nil {
+		_, err := dst.Write(body.data)
+		return err
+	}
+	cursor, ok := cs[body.src]
+	if !ok {
+		cursor = &layerCursor{layer: body.src.layer} //nolint:exhaustivestruct
+		cs[body.src] = cursor
+	}
+	return cursor.copyEntry(dst, body)
+}
+
+// Close closes all of the cursors in the set.
+func (cs cursorSet) Close() error {
+	var ret error
+	for _, cursor := range cs {
+		if err := cursor.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// streamOpener returns a function that calls write with a fresh cursorSet to generate a tarball
+// each time that it is called, streaming the output through a pipe rather than buffering it in
+// memory.  It is suitable for passing to ociv1tarball.LayerFromOpener.
+func streamOpener(write func(*tar.Writer, cursorSet) error) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		pipeReader, pipeWriter := io.Pipe()
+		go func() {
+			cursors := make(cursorSet)
+			tarWriter := tar.NewWriter(pipeWriter)
+			err := write(tarWriter, cursors)
+			if err == nil {
+				err = tarWriter.Close()
+			}
+			if closeErr := cursors.Close(); err == nil {
+				err = closeErr
+			}
+			_ = pipeWriter.CloseWithError(err)
+		}()
+		return pipeReader, nil
+	}
+}
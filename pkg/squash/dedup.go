@@ -0,0 +1,116 @@
+package squash
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+// A Deduplicator removes files from layers that are identical to the files that are already present
+// in the layers below them.
+type Deduplicator struct {
+	root *fsfile
+}
+
+// NewDeduplicator returns a Deduplicator for layers that are to be stacked on top of base.
+func NewDeduplicator(base []ociv1.Layer) (*Deduplicator, error) {
+	root, err := loadLayers(base, false, fsutil.SpecialFilesPreserve)
+	if err != nil {
+		return nil, fmt.Errorf("squash.NewDeduplicator: %w", err)
+	}
+	return &Deduplicator{root: root}, nil
+}
+
+// sameFile returns whether the file described by the header and body would be indistinguishable
+// from the existing file (including extended attributes, such as file capabilities); modification
+// times and symbolic user and group names are not considered.
+func (f *fsfile) sameFile(hdr *tar.Header, body *fileBody) bool {
+	if f.header == nil {
+		return false
+	}
+	return f.header.Typeflag == hdr.Typeflag &&
+		f.header.Mode == hdr.Mode &&
+		f.header.Uid == hdr.Uid &&
+		f.header.Gid == hdr.Gid &&
+		f.header.Linkname == hdr.Linkname &&
+		f.header.Devmajor == hdr.Devmajor &&
+		f.header.Devminor == hdr.Devminor &&
+		fsutil.SameXattrs(f.header, hdr) &&
+		sameBody(f.body, body)
+}
+
+// Dedup returns a copy of layer with any files that are identical (same path, type, permissions,
+// ownership, extended attributes, and content) to those already present in the layers below it removed.  The returned
+// layer is then considered to be "below" any layers passed to subsequent calls to Dedup.
+//
+// Whiteout markers are always kept, as are files that are the target of a hardlink in the layer.
+// The second return value is the number of bytes of file content that were removed.
+func (d *Deduplicator) Dedup(layer ociv1.Layer, opts ...ociv1tarball.LayerOption) (ociv1.Layer, int64, error) {
+	lfs, err := parseLayer(layer, false, fsutil.SpecialFilesPreserve)
+	if err != nil {
+		return nil, 0, fmt.Errorf("squash.Deduplicator.Dedup: %w", err)
+	}
+
+	// Whiteouts in a layer apply before the files in that layer.
+	for _, wh := range lfs.WhiteoutMarkers {
+		vfsFile, err := fsGet(d.root, wh.Header.Name, true, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("squash.Deduplicator.Dedup: %w", err)
+		}
+		if err := vfsFile.Set(wh.Header, wh.Body); err != nil {
+			return nil, 0, fmt.Errorf("squash.Deduplicator.Dedup: %w", err)
+		}
+	}
+
+	linkTargets := make(map[string]struct{})
+	for _, file := range lfs.Files {
+		if file.Header.Typeflag == tar.TypeLink {
+			linkTargets[path.Clean(file.Header.Linkname)] = struct{}{}
+		}
+	}
+
+	// The entries to write to the output layer.
+	kept := append([]fileEntry(nil), lfs.WhiteoutMarkers...)
+	var saved int64
+	for _, file := range lfs.Files {
+		_, isLinkTarget := linkTargets[file.Header.Name]
+		if existing, err := fsGet(d.root, file.Header.Name, false, false); err == nil &&
+			!isLinkTarget && existing.sameFile(file.Header, file.Body) {
+			saved += file.Body.Size()
+			continue
+		}
+		vfsFile, err := fsGet(d.root, file.Header.Name, true, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("squash.Deduplicator.Dedup: %w", err)
+		}
+		if err := vfsFile.Set(file.Header, file.Body); err != nil {
+			return nil, 0, fmt.Errorf("squash.Deduplicator.Dedup: %w", err)
+		}
+		kept = append(kept, file)
+	}
+
+	ret, err := ociv1tarball.LayerFromOpener(streamOpener(func(tarWriter *tar.Writer, cursors cursorSet) error {
+		for _, entry := range kept {
+			hdr := *entry.Header // shallow copy
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Name += "/"
+			}
+			if err := tarWriter.WriteHeader(&hdr); err != nil {
+				return err
+			}
+			if err := cursors.copyBody(tarWriter, entry.Body); err != nil {
+				return err
+			}
+		}
+		return nil
+	}), opts...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("squash.Deduplicator.Dedup: %w", err)
+	}
+	return ret, saved, nil
+}
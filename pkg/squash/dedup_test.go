@@ -0,0 +1,88 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+type contentFile struct {
+	Name    string
+	Type    byte
+	Mode    int64
+	Content string
+}
+
+func contentLayer(t *testing.T, files ...contentFile) ociv1.Layer {
+	t.Helper()
+	var byteWriter bytes.Buffer
+	tarWriter := tar.NewWriter(&byteWriter)
+	for _, file := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Name:     file.Name,
+			Typeflag: file.Type,
+			Mode:     file.Mode,
+			Size:     int64(len(file.Content)),
+		}))
+		_, err := io.WriteString(tarWriter, file.Content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	byteSlice := byteWriter.Bytes()
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(byteSlice)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func TestDedup(t *testing.T) {
+	t.Parallel()
+	base := contentLayer(t,
+		contentFile{"dir/", tar.TypeDir, 0o755, ""},
+		contentFile{"dir/same", tar.TypeReg, 0o644, "same"},
+		contentFile{"dir/content", tar.TypeReg, 0o644, "old"},
+		contentFile{"dir/mode", tar.TypeReg, 0o644, "mode"},
+		contentFile{"dir/whiteout", tar.TypeReg, 0o644, "wh"},
+	)
+	deduplicator, err := squash.NewDeduplicator([]ociv1.Layer{base})
+	require.NoError(t, err)
+
+	layer, saved, err := deduplicator.Dedup(contentLayer(t,
+		contentFile{"dir/", tar.TypeDir, 0o755, ""},
+		contentFile{"dir/same", tar.TypeReg, 0o644, "same"},
+		contentFile{"dir/content", tar.TypeReg, 0o644, "new"},
+		contentFile{"dir/mode", tar.TypeReg, 0o755, "mode"},
+		contentFile{"dir/.wh.whiteout", tar.TypeReg, 0o644, ""},
+		contentFile{"dir/whiteout", tar.TypeReg, 0o644, "wh"},
+		contentFile{"dir/added", tar.TypeReg, 0o644, "added"},
+	))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("same")), saved)
+	assert.Equal(t, TestLayer{
+		{Name: "dir/.wh.whiteout", Type: tar.TypeReg},
+		{Name: "dir/content", Type: tar.TypeReg},
+		{Name: "dir/mode", Type: tar.TypeReg},
+		{Name: "dir/whiteout", Type: tar.TypeReg},
+		{Name: "dir/added", Type: tar.TypeReg},
+	}, ParseTestLayer(t, layer))
+
+	// The output of the first call is considered by the second call.
+	layer, saved, err = deduplicator.Dedup(contentLayer(t,
+		contentFile{"dir/added", tar.TypeReg, 0o644, "added"},
+		contentFile{"dir/content", tar.TypeReg, 0o644, "old"},
+	))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("added")), saved)
+	assert.Equal(t, TestLayer{
+		{Name: "dir/content", Type: tar.TypeReg},
+	}, ParseTestLayer(t, layer))
+}
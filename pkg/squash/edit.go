@@ -0,0 +1,171 @@
+package squash
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/tarnorm"
+)
+
+// An Editor is a mutable view of several layers squashed together.  Files may be added, replaced,
+// and removed, and then the result written out either as a complete squashed layer (Squashed) or as
+// a layer containing only the changes (Delta), to be stacked on top of the original layers.
+//
+// An Editor implements io/fs.FS, reflecting the edits made so far.
+type Editor struct {
+	merged *fsfile // the original layers, plus the edits
+	delta  *fsfile // just the edits
+}
+
+var _ fs.FS = (*Editor)(nil)
+
+func newRoot() *fsfile {
+	root := &fsfile{ //nolint:exhaustivestruct
+		name: ".",
+	}
+	root.parent = root
+	return root
+}
+
+// NewEditor returns an Editor for the given layers (which may be empty, to build a layer from
+// scratch).  Character devices, block devices, and FIFOs in the layers are handled according to the
+// special policy.
+//
+// As with Squash, file content from the layers is not held in memory, so the layers must remain
+// readable for as long as the Editor or any layer returned from it is in use.
+func NewEditor(layers []ociv1.Layer, special fsutil.SpecialFilePolicy) (*Editor, error) {
+	merged, err := loadLayers(layers, false, special)
+	if err != nil {
+		return nil, fmt.Errorf("squash.NewEditor: %w", err)
+	}
+	return &Editor{
+		merged: merged,
+		delta:  newRoot(),
+	}, nil
+}
+
+// Open implements io/fs.FS.
+func (e *Editor) Open(name string) (fs.File, error) {
+	return e.merged.Open(name)
+}
+
+func cleanEditName(op, name string) (string, error) {
+	// Unlike in a layer, an absolute name is fine here; it's relative to the image root.
+	cleanName, err := tarnorm.CleanName(strings.TrimLeft(name, "/"), tarnorm.Lax)
+	if err != nil {
+		return "", fmt.Errorf("squash.Editor.%s: %w", op, err)
+	}
+	if strings.HasPrefix(path.Base(cleanName), ".wh.") {
+		return "", fmt.Errorf("squash.Editor.%s: file name is reserved for whiteouts: %q", op, name)
+	}
+	return cleanName, nil
+}
+
+// Add adds a file, replacing any existing file of the same name.  The header's Name is the path of
+// the file; for a regular file, the header's Size is set from the length of content, and for other
+// types of file, content must be empty.  Parent directories are not created automatically; add
+// them first if they need specific permissions.
+func (e *Editor) Add(hdr *tar.Header, content []byte) error {
+	name, err := cleanEditName("Add", hdr.Name)
+	if err != nil {
+		return err
+	}
+	_hdr := *hdr // shallow copy
+	hdr = &_hdr
+	hdr.Name = name
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA: //nolint:staticcheck // TypeRegA is deprecated, but may still be read
+		hdr.Size = int64(len(content))
+	default:
+		if len(content) > 0 {
+			return fmt.Errorf("squash.Editor.Add: %q: only regular files may have content", name)
+		}
+		hdr.Size = 0
+	}
+	body := newMemBody(content)
+
+	// Replacing a removed directory with a new directory must not let the contents of the
+	// old directory show through in the delta layer.
+	deltaDir, err := fsGet(e.delta, path.Dir(name), true, false)
+	if err != nil {
+		return fmt.Errorf("squash.Editor.Add: %w", err)
+	}
+	_, wasRemoved := deltaDir.children[".wh."+path.Base(name)]
+
+	for _, root := range []*fsfile{e.merged, e.delta} {
+		file, err := fsGet(root, name, true, false)
+		if err != nil {
+			return fmt.Errorf("squash.Editor.Add: %w", err)
+		}
+		if err := file.Set(hdr, body); err != nil {
+			return fmt.Errorf("squash.Editor.Add: %w", err)
+		}
+	}
+
+	if wasRemoved && hdr.Typeflag == tar.TypeDir {
+		if err := e.whiteout(path.Join(name, ".wh..wh..opq")); err != nil {
+			return fmt.Errorf("squash.Editor.Add: %w", err)
+		}
+	}
+	return nil
+}
+
+// Remove removes a file (and, if it is a directory, everything in it).  It is an error if the file
+// doesn't exist.
+func (e *Editor) Remove(name string) error {
+	name, err := cleanEditName("Remove", name)
+	if err != nil {
+		return err
+	}
+	if _, err := fsGet(e.merged, name, false, false); err != nil {
+		return fmt.Errorf("squash.Editor.Remove: %w", err)
+	}
+	if err := e.whiteout(path.Join(path.Dir(name), ".wh."+path.Base(name))); err != nil {
+		return fmt.Errorf("squash.Editor.Remove: %w", err)
+	}
+	return nil
+}
+
+func (e *Editor) whiteout(name string) error {
+	for _, root := range []*fsfile{e.merged, e.delta} {
+		file, err := fsGet(root, name, true, false)
+		if err != nil {
+			return err
+		}
+		if err := file.Set(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Squashed returns a single layer containing the original layers with the edits applied, as if
+// by Squash.  Later edits do not affect the returned layer.
+func (e *Editor) Squashed(opts ...ociv1tarball.LayerOption) (ociv1.Layer, error) {
+	layer, err := ociv1tarball.LayerFromOpener(streamOpener(e.merged.clone(nil).WriteTo), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("squash.Editor.Squashed: %w", err)
+	}
+	return layer, nil
+}
+
+// Delta returns a layer containing only the edits, with whiteout markers for removed files; stacking
+// it on top of the original layers gives the same result as Squashed.  Later edits do not affect the
+// returned layer.
+func (e *Editor) Delta(opts ...ociv1tarball.LayerOption) (ociv1.Layer, error) {
+	layer, err := ociv1tarball.LayerFromOpener(streamOpener(e.delta.clone(nil).WriteTo), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("squash.Editor.Delta: %w", err)
+	}
+	return layer, nil
+}
@@ -0,0 +1,83 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"io/fs"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func TestEditor(t *testing.T) {
+	t.Parallel()
+	base := linkLayer(t,
+		linkFile{Name: "etc", Type: tar.TypeDir},
+		linkFile{Name: "etc/motd", Type: tar.TypeReg, Content: "hello"},
+		linkFile{Name: "etc/passwd", Type: tar.TypeReg, Content: "root:x:0:0::/root:/bin/sh"},
+		linkFile{Name: "var", Type: tar.TypeDir},
+		linkFile{Name: "var/cache", Type: tar.TypeDir},
+		linkFile{Name: "var/cache/junk", Type: tar.TypeReg, Content: "junk"},
+		linkFile{Name: "var/log", Type: tar.TypeDir},
+		linkFile{Name: "var/log/messages", Type: tar.TypeReg, Content: "log"},
+	)
+	editor, err := squash.NewEditor([]ociv1.Layer{base}, fsutil.SpecialFilesPreserve)
+	require.NoError(t, err)
+
+	require.NoError(t, editor.Add(&tar.Header{Name: "etc/motd", Typeflag: tar.TypeReg, Mode: 0o644},
+		[]byte("goodbye")))
+	require.NoError(t, editor.Add(&tar.Header{Name: "/usr/bin/app", Typeflag: tar.TypeReg, Mode: 0o755},
+		[]byte("#!/bin/sh\n")))
+	require.NoError(t, editor.Remove("var/cache"))
+	require.NoError(t, editor.Remove("var/log"))
+	require.NoError(t, editor.Add(&tar.Header{Name: "var/log", Typeflag: tar.TypeDir, Mode: 0o755}, nil))
+
+	assert.Error(t, editor.Remove("nonexistent"))
+	assert.Error(t, editor.Add(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg}, nil))
+	assert.Error(t, editor.Add(&tar.Header{Name: "etc/.wh.passwd", Typeflag: tar.TypeReg}, nil))
+	assert.Error(t, editor.Add(&tar.Header{Name: "etc/link", Typeflag: tar.TypeSymlink}, []byte("x")))
+
+	// The edits are visible through the io/fs.FS interface.
+	content, err := fs.ReadFile(editor, "etc/motd")
+	require.NoError(t, err)
+	assert.Equal(t, "goodbye", string(content))
+	_, err = fs.Stat(editor, "var/cache/junk")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	delta, err := editor.Delta()
+	require.NoError(t, err)
+	assert.Equal(t, []linkFile{
+		{Name: "etc/motd", Type: tar.TypeReg, Content: "goodbye"},
+		{Name: "usr/bin/app", Type: tar.TypeReg, Content: "#!/bin/sh\n"},
+		{Name: "var/.wh.cache", Type: tar.TypeReg},
+		{Name: "var/log/", Type: tar.TypeDir},
+		{Name: "var/log/.wh..wh..opq", Type: tar.TypeReg},
+	}, parseLinkLayer(t, delta))
+
+	squashed, err := editor.Squashed()
+	require.NoError(t, err)
+	expected := []linkFile{
+		{Name: "etc/", Type: tar.TypeDir},
+		{Name: "etc/motd", Type: tar.TypeReg, Content: "goodbye"},
+		{Name: "etc/passwd", Type: tar.TypeReg, Content: "root:x:0:0::/root:/bin/sh"},
+		{Name: "usr/bin/app", Type: tar.TypeReg, Content: "#!/bin/sh\n"},
+		{Name: "var/", Type: tar.TypeDir},
+		{Name: "var/.wh.cache", Type: tar.TypeReg},
+		{Name: "var/log/", Type: tar.TypeDir},
+		{Name: "var/log/.wh..wh..opq", Type: tar.TypeReg},
+	}
+	assert.Equal(t, expected, parseLinkLayer(t, squashed))
+
+	// Stacking the delta on the original gives the same result.
+	stacked, err := squash.Squash([]ociv1.Layer{base, delta})
+	require.NoError(t, err)
+	assert.Equal(t, expected, parseLinkLayer(t, stacked))
+
+	// Later edits don't affect layers that have already been returned.
+	require.NoError(t, editor.Remove("etc/passwd"))
+	assert.Equal(t, expected, parseLinkLayer(t, squashed))
+}
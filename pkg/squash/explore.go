@@ -0,0 +1,169 @@
+package squash
+
+import (
+	"archive/tar"
+	"path"
+	"sort"
+	"strings"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+// A Node is a path in the squashed filesystem of a stack of layers, annotated with which layer it
+// came from; see Explore.
+type Node struct {
+	// Name is the full name of the path, such as "usr/bin/python3"; or "." for the root.
+	Name string
+	// Header is the tar header of the path in the layer that it came from, or nil for a
+	// directory that no layer has an entry for.
+	Header *tar.Header
+	// Layer is the index of the last layer that added or changed this path (for a directory,
+	// that includes removing something from the directory), or -1 if no layer did.
+	Layer int
+	// Size is the size of the file; or for a directory, the total size of all of the files
+	// under it.
+	Size int64
+	// Children are the entries in a directory, sorted by name.
+	Children []*Node
+}
+
+// ChangeKind is the kind of a Change.
+type ChangeKind string
+
+const (
+	ChangeAdd    ChangeKind = "add"
+	ChangeModify ChangeKind = "modify"
+	ChangeRemove ChangeKind = "remove"
+)
+
+// A Change is a path that a layer adds, modifies (replaces), or removes (whites out).
+type Change struct {
+	Name string
+	Kind ChangeKind
+	// Size is the size of the file in this layer; or for a removal, the size of what was
+	// removed (for a directory, including everything under it).
+	Size int64
+}
+
+// Explore loads layers like Load does, but rather than returning a filesystem, it returns the tree
+// of the squashed filesystem annotated with which layer each path came from, as well as the list
+// of changes that each layer makes (in the order that the layer makes them).  File content is not
+// read.
+func Explore(layers []ociv1.Layer) (*Node, [][]Change, error) {
+	root := &fsfile{ //nolint:exhaustivestruct
+		name: ".",
+	}
+	root.parent = root
+	lastLayer := make(map[string]int)
+	changes := make([][]Change, len(layers))
+
+	lookup := func(name string) *fsfile {
+		file, err := fsGet(root, name, false, false)
+		if err != nil || file == nil || strings.HasPrefix(path.Base(file.name), ".wh.") {
+			return nil
+		}
+		return file
+	}
+
+	for i, layer := range layers {
+		layerFS, err := parseLayer(layer, true, fsutil.SpecialFilesPreserve)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, wh := range layerFS.WhiteoutMarkers {
+			dir, base := path.Split(wh.Header.Name)
+			dir = path.Clean(dir)
+			var removed []string
+			if base == ".wh..wh..opq" {
+				if parent := lookup(dir); parent != nil {
+					for _, child := range sortedChildren(parent) {
+						removed = append(removed, child.name)
+					}
+				}
+			} else if target := lookup(path.Join(dir, strings.TrimPrefix(base, ".wh."))); target != nil {
+				removed = append(removed, target.name)
+			}
+			for _, name := range removed {
+				changes[i] = append(changes[i], Change{
+					Name: name,
+					Kind: ChangeRemove,
+					Size: newNode(lookup(name), nil).Size,
+				})
+			}
+
+			vfsFile, err := fsGet(root, wh.Header.Name, true, false)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := vfsFile.Set(wh.Header, wh.Body); err != nil {
+				return nil, nil, err
+			}
+			lastLayer[dir] = i
+		}
+		for _, file := range layerFS.Files {
+			kind := ChangeAdd
+			if existing := lookup(file.Header.Name); existing != nil && existing.header != nil {
+				kind = ChangeModify
+			}
+			changes[i] = append(changes[i], Change{
+				Name: file.Header.Name,
+				Kind: kind,
+				Size: file.Header.Size,
+			})
+
+			vfsFile, err := fsGet(root, file.Header.Name, true, false)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := vfsFile.Set(file.Header, file.Body); err != nil {
+				return nil, nil, err
+			}
+			lastLayer[file.Header.Name] = i
+		}
+	}
+
+	return newNode(root, lastLayer), changes, nil
+}
+
+// sortedChildren returns the children of a directory (excluding whiteout markers), sorted by name.
+func sortedChildren(dir *fsfile) []*fsfile {
+	ret := make([]*fsfile, 0, len(dir.children))
+	for name, child := range dir.children {
+		if strings.HasPrefix(name, ".wh.") {
+			continue
+		}
+		ret = append(ret, child)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].name < ret[j].name
+	})
+	return ret
+}
+
+// newNode returns the Node for the tree rooted at file.  If lastLayer is nil, then the Layers of
+// the returned Nodes are all -1.
+func newNode(file *fsfile, lastLayer map[string]int) *Node {
+	if file == nil {
+		return &Node{Layer: -1} //nolint:exhaustivestruct
+	}
+	ret := &Node{ //nolint:exhaustivestruct
+		Name:   file.name,
+		Header: file.header,
+		Layer:  -1,
+	}
+	if layer, ok := lastLayer[file.name]; ok {
+		ret.Layer = layer
+	}
+	if file.header != nil && file.header.Typeflag != tar.TypeDir {
+		ret.Size = file.header.Size
+		return ret
+	}
+	for _, child := range sortedChildren(file) {
+		childNode := newNode(child, lastLayer)
+		ret.Size += childNode.Size
+		ret.Children = append(ret.Children, childNode)
+	}
+	return ret
+}
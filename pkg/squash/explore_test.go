@@ -0,0 +1,70 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func TestExplore(t *testing.T) {
+	t.Parallel()
+	layers := []ociv1.Layer{
+		TestLayer{
+			{Name: "etc", Type: tar.TypeDir},
+			{Name: "etc/passwd", Type: tar.TypeReg},
+			{Name: "etc/shadow", Type: tar.TypeReg},
+			{Name: "opt/app", Type: tar.TypeDir},
+			{Name: "opt/app/old", Type: tar.TypeReg},
+		}.ToLayer(t),
+		TestLayer{
+			{Name: "etc/.wh.shadow", Type: tar.TypeReg},
+			{Name: "etc/passwd", Type: tar.TypeReg},
+			{Name: "opt/app/.wh..wh..opq", Type: tar.TypeReg},
+			{Name: "opt/app/new", Type: tar.TypeReg},
+		}.ToLayer(t),
+	}
+
+	root, changes, err := squash.Explore(layers)
+	require.NoError(t, err)
+
+	type flatNode struct {
+		Name  string
+		Layer int
+	}
+	var flatten func(*squash.Node) []flatNode
+	flatten = func(node *squash.Node) []flatNode {
+		ret := []flatNode{{node.Name, node.Layer}}
+		for _, child := range node.Children {
+			ret = append(ret, flatten(child)...)
+		}
+		return ret
+	}
+	assert.Equal(t, []flatNode{
+		{".", -1},
+		{"etc", 1},
+		{"etc/passwd", 1},
+		{"opt", -1},
+		{"opt/app", 1},
+		{"opt/app/new", 1},
+	}, flatten(root))
+
+	require.Len(t, changes, 2)
+	assert.Equal(t, []squash.Change{
+		{Name: "etc", Kind: squash.ChangeAdd},
+		{Name: "etc/passwd", Kind: squash.ChangeAdd},
+		{Name: "etc/shadow", Kind: squash.ChangeAdd},
+		{Name: "opt/app", Kind: squash.ChangeAdd},
+		{Name: "opt/app/old", Kind: squash.ChangeAdd},
+	}, changes[0])
+	assert.Equal(t, []squash.Change{
+		{Name: "etc/shadow", Kind: squash.ChangeRemove},
+		{Name: "opt/app/old", Kind: squash.ChangeRemove},
+		{Name: "etc/passwd", Kind: squash.ChangeModify},
+		{Name: "opt/app/new", Kind: squash.ChangeAdd},
+	}, changes[1])
+}
@@ -0,0 +1,164 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+type linkFile struct {
+	Name     string
+	Type     byte
+	Linkname string
+	Content  string
+}
+
+func linkLayer(t *testing.T, files ...linkFile) ociv1.Layer {
+	t.Helper()
+	var byteWriter bytes.Buffer
+	tarWriter := tar.NewWriter(&byteWriter)
+	for _, file := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Name:     file.Name,
+			Typeflag: file.Type,
+			Linkname: file.Linkname,
+			Mode:     0o644,
+			Size:     int64(len(file.Content)),
+		}))
+		_, err := io.WriteString(tarWriter, file.Content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	byteSlice := byteWriter.Bytes()
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(byteSlice)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func parseLinkLayer(t *testing.T, layer ociv1.Layer) []linkFile {
+	t.Helper()
+	layerReader, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer layerReader.Close()
+	var ret []linkFile
+	tarReader := tar.NewReader(layerReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		ret = append(ret, linkFile{
+			Name:     header.Name,
+			Type:     header.Typeflag,
+			Linkname: header.Linkname,
+			Content:  string(content),
+		})
+	}
+	return ret
+}
+
+func TestSquashHardlinks(t *testing.T) {
+	t.Parallel()
+	type testcase struct {
+		Input  [][]linkFile
+		Output []linkFile
+	}
+	testcases := map[string]testcase{
+		"link-sorts-before-target": {
+			Input: [][]linkFile{{
+				{Name: "z", Type: tar.TypeReg, Content: "data"},
+				{Name: "a", Type: tar.TypeLink, Linkname: "z"},
+			}},
+			Output: []linkFile{
+				{Name: "a", Type: tar.TypeReg, Content: "data"},
+				{Name: "z", Type: tar.TypeLink, Linkname: "a"},
+			},
+		},
+		"link-to-lower-layer": {
+			Input: [][]linkFile{
+				{{Name: "target", Type: tar.TypeReg, Content: "data"}},
+				{{Name: "x/link", Type: tar.TypeLink, Linkname: "target"}},
+			},
+			Output: []linkFile{
+				{Name: "target", Type: tar.TypeReg, Content: "data"},
+				{Name: "x/link", Type: tar.TypeLink, Linkname: "target"},
+			},
+		},
+		"target-whited-out": {
+			Input: [][]linkFile{
+				{
+					{Name: "target", Type: tar.TypeReg, Content: "data"},
+					{Name: "link1", Type: tar.TypeLink, Linkname: "target"},
+					{Name: "link2", Type: tar.TypeLink, Linkname: "target"},
+				},
+				{{Name: ".wh.target", Type: tar.TypeReg}},
+			},
+			Output: []linkFile{
+				{Name: ".wh.target", Type: tar.TypeReg},
+				{Name: "link1", Type: tar.TypeReg, Content: "data"},
+				{Name: "link2", Type: tar.TypeLink, Linkname: "link1"},
+			},
+		},
+		"target-replaced": {
+			Input: [][]linkFile{
+				{
+					{Name: "target", Type: tar.TypeReg, Content: "old"},
+					{Name: "link", Type: tar.TypeLink, Linkname: "target"},
+				},
+				{{Name: "target", Type: tar.TypeReg, Content: "new"}},
+			},
+			Output: []linkFile{
+				{Name: "link", Type: tar.TypeReg, Content: "old"},
+				{Name: "target", Type: tar.TypeReg, Content: "new"},
+			},
+		},
+		"link-replaced": {
+			Input: [][]linkFile{
+				{
+					{Name: "target", Type: tar.TypeReg, Content: "data"},
+					{Name: "link", Type: tar.TypeLink, Linkname: "target"},
+				},
+				{{Name: "link", Type: tar.TypeReg, Content: "other"}},
+			},
+			Output: []linkFile{
+				{Name: "link", Type: tar.TypeReg, Content: "other"},
+				{Name: "target", Type: tar.TypeReg, Content: "data"},
+			},
+		},
+		"target-not-loaded": {
+			Input: [][]linkFile{{
+				{Name: "link", Type: tar.TypeLink, Linkname: "elsewhere"},
+			}},
+			Output: []linkFile{
+				{Name: "link", Type: tar.TypeLink, Linkname: "elsewhere"},
+			},
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			layers := make([]ociv1.Layer, 0, len(tcData.Input))
+			for _, files := range tcData.Input {
+				layers = append(layers, linkLayer(t, files...))
+			}
+			squashed, err := squash.Squash(layers)
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Output, parseLinkLayer(t, squashed))
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package squash
+
+import (
+	"fmt"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+// Image squashes all of the layers of an image together, returning an image with a single layer
+// and the same config (other than the rootfs and history, which are replaced to describe the single
+// layer).
+//
+// The layers are obtained from the image with img.Layers() and are only read as needed, so a
+// remote-backed image (such as one from github.com/google/go-containerregistry/pkg/v1/remote) is
+// streamed rather than being extracted locally first.  As with Squash, the returned image reads
+// from img whenever its layer is read.
+func Image(
+	img ociv1.Image,
+	special fsutil.SpecialFilePolicy,
+	opts ...ociv1tarball.LayerOption,
+) (ociv1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("squash.Image: %w", err)
+	}
+	layer, err := SquashWithSpecialFiles(layers, special, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("squash.Image: %w", err)
+	}
+
+	origConfig, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("squash.Image: %w", err)
+	}
+	config := *origConfig // shallow copy
+	config.RootFS.DiffIDs = nil
+	config.History = nil
+
+	mediaType, err := img.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("squash.Image: %w", err)
+	}
+	ret, err := mutate.ConfigFile(mutate.MediaType(empty.Image, mediaType), &config)
+	if err != nil {
+		return nil, fmt.Errorf("squash.Image: %w", err)
+	}
+	ret, err = mutate.Append(ret, mutate.Addendum{ //nolint:exhaustivestruct
+		Layer: layer,
+		History: ociv1.History{ //nolint:exhaustivestruct
+			Created:   config.Created,
+			CreatedBy: "ocibuild squash",
+			Comment:   fmt.Sprintf("squashed %d layers", len(layers)),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("squash.Image: %w", err)
+	}
+	return ret, nil
+}
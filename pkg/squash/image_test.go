@@ -0,0 +1,60 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func TestImage(t *testing.T) {
+	t.Parallel()
+	img, err := mutate.AppendLayers(empty.Image,
+		linkLayer(t,
+			linkFile{Name: "etc/motd", Type: tar.TypeReg, Content: "hello"},
+			linkFile{Name: "tmp/junk", Type: tar.TypeReg, Content: "junk"},
+		),
+		linkLayer(t,
+			linkFile{Name: "tmp/.wh.junk", Type: tar.TypeReg},
+		),
+	)
+	require.NoError(t, err)
+	img, err = mutate.Config(img, ociv1.Config{ //nolint:exhaustivestruct
+		Env:        []string{"FOO=bar"},
+		Entrypoint: []string{"/bin/app"},
+	})
+	require.NoError(t, err)
+
+	squashed, err := squash.Image(img, fsutil.SpecialFilesPreserve)
+	require.NoError(t, err)
+
+	layers, err := squashed.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	assert.Equal(t, []linkFile{
+		{Name: "etc/motd", Type: tar.TypeReg, Content: "hello"},
+		{Name: "tmp/.wh.junk", Type: tar.TypeReg},
+	}, parseLinkLayer(t, layers[0]))
+
+	config, err := squashed.ConfigFile()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FOO=bar"}, config.Config.Env)
+	assert.Equal(t, []string{"/bin/app"}, config.Config.Entrypoint)
+	diffID, err := layers[0].DiffID()
+	require.NoError(t, err)
+	assert.Equal(t, []ociv1.Hash{diffID}, config.RootFS.DiffIDs)
+	require.Len(t, config.History, 1)
+	assert.Equal(t, "squashed 2 layers", config.History[0].Comment)
+
+	// The original image is unchanged.
+	origConfig, err := img.ConfigFile()
+	require.NoError(t, err)
+	assert.Len(t, origConfig.RootFS.DiffIDs, 2)
+}
@@ -0,0 +1,223 @@
+package squash
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+const opaqueWhiteout = ".wh..wh..opq"
+
+// entryReference is a fileEntry as an fsutil.FileReference.
+type entryReference struct {
+	fs.FileInfo
+	entry fileEntry
+}
+
+func newEntryReference(entry fileEntry) *entryReference {
+	return &entryReference{
+		FileInfo: entry.Header.FileInfo(),
+		entry:    entry,
+	}
+}
+
+func (ref *entryReference) FullName() string { return ref.entry.Header.Name }
+
+func (ref *entryReference) Open() (io.ReadCloser, error) {
+	content, err := ref.entry.Body.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// Merge merges multiple layers in to a single layer.  It is much like Squash, except that rather
+// than later layers always replacing what is in earlier layers, a path that more than one layer
+// has something at is handled according to the conflict policy (see fsutil.Merge); so it can be
+// used to combine layers that are expected to be disjoint, and to catch it if they aren't.
+//
+// Whiteout markers aren't subject to the policy; they are explicit removals rather than
+// conflicts.  A whiteout marker removes the file (or, for an opaque whiteout, the contents of the
+// directory) that it names from the earlier layers, as it would if the layers were stacked.  The
+// marker is kept in the merged layer, so that it still hides that file in whatever layers the
+// merged layer is stacked on top of; unless a later layer (or the same layer) puts a non-directory
+// at that path, in which case the marker is redundant and is dropped.  (If it is a directory, the
+// marker is kept so that the contents of the lower directory don't show through.)
+//
+// Hardlinks whose target isn't in the merged layer, or that would be written before their target,
+// are turned in to regular files.  Character devices, block devices, and FIFOs in the input
+// layers are handled according to the special policy.  Timestamps later than clampTime are clamped
+// to clampTime.  Unlike Squash, the content of the merged layer is held in memory.
+func Merge(
+	ctx context.Context,
+	layers []ociv1.Layer,
+	policy fsutil.ConflictPolicy,
+	special fsutil.SpecialFilePolicy,
+	clampTime time.Time,
+	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, error) {
+	sets := make([][]fileEntry, 0, len(layers))
+	for i, layer := range layers {
+		lfs, err := parseLayer(layer, false, special)
+		if err != nil {
+			return nil, fmt.Errorf("squash.Merge: layer %d: %w", i, err)
+		}
+		var set []fileEntry
+		for _, entry := range append(lfs.Files, lfs.WhiteoutMarkers...) {
+			if entry.Header.Name == "." {
+				continue
+			}
+			set = append(set, entry)
+		}
+		sets = append(sets, set)
+	}
+
+	// Keep the layers as they were, for fixHardlinks to find the targets of hardlinks in.
+	origSets := make([][]fileEntry, 0, len(sets))
+	for _, set := range sets {
+		origSets = append(origSets, append([]fileEntry(nil), set...))
+	}
+
+	// Apply each whiteout marker to the earlier layers.
+	for i, set := range sets {
+		for _, marker := range set {
+			dir, base := path.Split(marker.Header.Name)
+			dir = strings.TrimSuffix(dir, "/")
+			var hides func(name string) bool
+			switch {
+			case base == opaqueWhiteout && dir == "":
+				hides = func(string) bool { return true }
+			case base == opaqueWhiteout:
+				hides = func(name string) bool { return strings.HasPrefix(name, dir+"/") }
+			case strings.HasPrefix(base, ".wh."):
+				target := path.Join(dir, strings.TrimPrefix(base, ".wh."))
+				hides = func(name string) bool {
+					return fsutil.IsUnder(name, target) || name == marker.Header.Name
+				}
+			default:
+				continue
+			}
+			for j := 0; j < i; j++ {
+				kept := sets[j][:0]
+				for _, entry := range sets[j] {
+					if !hides(entry.Header.Name) {
+						kept = append(kept, entry)
+					}
+				}
+				sets[j] = kept
+			}
+		}
+	}
+
+	// Drop redundant whiteout markers.
+	for i, set := range sets {
+		kept := set[:0]
+	nextEntry:
+		for _, entry := range set {
+			dir, base := path.Split(entry.Header.Name)
+			if strings.HasPrefix(base, ".wh.") && base != opaqueWhiteout {
+				target := path.Join(dir, strings.TrimPrefix(base, ".wh."))
+				for _, laterSet := range sets[i:] {
+					for _, later := range laterSet {
+						if later.Header.Name == target && later.Header.Typeflag != tar.TypeDir {
+							continue nextEntry
+						}
+					}
+				}
+			}
+			kept = append(kept, entry)
+		}
+		sets[i] = kept
+	}
+
+	refSets := make([][]fsutil.FileReference, 0, len(sets))
+	for _, set := range sets {
+		refs := make([]fsutil.FileReference, 0, len(set))
+		for _, entry := range set {
+			refs = append(refs, newEntryReference(entry))
+		}
+		refSets = append(refSets, refs)
+	}
+	merged, err := fsutil.Merge(policy, refSets...)
+	if err != nil {
+		return nil, fmt.Errorf("squash.Merge: %w", err)
+	}
+
+	merged, err = fixHardlinks(merged, origSets)
+	if err != nil {
+		return nil, fmt.Errorf("squash.Merge: %w", err)
+	}
+
+	layer, err := fsutil.LayerFromFileReferencesContext(ctx, merged, clampTime, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("squash.Merge: %w", err)
+	}
+	return layer, nil
+}
+
+// fixHardlinks turns hardlinks in the merged (sorted) files in to regular files (with the content
+// of the target from the link's own layer), unless that same target is written before the link.
+func fixHardlinks(merged []fsutil.FileReference, sets [][]fileEntry) ([]fsutil.FileReference, error) {
+	// written is the regular files that will be written to the layer, by name.
+	written := make(map[string]fileEntry, len(merged))
+	for i, file := range merged {
+		ref, ok := file.(*entryReference)
+		if !ok {
+			continue
+		}
+		header := ref.entry.Header
+		if header.Typeflag == tar.TypeLink {
+			target, ok := findTarget(sets, ref.entry)
+			if !ok {
+				return nil, fmt.Errorf("hardlink %q: target %q does not exist", header.Name, header.Linkname)
+			}
+			if written, ok := written[header.Linkname]; ok && written.Header == target.Header {
+				continue
+			}
+			copied := *header
+			copied.Typeflag = tar.TypeReg
+			copied.Linkname = ""
+			copied.Size = target.Body.Size()
+			merged[i] = newEntryReference(fileEntry{Header: &copied, Body: target.Body})
+			continue
+		}
+		if header.Typeflag == tar.TypeReg {
+			written[header.Name] = ref.entry
+		}
+	}
+	return merged, nil
+}
+
+// findTarget returns the regular file that a hardlink entry refers to, from the same layer as the
+// link.
+func findTarget(sets [][]fileEntry, link fileEntry) (fileEntry, bool) {
+	for _, set := range sets {
+		var inSet bool
+		for _, entry := range set {
+			if entry.Header == link.Header {
+				inSet = true
+				break
+			}
+		}
+		if !inSet {
+			continue
+		}
+		for _, entry := range set {
+			if entry.Header.Name == link.Header.Linkname && entry.Header.Typeflag == tar.TypeReg {
+				return entry, true
+			}
+		}
+	}
+	return fileEntry{}, false //nolint:exhaustivestruct // zero value
+}
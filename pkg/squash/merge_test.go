@@ -0,0 +1,162 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"context"
+	"testing"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	type testcase struct {
+		Policy fsutil.ConflictPolicy
+		Input  [][]linkFile
+		Output []linkFile
+		Err    string
+	}
+	conflicting := [][]linkFile{
+		{{Name: "a", Type: tar.TypeReg, Content: "first"}},
+		{{Name: "a", Type: tar.TypeReg, Content: "last"}},
+	}
+	testcases := map[string]testcase{
+		"disjoint": {
+			Input: [][]linkFile{
+				{
+					{Name: "dir", Type: tar.TypeDir},
+					{Name: "dir/a", Type: tar.TypeReg, Content: "a"},
+				},
+				{
+					{Name: "dir", Type: tar.TypeDir},
+					{Name: "dir/b", Type: tar.TypeReg, Content: "b"},
+				},
+			},
+			Output: []linkFile{
+				{Name: "dir/", Type: tar.TypeDir},
+				{Name: "dir/a", Type: tar.TypeReg, Content: "a"},
+				{Name: "dir/b", Type: tar.TypeReg, Content: "b"},
+			},
+		},
+		"conflict-error": {
+			Input: conflicting,
+			Err:   "conflict",
+		},
+		"conflict-keep-first": {
+			Policy: fsutil.ConflictKeepFirst,
+			Input:  conflicting,
+			Output: []linkFile{{Name: "a", Type: tar.TypeReg, Content: "first"}},
+		},
+		"conflict-keep-last": {
+			Policy: fsutil.ConflictKeepLast,
+			Input:  conflicting,
+			Output: []linkFile{{Name: "a", Type: tar.TypeReg, Content: "last"}},
+		},
+		"whiteout-kept": {
+			Input: [][]linkFile{
+				{
+					{Name: "a", Type: tar.TypeReg, Content: "a"},
+					{Name: "b", Type: tar.TypeReg, Content: "b"},
+				},
+				{{Name: ".wh.a", Type: tar.TypeReg}},
+			},
+			Output: []linkFile{
+				{Name: ".wh.a", Type: tar.TypeReg},
+				{Name: "b", Type: tar.TypeReg, Content: "b"},
+			},
+		},
+		"whiteout-redundant": {
+			Input: [][]linkFile{
+				{{Name: ".wh.a", Type: tar.TypeReg}},
+				{{Name: "a", Type: tar.TypeReg, Content: "new"}},
+			},
+			Output: []linkFile{{Name: "a", Type: tar.TypeReg, Content: "new"}},
+		},
+		"whiteout-replaced-by-dir": {
+			Input: [][]linkFile{
+				{{Name: ".wh.a", Type: tar.TypeReg}},
+				{
+					{Name: "a", Type: tar.TypeDir},
+					{Name: "a/x", Type: tar.TypeReg, Content: "x"},
+				},
+			},
+			Output: []linkFile{
+				{Name: ".wh.a", Type: tar.TypeReg},
+				{Name: "a/", Type: tar.TypeDir},
+				{Name: "a/x", Type: tar.TypeReg, Content: "x"},
+			},
+		},
+		"opaque-whiteout": {
+			Input: [][]linkFile{
+				{
+					{Name: "dir", Type: tar.TypeDir},
+					{Name: "dir/old", Type: tar.TypeReg, Content: "old"},
+				},
+				{
+					{Name: "dir", Type: tar.TypeDir},
+					{Name: "dir/.wh..wh..opq", Type: tar.TypeReg},
+					{Name: "dir/new", Type: tar.TypeReg, Content: "new"},
+				},
+			},
+			Output: []linkFile{
+				{Name: "dir/", Type: tar.TypeDir},
+				{Name: "dir/.wh..wh..opq", Type: tar.TypeReg},
+				{Name: "dir/new", Type: tar.TypeReg, Content: "new"},
+			},
+		},
+		"hardlink-target-in-other-layer": {
+			Input: [][]linkFile{
+				{
+					{Name: "a", Type: tar.TypeReg, Content: "data"},
+					{Name: "z", Type: tar.TypeLink, Linkname: "a"},
+				},
+				{{Name: "b", Type: tar.TypeReg, Content: "b"}},
+			},
+			Output: []linkFile{
+				{Name: "a", Type: tar.TypeReg, Content: "data"},
+				{Name: "b", Type: tar.TypeReg, Content: "b"},
+				{Name: "z", Type: tar.TypeLink, Linkname: "a"},
+			},
+		},
+		"hardlink-target-replaced": {
+			Policy: fsutil.ConflictKeepLast,
+			Input: [][]linkFile{
+				{
+					{Name: "a", Type: tar.TypeReg, Content: "old"},
+					{Name: "z", Type: tar.TypeLink, Linkname: "a"},
+				},
+				{{Name: "a", Type: tar.TypeReg, Content: "new"}},
+			},
+			Output: []linkFile{
+				{Name: "a", Type: tar.TypeReg, Content: "new"},
+				{Name: "z", Type: tar.TypeReg, Content: "old"},
+			},
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			layers := make([]ociv1.Layer, 0, len(tcData.Input))
+			for _, files := range tcData.Input {
+				layers = append(layers, linkLayer(t, files...))
+			}
+			merged, err := squash.Merge(context.Background(), layers,
+				tcData.Policy, fsutil.SpecialFilesPreserve, time.Unix(0, 0))
+			if tcData.Err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tcData.Err)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Output, parseLinkLayer(t, merged))
+		})
+	}
+}
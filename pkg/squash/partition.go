@@ -0,0 +1,82 @@
+package squash
+
+import (
+	"fmt"
+	"io"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// A NamedLayer is an input to PartitionBySize; the Name is only used to describe the Partitions.
+type NamedLayer struct {
+	Name  string
+	Layer ociv1.Layer
+}
+
+// Partition is one of the layers returned by PartitionBySize.
+type Partition struct {
+	// Names are the names of the input layers that were squashed together to make this
+	// partition, in the order that they were given.
+	Names []string
+	// Size is the sum of the uncompressed sizes of the input layers.
+	Size  int64
+	Layer ociv1.Layer
+}
+
+func uncompressedSize(layer ociv1.Layer) (int64, error) {
+	reader, err := layer.Uncompressed()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	return io.Copy(io.Discard, reader)
+}
+
+// PartitionBySize squashes the layers together in to as few layers as possible, such that each
+// resulting layer has an uncompressed size of at most budget bytes.  An input layer is never
+// split; an input layer that is larger than budget on its own will be a partition by itself.
+//
+// The layers are in stacking order (a later layer's files win over an earlier one's), and they
+// are packed in that order, starting a new partition whenever the next input layer wouldn't fit;
+// so the returned partitions are also in stacking order.  The partitioning is deterministic and
+// stable: adding, removing, or changing one input layer only affects the partition that it is in
+// and (if that partition's size changes enough to move a boundary) the partitions after it;
+// partitions before it are unchanged, and so will be cache hits when pushing to a registry.  So
+// callers should give the layers in a consistent order from one build to the next.
+func PartitionBySize(
+	layers []NamedLayer,
+	budget int64,
+	opts ...ociv1tarball.LayerOption,
+) ([]Partition, error) {
+	if budget <= 0 {
+		return nil, fmt.Errorf("squash.PartitionBySize: budget must be positive: %d", budget)
+	}
+
+	var ret []Partition
+	var inputs [][]ociv1.Layer
+	for _, layer := range layers {
+		size, err := uncompressedSize(layer.Layer)
+		if err != nil {
+			return nil, fmt.Errorf("squash.PartitionBySize: %q: %w", layer.Name, err)
+		}
+		if len(ret) == 0 || ret[len(ret)-1].Size+size > budget {
+			ret = append(ret, Partition{}) //nolint:exhaustivestruct // filled in below
+			inputs = append(inputs, nil)
+		}
+		ret[len(ret)-1].Names = append(ret[len(ret)-1].Names, layer.Name)
+		ret[len(ret)-1].Size += size
+		inputs[len(inputs)-1] = append(inputs[len(inputs)-1], layer.Layer)
+	}
+
+	for i := range ret {
+		layer, err := Squash(inputs[i], opts...)
+		if err != nil {
+			return nil, fmt.Errorf("squash.PartitionBySize: %w", err)
+		}
+		ret[i].Layer = layer
+	}
+	return ret, nil
+}
@@ -0,0 +1,91 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func TestPartitionBySize(t *testing.T) {
+	t.Parallel()
+	layer := func(names ...string) ociv1.Layer {
+		var tl TestLayer
+		for _, name := range names {
+			tl = append(tl, TestFile{Name: name, Type: tar.TypeReg}) //nolint:exhaustivestruct
+		}
+		return tl.ToLayer(t)
+	}
+	// Each single-file layer is 1536 bytes: a 512-byte header and a 1024-byte trailer.  The
+	// layers are packed in the order given, not in order of their names.
+	layers := []squash.NamedLayer{
+		{Name: "d", Layer: layer("d")},
+		{Name: "a", Layer: layer("a")},
+		{Name: "c", Layer: layer("c", "x")},
+		{Name: "b", Layer: layer("b", "x")},
+		{Name: "e", Layer: layer("e1", "e2", "e3", "e4", "e5", "e6")},
+		{Name: "f", Layer: layer("f")},
+	}
+
+	partitions, err := squash.PartitionBySize(layers, 3*1536)
+	require.NoError(t, err)
+	type result struct {
+		Names []string
+		Size  int64
+		Files TestLayer
+	}
+	actual := make([]result, 0, len(partitions))
+	for _, partition := range partitions {
+		actual = append(actual, result{
+			Names: partition.Names,
+			Size:  partition.Size,
+			Files: ParseTestLayer(t, partition.Layer),
+		})
+	}
+	assert.Equal(t, []result{
+		{
+			Names: []string{"d", "a"},
+			Size:  2 * 1536,
+			Files: TestLayer{
+				{Name: "a", Type: tar.TypeReg},
+				{Name: "d", Type: tar.TypeReg},
+			},
+		},
+		{
+			// "x" is in both input layers, but only once in the squashed layer.
+			Names: []string{"c", "b"},
+			Size:  2 * (2*512 + 1024),
+			Files: TestLayer{
+				{Name: "b", Type: tar.TypeReg},
+				{Name: "c", Type: tar.TypeReg},
+				{Name: "x", Type: tar.TypeReg},
+			},
+		},
+		{
+			Names: []string{"e"},
+			Size:  6*512 + 1024,
+			Files: TestLayer{
+				{Name: "e1", Type: tar.TypeReg},
+				{Name: "e2", Type: tar.TypeReg},
+				{Name: "e3", Type: tar.TypeReg},
+				{Name: "e4", Type: tar.TypeReg},
+				{Name: "e5", Type: tar.TypeReg},
+				{Name: "e6", Type: tar.TypeReg},
+			},
+		},
+		{
+			Names: []string{"f"},
+			Size:  1536,
+			Files: TestLayer{
+				{Name: "f", Type: tar.TypeReg},
+			},
+		},
+	}, actual)
+
+	_, err = squash.PartitionBySize(layers, 0)
+	assert.EqualError(t, err, "squash.PartitionBySize: budget must be positive: 0")
+}
@@ -2,6 +2,7 @@ package squash
 
 import (
 	"archive/tar"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -9,11 +10,14 @@ import (
 	"strings"
 
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/tarnorm"
 )
 
 type fileEntry struct {
 	Header *tar.Header
-	Body   []byte
+	Body   *fileBody // nil if the content was omitted
 }
 
 type layerFS struct {
@@ -24,16 +28,22 @@ type layerFS struct {
 // parseLayer parses a Layer in to a filesystem object, with the following sanitizations made for
 // consistent querying:
 //
-//  - Paths are always path.Clean()'d (notably, directories do NOT contain trailing "/").
-func parseLayer(layer ociv1.Layer, omitContent bool) (*layerFS, error) {
+//  - Headers are normalized with tarnorm.Lax, except that directories do NOT contain a trailing
+//    "/".
+//  - Device nodes and FIFOs are handled according to the special policy.
+//
+// File content is not kept in memory; the returned entries refer back in to the layer, which is
+// re-read when the content is needed.
+func parseLayer(layer ociv1.Layer, omitContent bool, special fsutil.SpecialFilePolicy) (*layerFS, error) {
 	lfs := new(layerFS)
+	src := &layerSource{layer: layer} //nolint:exhaustivestruct
 	layerReader, err := layer.Uncompressed()
 	if err != nil {
 		return nil, fmt.Errorf("reading layer contents: %w", err)
 	}
 	defer layerReader.Close()
 	tarReader := tar.NewReader(layerReader)
-	for {
+	for index := 0; ; index++ {
 		header, err := tarReader.Next()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
@@ -42,23 +52,45 @@ func parseLayer(layer ociv1.Layer, omitContent bool) (*layerFS, error) {
 			return nil, fmt.Errorf("reading tar: %w", err)
 		}
 
-		cleanName := path.Clean(header.Name)
-		if strings.HasPrefix(cleanName, "/") || strings.HasPrefix(cleanName, "../") || cleanName == ".." {
-			return nil, fmt.Errorf("layer contains file outside of image root: %q", header.Name)
+		if path.Clean(header.Name) == "." {
+			// The root directory itself ("./", from `tar -C dir .`) isn't a valid name
+			// for tarnorm, but we can still track its metadata.
+			header.Name = "."
+		} else {
+			if _, err := tarnorm.CleanName(header.Name, tarnorm.Lax); errors.Is(err, tarnorm.ErrOutsideRoot) {
+				return nil, fmt.Errorf("layer contains file outside of image root: %q", header.Name)
+			}
+			if err := tarnorm.Header(header, tarnorm.Lax); err != nil {
+				return nil, fmt.Errorf("layer contains invalid entry: %w", err)
+			}
+			header.Name = strings.TrimSuffix(header.Name, "/")
+		}
+
+		if keep, err := special.Check(header); err != nil {
+			return nil, fmt.Errorf("layer contains %w", err)
+		} else if !keep {
+			continue
 		}
-		header.Name = cleanName
 
-		var body []byte
+		var body *fileBody
 		if omitContent {
 			// #nosec G110 -- mitigated with io.Discard
 			if _, err := io.Copy(io.Discard, tarReader); err != nil {
 				return nil, fmt.Errorf("reading tar: %w", err)
 			}
 		} else {
-			body, err = io.ReadAll(tarReader)
+			hasher := sha256.New()
+			// #nosec G110 -- mitigated by only hashing
+			size, err := io.Copy(hasher, tarReader)
 			if err != nil {
 				return nil, fmt.Errorf("reading tar: %w", err)
 			}
+			body = &fileBody{
+				src:   src,
+				index: index,
+				size:  size,
+			}
+			copy(body.digest[:], hasher.Sum(nil))
 		}
 		entry := fileEntry{
 			Header: header,
@@ -0,0 +1,61 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"errors"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func TestSquashSpecialFiles(t *testing.T) {
+	t.Parallel()
+	input := []linkFile{
+		{Name: "dev/null", Type: tar.TypeChar},
+		{Name: "dev/sda", Type: tar.TypeBlock},
+		{Name: "etc/hostname", Type: tar.TypeReg, Content: "localhost"},
+		{Name: "run/pipe", Type: tar.TypeFifo},
+	}
+	type testcase struct {
+		Policy fsutil.SpecialFilePolicy
+		Output []linkFile
+	}
+	testcases := map[string]testcase{
+		"preserve": {
+			Policy: fsutil.SpecialFilesPreserve,
+			Output: []linkFile{
+				{Name: "dev/null", Type: tar.TypeChar},
+				{Name: "dev/sda", Type: tar.TypeBlock},
+				{Name: "etc/hostname", Type: tar.TypeReg, Content: "localhost"},
+				{Name: "run/pipe", Type: tar.TypeFifo},
+			},
+		},
+		"strip": {
+			Policy: fsutil.SpecialFilesStrip,
+			Output: []linkFile{
+				{Name: "etc/hostname", Type: tar.TypeReg, Content: "localhost"},
+			},
+		},
+		"error": {
+			Policy: fsutil.SpecialFilesError,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			squashed, err := squash.SquashWithSpecialFiles([]ociv1.Layer{linkLayer(t, input...)}, tcData.Policy)
+			if tcData.Output == nil {
+				assert.True(t, errors.Is(err, fsutil.ErrSpecialFile))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tcData.Output, parseLinkLayer(t, squashed))
+		})
+	}
+}
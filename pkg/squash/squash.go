@@ -4,23 +4,22 @@
 package squash
 
 import (
-	"archive/tar"
-	"bytes"
-	"io"
 	"io/fs"
 
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
 	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
 )
 
-func loadLayers(layers []ociv1.Layer, omitContent bool) (*fsfile, error) {
+func loadLayers(layers []ociv1.Layer, omitContent bool, special fsutil.SpecialFilePolicy) (*fsfile, error) {
 	root := &fsfile{ //nolint:exhaustivestruct
 		name: ".",
 	}
 	root.parent = root
 	// Apply all the layers
 	for _, layer := range layers {
-		layerFS, err := parseLayer(layer, omitContent)
+		layerFS, err := parseLayer(layer, omitContent, special)
 		if err != nil {
 			return nil, err
 		}
@@ -52,33 +51,37 @@ func loadLayers(layers []ociv1.Layer, omitContent bool) (*fsfile, error) {
 //
 //  1. Includes whiteout markers in the output, since we don't assume to have the root layer.
 //  2. Squash properly implements "opaque whiteouts", which go-containerregistry doesn't support.
+//
+// Character devices, block devices, and FIFOs in the input layers are preserved; use
+// SquashWithSpecialFiles to strip or reject them instead.
+//
+// File content isn't held in memory; it is read from the input layers whenever the returned layer
+// is read, so the input layers must remain readable for as long as the returned layer is in use.
 func Squash(layers []ociv1.Layer, opts ...ociv1tarball.LayerOption) (ociv1.Layer, error) {
+	return SquashWithSpecialFiles(layers, fsutil.SpecialFilesPreserve, opts...)
+}
+
+// SquashWithSpecialFiles is like Squash, but character devices, block devices, and FIFOs in the
+// input layers are handled according to the special policy.
+func SquashWithSpecialFiles(
+	layers []ociv1.Layer,
+	special fsutil.SpecialFilePolicy,
+	opts ...ociv1tarball.LayerOption,
+) (ociv1.Layer, error) {
 	// Load the layers.
-	root, err := loadLayers(layers, false)
+	root, err := loadLayers(layers, false, special)
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate the layer tarball
-	var byteWriter bytes.Buffer
-	tarWriter := tar.NewWriter(&byteWriter)
-	if err := root.WriteTo(tarWriter); err != nil {
-		return nil, err
-	}
-	if err := tarWriter.Close(); err != nil {
-		return nil, err
-	}
-
-	// Wrap that in to a Layer object
-	byteSlice := byteWriter.Bytes()
-	return ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
-		return io.NopCloser(bytes.NewReader(byteSlice)), nil
-	}, opts...)
+	// Generate the layer tarball on demand; the file content is read from the input layers
+	// each time that the output layer is read, rather than being held in memory.
+	return ociv1tarball.LayerFromOpener(streamOpener(root.WriteTo), opts...)
 }
 
 // Load multiple layers as a filesystem.
 func Load(layers []ociv1.Layer, omitContent bool) (fs.FS, error) {
-	root, err := loadLayers(layers, omitContent)
+	root, err := loadLayers(layers, omitContent, fsutil.SpecialFilesPreserve)
 	if err != nil {
 		return nil, err
 	}
@@ -5,11 +5,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
 
-	"github.com/datawire/dlib/dexec"
 	"github.com/datawire/dlib/dlog"
 	"github.com/google/go-containerregistry/pkg/name"
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
@@ -360,16 +360,28 @@ func dockerSquash(t *testing.T, layers []ociv1.Layer) TestLayer { //nolint:thelp
 				err = _err
 			}
 		}
-		bs, err := dexec.CommandContext(ctx, "docker", "container", "create", tag.String(), "/bin/sh").Output()
+		cmd, err := dockerutil.Command(ctx, "container", "create", tag.String(), "/bin/sh")
+		if err != nil {
+			return err
+		}
+		bs, err := cmd.Output()
 		if err != nil {
 			return err
 		}
 		containerName := strings.TrimSpace(string(bs))
 		defer func() {
-			maybeSetErr(dexec.CommandContext(ctx, "docker", "container", "rm", containerName).Run())
+			cmd, err := dockerutil.Command(ctx, "container", "rm", containerName)
+			if err != nil {
+				maybeSetErr(err)
+				return
+			}
+			maybeSetErr(cmd.Run())
 		}()
 
-		cmd := dexec.CommandContext(ctx, "docker", "container", "export", containerName)
+		cmd, err = dockerutil.Command(ctx, "container", "export", containerName)
+		if err != nil {
+			return err
+		}
 		pipe, err := cmd.StdoutPipe()
 		if err != nil {
 			return err
@@ -412,3 +424,13 @@ func dockerSquash(t *testing.T, layers []ociv1.Layer) TestLayer { //nolint:thelp
 	}
 	return ret
 }
+
+func TestSquashOutsideRoot(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"/etc/passwd", "../etc/passwd", "a/../../etc/passwd"} {
+		layer := TestLayer{{Name: name, Type: tar.TypeReg}}.ToLayer(t) //nolint:exhaustivestruct
+		_, err := squash.Squash([]ociv1.Layer{layer})
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), fmt.Sprintf("layer contains file outside of image root: %q", name))
+	}
+}
@@ -0,0 +1,160 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+func TestSquashStreaming(t *testing.T) {
+	t.Parallel()
+
+	// Files are deliberately not in sorted order within the layers, so the output has to seek
+	// backward in the input layers.
+	var lower, upper []linkFile
+	var expected []linkFile
+	for i := 9; i >= 0; i-- {
+		lower = append(lower, linkFile{
+			Name:    fmt.Sprintf("lower%d", i),
+			Type:    tar.TypeReg,
+			Content: fmt.Sprintf("lower content %d", i),
+		})
+		upper = append(upper, linkFile{
+			Name:    fmt.Sprintf("upper%d", i),
+			Type:    tar.TypeReg,
+			Content: fmt.Sprintf("upper content %d", i),
+		})
+	}
+	for i := 0; i < 10; i++ {
+		expected = append(expected, lower[9-i])
+	}
+	for i := 0; i < 10; i++ {
+		expected = append(expected, upper[9-i])
+	}
+
+	squashed, err := squash.Squash([]ociv1.Layer{linkLayer(t, lower...), linkLayer(t, upper...)})
+	require.NoError(t, err)
+	assert.Equal(t, expected, parseLinkLayer(t, squashed))
+
+	// The output may be read several times at once.
+	var wg sync.WaitGroup
+	outputs := make([][]byte, 4)
+	for i := range outputs {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader, err := squashed.Uncompressed()
+			if err != nil {
+				return
+			}
+			defer reader.Close()
+			outputs[i], _ = io.ReadAll(reader)
+		}()
+	}
+	wg.Wait()
+	for i := range outputs {
+		assert.NotEmpty(t, outputs[i])
+		assert.Equal(t, outputs[0], outputs[i])
+	}
+}
+
+func TestSquashChangedInput(t *testing.T) {
+	t.Parallel()
+
+	// A layer that returns different content each time that it is opened.
+	var mu sync.Mutex
+	generation := 0
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		mu.Lock()
+		generation++
+		content := fmt.Sprintf("generation %d", generation)
+		mu.Unlock()
+		var byteWriter bytes.Buffer
+		tarWriter := tar.NewWriter(&byteWriter)
+		if err := tarWriter.WriteHeader(&tar.Header{
+			Name:     "file",
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(tarWriter, content); err != nil {
+			return nil, err
+		}
+		if err := tarWriter.Close(); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(&byteWriter), nil
+	})
+	require.NoError(t, err)
+
+	_, err = squash.Squash([]ociv1.Layer{layer})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "layer content changed")
+}
+
+func TestSquashOutOfOrderReads(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		Size int
+		// ExpectedOpens is the number of times that the input layer is opened to read the
+		// output layer once.
+		ExpectedOpens int
+	}{
+		// Small files that are skipped over are kept, so the input is only read once.
+		"small": {Size: 100, ExpectedOpens: 1},
+		// Large files aren't kept, so each one that is out of order re-reads the input.
+		"large": {Size: 512 * 1024, ExpectedOpens: 5},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			// Files are in reverse order within the layer.
+			var files []linkFile
+			for i := 4; i >= 0; i-- {
+				files = append(files, linkFile{
+					Name:    fmt.Sprintf("file%d", i),
+					Type:    tar.TypeReg,
+					Content: strings.Repeat(fmt.Sprint(i), tcData.Size),
+				})
+			}
+			reader, err := linkLayer(t, files...).Uncompressed()
+			require.NoError(t, err)
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+
+			var opens int32
+			input, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+				atomic.AddInt32(&opens, 1)
+				return io.NopCloser(bytes.NewReader(content)), nil
+			})
+			require.NoError(t, err)
+			squashed, err := squash.Squash([]ociv1.Layer{input})
+			require.NoError(t, err)
+
+			before := atomic.LoadInt32(&opens)
+			reader, err = squashed.Uncompressed()
+			require.NoError(t, err)
+			_, err = io.Copy(io.Discard, reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			assert.Equal(t, tcData.ExpectedOpens, int(atomic.LoadInt32(&opens)-before))
+		})
+	}
+}
@@ -24,7 +24,28 @@ type fsfile struct {
 
 	// if header is nil, that implies that this is a directory
 	header *tar.Header
-	body   []byte
+	body   *fileBody
+
+	// inode is shared by a regular file and any hardlinks to it; it is nil for other types
+	// of file, and for hardlinks whose target isn't in the layers that were loaded.
+	inode *fsinode
+}
+
+// fsinode is the content of a regular file, independent of the names that it has.  Tracking it
+// separately from the fsfile means that a hardlink keeps the content that it was created with,
+// even if the file that it was a link to is later replaced or whited out.
+type fsinode struct {
+	header *tar.Header // the regular file's header
+	body   *fileBody
+}
+
+// content returns the header and body that should be used when reading the file; for a hardlink,
+// this is the header and body of the file that it links to.
+func (f *fsfile) content() (*tar.Header, *fileBody) {
+	if f.inode != nil && f.header.Typeflag == tar.TypeLink {
+		return f.inode.header, f.inode.body
+	}
+	return f.header, f.body
 }
 
 func fsGet(dir *fsfile, pathname string, create, followLinks bool) (*fsfile, error) {
@@ -152,7 +173,7 @@ func (f *fsfile) Get(child string, create, followLinks bool) (*fsfile, error) {
 	return ret, nil
 }
 
-func (f *fsfile) Set(hdr *tar.Header, body []byte) error {
+func (f *fsfile) Set(hdr *tar.Header, body *fileBody) error {
 	if hdr != nil {
 		_hdr := *hdr
 		hdr = &_hdr
@@ -162,6 +183,16 @@ func (f *fsfile) Set(hdr *tar.Header, body []byte) error {
 
 	f.header = hdr
 	f.body = body
+	f.inode = nil
+	switch f.header.Typeflag {
+	case tar.TypeReg, tar.TypeRegA: //nolint:staticcheck // TypeRegA is deprecated, but may still be read
+		f.inode = &fsinode{header: hdr, body: body}
+	case tar.TypeLink:
+		// Hardlink names are relative to the root of the layer.
+		if target, err := fsGet(f, "/"+f.header.Linkname, false, false); err == nil && target != f {
+			f.inode = target.inode
+		}
+	}
 
 	if f.header.Typeflag != tar.TypeDir {
 		// Changing a directory to a non-directory will implicitly whiteout anything in that
@@ -202,7 +233,42 @@ func (f *fsfile) Set(hdr *tar.Header, body []byte) error {
 	return nil
 }
 
-func (f *fsfile) WriteTo(tarWriter *tar.Writer) error {
+// clone returns a deep copy of the tree rooted at f, with the copy's parent set to parent (or to
+// itself, if parent is nil).  Headers and inodes are never modified in-place, so they are shared
+// with the original.
+func (f *fsfile) clone(parent *fsfile) *fsfile {
+	ret := &fsfile{
+		name:     f.name,
+		parent:   parent,
+		children: nil,
+		header:   f.header,
+		body:     f.body,
+		inode:    f.inode,
+	}
+	if parent == nil {
+		ret.parent = ret
+	}
+	if f.children != nil {
+		ret.children = make(map[string]*fsfile, len(f.children))
+		for childName, child := range f.children {
+			ret.children[childName] = child.clone(ret)
+		}
+	}
+	return ret
+}
+
+// WriteTo writes the file and its children (recursively) to tarWriter, reading file content from
+// the source layers using cursors.
+//
+// Hardlinks are written so that each group of links to the same content stays a group of links;
+// whichever member of the group is written first gets the content and the others are written as
+// links to it.  This way the target of a link always comes before the link, even if the original
+// target was renamed over or whited out.
+func (f *fsfile) WriteTo(tarWriter *tar.Writer, cursors cursorSet) error {
+	return f.writeTo(tarWriter, cursors, make(map[*fsinode]string))
+}
+
+func (f *fsfile) writeTo(tarWriter *tar.Writer, cursors cursorSet, written map[*fsinode]string) error {
 	name := f.name
 
 	if f.header != nil {
@@ -210,11 +276,24 @@ func (f *fsfile) WriteTo(tarWriter *tar.Writer) error {
 			name += "/"
 		}
 		hdr := *f.header // shallow copy
+		body := f.body
+		if f.inode != nil {
+			if linkname, ok := written[f.inode]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = linkname
+				hdr.Size = 0
+				body = nil
+			} else {
+				written[f.inode] = name
+				hdr = *f.inode.header // shallow copy
+				body = f.inode.body
+			}
+		}
 		hdr.Name = name
 		if err := tarWriter.WriteHeader(&hdr); err != nil {
 			return err
 		}
-		if _, err := tarWriter.Write(f.body); err != nil {
+		if err := cursors.copyBody(tarWriter, body); err != nil {
 			return err
 		}
 	}
@@ -239,7 +318,7 @@ func (f *fsfile) WriteTo(tarWriter *tar.Writer) error {
 
 	for _, childName := range childNames {
 		child := f.children[childName]
-		if err := child.WriteTo(tarWriter); err != nil {
+		if err := child.writeTo(tarWriter, cursors, written); err != nil {
 			return err
 		}
 	}
@@ -65,6 +65,8 @@ type fsfileReader struct {
 	// dynamic state
 	mu      sync.Mutex
 	pos     int
+	loaded  bool
+	content []byte // loaded on the first Read
 	closed  bool
 	dirents []fs.DirEntry // cache; generated from .tgt.children
 }
@@ -78,7 +80,8 @@ func (f *fsfileReader) Stat() (fs.FileInfo, error) {
 			Err:  ErrMissing,
 		}
 	}
-	hdr := *f.tgt.header // shallow copy
+	tgtHeader, _ := f.tgt.content()
+	hdr := *tgtHeader // shallow copy
 	hdr.Name = f.lnk.header.Name
 	return hdr.FileInfo(), nil
 }
@@ -97,7 +100,8 @@ func (f *fsfileReader) Read(buf []byte) (_ int, err error) {
 	if f.tgt.header == nil || f.tgt.header.Typeflag == tar.TypeDir {
 		return 0, ErrIsDir
 	}
-	if int64(len(f.tgt.body)) < f.tgt.header.Size {
+	tgtHeader, tgtBody := f.tgt.content()
+	if tgtBody.Size() < tgtHeader.Size {
 		return 0, ErrMissing
 	}
 
@@ -107,10 +111,17 @@ func (f *fsfileReader) Read(buf []byte) (_ int, err error) {
 	if f.closed {
 		return 0, fs.ErrClosed
 	}
-	if f.pos == len(f.tgt.body) {
+	if !f.loaded {
+		f.content, err = tgtBody.ReadAll()
+		if err != nil {
+			return 0, err
+		}
+		f.loaded = true
+	}
+	if f.pos == len(f.content) {
 		return 0, io.EOF
 	}
-	n := copy(buf, f.tgt.body[f.pos:])
+	n := copy(buf, f.content[f.pos:])
 	f.pos += n
 	return n, nil
 }
@@ -0,0 +1,89 @@
+package squash_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+	"github.com/datawire/ocibuild/pkg/squash"
+)
+
+const testCapability = "\x01\x00\x00\x02\x00\x20\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+
+func xattrLayer(t *testing.T, name string, xattrs map[string]string) ociv1.Layer {
+	t.Helper()
+	var byteWriter bytes.Buffer
+	tarWriter := tar.NewWriter(&byteWriter)
+	header := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0o755,
+		Size:     int64(len("binary")),
+	}
+	fsutil.SetXattrs(header, xattrs)
+	require.NoError(t, tarWriter.WriteHeader(header))
+	_, err := io.WriteString(tarWriter, "binary")
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	byteSlice := byteWriter.Bytes()
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(byteSlice)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func layerXattrs(t *testing.T, layer ociv1.Layer) map[string]map[string]string {
+	t.Helper()
+	layerReader, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer layerReader.Close()
+	ret := make(map[string]map[string]string)
+	tarReader := tar.NewReader(layerReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		ret[header.Name] = fsutil.Xattrs(header)
+	}
+	return ret
+}
+
+func TestXattrs(t *testing.T) {
+	t.Parallel()
+	capXattrs := map[string]string{"security.capability": testCapability}
+
+	// Squashing preserves extended attributes.
+	squashed, err := squash.Squash([]ociv1.Layer{
+		xattrLayer(t, "usr/bin/ping", capXattrs),
+		xattrLayer(t, "usr/bin/other", nil),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"usr/bin/ping":  capXattrs,
+		"usr/bin/other": nil,
+	}, layerXattrs(t, squashed))
+
+	// Deduplication considers extended attributes.
+	deduplicator, err := squash.NewDeduplicator([]ociv1.Layer{xattrLayer(t, "usr/bin/ping", nil)})
+	require.NoError(t, err)
+	deduped, saved, err := deduplicator.Dedup(xattrLayer(t, "usr/bin/ping", capXattrs))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), saved)
+	assert.Equal(t, map[string]map[string]string{
+		"usr/bin/ping": capXattrs,
+	}, layerXattrs(t, deduped))
+	_, saved, err = deduplicator.Dedup(xattrLayer(t, "usr/bin/ping", capXattrs))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("binary")), saved)
+}
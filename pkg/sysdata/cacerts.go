@@ -0,0 +1,154 @@
+package sysdata
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// CABundlePath is where CACertsLayer puts the CA bundle; it is where Debian, Ubuntu, Alpine, and
+// Go's crypto/x509 (among others) look for it.
+const CABundlePath = "etc/ssl/certs/ca-certificates.crt"
+
+// caBundleAliases are other paths that some distributions (and the programs built for them) look
+// for the bundle at; CACertsLayer makes them symlinks to CABundlePath.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var caBundleAliases = []string{
+	"etc/pki/tls/certs/ca-bundle.crt", // Fedora, RHEL
+	"etc/ssl/cert.pem",                // Alpine, macOS-derived tooling
+}
+
+// HostCABundles is the list of files that CABundleFromHost looks for, in order; it is the same as
+// the list that Go's crypto/x509 uses on Linux.
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var HostCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Gentoo, Arch
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS, RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine
+}
+
+// ValidateCABundle checks that content is a PEM bundle of CA certificates, returning the number
+// of certificates in it.  It is an error if the bundle contains no certificates, or anything that
+// isn't a certificate.
+func ValidateCABundle(content []byte) (int, error) {
+	count := 0
+	for rest := content; len(strings.TrimSpace(string(rest))) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return 0, fmt.Errorf("sysdata.ValidateCABundle: invalid PEM data after %d certificates", count)
+		}
+		if block.Type != "CERTIFICATE" {
+			return 0, fmt.Errorf("sysdata.ValidateCABundle: unexpected PEM block type %q", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return 0, fmt.Errorf("sysdata.ValidateCABundle: certificate %d: %w", count+1, err)
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("sysdata.ValidateCABundle: no certificates")
+	}
+	return count, nil
+}
+
+// CABundleFromHost reads the CA bundle of the host that ocibuild is running on, from the first of
+// HostCABundles that exists, returning its content and the filename that it was read from.
+func CABundleFromHost() (content []byte, filename string, err error) {
+	for _, filename := range HostCABundles {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, "", fmt.Errorf("sysdata.CABundleFromHost: %w", err)
+		}
+		if _, err := ValidateCABundle(content); err != nil {
+			return nil, "", fmt.Errorf("sysdata.CABundleFromHost: %s: %w", filename, err)
+		}
+		return content, filename, nil
+	}
+	return nil, "", fmt.Errorf("sysdata.CABundleFromHost: no CA bundle found in any of %q", HostCABundles)
+}
+
+// CABundleFromURL downloads a CA bundle (such as the Mozilla bundle published at
+// https://curl.se/docs/caextract.html), and verifies that its SHA-256 digest is sha256Hex, so that
+// the result is pinned to a specific, known-good bundle.  If client is nil, http.DefaultClient is
+// used.
+func CABundleFromURL(ctx context.Context, client *http.Client, url, sha256Hex string) ([]byte, error) {
+	if sha256Hex == "" {
+		return nil, fmt.Errorf("sysdata.CABundleFromURL: a SHA-256 digest is required")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("sysdata.CABundleFromURL: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sysdata.CABundleFromURL: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sysdata.CABundleFromURL: GET %q: HTTP %s", url, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("sysdata.CABundleFromURL: GET %q: %w", url, err)
+	}
+	sum := sha256.Sum256(content)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, sha256Hex) {
+		return nil, fmt.Errorf("sysdata.CABundleFromURL: GET %q: SHA-256 mismatch: expected %s, got %s",
+			url, strings.ToLower(sha256Hex), actual)
+	}
+	if _, err := ValidateCABundle(content); err != nil {
+		return nil, fmt.Errorf("sysdata.CABundleFromURL: GET %q: %w", url, err)
+	}
+	return content, nil
+}
+
+// CACertsLayer returns a layer containing bundle at CABundlePath, with symlinks to it from the
+// other common locations, all with the timestamp mtime.
+func CACertsLayer(ctx context.Context, bundle []byte, mtime time.Time) (ociv1.Layer, error) {
+	if _, err := ValidateCABundle(bundle); err != nil {
+		return nil, err
+	}
+	files := parentDirs(CABundlePath, mtime)
+	files = append(files, fileEntry(CABundlePath, bundle, mtime))
+	for _, alias := range caBundleAliases {
+		files = append(files, parentDirs(alias, mtime)...)
+		files = append(files, symlinkEntry(alias, relativeTarget(alias, CABundlePath), mtime))
+	}
+	ret, err := layer(ctx, files, mtime)
+	if err != nil {
+		return nil, fmt.Errorf("sysdata.CACertsLayer: %w", err)
+	}
+	return ret, nil
+}
+
+// relativeTarget returns the target of a relative symlink at name that points to target; both are
+// relative to the root.
+func relativeTarget(name, target string) string {
+	return strings.Repeat("../", strings.Count(name, "/")) + target
+}
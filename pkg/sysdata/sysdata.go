@@ -0,0 +1,89 @@
+// Package sysdata builds layers of the system data files that nearly every image needs but that a
+// from-scratch image doesn't have: a bundle of CA certificates, and the timezone database.
+package sysdata
+
+import (
+	"archive/tar"
+	"context"
+	"path"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+// parentDirs returns root-owned 0755 directory entries for each of the parent directories of name.
+func parentDirs(name string, mtime time.Time) []fsutil.FileReference {
+	var ret []fsutil.FileReference
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		ret = append(ret, dirEntry(dir, mtime))
+	}
+	return ret
+}
+
+func dirEntry(name string, mtime time.Time) fsutil.FileReference {
+	return &fsutil.InMemFileReference{
+		FileInfo: (&tar.Header{ //nolint:exhaustivestruct // only set what we need
+			Typeflag: tar.TypeDir,
+			Name:     name,
+			Mode:     0o755,
+			Uname:    "root",
+			Gname:    "root",
+			ModTime:  mtime,
+		}).FileInfo(),
+		MFullName: name,
+		MContent:  nil,
+	}
+}
+
+func fileEntry(name string, content []byte, mtime time.Time) fsutil.FileReference {
+	return &fsutil.InMemFileReference{
+		FileInfo: (&tar.Header{ //nolint:exhaustivestruct // only set what we need
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Uname:    "root",
+			Gname:    "root",
+			ModTime:  mtime,
+		}).FileInfo(),
+		MFullName: name,
+		MContent:  content,
+	}
+}
+
+func symlinkEntry(name, target string, mtime time.Time) fsutil.FileReference {
+	return &fsutil.InMemFileReference{
+		FileInfo: (&tar.Header{ //nolint:exhaustivestruct // only set what we need
+			Typeflag: tar.TypeSymlink,
+			Name:     name,
+			Linkname: target,
+			Mode:     0o777,
+			Uname:    "root",
+			Gname:    "root",
+			ModTime:  mtime,
+		}).FileInfo(),
+		MFullName: name,
+		MContent:  nil,
+	}
+}
+
+// dedupDirs removes duplicate directory entries (keeping the first), since several files may
+// share parent directories.
+func dedupDirs(files []fsutil.FileReference) []fsutil.FileReference {
+	seen := make(map[string]struct{}, len(files))
+	ret := make([]fsutil.FileReference, 0, len(files))
+	for _, file := range files {
+		if _, dup := seen[file.FullName()]; dup && file.IsDir() {
+			continue
+		}
+		seen[file.FullName()] = struct{}{}
+		ret = append(ret, file)
+	}
+	return ret
+}
+
+func layer(ctx context.Context, files []fsutil.FileReference, clampTime time.Time) (ociv1.Layer, error) {
+	return fsutil.LayerFromFileReferencesContext(ctx, dedupDirs(files), clampTime)
+}
@@ -0,0 +1,215 @@
+package sysdata_test
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/sysdata"
+)
+
+func genCert(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{ //nolint:exhaustivestruct
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"}, //nolint:exhaustivestruct
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}) //nolint:exhaustivestruct
+}
+
+type entry struct {
+	Type     byte
+	Linkname string
+	Content  string
+}
+
+func readLayer(t *testing.T, layer ociv1.Layer) map[string]entry {
+	t.Helper()
+	rc, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer func() {
+		_ = rc.Close()
+	}()
+	ret := make(map[string]entry)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		ret[hdr.Name] = entry{Type: hdr.Typeflag, Linkname: hdr.Linkname, Content: string(content)}
+	}
+	return ret
+}
+
+func TestValidateCABundle(t *testing.T) {
+	t.Parallel()
+	cert := genCert(t)
+	testcases := map[string]struct {
+		Input    []byte
+		ExpCount int
+		ExpErr   bool
+	}{
+		"one":      {Input: cert, ExpCount: 1},
+		"two":      {Input: append(append([]byte{}, cert...), cert...), ExpCount: 2},
+		"empty":    {Input: []byte("\n"), ExpErr: true},
+		"garbage":  {Input: []byte("garbage\n"), ExpErr: true},
+		"privkey":  {Input: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}}), ExpErr: true}, //nolint:exhaustivestruct,lll
+		"badcert":  {Input: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}), ExpErr: true}, //nolint:exhaustivestruct,lll
+		"trailing": {Input: append(append([]byte{}, cert...), "junk"...), ExpErr: true},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			count, err := sysdata.ValidateCABundle(tcData.Input)
+			if tcData.ExpErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tcData.ExpCount, count)
+			}
+		})
+	}
+}
+
+func TestCABundleFromURL(t *testing.T) {
+	t.Parallel()
+	cert := genCert(t)
+	sum := sha256.Sum256(cert)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cacert.pem" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(cert)
+	}))
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	content, err := sysdata.CABundleFromURL(ctx, srv.Client(), srv.URL+"/cacert.pem", hex.EncodeToString(sum[:]))
+	assert.NoError(t, err)
+	assert.Equal(t, cert, content)
+
+	_, err = sysdata.CABundleFromURL(ctx, srv.Client(), srv.URL+"/cacert.pem", hex.EncodeToString(make([]byte, 32)))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "SHA-256 mismatch")
+	}
+
+	_, err = sysdata.CABundleFromURL(ctx, srv.Client(), srv.URL+"/cacert.pem", "")
+	assert.Error(t, err)
+
+	_, err = sysdata.CABundleFromURL(ctx, srv.Client(), srv.URL+"/missing.pem", hex.EncodeToString(sum[:]))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+}
+
+func TestCACertsLayer(t *testing.T) {
+	t.Parallel()
+	cert := genCert(t)
+	layer, err := sysdata.CACertsLayer(context.Background(), cert, time.Unix(0, 0))
+	require.NoError(t, err)
+	files := readLayer(t, layer)
+	assert.Equal(t, entry{Type: tar.TypeReg, Content: string(cert)}, files[sysdata.CABundlePath])
+	assert.Equal(t, entry{Type: tar.TypeSymlink, Linkname: "../../" + sysdata.CABundlePath}, files["etc/ssl/cert.pem"])
+	assert.Equal(t, entry{Type: tar.TypeSymlink, Linkname: "../../../../" + sysdata.CABundlePath},
+		files["etc/pki/tls/certs/ca-bundle.crt"])
+	assert.Equal(t, byte(tar.TypeDir), files["etc/ssl/certs/"].Type)
+
+	_, err = sysdata.CACertsLayer(context.Background(), []byte("not a cert"), time.Unix(0, 0))
+	assert.Error(t, err)
+}
+
+func TestTZDataLayer(t *testing.T) {
+	t.Parallel()
+	srcDir := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		filename := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+	writeFile("UTC", "TZif utc")
+	writeFile("Etc/GMT", "TZif gmt")
+	writeFile("America/New_York", "TZif ny")
+	writeFile("Europe/Paris", "TZif paris")
+	writeFile("zone.tab", "# zone.tab")
+	require.NoError(t, os.Symlink("../America/New_York", filepath.Join(srcDir, "Etc", "EST5EDT")))
+
+	ctx := context.Background()
+
+	t.Run("all", func(t *testing.T) {
+		t.Parallel()
+		layer, err := sysdata.TZDataLayer(ctx, srcDir, nil, "", time.Unix(0, 0))
+		require.NoError(t, err)
+		files := readLayer(t, layer)
+		assert.Equal(t, entry{Type: tar.TypeReg, Content: "TZif paris"}, files["usr/share/zoneinfo/Europe/Paris"])
+		assert.Equal(t, entry{Type: tar.TypeSymlink, Linkname: "../America/New_York"},
+			files["usr/share/zoneinfo/Etc/EST5EDT"])
+		assert.NotContains(t, files, "etc/localtime")
+	})
+	t.Run("filtered", func(t *testing.T) {
+		t.Parallel()
+		layer, err := sysdata.TZDataLayer(ctx, srcDir, []string{"UTC", "America/*", "EST5EDT"}, "America/New_York",
+			time.Unix(0, 0))
+		require.NoError(t, err)
+		files := readLayer(t, layer)
+		var names []string
+		for name := range files {
+			names = append(names, name)
+		}
+		assert.ElementsMatch(t, []string{
+			"etc/",
+			"etc/localtime",
+			"usr/",
+			"usr/share/",
+			"usr/share/zoneinfo/",
+			"usr/share/zoneinfo/America/",
+			"usr/share/zoneinfo/America/New_York",
+			"usr/share/zoneinfo/Etc/",
+			"usr/share/zoneinfo/Etc/EST5EDT",
+			"usr/share/zoneinfo/UTC",
+			"usr/share/zoneinfo/zone.tab",
+		}, names)
+		assert.Equal(t, entry{Type: tar.TypeSymlink, Linkname: "/usr/share/zoneinfo/America/New_York"},
+			files["etc/localtime"])
+		assert.Equal(t, entry{Type: tar.TypeReg, Content: "TZif ny"}, files["usr/share/zoneinfo/Etc/EST5EDT"])
+	})
+	t.Run("missing-localtime", func(t *testing.T) {
+		t.Parallel()
+		_, err := sysdata.TZDataLayer(ctx, srcDir, []string{"UTC"}, "Europe/Paris", time.Unix(0, 0))
+		assert.Error(t, err)
+	})
+}
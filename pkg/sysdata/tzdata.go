@@ -0,0 +1,130 @@
+package sysdata
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/datawire/ocibuild/pkg/fsutil"
+)
+
+// ZoneinfoPath is where TZDataLayer puts the timezone database; it is where glibc, musl, and Go's
+// time package look for it.
+const ZoneinfoPath = "usr/share/zoneinfo"
+
+// HostZoneinfoDir is the host's timezone database, that TZDataLayer is usually given.
+const HostZoneinfoDir = "/usr/share/zoneinfo"
+
+// tzifMagic is the magic number at the start of every compiled zone file (RFC 8536).
+var tzifMagic = []byte("TZif") //nolint:gochecknoglobals // Would be 'const'.
+
+// TZDataLayer returns a layer containing the timezone database from the directory srcDir (such as
+// HostZoneinfoDir) at ZoneinfoPath, with the timestamp mtime.
+//
+// If zones is non-empty, then only the zones matching those globs (as with fsutil.MatchGlob; such
+// as "UTC" or "America/*") are included, along with the zone.tab-style metadata files.  If
+// localtime is non-empty, then /etc/localtime is made a symlink to that zone, which must be
+// included.
+//
+// Symlinks within srcDir (as some distributions use for zone aliases) are kept as symlinks, unless
+// zones is non-empty, in which case they are copied as regular files so that they can't dangle.
+func TZDataLayer(
+	ctx context.Context, srcDir string, zones []string, localtime string, mtime time.Time,
+) (ociv1.Layer, error) {
+	files := parentDirs(path.Join(ZoneinfoPath, "x"), mtime)
+	haveLocaltime := false
+	fsys := os.DirFS(srcDir)
+	err := fs.WalkDir(fsys, ".", func(name string, dirent fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		fullName := path.Join(ZoneinfoPath, name)
+		switch {
+		case dirent.IsDir():
+			files = append(files, dirEntry(fullName, mtime))
+			return nil
+		case dirent.Type()&fs.ModeSymlink != 0:
+			if len(zones) > 0 && fsutil.MatchGlob(zones, name) == "" {
+				return nil
+			}
+			if len(zones) > 0 {
+				// The target might not be included, so copy it rather than risk a dangling
+				// symlink.
+				content, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					return err
+				}
+				files = append(files, fileEntry(fullName, content, mtime))
+				break
+			}
+			target, err := os.Readlink(filepath.Join(srcDir, filepath.FromSlash(name)))
+			if err != nil {
+				return err
+			}
+			files = append(files, symlinkEntry(fullName, target, mtime))
+		case dirent.Type().IsRegular():
+			content, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return err
+			}
+			isZone := bytes.HasPrefix(content, tzifMagic)
+			if len(zones) > 0 && isZone && fsutil.MatchGlob(zones, name) == "" {
+				return nil
+			}
+			files = append(files, fileEntry(fullName, content, mtime))
+		default:
+			return nil
+		}
+		if name == localtime {
+			haveLocaltime = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sysdata.TZDataLayer: %w", err)
+	}
+	if localtime != "" {
+		if !haveLocaltime {
+			return nil, fmt.Errorf("sysdata.TZDataLayer: localtime zone %q is not included", localtime)
+		}
+		files = append(files,
+			dirEntry("etc", mtime),
+			symlinkEntry("etc/localtime", "/"+path.Join(ZoneinfoPath, localtime), mtime))
+	}
+	ret, err := layer(ctx, pruneEmptyDirs(files), mtime)
+	if err != nil {
+		return nil, fmt.Errorf("sysdata.TZDataLayer: %w", err)
+	}
+	return ret, nil
+}
+
+// pruneEmptyDirs removes the directories under ZoneinfoPath that (after filtering by zone) don't
+// contain anything.
+func pruneEmptyDirs(files []fsutil.FileReference) []fsutil.FileReference {
+	nonEmpty := make(map[string]bool)
+	for _, file := range files {
+		if !file.IsDir() {
+			for dir := path.Dir(file.FullName()); dir != "."; dir = path.Dir(dir) {
+				nonEmpty[dir] = true
+			}
+		}
+	}
+	ret := make([]fsutil.FileReference, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() && !nonEmpty[file.FullName()] {
+			continue
+		}
+		ret = append(ret, file)
+	}
+	return ret
+}
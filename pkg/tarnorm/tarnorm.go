@@ -0,0 +1,190 @@
+// Package tarnorm defines the canonical form of the tar headers in the layers that ocibuild reads
+// and writes, so that every producer of layers (squash, bdist, dir, ...) agrees on it.
+//
+// A canonical header:
+//
+//  - has a Name that is relative, path.Clean()'d, and does not start with "./", and that ends with
+//    "/" if and only if the entry is a directory;
+//  - for a hardlink, has a Linkname that follows the same rules (without the trailing "/");
+//  - has a Typeflag of TypeReg rather than the deprecated TypeRegA;
+//  - has a Mode that only contains permission bits (including setuid, setgid, and sticky), not
+//    the file type bits that some tar implementations include.
+//
+// Each function has a Strict mode that returns an error for a non-canonical header, and a Lax mode
+// that fixes up anything that can safely be fixed.  Names that are absolute or that climb out of
+// the root with ".." are an error in either mode; a layer containing them is malformed (or
+// malicious), and guessing what was meant would hide that.
+package tarnorm
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Mode says whether to fix non-canonical headers or to reject them.
+type Mode int
+
+const (
+	// Strict returns an error for any non-canonical header.
+	Strict Mode = iota
+	// Lax fixes non-canonical headers where possible.
+	Lax
+)
+
+var (
+	// ErrNonCanonical is returned (wrapped) in Strict mode for a header that isn't canonical.
+	ErrNonCanonical = errors.New("non-canonical tar header")
+	// ErrOutsideRoot is returned (wrapped) in either mode for a name that is absolute or
+	// that climbs out of the root.
+	ErrOutsideRoot = errors.New("file outside of image root")
+)
+
+// permBits are the bits of tar.Header.Mode that are allowed in canonical form.
+const permBits = 0o7777
+
+// CleanName returns the canonical form of name, without any trailing "/"; this is the form used as
+// a key when tracking files in memory (for instance, by fsutil.FileReference.FullName).  In Strict
+// mode, a trailing "/" is permitted, but nothing else non-canonical is.  The root directory itself
+// (".") is an error, since it can't be an entry in a layer.
+func CleanName(name string, mode Mode) (string, error) {
+	clean := path.Clean(name)
+	switch {
+	case clean == "." || name == "":
+		return "", fmt.Errorf("tarnorm: %w: empty file name: %q", ErrNonCanonical, name)
+	case clean == ".." || strings.HasPrefix(clean, "../"):
+		return "", fmt.Errorf("tarnorm: %w: %q", ErrOutsideRoot, name)
+	case strings.HasPrefix(clean, "/"):
+		return "", fmt.Errorf("tarnorm: %w: %q", ErrOutsideRoot, name)
+	}
+	if mode == Strict && clean != strings.TrimSuffix(name, "/") {
+		return "", fmt.Errorf("tarnorm: %w: file name is not clean: %q (should be %q)",
+			ErrNonCanonical, name, clean)
+	}
+	return clean, nil
+}
+
+// Name returns the canonical form of name for an entry in a layer: as with CleanName, but with a
+// trailing "/" if isDir.  In Strict mode, the trailing "/" must already be correct.
+func Name(name string, isDir bool, mode Mode) (string, error) {
+	clean, err := CleanName(name, mode)
+	if err != nil {
+		return "", err
+	}
+	if isDir {
+		clean += "/"
+	}
+	if mode == Strict && clean != name {
+		return "", fmt.Errorf("tarnorm: %w: file name %q should be %q", ErrNonCanonical, name, clean)
+	}
+	return clean, nil
+}
+
+// Header normalizes hdr in-place.  In Strict mode, hdr is not modified if an error is returned.
+func Header(hdr *tar.Header, mode Mode) error {
+	typeflag := hdr.Typeflag
+	if typeflag == tar.TypeRegA { //nolint:staticcheck // TypeRegA is deprecated, but may still be read
+		if mode == Strict {
+			return fmt.Errorf("tarnorm: %w: %q: deprecated TypeRegA type", ErrNonCanonical, hdr.Name)
+		}
+		// Old tar implementations used a trailing "/" to indicate a directory.
+		if strings.HasSuffix(hdr.Name, "/") {
+			typeflag = tar.TypeDir
+		} else {
+			typeflag = tar.TypeReg
+		}
+	}
+
+	name, err := Name(hdr.Name, typeflag == tar.TypeDir, mode)
+	if err != nil {
+		return err
+	}
+
+	linkname := hdr.Linkname
+	if typeflag == tar.TypeLink {
+		linkname, err = CleanName(hdr.Linkname, mode)
+		if err != nil {
+			return fmt.Errorf("hardlink %q: %w", hdr.Name, err)
+		}
+		if mode == Strict && linkname != hdr.Linkname {
+			return fmt.Errorf("tarnorm: %w: hardlink %q: target %q should be %q",
+				ErrNonCanonical, hdr.Name, hdr.Linkname, linkname)
+		}
+	}
+
+	if hdr.Mode&^permBits != 0 && mode == Strict {
+		return fmt.Errorf("tarnorm: %w: %q: mode %#o has non-permission bits",
+			ErrNonCanonical, hdr.Name, hdr.Mode)
+	}
+
+	hdr.Typeflag = typeflag
+	hdr.Name = name
+	hdr.Linkname = linkname
+	hdr.Mode &= permBits
+	return nil
+}
+
+// A Normalizer normalizes the sequence of headers in a single layer.  In addition to normalizing
+// each header with Header, it checks for duplicate entries, and (optionally) that each entry's
+// parent directories come before it.  The zero value is a Strict Normalizer that doesn't check
+// for parent directories.
+type Normalizer struct {
+	Mode Mode
+
+	// ParentTemplate, if non-nil, enables checking for parent directories.  In Lax mode, a
+	// missing parent directory is created by copying ParentTemplate; in Strict mode, it is an
+	// error.  If nil, parent directories are not checked, which is appropriate for a layer
+	// that is to be stacked on top of other layers.
+	ParentTemplate *tar.Header
+
+	seen map[string]byte // clean name => typeflag
+}
+
+// Next normalizes hdr in-place, and returns the headers that should be written for it: hdr,
+// preceded by any parent directories that need to be created.
+func (n *Normalizer) Next(hdr *tar.Header) ([]*tar.Header, error) {
+	if err := Header(hdr, n.Mode); err != nil {
+		return nil, err
+	}
+	if n.seen == nil {
+		n.seen = make(map[string]byte)
+	}
+	clean := strings.TrimSuffix(hdr.Name, "/")
+
+	var ret []*tar.Header
+	if n.ParentTemplate != nil {
+		var missing []string
+		for dir := path.Dir(clean); dir != "."; dir = path.Dir(dir) {
+			typeflag, ok := n.seen[dir]
+			if ok && typeflag != tar.TypeDir {
+				return nil, fmt.Errorf("tarnorm: %q: parent %q is not a directory", hdr.Name, dir)
+			}
+			if ok {
+				break
+			}
+			missing = append(missing, dir)
+		}
+		if len(missing) > 0 && n.Mode == Strict {
+			return nil, fmt.Errorf("tarnorm: %w: %q: parent directory %q is missing",
+				ErrNonCanonical, hdr.Name, missing[len(missing)-1])
+		}
+		for i := len(missing) - 1; i >= 0; i-- {
+			parent := *n.ParentTemplate // shallow copy
+			parent.Name = missing[i] + "/"
+			parent.Typeflag = tar.TypeDir
+			n.seen[missing[i]] = tar.TypeDir
+			ret = append(ret, &parent)
+		}
+	}
+
+	// A later entry with the same name as an earlier one replaces it, which is valid but not
+	// canonical; whiteouts are the exception, since repeating one is harmless.
+	if _, dup := n.seen[clean]; dup && n.Mode == Strict && !strings.HasPrefix(path.Base(clean), ".wh.") {
+		return nil, fmt.Errorf("tarnorm: %w: duplicate entry: %q", ErrNonCanonical, hdr.Name)
+	}
+	n.seen[clean] = hdr.Typeflag
+
+	return append(ret, hdr), nil
+}
@@ -0,0 +1,236 @@
+package tarnorm_test
+
+import (
+	"archive/tar"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/tarnorm"
+)
+
+func TestName(t *testing.T) {
+	t.Parallel()
+	type testcase struct {
+		InName  string
+		InIsDir bool
+		// Expected results; an empty string means that an error is expected, and the error
+		// is checked against ErrOutsideRoot if OutsideRoot is set and ErrNonCanonical
+		// otherwise.
+		Strict      string
+		Lax         string
+		OutsideRoot bool
+	}
+	testcases := map[string]testcase{
+		"file":               {InName: "usr/bin/foo", Strict: "usr/bin/foo", Lax: "usr/bin/foo"},
+		"dir":                {InName: "usr/bin/", InIsDir: true, Strict: "usr/bin/", Lax: "usr/bin/"},
+		"dir-without-slash":  {InName: "usr/bin", InIsDir: true, Lax: "usr/bin/"},
+		"file-with-slash":    {InName: "usr/bin/foo/", Lax: "usr/bin/foo"},
+		"leading-dot-slash":  {InName: "./usr/bin/foo", Lax: "usr/bin/foo"},
+		"leading-slash":      {InName: "/usr/bin/foo", OutsideRoot: true},
+		"leading-slashes":    {InName: "//usr/bin/foo", OutsideRoot: true},
+		"double-slash":       {InName: "usr//bin/foo", Lax: "usr/bin/foo"},
+		"inner-dot":          {InName: "usr/./bin/foo", Lax: "usr/bin/foo"},
+		"inner-dotdot":       {InName: "usr/lib/../bin/foo", Lax: "usr/bin/foo"},
+		"dot-dir":            {InName: "./", InIsDir: true},
+		"dot":                {InName: "."},
+		"empty":              {InName: ""},
+		"root":               {InName: "/", InIsDir: true, OutsideRoot: true},
+		"dotdot":             {InName: "..", OutsideRoot: true},
+		"leading-dotdot":     {InName: "../etc/passwd", OutsideRoot: true},
+		"escaping-dotdot":    {InName: "usr/../../etc/passwd", OutsideRoot: true},
+		"absolute-dotdot":    {InName: "/../etc/passwd", OutsideRoot: true},
+		"whiteout":           {InName: "usr/.wh.foo", Strict: "usr/.wh.foo", Lax: "usr/.wh.foo"},
+		"opaque-whiteout":    {InName: "usr/.wh..wh..opq", Strict: "usr/.wh..wh..opq", Lax: "usr/.wh..wh..opq"},
+		"dotfile":            {InName: ".bashrc", Strict: ".bashrc", Lax: ".bashrc"},
+		"dot-dot-dot":        {InName: "...", Strict: "...", Lax: "..."},
+		"dotdot-prefix-name": {InName: "..foo", Strict: "..foo", Lax: "..foo"},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			for mode, exp := range map[tarnorm.Mode]string{tarnorm.Strict: tcData.Strict, tarnorm.Lax: tcData.Lax} {
+				act, err := tarnorm.Name(tcData.InName, tcData.InIsDir, mode)
+				if exp == "" {
+					assert.Error(t, err, "mode=%v", mode)
+					if tcData.OutsideRoot {
+						assert.True(t, errors.Is(err, tarnorm.ErrOutsideRoot), "mode=%v", mode)
+					} else {
+						assert.True(t, errors.Is(err, tarnorm.ErrNonCanonical), "mode=%v", mode)
+					}
+				} else {
+					assert.NoError(t, err, "mode=%v", mode)
+					assert.Equal(t, exp, act, "mode=%v", mode)
+				}
+			}
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	t.Parallel()
+	type testcase struct {
+		Input     tar.Header
+		Output    tar.Header
+		StrictErr bool
+		LaxErr    bool
+	}
+	testcases := map[string]testcase{
+		"canonical-file": {
+			Input:  tar.Header{Name: "a/b", Typeflag: tar.TypeReg, Mode: 0o644},
+			Output: tar.Header{Name: "a/b", Typeflag: tar.TypeReg, Mode: 0o644},
+		},
+		"canonical-dir": {
+			Input:  tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o755},
+			Output: tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o755},
+		},
+		"setuid": {
+			Input:  tar.Header{Name: "bin/su", Typeflag: tar.TypeReg, Mode: 0o4755},
+			Output: tar.Header{Name: "bin/su", Typeflag: tar.TypeReg, Mode: 0o4755},
+		},
+		"sticky-dir": {
+			Input:  tar.Header{Name: "tmp/", Typeflag: tar.TypeDir, Mode: 0o1777},
+			Output: tar.Header{Name: "tmp/", Typeflag: tar.TypeDir, Mode: 0o1777},
+		},
+		"type-bits-in-mode": {
+			Input:     tar.Header{Name: "a/b", Typeflag: tar.TypeReg, Mode: 0o100644},
+			Output:    tar.Header{Name: "a/b", Typeflag: tar.TypeReg, Mode: 0o644},
+			StrictErr: true,
+		},
+		"dir-type-bits-in-mode": {
+			Input:     tar.Header{Name: "a", Typeflag: tar.TypeDir, Mode: 0o40755},
+			Output:    tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o755},
+			StrictErr: true,
+		},
+		"rega-file": {
+			Input:     tar.Header{Name: "a/b", Typeflag: tar.TypeRegA, Mode: 0o644}, //nolint:staticcheck // testing
+			Output:    tar.Header{Name: "a/b", Typeflag: tar.TypeReg, Mode: 0o644},
+			StrictErr: true,
+		},
+		"rega-dir": {
+			Input:     tar.Header{Name: "a/", Typeflag: tar.TypeRegA, Mode: 0o755}, //nolint:staticcheck // testing
+			Output:    tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o755},
+			StrictErr: true,
+		},
+		"hardlink": {
+			Input:  tar.Header{Name: "a/c", Typeflag: tar.TypeLink, Linkname: "a/b", Mode: 0o644},
+			Output: tar.Header{Name: "a/c", Typeflag: tar.TypeLink, Linkname: "a/b", Mode: 0o644},
+		},
+		"hardlink-unclean": {
+			Input:     tar.Header{Name: "./a/c", Typeflag: tar.TypeLink, Linkname: "./a/b", Mode: 0o644},
+			Output:    tar.Header{Name: "a/c", Typeflag: tar.TypeLink, Linkname: "a/b", Mode: 0o644},
+			StrictErr: true,
+		},
+		"hardlink-outside-root": {
+			Input:     tar.Header{Name: "a/c", Typeflag: tar.TypeLink, Linkname: "../b", Mode: 0o644},
+			StrictErr: true,
+			LaxErr:    true,
+		},
+		"symlink-target-untouched": {
+			Input:  tar.Header{Name: "a/c", Typeflag: tar.TypeSymlink, Linkname: "/../b/./c", Mode: 0o777},
+			Output: tar.Header{Name: "a/c", Typeflag: tar.TypeSymlink, Linkname: "/../b/./c", Mode: 0o777},
+		},
+		"outside-root": {
+			Input:     tar.Header{Name: "../a", Typeflag: tar.TypeReg, Mode: 0o644},
+			StrictErr: true,
+			LaxErr:    true,
+		},
+		"absolute": {
+			Input:     tar.Header{Name: "/etc/passwd", Typeflag: tar.TypeReg, Mode: 0o644},
+			StrictErr: true,
+			LaxErr:    true,
+		},
+		"hardlink-absolute": {
+			Input:     tar.Header{Name: "a/c", Typeflag: tar.TypeLink, Linkname: "/etc/passwd", Mode: 0o644},
+			StrictErr: true,
+			LaxErr:    true,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+
+			strict := tcData.Input // shallow copy
+			err := tarnorm.Header(&strict, tarnorm.Strict)
+			if tcData.StrictErr {
+				assert.Error(t, err)
+				assert.Equal(t, tcData.Input, strict, "Strict must not modify the header on error")
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tcData.Output, strict)
+			}
+
+			lax := tcData.Input // shallow copy
+			err = tarnorm.Header(&lax, tarnorm.Lax)
+			if tcData.LaxErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tcData.Output, lax)
+
+				// Lax output is always canonical.
+				assert.NoError(t, tarnorm.Header(&lax, tarnorm.Strict))
+			}
+		})
+	}
+}
+
+func TestNormalizer(t *testing.T) {
+	t.Parallel()
+	template := &tar.Header{Typeflag: tar.TypeDir, Mode: 0o755, Uname: "root", Gname: "root"}
+
+	names := func(hdrs []*tar.Header) []string {
+		ret := make([]string, 0, len(hdrs))
+		for _, hdr := range hdrs {
+			ret = append(ret, hdr.Name)
+		}
+		return ret
+	}
+
+	t.Run("lax-parents", func(t *testing.T) {
+		t.Parallel()
+		norm := &tarnorm.Normalizer{Mode: tarnorm.Lax, ParentTemplate: template}
+		out, err := norm.Next(&tar.Header{Name: "usr/bin/foo", Typeflag: tar.TypeReg, Mode: 0o755})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"usr/", "usr/bin/", "usr/bin/foo"}, names(out))
+		assert.Equal(t, "root", out[0].Uname)
+		out, err = norm.Next(&tar.Header{Name: "usr/lib/foo", Typeflag: tar.TypeReg, Mode: 0o644})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"usr/lib/", "usr/lib/foo"}, names(out))
+		// Duplicates are permitted in Lax mode.
+		out, err = norm.Next(&tar.Header{Name: "usr/lib/foo", Typeflag: tar.TypeReg, Mode: 0o644})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"usr/lib/foo"}, names(out))
+		// But a file can't be a parent directory.
+		_, err = norm.Next(&tar.Header{Name: "usr/lib/foo/bar", Typeflag: tar.TypeReg, Mode: 0o644})
+		assert.Error(t, err)
+	})
+
+	t.Run("strict-parents", func(t *testing.T) {
+		t.Parallel()
+		norm := &tarnorm.Normalizer{Mode: tarnorm.Strict, ParentTemplate: template}
+		_, err := norm.Next(&tar.Header{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0o755})
+		require.NoError(t, err)
+		_, err = norm.Next(&tar.Header{Name: "usr/bin/foo", Typeflag: tar.TypeReg, Mode: 0o755})
+		assert.True(t, errors.Is(err, tarnorm.ErrNonCanonical))
+	})
+
+	t.Run("strict-no-parents", func(t *testing.T) {
+		t.Parallel()
+		var norm tarnorm.Normalizer
+		out, err := norm.Next(&tar.Header{Name: "usr/bin/foo", Typeflag: tar.TypeReg, Mode: 0o755})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"usr/bin/foo"}, names(out))
+		// Whiteouts may be repeated, but nothing else may.
+		for i := 0; i < 2; i++ {
+			_, err = norm.Next(&tar.Header{Name: "usr/.wh.bar", Typeflag: tar.TypeReg, Mode: 0o644})
+			require.NoError(t, err)
+		}
+		_, err = norm.Next(&tar.Header{Name: "usr/bin/foo", Typeflag: tar.TypeReg, Mode: 0o755})
+		assert.True(t, errors.Is(err, tarnorm.ErrNonCanonical))
+	})
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
 	"text/tabwriter"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	ociv1 "github.com/google/go-containerregistry/pkg/v1"
@@ -18,29 +20,64 @@ import (
 	"github.com/datawire/ocibuild/pkg/fsutil"
 )
 
-func DumpLayerFull(layer ociv1.Layer) (str string, err error) {
-	maybeSetErr := func(_err error) {
-		if _err != nil && err == nil {
-			str = ""
-			err = _err
+// A LayerOption adjusts how DumpLayerFullWithOptions, DumpLayerListingWithOptions, DiffLayers, and
+// AssertEqualLayersWithOptions treat a layer, in order to ignore differences that a test doesn't
+// care about.
+type LayerOption func(*layerConfig)
+
+type layerConfig struct {
+	modifyHeaders []func(*tar.Header)
+	ignoreOrder   bool
+}
+
+// IgnoreMtimes ignores the modification, access, and change times of the files in a layer.
+func IgnoreMtimes() LayerOption {
+	return ModifyHeaders(func(header *tar.Header) {
+		header.ModTime = time.Time{}
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		for _, key := range []string{"mtime", "atime", "ctime"} {
+			delete(header.PAXRecords, key)
 		}
+	})
+}
+
+// IgnoreOrder ignores the order of the files in a layer, by sorting them with fsutil.PathLess.
+func IgnoreOrder() LayerOption {
+	return func(cfg *layerConfig) {
+		cfg.ignoreOrder = true
 	}
+}
 
-	spewConfig := spew.ConfigState{ //nolint:exhaustivestruct
-		Indent:                  "  ",
-		DisableCapacities:       true,
-		DisablePointerAddresses: true,
-		SortKeys:                true,
+// ModifyHeaders calls fn on the tar header of each file in a layer before comparing it; fn may
+// clear any fields that a test doesn't care about.
+func ModifyHeaders(fn func(*tar.Header)) LayerOption {
+	return func(cfg *layerConfig) {
+		cfg.modifyHeaders = append(cfg.modifyHeaders, fn)
 	}
+}
 
-	ret := new(strings.Builder)
+type layerEntry struct {
+	header  *tar.Header
+	content []byte
+}
+
+// readLayer reads all of the files from a layer, along with any trailing data after the end of the
+// tar archive.
+func readLayer(layer ociv1.Layer, opts []LayerOption) (entries []layerEntry, tail []byte, err error) {
+	var cfg layerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 
 	layerReader, err := layer.Uncompressed()
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 	defer func() {
-		maybeSetErr(layerReader.Close())
+		if _err := layerReader.Close(); _err != nil && err == nil {
+			entries, tail, err = nil, nil, _err
+		}
 	}()
 
 	tarReader := tar.NewReader(layerReader)
@@ -50,54 +87,82 @@ func DumpLayerFull(layer ociv1.Layer) (str string, err error) {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return "", err
+			return nil, nil, err
 		}
-
-		if err != nil {
-			return "", err
-		}
-		if _, err := fmt.Fprintf(ret, "tarHeader = %s", spewConfig.Sdump(header)); err != nil {
-			return "", err
-		}
-
 		content, err := io.ReadAll(tarReader)
 		if err != nil {
-			return "", err
+			return nil, nil, err
 		}
-		if _, err := fmt.Fprintf(ret, "tarContent =%s", spewConfig.Sdump(content)); err != nil {
-			return "", err
+		for _, fn := range cfg.modifyHeaders {
+			fn(header)
 		}
+		entries = append(entries, layerEntry{
+			header:  header,
+			content: content,
+		})
+	}
+	if cfg.ignoreOrder {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return fsutil.PathLess(entries[i].header.Name, entries[j].header.Name)
+		})
+	}
+
+	tail, err = io.ReadAll(layerReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, tail, nil
+}
+
+// DumpLayerFull returns a textual dump of every tar header and every byte of file content in a
+// layer, suitable for diffing.
+func DumpLayerFull(layer ociv1.Layer) (string, error) {
+	return DumpLayerFullWithOptions(layer)
+}
+
+// DumpLayerFullWithOptions is like DumpLayerFull, but applies opts to the layer first.
+func DumpLayerFullWithOptions(layer ociv1.Layer, opts ...LayerOption) (string, error) {
+	spewConfig := spew.ConfigState{ //nolint:exhaustivestruct
+		Indent:                  "  ",
+		DisableCapacities:       true,
+		DisablePointerAddresses: true,
+		SortKeys:                true,
 	}
 
-	rest, err := io.ReadAll(layerReader)
+	entries, tail, err := readLayer(layer, opts)
 	if err != nil {
 		return "", err
 	}
-	if _, err := fmt.Fprintf(ret, "tail =\n%s", spewConfig.Sdump(rest)); err != nil {
+
+	ret := new(strings.Builder)
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(ret, "tarHeader = %s", spewConfig.Sdump(entry.header)); err != nil {
+			return "", err
+		}
+		if _, err := fmt.Fprintf(ret, "tarContent =%s", spewConfig.Sdump(entry.content)); err != nil {
+			return "", err
+		}
+	}
+	if _, err := fmt.Fprintf(ret, "tail =\n%s", spewConfig.Sdump(tail)); err != nil {
 		return "", err
 	}
 
 	return ret.String(), nil
 }
 
-func DumpLayerListing(layer ociv1.Layer) (str string, err error) {
-	maybeSetErr := func(_err error) {
-		if _err != nil && err == nil {
-			str = ""
-			err = _err
-		}
-	}
-
-	ret := new(strings.Builder)
+// DumpLayerListing returns an `ls -l`-like listing of the files in a layer.
+func DumpLayerListing(layer ociv1.Layer) (string, error) {
+	return DumpLayerListingWithOptions(layer)
+}
 
-	layerReader, err := layer.Uncompressed()
+// DumpLayerListingWithOptions is like DumpLayerListing, but applies opts to the layer first.
+func DumpLayerListingWithOptions(layer ociv1.Layer, opts ...LayerOption) (string, error) {
+	entries, _, err := readLayer(layer, opts)
 	if err != nil {
 		return "", err
 	}
-	defer func() {
-		maybeSetErr(layerReader.Close())
-	}()
 
+	ret := new(strings.Builder)
 	table := tabwriter.NewWriter(
 		ret, // output
 		0,   // minwidth
@@ -105,19 +170,8 @@ func DumpLayerListing(layer ociv1.Layer) (str string, err error) {
 		1,   // padding
 		' ', // padchar
 		0)   // flags
-	tarReader := tar.NewReader(layerReader)
-	for {
-		header, err := tarReader.Next()
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			return "", err
-		}
-
-		if err != nil {
-			return "", err
-		}
+	for _, entry := range entries {
+		header := entry.header
 		if _, err := fmt.Fprintln(table, strings.Join([]string{
 			"",
 			header.FileInfo().Mode().String(),
@@ -128,10 +182,6 @@ func DumpLayerListing(layer ociv1.Layer) (str string, err error) {
 		}, "\t")); err != nil {
 			return "", err
 		}
-
-		if _, err := io.ReadAll(tarReader); err != nil {
-			return "", err
-		}
 	}
 	if err := table.Flush(); err != nil {
 		return "", err
@@ -140,7 +190,7 @@ func DumpLayerListing(layer ociv1.Layer) (str string, err error) {
 	return ret.String(), nil
 }
 
-func writeLayerToFile(t *testing.T, filename string, layer ociv1.Layer) {
+func writeLayerToFile(t testing.TB, filename string, layer ociv1.Layer) {
 	t.Helper()
 	file, err := os.Create(filename)
 	if err != nil {
@@ -157,23 +207,23 @@ func writeLayerToFile(t *testing.T, filename string, layer ociv1.Layer) {
 	}
 }
 
-func AssertEqualLayers(t *testing.T, exp, act ociv1.Layer) bool {
-	t.Helper()
-	if save, _ := strconv.ParseBool(os.Getenv("GOTEST_OCIBUILD_SAVELAYERS")); save {
-		writeLayerToFile(t, "exp.layer.tar", exp)
-		writeLayerToFile(t, "act.layer.tar", act)
-	}
+// DiffLayers compares two layers file-by-file, returning a human-readable diff of them, or an
+// empty string if they are the same.  The opts are applied to both layers before comparing them.
+//
+// The `ls -l`-like listings of the layers are compared first, since that gives more readable
+// output; the full tar headers and content are only compared if the listings are the same or
+// differ by just a single file.
+func DiffLayers(exp, act ociv1.Layer, opts ...LayerOption) (string, error) {
+	ret := new(strings.Builder)
 
 	// First just compare the listings, in order to "fail fast" and give more readable output.
-	expStr, err := DumpLayerListing(exp)
+	expStr, err := DumpLayerListingWithOptions(exp, opts...)
 	if err != nil {
-		t.Errorf("error dumping expected layer listing: %v", err)
-		return false
+		return "", fmt.Errorf("error dumping expected layer listing: %w", err)
 	}
-	actStr, err := DumpLayerListing(act)
+	actStr, err := DumpLayerListingWithOptions(act, opts...)
 	if err != nil {
-		t.Errorf("error dumping actual layer listing: %v", err)
-		return false
+		return "", fmt.Errorf("error dumping actual layer listing: %w", err)
 	}
 	if expStr != actStr {
 		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{ //nolint:exhaustivestruct
@@ -183,7 +233,7 @@ func AssertEqualLayers(t *testing.T, exp, act ociv1.Layer) bool {
 			ToFile:   "Actual",
 			Context:  1,
 		})
-		t.Errorf("Listing diff:\n%s", diff)
+		fmt.Fprintf(ret, "Listing diff:\n%s", diff)
 		keepGoing := false
 		if lines := strings.Split(diff, "\n"); len(lines) > 3 {
 			var del, add int
@@ -200,20 +250,18 @@ func AssertEqualLayers(t *testing.T, exp, act ociv1.Layer) bool {
 			}
 		}
 		if !keepGoing {
-			return false
+			return ret.String(), nil
 		}
 	}
 
 	// OK, that passed, now dow a comre comprehensive diff.
-	expStr, err = DumpLayerFull(exp)
+	expStr, err = DumpLayerFullWithOptions(exp, opts...)
 	if err != nil {
-		t.Errorf("error dumping expected layer: %v", err)
-		return false
+		return "", fmt.Errorf("error dumping expected layer: %w", err)
 	}
-	actStr, err = DumpLayerFull(act)
+	actStr, err = DumpLayerFullWithOptions(act, opts...)
 	if err != nil {
-		t.Errorf("error dumping actual layer: %v", err)
-		return false
+		return "", fmt.Errorf("error dumping actual layer: %w", err)
 	}
 	if expStr != actStr {
 		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{ //nolint:exhaustivestruct
@@ -223,9 +271,39 @@ func AssertEqualLayers(t *testing.T, exp, act ociv1.Layer) bool {
 			ToFile:   "Actual",
 			Context:  10,
 		})
-		t.Errorf("Full diff:\n%s", diff)
-		return false
+		fmt.Fprintf(ret, "Full diff:\n%s", diff)
+	}
+
+	return ret.String(), nil
+}
+
+// AssertEqualLayers asserts that two layers have the same files, with the same tar headers and
+// content, reporting a diff (see DiffLayers) with t.Errorf if they don't.
+//
+// If $GOTEST_OCIBUILD_SAVELAYERS is true, then the layers are also written to "exp.layer.tar" and
+// "act.layer.tar" in the current directory, for closer inspection.
+func AssertEqualLayers(t *testing.T, exp, act ociv1.Layer) bool {
+	t.Helper()
+	return AssertEqualLayersWithOptions(t, exp, act)
+}
+
+// AssertEqualLayersWithOptions is like AssertEqualLayers, but works with any testing.TB, and
+// applies opts to both layers before comparing them.
+func AssertEqualLayersWithOptions(t testing.TB, exp, act ociv1.Layer, opts ...LayerOption) bool {
+	t.Helper()
+	if save, _ := strconv.ParseBool(os.Getenv("GOTEST_OCIBUILD_SAVELAYERS")); save {
+		writeLayerToFile(t, "exp.layer.tar", exp)
+		writeLayerToFile(t, "act.layer.tar", act)
 	}
 
+	diff, err := DiffLayers(exp, act, opts...)
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	if diff != "" {
+		t.Errorf("%s", diff)
+		return false
+	}
 	return true
 }
@@ -0,0 +1,117 @@
+package testutil_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/testutil"
+)
+
+// recordingTB is a testing.TB that records errors instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingTB) Helper() {}
+
+func (t *recordingTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func makeLayer(t *testing.T, mtime time.Time, names ...string) ociv1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, name := range names {
+		content := []byte("content of " + name)
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{ //nolint:exhaustivestruct
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			ModTime:  mtime,
+		}))
+		_, err := tarWriter.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func TestAssertEqualLayersWithOptions(t *testing.T) {
+	t.Parallel()
+	t1 := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2021, 12, 2, 0, 0, 0, 0, time.UTC)
+
+	testcases := map[string]struct {
+		Exp, Act ociv1.Layer
+		Opts     []testutil.LayerOption
+		Equal    bool
+	}{
+		"identical": {
+			Exp:   makeLayer(t, t1, "a", "b"),
+			Act:   makeLayer(t, t1, "a", "b"),
+			Equal: true,
+		},
+		"mtime": {
+			Exp:   makeLayer(t, t1, "a", "b"),
+			Act:   makeLayer(t, t2, "a", "b"),
+			Equal: false,
+		},
+		"mtime-ignored": {
+			Exp:   makeLayer(t, t1, "a", "b"),
+			Act:   makeLayer(t, t2, "a", "b"),
+			Opts:  []testutil.LayerOption{testutil.IgnoreMtimes()},
+			Equal: true,
+		},
+		"order": {
+			Exp:   makeLayer(t, t1, "a", "b"),
+			Act:   makeLayer(t, t1, "b", "a"),
+			Equal: false,
+		},
+		"order-ignored": {
+			Exp:   makeLayer(t, t1, "a", "b"),
+			Act:   makeLayer(t, t1, "b", "a"),
+			Opts:  []testutil.LayerOption{testutil.IgnoreOrder()},
+			Equal: true,
+		},
+		"missing-file": {
+			Exp:   makeLayer(t, t1, "a", "b"),
+			Act:   makeLayer(t, t2, "a"),
+			Opts:  []testutil.LayerOption{testutil.IgnoreMtimes(), testutil.IgnoreOrder()},
+			Equal: false,
+		},
+		"modify-headers": {
+			Exp: makeLayer(t, t1, "a"),
+			Act: makeLayer(t, t2, "a"),
+			Opts: []testutil.LayerOption{testutil.ModifyHeaders(func(header *tar.Header) {
+				header.ModTime = time.Time{}
+			})},
+			Equal: true,
+		},
+	}
+	for tcName, tcData := range testcases {
+		tcData := tcData
+		t.Run(tcName, func(t *testing.T) {
+			t.Parallel()
+			rec := &recordingTB{TB: t} //nolint:exhaustivestruct
+			equal := testutil.AssertEqualLayersWithOptions(rec, tcData.Exp, tcData.Act, tcData.Opts...)
+			assert.Equal(t, tcData.Equal, equal)
+			assert.Equal(t, tcData.Equal, len(rec.errors) == 0, rec.errors)
+		})
+	}
+}
@@ -0,0 +1,4 @@
+// Package testutil contains helpers for writing tests: comparing layers file-by-file (for checking
+// that a layer is reproducible, or that it matches what another tool produces), and running
+// testing/quick checks with additional static inputs.
+package testutil
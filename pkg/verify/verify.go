@@ -0,0 +1,301 @@
+// Package verify checks the structural correctness of an image: that the digests and sizes in its
+// manifest match its config and layers, that the diffIDs in its config match its layers (in
+// order), that its media types are valid and consistent, and that each layer is a valid tar
+// archive with sensible whiteouts.  These are the sorts of problems that cause some registries to
+// reject an image, while others accept it.
+package verify
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// A Problem is a single problem found by Image.
+type Problem struct {
+	// Object is what the problem is with: "manifest", "config", or "layer N" (counting from 0).
+	Object string `json:"object"`
+	// Check is a short identifier for the kind of problem, such as "digest" or "whiteout".
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Object, p.Check, p.Message)
+}
+
+type problemList []Problem
+
+func (l *problemList) add(object, check, format string, args ...interface{}) {
+	*l = append(*l, Problem{
+		Object:  object,
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// mediaTypeFamily returns "docker" or "oci" for a media type that may appear in an image, or "" if
+// the media type isn't one that belongs in the given role ("manifest", "config", or "layer").
+func mediaTypeFamily(role string, mediaType types.MediaType) string {
+	switch role {
+	case "manifest":
+		switch mediaType {
+		case types.DockerManifestSchema2:
+			return "docker"
+		case types.OCIManifestSchema1:
+			return "oci"
+		}
+	case "config":
+		switch mediaType {
+		case types.DockerConfigJSON:
+			return "docker"
+		case types.OCIConfigJSON:
+			return "oci"
+		}
+	case "layer":
+		switch mediaType {
+		case types.DockerLayer, types.DockerForeignLayer, types.DockerUncompressedLayer:
+			return "docker"
+		case types.OCILayer, types.OCIRestrictedLayer,
+			types.OCIUncompressedLayer, types.OCIUncompressedRestrictedLayer:
+			return "oci"
+		}
+	}
+	return ""
+}
+
+// Image checks img for structural problems.  An error is returned only if img can't be checked at
+// all; problems with the image itself (including layers that can't be read) are returned as
+// Problems.
+func Image(img ociv1.Image) ([]Problem, error) {
+	var problems problemList
+
+	// manifest
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return nil, fmt.Errorf("verify.Image: read manifest: %w", err)
+	}
+	var manifest ociv1.Manifest
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		problems.add("manifest", "syntax", "%v", err)
+		return problems, nil
+	}
+	manifestDigest, err := img.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("verify.Image: manifest digest: %w", err)
+	}
+	if actual := sha256Digest(rawManifest); manifestDigest != actual {
+		problems.add("manifest", "digest", "image reports digest %s, but the manifest's digest is %s",
+			manifestDigest, actual)
+	}
+	if manifest.SchemaVersion != 2 {
+		problems.add("manifest", "schema-version", "schemaVersion is %d, not 2", manifest.SchemaVersion)
+	}
+	family := mediaTypeFamily("manifest", manifest.MediaType)
+	if family == "" {
+		problems.add("manifest", "media-type", "invalid manifest mediaType %q", manifest.MediaType)
+	}
+	checkFamily := func(object, role string, mediaType types.MediaType) {
+		switch fam := mediaTypeFamily(role, mediaType); {
+		case fam == "":
+			problems.add(object, "media-type", "invalid %s mediaType %q", role, mediaType)
+		case family != "" && fam != family:
+			problems.add(object, "media-type", "%s mediaType %q is %s, but the manifest is %s",
+				role, mediaType, fam, family)
+		}
+	}
+
+	// config
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("verify.Image: read config: %w", err)
+	}
+	checkFamily("config", "config", manifest.Config.MediaType)
+	if actual := sha256Digest(rawConfig); manifest.Config.Digest != actual {
+		problems.add("config", "digest", "manifest says %s, actual %s", manifest.Config.Digest, actual)
+	}
+	if actual := int64(len(rawConfig)); manifest.Config.Size != actual {
+		problems.add("config", "size", "manifest says %d, actual %d", manifest.Config.Size, actual)
+	}
+	var config ociv1.ConfigFile
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		problems.add("config", "syntax", "%v", err)
+		return problems, nil
+	}
+	if config.RootFS.Type != "layers" {
+		problems.add("config", "rootfs", "rootfs.type is %q, not \"layers\"", config.RootFS.Type)
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		problems.add("config", "layer-count", "config has %d diff_ids, but the manifest has %d layers",
+			len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+	var nonEmptyHistory int
+	for _, entry := range config.History {
+		if !entry.EmptyLayer {
+			nonEmptyHistory++
+		}
+	}
+	if len(config.History) > 0 && nonEmptyHistory != len(manifest.Layers) {
+		problems.add("config", "history", "config has %d non-empty history entries, but the manifest has %d layers",
+			nonEmptyHistory, len(manifest.Layers))
+	}
+
+	// layers
+	for i, desc := range manifest.Layers {
+		object := fmt.Sprintf("layer %d", i)
+		checkFamily(object, "layer", desc.MediaType)
+		if desc.MediaType == types.DockerForeignLayer {
+			// The content of foreign layers isn't part of the image.
+			continue
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			problems.add(object, "read", "%v", err)
+			continue
+		}
+		var expectedDiffID *ociv1.Hash
+		if i < len(config.RootFS.DiffIDs) {
+			expectedDiffID = &config.RootFS.DiffIDs[i]
+		}
+		checkLayer(&problems, object, desc, expectedDiffID, layer)
+	}
+
+	return problems, nil
+}
+
+func sha256Digest(content []byte) ociv1.Hash {
+	sum := sha256.Sum256(content)
+	return ociv1.Hash{
+		Algorithm: "sha256",
+		Hex:       fmt.Sprintf("%x", sum),
+	}
+}
+
+// countingHasher hashes and counts everything written to it.
+type countingHasher struct {
+	hash hash.Hash
+	size int64
+}
+
+func newCountingHasher() *countingHasher {
+	return &countingHasher{hash: sha256.New(), size: 0}
+}
+
+func (h *countingHasher) Write(p []byte) (int, error) {
+	h.size += int64(len(p))
+	return h.hash.Write(p)
+}
+
+func (h *countingHasher) Digest() ociv1.Hash {
+	return ociv1.Hash{
+		Algorithm: "sha256",
+		Hex:       fmt.Sprintf("%x", h.hash.Sum(nil)),
+	}
+}
+
+func checkLayer(problems *problemList, object string, desc ociv1.Descriptor, diffID *ociv1.Hash, layer ociv1.Layer) {
+	// compressed digest and size
+	compressed, err := layer.Compressed()
+	if err != nil {
+		problems.add(object, "read", "%v", err)
+		return
+	}
+	compressedHash := newCountingHasher()
+	_, err = io.Copy(compressedHash, compressed)
+	_ = compressed.Close()
+	if err != nil {
+		problems.add(object, "read", "%v", err)
+		return
+	}
+	if actual := compressedHash.Digest(); desc.Digest != actual {
+		problems.add(object, "digest", "manifest says %s, actual %s", desc.Digest, actual)
+	}
+	if desc.Size != compressedHash.size {
+		problems.add(object, "size", "manifest says %d, actual %d", desc.Size, compressedHash.size)
+	}
+
+	// diffID and tar validity
+	uncompressed, err := layer.Uncompressed()
+	if err != nil {
+		problems.add(object, "read", "%v", err)
+		return
+	}
+	defer uncompressed.Close()
+	uncompressedHash := newCountingHasher()
+	checkTar(problems, object, io.TeeReader(uncompressed, uncompressedHash))
+	// Hash anything after the end of the tar archive, too.
+	if _, err := io.Copy(uncompressedHash, uncompressed); err != nil {
+		problems.add(object, "read", "%v", err)
+		return
+	}
+	if actual := uncompressedHash.Digest(); diffID != nil && *diffID != actual {
+		problems.add(object, "diff-id", "config says %s, actual %s", *diffID, actual)
+	}
+}
+
+// checkTar checks that r is a valid tar archive, and that its whiteouts make sense: no path is
+// whited out twice, no directory is made opaque twice, and no path is both whited out and present
+// in the same layer (a whiteout only applies to lower layers).
+func checkTar(problems *problemList, object string, r io.Reader) {
+	var (
+		entries   = make(map[string]struct{})
+		whiteouts = make(map[string]int)
+		opaques   = make(map[string]int)
+	)
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				problems.add(object, "tar", "invalid tar archive: %v", err)
+			}
+			break
+		}
+		if _, err := io.Copy(io.Discard, tarReader); err != nil {
+			problems.add(object, "tar", "invalid tar archive: %q: %v", header.Name, err)
+			break
+		}
+		name := path.Clean("/" + header.Name)
+		dir, base := path.Split(name)
+		switch {
+		case base == ".wh..wh..opq":
+			opaques[path.Clean(dir)]++
+		case strings.HasPrefix(base, ".wh."):
+			whiteouts[path.Join(dir, strings.TrimPrefix(base, ".wh."))]++
+		default:
+			entries[name] = struct{}{}
+		}
+	}
+	for _, name := range sortedKeys(whiteouts) {
+		if whiteouts[name] > 1 {
+			problems.add(object, "whiteout", "%q is whited out %d times", name, whiteouts[name])
+		}
+		if _, ok := entries[name]; ok {
+			problems.add(object, "whiteout", "%q is both whited out and present in the same layer", name)
+		}
+	}
+	for _, name := range sortedKeys(opaques) {
+		if opaques[name] > 1 {
+			problems.add(object, "whiteout", "directory %q is made opaque %d times", name, opaques[name])
+		}
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
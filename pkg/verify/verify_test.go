@@ -0,0 +1,133 @@
+package verify_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	ociv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ociv1tarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/verify"
+)
+
+func rawLayer(t *testing.T, content []byte) ociv1.Layer {
+	t.Helper()
+	layer, err := ociv1tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func tarLayer(t *testing.T, names ...string) ociv1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, name := range names {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+		}))
+	}
+	require.NoError(t, tarWriter.Close())
+	return rawLayer(t, buf.Bytes())
+}
+
+// ociLayer is a layer that claims to have the OCI media type.
+type ociLayer struct {
+	ociv1.Layer
+}
+
+func (ociLayer) MediaType() (types.MediaType, error) {
+	return types.OCILayer, nil
+}
+
+func testImage(t *testing.T, layers ...ociv1.Layer) ociv1.Image {
+	t.Helper()
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+	return img
+}
+
+func problemStrings(t *testing.T, img ociv1.Image) []string {
+	t.Helper()
+	problems, err := verify.Image(img)
+	require.NoError(t, err)
+	ret := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		ret = append(ret, problem.String())
+	}
+	return ret
+}
+
+func TestImage(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+		img := testImage(t,
+			tarLayer(t, "etc/foo", "etc/bar"),
+			tarLayer(t, "etc/.wh.foo", "etc/.wh..wh..opq", "etc/baz"))
+		assert.Empty(t, problemStrings(t, img))
+	})
+
+	t.Run("whiteouts", func(t *testing.T) {
+		t.Parallel()
+		img := testImage(t,
+			tarLayer(t, "etc/.wh.foo", "./etc/.wh.foo", "etc/.wh.bar", "etc/bar",
+				"usr/.wh..wh..opq", "usr/.wh..wh..opq"))
+		assert.Equal(t, []string{
+			`layer 0: whiteout: "/etc/bar" is both whited out and present in the same layer`,
+			`layer 0: whiteout: "/etc/foo" is whited out 2 times`,
+			`layer 0: whiteout: directory "/usr" is made opaque 2 times`,
+		}, problemStrings(t, img))
+	})
+
+	t.Run("tar", func(t *testing.T) {
+		t.Parallel()
+		img := testImage(t, rawLayer(t, bytes.Repeat([]byte("not a tar file"), 100)))
+		problems := problemStrings(t, img)
+		require.Len(t, problems, 1)
+		assert.Contains(t, problems[0], "layer 0: tar: invalid tar archive: ")
+	})
+
+	t.Run("diff-ids", func(t *testing.T) {
+		t.Parallel()
+		img := testImage(t, tarLayer(t, "a"), tarLayer(t, "b"))
+		configFile, err := img.ConfigFile()
+		require.NoError(t, err)
+		configFile = configFile.DeepCopy()
+		diffIDs := configFile.RootFS.DiffIDs
+		configFile.RootFS.DiffIDs = []ociv1.Hash{diffIDs[1], diffIDs[0]}
+		img, err = mutate.ConfigFile(img, configFile)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"layer 0: diff-id: config says " + diffIDs[1].String() + ", actual " + diffIDs[0].String(),
+			"layer 1: diff-id: config says " + diffIDs[0].String() + ", actual " + diffIDs[1].String(),
+		}, problemStrings(t, img))
+
+		configFile.RootFS.DiffIDs = diffIDs[:1]
+		img, err = mutate.ConfigFile(img, configFile)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"config: layer-count: config has 1 diff_ids, but the manifest has 2 layers",
+		}, problemStrings(t, img))
+	})
+
+	t.Run("media-types", func(t *testing.T) {
+		t.Parallel()
+		img := testImage(t, tarLayer(t, "a"), ociLayer{tarLayer(t, "b")})
+		assert.Equal(t, []string{
+			`layer 1: media-type: layer mediaType "application/vnd.oci.image.layer.v1.tar+gzip" is oci, ` +
+				`but the manifest is docker`,
+		}, problemStrings(t, img))
+	})
+}
@@ -0,0 +1,146 @@
+// Package warnings collects the warnings from library code (such as "this wheel's Wheel-Version is
+// newer than this parser") as structured values, so that callers can report them (such as in a
+// JSON file) and turn selected classes of them in to errors, rather than them only being logged.
+//
+// Warnings are passed to the Collector associated with the Context; if there isn't one, then they
+// are passed to the fallback Collector (if one is set).  Either way, they are also logged through
+// dlog, as before.
+package warnings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// Class identifies what sort of warning something is, so that Collector.Strict can select it.
+type Class string
+
+const (
+	// WheelVersion is a wheel whose Wheel-Version is newer (but still compatible) than the
+	// version of the wheel spec that ocibuild implements.
+	WheelVersion Class = "wheel-version"
+	// Tags is a wheel whose compatibility tags can't be verified against its filename.
+	Tags Class = "tags"
+	// Record is a wheel with an incomplete RECORD file that is tolerated because of
+	// bdist.WithPermissiveRecord.
+	Record Class = "record"
+	// RepositoryVersion is an index server whose API version is newer (but still compatible)
+	// than the version that ocibuild implements.
+	RepositoryVersion Class = "repository-version"
+	// Yanked is a yanked file (per PEP 592) that is used anyway, because it was pinned.
+	Yanked Class = "yanked"
+
+	// All, as a Collector.Strict entry, selects every class.
+	All Class = "all"
+)
+
+// Classes is the list of all warning classes (not including All).
+//
+//nolint:gochecknoglobals // Would be 'const'.
+var Classes = []Class{WheelVersion, Tags, Record, RepositoryVersion, Yanked}
+
+// ErrStrict is returned (wrapped) by Warnf if the Collector is strict about the warning's class.
+var ErrStrict = errors.New("warning treated as an error")
+
+// A Warning is a single warning.
+type Warning struct {
+	Class   Class  `json:"class"`
+	Message string `json:"message"`
+}
+
+// A Collector records warnings.  It is safe to use from multiple goroutines.
+type Collector struct {
+	// Strict is the list of classes of warnings that should be errors instead (or All).
+	Strict []Class
+
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+func (c *Collector) isStrict(class Class) bool {
+	for _, strict := range c.Strict {
+		if strict == class || strict == All {
+			return true
+		}
+	}
+	return false
+}
+
+// Warnings returns the warnings that have been collected so far, in the order that they were
+// reported.  This includes any that were turned in to errors.
+func (c *Collector) Warnings() []Warning {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Warning(nil), c.warnings...)
+}
+
+// WriteJSON writes the collected warnings to w as a JSON array.
+func (c *Collector) WriteJSON(w io.Writer) error {
+	list := c.Warnings()
+	if list == nil {
+		list = []Warning{}
+	}
+	bs, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bs, '\n'))
+	return err
+}
+
+type collectorContextKey struct{}
+
+// WithCollector returns a copy of ctx that has collector associated with it.
+func WithCollector(ctx context.Context, collector *Collector) context.Context {
+	return context.WithValue(ctx, collectorContextKey{}, collector)
+}
+
+//nolint:gochecknoglobals // Can't be a constant.
+var (
+	fallbackCollector   *Collector
+	fallbackCollectorMu sync.RWMutex
+)
+
+// SetFallbackCollector sets the Collector that is used for a Context that doesn't have a
+// Collector associated with it.  By default there is no fallback Collector, and warnings are only
+// logged.
+func SetFallbackCollector(collector *Collector) {
+	fallbackCollectorMu.Lock()
+	defer fallbackCollectorMu.Unlock()
+	fallbackCollector = collector
+}
+
+func getCollector(ctx context.Context) *Collector {
+	if collector, ok := ctx.Value(collectorContextKey{}).(*Collector); ok {
+		return collector
+	}
+	fallbackCollectorMu.RLock()
+	defer fallbackCollectorMu.RUnlock()
+	return fallbackCollector
+}
+
+// Warnf reports a warning to the Collector associated with ctx, and logs it (with the class as the
+// "warning" field).  If the Collector is strict about the class, then instead of logging it, Warnf
+// returns an error wrapping ErrStrict, which the caller must return; otherwise it returns nil.
+func Warnf(ctx context.Context, class Class, format string, args ...interface{}) error {
+	warning := Warning{
+		Class:   class,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if collector := getCollector(ctx); collector != nil {
+		collector.mu.Lock()
+		collector.warnings = append(collector.warnings, warning)
+		collector.mu.Unlock()
+		if collector.isStrict(class) {
+			return fmt.Errorf("%s: %w (class %q)", warning.Message, ErrStrict, class)
+		}
+	}
+	dlog.Warnln(dlog.WithField(ctx, "warning", string(class)), warning.Message)
+	return nil
+}
@@ -0,0 +1,47 @@
+package warnings_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/ocibuild/pkg/warnings"
+)
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+	collector := &warnings.Collector{ //nolint:exhaustivestruct
+		Strict: []warnings.Class{warnings.Yanked},
+	}
+	ctx := warnings.WithCollector(context.Background(), collector)
+
+	assert.NoError(t, warnings.Warnf(ctx, warnings.Tags, "no tags in %q", "WHEEL"))
+	err := warnings.Warnf(ctx, warnings.Yanked, "foo-1.0 has been yanked")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, warnings.ErrStrict))
+	assert.Contains(t, err.Error(), "foo-1.0 has been yanked")
+
+	assert.Equal(t, []warnings.Warning{
+		{Class: warnings.Tags, Message: `no tags in "WHEEL"`},
+		{Class: warnings.Yanked, Message: "foo-1.0 has been yanked"},
+	}, collector.Warnings())
+
+	var buf bytes.Buffer
+	require.NoError(t, collector.WriteJSON(&buf))
+	assert.JSONEq(t, `[
+		{"class": "tags", "message": "no tags in \"WHEEL\""},
+		{"class": "yanked", "message": "foo-1.0 has been yanked"}
+	]`, buf.String())
+
+	all := &warnings.Collector{Strict: []warnings.Class{warnings.All}} //nolint:exhaustivestruct
+	ctx = warnings.WithCollector(context.Background(), all)
+	assert.Error(t, warnings.Warnf(ctx, warnings.Record, "RECORD is missing"))
+
+	buf.Reset()
+	require.NoError(t, (&warnings.Collector{}).WriteJSON(&buf)) //nolint:exhaustivestruct
+	assert.Equal(t, "[]\n", buf.String())
+}
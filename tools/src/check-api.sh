@@ -0,0 +1,36 @@
+#!/usr/bin/env bash
+# Copyright 2021 Datawire. All rights reserved.
+#
+# Usage: check-api BASE_REVISION
+#
+# Fail if any of the supported packages listed in devdocs/api.md has incompatible API changes
+# since the Git revision BASE_REVISION.
+set -euo pipefail
+
+apidiff=(go run golang.org/x/exp/cmd/apidiff@v0.0.0-20220722155223-a9213eeb770e)
+base=$1
+
+tmp=$(mktemp -d)
+cleanup() {
+	git worktree remove --force "$tmp/base" 2>/dev/null || true
+	rm -rf "$tmp"
+}
+trap cleanup EXIT
+git worktree add --quiet --detach "$tmp/base" "$base"
+
+module=$(go list -m)
+ret=0
+for pkg in $(sed -En 's,^- `\./(pkg/[^`]*)`.*,\1,p' devdocs/api.md); do
+	if ! [[ -d "$tmp/base/$pkg" ]]; then
+		echo "$pkg: new package"
+		continue
+	fi
+	(cd "$tmp/base" && "${apidiff[@]}" -w "$tmp/${pkg//\//_}.api" "$module/$pkg")
+	incompatible=$("${apidiff[@]}" -incompatible "$tmp/${pkg//\//_}.api" "$module/$pkg")
+	if [[ -n "$incompatible" ]]; then
+		echo "$pkg: incompatible changes since $base:"
+		sed 's/^/    /' <<<"$incompatible"
+		ret=1
+	fi
+done
+exit $ret